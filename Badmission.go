@@ -0,0 +1,134 @@
+package manager
+
+// Count-min sketch parameters: sketchDepth rows of saturating counters,
+// halved every sketchResetFactor*width increments so old popularity fades.
+const (
+	sketchDepth       = 4
+	sketchMaxCount    = 15
+	sketchResetFactor = 10
+)
+
+var sketchSeeds = [sketchDepth]uint64{
+	0x9E3779B97F4A7C15, 0xC2B2AE3D27D4EB4F, 0x165667B19E3779F9, 0xD6E8FEB86659FD93,
+}
+
+// frequencySketch estimates how often each page was pinned recently.
+type frequencySketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newFrequencySketch(frames int) *frequencySketch {
+	width := 16
+	for width < 8*frames {
+		width <<= 1
+	}
+	s := &frequencySketch{
+		mask:    uint64(width - 1),
+		resetAt: sketchResetFactor * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *frequencySketch) slot(row int, pageID PageID) uint64 {
+	h := (uint64(pageID) + 1) * sketchSeeds[row]
+	h ^= h >> 31
+	return h & s.mask
+}
+
+func (s *frequencySketch) increment(pageID PageID) {
+	for i := range s.rows {
+		if c := &s.rows[i][s.slot(i, pageID)]; *c < sketchMaxCount {
+			*c++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.age()
+	}
+}
+
+func (s *frequencySketch) estimate(pageID PageID) uint8 {
+	min := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if c := s.rows[i][s.slot(i, pageID)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+func (s *frequencySketch) age() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// admission is the TinyLFU filter in front of eviction.
+type admission struct {
+	sketch *frequencySketch
+	// victimFreq is the frequency of the page claimFrame evicted last, 0
+	// if it claimed an empty frame
+	victimFreq uint8
+	rejected   uint64
+}
+
+// EnableAdmission puts a TinyLFU admission filter in front of eviction.
+// Every pin is counted in a frequency sketch, and a page read on a miss is
+// only admitted into the clock if it has been used more often than the page
+// it replaced. A page that is not admitted is cached like a PinSequential
+// page: its frame is the first to be reused once it is unpinned, unless it
+// is pinned again in the meantime. One-off scans therefore cycle through a
+// handful of frames instead of flushing the working set.
+func (bm *BufferManager) EnableAdmission() {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if bm.admission == nil {
+		bm.admission = &admission{sketch: newFrequencySketch(len(bm.frames))}
+		bm.updateFastPath()
+	}
+}
+
+// AdmissionRejects returns how many missed pages were not admitted.
+func (bm *BufferManager) AdmissionRejects() uint64 {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if bm.admission == nil {
+		return 0
+	}
+	return bm.admission.rejected
+}
+
+func (bm *BufferManager) recordAccess(pageID PageID) {
+	if bm.admission != nil {
+		bm.admission.sketch.increment(pageID)
+	}
+}
+
+func (bm *BufferManager) noteVictim(victim *bufferPage) {
+	if bm.admission == nil {
+		return
+	}
+	bm.admission.victimFreq = 0
+	if victim.valid {
+		bm.admission.victimFreq = bm.admission.sketch.estimate(victim.pageID)
+	}
+}
+
+// admit decides whether a page just read on a miss joins the clock.
+func (bm *BufferManager) admit(pageID PageID) bool {
+	a := bm.admission
+	if a == nil || a.sketch.estimate(pageID) > a.victimFreq {
+		return true
+	}
+	a.rejected++
+	return false
+}
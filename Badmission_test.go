@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestFrequencySketch(t *testing.T) {
+	s := newFrequencySketch(64)
+	counts := make(map[PageID]int)
+	r := rand.New(rand.NewPCG(2, 5))
+	for range s.resetAt - 1 {
+		pageID := PageID(r.IntN(200))
+		counts[pageID]++
+		s.increment(pageID)
+	}
+	// A count-min sketch may overestimate, never underestimate
+	for pageID, n := range counts {
+		if got := s.estimate(pageID); int(got) < min(n, sketchMaxCount) {
+			t.Errorf("estimate(%d) = %d after %d pins", pageID, got, n)
+		}
+	}
+	if got := s.estimate(1000); got > 2 {
+		t.Errorf("estimate of a page never pinned = %d", got)
+	}
+
+	s = newFrequencySketch(8)
+	for range 3 * sketchMaxCount {
+		s.increment(7)
+	}
+	if got := s.estimate(7); got != sketchMaxCount {
+		t.Errorf("estimate after %d pins = %d, want the cap %d", 3*sketchMaxCount, got, sketchMaxCount)
+	}
+	// Counts halve once the sketch has seen resetAt increments
+	for i := range s.resetAt - s.additions {
+		s.increment(PageID(1000 + i))
+	}
+	if got := s.estimate(7); got != sketchMaxCount/2 {
+		t.Errorf("estimate after aging = %d, want %d", got, sketchMaxCount/2)
+	}
+}
+
+// scanMisses warms a hot set of 6 pages in a pool of 8 frames, reads 32
+// other pages once each, and returns how many hot pages the scan evicted
+// and how many cold ones were not admitted.
+func scanMisses(t *testing.T, admission bool) (misses uint64, rejects uint64) {
+	t.Helper()
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	ids := fillPages(t, bm, DefaultFileID, 38)
+	if admission {
+		bm.EnableAdmission()
+		if bm.fastPath.Load() {
+			t.Error("lock-free pins, which the sketch does not see, still on with admission")
+		}
+	}
+	hot, cold := ids[:6], ids[6:]
+	for range 5 {
+		checkPages(t, bm, hot)
+	}
+	checkPages(t, bm, cold)
+	before := bm.Stats().Misses
+	checkPages(t, bm, hot)
+	return bm.Stats().Misses - before, bm.AdmissionRejects()
+}
+
+func TestAdmission(t *testing.T) {
+	misses, rejects := scanMisses(t, false)
+	if misses != 6 || rejects != 0 {
+		t.Errorf("without admission the scan evicted %d hot pages and rejected %d, want 6 and 0", misses, rejects)
+	}
+	// The first cold pages go to the free frames and the clock takes one
+	// hot page before the filter starts rejecting
+	misses, rejects = scanMisses(t, true)
+	if misses > 1 || rejects < 30 {
+		t.Errorf("with admission the scan evicted %d hot pages and rejected %d", misses, rejects)
+	}
+}
@@ -0,0 +1,374 @@
+package manager
+
+import (
+	"errors"
+	"maps"
+	"sync"
+)
+
+// IOFuture is the completion handle of an asynchronous page read or write.
+type IOFuture struct {
+	done chan struct{}
+	err  error
+}
+
+func newIOFuture() *IOFuture {
+	return &IOFuture{done: make(chan struct{})}
+}
+
+func completedFuture(err error) *IOFuture {
+	f := newIOFuture()
+	f.complete(err)
+	return f
+}
+
+func (f *IOFuture) complete(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// Done is closed once the I/O has finished.
+func (f *IOFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the I/O has finished and returns its error.
+func (f *IOFuture) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// OnComplete runs fn on its own goroutine once the I/O has finished.
+func (f *IOFuture) OnComplete(fn func(error)) {
+	go func() {
+		fn(f.Wait())
+	}()
+}
+
+// IOOptions configures the I/O worker pool.
+type IOOptions struct {
+	Workers    int // goroutines issuing disk I/O, default 4
+	QueueDepth int // requests that may wait for a free worker, default 64
+}
+
+type ioPool struct {
+	queue  chan func()
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newIOPool(opts IOOptions) *ioPool {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueDepth <= 0 {
+		opts.QueueDepth = 64
+	}
+
+	p := &ioPool{queue: make(chan func(), opts.QueueDepth)}
+	p.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.queue {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues job, blocking while the queue is full. It returns false once
+// the pool has been stopped.
+func (p *ioPool) submit(job func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	p.queue <- job
+	return true
+}
+
+// trySubmit queues job only if there is room; callers holding the buffer
+// manager lock use it so a full queue can never deadlock against workers.
+func (p *ioPool) trySubmit(job func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *ioPool) stop() {
+	p.mu.Lock()
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// pendingWrite holds the latest image of an evicted page whose write-back
+// has not reached the tablespace yet. mu serializes writes of the same page.
+type pendingWrite struct {
+	mu   sync.Mutex
+	data *[PageSize]byte
+	seq  uint64
+}
+
+// StartIOWorkers routes write-backs of evicted pages and Prefetch reads
+// through a pool of I/O goroutines.
+func (bm *BufferManager) StartIOWorkers(opts IOOptions) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.io != nil {
+		return errors.New("I/O workers already running")
+	}
+	bm.io = newIOPool(opts)
+	return nil
+}
+
+// StopIOWorkers drains the I/O queue and returns the first error an
+// asynchronous write-back hit, if any.
+func (bm *BufferManager) StopIOWorkers() error {
+	bm.mu.Lock()
+	pool := bm.io
+	bm.io = nil
+	bm.mu.Unlock()
+
+	if pool != nil {
+		pool.stop()
+	}
+
+	bm.pendingMu.Lock()
+	defer bm.pendingMu.Unlock()
+	err := bm.asyncErr
+	bm.asyncErr = nil
+	return err
+}
+
+// Prefetch starts loading pageID into the pool without pinning it for the
+// caller. A PinPage issued before the read completes waits for it.
+func (bm *BufferManager) Prefetch(pageID PageID) *IOFuture {
+	bm.mu.Lock()
+
+	if _, exists := bm.pageTable[pageID]; exists {
+		bm.mu.Unlock()
+		return completedFuture(nil)
+	}
+	ts, exists := bm.spaces.get(pageID.FileID())
+	if !exists {
+		bm.mu.Unlock()
+		return completedFuture(errors.New("tablespace does not exist"))
+	}
+	if pageID.PageNo() >= ts.pageCount() {
+		bm.mu.Unlock()
+		return completedFuture(errors.New("page does not exist"))
+	}
+
+	victimIdx, victim, err := bm.claimFrame()
+	if err != nil {
+		bm.mu.Unlock()
+		return completedFuture(err)
+	}
+
+	// The frame stays pinned by the prefetch itself until the read is done
+	victim.reuse(pageID)
+	victim.refBit.Store(true)
+	victim.valid = true
+	victim.loading = make(chan struct{})
+	victim.pins.Store(1)
+	bm.pageTable[pageID] = victimIdx
+	fromPending := bm.readPending(pageID, victim.data)
+	pool := bm.io
+	bm.mu.Unlock()
+
+	future := newIOFuture()
+	load := func() {
+		var err error
+		if !fromPending {
+			err = ts.readPage(pageID.PageNo(), victim.data)
+			bm.stats.pagesRead.Add(1)
+		}
+		bm.finishLoad(victim, err)
+		future.complete(err)
+	}
+	if pool == nil || !pool.submit(load) {
+		load()
+	}
+	return future
+}
+
+func (bm *BufferManager) finishLoad(frame *bufferPage, err error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	frame.pins.Add(-1)
+	frame.pageLSN = GetPageLSN(frame.data)
+	if err != nil {
+		delete(bm.pageTable, frame.pageID)
+		frame.valid = false
+		frame.loadErr = err
+	}
+	close(frame.loading)
+	frame.loading = nil
+	bm.publish(frame)
+}
+
+// waitLoaded blocks until an in-flight Prefetch of the frame finishes. The
+// caller holds bm.mu and a pin on the frame; the lock is dropped while
+// waiting.
+func (bm *BufferManager) waitLoaded(frame *bufferPage) error {
+	loading := frame.loading
+	if loading == nil {
+		return nil
+	}
+	bm.mu.Unlock()
+	<-loading
+	bm.mu.Lock()
+
+	if !frame.valid {
+		frame.pins.Add(-1)
+		return frame.loadErr
+	}
+	return nil
+}
+
+// readPending copies the image of a page still queued for write-back.
+func (bm *BufferManager) readPending(pageID PageID, buf *[PageSize]byte) bool {
+	bm.pendingMu.Lock()
+	defer bm.pendingMu.Unlock()
+
+	pw, exists := bm.pending[pageID]
+	if !exists {
+		return false
+	}
+	*buf = *pw.data
+	return true
+}
+
+func (bm *BufferManager) hasPendingWrites(fileID FileID) bool {
+	bm.pendingMu.Lock()
+	defer bm.pendingMu.Unlock()
+
+	for pageID := range bm.pending {
+		if pageID.FileID() == fileID {
+			return true
+		}
+	}
+	return false
+}
+
+// flushPendingWrites writes the images still queued for asynchronous
+// write-back itself, so that a sync after it covers them. A queued job
+// that runs later writes the same image again.
+func (bm *BufferManager) flushPendingWrites() error {
+	bm.pendingMu.Lock()
+	pending := make(map[PageID]*pendingWrite, len(bm.pending))
+	maps.Copy(pending, bm.pending)
+	bm.pendingMu.Unlock()
+
+	for pageID, pw := range pending {
+		ts, exists := bm.spaces.get(pageID.FileID())
+		if !exists {
+			continue
+		}
+		pw.mu.Lock()
+		bm.pendingMu.Lock()
+		if bm.pending[pageID] != pw {
+			// Written since
+			bm.pendingMu.Unlock()
+			pw.mu.Unlock()
+			continue
+		}
+		data, seq := pw.data, pw.seq
+		bm.pendingMu.Unlock()
+
+		err := ts.writePage(pageID.PageNo(), data)
+
+		bm.pendingMu.Lock()
+		if err == nil {
+			bm.stats.pagesWritten.Add(1)
+			if pw.seq == seq {
+				delete(bm.pending, pageID)
+			}
+		}
+		bm.pendingMu.Unlock()
+		pw.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueWrite records the frame's image as the latest pending write of its
+// page and returns the job that writes it.
+func (bm *BufferManager) queueWrite(ts *tablespace, frame *bufferPage) func() error {
+	pageID := frame.pageID
+	data := *frame.data
+
+	bm.pendingMu.Lock()
+	pw, exists := bm.pending[pageID]
+	if !exists {
+		pw = &pendingWrite{}
+		bm.pending[pageID] = pw
+	}
+	pw.data = &data
+	pw.seq++
+	bm.pendingMu.Unlock()
+
+	return func() error {
+		pw.mu.Lock()
+		defer pw.mu.Unlock()
+
+		bm.pendingMu.Lock()
+		data, seq := pw.data, pw.seq
+		bm.pendingMu.Unlock()
+
+		err := ts.writePage(pageID.PageNo(), data)
+
+		bm.pendingMu.Lock()
+		defer bm.pendingMu.Unlock()
+		if err != nil {
+			// Keep the image so readers still see it
+			if bm.asyncErr == nil {
+				bm.asyncErr = err
+			}
+			return err
+		}
+		bm.stats.pagesWritten.Add(1)
+		if pw.seq == seq && bm.pending[pageID] == pw {
+			delete(bm.pending, pageID)
+		}
+		return nil
+	}
+}
+
+// writeBackAsync hands an evicted frame's write-back to the I/O pool,
+// falling back to writing inline when the queue is full.
+func (bm *BufferManager) writeBackAsync(frame *bufferPage) error {
+	if err := bm.forceLog(frame); err != nil {
+		return err
+	}
+	ts, exists := bm.spaces.get(frame.pageID.FileID())
+	if !exists {
+		return errors.New("tablespace does not exist")
+	}
+
+	write := bm.queueWrite(ts, frame)
+	frame.markClean()
+	bm.notifyFlush(frame.pageID)
+	if !bm.io.trySubmit(func() { write() }) {
+		return write()
+	}
+	return nil
+}
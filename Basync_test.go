@@ -0,0 +1,211 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedBackend is a memory backend whose reads and writes wait for gate
+// to close, and fail with err if it is set.
+type gatedBackend struct {
+	*MemoryBackend
+	gate chan struct{}
+	mu   sync.Mutex
+	err  error
+}
+
+func newGatedBackend() *gatedBackend {
+	return &gatedBackend{MemoryBackend: NewMemoryBackend(), gate: make(chan struct{})}
+}
+
+func (g *gatedBackend) fail(err error) {
+	g.mu.Lock()
+	g.err = err
+	g.mu.Unlock()
+}
+
+func (g *gatedBackend) failure() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+func (g *gatedBackend) ReadPage(pageNo uint64, buf *[PageSize]byte) error {
+	<-g.gate
+	if err := g.failure(); err != nil {
+		return err
+	}
+	return g.MemoryBackend.ReadPage(pageNo, buf)
+}
+
+func (g *gatedBackend) WritePage(pageNo uint64, buf *[PageSize]byte) error {
+	<-g.gate
+	if err := g.failure(); err != nil {
+		return err
+	}
+	return g.MemoryBackend.WritePage(pageNo, buf)
+}
+
+func TestAsyncWriteBack(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 4})
+	backend := newGatedBackend()
+	fileID, err := bm.AttachTablespace(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.StartIOWorkers(IOOptions{Workers: 2, QueueDepth: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.StartIOWorkers(IOOptions{}); err == nil {
+		t.Error("second StartIOWorkers succeeded")
+	}
+
+	// With the backend stalled, evictions queue their write-backs; the
+	// queue has room for all of them, as one written inline would stall
+	ids := fillPages(t, bm, fileID, 8)
+	// Evicted pages come back from their queued images, not the backend
+	checkPages(t, bm, ids)
+	if s := bm.Stats(); s.PagesRead != 0 || s.PagesWritten != 0 {
+		t.Errorf("with writes stalled %d pages read and %d written, want none", s.PagesRead, s.PagesWritten)
+	}
+
+	close(backend.gate)
+	if err := bm.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.StopIOWorkers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, pageID := range ids {
+		var page [PageSize]byte
+		backend.MemoryBackend.ReadPage(pageID.PageNo(), &page)
+		if page != *stamp(uint64(pageID)) {
+			t.Errorf("page %d not written back", pageID.PageNo())
+		}
+	}
+}
+
+func TestAsyncWriteOrder(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 2})
+	backend := newGatedBackend()
+	fileID, _ := bm.AttachTablespace(backend)
+	bm.StartIOWorkers(IOOptions{Workers: 1})
+
+	// The first image of page 0 is queued behind the stalled backend
+	ids := fillPages(t, bm, fileID, 3)
+	data, err := bm.PinPage(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 0xee
+	bm.UnpinPage(ids[0], true)
+
+	// A synchronous write of the newer image waits its turn behind the
+	// queued one, and the queued one must not land after it
+	flushed := make(chan error)
+	go func() { flushed <- bm.FlushPage(ids[0]) }()
+	time.Sleep(10 * time.Millisecond)
+	close(backend.gate)
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.StopIOWorkers(); err != nil {
+		t.Fatal(err)
+	}
+	var page [PageSize]byte
+	backend.MemoryBackend.ReadPage(ids[0].PageNo(), &page)
+	if page[0] != 0xee {
+		t.Errorf("page 0 on the backend starts %#x, want the newer image's 0xee", page[0])
+	}
+}
+
+func TestAsyncWriteError(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 2})
+	backend := newGatedBackend()
+	close(backend.gate)
+	fileID, _ := bm.AttachTablespace(backend)
+	bm.StartIOWorkers(IOOptions{})
+
+	failed := errors.New("disk on fire")
+	backend.fail(failed)
+	fillPages(t, bm, fileID, 6)
+	if err := bm.StopIOWorkers(); !errors.Is(err, failed) {
+		t.Errorf("StopIOWorkers = %v, want the write-back's error", err)
+	}
+	// The error is reported once
+	if err := bm.StopIOWorkers(); err != nil {
+		t.Errorf("second StopIOWorkers = %v", err)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	backend := newGatedBackend()
+	close(backend.gate)
+	fileID, _ := bm.AttachTablespace(backend)
+	ids := fillPages(t, bm, fileID, 16)
+	if err := bm.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	bm.StartIOWorkers(IOOptions{})
+	defer bm.StopIOWorkers()
+
+	// ids[0] was evicted long ago; stall its read
+	backend.gate = make(chan struct{})
+	future := bm.Prefetch(ids[0])
+	select {
+	case <-future.Done():
+		t.Fatal("Prefetch finished with the backend stalled")
+	default:
+	}
+
+	// A pin of the page waits for the read instead of starting another
+	pinned := make(chan error)
+	go func() {
+		data, err := bm.PinPage(ids[0])
+		if err == nil && *data != *stamp(uint64(ids[0])) {
+			err = errors.New("pinned page does not hold its stamp")
+		}
+		pinned <- err
+	}()
+	select {
+	case err := <-pinned:
+		t.Fatalf("PinPage returned during the prefetch: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	completed := make(chan error, 1)
+	future.OnComplete(func(err error) { completed <- err })
+	close(backend.gate)
+	if err := <-pinned; err != nil {
+		t.Fatal(err)
+	}
+	if err := future.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-completed; err != nil {
+		t.Errorf("OnComplete got %v", err)
+	}
+	bm.UnpinPage(ids[0], false)
+	if s := bm.Stats(); s.Hits == 0 {
+		t.Error("pin of a prefetched page did not count as a hit")
+	}
+
+	// Resident pages need no read, missing ones fail
+	if err := bm.Prefetch(ids[0]).Wait(); err != nil {
+		t.Errorf("Prefetch of a resident page: %v", err)
+	}
+	if err := bm.Prefetch(MakePageID(fileID, 16)).Wait(); err == nil {
+		t.Error("Prefetch past the end succeeded")
+	}
+
+	// A failed read leaves nothing behind for the next pin
+	failed := errors.New("bad sector")
+	backend.fail(failed)
+	if err := bm.Prefetch(ids[1]).Wait(); !errors.Is(err, failed) {
+		t.Errorf("Prefetch of an unreadable page = %v", err)
+	}
+	backend.fail(nil)
+	checkPages(t, bm, ids[1:2])
+}
@@ -0,0 +1,456 @@
+package catalog
+
+import (
+	"btree"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"manager"
+	"maps"
+	"slices"
+	"splitordered"
+	"sync"
+)
+
+// The catalog is kept in a chain of meta pages starting at page 0 of its
+// tablespace, which Create reserves. Each page holds, after the common
+// header, the next page of the chain (0 ends it) and a slice of the
+// encoded catalog; the first also holds a magic number and the encoded
+// length:
+//
+//	page 0:  header(16) magic(8) length(8) next(8) data...
+//	page n:  header(16) next(8) data...
+const (
+	catalogMagic      = 0x43415441_4c4f4731 // "CATALOG1"
+	firstHeaderSize   = manager.PageHeaderSize + 24
+	chainHeaderSize   = manager.PageHeaderSize + 8
+	maxIndexName      = 255
+	catalogEntryFixed = 1 + 8 + 2 + 2 // type, root, schema, option count
+)
+
+var (
+	// ErrIndexExists is returned by CreateIndex for a name in use.
+	ErrIndexExists = errors.New("catalog: index already exists")
+	// ErrNoIndex is returned for a name the catalog does not hold.
+	ErrNoIndex = errors.New("catalog: no such index")
+	// ErrNoCatalog is returned by Open for a tablespace without one.
+	ErrNoCatalog = errors.New("catalog: tablespace holds no catalog")
+)
+
+// IndexType is the structure an index is kept in.
+type IndexType uint8
+
+const (
+	BTreeIndex IndexType = iota + 1 // a btree.BTree, for ranges and order
+	HashIndex                       // a splitordered.DiskHash, for equality
+)
+
+func (t IndexType) String() string {
+	switch t {
+	case BTreeIndex:
+		return "btree"
+	case HashIndex:
+		return "hash"
+	}
+	return fmt.Sprintf("IndexType(%d)", uint8(t))
+}
+
+// ColumnType tells how the uint64 keys or values of an index are to be
+// read. The indexes themselves only see uint64s; the type is for the
+// applications sharing the file.
+type ColumnType uint8
+
+const (
+	Uint64  ColumnType = iota
+	Int64              // order-preserving: stored with the sign bit flipped
+	Float64            // order-preserving IEEE 754 bits
+	Time               // Unix nanoseconds
+	PageRef            // a manager.PageID, such as of an overflow value
+)
+
+// KeySchema describes the keys and values of an index.
+type KeySchema struct {
+	Key   ColumnType
+	Value ColumnType
+}
+
+// IndexInfo is a catalog entry.
+type IndexInfo struct {
+	Name    string
+	Type    IndexType
+	Root    manager.PageID
+	Schema  KeySchema
+	Options map[string]string // free-form, such as "unique": "true"
+}
+
+// Catalog maps index names to the indexes of one database file, so that
+// it can host many named indexes instead of a single anonymous tree. Its
+// entries are rewritten in full on every change, which suits the handful
+// of indexes a file holds. Safe for concurrent use, though the indexes it
+// opens are not safe for concurrent writes.
+type Catalog struct {
+	bm     *manager.BufferManager
+	fileID manager.FileID
+
+	mu      sync.Mutex
+	indexes map[string]IndexInfo
+	pages   []manager.PageID // the chain, first at page 0
+}
+
+// Create sets up an empty catalog in a tablespace no page has been
+// allocated in yet, taking its page 0.
+func Create(bm *manager.BufferManager, fileID manager.FileID) (*Catalog, error) {
+	id, data, err := bm.NewPageIn(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if id.PageNo() != 0 {
+		bm.UnpinPage(id, false)
+		return nil, fmt.Errorf("catalog: tablespace %d already has pages", fileID)
+	}
+	manager.SetPageType(data, manager.PageTypeMeta)
+	binary.BigEndian.PutUint64(data[manager.PageHeaderSize:], catalogMagic)
+	if err := bm.UnpinPage(id, true); err != nil {
+		return nil, err
+	}
+	return &Catalog{
+		bm:      bm,
+		fileID:  fileID,
+		indexes: make(map[string]IndexInfo),
+		pages:   []manager.PageID{id},
+	}, nil
+}
+
+// Open reads the catalog of a tablespace.
+func Open(bm *manager.BufferManager, fileID manager.FileID) (*Catalog, error) {
+	c := &Catalog{bm: bm, fileID: fileID, indexes: make(map[string]IndexInfo)}
+	var buf []byte
+	length := 0
+	for id := manager.MakePageID(fileID, 0); ; {
+		data, err := bm.PinPage(id)
+		if err != nil {
+			if len(c.pages) == 0 {
+				return nil, fmt.Errorf("%w: %v", ErrNoCatalog, err)
+			}
+			return nil, err
+		}
+		start := chainHeaderSize
+		if len(c.pages) == 0 {
+			if manager.GetPageType(data) != manager.PageTypeMeta ||
+				binary.BigEndian.Uint64(data[manager.PageHeaderSize:]) != catalogMagic {
+				bm.UnpinPage(id, false)
+				return nil, ErrNoCatalog
+			}
+			length = int(binary.BigEndian.Uint64(data[manager.PageHeaderSize+8:]))
+			start = firstHeaderSize
+		}
+		next := manager.PageID(binary.BigEndian.Uint64(data[start-8:]))
+		if len(buf) < length {
+			buf = append(buf, data[start:]...)
+		}
+		bm.UnpinPage(id, false)
+		c.pages = append(c.pages, id)
+		if next == 0 {
+			break
+		}
+		// Pages past the contents are kept by write, but not a loop
+		if slices.Contains(c.pages, next) {
+			return nil, errors.New("catalog: page chain loops")
+		}
+		id = next
+	}
+	if length > len(buf) {
+		return nil, errors.New("catalog: contents longer than its pages")
+	}
+	infos, err := decodeCatalog(buf[:length])
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		c.indexes[info.Name] = info
+	}
+	return c, nil
+}
+
+// Index is an index opened through the catalog.
+type Index struct {
+	c    *Catalog
+	info IndexInfo
+	tree *btree.BTree
+	hash *splitordered.DiskHash
+}
+
+// CreateIndex creates an empty index of type typ in the catalog's
+// tablespace and records it under name.
+func (c *Catalog) CreateIndex(name string, typ IndexType, schema KeySchema, opts map[string]string) (*Index, error) {
+	if name == "" || len(name) > maxIndexName {
+		return nil, fmt.Errorf("catalog: index name must be 1 to %d bytes", maxIndexName)
+	}
+	if len(opts) > 0xffff {
+		return nil, errors.New("catalog: too many index options")
+	}
+	for k, v := range opts {
+		if len(k) > 0xffff || len(v) > 0xffff {
+			return nil, fmt.Errorf("catalog: index option %.20q too long", k)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.indexes[name]; exists {
+		return nil, ErrIndexExists
+	}
+	ix := &Index{c: c, info: IndexInfo{Name: name, Type: typ, Schema: schema, Options: maps.Clone(opts)}}
+	switch typ {
+	case BTreeIndex:
+		tree, err := btree.NewBTreeIn(c.bm, c.fileID)
+		if err != nil {
+			return nil, err
+		}
+		ix.tree, ix.info.Root = tree, tree.RootPageID()
+	case HashIndex:
+		hash, err := splitordered.NewDiskHashIn(c.bm, c.fileID)
+		if err != nil {
+			return nil, err
+		}
+		ix.hash, ix.info.Root = hash, hash.Root()
+	default:
+		return nil, fmt.Errorf("catalog: unknown index type %v", typ)
+	}
+	if err := c.update(func(m map[string]IndexInfo) { m[name] = ix.info }); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// OpenIndex opens the index recorded under name.
+func (c *Catalog) OpenIndex(name string) (*Index, error) {
+	c.mu.Lock()
+	info, exists := c.indexes[name]
+	c.mu.Unlock()
+	if !exists {
+		return nil, ErrNoIndex
+	}
+	ix := &Index{c: c, info: info}
+	switch info.Type {
+	case BTreeIndex:
+		ix.tree = btree.OpenBTree(c.bm, info.Root)
+	case HashIndex:
+		hash, err := splitordered.OpenDiskHash(c.bm, info.Root)
+		if err != nil {
+			return nil, err
+		}
+		ix.hash = hash
+	default:
+		return nil, fmt.Errorf("catalog: index %q has unknown type %v", name, info.Type)
+	}
+	return ix, nil
+}
+
+// DropIndex removes the index recorded under name from the catalog. Its
+// pages are not freed.
+func (c *Catalog) DropIndex(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.indexes[name]; !exists {
+		return ErrNoIndex
+	}
+	return c.update(func(m map[string]IndexInfo) { delete(m, name) })
+}
+
+// Indexes returns the catalog's entries in name order.
+func (c *Catalog) Indexes() []IndexInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	infos := make([]IndexInfo, 0, len(c.indexes))
+	for _, name := range slices.Sorted(maps.Keys(c.indexes)) {
+		infos = append(infos, c.indexes[name])
+	}
+	return infos
+}
+
+// Pages returns the chain of meta pages the catalog is kept in, starting
+// with page 0.
+func (c *Catalog) Pages() []manager.PageID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.pages)
+}
+
+// Info returns the index's catalog entry as of when it was opened or last
+// synced.
+func (ix *Index) Info() IndexInfo {
+	return ix.info
+}
+
+// Tree returns the tree of a BTreeIndex, or nil.
+func (ix *Index) Tree() *btree.BTree {
+	return ix.tree
+}
+
+// Hash returns the hash index of a HashIndex, or nil.
+func (ix *Index) Hash() *splitordered.DiskHash {
+	return ix.hash
+}
+
+// Sync records the index's root in the catalog if it has moved, as a
+// tree's does when its root splits. Call it after writing to a tree, and
+// before the catalog's pages are flushed.
+func (ix *Index) Sync() error {
+	if ix.tree == nil || ix.tree.RootPageID() == ix.info.Root {
+		return nil
+	}
+	c := ix.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, exists := c.indexes[ix.info.Name]
+	if !exists || info.Root != ix.info.Root {
+		return fmt.Errorf("catalog: index %q was dropped or replaced", ix.info.Name)
+	}
+	info.Root = ix.tree.RootPageID()
+	if err := c.update(func(m map[string]IndexInfo) { m[info.Name] = info }); err != nil {
+		return err
+	}
+	ix.info = info
+	return nil
+}
+
+// update applies change to a copy of the entries, writes them out, and
+// keeps the copy if that succeeds. c.mu must be held.
+func (c *Catalog) update(change func(map[string]IndexInfo)) error {
+	indexes := maps.Clone(c.indexes)
+	change(indexes)
+	infos := make([]IndexInfo, 0, len(indexes))
+	for _, name := range slices.Sorted(maps.Keys(indexes)) {
+		infos = append(infos, indexes[name])
+	}
+	if err := c.write(encodeCatalog(infos)); err != nil {
+		return err
+	}
+	c.indexes = indexes
+	return nil
+}
+
+// write stores buf across the page chain, extending it as needed. Pages
+// the chain no longer needs stay linked, holding nothing.
+func (c *Catalog) write(buf []byte) error {
+	need := 1
+	if rest := len(buf) - (manager.PageSize - firstHeaderSize); rest > 0 {
+		per := manager.PageSize - chainHeaderSize
+		need += (rest + per - 1) / per
+	}
+	for len(c.pages) < need {
+		id, data, err := c.bm.NewPageIn(c.fileID)
+		if err != nil {
+			return err
+		}
+		manager.SetPageType(data, manager.PageTypeMeta)
+		if err := c.bm.UnpinPage(id, true); err != nil {
+			return err
+		}
+		c.pages = append(c.pages, id)
+	}
+
+	for i, id := range c.pages {
+		data, err := c.bm.PinPage(id)
+		if err != nil {
+			return err
+		}
+		start, off := chainHeaderSize, 0
+		if i == 0 {
+			start = firstHeaderSize
+			binary.BigEndian.PutUint64(data[manager.PageHeaderSize+8:], uint64(len(buf)))
+		} else {
+			off = manager.PageSize - firstHeaderSize + (i-1)*(manager.PageSize-chainHeaderSize)
+		}
+		var next manager.PageID
+		if i+1 < len(c.pages) {
+			next = c.pages[i+1]
+		}
+		binary.BigEndian.PutUint64(data[start-8:], uint64(next))
+		clear(data[start:])
+		if off < len(buf) {
+			copy(data[start:], buf[off:])
+		}
+		if err := c.bm.UnpinPage(id, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// An entry is encoded as
+//
+//	nameLen(1) name type(1) root(8) key(1) value(1) optCount(2)
+//	{keyLen(2) key valueLen(2) value}...
+func encodeCatalog(infos []IndexInfo) []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(len(infos)))
+	for _, info := range infos {
+		buf = append(buf, byte(len(info.Name)))
+		buf = append(buf, info.Name...)
+		buf = append(buf, byte(info.Type))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(info.Root))
+		buf = append(buf, byte(info.Schema.Key), byte(info.Schema.Value))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(info.Options)))
+		for _, k := range slices.Sorted(maps.Keys(info.Options)) {
+			buf = appendString(buf, k)
+			buf = appendString(buf, info.Options[k])
+		}
+	}
+	return buf
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+var errCorruptCatalog = errors.New("catalog: corrupt entry")
+
+func decodeCatalog(buf []byte) ([]IndexInfo, error) {
+	if len(buf) < 4 {
+		return nil, errCorruptCatalog
+	}
+	n := binary.BigEndian.Uint32(buf)
+	buf = buf[4:]
+	var infos []IndexInfo
+	for range n {
+		if len(buf) < 1 || len(buf) < 1+int(buf[0])+catalogEntryFixed {
+			return nil, errCorruptCatalog
+		}
+		var info IndexInfo
+		info.Name = string(buf[1 : 1+buf[0]])
+		buf = buf[1+len(info.Name):]
+		info.Type = IndexType(buf[0])
+		info.Root = manager.PageID(binary.BigEndian.Uint64(buf[1:]))
+		info.Schema = KeySchema{Key: ColumnType(buf[9]), Value: ColumnType(buf[10])}
+		opts := int(binary.BigEndian.Uint16(buf[11:]))
+		buf = buf[catalogEntryFixed:]
+		if opts > 0 {
+			info.Options = make(map[string]string, opts)
+		}
+		for range opts {
+			var k, v string
+			var ok bool
+			if k, buf, ok = readString(buf); !ok {
+				return nil, errCorruptCatalog
+			}
+			if v, buf, ok = readString(buf); !ok {
+				return nil, errCorruptCatalog
+			}
+			info.Options[k] = v
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func readString(buf []byte) (string, []byte, bool) {
+	if len(buf) < 2 {
+		return "", buf, false
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if len(buf) < 2+n {
+		return "", buf, false
+	}
+	return string(buf[2 : 2+n]), buf[2+n:], true
+}
@@ -0,0 +1,218 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"manager"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openSpace(t *testing.T, path string) (*manager.BufferManager, manager.FileID) {
+	t.Helper()
+	bm := manager.NewBufferManager()
+	fileID, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bm, fileID
+}
+
+func TestCatalogReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	bm, fileID := openSpace(t, path)
+	c, err := Create(bm, fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := c.CreateIndex("by_id", BTreeIndex, KeySchema{Key: Int64, Value: PageRef}, map[string]string{"unique": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.CreateIndex("by_hash", HashIndex, KeySchema{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 5000
+	for k := range uint64(n) {
+		if err := tree.Tree().Insert(k, k*2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := hash.Hash().Put(k, k*3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := tree.Info().Root
+	if err := tree.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Info().Root == root {
+		t.Fatalf("root did not move after %d inserts", n)
+	}
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bm, fileID = openSpace(t, path)
+	defer bm.Close()
+	c, err = Open(bm, fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := c.Indexes()
+	if len(infos) != 2 || infos[0].Name != "by_hash" || infos[1].Name != "by_id" {
+		t.Fatalf("Indexes = %+v", infos)
+	}
+	if info := infos[1]; info.Type != BTreeIndex || info.Root != tree.Info().Root ||
+		info.Schema != (KeySchema{Int64, PageRef}) || info.Options["unique"] != "true" {
+		t.Errorf("by_id reopened as %+v, want %+v", info, tree.Info())
+	}
+
+	tree, err = c.OpenIndex("by_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err = c.OpenIndex("by_hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range uint64(n) {
+		if v, err := tree.Tree().Get(k); err != nil || v != k*2 {
+			t.Fatalf("tree Get(%d) = %d, %v", k, v, err)
+		}
+		if v, ok, err := hash.Hash().Get(k); err != nil || !ok || v != k*3 {
+			t.Fatalf("hash Get(%d) = %d, %v, %v", k, v, ok, err)
+		}
+	}
+}
+
+func TestCatalogCreateDrop(t *testing.T) {
+	bm := manager.NewBufferManager()
+	defer bm.Close()
+	c, err := Create(bm, manager.DefaultFileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(bm, manager.DefaultFileID); err == nil {
+		t.Error("created a second catalog in the same tablespace")
+	}
+
+	if _, err := c.CreateIndex("a", BTreeIndex, KeySchema{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateIndex("a", HashIndex, KeySchema{}, nil); !errors.Is(err, ErrIndexExists) {
+		t.Errorf("CreateIndex of a taken name: %v, want ErrIndexExists", err)
+	}
+	for _, name := range []string{"", strings.Repeat("x", maxIndexName+1)} {
+		if _, err := c.CreateIndex(name, BTreeIndex, KeySchema{}, nil); err == nil {
+			t.Errorf("CreateIndex accepted a name of %d bytes", len(name))
+		}
+	}
+	if _, err := c.CreateIndex("b", IndexType(9), KeySchema{}, nil); err == nil {
+		t.Error("CreateIndex accepted an unknown type")
+	}
+
+	ix, err := c.OpenIndex("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DropIndex("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DropIndex("a"); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("second DropIndex: %v, want ErrNoIndex", err)
+	}
+	if _, err := c.OpenIndex("a"); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("OpenIndex of a dropped index: %v, want ErrNoIndex", err)
+	}
+	// An index opened before the drop can no longer record its root
+	for k := range uint64(2000) {
+		ix.Tree().Insert(k, k)
+	}
+	if err := ix.Sync(); err == nil {
+		t.Error("Sync of a dropped index succeeded")
+	}
+	if len(c.Indexes()) != 0 {
+		t.Errorf("Indexes = %+v after the drop", c.Indexes())
+	}
+}
+
+func TestCatalogSpansPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	bm, fileID := openSpace(t, path)
+	c, err := Create(bm, fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough entries, with long options, to need a chain of meta pages
+	note := strings.Repeat("n", 500)
+	for i := range 30 {
+		if _, err := c.CreateIndex(fmt.Sprintf("index%02d", i), HashIndex, KeySchema{}, map[string]string{"note": note}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.Pages()) < 3 {
+		t.Fatalf("catalog kept in %d pages, want several", len(c.Pages()))
+	}
+	// Dropping most of them still reads back right
+	for i := range 25 {
+		if err := c.DropIndex(fmt.Sprintf("index%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bm, fileID = openSpace(t, path)
+	defer bm.Close()
+	c, err = Open(bm, fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := c.Indexes()
+	if len(infos) != 5 || infos[0].Name != "index25" || infos[4].Options["note"] != note {
+		t.Errorf("reopened catalog has %d indexes, first %+v", len(infos), infos[0])
+	}
+	if _, err := c.OpenIndex("index29"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenWithoutCatalog(t *testing.T) {
+	bm := manager.NewBufferManager()
+	defer bm.Close()
+	if _, err := Open(bm, manager.DefaultFileID); !errors.Is(err, ErrNoCatalog) {
+		t.Errorf("Open of an empty tablespace: %v, want ErrNoCatalog", err)
+	}
+	id, data, err := bm.NewPageIn(manager.DefaultFileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetPageType(data, manager.PageTypeLeaf)
+	bm.UnpinPage(id, true)
+	if _, err := Open(bm, manager.DefaultFileID); !errors.Is(err, ErrNoCatalog) {
+		t.Errorf("Open of a tablespace with other pages: %v, want ErrNoCatalog", err)
+	}
+}
+
+func TestCatalogEncodingRejectsCorruption(t *testing.T) {
+	infos := []IndexInfo{
+		{Name: "a", Type: BTreeIndex, Root: 7, Schema: KeySchema{Float64, Time}, Options: map[string]string{"k": "v"}},
+		{Name: "b", Type: HashIndex, Root: 9},
+	}
+	buf := encodeCatalog(infos)
+	got, err := decodeCatalog(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "a" || got[0].Schema != infos[0].Schema || got[0].Options["k"] != "v" || got[1].Root != 9 {
+		t.Errorf("decoded %+v, want %+v", got, infos)
+	}
+	for n := range len(buf) {
+		if _, err := decodeCatalog(buf[:n]); err == nil {
+			t.Errorf("decoded a catalog cut to %d of %d bytes", n, len(buf))
+		}
+	}
+}
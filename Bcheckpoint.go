@@ -0,0 +1,265 @@
+package manager
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// checkpointBatch caps how many pages a checkpoint writes back per hold
+// of bm.mu, so pins and evictions go on while it runs.
+const checkpointBatch = maxFlushRun
+
+// DirtyPage is an entry of the dirty page table: a page with logged
+// changes not yet written back, and the LSN of the first of them, from
+// which recovery has to redo it.
+type DirtyPage struct {
+	PageID PageID
+	RecLSN LSN
+}
+
+// ActiveTxn is an entry of the active transaction table: a transaction
+// running at the checkpoint, with the LSNs of its first and last log
+// records, from which recovery undoes it if it never commits. A
+// transaction must stay in the table until the pages it changed are
+// unpinned with UnpinPageWithLSN: until then they are not in the dirty
+// page table, and its FirstLSN is what keeps their log records.
+type ActiveTxn struct {
+	ID       uint64
+	FirstLSN LSN
+	LastLSN  LSN
+}
+
+// CheckpointRecord is what a checkpoint logs for recovery to start from.
+type CheckpointRecord struct {
+	DirtyPages []DirtyPage
+	ActiveTxns []ActiveTxn
+}
+
+// A checkpoint record's data is
+//
+//	dirtyCount(4) { pageID(8) recLSN(8) } txnCount(4) { id(8) first(8) last(8) }
+func encodeCheckpointRecord(rec CheckpointRecord) []byte {
+	buf := make([]byte, 0, 8+16*len(rec.DirtyPages)+24*len(rec.ActiveTxns))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(rec.DirtyPages)))
+	for _, p := range rec.DirtyPages {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(p.PageID))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(p.RecLSN))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(rec.ActiveTxns)))
+	for _, t := range rec.ActiveTxns {
+		buf = binary.LittleEndian.AppendUint64(buf, t.ID)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(t.FirstLSN))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(t.LastLSN))
+	}
+	return buf
+}
+
+// DecodeCheckpointRecord reads the data of a checkpoint record, one with
+// LogRecord.Checkpoint set.
+func DecodeCheckpointRecord(data []byte) (CheckpointRecord, error) {
+	var rec CheckpointRecord
+	errShort := fmt.Errorf("%w: short checkpoint record", ErrCorruptWAL)
+	if len(data) < 4 {
+		return rec, errShort
+	}
+	n := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	if len(data) < 16*n+4 {
+		return rec, errShort
+	}
+	for range n {
+		rec.DirtyPages = append(rec.DirtyPages, DirtyPage{
+			PageID: PageID(binary.LittleEndian.Uint64(data)),
+			RecLSN: LSN(binary.LittleEndian.Uint64(data[8:])),
+		})
+		data = data[16:]
+	}
+	n = int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	if len(data) != 24*n {
+		return rec, errShort
+	}
+	for range n {
+		rec.ActiveTxns = append(rec.ActiveTxns, ActiveTxn{
+			ID:       binary.LittleEndian.Uint64(data),
+			FirstLSN: LSN(binary.LittleEndian.Uint64(data[8:])),
+			LastLSN:  LSN(binary.LittleEndian.Uint64(data[16:])),
+		})
+		data = data[24:]
+	}
+	return rec, nil
+}
+
+// CheckpointLog is the part of a write-ahead log checkpoints need.
+// WALWriter implements it.
+type CheckpointLog interface {
+	LogFlusher
+	// AppendCheckpoint logs rec, makes it durable and records it as the
+	// last checkpoint, where recovery begins, returning its LSN.
+	AppendCheckpoint(rec CheckpointRecord) (LSN, error)
+	// TruncateBefore drops the log segments holding only records before
+	// lsn.
+	TruncateBefore(lsn LSN) error
+}
+
+// CheckpointResult describes a finished checkpoint.
+type CheckpointResult struct {
+	LSN          LSN // of the checkpoint record
+	PagesFlushed int
+	DirtyPages   int // in the record: pages dirtied while it ran
+	ActiveTxns   int
+	// TruncatedBefore is the oldest LSN kept: the earliest of the
+	// record's own LSN, its dirty pages' RecLSNs and its transactions'
+	// FirstLSNs.
+	TruncatedBefore LSN
+}
+
+// CheckpointOptions configures StartCheckpoints.
+type CheckpointOptions struct {
+	Interval time.Duration // between checkpoints, default 1m
+	// ActiveTxns returns the active transaction table. Nil means no
+	// transactions need undoing.
+	ActiveTxns func() []ActiveTxn
+	// OnCheckpoint, if set, is called after every checkpoint with its
+	// result, or the error that stopped it.
+	OnCheckpoint func(CheckpointResult, error)
+}
+
+// DirtyPages returns the dirty page table: the pages with logged changes
+// not yet written back, in RecLSN order. Pages dirtied without an LSN,
+// through UnpinPage, are left out, as recovery has nothing to redo in
+// them.
+func (bm *BufferManager) DirtyPages() []DirtyPage {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.dirtyPages()
+}
+
+func (bm *BufferManager) dirtyPages() []DirtyPage {
+	var pages []DirtyPage
+	for _, frame := range bm.frames {
+		if frame.valid && frame.isDirty && frame.recLSN != 0 {
+			pages = append(pages, DirtyPage{PageID: frame.pageID, RecLSN: frame.recLSN})
+		}
+	}
+	slices.SortFunc(pages, func(a, b DirtyPage) int { return cmp.Compare(a.RecLSN, b.RecLSN) })
+	return pages
+}
+
+// Checkpoint takes a fuzzy checkpoint: it writes back the pages dirty when
+// it starts, oldest RecLSN first and a batch at a time so other work goes
+// on meanwhile, and syncs the tablespaces. It then logs the dirty page
+// table of the pages dirtied since, with the active transaction table
+// activeTxns returns (which may be nil), and truncates the log before the
+// oldest LSN recovery could still need. Recovery then reads no further
+// back than the checkpoint's dirty pages and transactions, which bounds
+// both its time and the log's size. On a write-back or sync error no
+// checkpoint is logged.
+func (bm *BufferManager) Checkpoint(wal CheckpointLog, activeTxns func() []ActiveTxn) (CheckpointResult, error) {
+	var res CheckpointResult
+	pages := bm.DirtyPages()
+	for len(pages) > 0 {
+		n := min(len(pages), checkpointBatch)
+		flushed, err := bm.flushDirtyPages(pages[:n])
+		res.PagesFlushed += flushed
+		if err != nil {
+			return res, err
+		}
+		pages = pages[n:]
+	}
+	// The log before the checkpoint may only go once what the pages were
+	// written back to is durable, asynchronous write-backs included
+	if err := bm.Sync(); err != nil {
+		return res, err
+	}
+
+	var rec CheckpointRecord
+	if activeTxns != nil {
+		rec.ActiveTxns = activeTxns()
+	}
+	rec.DirtyPages = bm.DirtyPages()
+	lsn, err := wal.AppendCheckpoint(rec)
+	if err != nil {
+		return res, err
+	}
+	res.LSN = lsn
+	res.DirtyPages = len(rec.DirtyPages)
+	res.ActiveTxns = len(rec.ActiveTxns)
+
+	// Changes logged before the table was taken but not yet in it are
+	// covered by their transactions' FirstLSNs
+	oldest := lsn
+	for _, p := range rec.DirtyPages {
+		oldest = min(oldest, p.RecLSN)
+	}
+	for _, t := range rec.ActiveTxns {
+		if t.FirstLSN != 0 {
+			oldest = min(oldest, t.FirstLSN)
+		}
+	}
+	if err := wal.TruncateBefore(oldest); err != nil {
+		return res, err
+	}
+	res.TruncatedBefore = oldest
+	return res, nil
+}
+
+// markClean records that a frame has been written back: it drops out of
+// the dirty page table until its next logged change.
+func (frame *bufferPage) markClean() {
+	frame.isDirty = false
+	frame.recLSN = 0
+}
+
+// flushDirtyPages writes back those of pages still dirty, under one hold
+// of bm.mu, and returns how many it wrote.
+func (bm *BufferManager) flushDirtyPages(pages []DirtyPage) (int, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	flushed := 0
+	for _, p := range pages {
+		idx, exists := bm.pageTable[p.PageID]
+		if !exists {
+			// Evicted, and so written back, since the table was taken
+			continue
+		}
+		frame := bm.frames[idx]
+		if !frame.isDirty || frame.loading != nil {
+			continue
+		}
+		if err := bm.writeBack(frame); err != nil {
+			return flushed, err
+		}
+		flushed++
+	}
+	return flushed, nil
+}
+
+// StartCheckpoints takes a checkpoint every opts.Interval until the
+// returned function is called. A checkpoint that fails is retried at the
+// next tick.
+func (bm *BufferManager) StartCheckpoints(wal CheckpointLog, opts CheckpointOptions) (stop func()) {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				res, err := bm.Checkpoint(wal, opts.ActiveTxns)
+				if opts.OnCheckpoint != nil {
+					opts.OnCheckpoint(res, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,238 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// walPages is a buffer manager with one file tablespace and a WALWriter
+// attached, in a temporary directory.
+type walPages struct {
+	dir    string
+	bm     *BufferManager
+	fileID FileID
+	wal    *WALWriter
+}
+
+func newWALPages(t *testing.T) *walPages {
+	t.Helper()
+	dir := t.TempDir()
+	bm := NewBufferManager()
+	fileID, err := bm.CreateTablespace(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal, _, err := OpenWALWriter(filepath.Join(dir, "log.wal"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.SetLogFlusher(wal)
+	return &walPages{dir: dir, bm: bm, fileID: fileID, wal: wal}
+}
+
+// update logs a change to the page and applies it, setting its first
+// payload byte to b.
+func (p *walPages) update(t *testing.T, pageID PageID, b byte) LSN {
+	t.Helper()
+	lsn, err := p.wal.Append([]byte{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.bm.PinPage(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[PageHeaderSize] = b
+	if err := p.bm.UnpinPageWithLSN(pageID, lsn); err != nil {
+		t.Fatal(err)
+	}
+	return lsn
+}
+
+func (p *walPages) newPage(t *testing.T) PageID {
+	t.Helper()
+	pageID, _, err := p.bm.NewPageIn(p.fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.bm.UnpinPage(pageID, true); err != nil {
+		t.Fatal(err)
+	}
+	return pageID
+}
+
+func (p *walPages) segments(t *testing.T) int {
+	t.Helper()
+	segs, err := listWALSegments(filepath.Join(p.dir, "log.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(segs)
+}
+
+func TestCheckpointWritesBackAndLogs(t *testing.T) {
+	p := newWALPages(t)
+	defer p.bm.Close()
+	defer p.wal.Close()
+
+	var pages []PageID
+	for i := range 3 {
+		pageID := p.newPage(t)
+		p.update(t, pageID, byte(i+1))
+		pages = append(pages, pageID)
+	}
+	if got := len(p.bm.DirtyPages()); got != 3 {
+		t.Fatalf("%d dirty pages before the checkpoint, want 3", got)
+	}
+
+	txn := ActiveTxn{ID: 7, FirstLSN: 2, LastLSN: 3}
+	res, err := p.bm.Checkpoint(p.wal, func() []ActiveTxn { return []ActiveTxn{txn} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PagesFlushed != 3 || res.DirtyPages != 0 || res.ActiveTxns != 1 {
+		t.Errorf("result = %+v", res)
+	}
+	if res.LSN != 4 || res.TruncatedBefore != txn.FirstLSN {
+		t.Errorf("checkpoint at %d truncated before %d, want 4 and %d", res.LSN, res.TruncatedBefore, txn.FirstLSN)
+	}
+	if p.wal.FlushedLSN() < res.LSN {
+		t.Errorf("checkpoint record not flushed")
+	}
+
+	// The pages are in the file, not just written to it
+	file, err := os.ReadFile(filepath.Join(p.dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pageID := range pages {
+		if got := file[int(pageID.PageNo())*PageSize+PageHeaderSize]; got != byte(i+1) {
+			t.Errorf("page %d holds %d on disk, want %d", pageID.PageNo(), got, i+1)
+		}
+	}
+}
+
+func TestCheckpointTruncateAndReopen(t *testing.T) {
+	p := newWALPages(t)
+	pageID := p.newPage(t)
+
+	// Each checkpoint closes the segment holding the records before it,
+	// and deletes the previous one
+	for round := range 3 {
+		for b := range 4 {
+			p.update(t, pageID, byte(10*round+b))
+		}
+		res, err := p.bm.Checkpoint(p.wal, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.TruncatedBefore != res.LSN {
+			t.Errorf("round %d: truncated before %d, want %d", round, res.TruncatedBefore, res.LSN)
+		}
+		if n := p.segments(t); n != 1 {
+			t.Errorf("round %d: %d closed segments, want 1", round, n)
+		}
+	}
+	last := p.update(t, pageID, 99)
+	if err := p.wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the last round's records are left, ahead of its checkpoint
+	var replayed []LogRecord
+	wal, rec, err := OpenWALWriter(filepath.Join(p.dir, "log.wal"), func(r LogRecord) error {
+		r.Data = append([]byte(nil), r.Data...)
+		replayed = append(replayed, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if len(replayed) != 6 {
+		t.Fatalf("replayed %d records, want 6", len(replayed))
+	}
+	if replayed[0].Data[0] != 20 || replayed[5].LSN != last || replayed[5].Data[0] != 99 {
+		t.Errorf("replayed %+v", replayed)
+	}
+	ckpt := replayed[4]
+	if !ckpt.Checkpoint || rec.Checkpoint != ckpt.LSN || rec.LastLSN != last {
+		t.Errorf("checkpoint record %+v, recovery %+v", ckpt, rec)
+	}
+	if cr, err := DecodeCheckpointRecord(ckpt.Data); err != nil || len(cr.DirtyPages) != 0 {
+		t.Errorf("DecodeCheckpointRecord = %+v, %v", cr, err)
+	}
+	if lsn, err := wal.Append([]byte{1}); err != nil || lsn != last+1 {
+		t.Errorf("Append after reopen = %d, %v; want %d", lsn, err, last+1)
+	}
+}
+
+func TestCheckpointKeepsActiveTxnLog(t *testing.T) {
+	p := newWALPages(t)
+	defer p.bm.Close()
+	defer p.wal.Close()
+	pageID := p.newPage(t)
+
+	p.update(t, pageID, 1)
+	if _, err := p.bm.Checkpoint(p.wal, nil); err != nil {
+		t.Fatal(err)
+	}
+	first := p.update(t, pageID, 2)
+	txns := func() []ActiveTxn { return []ActiveTxn{{ID: 1, FirstLSN: first}} }
+	for range 3 {
+		p.update(t, pageID, 3)
+		res, err := p.bm.Checkpoint(p.wal, txns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.TruncatedBefore != first {
+			t.Errorf("truncated before %d, want the transaction's first LSN %d", res.TruncatedBefore, first)
+		}
+	}
+
+	// The log still starts at the transaction's first record
+	if n := p.segments(t); n != 0 {
+		t.Errorf("%d closed segments, want 0", n)
+	}
+	data, err := os.ReadFile(filepath.Join(p.dir, "log.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var oldest LSN
+	DecodeWALSegment(data, func(r LogRecord) bool {
+		oldest = r.LSN
+		return false
+	})
+	if oldest != first {
+		t.Errorf("log starts at %d, want %d", oldest, first)
+	}
+
+	if _, err := p.bm.Checkpoint(p.wal, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.segments(t); n != 1 {
+		t.Errorf("%d closed segments once the transaction ended, want 1", n)
+	}
+}
+
+func TestCheckpointRecordRoundTrip(t *testing.T) {
+	rec := CheckpointRecord{
+		DirtyPages: []DirtyPage{{PageID: MakePageID(1, 5), RecLSN: 10}, {PageID: 3, RecLSN: 12}},
+		ActiveTxns: []ActiveTxn{{ID: 9, FirstLSN: 4, LastLSN: 11}},
+	}
+	got, err := DecodeCheckpointRecord(encodeCheckpointRecord(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.DirtyPages) != 2 || got.DirtyPages[0] != rec.DirtyPages[0] || got.DirtyPages[1] != rec.DirtyPages[1] ||
+		len(got.ActiveTxns) != 1 || got.ActiveTxns[0] != rec.ActiveTxns[0] {
+		t.Errorf("decoded %+v, want %+v", got, rec)
+	}
+	if _, err := DecodeCheckpointRecord(encodeCheckpointRecord(rec)[:20]); err == nil {
+		t.Error("decoded a truncated checkpoint record")
+	}
+}
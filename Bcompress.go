@@ -0,0 +1,337 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"slices"
+	"sync"
+)
+
+// A compressed tablespace stores each page in an extent of whole sectors
+// just large enough for it, starting with a header
+//
+//	magic(4) crc(4) pageNo(8) gen(8) length(4)
+//
+// followed by the payload: the page compressed, or the raw page when it
+// did not shrink, marked by a length of PageSize. The CRC covers the rest
+// of the header and the payload. No map of the extents is stored: opening
+// the file scans it for valid headers, and where a page turns up more than
+// once, as its extents move when it grows, the highest gen wins.
+const (
+	sectorSize         = 512
+	compressHeaderSize = 28
+	compressMagic      = "PGZ\x01"
+)
+
+// Compressor compresses page images on write-back and restores them on
+// fetch. FlateCompressor and SnappyCompressor are built in, without
+// dependencies; others, such as an lz4 wrapper, plug in through
+// WithCompression.
+type Compressor interface {
+	Compress(dst, src []byte) ([]byte, error)
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+// WithCompression stores the tablespace's pages compressed with c.
+func WithCompression(c Compressor) TablespaceOption {
+	return func(cfg *tablespaceConfig) {
+		cfg.compressor = c
+	}
+}
+
+// FlateCompressor is a Compressor built on compress/flate.
+type FlateCompressor struct {
+	Level int
+}
+
+func (fc FlateCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst[:0])
+	w, err := flate.NewWriter(buf, fc.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (fc FlateCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	buf := bytes.NewBuffer(dst[:0])
+	if _, err := io.Copy(buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// extent is a run of sectors of a compressed tablespace.
+type extent struct {
+	start, sectors uint64
+}
+
+// pageExtent is where a page is stored, and the gen of that write.
+type pageExtent struct {
+	extent
+	gen uint64
+}
+
+// extentMap maps the pages of a compressed tablespace to their extents and
+// keeps the free ones.
+type extentMap struct {
+	mu    sync.Mutex
+	pages map[uint64]pageExtent
+	free  []extent // by start, coalesced
+	// unsynced are extents given up since the last Sync. They still hold
+	// the last durable image of their page, so they are only reused after
+	// the new image is durable too.
+	unsynced []extent
+	end      uint64 // sectors in the file
+	gen      uint64
+}
+
+func sectorsFor(n int) uint64 {
+	return uint64(n+sectorSize-1) / sectorSize
+}
+
+// alloc returns a free extent of n sectors, first fit, or one at the end
+// of the file.
+func (m *extentMap) alloc(n uint64) extent {
+	for i, e := range m.free {
+		if e.sectors < n {
+			continue
+		}
+		if e.sectors == n {
+			m.free = slices.Delete(m.free, i, i+1)
+		} else {
+			m.free[i] = extent{e.start + n, e.sectors - n}
+		}
+		return extent{e.start, n}
+	}
+	e := extent{m.end, n}
+	m.end += n
+	return e
+}
+
+// release frees e once the tablespace is next synced.
+func (m *extentMap) release(e extent) {
+	if e.sectors > 0 {
+		m.unsynced = append(m.unsynced, e)
+	}
+}
+
+// synced makes the extents released before a Sync reusable.
+func (m *extentMap) synced() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.unsynced {
+		m.addFree(e)
+	}
+	m.unsynced = m.unsynced[:0]
+}
+
+func (m *extentMap) addFree(e extent) {
+	i, _ := slices.BinarySearchFunc(m.free, e.start, func(f extent, start uint64) int {
+		return cmp.Compare(f.start, start)
+	})
+	m.free = slices.Insert(m.free, i, e)
+	// Coalesce with the neighbours
+	if i+1 < len(m.free) && m.free[i].start+m.free[i].sectors == m.free[i+1].start {
+		m.free[i].sectors += m.free[i+1].sectors
+		m.free = slices.Delete(m.free, i+1, i+2)
+	}
+	if i > 0 && m.free[i-1].start+m.free[i-1].sectors == m.free[i].start {
+		m.free[i-1].sectors += m.free[i].sectors
+		m.free = slices.Delete(m.free, i, i+1)
+	}
+}
+
+// parseCompressed checks the header and payload of an extent's data and
+// returns its page number, gen and payload.
+func parseCompressed(data []byte) (pageNo, gen uint64, payload []byte, ok bool) {
+	if len(data) < compressHeaderSize || string(data[:4]) != compressMagic {
+		return 0, 0, nil, false
+	}
+	length := int(binary.BigEndian.Uint32(data[24:]))
+	if length == 0 || length > PageSize || compressHeaderSize+length > len(data) {
+		return 0, 0, nil, false
+	}
+	blob := data[:compressHeaderSize+length]
+	if binary.BigEndian.Uint32(blob[4:]) != crc32.ChecksumIEEE(blob[8:]) {
+		return 0, 0, nil, false
+	}
+	return binary.BigEndian.Uint64(blob[8:]), binary.BigEndian.Uint64(blob[16:]), blob[compressHeaderSize:], true
+}
+
+// loadExtents scans a compressed tablespace for its pages' extents. Every
+// sector not in the newest extent of a page is free.
+func (fb *FileBackend) loadExtents(size int64) error {
+	m := &extentMap{pages: make(map[uint64]pageExtent), end: sectorsFor(int(size))}
+	r := bufio.NewReaderSize(io.NewSectionReader(fb.file, 0, size), 1<<20)
+	buf := make([]byte, 0, compressHeaderSize+PageSize)
+	for s := uint64(0); s < m.end; {
+		buf = buf[:sectorSize]
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		buf = buf[:n]
+		if n < compressHeaderSize || string(buf[:4]) != compressMagic {
+			s++
+			continue
+		}
+		// Read the rest of the extent the header claims, then check it
+		length := int(binary.BigEndian.Uint32(buf[24:]))
+		if length == 0 || length > PageSize {
+			s++
+			continue
+		}
+		if blobLen := compressHeaderSize + length; blobLen > n {
+			rest, _ := r.Peek(blobLen - n)
+			buf = append(buf, rest...)
+		}
+		pageNo, gen, _, ok := parseCompressed(buf)
+		if !ok {
+			s++
+			continue
+		}
+		need := sectorsFor(compressHeaderSize + length)
+		if _, err := r.Discard(int(need*sectorSize) - n); err != nil && err != io.EOF {
+			return err
+		}
+		if old, seen := m.pages[pageNo]; !seen || gen > old.gen {
+			m.pages[pageNo] = pageExtent{extent{s, need}, gen}
+		}
+		m.gen = max(m.gen, gen)
+		s += need
+	}
+	if size > 0 && len(m.pages) == 0 {
+		return errors.New("not a compressed tablespace")
+	}
+
+	used := make([]extent, 0, len(m.pages))
+	var pageCount uint64
+	for pageNo, pe := range m.pages {
+		used = append(used, pe.extent)
+		pageCount = max(pageCount, pageNo+1)
+	}
+	slices.SortFunc(used, func(a, b extent) int { return cmp.Compare(a.start, b.start) })
+	next := uint64(0)
+	for _, e := range used {
+		if e.start > next {
+			m.free = append(m.free, extent{next, e.start - next})
+		}
+		next = e.start + e.sectors
+	}
+	if m.end > next {
+		m.free = append(m.free, extent{next, m.end - next})
+	}
+	fb.extents = m
+	fb.nextPageNo.Store(pageCount)
+	return nil
+}
+
+func (fb *FileBackend) writeCompressed(pageNo uint64, page *[PageSize]byte) error {
+	blob := make([]byte, compressHeaderSize, compressHeaderSize+PageSize)
+	payload, err := fb.compressor.Compress(blob[compressHeaderSize:], page[:])
+	if err != nil {
+		return err
+	}
+	if len(payload) >= PageSize {
+		payload = page[:]
+	}
+	blob = append(blob[:compressHeaderSize], payload...)
+	need := sectorsFor(len(blob))
+
+	m := fb.extents
+	m.mu.Lock()
+	m.gen++
+	gen := m.gen
+	old, exists := m.pages[pageNo]
+	var e extent
+	if exists && old.sectors >= need {
+		// Overwrite in place, as an uncompressed page would be, and free
+		// what the page no longer needs
+		e = extent{old.start, need}
+		m.release(extent{old.start + need, old.sectors - need})
+	} else {
+		e = m.alloc(need)
+		if exists {
+			m.release(old.extent)
+		}
+	}
+	m.pages[pageNo] = pageExtent{e, gen}
+	m.mu.Unlock()
+
+	copy(blob, compressMagic)
+	binary.BigEndian.PutUint64(blob[8:], pageNo)
+	binary.BigEndian.PutUint64(blob[16:], gen)
+	binary.BigEndian.PutUint32(blob[24:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(blob[4:], crc32.ChecksumIEEE(blob[8:]))
+	_, err = fb.file.WriteAt(blob, int64(e.start)*sectorSize)
+	return err
+}
+
+func (fb *FileBackend) readCompressed(pageNo uint64, page *[PageSize]byte) error {
+	m := fb.extents
+	buf := make([]byte, compressHeaderSize+PageSize)
+	for {
+		m.mu.Lock()
+		pe, exists := m.pages[pageNo]
+		m.mu.Unlock()
+		if !exists {
+			clear(page[:])
+			return nil
+		}
+
+		data := buf[:min(pe.sectors*sectorSize, uint64(len(buf)))]
+		n, err := fb.file.ReadAt(data, int64(pe.start)*sectorSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		storedPage, gen, payload, ok := parseCompressed(data[:n])
+		if !ok || storedPage != pageNo || gen != pe.gen {
+			if fb.moved(pageNo, pe) {
+				// Rewritten elsewhere while being read: look again
+				continue
+			}
+			return errors.New("corrupt compressed page")
+		}
+		if len(payload) == PageSize {
+			copy(page[:], payload)
+			return nil
+		}
+		out, err := fb.compressor.Decompress(page[:0], payload)
+		if err != nil {
+			return err
+		}
+		if len(out) != PageSize {
+			return errors.New("corrupt compressed page")
+		}
+		if &out[0] != &page[0] {
+			copy(page[:], out)
+		}
+		return nil
+	}
+}
+
+// moved reports whether the page has been written again since it was
+// found at pe.
+func (fb *FileBackend) moved(pageNo uint64, pe pageExtent) bool {
+	fb.extents.mu.Lock()
+	defer fb.extents.mu.Unlock()
+	return fb.extents.pages[pageNo] != pe
+}
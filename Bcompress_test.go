@@ -0,0 +1,184 @@
+package manager
+
+import (
+	"compress/flate"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// textPage fills a page with repetitive, compressible text.
+func textPage(n int) *[PageSize]byte {
+	var page [PageSize]byte
+	line := fmt.Sprintf("page %d holds a row of ordinary text; ", n)
+	for i := 0; i < PageSize; i += len(line) {
+		copy(page[i:], line)
+	}
+	return &page
+}
+
+// noisePage fills a page with random bytes, which do not compress.
+func noisePage(seed uint64) *[PageSize]byte {
+	var page [PageSize]byte
+	r := rand.New(rand.NewPCG(seed, seed))
+	for i := range page {
+		page[i] = byte(r.Uint32())
+	}
+	return &page
+}
+
+func TestCompressedTablespaceShrinks(t *testing.T) {
+	dir := t.TempDir()
+	const pages = 64
+	compressors := map[string]Compressor{
+		"flate":  FlateCompressor{Level: flate.BestSpeed},
+		"snappy": SnappyCompressor{},
+	}
+	sizes := make(map[string]int64)
+	for _, name := range []string{"plain", "flate", "snappy"} {
+		var opts []TablespaceOption
+		if c := compressors[name]; c != nil {
+			opts = append(opts, WithCompression(c))
+		}
+		bm := NewBufferManager()
+		fileID, err := bm.CreateTablespace(filepath.Join(dir, name), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range pages {
+			pageID, data, err := bm.NewPageIn(fileID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			*data = *textPage(i)
+			if err := bm.UnpinPage(pageID, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := bm.Close(); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[name] = fi.Size()
+	}
+	if sizes["plain"] != pages*PageSize {
+		t.Errorf("plain tablespace is %d bytes, want %d", sizes["plain"], pages*PageSize)
+	}
+	for name := range compressors {
+		if sizes[name] > sizes["plain"]/4 {
+			t.Errorf("%s tablespace is %d bytes, not much below %d", name, sizes[name], sizes["plain"])
+		}
+	}
+
+	// The pages read back after a reopen
+	for name, c := range compressors {
+		bm := NewBufferManager()
+		defer bm.Close()
+		fileID, err := bm.CreateTablespace(filepath.Join(dir, name), WithCompression(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range pages {
+			pageID := MakePageID(fileID, uint64(i))
+			data, err := bm.PinPage(pageID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *data != *textPage(i) {
+				t.Errorf("%s: page %d differs after reopen", name, i)
+			}
+			bm.UnpinPage(pageID, false)
+		}
+	}
+}
+
+func TestCompressedPagesMove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	open := func() *FileBackend {
+		t.Helper()
+		fb, err := OpenFileBackend(path, WithCompression(FlateCompressor{Level: flate.BestSpeed}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fb
+	}
+	check := func(fb *FileBackend, want ...*[PageSize]byte) {
+		t.Helper()
+		if fb.PageCount() != uint64(len(want)) {
+			t.Errorf("PageCount = %d, want %d", fb.PageCount(), len(want))
+		}
+		var got [PageSize]byte
+		for i, w := range want {
+			if err := fb.ReadPage(uint64(i), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != *w {
+				t.Errorf("page %d differs", i)
+			}
+		}
+	}
+	write := func(fb *FileBackend, pageNo uint64, page *[PageSize]byte) {
+		t.Helper()
+		if err := fb.WritePage(pageNo, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fb := open()
+	for range 3 {
+		fb.Allocate()
+	}
+	write(fb, 0, textPage(0))
+	write(fb, 1, textPage(1))
+	write(fb, 2, textPage(2))
+
+	// Page 1 no longer fits its extent and moves to the end of the file,
+	// leaving its old copy behind until the next sync
+	write(fb, 1, noisePage(1))
+	check(fb, textPage(0), noisePage(1), textPage(2))
+	if err := fb.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(path)
+	size := fi.Size()
+	fb.Close()
+
+	fb = open()
+	check(fb, textPage(0), noisePage(1), textPage(2))
+
+	// Shrinking in place frees the rest of the extent, and a new page
+	// reuses the one freed before: the file does not grow
+	write(fb, 1, textPage(11))
+	if err := fb.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	fb.Allocate()
+	write(fb, 3, textPage(13))
+	write(fb, 0, textPage(10))
+	fb.Sync()
+	if fi, _ := os.Stat(path); fi.Size() != size {
+		t.Errorf("file grew from %d to %d bytes", size, fi.Size())
+	}
+	check(fb, textPage(10), textPage(11), textPage(2), textPage(13))
+	fb.Close()
+
+	fb = open()
+	defer fb.Close()
+	check(fb, textPage(10), textPage(11), textPage(2), textPage(13))
+}
+
+func TestCompressedRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, textPage(0)[:], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if fb, err := OpenFileBackend(path, WithCompression(FlateCompressor{})); err == nil {
+		fb.Close()
+		t.Error("opened an uncompressed file as a compressed tablespace")
+	}
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+// directIOAlign is the buffer, offset and length alignment O_DIRECT needs.
+const directIOAlign = 4096
+
+// WithDirectIO opens the tablespace file with O_DIRECT so pages bypass the
+// OS page cache and are cached only once, by the buffer pool. It cannot be
+// combined with WithCompression, whose pages are stored in extents of
+// 512-byte sectors, not aligned blocks.
+func WithDirectIO() TablespaceOption {
+	return func(cfg *tablespaceConfig) {
+		cfg.direct = true
+	}
+}
+
+var alignedPool = sync.Pool{
+	New: func() any {
+		return alignedBuffer(PageSize)
+	},
+}
+
+// alignedBuffer returns a buffer of size bytes aligned to directIOAlign.
+func alignedBuffer(size int) []byte {
+	return alignedBufferTo(size, directIOAlign)
+}
+
+func alignedBufferTo(size, align int) []byte {
+	raw := make([]byte, size+align)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&raw[0])) & uintptr(align-1)); rem != 0 {
+		offset = align - rem
+	}
+	return raw[offset : offset+size : offset+size]
+}
+
+func (fb *FileBackend) checkDirectIO() error {
+	if !fb.direct {
+		return nil
+	}
+	if directIOFlag == 0 {
+		return errors.New("direct I/O not supported on this platform")
+	}
+	if fb.compressor != nil {
+		return errors.New("direct I/O cannot be combined with compression")
+	}
+	return nil
+}
+
+func (fb *FileBackend) readDirect(pageNo uint64, page *[PageSize]byte) error {
+	if isAligned(page[:]) {
+		// Frames come from an aligned slab: read straight into them
+		n, err := fb.file.ReadAt(page[:], int64(pageNo)*PageSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		clear(page[n:])
+		return nil
+	}
+
+	block := alignedPool.Get().([]byte)
+	defer alignedPool.Put(block)
+
+	n, err := fb.file.ReadAt(block, int64(pageNo)*PageSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	copy(page[:], block[:n])
+	clear(page[n:])
+	return nil
+}
+
+func (fb *FileBackend) writeDirect(pageNo uint64, page *[PageSize]byte) error {
+	if isAligned(page[:]) {
+		_, err := fb.file.WriteAt(page[:], int64(pageNo)*PageSize)
+		return err
+	}
+
+	block := alignedPool.Get().([]byte)
+	defer alignedPool.Put(block)
+
+	copy(block, page[:])
+	_, err := fb.file.WriteAt(block, int64(pageNo)*PageSize)
+	return err
+}
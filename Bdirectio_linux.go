@@ -0,0 +1,5 @@
+package manager
+
+import "syscall"
+
+const directIOFlag = syscall.O_DIRECT
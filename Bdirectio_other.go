@@ -0,0 +1,5 @@
+//go:build !linux
+
+package manager
+
+const directIOFlag = 0
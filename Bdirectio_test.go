@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"compress/flate"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+// openDirect creates a tablespace file with direct I/O, skipping the test
+// where the platform or file system does not support it.
+func openDirect(t *testing.T, bm *BufferManager, path string) FileID {
+	t.Helper()
+	if directIOFlag == 0 {
+		t.Skip("no direct I/O on this platform")
+	}
+	fileID, err := bm.CreateTablespace(path, WithDirectIO())
+	if err != nil {
+		t.Skipf("direct I/O: %v", err)
+	}
+	return fileID
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, size := range []int{1, PageSize, 3 * PageSize, PageSize + 100} {
+		b := alignedBuffer(size)
+		if len(b) != size || cap(b) != size || !isAligned(b) {
+			t.Errorf("alignedBuffer(%d): length %d, capacity %d, aligned %v", size, len(b), cap(b), isAligned(b))
+		}
+	}
+	b := alignedBufferTo(PageSize, hugePageSize)
+	if addr := uintptr(unsafe.Pointer(&b[0])); len(b) != PageSize || addr%hugePageSize != 0 {
+		t.Errorf("alignedBufferTo huge page: %d bytes at %#x", len(b), addr)
+	}
+	if isAligned(b[1:]) {
+		t.Error("isAligned of a buffer one byte in")
+	}
+}
+
+func TestDirectIO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "direct")
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 4})
+	fileID := openDirect(t, bm, path)
+	// Pages go out through evictions one at a time and through FlushAll
+	// in coalesced runs
+	ids := fillPages(t, bm, fileID, 20)
+	if err := bm.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	checkPages(t, bm, ids)
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file reads the same without direct I/O, and through buffers
+	// that are not aligned, which go through a bounce buffer
+	fb, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Close()
+	direct, err := OpenFileBackend(path, WithDirectIO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer direct.Close()
+	var unaligned struct {
+		pad  byte
+		page [PageSize]byte
+	}
+	if isAligned(unaligned.page[:]) {
+		t.Fatal("test buffer is aligned")
+	}
+	for _, pageID := range ids {
+		var page [PageSize]byte
+		if err := fb.ReadPage(pageID.PageNo(), &page); err != nil {
+			t.Fatal(err)
+		}
+		if err := direct.ReadPage(pageID.PageNo(), &unaligned.page); err != nil {
+			t.Fatal(err)
+		}
+		want := stamp(uint64(pageID))
+		if page != *want || unaligned.page != *want {
+			t.Fatalf("page %d differs read back", pageID.PageNo())
+		}
+	}
+	unaligned.page = *stamp(99)
+	if err := direct.WritePage(3, &unaligned.page); err != nil {
+		t.Fatal(err)
+	}
+	var page [PageSize]byte
+	if err := fb.ReadPage(3, &page); err != nil || page != *stamp(99) {
+		t.Errorf("write through a bounce buffer read back wrong, %v", err)
+	}
+	// Past the end reads as zeroes
+	if err := direct.ReadPage(100, &unaligned.page); err != nil || unaligned.page != [PageSize]byte{} {
+		t.Errorf("read past the end: %v", err)
+	}
+}
+
+func TestDirectIOWithCompression(t *testing.T) {
+	if directIOFlag == 0 {
+		t.Skip("no direct I/O on this platform")
+	}
+	_, err := OpenFileBackend(filepath.Join(t.TempDir(), "f"), WithDirectIO(), WithCompression(FlateCompressor{Level: flate.BestSpeed}))
+	if err == nil {
+		t.Error("direct I/O with compression opened")
+	}
+}
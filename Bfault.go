@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Errors returned by a tablespace with fault injection enabled.
+var (
+	ErrInjectedRead  = errors.New("injected read error")
+	ErrInjectedWrite = errors.New("injected write error")
+	ErrTornWrite     = errors.New("injected torn write")
+)
+
+// tornWriteUnit is the granularity of a torn write: a disk sector.
+const tornWriteUnit = 512
+
+// FaultConfig describes the storage failures a FaultInjector simulates.
+// Rates are probabilities between 0 and 1 per page read or write.
+type FaultConfig struct {
+	ReadLatency    time.Duration
+	WriteLatency   time.Duration
+	ReadErrorRate  float64
+	WriteErrorRate float64
+	// TornWriteRate is the chance that a write persists only a prefix of
+	// the page, a whole number of sectors, before failing with ErrTornWrite.
+	TornWriteRate float64
+	Seed          int64
+}
+
+// FaultStats counts the faults injected so far.
+type FaultStats struct {
+	ReadErrors  uint64
+	WriteErrors uint64
+	TornWrites  uint64
+}
+
+// FaultInjector wraps a tablespace's page I/O for tests of the layers above
+// the buffer manager (B+Tree, WAL, recovery) against unreliable storage.
+// Attach it with InjectFaults.
+type FaultInjector struct {
+	mu    sync.Mutex
+	cfg   FaultConfig
+	rng   *rand.Rand
+	stats FaultStats
+}
+
+func NewFaultInjector(cfg FaultConfig) *FaultInjector {
+	return &FaultInjector{cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Configure replaces the injector's configuration, e.g. to switch faults
+// off before verifying what survived.
+func (fi *FaultInjector) Configure(cfg FaultConfig) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.cfg = cfg
+	fi.rng = rand.New(rand.NewSource(cfg.Seed))
+}
+
+func (fi *FaultInjector) Stats() FaultStats {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.stats
+}
+
+// beforeRead sleeps for the read latency and decides whether the read fails.
+func (fi *FaultInjector) beforeRead() error {
+	fi.mu.Lock()
+	latency := fi.cfg.ReadLatency
+	fail := fi.rng.Float64() < fi.cfg.ReadErrorRate
+	if fail {
+		fi.stats.ReadErrors++
+	}
+	fi.mu.Unlock()
+
+	time.Sleep(latency)
+	if fail {
+		return ErrInjectedRead
+	}
+	return nil
+}
+
+// beforeWrite sleeps for the write latency and decides the write's fate:
+// an error, or a torn write that keeps only the first torn bytes (torn > 0).
+func (fi *FaultInjector) beforeWrite() (torn int, err error) {
+	fi.mu.Lock()
+	latency := fi.cfg.WriteLatency
+	switch r := fi.rng.Float64(); {
+	case r < fi.cfg.WriteErrorRate:
+		fi.stats.WriteErrors++
+		err = ErrInjectedWrite
+	case r < fi.cfg.WriteErrorRate+fi.cfg.TornWriteRate:
+		fi.stats.TornWrites++
+		torn = (1 + fi.rng.Intn(PageSize/tornWriteUnit-1)) * tornWriteUnit
+	}
+	fi.mu.Unlock()
+
+	time.Sleep(latency)
+	return torn, err
+}
+
+// InjectFaults routes every page read and write of the tablespace through
+// fi. A nil fi switches fault injection off again.
+func (bm *BufferManager) InjectFaults(fileID FileID, fi *FaultInjector) error {
+	ts, exists := bm.spaces.get(fileID)
+	if !exists {
+		return errors.New("tablespace does not exist")
+	}
+	ts.faults.Store(fi)
+	return nil
+}
+
+func (ts *tablespace) faultyRead(fi *FaultInjector, pageNo uint64, buf *[PageSize]byte) error {
+	if err := fi.beforeRead(); err != nil {
+		return err
+	}
+	return ts.backend.ReadPage(pageNo, buf)
+}
+
+func (ts *tablespace) faultyWrite(fi *FaultInjector, pageNo uint64, buf *[PageSize]byte) error {
+	torn, err := fi.beforeWrite()
+	if err != nil {
+		return err
+	}
+	if torn == 0 {
+		return ts.backend.WritePage(pageNo, buf)
+	}
+
+	// Only the leading sectors of the new image reach storage
+	var mixed [PageSize]byte
+	if err := ts.backend.ReadPage(pageNo, &mixed); err != nil {
+		return err
+	}
+	copy(mixed[:torn], buf[:torn])
+	if err := ts.backend.WritePage(pageNo, &mixed); err != nil {
+		return err
+	}
+	return ErrTornWrite
+}
@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaultInjection(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 4})
+	backend := NewMemoryBackend()
+	fileID, err := bm.AttachTablespace(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := fillPages(t, bm, fileID, 8)
+	if err := bm.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.InjectFaults(fileID+1, NewFaultInjector(FaultConfig{})); err == nil {
+		t.Error("InjectFaults on a missing tablespace succeeded")
+	}
+
+	// Every read fails, and a failed read leaves the page to be read again
+	fi := NewFaultInjector(FaultConfig{ReadErrorRate: 1})
+	if err := bm.InjectFaults(fileID, fi); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bm.PinPage(ids[0]); !errors.Is(err, ErrInjectedRead) {
+		t.Errorf("PinPage with failing reads: %v, want ErrInjectedRead", err)
+	}
+	if s := bm.Stats(); s.Pinned != 0 || s.Resident != 3 {
+		t.Errorf("after a failed read %d pages are pinned and %d resident, want 0 and 3", s.Pinned, s.Resident)
+	}
+	fi.Configure(FaultConfig{})
+	checkPages(t, bm, ids)
+
+	// A failed write keeps the page dirty for a later flush
+	data, _ := bm.PinPage(ids[0])
+	data[0] ^= 0xff
+	bm.UnpinPage(ids[0], true)
+	fi.Configure(FaultConfig{WriteErrorRate: 1})
+	if err := bm.FlushPage(ids[0]); !errors.Is(err, ErrInjectedWrite) {
+		t.Errorf("FlushPage with failing writes: %v, want ErrInjectedWrite", err)
+	}
+	if s := bm.Stats(); s.Dirty != 1 {
+		t.Errorf("%d dirty pages after a failed write, want 1", s.Dirty)
+	}
+	fi.Configure(FaultConfig{})
+	if err := bm.FlushPage(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	var page [PageSize]byte
+	backend.ReadPage(ids[0].PageNo(), &page)
+	if page != *data {
+		t.Error("the page flushed after a failed write is not the latest image")
+	}
+	if got := fi.Stats(); got != (FaultStats{ReadErrors: 1, WriteErrors: 1}) {
+		t.Errorf("Stats() = %+v", got)
+	}
+
+	// No faults injected once switched off
+	if err := bm.InjectFaults(fileID, nil); err != nil {
+		t.Fatal(err)
+	}
+	fi.Configure(FaultConfig{ReadErrorRate: 1, WriteErrorRate: 1})
+	checkPages(t, bm, ids[1:])
+}
+
+func TestTornWrite(t *testing.T) {
+	bm := NewBufferManager()
+	backend := NewMemoryBackend()
+	fileID, err := bm.AttachTablespace(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := fillPages(t, bm, fileID, 1)
+	if err := bm.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	fi := NewFaultInjector(FaultConfig{TornWriteRate: 1, Seed: 3})
+	bm.InjectFaults(fileID, fi)
+
+	for range 20 {
+		data, _ := bm.PinPage(ids[0])
+		var old [PageSize]byte
+		backend.ReadPage(ids[0].PageNo(), &old)
+		for i := range data {
+			data[i]++
+		}
+		bm.UnpinPage(ids[0], true)
+		if err := bm.FlushPage(ids[0]); !errors.Is(err, ErrTornWrite) {
+			t.Fatalf("FlushPage with torn writes: %v, want ErrTornWrite", err)
+		}
+
+		// Storage holds whole sectors of the new image, then the old
+		var page [PageSize]byte
+		backend.ReadPage(ids[0].PageNo(), &page)
+		torn := 0
+		for torn < PageSize && page[torn] == data[torn] {
+			torn++
+		}
+		if torn == 0 || torn == PageSize || torn%tornWriteUnit != 0 || !bytes.Equal(page[torn:], old[torn:]) {
+			t.Fatalf("torn write kept %d bytes of the new image and not the old rest", torn)
+		}
+	}
+	if got := fi.Stats(); got.TornWrites != 20 {
+		t.Errorf("%d torn writes, want 20", got.TornWrites)
+	}
+}
+
+func TestFaultRatesAndLatency(t *testing.T) {
+	// The same seed fails the same I/Os
+	cfg := FaultConfig{ReadErrorRate: 0.3, WriteErrorRate: 0.2, TornWriteRate: 0.1, Seed: 7}
+	var runs [2]FaultStats
+	for i := range runs {
+		fi := NewFaultInjector(cfg)
+		for range 1000 {
+			fi.beforeRead()
+			fi.beforeWrite()
+		}
+		runs[i] = fi.Stats()
+	}
+	if runs[0] != runs[1] {
+		t.Errorf("two runs of seed 7 injected %+v and %+v", runs[0], runs[1])
+	}
+	if s := runs[0]; s.ReadErrors < 250 || s.ReadErrors > 350 || s.WriteErrors < 150 || s.WriteErrors > 250 ||
+		s.TornWrites < 60 || s.TornWrites > 140 {
+		t.Errorf("1000 reads and writes injected %+v, want about 300, 200 and 100", s)
+	}
+
+	fi := NewFaultInjector(FaultConfig{ReadLatency: 20 * time.Millisecond, WriteLatency: 10 * time.Millisecond})
+	start := time.Now()
+	fi.beforeRead()
+	fi.beforeWrite()
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("a read and a write took %v, want 30ms of latency", d)
+	}
+}
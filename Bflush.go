@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"errors"
+	"sort"
+)
+
+// maxFlushRun caps how many consecutive pages go into one coalesced write.
+const maxFlushRun = 64
+
+// FlushAll writes back every dirty page. Runs of dirty pages with
+// consecutive page numbers in the same tablespace are written with a single
+// large write instead of one write per page.
+func (bm *BufferManager) FlushAll() error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.flushDirty()
+}
+
+func (bm *BufferManager) flushDirty() error {
+	var dirty []*bufferPage
+	for _, frame := range bm.frames {
+		if frame.valid && frame.isDirty && frame.loading == nil {
+			dirty = append(dirty, frame)
+		}
+	}
+	sort.Slice(dirty, func(i, j int) bool {
+		return dirty[i].pageID < dirty[j].pageID
+	})
+
+	var firstErr error
+	for i := 0; i < len(dirty); {
+		j := i + 1
+		for j < len(dirty) && j-i < maxFlushRun &&
+			dirty[j].pageID == dirty[j-1].pageID+1 &&
+			dirty[j].pageID.FileID() == dirty[i].pageID.FileID() {
+			j++
+		}
+		if err := bm.writeRun(dirty[i:j]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		i = j
+	}
+	return firstErr
+}
+
+// runWriter is a backend that can write consecutive pages with one write.
+type runWriter interface {
+	// runBuffer returns a buffer for n pages, or nil if the backend
+	// cannot take them as one run.
+	runBuffer(n int) []byte
+	writeRun(pageNo uint64, buf []byte) error
+}
+
+// writeRun writes back frames holding consecutive pages of one tablespace.
+func (bm *BufferManager) writeRun(run []*bufferPage) error {
+	ts, exists := bm.spaces.get(run[0].pageID.FileID())
+	if !exists {
+		return errors.New("tablespace does not exist")
+	}
+	// Only uncompressed files gain from coalescing, the asynchronous path
+	// has to order writes through the pending queue, and injected faults
+	// apply page by page
+	var buf []byte
+	rw, canRun := ts.backend.(runWriter)
+	if canRun && len(run) > 1 && bm.io == nil && ts.faults.Load() == nil {
+		buf = rw.runBuffer(len(run))
+	}
+	if buf == nil {
+		var firstErr error
+		for _, frame := range run {
+			if err := bm.writeBack(frame); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	// One log force covers the whole run
+	latest := run[0]
+	for _, frame := range run[1:] {
+		if frame.pageLSN > latest.pageLSN {
+			latest = frame
+		}
+	}
+	if err := bm.forceLog(latest); err != nil {
+		return err
+	}
+
+	for i, frame := range run {
+		copy(buf[i*PageSize:], frame.data[:])
+	}
+	if err := rw.writeRun(run[0].pageID.PageNo(), buf); err != nil {
+		return err
+	}
+
+	for _, frame := range run {
+		frame.markClean()
+		bm.stats.pagesWritten.Add(1)
+		bm.notifyFlush(frame.pageID)
+	}
+	return nil
+}
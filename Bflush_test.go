@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// pageWrite is one write a countingBackend saw: n pages from pageNo on.
+type pageWrite struct {
+	pageNo uint64
+	n      int
+}
+
+// countingBackend is a file backend that records its writes, and fails
+// those starting at failAt once fail is set.
+type countingBackend struct {
+	*FileBackend
+	mu     sync.Mutex
+	writes []pageWrite
+	fail   error
+	failAt uint64
+}
+
+func newCountingBackend(t *testing.T) *countingBackend {
+	t.Helper()
+	fb, err := OpenFileBackend(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingBackend{FileBackend: fb}
+}
+
+func (cb *countingBackend) record(pageNo uint64, n int) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.fail != nil && pageNo == cb.failAt {
+		return cb.fail
+	}
+	cb.writes = append(cb.writes, pageWrite{pageNo, n})
+	return nil
+}
+
+func (cb *countingBackend) WritePage(pageNo uint64, buf *[PageSize]byte) error {
+	if err := cb.record(pageNo, 1); err != nil {
+		return err
+	}
+	return cb.FileBackend.WritePage(pageNo, buf)
+}
+
+func (cb *countingBackend) writeRun(pageNo uint64, buf []byte) error {
+	if err := cb.record(pageNo, len(buf)/PageSize); err != nil {
+		return err
+	}
+	return cb.FileBackend.writeRun(pageNo, buf)
+}
+
+// take returns the writes seen so far and forgets them.
+func (cb *countingBackend) take() []pageWrite {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	writes := cb.writes
+	cb.writes = nil
+	return writes
+}
+
+// dirty pins each page and unpins it dirty.
+func dirty(t *testing.T, bm *BufferManager, ids ...PageID) {
+	t.Helper()
+	for _, pageID := range ids {
+		if _, err := bm.PinPage(pageID); err != nil {
+			t.Fatal(err)
+		}
+		if err := bm.UnpinPage(pageID, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFlushAllCoalesces(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 256})
+	defer bm.Close()
+	backend := newCountingBackend(t)
+	fileID, _ := bm.AttachTablespace(backend)
+
+	ids := fillPages(t, bm, fileID, 150)
+	backend.take()
+	if err := bm.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	want := []pageWrite{{0, 64}, {64, 64}, {128, 22}}
+	if got := backend.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("writes = %v, want %v", got, want)
+	}
+
+	// Gaps split the runs, and a lone page is written on its own
+	dirty(t, bm, ids[3], ids[4], ids[5], ids[10], ids[21], ids[20])
+	if err := bm.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	want = []pageWrite{{3, 3}, {10, 1}, {20, 2}}
+	if got := backend.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("writes = %v, want %v", got, want)
+	}
+	if n := bm.Stats().Dirty; n != 0 {
+		t.Errorf("Dirty = %d after FlushAll, want 0", n)
+	}
+
+	// What was written is what the pages hold
+	for _, pageID := range ids {
+		var page [PageSize]byte
+		backend.FileBackend.ReadPage(pageID.PageNo(), &page)
+		if page != *stamp(uint64(pageID)) {
+			t.Fatalf("page %d not written back", pageID.PageNo())
+		}
+	}
+}
+
+func TestFlushAllRunError(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 256})
+	defer bm.Close()
+	backend := newCountingBackend(t)
+	fileID, _ := bm.AttachTablespace(backend)
+
+	fillPages(t, bm, fileID, 130)
+	backend.take()
+
+	// The second of three runs fails; the runs around it still go out
+	failed := errors.New("disk on fire")
+	backend.mu.Lock()
+	backend.fail, backend.failAt = failed, 64
+	backend.mu.Unlock()
+	if err := bm.FlushAll(); !errors.Is(err, failed) {
+		t.Errorf("FlushAll = %v, want the write's error", err)
+	}
+	want := []pageWrite{{0, 64}, {128, 2}}
+	if got := backend.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("writes = %v, want %v", got, want)
+	}
+	if n := bm.Stats().Dirty; n != 64 {
+		t.Errorf("Dirty = %d after the failed run, want 64", n)
+	}
+
+	// The failed run's pages are still dirty, so the next flush retries
+	// just them
+	backend.mu.Lock()
+	backend.fail = nil
+	backend.mu.Unlock()
+	if err := bm.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	want = []pageWrite{{64, 64}}
+	if got := backend.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("writes after retry = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"sync"
+	"time"
+)
+
+// GroupCommitOptions configures a GroupCommitter.
+type GroupCommitOptions struct {
+	// MaxWait is how long the first commit of a batch waits for others
+	// to join before flushing. Zero flushes at once, and only commits
+	// that arrive during the previous flush are batched.
+	MaxWait time.Duration
+	// MaxBatch flushes a batch as soon as it has this many commits,
+	// without waiting out MaxWait. Zero means no limit.
+	MaxBatch int
+}
+
+// GroupCommitStats counts a GroupCommitter's commits and log flushes.
+type GroupCommitStats struct {
+	Commits  uint64
+	Flushes  uint64 // one fsync each
+	Skipped  uint64 // commits already durable, needing no flush
+	MaxBatch int    // most commits made durable by one flush
+}
+
+// CommitsPerFlush returns the average number of commits each log flush
+// made durable.
+func (s GroupCommitStats) CommitsPerFlush() float64 {
+	if s.Flushes == 0 {
+		return 0
+	}
+	return float64(s.Commits-s.Skipped) / float64(s.Flushes)
+}
+
+// GroupCommitter batches the log flushes of commits: transactions that
+// commit within a short window share one flush, so one fsync makes them
+// all durable. It is itself a LogFlusher, so the buffer manager's forces
+// of the log can go through it as well.
+type GroupCommitter struct {
+	log  LogFlusher
+	opts GroupCommitOptions
+
+	mu    sync.Mutex
+	open  *commitBatch // the batch new commits join
+	stats GroupCommitStats
+
+	// flushMu lets one flush run at a time; commits arriving meanwhile
+	// gather in the next batch
+	flushMu sync.Mutex
+}
+
+// commitBatch is a group of commits flushed together. Its first commit,
+// the leader, flushes it.
+type commitBatch struct {
+	lsn     LSN // the highest of its commits
+	commits int
+	full    chan struct{} // closed when MaxBatch is reached
+	done    chan struct{} // closed once flushed
+	err     error
+}
+
+// NewGroupCommitter returns a coordinator flushing log in batches.
+func NewGroupCommitter(log LogFlusher, opts GroupCommitOptions) *GroupCommitter {
+	return &GroupCommitter{log: log, opts: opts}
+}
+
+// Commit returns once the log is durable up to lsn, the LSN of a
+// transaction's commit record, flushing it together with the other
+// commits that arrive within MaxWait.
+func (g *GroupCommitter) Commit(lsn LSN) error {
+	g.mu.Lock()
+	if lsn <= g.log.FlushedLSN() {
+		g.stats.Commits++
+		g.stats.Skipped++
+		g.mu.Unlock()
+		return nil
+	}
+	b := g.open
+	leader := b == nil
+	if leader {
+		b = &commitBatch{full: make(chan struct{}), done: make(chan struct{})}
+		g.open = b
+	}
+	b.lsn = max(b.lsn, lsn)
+	b.commits++
+	if b.commits == g.opts.MaxBatch {
+		close(b.full)
+		g.open = nil
+	}
+	g.mu.Unlock()
+
+	if !leader {
+		<-b.done
+		return b.err
+	}
+	return g.lead(b)
+}
+
+// lead waits for b to fill, then flushes it and wakes its commits.
+func (g *GroupCommitter) lead(b *commitBatch) error {
+	if g.opts.MaxWait > 0 {
+		timer := time.NewTimer(g.opts.MaxWait)
+		select {
+		case <-timer.C:
+		case <-b.full:
+		}
+		timer.Stop()
+	}
+
+	// Commits keep joining while an earlier batch is flushed
+	g.flushMu.Lock()
+	g.mu.Lock()
+	if g.open == b {
+		g.open = nil
+	}
+	lsn, commits := b.lsn, b.commits
+	g.mu.Unlock()
+
+	var err error
+	flushed := lsn > g.log.FlushedLSN()
+	if flushed {
+		err = g.log.Flush(lsn)
+	}
+	g.flushMu.Unlock()
+
+	g.mu.Lock()
+	g.stats.Commits += uint64(commits)
+	if flushed {
+		g.stats.Flushes++
+		g.stats.MaxBatch = max(g.stats.MaxBatch, commits)
+	} else {
+		g.stats.Skipped += uint64(commits)
+	}
+	g.mu.Unlock()
+
+	b.err = err
+	close(b.done)
+	return err
+}
+
+// FlushedLSN returns the highest LSN known to be durable.
+func (g *GroupCommitter) FlushedLSN() LSN {
+	return g.log.FlushedLSN()
+}
+
+// Flush makes the log durable up to lsn, as a commit would, sharing the
+// flush with concurrent commits; it counts as one in Stats.
+func (g *GroupCommitter) Flush(lsn LSN) error {
+	return g.Commit(lsn)
+}
+
+// Stats returns the committer's counters.
+func (g *GroupCommitter) Stats() GroupCommitStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingLog is a LogFlusher counting its flushes. If gate is set, each
+// flush sends on it as it starts, then waits to receive from it.
+type countingLog struct {
+	mu      sync.Mutex
+	flushed LSN
+	flushes int
+	err     error
+	gate    chan struct{}
+}
+
+func (l *countingLog) FlushedLSN() LSN {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.flushed
+}
+
+func (l *countingLog) Flush(lsn LSN) error {
+	if l.gate != nil {
+		l.gate <- struct{}{}
+		<-l.gate
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushes++
+	if l.err != nil {
+		return l.err
+	}
+	l.flushed = max(l.flushed, lsn)
+	return nil
+}
+
+// commitAll commits LSNs first..last at once and returns their errors.
+func commitAll(g *GroupCommitter, first, last LSN) []error {
+	errs := make([]error, last-first+1)
+	var wg sync.WaitGroup
+	for lsn := first; lsn <= last; lsn++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[lsn-first] = g.Commit(lsn)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestGroupCommitSharesFlush(t *testing.T) {
+	log := &countingLog{}
+	g := NewGroupCommitter(log, GroupCommitOptions{MaxWait: time.Hour, MaxBatch: 20})
+	for _, err := range commitAll(g, 1, 20) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if log.flushes != 1 || log.flushed != 20 {
+		t.Errorf("20 commits took %d flushes, to LSN %d; want 1, to 20", log.flushes, log.flushed)
+	}
+	want := GroupCommitStats{Commits: 20, Flushes: 1, MaxBatch: 20}
+	if s := g.Stats(); s != want || s.CommitsPerFlush() != 20 {
+		t.Errorf("Stats = %+v, want %+v", s, want)
+	}
+
+	// Already durable, a commit needs no flush
+	if err := g.Commit(7); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Stats(); s.Commits != 21 || s.Skipped != 1 || log.flushes != 1 {
+		t.Errorf("commit of a durable LSN: %+v after %d flushes", s, log.flushes)
+	}
+}
+
+func TestGroupCommitMaxBatch(t *testing.T) {
+	log := &countingLog{}
+	// Commits already durable when they arrive skip the batch, so the
+	// last batch may never fill; MaxWait sees it flushed all the same
+	g := NewGroupCommitter(log, GroupCommitOptions{MaxWait: 20 * time.Millisecond, MaxBatch: 5})
+	for _, err := range commitAll(g, 1, 10) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := g.Stats(); s.Commits != 10 || s.MaxBatch != 5 || log.flushed != 10 {
+		t.Errorf("Stats = %+v, log flushed to %d; want 10 commits in batches of at most 5", s, log.flushed)
+	}
+}
+
+func TestGroupCommitMaxWait(t *testing.T) {
+	log := &countingLog{}
+	const wait = 30 * time.Millisecond
+	g := NewGroupCommitter(log, GroupCommitOptions{MaxWait: wait})
+	start := time.Now()
+	if err := g.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < wait {
+		t.Errorf("lone commit returned after %v, before MaxWait %v", d, wait)
+	}
+	if log.flushes != 1 {
+		t.Errorf("%d flushes, want 1", log.flushes)
+	}
+}
+
+func TestGroupCommitDuringFlush(t *testing.T) {
+	// Without MaxWait, commits arriving while a flush runs form the next
+	// batch
+	log := &countingLog{gate: make(chan struct{})}
+	g := NewGroupCommitter(log, GroupCommitOptions{})
+	first := make(chan error)
+	go func() { first <- g.Commit(1) }()
+	<-log.gate
+	// The first flush is under way; queue five more behind it
+	done := make(chan []error)
+	go func() { done <- commitAll(g, 2, 6) }()
+	for {
+		g.mu.Lock()
+		n := 0
+		if g.open != nil {
+			n = g.open.commits
+		}
+		g.mu.Unlock()
+		if n == 5 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	log.gate <- struct{}{}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	<-log.gate
+	log.gate <- struct{}{}
+	for _, err := range <-done {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := g.Stats(); s.Flushes != 2 || s.MaxBatch != 5 || s.Commits != 6 {
+		t.Errorf("Stats = %+v, want 6 commits in 2 flushes of at most 5", s)
+	}
+}
+
+func TestGroupCommitErrors(t *testing.T) {
+	failed := errors.New("disk on fire")
+	log := &countingLog{err: failed}
+	g := NewGroupCommitter(log, GroupCommitOptions{MaxWait: time.Hour, MaxBatch: 8})
+	for i, err := range commitAll(g, 1, 8) {
+		if !errors.Is(err, failed) {
+			t.Errorf("commit %d: %v, want the flush's error", i+1, err)
+		}
+	}
+	if log.flushes != 1 {
+		t.Errorf("%d flushes, want 1", log.flushes)
+	}
+	// The next batch tries again
+	log.mu.Lock()
+	log.err = nil
+	log.mu.Unlock()
+	for _, err := range commitAll(g, 1, 8) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g.FlushedLSN() != 8 || log.flushes != 2 {
+		t.Errorf("flushed to %d in %d flushes, want 8 in 2", g.FlushedLSN(), log.flushes)
+	}
+}
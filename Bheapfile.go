@@ -0,0 +1,682 @@
+package heapfile
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"manager"
+	"slices"
+)
+
+// A heap page is a slotted page: after the common header come the next
+// page of the file, the slot count and the start of the record area, then
+// the slot directory growing up and the records growing down from the end
+// of the page:
+//
+//	header(16) next(8) slots(2) freeEnd(2) {offset(2) length(2)}... free ... records
+//
+// A free slot has offset 0. Each record starts with a flag byte.
+const (
+	nextOffset    = manager.PageHeaderSize
+	slotsOffset   = nextOffset + 8
+	freeEndOffset = slotsOffset + 2
+	pageHeader    = freeEndOffset + 2
+	slotSize      = 4
+
+	// A record moved off its page by a growing Update leaves a forward
+	// stub pointing at it, so that its RID stays valid; the moved record
+	// carries its original RID, under which scans yield it
+	recNormal  = 0 // flag, data
+	recForward = 1 // flag, RID of the moved record
+	recMoved   = 2 // flag, original RID, data
+	ridSize    = 8
+
+	// minFootprint is the least space a record takes up in a page, so
+	// any record can be turned into a forward stub in place
+	minFootprint = 1 + ridSize
+
+	// MaxRecordSize is the largest record a heap file stores.
+	MaxRecordSize = manager.PageSize - pageHeader - slotSize - 1 - ridSize
+
+	// slot numbers fit in 12 bits, pages hold fewer slots than that
+	slotBits = 12
+
+	// noPage is no page of any file
+	noPage = ^manager.PageID(0)
+)
+
+var (
+	// ErrNoRecord is returned for a RID that names no record.
+	ErrNoRecord = errors.New("heapfile: no such record")
+	// ErrRecordTooLarge is returned for a record above MaxRecordSize.
+	ErrRecordTooLarge = fmt.Errorf("heapfile: record larger than %d bytes", MaxRecordSize)
+)
+
+// RID identifies a record by its page and its slot in the page. It stays
+// the same for the record's lifetime, even when an Update moves it.
+type RID struct {
+	Page manager.PageID
+	Slot uint16
+}
+
+// Uint64 packs the RID into a uint64, for example to store it as a value
+// of a B+Tree: tablespace(16) page number(36) slot(12). Page numbers must
+// be below 2^36, 256 TiB into a tablespace.
+func (r RID) Uint64() uint64 {
+	return uint64(r.Page.FileID())<<48 | r.Page.PageNo()<<slotBits | uint64(r.Slot)
+}
+
+// RIDFromUint64 unpacks a RID packed by Uint64.
+func RIDFromUint64(v uint64) RID {
+	page := manager.MakePageID(manager.FileID(v>>48), v>>slotBits&(1<<(48-slotBits)-1))
+	return RID{Page: page, Slot: uint16(v & (1<<slotBits - 1))}
+}
+
+func (r RID) String() string {
+	return fmt.Sprintf("(%d:%d, %d)", r.Page.FileID(), r.Page.PageNo(), r.Slot)
+}
+
+// HeapFile stores variable-length records, unordered, in a chain of
+// slotted pages of the buffer manager, and finds them by RID. A B+Tree
+// mapping keys to RIDs (RID.Uint64) on top of it makes a table. Records
+// are placed in the last page, or in one with room freed by deletes, or a
+// new page. Like BTree it is not safe for concurrent use.
+type HeapFile struct {
+	bm     *manager.BufferManager
+	fileID manager.FileID
+	pages  []manager.PageID // the chain, first page first
+	owned  map[manager.PageID]bool
+	// roomy are pages other than the last with at least a quarter of
+	// a page free, where inserts go before a new page is added
+	roomy map[manager.PageID]bool
+}
+
+// Create makes an empty heap file in the given tablespace. Its first
+// page, First, identifies it to Open.
+func Create(bm *manager.BufferManager, fileID manager.FileID) (*HeapFile, error) {
+	hf := &HeapFile{bm: bm, fileID: fileID, owned: make(map[manager.PageID]bool), roomy: make(map[manager.PageID]bool)}
+	if _, err := hf.addPage(); err != nil {
+		return nil, err
+	}
+	return hf, nil
+}
+
+// Open opens the heap file whose first page is first, reading the header
+// of each of its pages.
+func Open(bm *manager.BufferManager, first manager.PageID) (*HeapFile, error) {
+	hf := &HeapFile{bm: bm, fileID: first.FileID(), owned: make(map[manager.PageID]bool), roomy: make(map[manager.PageID]bool)}
+	for id := first; ; {
+		data, err := bm.PinPage(id)
+		if err != nil {
+			return nil, err
+		}
+		if t := manager.GetPageType(data); t != manager.PageTypeHeap {
+			bm.UnpinPage(id, false)
+			return nil, fmt.Errorf("heapfile: expected heap page, got %v", t)
+		}
+		p := page{data}
+		next, free := p.next(), p.freeSpace()
+		bm.UnpinPage(id, false)
+		if hf.owned[id] {
+			return nil, errors.New("heapfile: page chain loops")
+		}
+		hf.pages = append(hf.pages, id)
+		hf.owned[id] = true
+		if next == 0 {
+			break
+		}
+		if free >= manager.PageSize/4 {
+			hf.roomy[id] = true
+		}
+		id = next
+	}
+	return hf, nil
+}
+
+// First returns the first page of the file, which Open takes.
+func (hf *HeapFile) First() manager.PageID {
+	return hf.pages[0]
+}
+
+// Pages returns how many pages the file has.
+func (hf *HeapFile) Pages() int {
+	return len(hf.pages)
+}
+
+// Insert stores a record and returns its RID.
+func (hf *HeapFile) Insert(data []byte) (RID, error) {
+	if len(data) > MaxRecordSize {
+		return RID{}, ErrRecordTooLarge
+	}
+	return hf.place(recNormal, RID{}, data, noPage)
+}
+
+// Get returns a copy of the record at rid.
+func (hf *HeapFile) Get(rid RID) ([]byte, error) {
+	var out []byte
+	err := hf.withRecord(rid, false, func(p page, slot int, flag byte, body []byte) (bool, error) {
+		switch flag {
+		case recNormal:
+			out = append([]byte(nil), body...)
+			return false, nil
+		case recForward:
+			target := decodeRID(body)
+			return false, hf.withRecord(target, false, func(_ page, _ int, flag byte, body []byte) (bool, error) {
+				if flag != recMoved {
+					return false, fmt.Errorf("heapfile: forward from %v to %v finds no moved record", rid, target)
+				}
+				out = append([]byte(nil), body[ridSize:]...)
+				return false, nil
+			})
+		}
+		return false, ErrNoRecord
+	})
+	return out, err
+}
+
+// Update replaces the record at rid. A record that no longer fits in its
+// page moves to another, leaving a forward stub under its RID.
+func (hf *HeapFile) Update(rid RID, data []byte) error {
+	if len(data) > MaxRecordSize {
+		return ErrRecordTooLarge
+	}
+	var moveTo RID
+	var moved, forwarded bool
+	err := hf.withRecord(rid, true, func(p page, slot int, flag byte, body []byte) (bool, error) {
+		switch flag {
+		case recNormal:
+			if p.resize(slot, 1+len(data)) {
+				copy(p.record(slot)[1:], data)
+				return true, nil
+			}
+			moved = true
+			return false, nil
+		case recForward:
+			moveTo, forwarded = decodeRID(body), true
+			return false, nil
+		}
+		return false, ErrNoRecord
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case moved:
+		// Off the page: place it elsewhere, then turn the original into
+		// a stub, which always fits as every record takes minFootprint
+		target, err := hf.place(recMoved, rid, data, rid.Page)
+		if err != nil {
+			return err
+		}
+		return hf.setForward(rid, target)
+	case forwarded:
+		// Already moved: update it where it is, or move it again
+		fits := false
+		err := hf.withRecord(moveTo, true, func(p page, slot int, _ byte, _ []byte) (bool, error) {
+			if fits = p.resize(slot, 1+ridSize+len(data)); fits {
+				copy(p.record(slot)[1+ridSize:], data)
+			}
+			return fits, nil
+		})
+		if err != nil || fits {
+			return err
+		}
+		target, err := hf.place(recMoved, rid, data, moveTo.Page)
+		if err != nil {
+			return err
+		}
+		if err := hf.setForward(rid, target); err != nil {
+			return err
+		}
+		return hf.remove(moveTo)
+	}
+	return nil
+}
+
+// Delete removes the record at rid. Its slot may be reused by a later
+// Insert.
+func (hf *HeapFile) Delete(rid RID) error {
+	var target RID
+	var forwarded bool
+	err := hf.withRecord(rid, false, func(_ page, _ int, flag byte, body []byte) (bool, error) {
+		switch flag {
+		case recNormal:
+			return false, nil
+		case recForward:
+			target, forwarded = decodeRID(body), true
+			return false, nil
+		}
+		return false, ErrNoRecord
+	})
+	if err != nil {
+		return err
+	}
+	if forwarded {
+		if err := hf.remove(target); err != nil {
+			return err
+		}
+	}
+	return hf.remove(rid)
+}
+
+// All returns an iterator over every record and its RID, page by page, as
+// Cursor().All() does.
+func (hf *HeapFile) All() iter.Seq2[RID, []byte] {
+	return hf.Cursor().All()
+}
+
+// Cursor scans a heap file.
+type Cursor struct {
+	hf  *HeapFile
+	err error
+}
+
+// Cursor returns a cursor over the file.
+func (hf *HeapFile) Cursor() *Cursor {
+	return &Cursor{hf: hf}
+}
+
+// Err returns the error that ended the last scan, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// All returns an iterator over every record and its RID. Each page is
+// copied out and unpinned before its records are yielded, so the loop
+// body may use the buffer manager. A moved record is yielded, under its
+// RID, where it now lies rather than where its stub is.
+func (c *Cursor) All() iter.Seq2[RID, []byte] {
+	return func(yield func(RID, []byte) bool) {
+		c.err = nil
+		var buf [manager.PageSize]byte
+		for i := 0; i < len(c.hf.pages); i++ {
+			id := c.hf.pages[i]
+			data, err := c.hf.bm.PinPage(id)
+			if err != nil {
+				c.err = err
+				return
+			}
+			buf = *data
+			c.hf.bm.UnpinPage(id, false)
+
+			p := page{&buf}
+			for slot := range p.slots() {
+				if p.slotOffset(slot) == 0 {
+					continue
+				}
+				rec := p.record(slot)
+				var rid RID
+				var body []byte
+				switch rec[0] {
+				case recNormal:
+					rid, body = RID{Page: id, Slot: uint16(slot)}, rec[1:]
+				case recMoved:
+					rid, body = decodeRID(rec[1:]), rec[1+ridSize:]
+				default:
+					continue
+				}
+				if !yield(rid, append([]byte(nil), body...)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// withRecord pins rid's page and calls fn with the record's flag and
+// body; fn reports whether it changed the page.
+func (hf *HeapFile) withRecord(rid RID, write bool, fn func(p page, slot int, flag byte, body []byte) (bool, error)) error {
+	if !hf.owned[rid.Page] {
+		return ErrNoRecord
+	}
+	data, err := hf.bm.PinPage(rid.Page)
+	if err != nil {
+		return err
+	}
+	p := page{data}
+	slot := int(rid.Slot)
+	if slot >= p.slots() || p.slotOffset(slot) == 0 {
+		hf.bm.UnpinPage(rid.Page, false)
+		return ErrNoRecord
+	}
+	rec := p.record(slot)
+	dirty, err := fn(p, slot, rec[0], rec[1:])
+	if dirty {
+		hf.noteFree(rid.Page, p.freeSpace())
+	}
+	if uerr := hf.bm.UnpinPage(rid.Page, dirty && write); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// place stores a record of the given flag, prefixed by origin for a moved
+// record, in a page with room, other than avoid, and returns its RID.
+func (hf *HeapFile) place(flag byte, origin RID, data []byte, avoid manager.PageID) (RID, error) {
+	size := 1 + len(data)
+	if flag == recMoved {
+		size += ridSize
+	}
+	candidates := []manager.PageID{hf.pages[len(hf.pages)-1]}
+	for id := range hf.roomy {
+		candidates = append(candidates, id)
+	}
+	for _, id := range candidates {
+		if id == avoid {
+			continue
+		}
+		rid, ok, err := hf.placeIn(id, flag, origin, data, size)
+		if err != nil || ok {
+			return rid, err
+		}
+	}
+	id, err := hf.addPage()
+	if err != nil {
+		return RID{}, err
+	}
+	rid, _, err := hf.placeIn(id, flag, origin, data, size)
+	return rid, err
+}
+
+func (hf *HeapFile) placeIn(id manager.PageID, flag byte, origin RID, data []byte, size int) (RID, bool, error) {
+	buf, err := hf.bm.PinPage(id)
+	if err != nil {
+		return RID{}, false, err
+	}
+	p := page{buf}
+	slot, ok := p.insert(size)
+	if !ok {
+		delete(hf.roomy, id)
+		return RID{}, false, hf.bm.UnpinPage(id, false)
+	}
+	rec := p.record(slot)
+	rec[0] = flag
+	if flag == recMoved {
+		encodeRID(rec[1:], origin)
+		copy(rec[1+ridSize:], data)
+	} else {
+		copy(rec[1:], data)
+	}
+	hf.noteFree(id, p.freeSpace())
+	return RID{Page: id, Slot: uint16(slot)}, true, hf.bm.UnpinPage(id, true)
+}
+
+// setForward turns the record at rid into a stub pointing at target.
+func (hf *HeapFile) setForward(rid, target RID) error {
+	return hf.withRecord(rid, true, func(p page, slot int, _ byte, _ []byte) (bool, error) {
+		if !p.resize(slot, 1+ridSize) {
+			return false, errors.New("heapfile: no room for a forward stub")
+		}
+		rec := p.record(slot)
+		rec[0] = recForward
+		encodeRID(rec[1:], target)
+		return true, nil
+	})
+}
+
+// remove frees the slot of rid.
+func (hf *HeapFile) remove(rid RID) error {
+	return hf.withRecord(rid, true, func(p page, slot int, _ byte, _ []byte) (bool, error) {
+		p.free(slot)
+		return true, nil
+	})
+}
+
+// addPage appends an empty page to the chain.
+func (hf *HeapFile) addPage() (manager.PageID, error) {
+	id, data, err := hf.bm.NewPageIn(hf.fileID)
+	if err != nil {
+		return 0, err
+	}
+	manager.SetPageType(data, manager.PageTypeHeap)
+	page{data}.setFreeEnd(manager.PageSize)
+	if err := hf.bm.UnpinPage(id, true); err != nil {
+		return 0, err
+	}
+	if n := len(hf.pages); n > 0 {
+		last := hf.pages[n-1]
+		data, err := hf.bm.PinPage(last)
+		if err != nil {
+			return 0, err
+		}
+		binary.BigEndian.PutUint64(data[nextOffset:], uint64(id))
+		free := page{data}.freeSpace()
+		if err := hf.bm.UnpinPage(last, true); err != nil {
+			return 0, err
+		}
+		if free >= manager.PageSize/4 {
+			hf.roomy[last] = true
+		}
+	}
+	hf.pages = append(hf.pages, id)
+	hf.owned[id] = true
+	return id, nil
+}
+
+// noteFree keeps track of pages that can take more records.
+func (hf *HeapFile) noteFree(id manager.PageID, free int) {
+	if id == hf.pages[len(hf.pages)-1] {
+		return
+	}
+	if free >= manager.PageSize/4 {
+		hf.roomy[id] = true
+	} else {
+		delete(hf.roomy, id)
+	}
+}
+
+func encodeRID(b []byte, rid RID) {
+	binary.BigEndian.PutUint64(b, rid.Uint64())
+}
+
+func decodeRID(b []byte) RID {
+	return RIDFromUint64(binary.BigEndian.Uint64(b))
+}
+
+// SlotInfo describes a slot of a heap page. Ref is the RID a forward stub
+// points at, or the original RID of a moved record.
+type SlotInfo struct {
+	Offset, Length int // 0, 0 for a free slot
+	Kind           string
+	Ref            RID
+}
+
+// PageInfo describes a heap page, for inspection tools.
+type PageInfo struct {
+	Next      manager.PageID
+	FreeEnd   int
+	FreeSpace int
+	Slots     []SlotInfo
+}
+
+// InspectPage decodes a heap page and checks its layout: that the slot
+// directory ends before the record area, and that each record lies within
+// it, without overlapping another, and starts with a known flag. It
+// returns what it could decode along with the first problem found.
+func InspectPage(data *[manager.PageSize]byte) (PageInfo, error) {
+	if t := manager.GetPageType(data); t != manager.PageTypeHeap {
+		return PageInfo{}, fmt.Errorf("heapfile: expected heap page, got %v", t)
+	}
+	p := page{data}
+	info := PageInfo{Next: p.next(), FreeEnd: p.freeEnd()}
+	dirEnd := pageHeader + p.slots()*slotSize
+	if dirEnd > info.FreeEnd || info.FreeEnd > manager.PageSize {
+		return info, fmt.Errorf("heapfile: %d slots end at %d, past the record area at %d", p.slots(), dirEnd, info.FreeEnd)
+	}
+	info.FreeSpace = p.freeSpace()
+	var used []SlotInfo // records by offset, for the overlap check
+	for slot := range p.slots() {
+		s := SlotInfo{Offset: p.slotOffset(slot), Length: p.slotLength(slot)}
+		info.Slots = append(info.Slots, s)
+		if s.Offset == 0 {
+			continue
+		}
+		if s.Offset < info.FreeEnd || s.Length < 1 || s.Offset+footprint(s.Length) > manager.PageSize {
+			return info, fmt.Errorf("heapfile: slot %d at %d+%d outside the record area", slot, s.Offset, s.Length)
+		}
+		rec := p.record(slot)
+		switch rec[0] {
+		case recNormal:
+			s.Kind = "record"
+		case recForward, recMoved:
+			if len(rec) < 1+ridSize {
+				return info, fmt.Errorf("heapfile: slot %d too short for its RID", slot)
+			}
+			s.Kind, s.Ref = "forward", decodeRID(rec[1:])
+			if rec[0] == recMoved {
+				s.Kind = "moved"
+			}
+		default:
+			return info, fmt.Errorf("heapfile: slot %d has unknown flag %d", slot, rec[0])
+		}
+		info.Slots[slot] = s
+		used = append(used, s)
+	}
+	slices.SortFunc(used, func(a, b SlotInfo) int { return cmp.Compare(a.Offset, b.Offset) })
+	for i := 1; i < len(used); i++ {
+		if prev := used[i-1]; prev.Offset+footprint(prev.Length) > used[i].Offset {
+			return info, fmt.Errorf("heapfile: records at %d and %d overlap", prev.Offset, used[i].Offset)
+		}
+	}
+	return info, nil
+}
+
+// page is a view of a heap page.
+type page struct {
+	data *[manager.PageSize]byte
+}
+
+func (p page) next() manager.PageID {
+	return manager.PageID(binary.BigEndian.Uint64(p.data[nextOffset:]))
+}
+
+func (p page) slots() int {
+	return int(binary.BigEndian.Uint16(p.data[slotsOffset:]))
+}
+
+// freeEnd is where the record area starts.
+func (p page) freeEnd() int {
+	return int(binary.BigEndian.Uint16(p.data[freeEndOffset:]))
+}
+
+func (p page) setFreeEnd(end int) {
+	binary.BigEndian.PutUint16(p.data[freeEndOffset:], uint16(end))
+}
+
+func (p page) slotOffset(slot int) int {
+	return int(binary.BigEndian.Uint16(p.data[pageHeader+slot*slotSize:]))
+}
+
+func (p page) slotLength(slot int) int {
+	return int(binary.BigEndian.Uint16(p.data[pageHeader+slot*slotSize+2:]))
+}
+
+func (p page) setSlot(slot, offset, length int) {
+	binary.BigEndian.PutUint16(p.data[pageHeader+slot*slotSize:], uint16(offset))
+	binary.BigEndian.PutUint16(p.data[pageHeader+slot*slotSize+2:], uint16(length))
+}
+
+func (p page) record(slot int) []byte {
+	off := p.slotOffset(slot)
+	return p.data[off : off+p.slotLength(slot)]
+}
+
+func footprint(length int) int {
+	return max(length, minFootprint)
+}
+
+// freeSpace returns the bytes a compaction would leave free for records
+// and their slots.
+func (p page) freeSpace() int {
+	used := pageHeader + p.slots()*slotSize
+	for slot := range p.slots() {
+		if p.slotOffset(slot) != 0 {
+			used += footprint(p.slotLength(slot))
+		}
+	}
+	return manager.PageSize - used
+}
+
+// insert reserves size bytes in a free or new slot, compacting the page
+// if need be.
+func (p page) insert(size int) (int, bool) {
+	slot := -1
+	for s := range p.slots() {
+		if p.slotOffset(s) == 0 {
+			slot = s
+			break
+		}
+	}
+	need := footprint(size)
+	if slot < 0 {
+		need += slotSize
+	}
+	if p.freeSpace() < need {
+		return 0, false
+	}
+	if p.freeEnd()-(pageHeader+p.slots()*slotSize) < need {
+		p.compact()
+	}
+	if slot < 0 {
+		slot = p.slots()
+		binary.BigEndian.PutUint16(p.data[slotsOffset:], uint16(slot+1))
+	}
+	end := p.freeEnd() - footprint(size)
+	p.setFreeEnd(end)
+	p.setSlot(slot, end, size)
+	return slot, true
+}
+
+// resize changes the length of a record in place, moving it within the
+// page if it grows, and reports whether it fits. The record's bytes are
+// kept, up to the new length.
+func (p page) resize(slot, size int) bool {
+	old := p.slotLength(slot)
+	if footprint(size) <= footprint(old) {
+		p.setSlot(slot, p.slotOffset(slot), size)
+		return true
+	}
+	if p.freeSpace() < footprint(size)-footprint(old) {
+		return false
+	}
+	saved := append([]byte(nil), p.record(slot)...)
+	p.setSlot(slot, 0, 0)
+	if p.freeEnd()-(pageHeader+p.slots()*slotSize) < footprint(size) {
+		p.compact()
+	}
+	end := p.freeEnd() - footprint(size)
+	p.setFreeEnd(end)
+	p.setSlot(slot, end, size)
+	copy(p.data[end:], saved)
+	return true
+}
+
+// free releases a slot, and drops trailing free slots.
+func (p page) free(slot int) {
+	p.setSlot(slot, 0, 0)
+	n := p.slots()
+	for n > 0 && p.slotOffset(n-1) == 0 {
+		n--
+	}
+	binary.BigEndian.PutUint16(p.data[slotsOffset:], uint16(n))
+}
+
+// compact moves the records to the end of the page, closing the gaps
+// left by deleted and moved ones.
+func (p page) compact() {
+	var buf [manager.PageSize]byte
+	end := manager.PageSize
+	for slot := range p.slots() {
+		if p.slotOffset(slot) == 0 {
+			continue
+		}
+		rec := p.record(slot)
+		end -= footprint(len(rec))
+		copy(buf[end:], rec)
+		p.setSlot(slot, end, len(rec))
+	}
+	copy(p.data[end:], buf[end:])
+	p.setFreeEnd(end)
+}
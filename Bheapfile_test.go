@@ -0,0 +1,218 @@
+package heapfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"manager"
+	"testing"
+)
+
+func newHeapFile(t *testing.T) (*manager.BufferManager, *HeapFile) {
+	t.Helper()
+	bm := manager.NewBufferManager()
+	t.Cleanup(func() { bm.Close() })
+	hf, err := Create(bm, manager.DefaultFileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bm, hf
+}
+
+func record(i, size int) []byte {
+	rec := bytes.Repeat([]byte{byte(i)}, size)
+	copy(rec, fmt.Sprintf("rec %d", i))
+	return rec
+}
+
+func expectRecord(t *testing.T, hf *HeapFile, rid RID, want []byte) {
+	t.Helper()
+	got, err := hf.Get(rid)
+	if err != nil {
+		t.Fatalf("Get(%v): %v", rid, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Get(%v) = %q, want %q", rid, got, want)
+	}
+}
+
+// scan returns the file's records by RID, checking each is yielded once.
+func scan(t *testing.T, hf *HeapFile) map[RID][]byte {
+	t.Helper()
+	all := make(map[RID][]byte)
+	cur := hf.Cursor()
+	for rid, data := range cur.All() {
+		if _, ok := all[rid]; ok {
+			t.Errorf("scan yielded %v twice", rid)
+		}
+		all[rid] = data
+	}
+	if err := cur.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return all
+}
+
+func TestInsertGetDelete(t *testing.T) {
+	bm, hf := newHeapFile(t)
+	rids := make([]RID, 200)
+	for i := range rids {
+		rid, err := hf.Insert(record(i, 50+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rids[i] = rid
+	}
+	if hf.Pages() < 2 {
+		t.Fatalf("%d pages for 200 records, want several", hf.Pages())
+	}
+	for i, rid := range rids {
+		expectRecord(t, hf, rid, record(i, 50+i))
+	}
+
+	for i := 0; i < len(rids); i += 2 {
+		if err := hf.Delete(rids[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := hf.Get(rids[0]); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Get of a deleted record: %v, want ErrNoRecord", err)
+	}
+	if err := hf.Delete(rids[0]); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("second Delete: %v, want ErrNoRecord", err)
+	}
+	if _, err := hf.Get(RID{Page: 12345, Slot: 1}); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Get of another file's page: %v, want ErrNoRecord", err)
+	}
+	if _, err := hf.Insert(make([]byte, MaxRecordSize+1)); !errors.Is(err, ErrRecordTooLarge) {
+		t.Errorf("oversized Insert: %v, want ErrRecordTooLarge", err)
+	}
+
+	// A reopened file has the same records
+	hf, err := Open(bm, hf.First())
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := scan(t, hf)
+	if len(all) != len(rids)/2 {
+		t.Errorf("scan found %d records, want %d", len(all), len(rids)/2)
+	}
+	for i := 1; i < len(rids); i += 2 {
+		if !bytes.Equal(all[rids[i]], record(i, 50+i)) {
+			t.Errorf("scan has %q for %v, want record %d", all[rids[i]], rids[i], i)
+		}
+	}
+}
+
+func TestUpdateMovesRecords(t *testing.T) {
+	_, hf := newHeapFile(t)
+	var rids []RID
+	for i := range 60 {
+		rid, err := hf.Insert(record(i, 60))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rids = append(rids, rid)
+	}
+	first := rids[0]
+
+	// Shrinking and growing a little stays in place
+	if err := hf.Update(first, record(100, 10)); err != nil {
+		t.Fatal(err)
+	}
+	expectRecord(t, hf, first, record(100, 10))
+	if err := hf.Update(first, record(101, 60)); err != nil {
+		t.Fatal(err)
+	}
+	expectRecord(t, hf, first, record(101, 60))
+
+	// Growing past what the full page has left moves the record, and
+	// moving it on again keeps its RID
+	for _, size := range []int{2000, 3000, 40} {
+		if err := hf.Update(first, record(102, size)); err != nil {
+			t.Fatal(err)
+		}
+		expectRecord(t, hf, first, record(102, size))
+	}
+	all := scan(t, hf)
+	if len(all) != len(rids) || !bytes.Equal(all[first], record(102, 40)) {
+		t.Errorf("scan found %d records, %q for the moved one", len(all), all[first])
+	}
+	info, err := inspect(hf, first.Page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := info.Slots[first.Slot]; s.Kind != "forward" {
+		t.Errorf("moved record's slot holds a %q, want a forward stub", s.Kind)
+	}
+
+	// Deleting the record removes the stub and the moved copy
+	if err := hf.Delete(first); err != nil {
+		t.Fatal(err)
+	}
+	if all := scan(t, hf); len(all) != len(rids)-1 {
+		t.Errorf("scan found %d records after the delete, want %d", len(all), len(rids)-1)
+	}
+}
+
+func TestFreedSpaceIsReused(t *testing.T) {
+	_, hf := newHeapFile(t)
+	var rids []RID
+	for i := range 150 {
+		rid, err := hf.Insert(record(i, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rids = append(rids, rid)
+	}
+	pages := hf.Pages()
+
+	// Emptying the first page lets half as many records go back without a
+	// new page, most of them into the freed slots
+	var freed []RID
+	for _, rid := range rids {
+		if rid.Page == hf.First() {
+			if err := hf.Delete(rid); err != nil {
+				t.Fatal(err)
+			}
+			freed = append(freed, rid)
+		}
+	}
+	reused := 0
+	for i := range len(freed) / 2 {
+		rid, err := hf.Insert(record(i, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rid.Page == hf.First() {
+			reused++
+		}
+	}
+	if hf.Pages() != pages {
+		t.Errorf("file grew from %d to %d pages", pages, hf.Pages())
+	}
+	if reused < len(freed)/4 {
+		t.Errorf("%d records went back into the emptied page", reused)
+	}
+}
+
+func TestRIDUint64(t *testing.T) {
+	for _, rid := range []RID{
+		{},
+		{Page: manager.MakePageID(3, 77), Slot: 5},
+		{Page: manager.MakePageID(1<<16-1, 1<<36-1), Slot: 1<<12 - 1},
+	} {
+		if got := RIDFromUint64(rid.Uint64()); got != rid {
+			t.Errorf("RIDFromUint64(%v.Uint64()) = %v", rid, got)
+		}
+	}
+}
+
+func inspect(hf *HeapFile, id manager.PageID) (PageInfo, error) {
+	data, err := hf.bm.PinPage(id)
+	if err != nil {
+		return PageInfo{}, err
+	}
+	defer hf.bm.UnpinPage(id, false)
+	return InspectPage(data)
+}
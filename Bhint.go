@@ -0,0 +1,53 @@
+package manager
+
+// PinHint tells the buffer manager how a pinned page is going to be used.
+type PinHint int
+
+const (
+	// PinNormal pins a page that may be reused soon.
+	PinNormal PinHint = iota
+	// PinSequential pins a page touched once by a large scan. Such pages
+	// are evicted before any other unpinned page so a scan cannot flush
+	// the working set.
+	PinSequential
+)
+
+// PinPageHint pins a page like PinPage, applying the given hint. A
+// sequential pin of an already cached page leaves its state untouched, and
+// a normal pin at any time clears the page's scan status.
+func (bm *BufferManager) PinPageHint(pageID PageID, hint PinHint) (*[PageSize]byte, error) {
+	return bm.pinPage(pageID, hint)
+}
+
+// queueScanVictim records an unpinned scan page as the next eviction
+// candidate.
+func (bm *BufferManager) queueScanVictim(idx int) {
+	if len(bm.scanVictims) >= len(bm.frames) {
+		// Drop stale entries so repeated unpins can't grow the queue
+		seen := make([]bool, len(bm.frames))
+		seen[idx] = true
+		live := bm.scanVictims[:0]
+		for _, i := range bm.scanVictims {
+			if !seen[i] && bm.frames[i].scan && !bm.frames[i].pinned() {
+				seen[i] = true
+				live = append(live, i)
+			}
+		}
+		bm.scanVictims = live
+	}
+	bm.scanVictims = append(bm.scanVictims, idx)
+}
+
+// popScanVictim returns the oldest still-evictable scan page, if any.
+func (bm *BufferManager) popScanVictim() (int, bool) {
+	for len(bm.scanVictims) > 0 {
+		idx := bm.scanVictims[0]
+		bm.scanVictims = bm.scanVictims[1:]
+
+		frame := bm.frames[idx]
+		if frame.valid && frame.scan && !frame.pinned() && bm.evictable(frame) && frame.tryLock() {
+			return idx, true
+		}
+	}
+	return 0, false
+}
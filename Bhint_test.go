@@ -0,0 +1,82 @@
+package manager
+
+import "testing"
+
+// scanAfterHotSet pins hot pages, pins every other page once with hint,
+// and returns how many of the hot pages then had to be read again.
+func scanAfterHotSet(t *testing.T, hint PinHint) uint64 {
+	t.Helper()
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	ids := fillPages(t, bm, DefaultFileID, 100)
+	hot, rest := ids[:4], ids[4:]
+	for range 2 {
+		checkPages(t, bm, hot)
+	}
+	for _, pageID := range rest {
+		if _, err := bm.PinPageHint(pageID, hint); err != nil {
+			t.Fatal(err)
+		}
+		if err := bm.UnpinPage(pageID, false); err != nil {
+			t.Fatal(err)
+		}
+		// Hot pages pinned sequentially stay hot
+		if _, err := bm.PinPageHint(hot[0], PinSequential); err != nil {
+			t.Fatal(err)
+		}
+		bm.UnpinPage(hot[0], false)
+	}
+	misses := bm.Stats().Misses
+	checkPages(t, bm, hot)
+	return bm.Stats().Misses - misses
+}
+
+func TestSequentialHint(t *testing.T) {
+	if n := scanAfterHotSet(t, PinNormal); n == 0 {
+		t.Error("a scan of normal pins left the hot set cached; the test shows nothing")
+	}
+	if n := scanAfterHotSet(t, PinSequential); n != 0 {
+		t.Errorf("a sequential scan evicted %d of 4 hot pages", n)
+	}
+}
+
+func TestNormalPinClearsScan(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 4})
+	ids := fillPages(t, bm, DefaultFileID, 20)
+
+	// A page first met by a scan and then used normally is no longer the
+	// first to go
+	if _, err := bm.PinPageHint(ids[0], PinSequential); err != nil {
+		t.Fatal(err)
+	}
+	bm.UnpinPage(ids[0], false)
+	checkPages(t, bm, ids[:1])
+	for _, pageID := range ids[10:13] {
+		bm.PinPageHint(pageID, PinSequential)
+		bm.UnpinPage(pageID, false)
+	}
+	misses := bm.Stats().Misses
+	checkPages(t, bm, ids[:1])
+	if bm.Stats().Misses != misses {
+		t.Error("page pinned normally after a scan was evicted by the next scan")
+	}
+
+	// Scan pages dirtied by their user are written back when evicted
+	data, err := bm.PinPageHint(ids[15], PinSequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	bm.UnpinPage(ids[15], true)
+	for _, pageID := range ids[1:10] {
+		bm.PinPageHint(pageID, PinSequential)
+		bm.UnpinPage(pageID, false)
+	}
+	data, err = bm.PinPage(ids[15])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != stamp(uint64(ids[15]))[0]^0xff {
+		t.Error("change to an evicted scan page was lost")
+	}
+	bm.UnpinPage(ids[15], false)
+}
@@ -0,0 +1,34 @@
+package manager
+
+// EvictionHook observes a page leaving the pool or being written back.
+// dirty reports whether the page had unwritten changes at that moment.
+// Hooks run with the buffer manager locked and must not call back into it.
+type EvictionHook func(pageID PageID, dirty bool)
+
+// RegisterEvictionHook adds fn to the hooks run whenever a page is evicted
+// from its frame, including pages dropped by Resize and DropTablespace.
+func (bm *BufferManager) RegisterEvictionHook(fn EvictionHook) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.evictHooks = append(bm.evictHooks, fn)
+}
+
+// RegisterFlushHook adds fn to the hooks run whenever a dirty page is
+// written back, whether by eviction, FlushPage, Resize or Close.
+func (bm *BufferManager) RegisterFlushHook(fn EvictionHook) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.flushHooks = append(bm.flushHooks, fn)
+}
+
+func (bm *BufferManager) notifyEvict(pageID PageID, dirty bool) {
+	for _, fn := range bm.evictHooks {
+		fn(pageID, dirty)
+	}
+}
+
+func (bm *BufferManager) notifyFlush(pageID PageID) {
+	for _, fn := range bm.flushHooks {
+		fn(pageID, true)
+	}
+}
@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 2})
+	var events []string
+	bm.RegisterEvictionHook(func(pageID PageID, dirty bool) {
+		events = append(events, fmt.Sprintf("evict %d:%d %v", pageID.FileID(), pageID.PageNo(), dirty))
+	})
+	bm.RegisterFlushHook(func(pageID PageID, dirty bool) {
+		events = append(events, fmt.Sprintf("flush %d:%d %v", pageID.FileID(), pageID.PageNo(), dirty))
+	})
+	// Hooks run in the order registered
+	bm.RegisterFlushHook(func(PageID, bool) { events = append(events, "second flush hook") })
+	expect := func(step string, want ...string) {
+		t.Helper()
+		if !slices.Equal(events, want) {
+			t.Errorf("%s: hooks saw %q, want %q", step, events, want)
+		}
+		events = nil
+	}
+
+	ids := fillPages(t, bm, DefaultFileID, 2)
+	expect("allocation")
+	if err := bm.FlushPage(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	expect("FlushPage", "flush 0:0 true", "second flush hook")
+	if err := bm.FlushPage(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	expect("FlushPage of a clean page")
+
+	// A clean page is evicted without a write, a dirty one after one
+	fillPages(t, bm, DefaultFileID, 1)
+	expect("clean eviction", "evict 0:0 false")
+	fillPages(t, bm, DefaultFileID, 1)
+	expect("dirty eviction", "flush 0:1 true", "second flush hook", "evict 0:1 true")
+
+	// Resize writes back what it drops, and reports it clean
+	bm.Resize(1)
+	expect("Resize", "flush 0:3 true", "second flush hook", "evict 0:3 false")
+
+	// Dropping a tablespace evicts its pages without writing them
+	fileID, err := bm.CreateTablespace(filepath.Join(t.TempDir(), "dropped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.Resize(2)
+	fillPages(t, bm, fileID, 1)
+	expect("allocation into a free frame")
+	if err := bm.DropTablespace(fileID); err != nil {
+		t.Fatal(err)
+	}
+	expect("DropTablespace", fmt.Sprintf("evict %d:0 true", fileID))
+
+	// The clock passed page 2 on the way to the free frame, so it goes
+	// next
+	fillPages(t, bm, DefaultFileID, 1)
+	expect("eviction after a drop", "flush 0:2 true", "second flush hook", "evict 0:2 true")
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expect("Close", "flush 0:4 true", "second flush hook")
+}
@@ -0,0 +1,492 @@
+package kv
+
+import (
+	"bytes"
+	"catalog"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"heapfile"
+	"manager"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A database is one tablespace file and a log beside it, at path+".wal".
+// The file holds the catalog in its meta pages, a heap file of values, and
+// per keyspace a B+Tree mapping each key to the RID of its value. The
+// top-level keyspace's tree is recorded in the catalog as treeName, with
+// the heap file's first page as an option, and each bucket's under its
+// catalogName. Each write is logged before it is applied, and pages only
+// reach the file at checkpoints, so between them the file holds the state
+// of the last one. Sync checkpoints, as do writes once the held dirty
+// pages or the log grow large: the dirty pages are logged whole, then
+// written back, the file synced and the log emptied. Open restores the
+// page images of a checkpoint the log holds in full, since a crash may
+// have stopped their write-back halfway, then redoes the writes logged
+// after them.
+const (
+	treeName   = "kv"
+	heapOption = "heap"
+
+	// Log records are an op, the bucket's path (empty for the top-level
+	// keyspace) and the op's arguments:
+	//
+	//	op(1) pathLen(2) path key(8) value
+	opPut          byte = 1 // key, value
+	opDelete       byte = 2 // key
+	opCreateBucket byte = 3
+	opDeleteBucket byte = 4
+	opBatch        byte = 5 // records, each as length(4) record
+	opPageImage    byte = 6 // key: page number, value: the page
+	opImagesEnd    byte = 7 // follows a checkpoint's page images
+)
+
+// treeSchema is that of every tree: values are RIDs packed by RID.Uint64.
+var treeSchema = catalog.KeySchema{Key: catalog.Uint64, Value: catalog.Uint64}
+
+var (
+	// ErrClosed is returned by the methods of a closed DB.
+	ErrClosed = errors.New("kv: database is closed")
+
+	errBadLogRecord = errors.New("kv: bad log record")
+)
+
+// Options configures Open. The zero value is the default.
+type Options struct {
+	// Frames is the size of the buffer pool, 0 for manager.MaxFrames.
+	Frames int
+	// NoSync leaves writes in memory until the next Sync or Close instead
+	// of flushing the log on each, so a crash may lose the latest ones.
+	NoSync bool
+}
+
+// DB is an embedded key-value store of uint64 keys and byte-slice values,
+// kept in order of their keys. Safe for concurrent use; reads run in
+// parallel with each other but not with writes.
+type DB struct {
+	mu     sync.RWMutex
+	bm     *manager.BufferManager
+	cat    *catalog.Catalog
+	heap   *heapfile.HeapFile
+	wal    *manager.WALWriter
+	fileID manager.FileID
+	noSync bool
+	closed bool
+
+	// frames is the configured pool size, which the pool grows past when
+	// every frame holds a dirty page; logged counts the bytes logged since
+	// the last checkpoint
+	frames int
+	logged int
+	// imagesLogged, if set, runs once a checkpoint's images are durable
+	imagesLogged func()
+
+	root *Bucket
+	// buckets are the open handles of every bucket by path, so that each
+	// catalog entry has a single Index keeping its root current
+	buckets map[string]*Bucket
+
+	stats dbStats
+}
+
+// Open opens the database at path, creating it if the file does not exist
+// or is empty, and recovers the writes its log holds. opts may be nil.
+func Open(path string, opts *Options) (*DB, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	fresh := false
+	switch fi, err := os.Stat(path); {
+	case errors.Is(err, os.ErrNotExist):
+		fresh = true
+	case err != nil:
+		return nil, err
+	default:
+		fresh = fi.Size() == 0
+	}
+
+	bm := manager.NewBufferManager()
+	frames := manager.MaxFrames
+	if opts.Frames > 0 {
+		frames = opts.Frames
+		if err := bm.Resize(frames); err != nil {
+			return nil, err
+		}
+	}
+	bm.HoldDirtyPages(true)
+	db := &DB{bm: bm, noSync: opts.NoSync, frames: frames, buckets: make(map[string]*Bucket)}
+	if err := db.open(path, fresh); err != nil {
+		// Nothing half-recovered may reach the file
+		bm.Discard()
+		return nil, err
+	}
+	return db, nil
+}
+
+// open restores the page images the log holds, sets up the file's
+// structures, replays the writes logged after the images onto them and
+// checkpoints, so the log starts out empty.
+func (db *DB) open(path string, fresh bool) error {
+	fileID, err := db.bm.CreateTablespace(path)
+	if err != nil {
+		return err
+	}
+	db.fileID = fileID
+	var recs [][]byte
+	wal, _, err := manager.OpenWALWriter(path+".wal", func(rec manager.LogRecord) error {
+		recs = append(recs, bytes.Clone(rec.Data))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.wal = wal
+	if err := db.recover(path, fresh, recs); err != nil {
+		wal.Close()
+		return err
+	}
+	if err := db.sync(); err != nil {
+		wal.Close()
+		return err
+	}
+	return nil
+}
+
+// recover brings the database to the state the log leaves it in. Images
+// after the last end marker are of a checkpoint cut short before any page
+// was written back, so the file is still as the writes after it expect.
+func (db *DB) recover(path string, fresh bool, recs [][]byte) error {
+	end := -1
+	for i, rec := range recs {
+		if len(rec) > 0 && rec[0] == opImagesEnd {
+			end = i
+		}
+	}
+	for _, rec := range recs[:end+1] {
+		if len(rec) > 0 && rec[0] == opPageImage {
+			if err := db.restorePage(rec); err != nil {
+				return err
+			}
+		}
+	}
+	var writes [][]byte
+	for _, rec := range recs[end+1:] {
+		if len(rec) == 0 || rec[0] != opPageImage {
+			writes = append(writes, rec)
+		}
+	}
+
+	var err error
+	if fresh && end < 0 {
+		if len(writes) > 0 {
+			// Open checkpoints before it returns, so a log with writes
+			// always has a database file with a catalog
+			return fmt.Errorf("kv: log %s.wal belongs to no database file", path)
+		}
+		err = db.create(db.fileID)
+	} else {
+		err = db.load(db.fileID)
+	}
+	if err != nil {
+		return err
+	}
+	for _, rec := range writes {
+		if err := db.redo(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restorePage puts a logged page image in the pool, growing the file to
+// hold it if the crash came before the file did.
+func (db *DB) restorePage(rec []byte) error {
+	if len(rec) != 3+8+manager.PageSize {
+		return errBadLogRecord
+	}
+	pageNo := binary.LittleEndian.Uint64(rec[3:])
+	for {
+		count, err := db.bm.PageCount(db.fileID)
+		if err != nil {
+			return err
+		}
+		if pageNo < count {
+			break
+		}
+		id, _, err := db.bm.NewPageIn(db.fileID)
+		if err != nil {
+			return err
+		}
+		if err := db.bm.UnpinPage(id, true); err != nil {
+			return err
+		}
+	}
+	id := manager.MakePageID(db.fileID, pageNo)
+	data, err := db.bm.PinPage(id)
+	if err != nil {
+		return err
+	}
+	copy(data[:], rec[3+8:])
+	return db.bm.UnpinPage(id, true)
+}
+
+// create lays out an empty database in a new tablespace.
+func (db *DB) create(fileID manager.FileID) error {
+	cat, err := catalog.Create(db.bm, fileID)
+	if err != nil {
+		return err
+	}
+	heap, err := heapfile.Create(db.bm, fileID)
+	if err != nil {
+		return err
+	}
+	opts := map[string]string{heapOption: strconv.FormatUint(uint64(heap.First()), 10)}
+	index, err := cat.CreateIndex(treeName, catalog.BTreeIndex, treeSchema, opts)
+	if err != nil {
+		return err
+	}
+	db.cat, db.heap = cat, heap
+	db.root = &Bucket{db: db, index: index, tree: index.Tree()}
+	return nil
+}
+
+// load opens the structures of an existing database.
+func (db *DB) load(fileID manager.FileID) error {
+	cat, err := catalog.Open(db.bm, fileID)
+	if err != nil {
+		return err
+	}
+	index, err := cat.OpenIndex(treeName)
+	if err != nil {
+		return fmt.Errorf("kv: %w: %q", err, treeName)
+	}
+	first, err := strconv.ParseUint(index.Info().Options[heapOption], 10, 64)
+	if err != nil {
+		return fmt.Errorf("kv: index %q names no heap file", treeName)
+	}
+	heap, err := heapfile.Open(db.bm, manager.PageID(first))
+	if err != nil {
+		return err
+	}
+	db.cat, db.heap = cat, heap
+	db.root = &Bucket{db: db, index: index, tree: index.Tree()}
+	for _, info := range cat.Indexes() {
+		path, ok := strings.CutPrefix(info.Name, treeName+pathSep)
+		if !ok {
+			continue
+		}
+		index, err := cat.OpenIndex(info.Name)
+		if err != nil {
+			return err
+		}
+		db.buckets[path] = &Bucket{db: db, path: path, index: index, tree: index.Tree()}
+	}
+	return nil
+}
+
+// Get returns a copy of the value stored under key in the top-level
+// keyspace, and whether there is one.
+func (db *DB) Get(key uint64) ([]byte, bool, error) {
+	return db.root.Get(key)
+}
+
+// Put stores value under key in the top-level keyspace, replacing any
+// value already there. Values are at most heapfile.MaxRecordSize bytes.
+func (db *DB) Put(key uint64, value []byte) error {
+	return db.root.Put(key, value)
+}
+
+// Delete removes key and its value from the top-level keyspace, if there
+// is one.
+func (db *DB) Delete(key uint64) error {
+	return db.root.Delete(key)
+}
+
+// Scan calls fn with each key of the top-level keyspace from lo to hi
+// inclusive and its value, as Bucket.Scan does.
+func (db *DB) Scan(lo, hi uint64, fn func(key uint64, value []byte) error) error {
+	return db.root.Scan(lo, hi, fn)
+}
+
+// Cursor returns a cursor over the top-level keyspace.
+func (db *DB) Cursor() *Cursor {
+	return db.root.Cursor()
+}
+
+// Sync makes every write so far durable in the database file and empties
+// the log.
+func (db *DB) Sync() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	return db.sync()
+}
+
+// Close syncs the database and closes its files. Closing a closed DB does
+// nothing.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	err := db.sync()
+	if werr := db.wal.Close(); err == nil {
+		err = werr
+	}
+	if err != nil {
+		// The log has what the file lacks
+		db.bm.Discard()
+		return err
+	}
+	return db.bm.Close()
+}
+
+// sync is the checkpoint: the log may only be emptied once the pages of
+// the writes it holds are durable, and the pages may only be written in
+// place once their images are.
+func (db *DB) sync() error {
+	if err := db.root.index.Sync(); err != nil {
+		return err
+	}
+	for _, b := range db.buckets {
+		if err := b.index.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := db.logImages(); err != nil {
+		return err
+	}
+	if err := db.bm.Sync(); err != nil {
+		return err
+	}
+	if err := db.wal.Reset(); err != nil {
+		return err
+	}
+	db.logged = 0
+	db.stats.checkpoints.Add(1)
+	if db.bm.Frames() > db.frames {
+		// The pages are clean now; if some are pinned the pool shrinks at
+		// a later checkpoint
+		db.bm.Resize(db.frames)
+	}
+	return nil
+}
+
+// logImages logs a copy of every dirty page and an end marker, and waits
+// for them to be durable.
+func (db *DB) logImages() error {
+	ids := db.bm.HeldPages()
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, id := range ids {
+		if id.FileID() != db.fileID {
+			continue
+		}
+		data, err := db.bm.PinPage(id)
+		if err != nil {
+			return err
+		}
+		rec := appendOp(nil, opPageImage, "", id.PageNo(), data[:])
+		db.bm.UnpinPage(id, false)
+		if _, err := db.wal.Append(rec); err != nil {
+			return err
+		}
+	}
+	lsn, err := db.wal.Append(appendOp(nil, opImagesEnd, "", 0, nil))
+	if err != nil {
+		return err
+	}
+	if err := db.wal.Flush(lsn); err != nil {
+		return err
+	}
+	if db.imagesLogged != nil {
+		db.imagesLogged()
+	}
+	return nil
+}
+
+// checkpointDue reports whether to checkpoint before logging n more
+// bytes: when half the pool holds dirty pages, or when the log would
+// outgrow what the pool holds, since recovery replays it in memory.
+func (db *DB) checkpointDue(n int) bool {
+	return db.bm.Stats().Dirty*2 >= db.frames || db.logged+n > db.frames*manager.PageSize
+}
+
+// appendOp appends a log record to dst.
+func appendOp(dst []byte, op byte, path string, key uint64, value []byte) []byte {
+	dst = append(dst, op)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(path)))
+	dst = append(dst, path...)
+	if op == opPut || op == opDelete || op == opPageImage {
+		dst = binary.LittleEndian.AppendUint64(dst, key)
+		dst = append(dst, value...)
+	}
+	return dst
+}
+
+// log appends a record to the log and, unless NoSync is set, waits for
+// it to be durable.
+func (db *DB) log(op byte, path string, key uint64, value []byte) error {
+	return db.logRecord(appendOp(nil, op, path, key, value))
+}
+
+func (db *DB) logRecord(rec []byte) error {
+	if db.checkpointDue(len(rec)) {
+		if err := db.sync(); err != nil {
+			return err
+		}
+	}
+	lsn, err := db.wal.Append(rec)
+	if err != nil {
+		return err
+	}
+	db.logged += len(rec)
+	if db.noSync {
+		return nil
+	}
+	return db.wal.Flush(lsn)
+}
+
+// redo applies a log record. Each ends in the same state however often it
+// is redone.
+func (db *DB) redo(data []byte) error {
+	if len(data) < 3 {
+		return errBadLogRecord
+	}
+	op, n := data[0], int(binary.LittleEndian.Uint16(data[1:]))
+	if len(data) < 3+n {
+		return errBadLogRecord
+	}
+	path, data := string(data[3:3+n]), data[3+n:]
+	switch op {
+	case opCreateBucket:
+		_, err := db.createBucket(path, true)
+		return err
+	case opDeleteBucket:
+		return db.deleteBucket(path)
+	case opPut, opDelete:
+		if len(data) < 8 {
+			return errBadLogRecord
+		}
+		b, err := db.bucket(path)
+		if err != nil {
+			return err
+		}
+		key := binary.LittleEndian.Uint64(data)
+		if op == opPut {
+			return b.put(key, data[8:])
+		}
+		return b.delete(key)
+	case opBatch:
+		return redoBatch(data, db.redo)
+	}
+	return errBadLogRecord
+}
@@ -0,0 +1,203 @@
+package kv
+
+import (
+	"bytes"
+	"fmt"
+	"manager"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// state is what a database should hold: values by key, per bucket path.
+type state map[string]map[uint64][]byte
+
+func (s state) clone() state {
+	c := make(state, len(s))
+	for path, m := range s {
+		c[path] = maps.Clone(m)
+	}
+	return c
+}
+
+func value(r *rand.Rand, key uint64) []byte {
+	return bytes.Repeat(fmt.Appendf(nil, "%d;", key), 1+r.IntN(100))
+}
+
+// copyDB copies the database file and its log, as a crash would leave
+// them, into a new directory.
+func copyDB(t *testing.T, path string) string {
+	t.Helper()
+	dst := filepath.Join(t.TempDir(), "db")
+	for _, suffix := range []string{"", ".wal"} {
+		data, err := os.ReadFile(path + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dst+suffix, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dst
+}
+
+// check reopens the database at path and compares it to want.
+func check(t *testing.T, path string, want state) {
+	t.Helper()
+	db, err := Open(path, &Options{Frames: 16})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+	for name, values := range want {
+		b := db.root
+		if name != "" {
+			if b, err = db.Bucket(name); err != nil {
+				t.Fatalf("bucket %q: %v", name, err)
+			}
+		}
+		got := make(map[uint64][]byte)
+		err := b.Scan(0, ^uint64(0), func(key uint64, value []byte) error {
+			got[key] = bytes.Clone(value)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("scan of %q: %v", name, err)
+		}
+		if !maps.EqualFunc(got, values, bytes.Equal) {
+			t.Fatalf("bucket %q holds %d keys, want %d", name, len(got), len(values))
+		}
+	}
+	names, err := db.Buckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(want)-1 {
+		t.Errorf("buckets %q, want %d", names, len(want)-1)
+	}
+}
+
+// run makes random writes to db, many more than its pool holds, calling
+// snapshot every so often with what the database should hold.
+func run(t *testing.T, db *DB, snapshot func(state)) {
+	r := rand.New(rand.NewPCG(1, 2))
+	want := state{"": {}}
+	for i := range 3000 {
+		key := r.Uint64N(2000)
+		switch n := r.IntN(20); {
+		case n == 0 && want["b"] == nil:
+			if _, err := db.CreateBucket("b"); err != nil {
+				t.Fatal(err)
+			}
+			want["b"] = map[uint64][]byte{}
+		case n == 0:
+			if err := db.DeleteBucket("b"); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, "b")
+		case n < 4 && want["b"] != nil:
+			b, err := db.Bucket("b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := value(r, key)
+			if err := b.Put(key, v); err != nil {
+				t.Fatal(err)
+			}
+			want["b"][key] = v
+		case n < 6:
+			if err := db.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			delete(want[""], key)
+		case n < 7:
+			var batch Batch
+			for j := range uint64(50) {
+				v := value(r, key+j)
+				batch.Put(key+j, v)
+				want[""][key+j] = v
+			}
+			if err := db.Write(&batch); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			v := value(r, key)
+			if err := db.Put(key, v); err != nil {
+				t.Fatal(err)
+			}
+			want[""][key] = v
+		}
+		if i%300 == 299 {
+			snapshot(want)
+		}
+	}
+}
+
+func TestRecoverFromCopies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := Open(path, &Options{Frames: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	type crash struct {
+		path string
+		want state
+	}
+	var crashes []crash
+	run(t, db, func(want state) {
+		crashes = append(crashes, crash{copyDB(t, path), want.clone()})
+	})
+	if db.stats.checkpoints.Load() < 5 {
+		t.Fatalf("%d checkpoints, want writes to have forced many", db.stats.checkpoints.Load())
+	}
+	if frames := db.bm.Frames(); frames != 16 {
+		t.Errorf("pool of %d frames after a checkpoint, want 16", frames)
+	}
+	for i, c := range crashes {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			check(t, c.path, c.want)
+		})
+	}
+}
+
+func TestRecoverMidCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := Open(path, &Options{Frames: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var copied string
+	var torn int
+	run(t, db, func(want state) {
+		// Crash once the images are logged, with some of the pages they
+		// are of half written back
+		db.imagesLogged = func() {
+			copied = copyDB(t, path)
+			f, err := os.OpenFile(copied, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			garbage := bytes.Repeat([]byte{0xa5}, 2048)
+			for i, id := range db.bm.HeldPages() {
+				if i%2 == 0 && id.FileID() == db.fileID {
+					f.WriteAt(garbage, int64(id.PageNo())*manager.PageSize)
+					torn++
+				}
+			}
+		}
+		err := db.Sync()
+		db.imagesLogged = nil
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, copied, want)
+	})
+	if torn == 0 {
+		t.Error("no page was torn")
+	}
+}
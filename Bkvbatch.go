@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"encoding/binary"
+	"heapfile"
+)
+
+// Batch collects writes to the top-level keyspace for Write to apply
+// together. The zero value is an empty batch.
+type Batch struct {
+	ops []byte // log records, each as length(4) record
+	n   int
+	err error
+}
+
+// Put adds storing value under key to the batch.
+func (b *Batch) Put(key uint64, value []byte) {
+	if len(value) > heapfile.MaxRecordSize && b.err == nil {
+		b.err = heapfile.ErrRecordTooLarge
+	}
+	b.add(opPut, key, value)
+}
+
+// Delete adds removing key to the batch.
+func (b *Batch) Delete(key uint64) {
+	b.add(opDelete, key, nil)
+}
+
+// Len returns the number of writes in the batch.
+func (b *Batch) Len() int {
+	return b.n
+}
+
+// Reset empties the batch for reuse.
+func (b *Batch) Reset() {
+	*b = Batch{ops: b.ops[:0]}
+}
+
+func (b *Batch) add(op byte, key uint64, value []byte) {
+	start := len(b.ops)
+	b.ops = binary.LittleEndian.AppendUint32(b.ops, 0)
+	b.ops = appendOp(b.ops, op, "", key, value)
+	binary.LittleEndian.PutUint32(b.ops[start:], uint32(len(b.ops)-start-4))
+	b.n++
+}
+
+// Write applies the writes of batch in order. They are logged as one
+// record, so a crash leaves all of them or none. A batch holding a value
+// too large to store is rejected as a whole.
+func (db *DB) Write(batch *Batch) error {
+	if batch.err != nil {
+		return batch.err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if batch.n == 0 {
+		return nil
+	}
+	db.stats.batches.Add(1)
+	rec := appendOp(nil, opBatch, "", 0, nil)
+	if err := db.logRecord(append(rec, batch.ops...)); err != nil {
+		return err
+	}
+	return redoBatch(batch.ops, db.redo)
+}
+
+// redoBatch applies each record of a batch with redo.
+func redoBatch(ops []byte, redo func([]byte) error) error {
+	for len(ops) > 0 {
+		if len(ops) < 4 {
+			return errBadLogRecord
+		}
+		n := binary.LittleEndian.Uint32(ops)
+		if uint64(len(ops)-4) < uint64(n) {
+			return errBadLogRecord
+		}
+		if err := redo(ops[4 : 4+n]); err != nil {
+			return err
+		}
+		ops = ops[4+n:]
+	}
+	return nil
+}
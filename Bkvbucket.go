@@ -0,0 +1,418 @@
+package kv
+
+import (
+	"btree"
+	"catalog"
+	"errors"
+	"heapfile"
+	"iter"
+	"math"
+	"slices"
+	"strings"
+)
+
+// pathSep joins the names of nested buckets into a path, so bucket names
+// may not hold it.
+const pathSep = "\x00"
+
+var (
+	// ErrBucketExists is returned by CreateBucket for a name in use.
+	ErrBucketExists = errors.New("kv: bucket already exists")
+	// ErrBucketNotFound is returned for a bucket that does not exist, or
+	// by the methods of one that has been deleted.
+	ErrBucketNotFound = errors.New("kv: bucket not found")
+	// ErrBucketName is returned for an empty bucket name or one holding a
+	// NUL byte.
+	ErrBucketName = errors.New("kv: bucket name is empty or holds a NUL byte")
+)
+
+// Bucket is a keyspace of its own: a key in one bucket is unrelated to the
+// same key elsewhere. Buckets hold buckets of their own by name, and the
+// DB's top-level keyspace holds the outermost ones. Each bucket is a B+Tree
+// in the catalog, with its values in the database's shared heap file. A
+// Bucket stays usable until it or a bucket around it is deleted.
+type Bucket struct {
+	db *DB
+	// path is the names of the bucket and those around it, outermost
+	// first, joined by pathSep; "" for the top-level keyspace
+	path    string
+	index   *catalog.Index
+	tree    *btree.BTree
+	deleted bool
+}
+
+// catalogName is the name of the catalog entry of the bucket at path.
+func catalogName(path string) string {
+	return treeName + pathSep + path
+}
+
+// CreateBucket creates an empty bucket called name at the top level.
+func (db *DB) CreateBucket(name string) (*Bucket, error) {
+	return db.root.CreateBucket(name)
+}
+
+// CreateBucketIfNotExists returns the top-level bucket called name,
+// creating it if needed.
+func (db *DB) CreateBucketIfNotExists(name string) (*Bucket, error) {
+	return db.root.CreateBucketIfNotExists(name)
+}
+
+// Bucket returns the top-level bucket called name.
+func (db *DB) Bucket(name string) (*Bucket, error) {
+	return db.root.Bucket(name)
+}
+
+// DeleteBucket deletes the top-level bucket called name, as
+// Bucket.DeleteBucket does.
+func (db *DB) DeleteBucket(name string) error {
+	return db.root.DeleteBucket(name)
+}
+
+// Buckets returns the names of the top-level buckets in order.
+func (db *DB) Buckets() ([]string, error) {
+	return db.root.Buckets()
+}
+
+// Name returns the bucket's name, "" for the top-level keyspace.
+func (b *Bucket) Name() string {
+	return b.path[strings.LastIndex(b.path, pathSep)+1:]
+}
+
+// CreateBucket creates an empty bucket called name in b.
+func (b *Bucket) CreateBucket(name string) (*Bucket, error) {
+	return b.create(name, false)
+}
+
+// CreateBucketIfNotExists returns the bucket called name in b, creating it
+// if needed.
+func (b *Bucket) CreateBucketIfNotExists(name string) (*Bucket, error) {
+	return b.create(name, true)
+}
+
+func (b *Bucket) create(name string, ifNotExists bool) (*Bucket, error) {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	path, err := b.child(name)
+	if err != nil {
+		return nil, err
+	}
+	if child, exists := b.db.buckets[path]; exists {
+		if ifNotExists {
+			return child, nil
+		}
+		return nil, ErrBucketExists
+	}
+	if err := b.db.log(opCreateBucket, path, 0, nil); err != nil {
+		return nil, err
+	}
+	return b.db.createBucket(path, ifNotExists)
+}
+
+// Bucket returns the bucket called name in b.
+func (b *Bucket) Bucket(name string) (*Bucket, error) {
+	b.db.mu.RLock()
+	defer b.db.mu.RUnlock()
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	path, err := b.child(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.db.bucket(path)
+}
+
+// DeleteBucket deletes the bucket called name in b, with its values and
+// the buckets inside it. Their tree pages are not reused.
+func (b *Bucket) DeleteBucket(name string) error {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	if err := b.check(); err != nil {
+		return err
+	}
+	path, err := b.child(name)
+	if err != nil {
+		return err
+	}
+	if _, exists := b.db.buckets[path]; !exists {
+		return ErrBucketNotFound
+	}
+	if err := b.db.log(opDeleteBucket, path, 0, nil); err != nil {
+		return err
+	}
+	return b.db.deleteBucket(path)
+}
+
+// Buckets returns the names of the buckets in b in order.
+func (b *Bucket) Buckets() ([]string, error) {
+	b.db.mu.RLock()
+	defer b.db.mu.RUnlock()
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	prefix := b.path + pathSep
+	if b.path == "" {
+		prefix = ""
+	}
+	var names []string
+	for path := range b.db.buckets {
+		if name, ok := strings.CutPrefix(path, prefix); ok && !strings.Contains(name, pathSep) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Get returns a copy of the value stored under key in b, and whether there
+// is one.
+func (b *Bucket) Get(key uint64) ([]byte, bool, error) {
+	b.db.mu.RLock()
+	defer b.db.mu.RUnlock()
+	if err := b.check(); err != nil {
+		return nil, false, err
+	}
+	b.db.stats.gets.Add(1)
+	rid, found, err := b.lookup(key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	value, err := b.db.heap.Get(rid)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Put stores value under key in b, replacing any value already there.
+// Values are at most heapfile.MaxRecordSize bytes.
+func (b *Bucket) Put(key uint64, value []byte) error {
+	if len(value) > heapfile.MaxRecordSize {
+		return heapfile.ErrRecordTooLarge
+	}
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	if err := b.check(); err != nil {
+		return err
+	}
+	b.db.stats.puts.Add(1)
+	if err := b.db.log(opPut, b.path, key, value); err != nil {
+		return err
+	}
+	return b.put(key, value)
+}
+
+// Delete removes key and its value from b, if there is one.
+func (b *Bucket) Delete(key uint64) error {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	if err := b.check(); err != nil {
+		return err
+	}
+	b.db.stats.deletes.Add(1)
+	_, found, err := b.lookup(key)
+	if err != nil || !found {
+		return err
+	}
+	if err := b.db.log(opDelete, b.path, key, nil); err != nil {
+		return err
+	}
+	return b.delete(key)
+}
+
+// Scan calls fn with each key of b from lo to hi inclusive and its value,
+// in key order, until fn returns an error, which Scan then returns. As in
+// a Cursor walk, fn must not call the database's methods.
+func (b *Bucket) Scan(lo, hi uint64, fn func(key uint64, value []byte) error) error {
+	cursor := b.Cursor()
+	for key, value := range cursor.Range(lo, hi) {
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Cursor walks the keys of a bucket in order. Iterators cannot return
+// errors, so a walk stops at the first read that fails and Err reports
+// why.
+type Cursor struct {
+	b   *Bucket
+	err error
+}
+
+// Cursor returns a cursor over b.
+func (b *Bucket) Cursor() *Cursor {
+	return &Cursor{b: b}
+}
+
+// Err returns the error that ended the last walk, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// All returns an iterator over every key of the bucket and its value, in
+// key order. The database is read-locked for the walk, so the loop body
+// must not call its methods.
+func (c *Cursor) All() iter.Seq2[uint64, []byte] {
+	return c.Range(0, math.MaxUint64)
+}
+
+// Range returns an iterator over the keys from lo to hi inclusive and
+// their values, in key order, as All does over every key.
+func (c *Cursor) Range(lo, hi uint64) iter.Seq2[uint64, []byte] {
+	return func(yield func(uint64, []byte) bool) {
+		db := c.b.db
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		if c.err = c.b.check(); c.err != nil {
+			return
+		}
+		db.stats.scans.Add(1)
+		cursor := c.b.tree.Cursor()
+		for key, v := range cursor.Range(lo, hi) {
+			value, err := db.heap.Get(heapfile.RIDFromUint64(v))
+			if err != nil {
+				c.err = err
+				return
+			}
+			if !yield(key, value) {
+				return
+			}
+		}
+		c.err = cursor.Err()
+	}
+}
+
+// check fails if b can no longer be used. db.mu must be held.
+func (b *Bucket) check() error {
+	if b.db.closed {
+		return ErrClosed
+	}
+	if b.deleted {
+		return ErrBucketNotFound
+	}
+	return nil
+}
+
+// child returns the path of the bucket called name in b.
+func (b *Bucket) child(name string) (string, error) {
+	if name == "" || strings.Contains(name, pathSep) {
+		return "", ErrBucketName
+	}
+	if b.path == "" {
+		return name, nil
+	}
+	return b.path + pathSep + name, nil
+}
+
+// lookup finds the RID of key's value. BTree.Get does not tell a missing
+// key from a failed read, so the lookup is a one-key range.
+func (b *Bucket) lookup(key uint64) (heapfile.RID, bool, error) {
+	cursor := b.tree.Cursor()
+	for _, v := range cursor.Range(key, key) {
+		return heapfile.RIDFromUint64(v), true, nil
+	}
+	return heapfile.RID{}, false, cursor.Err()
+}
+
+func (b *Bucket) put(key uint64, value []byte) error {
+	rid, found, err := b.lookup(key)
+	if err != nil {
+		return err
+	}
+	if found {
+		return b.db.heap.Update(rid, value)
+	}
+	rid, err = b.db.heap.Insert(value)
+	if err != nil {
+		return err
+	}
+	if err := b.tree.Insert(key, rid.Uint64()); err != nil {
+		return err
+	}
+	// Keep the catalog's root current for the next checkpoint's images
+	return b.index.Sync()
+}
+
+func (b *Bucket) delete(key uint64) error {
+	rid, found, err := b.lookup(key)
+	if err != nil || !found {
+		return err
+	}
+	if _, err := b.tree.Delete(key); err != nil {
+		return err
+	}
+	return freeValue(b.db.heap, rid)
+}
+
+// freeValue deletes a value from the heap file, if it is still there.
+func freeValue(heap *heapfile.HeapFile, rid heapfile.RID) error {
+	if err := heap.Delete(rid); err != nil && !errors.Is(err, heapfile.ErrNoRecord) {
+		return err
+	}
+	return nil
+}
+
+// bucket returns the bucket at path. db.mu must be held.
+func (db *DB) bucket(path string) (*Bucket, error) {
+	if path == "" {
+		return db.root, nil
+	}
+	b, exists := db.buckets[path]
+	if !exists {
+		return nil, ErrBucketNotFound
+	}
+	return b, nil
+}
+
+// createBucket creates the bucket at path, in a bucket that must exist.
+// db.mu must be held.
+func (db *DB) createBucket(path string, ifNotExists bool) (*Bucket, error) {
+	if b, exists := db.buckets[path]; exists {
+		if ifNotExists {
+			return b, nil
+		}
+		return nil, ErrBucketExists
+	}
+	if i := strings.LastIndex(path, pathSep); i >= 0 {
+		if _, exists := db.buckets[path[:i]]; !exists {
+			return nil, ErrBucketNotFound
+		}
+	}
+	index, err := db.cat.CreateIndex(catalogName(path), catalog.BTreeIndex, treeSchema, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bucket{db: db, path: path, index: index, tree: index.Tree()}
+	db.buckets[path] = b
+	return b, nil
+}
+
+// deleteBucket deletes the bucket at path and those inside it, if they
+// exist. db.mu must be held.
+func (db *DB) deleteBucket(path string) error {
+	for p, b := range db.buckets {
+		if p != path && !strings.HasPrefix(p, path+pathSep) {
+			continue
+		}
+		cursor := b.tree.Cursor()
+		for _, v := range cursor.All() {
+			if err := freeValue(db.heap, heapfile.RIDFromUint64(v)); err != nil {
+				return err
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+		if err := db.cat.DropIndex(catalogName(p)); err != nil {
+			return err
+		}
+		delete(db.buckets, p)
+		b.deleted = true
+	}
+	return nil
+}
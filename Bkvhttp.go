@@ -0,0 +1,218 @@
+package kvhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"heapfile"
+	"io"
+	"kv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultScanLimit is how many pairs a scan returns when the request
+	// sets no limit, and MaxScanLimit the most it may ask for.
+	DefaultScanLimit = 1000
+	MaxScanLimit     = 100000
+)
+
+// Pair is a key and its value; the value is base64 in JSON.
+type Pair struct {
+	Key   uint64 `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// ScanResult is the response to a scan. Next, if set, is the start of the
+// rest of the range, cut short by the limit.
+type ScanResult struct {
+	Pairs []Pair  `json:"pairs"`
+	Next  *uint64 `json:"next,omitempty"`
+}
+
+// NewHandler returns an HTTP handler for the top-level keyspace of db:
+//
+//	GET    /keys/{key}                       the Pair, or 404
+//	PUT    /keys/{key}                       store the request body, 204
+//	DELETE /keys/{key}                       204, whether or not it existed
+//	GET    /scan?start=&end=&limit=          a ScanResult of start to end inclusive
+//	GET    /admin/stats                      db.Stats()
+//
+// Keys are decimal. Other methods get 405. Errors are JSON objects with
+// an "error" string.
+//
+// The routes are plain paths, matched the same way whatever the
+// httpmuxgo121 setting, since GOPATH builds default to the Go 1.21 mux.
+func NewHandler(db *kv.DB) http.Handler {
+	h := &handler{db: db}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys/", h.keys)
+	mux.HandleFunc("/scan", methods(h.scan, http.MethodGet))
+	mux.HandleFunc("/admin/stats", methods(h.stats, http.MethodGet))
+	return mux
+}
+
+type handler struct {
+	db *kv.DB
+}
+
+func (h *handler) keys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r)
+	case http.MethodPut:
+		h.put(w, r)
+	case http.MethodDelete:
+		h.delete(w, r)
+	default:
+		notAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// methods limits f to the given methods, and HEAD if GET is among them.
+func methods(f http.HandlerFunc, allowed ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range allowed {
+			if r.Method == m || r.Method == http.MethodHead && m == http.MethodGet {
+				f(w, r)
+				return
+			}
+		}
+		notAllowed(w, allowed...)
+	}
+}
+
+func notAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, errorBody{"method not allowed"})
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	key, ok := parseKey(w, r)
+	if !ok {
+		return
+	}
+	value, found, err := h.db.Get(key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, errorBody{"key not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Pair{Key: key, Value: value})
+}
+
+func (h *handler) put(w http.ResponseWriter, r *http.Request) {
+	key, ok := parseKey(w, r)
+	if !ok {
+		return
+	}
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, heapfile.MaxRecordSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = heapfile.ErrRecordTooLarge
+		}
+		writeError(w, err)
+		return
+	}
+	if err := h.db.Put(key, value); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	key, ok := parseKey(w, r)
+	if !ok {
+		return
+	}
+	if err := h.db.Delete(key); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) scan(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, err := queryUint(q.Get("start"), 0)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{"bad start: " + err.Error()})
+		return
+	}
+	end, err := queryUint(q.Get("end"), math.MaxUint64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{"bad end: " + err.Error()})
+		return
+	}
+	limit, err := queryUint(q.Get("limit"), DefaultScanLimit)
+	if err != nil || limit == 0 || limit > MaxScanLimit {
+		writeJSON(w, http.StatusBadRequest, errorBody{"limit must be 1 to " + strconv.Itoa(MaxScanLimit)})
+		return
+	}
+
+	res := ScanResult{Pairs: []Pair{}}
+	errLimit := errors.New("limit reached")
+	err = h.db.Scan(start, end, func(key uint64, value []byte) error {
+		if uint64(len(res.Pairs)) == limit {
+			res.Next = &key
+			return errLimit
+		}
+		res.Pairs = append(res.Pairs, Pair{Key: key, Value: value})
+		return nil
+	})
+	if err != nil && err != errLimit {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.db.Stats())
+}
+
+func parseKey(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	key, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/keys/"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{"bad key: " + err.Error()})
+		return 0, false
+	}
+	return key, true
+}
+
+// queryUint parses a decimal query parameter, def if it is absent.
+func queryUint(s string, def uint64) (uint64, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// writeError maps the errors of the database to HTTP status codes.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, kv.ErrClosed):
+		code = http.StatusServiceUnavailable
+	case errors.Is(err, heapfile.ErrRecordTooLarge):
+		code = http.StatusRequestEntityTooLarge
+	}
+	writeJSON(w, code, errorBody{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,188 @@
+package kvhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"heapfile"
+	"io"
+	"kv"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// serve starts a server on a new database and returns its URL.
+func serve(t *testing.T) (*kv.DB, string) {
+	t.Helper()
+	db, err := kv.Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewHandler(db))
+	t.Cleanup(func() {
+		srv.Close()
+		db.Close()
+	})
+	return db, srv.URL
+}
+
+// do sends a request and returns the response's status and body.
+func do(t *testing.T, method, url string, body []byte) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, b
+}
+
+func decode[T any](t *testing.T, b []byte) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatalf("decoding %s: %v", b, err)
+	}
+	return v
+}
+
+func TestKeys(t *testing.T) {
+	_, url := serve(t)
+	if code, b := do(t, "PUT", url+"/keys/7", []byte("seven")); code != http.StatusNoContent {
+		t.Fatalf("PUT /keys/7: %d %s", code, b)
+	}
+	code, b := do(t, "GET", url+"/keys/7", nil)
+	if code != http.StatusOK {
+		t.Fatalf("GET /keys/7: %d %s", code, b)
+	}
+	if p := decode[Pair](t, b); p.Key != 7 || string(p.Value) != "seven" {
+		t.Errorf("GET /keys/7 = %+v", p)
+	}
+	if code, b := do(t, "DELETE", url+"/keys/7", nil); code != http.StatusNoContent {
+		t.Fatalf("DELETE /keys/7: %d %s", code, b)
+	}
+	if code, b := do(t, "GET", url+"/keys/7", nil); code != http.StatusNotFound {
+		t.Errorf("GET of a deleted key: %d %s, want 404", code, b)
+	}
+	if code, _ := do(t, "DELETE", url+"/keys/7", nil); code != http.StatusNoContent {
+		t.Errorf("DELETE of an absent key: %d, want 204", code)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	_, url := serve(t)
+	for _, tc := range []struct {
+		method, path string
+		body         []byte
+		want         int
+	}{
+		{"GET", "/keys/seven", nil, http.StatusBadRequest},
+		{"GET", "/keys/", nil, http.StatusBadRequest},
+		{"GET", "/keys/1/2", nil, http.StatusBadRequest},
+		{"GET", "/keys/-1", nil, http.StatusBadRequest},
+		{"PUT", "/keys/18446744073709551616", nil, http.StatusBadRequest},
+		{"PUT", "/keys/1", make([]byte, heapfile.MaxRecordSize+1), http.StatusRequestEntityTooLarge},
+		{"POST", "/keys/1", nil, http.StatusMethodNotAllowed},
+		{"DELETE", "/scan", nil, http.StatusMethodNotAllowed},
+		{"PUT", "/admin/stats", nil, http.StatusMethodNotAllowed},
+		{"GET", "/scan?limit=0", nil, http.StatusBadRequest},
+		{"GET", fmt.Sprintf("/scan?limit=%d", MaxScanLimit+1), nil, http.StatusBadRequest},
+		{"GET", "/scan?start=x", nil, http.StatusBadRequest},
+		{"GET", "/scan?end=-1", nil, http.StatusBadRequest},
+		{"GET", "/nowhere", nil, http.StatusNotFound},
+	} {
+		code, b := do(t, tc.method, url+tc.path, tc.body)
+		if code != tc.want {
+			t.Errorf("%s %s: %d %s, want %d", tc.method, tc.path, code, b, tc.want)
+			continue
+		}
+		if code != http.StatusNotFound && decode[errorBody](t, b).Error == "" {
+			t.Errorf("%s %s: no error message in %s", tc.method, tc.path, b)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	db, url := serve(t)
+	for k := range uint64(100) {
+		if err := db.Put(k, fmt.Appendf(nil, "v%d", k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pages of 30 from key 10 to 95 follow Next to the end
+	var keys []uint64
+	start := uint64(10)
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("scan never ended")
+		}
+		code, b := do(t, "GET", fmt.Sprintf("%s/scan?start=%d&end=95&limit=30", url, start), nil)
+		if code != http.StatusOK {
+			t.Fatalf("scan from %d: %d %s", start, code, b)
+		}
+		res := decode[ScanResult](t, b)
+		if len(res.Pairs) > 30 {
+			t.Fatalf("scan with limit 30 returned %d pairs", len(res.Pairs))
+		}
+		for _, p := range res.Pairs {
+			if string(p.Value) != fmt.Sprintf("v%d", p.Key) {
+				t.Errorf("scan yielded %d = %q", p.Key, p.Value)
+			}
+			keys = append(keys, p.Key)
+		}
+		if res.Next == nil {
+			break
+		}
+		if len(res.Pairs) != 30 || *res.Next != res.Pairs[29].Key+1 {
+			t.Fatalf("scan of %d pairs set Next to %d", len(res.Pairs), *res.Next)
+		}
+		start = *res.Next
+	}
+	if len(keys) != 86 || keys[0] != 10 || keys[85] != 95 {
+		t.Errorf("paged scan yielded %d keys, %v", len(keys), keys)
+	}
+
+	// The default range is everything, and an empty range is an empty list
+	code, b := do(t, "GET", url+"/scan", nil)
+	if res := decode[ScanResult](t, b); code != http.StatusOK || len(res.Pairs) != 100 || res.Next != nil {
+		t.Errorf("GET /scan: %d, %d pairs, next %v", code, len(res.Pairs), res.Next)
+	}
+	code, b = do(t, "GET", url+"/scan?start=200", nil)
+	if code != http.StatusOK || !bytes.Contains(b, []byte(`"pairs":[]`)) {
+		t.Errorf("scan past the last key: %d %s", code, b)
+	}
+}
+
+func TestStats(t *testing.T) {
+	db, url := serve(t)
+	db.Put(1, []byte("one"))
+	db.Get(1)
+	db.Get(2)
+	code, b := do(t, "GET", url+"/admin/stats", nil)
+	if code != http.StatusOK {
+		t.Fatalf("GET /admin/stats: %d %s", code, b)
+	}
+	s := decode[kv.Stats](t, b)
+	if s.Puts != 1 || s.Gets != 2 || s.HeapPages == 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	db, url := serve(t)
+	db.Close()
+	if code, b := do(t, "GET", url+"/keys/1", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("GET from a closed database: %d %s, want 503", code, b)
+	}
+}
@@ -0,0 +1,418 @@
+package kvrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"heapfile"
+	"kv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The KV service of kvrpc.proto. Its messages are encoded here by hand in
+// the protobuf wire format, which keeps the package free of generated
+// code while clients in other languages use the .proto as usual.
+const (
+	serviceName = "kvrpc.KV"
+	// scanChunk is how many pairs a scan reads per hold of the database's
+	// read lock, which it does not keep while sending
+	scanChunk = 256
+)
+
+// message is a message of the service.
+type message interface {
+	marshal(dst []byte) []byte
+	unmarshal(data []byte) error
+}
+
+// codec encodes messages. It is named "proto" after the content subtype
+// protobuf clients send, and forced on the server's and the Client's calls
+// rather than registered, so it does not replace the protobuf codec of
+// other services in the process.
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("kvrpc: cannot marshal %T", v)
+	}
+	return m.marshal(nil), nil
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("kvrpc: cannot unmarshal into %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (codec) Name() string {
+	return "proto"
+}
+
+// keyValue is a PutRequest or a Pair.
+type keyValue struct {
+	key   uint64
+	value []byte
+}
+
+// keyOnly is a GetRequest or a DeleteRequest.
+type keyOnly struct {
+	key uint64
+}
+
+type getResponse struct {
+	found bool
+	value []byte
+}
+
+type scanRequest struct {
+	lo, hi, limit uint64
+}
+
+type batchRequest struct {
+	writes []write
+}
+
+type write struct {
+	key    uint64
+	value  []byte
+	delete bool
+}
+
+// empty is a PutResponse, DeleteResponse or BatchResponse.
+type empty struct{}
+
+func (m *keyValue) marshal(dst []byte) []byte {
+	dst = appendVarint(dst, 1, m.key)
+	return appendBytes(dst, 2, m.value)
+}
+
+func (m *keyValue) unmarshal(data []byte) error {
+	return fields(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			m.key = v
+		case num == 2 && typ == protowire.BytesType:
+			m.value = bytes.Clone(b)
+		}
+		return nil
+	})
+}
+
+func (m *keyOnly) marshal(dst []byte) []byte {
+	return appendVarint(dst, 1, m.key)
+}
+
+func (m *keyOnly) unmarshal(data []byte) error {
+	return fields(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		if num == 1 && typ == protowire.VarintType {
+			m.key = v
+		}
+		return nil
+	})
+}
+
+func (m *getResponse) marshal(dst []byte) []byte {
+	dst = appendVarint(dst, 1, protowire.EncodeBool(m.found))
+	return appendBytes(dst, 2, m.value)
+}
+
+func (m *getResponse) unmarshal(data []byte) error {
+	return fields(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			m.found = v != 0
+		case num == 2 && typ == protowire.BytesType:
+			m.value = bytes.Clone(b)
+		}
+		return nil
+	})
+}
+
+func (m *scanRequest) marshal(dst []byte) []byte {
+	dst = appendVarint(dst, 1, m.lo)
+	dst = appendVarint(dst, 2, m.hi)
+	return appendVarint(dst, 3, m.limit)
+}
+
+func (m *scanRequest) unmarshal(data []byte) error {
+	return fields(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		if typ != protowire.VarintType {
+			return nil
+		}
+		switch num {
+		case 1:
+			m.lo = v
+		case 2:
+			m.hi = v
+		case 3:
+			m.limit = v
+		}
+		return nil
+	})
+}
+
+func (m *batchRequest) marshal(dst []byte) []byte {
+	var w []byte
+	for i := range m.writes {
+		w = m.writes[i].marshal(w[:0])
+		dst = protowire.AppendTag(dst, 1, protowire.BytesType)
+		dst = protowire.AppendBytes(dst, w)
+	}
+	return dst
+}
+
+func (m *batchRequest) unmarshal(data []byte) error {
+	return fields(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		var w write
+		if err := w.unmarshal(b); err != nil {
+			return err
+		}
+		m.writes = append(m.writes, w)
+		return nil
+	})
+}
+
+func (m *write) marshal(dst []byte) []byte {
+	dst = appendVarint(dst, 1, m.key)
+	dst = appendBytes(dst, 2, m.value)
+	return appendVarint(dst, 3, protowire.EncodeBool(m.delete))
+}
+
+func (m *write) unmarshal(data []byte) error {
+	return fields(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			m.key = v
+		case num == 2 && typ == protowire.BytesType:
+			m.value = bytes.Clone(b)
+		case num == 3 && typ == protowire.VarintType:
+			m.delete = v != 0
+		}
+		return nil
+	})
+}
+
+func (*empty) marshal(dst []byte) []byte {
+	return dst
+}
+
+func (*empty) unmarshal(data []byte) error {
+	return fields(data, func(protowire.Number, protowire.Type, uint64, []byte) error { return nil })
+}
+
+// appendVarint appends a varint field, unless it has the default value 0,
+// which proto3 leaves out.
+func appendVarint(dst []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return dst
+	}
+	dst = protowire.AppendTag(dst, num, protowire.VarintType)
+	return protowire.AppendVarint(dst, v)
+}
+
+// appendBytes appends a bytes field, unless it is empty.
+func appendBytes(dst []byte, num protowire.Number, b []byte) []byte {
+	if len(b) == 0 {
+		return dst
+	}
+	dst = protowire.AppendTag(dst, num, protowire.BytesType)
+	return protowire.AppendBytes(dst, b)
+}
+
+// fields calls field with each field of an encoded message: with its value
+// if it is a varint, its contents if length-delimited. Fields of other
+// wire types are skipped, and field ignores those it does not know, as
+// protobuf readers do.
+func fields(data []byte, field func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var v uint64
+		var b []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		if err := field(num, typ, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// service is the handler type of serviceDesc.
+type service interface {
+	Put(context.Context, *keyValue) (*empty, error)
+	Get(context.Context, *keyOnly) (*getResponse, error)
+	Delete(context.Context, *keyOnly) (*empty, error)
+	Scan(*scanRequest, grpc.ServerStream) error
+	Batch(context.Context, *batchRequest) (*empty, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*service)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("Put", func(s service, ctx context.Context, req *keyValue) (any, error) { return s.Put(ctx, req) }),
+		unary("Get", func(s service, ctx context.Context, req *keyOnly) (any, error) { return s.Get(ctx, req) }),
+		unary("Delete", func(s service, ctx context.Context, req *keyOnly) (any, error) { return s.Delete(ctx, req) }),
+		unary("Batch", func(s service, ctx context.Context, req *batchRequest) (any, error) { return s.Batch(ctx, req) }),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Scan",
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			req := new(scanRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(service).Scan(req, stream)
+		},
+		ServerStreams: true,
+	}},
+	Metadata: "kvrpc.proto",
+}
+
+// unary describes a unary method, decoding its request into a new Req and
+// running it through the server's interceptor, if any.
+func unary[Req any, PReq interface {
+	*Req
+	message
+}](name string, call func(service, context.Context, PReq) (any, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := PReq(new(Req))
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(service), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + name}
+			return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(service), ctx, req.(PReq))
+			})
+		},
+	}
+}
+
+// NewServer returns a gRPC server serving the top-level keyspace of db as
+// the KV service. opts are passed on to grpc.NewServer. The server speaks
+// only this package's messages, so other services cannot share it.
+func NewServer(db *kv.DB, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append([]grpc.ServerOption{grpc.ForceServerCodec(codec{})}, opts...)...)
+	s.RegisterService(&serviceDesc, &server{db: db})
+	return s
+}
+
+type server struct {
+	db *kv.DB
+}
+
+func (s *server) Put(_ context.Context, req *keyValue) (*empty, error) {
+	return &empty{}, toStatus(s.db.Put(req.key, req.value))
+}
+
+func (s *server) Get(_ context.Context, req *keyOnly) (*getResponse, error) {
+	value, found, err := s.db.Get(req.key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &getResponse{found: found, value: value}, nil
+}
+
+func (s *server) Delete(_ context.Context, req *keyOnly) (*empty, error) {
+	return &empty{}, toStatus(s.db.Delete(req.key))
+}
+
+func (s *server) Batch(_ context.Context, req *batchRequest) (*empty, error) {
+	var batch kv.Batch
+	for _, w := range req.writes {
+		if w.delete {
+			batch.Delete(w.key)
+		} else {
+			batch.Put(w.key, w.value)
+		}
+	}
+	return &empty{}, toStatus(s.db.Write(&batch))
+}
+
+// errChunkFull ends the read of a scan chunk.
+var errChunkFull = errors.New("kvrpc: scan chunk full")
+
+// Scan reads the range a chunk at a time, so the database is not locked
+// while a slow client drains the stream. Each chunk is consistent, but
+// writes between chunks may or may not be seen.
+func (s *server) Scan(req *scanRequest, stream grpc.ServerStream) error {
+	lo, sent := req.lo, uint64(0)
+	pairs := make([]keyValue, 0, scanChunk)
+	for lo <= req.hi {
+		pairs = pairs[:0]
+		err := s.db.Scan(lo, req.hi, func(key uint64, value []byte) error {
+			pairs = append(pairs, keyValue{key: key, value: value})
+			if len(pairs) == scanChunk {
+				return errChunkFull
+			}
+			return nil
+		})
+		if err != nil && err != errChunkFull {
+			return toStatus(err)
+		}
+		for i := range pairs {
+			if req.limit != 0 && sent == req.limit {
+				return nil
+			}
+			if err := stream.SendMsg(&pairs[i]); err != nil {
+				return err
+			}
+			sent++
+		}
+		if err == nil {
+			return nil
+		}
+		last := pairs[len(pairs)-1].key
+		if last == req.hi {
+			return nil
+		}
+		lo = last + 1
+	}
+	return nil
+}
+
+// toStatus maps the errors of the database to gRPC status codes.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, kv.ErrClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, heapfile.ErrRecordTooLarge):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
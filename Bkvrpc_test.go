@@ -0,0 +1,133 @@
+package kvrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"heapfile"
+	"kv"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// serve starts a server on a database in memory of the network and
+// returns a client of it.
+func serve(t *testing.T) (*kv.DB, *Client) {
+	t.Helper()
+	db, err := kv.Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(db)
+	go srv.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+		db.Close()
+	})
+	return db, NewClient(conn)
+}
+
+func TestRoundTrip(t *testing.T) {
+	_, c := serve(t)
+	ctx := context.Background()
+	if err := c.Put(ctx, 1, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := c.Get(ctx, 1); err != nil || !ok || string(v) != "one" {
+		t.Errorf("Get(1) = %q, %v, %v", v, ok, err)
+	}
+	// An empty value is still a value
+	if err := c.Put(ctx, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := c.Get(ctx, 2); err != nil || !ok || len(v) != 0 {
+		t.Errorf("Get(2) = %q, %v, %v", v, ok, err)
+	}
+	if err := c.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := c.Get(ctx, 1); err != nil || ok {
+		t.Errorf("Get of a deleted key = %q, %v, %v", v, ok, err)
+	}
+
+	var batch Batch
+	for k := range uint64(1000) {
+		batch.Put(k, fmt.Appendf(nil, "v%d", k))
+	}
+	batch.Delete(500)
+	if err := c.Batch(ctx, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := c.Get(ctx, 999); err != nil || !ok || string(v) != "v999" {
+		t.Errorf("Get(999) after the batch = %q, %v, %v", v, ok, err)
+	}
+}
+
+func TestScanStreams(t *testing.T) {
+	db, c := serve(t)
+	ctx := context.Background()
+	const n = 3*scanChunk + 10
+	for k := range uint64(n) {
+		if err := db.Put(k, fmt.Appendf(nil, "v%d", k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := uint64(0)
+	err := c.All(ctx, func(key uint64, value []byte) error {
+		if key != next || !bytes.Equal(value, fmt.Appendf(nil, "v%d", key)) {
+			t.Fatalf("scan yielded %d = %q, want key %d", key, value, next)
+		}
+		next++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != n {
+		t.Errorf("scan yielded %d pairs, want %d", next, n)
+	}
+
+	// A range within a chunk, and one the client stops early
+	var keys []uint64
+	if err := c.Scan(ctx, 300, 305, func(key uint64, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil || len(keys) != 6 || keys[0] != 300 {
+		t.Errorf("Scan(300, 305) yielded %v, %v", keys, err)
+	}
+	stop := errors.New("stop")
+	if err := c.All(ctx, func(uint64, []byte) error { return stop }); err != stop {
+		t.Errorf("stopped scan returned %v, want the callback's error", err)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	db, c := serve(t)
+	ctx := context.Background()
+	err := c.Put(ctx, 1, make([]byte, heapfile.MaxRecordSize+1))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("oversized Put: %v, want InvalidArgument", err)
+	}
+	db.Close()
+	if _, _, err := c.Get(ctx, 1); status.Code(err) != codes.Unavailable {
+		t.Errorf("Get from a closed database: %v, want Unavailable", err)
+	}
+}
@@ -0,0 +1,106 @@
+package kvrpc
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"google.golang.org/grpc"
+)
+
+// Client calls a KV service, such as one NewServer returns. Errors are
+// gRPC status errors. Safe for concurrent use.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient returns a client calling the KV service over conn, such as a
+// *grpc.ClientConn, which may be shared with other services.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// Put stores value under key, replacing any value already there.
+func (c *Client) Put(ctx context.Context, key uint64, value []byte) error {
+	return c.invoke(ctx, "Put", &keyValue{key: key, value: value}, &empty{})
+}
+
+// Get returns the value stored under key, and whether there is one.
+func (c *Client) Get(ctx context.Context, key uint64) ([]byte, bool, error) {
+	var resp getResponse
+	if err := c.invoke(ctx, "Get", &keyOnly{key: key}, &resp); err != nil {
+		return nil, false, err
+	}
+	return resp.value, resp.found, nil
+}
+
+// Delete removes key and its value, if there is one.
+func (c *Client) Delete(ctx context.Context, key uint64) error {
+	return c.invoke(ctx, "Delete", &keyOnly{key: key}, &empty{})
+}
+
+// Scan calls fn with each key from lo to hi inclusive and its value, in
+// key order, as the server streams them, until fn returns an error, which
+// Scan then returns. Writes made during a long scan may or may not be
+// seen.
+func (c *Client) Scan(ctx context.Context, lo, hi uint64, fn func(key uint64, value []byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/Scan", grpc.ForceCodec(codec{}))
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&scanRequest{lo: lo, hi: hi}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		var pair keyValue
+		if err := stream.RecvMsg(&pair); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(pair.key, pair.value); err != nil {
+			return err
+		}
+	}
+}
+
+// All calls fn with every key and its value, as Scan does.
+func (c *Client) All(ctx context.Context, fn func(key uint64, value []byte) error) error {
+	return c.Scan(ctx, 0, math.MaxUint64, fn)
+}
+
+// Batch collects writes for Client.Batch to apply together. The zero
+// value is an empty batch.
+type Batch struct {
+	writes []write
+}
+
+// Put adds storing value under key to the batch.
+func (b *Batch) Put(key uint64, value []byte) {
+	b.writes = append(b.writes, write{key: key, value: value})
+}
+
+// Delete adds removing key to the batch.
+func (b *Batch) Delete(key uint64) {
+	b.writes = append(b.writes, write{key: key, delete: true})
+}
+
+// Len returns the number of writes in the batch.
+func (b *Batch) Len() int {
+	return len(b.writes)
+}
+
+// Batch applies the writes of batch in order, as kv.DB.Write does: a crash
+// of the server leaves all of them or none.
+func (c *Client) Batch(ctx context.Context, batch *Batch) error {
+	return c.invoke(ctx, "Batch", &batchRequest{writes: batch.writes}, &empty{})
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp message) error {
+	return c.conn.Invoke(ctx, "/"+serviceName+"/"+method, req, resp, grpc.ForceCodec(codec{}))
+}
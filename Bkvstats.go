@@ -0,0 +1,41 @@
+package kv
+
+import (
+	"manager"
+	"sync/atomic"
+)
+
+// Stats describes a DB's activity since Open and its current size.
+type Stats struct {
+	Gets        uint64
+	Puts        uint64
+	Deletes     uint64
+	Scans       uint64 // cursor walks, Scan calls among them
+	Batches     uint64 // non-empty batches written
+	Checkpoints uint64 // syncs, by Open, Sync and Close
+	Buckets     int    // at every level
+	HeapPages   int
+	Buffer      manager.BufferStats
+}
+
+type dbStats struct {
+	gets, puts, deletes, scans, batches, checkpoints atomic.Uint64
+}
+
+// Stats returns the database's counters and those of its buffer pool.
+func (db *DB) Stats() Stats {
+	s := Stats{
+		Gets:        db.stats.gets.Load(),
+		Puts:        db.stats.puts.Load(),
+		Deletes:     db.stats.deletes.Load(),
+		Scans:       db.stats.scans.Load(),
+		Batches:     db.stats.batches.Load(),
+		Checkpoints: db.stats.checkpoints.Load(),
+		Buffer:      db.bm.Stats(),
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	s.Buckets = len(db.buckets)
+	s.HeapPages = db.heap.Pages()
+	return s
+}
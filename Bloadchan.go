@@ -0,0 +1,52 @@
+package loader
+
+import (
+	"btree"
+	"errors"
+	"io"
+	"manager"
+)
+
+// Entry is a key and value sent to LoadFromChannel.
+type Entry struct {
+	Key   uint64
+	Value uint64
+}
+
+var errChannelReread = errors.New("loader: a channel cannot be read twice")
+
+// LoadFromChannel builds a B+Tree from the entries received on ch, in any
+// order, until ch is closed, through the same sort as LoadReader, so that
+// an application generating entries, such as by transforming another
+// store, can feed them to the loader without writing a file first. A
+// channel can only be read once, so WithVerify(true) fails; a load
+// resumed with WithCheckpoint must be sent the same entries from the
+// start again, and skips those already in runs. The load stops receiving
+// when it fails or the WithContext context is done, so a producer should
+// also stop on a context cancelled once LoadFromChannel returns, or it
+// may block on a send for ever.
+func LoadFromChannel(bm *manager.BufferManager, ch <-chan Entry, opts ...Option) (*btree.BTree, error) {
+	o := applyOptions(opts)
+	var done <-chan struct{}
+	if o.ctx != nil {
+		done = o.ctx.Done()
+	}
+	opened := false
+	return load(bm, func() (func() (entry, error), func(), error) {
+		if opened {
+			return nil, nil, errChannelReread
+		}
+		opened = true
+		return func() (entry, error) {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return entry{}, io.EOF
+				}
+				return entry{key: e.Key, value: e.Value}, nil
+			case <-done:
+				return entry{}, o.ctx.Err()
+			}
+		}, func() {}, nil
+	}, o)
+}
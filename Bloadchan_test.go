@@ -0,0 +1,55 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"manager"
+	"testing"
+)
+
+func TestLoadFromChannel(t *testing.T) {
+	entries := randomEntries(50, 20000, 5000)
+	ch := make(chan Entry)
+	go func() {
+		for _, e := range entries {
+			ch <- Entry{e.key, e.value}
+		}
+		close(ch)
+	}()
+	bt, err := LoadFromChannel(manager.NewBufferManager(), ch,
+		WithMemoryLimit(3000*entrySize), WithTempDir(t.TempDir()), WithVerify(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+
+	// A channel cannot be read again to look the keys up
+	ch = make(chan Entry, 1)
+	ch <- Entry{1, 1}
+	close(ch)
+	if _, err := LoadFromChannel(manager.NewBufferManager(), ch, WithVerify(true)); !errors.Is(err, errChannelReread) {
+		t.Errorf("WithVerify(true) on a channel: %v, want errChannelReread", err)
+	}
+}
+
+func TestLoadFromChannelCancel(t *testing.T) {
+	// The producer never closes the channel; the context ends the load
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan Entry)
+	go func() {
+		for i := uint64(0); ; i++ {
+			select {
+			case ch <- Entry{i, i}:
+				if i == 1000 {
+					cancel()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	if _, err := LoadFromChannel(manager.NewBufferManager(), ch, WithContext(ctx)); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled load: %v, want context.Canceled", err)
+	}
+}
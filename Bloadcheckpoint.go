@@ -0,0 +1,292 @@
+package loader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"manager"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCheckpointInterval is how often a load with WithCheckpoint saves
+// its state while it builds the tree.
+const DefaultCheckpointInterval = time.Minute
+
+const checkpointMagic = 0x4c44434b // "LDCK"
+
+// The phases a checkpoint can be taken in
+const (
+	phaseSort  = 1 // spilling sorted runs
+	phaseBuild = 2 // merging the runs into the tree
+)
+
+// WithCheckpoint makes LoadDataFile, LoadReader and LoadCSV save their
+// state to path after every spilled run and, while building the tree,
+// every interval (DefaultCheckpointInterval if 0), so that a load that is
+// interrupted can resume: if path holds a checkpoint when a load starts,
+// the load skips the input already in runs, or the entries already in
+// the tree, and carries on from there. The file is removed when the load
+// succeeds. A resumed load must be given the same input and options, and
+// a buffer manager over the same tablespaces, set with WithTablespace,
+// since the default in-memory one does not survive the process; run
+// files are kept in WithTempDir, which must survive too. Pages written
+// after the last checkpoint are not reused.
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(o *options) {
+		o.checkpoint = path
+		o.checkpointEvery = interval
+		if interval <= 0 {
+			o.checkpointEvery = DefaultCheckpointInterval
+		}
+	}
+}
+
+// checkpoint is the saved state of a load.
+type checkpoint struct {
+	phase       byte
+	entriesRead uint64   // input entries in the runs
+	runs        []string // run files, in input order
+	consumed    uint64   // merged entries given to the loader
+	loader      loaderState
+}
+
+// loaderState is the state of a BulkLoader at a leaf boundary.
+type loaderState struct {
+	started   bool
+	leafID    manager.PageID
+	leafKeys  int
+	leafFirst uint64
+	last      uint64
+	pages     uint64
+	entries   uint64
+	levels    []levelState
+}
+
+type levelState struct {
+	id       manager.PageID
+	firstKey uint64
+	children int
+}
+
+func (cp *checkpoint) marshal() []byte {
+	b := binary.BigEndian.AppendUint32(nil, checkpointMagic)
+	b = append(b, cp.phase)
+	b = binary.BigEndian.AppendUint64(b, cp.entriesRead)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(cp.runs)))
+	for _, run := range cp.runs {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(run)))
+		b = append(b, run...)
+	}
+	b = binary.BigEndian.AppendUint64(b, cp.consumed)
+
+	s := &cp.loader
+	started := byte(0)
+	if s.started {
+		started = 1
+	}
+	b = append(b, started)
+	b = binary.BigEndian.AppendUint64(b, uint64(s.leafID))
+	b = binary.BigEndian.AppendUint32(b, uint32(s.leafKeys))
+	b = binary.BigEndian.AppendUint64(b, s.leafFirst)
+	b = binary.BigEndian.AppendUint64(b, s.last)
+	b = binary.BigEndian.AppendUint64(b, s.pages)
+	b = binary.BigEndian.AppendUint64(b, s.entries)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s.levels)))
+	for _, lv := range s.levels {
+		b = binary.BigEndian.AppendUint64(b, uint64(lv.id))
+		b = binary.BigEndian.AppendUint64(b, lv.firstKey)
+		b = binary.BigEndian.AppendUint32(b, uint32(lv.children))
+	}
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+var errCorruptCheckpoint = errors.New("loader: corrupt checkpoint")
+
+// checkpointReader decodes big-endian fields, keeping the first error.
+type checkpointReader struct {
+	b   []byte
+	err error
+}
+
+func (r *checkpointReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errCorruptCheckpoint
+		return make([]byte, n)
+	}
+	field := r.b[:n]
+	r.b = r.b[n:]
+	return field
+}
+
+func (r *checkpointReader) u8() byte    { return r.next(1)[0] }
+func (r *checkpointReader) u16() uint16 { return binary.BigEndian.Uint16(r.next(2)) }
+func (r *checkpointReader) u32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *checkpointReader) u64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+
+func unmarshalCheckpoint(b []byte) (*checkpoint, error) {
+	if len(b) < 8 || binary.BigEndian.Uint32(b[len(b)-4:]) != crc32.ChecksumIEEE(b[:len(b)-4]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errCorruptCheckpoint)
+	}
+	r := &checkpointReader{b: b[:len(b)-4]}
+	if r.u32() != checkpointMagic {
+		return nil, fmt.Errorf("%w: bad magic", errCorruptCheckpoint)
+	}
+	cp := &checkpoint{phase: r.u8(), entriesRead: r.u64()}
+	// The checksum has passed, so counts are sane unless the file was
+	// written by something else; next stops at the end either way
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		cp.runs = append(cp.runs, string(r.next(int(r.u16()))))
+	}
+	cp.consumed = r.u64()
+
+	s := &cp.loader
+	s.started = r.u8() == 1
+	s.leafID = manager.PageID(r.u64())
+	s.leafKeys = int(r.u32())
+	s.leafFirst = r.u64()
+	s.last = r.u64()
+	s.pages = r.u64()
+	s.entries = r.u64()
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		s.levels = append(s.levels, levelState{
+			id:       manager.PageID(r.u64()),
+			firstKey: r.u64(),
+			children: int(r.u32()),
+		})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if cp.phase != phaseSort && cp.phase != phaseBuild {
+		return nil, fmt.Errorf("%w: phase %d", errCorruptCheckpoint, cp.phase)
+	}
+	return cp, nil
+}
+
+// checkpointer saves a load's checkpoints.
+type checkpointer struct {
+	path  string
+	every time.Duration
+	last  time.Time
+	bm    *manager.BufferManager
+	state checkpoint
+}
+
+// startCheckpoints returns the checkpointer for a load with WithCheckpoint,
+// holding the checkpoint to resume from if there is one, or nil.
+func startCheckpoints(bm *manager.BufferManager, o options) (*checkpointer, error) {
+	if o.checkpoint == "" {
+		return nil, nil
+	}
+	c := &checkpointer{path: o.checkpoint, every: o.checkpointEvery, last: time.Now(), bm: bm}
+	b, err := os.ReadFile(o.checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		c.state.phase = phaseSort
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp, err := unmarshalCheckpoint(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", o.checkpoint, err)
+	}
+	c.state = *cp
+	return c, nil
+}
+
+// openRuns reopens the run files of the checkpoint.
+func (c *checkpointer) openRuns() ([]*os.File, error) {
+	var runs []*os.File
+	for _, name := range c.state.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			closeRuns(runs)
+			return nil, err
+		}
+		runs = append(runs, f)
+	}
+	return runs, nil
+}
+
+// sorted records that the runs hold the first entriesRead entries of the
+// input and, if done, that the input is all in them.
+func (c *checkpointer) sorted(entriesRead uint64, runs []*os.File, done bool) error {
+	// Only the newest run can be unsynced
+	if len(runs) > len(c.state.runs) {
+		if err := runs[len(runs)-1].Sync(); err != nil {
+			return err
+		}
+	}
+	c.state.entriesRead = entriesRead
+	c.state.runs = c.state.runs[:0]
+	for _, f := range runs {
+		name, err := filepath.Abs(f.Name())
+		if err != nil {
+			return err
+		}
+		c.state.runs = append(c.state.runs, name)
+	}
+	if done {
+		c.state.phase = phaseBuild
+	}
+	return c.save()
+}
+
+// due reports whether a build checkpoint is due.
+func (c *checkpointer) due() bool {
+	return time.Since(c.last) >= c.every
+}
+
+// built records that the first consumed merged entries are in the tree l
+// is building, once its pages are durable.
+func (c *checkpointer) built(consumed uint64, l *BulkLoader) error {
+	if err := l.markDirty(); err != nil {
+		return err
+	}
+	if err := c.bm.Sync(); err != nil {
+		return err
+	}
+	c.state.consumed = consumed
+	c.state.loader = l.state()
+	return c.save()
+}
+
+// save writes the checkpoint to a temporary file and renames it over the
+// last one, so that a crash leaves one or the other whole.
+func (c *checkpointer) save() error {
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(c.state.marshal())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, c.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	c.last = time.Now()
+	return nil
+}
+
+// finish removes the run files and the checkpoint of a completed load.
+func (c *checkpointer) finish() error {
+	var errs []error
+	for _, name := range c.state.runs {
+		errs = append(errs, os.Remove(name))
+	}
+	errs = append(errs, os.Remove(c.path))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"manager"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tablespace returns a buffer manager over the tablespace file at path,
+// created if need be, and its FileID. The manager is never closed: a
+// load interrupted in it stands for a process that died.
+func tablespace(t *testing.T, path string) (*manager.BufferManager, manager.FileID) {
+	t.Helper()
+	bm := manager.NewBufferManager()
+	id, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bm, id
+}
+
+// interruptAndResume loads entries with a checkpoint, cancelling the
+// load when stop says so, then loads them again in a fresh buffer
+// manager over the same files and checks the resumed tree.
+func interruptAndResume(t *testing.T, entries []entry, stop func(Progress) bool, opts ...Option) {
+	t.Helper()
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, "runs")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	space, ckpt := filepath.Join(dir, "tree"), filepath.Join(dir, "ckpt")
+	opts = append(opts, WithTempDir(tmp), WithCheckpoint(ckpt, time.Nanosecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stopped Progress
+	bm, id := tablespace(t, space)
+	_, err := LoadReader(bm, newBytesReader(entries), append(opts, WithTablespace(id), WithContext(ctx),
+		WithProgress(func(p Progress) {
+			if !p.Done && stop(p) {
+				stopped = p
+				cancel()
+			}
+		}))...)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted load: %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(ckpt); err != nil {
+		t.Fatalf("no checkpoint after the load stopped at %+v: %v", stopped, err)
+	}
+
+	var report LoadReport
+	bm, id = tablespace(t, space)
+	bt, err := LoadReader(bm, newBytesReader(entries), append(opts, WithTablespace(id), WithReport(&report), WithVerify(true))...)
+	if err != nil {
+		t.Fatalf("load resumed after %+v: %v", stopped, err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+	if report.EntriesRead != uint64(len(entries)) {
+		t.Errorf("resumed load read %d entries, want %d", report.EntriesRead, len(entries))
+	}
+	if _, err := os.Stat(ckpt); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint left after the load: %v", err)
+	}
+	if names := tempFiles(t, tmp); len(names) != 0 {
+		t.Errorf("run files left after the load: %v", names)
+	}
+}
+
+func TestResumeWhileSorting(t *testing.T) {
+	entries := randomEntries(50, 10000, 1<<40)
+	interruptAndResume(t, entries, func(p Progress) bool { return p.RunsWritten == 3 },
+		WithMemoryLimit(1000*entrySize))
+}
+
+func TestResumeWhileBuilding(t *testing.T) {
+	entries := randomEntries(51, 3*progressInterval, 1<<40)
+	interruptAndResume(t, entries, func(p Progress) bool { return p.PagesWritten > 100 },
+		WithMemoryLimit(progressInterval*entrySize))
+}
+
+func TestResumeWhileMerging(t *testing.T) {
+	// 150 runs merged two at a time; stopped partway through the passes,
+	// once merged runs have replaced their inputs in the checkpoint
+	entries := randomEntries(52, 3000, 1<<40)
+	interruptAndResume(t, entries, func(p Progress) bool { return p.RunsMerged > 100 },
+		WithMemoryLimit(20*entrySize))
+}
+
+func TestResumeOneRun(t *testing.T) {
+	// With a checkpoint even input that fits in memory is spilled
+	entries := randomEntries(53, 2*progressInterval, 1<<40)
+	interruptAndResume(t, entries, func(p Progress) bool { return p.PagesWritten > 50 })
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	cp := &checkpoint{
+		phase:       phaseBuild,
+		entriesRead: 1 << 40,
+		runs:        []string{"/tmp/a", "/tmp/bb"},
+		consumed:    12345,
+		loader: loaderState{
+			started: true, leafID: manager.MakePageID(3, 9), leafKeys: 17, leafFirst: 5, last: 99,
+			pages: 40, entries: 1000,
+			levels: []levelState{{manager.MakePageID(3, 10), 5, 2}, {manager.MakePageID(3, 11), 0, 7}},
+		},
+	}
+	got, err := unmarshalCheckpoint(cp.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.phase != cp.phase || got.entriesRead != cp.entriesRead || got.consumed != cp.consumed ||
+		len(got.runs) != 2 || got.runs[1] != "/tmp/bb" || got.loader.leafID != cp.loader.leafID ||
+		got.loader.leafKeys != 17 || len(got.loader.levels) != 2 || got.loader.levels[1] != cp.loader.levels[1] {
+		t.Errorf("checkpoint round trip = %+v, want %+v", got, cp)
+	}
+
+	b := cp.marshal()
+	for _, bad := range [][]byte{nil, b[:len(b)-1], append([]byte{1}, b[1:]...)} {
+		if _, err := unmarshalCheckpoint(bad); !errors.Is(err, errCorruptCheckpoint) {
+			t.Errorf("unmarshal of %d damaged bytes: %v, want errCorruptCheckpoint", len(bad), err)
+		}
+	}
+
+	// A load refuses a corrupt checkpoint rather than starting over
+	path := filepath.Join(t.TempDir(), "ckpt")
+	if err := os.WriteFile(path, b[:len(b)-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadReader(manager.NewBufferManager(), newBytesReader(sequential(10, 1)), WithCheckpoint(path, 0))
+	if !errors.Is(err, errCorruptCheckpoint) {
+		t.Errorf("load with a corrupt checkpoint: %v, want errCorruptCheckpoint", err)
+	}
+}
@@ -0,0 +1,122 @@
+package loader
+
+import (
+	"btree"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"manager"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WithDelimiter sets the field delimiter for LoadCSV, such as '\t' for
+// TSV. The default is a comma.
+func WithDelimiter(r rune) Option {
+	return func(o *options) {
+		o.delimiter = r
+	}
+}
+
+// WithHeader makes LoadCSV skip the first line.
+func WithHeader() Option {
+	return func(o *options) {
+		o.header = true
+	}
+}
+
+// WithBase sets the base LoadCSV parses keys and values in. The default, 0,
+// reads a 0x prefix as hexadecimal, 0o and 0b likewise, and anything else
+// as decimal; 16 reads hexadecimal with or without the prefix.
+func WithBase(base int) Option {
+	return func(o *options) {
+		o.base = base
+	}
+}
+
+// LoadCSV builds a B+Tree from the delimited text file at path, taking
+// each record's key from column keyCol and its value from column
+// valueCol, counting from 0. Records may come in any order; they are
+// sorted as by LoadReader, and the file may be compressed likewise.
+// Fields may be quoted as in RFC 4180 and surrounding spaces are ignored.
+// A field that is missing or not a uint64 fails the load with its line
+// number.
+func LoadCSV(bm *manager.BufferManager, path string, keyCol, valueCol int, opts ...Option) (*btree.BTree, error) {
+	o := applyOptions(opts)
+	if keyCol < 0 || valueCol < 0 {
+		return nil, errors.New("loader: negative column index")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return load(bm, rewindable(file, func(f io.Reader) (func() (entry, error), func(), error) {
+		return readCSV(f, path, keyCol, valueCol, o)
+	}), o)
+}
+
+// readCSV returns a function reading the entries of the CSV input f,
+// named path in errors, and one releasing its decompressor.
+func readCSV(f io.Reader, path string, keyCol, valueCol int, o options) (func() (entry, error), func(), error) {
+	dr, release, err := decompress(f, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := csv.NewReader(dr)
+	r.Comma = o.delimiter
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	if o.delimiter == '\t' {
+		// TSV has no quoting; take quotes inside fields literally
+		r.LazyQuotes = true
+	}
+	if o.header {
+		if _, err := r.Read(); err != nil && err != io.EOF {
+			release()
+			return nil, nil, fmt.Errorf("loader: %s: %w", path, err)
+		}
+	}
+
+	read := func() (entry, error) {
+		record, err := r.Read()
+		if err == io.EOF {
+			return entry{}, err
+		}
+		if err != nil {
+			return entry{}, fmt.Errorf("loader: %s: %w", path, err)
+		}
+		key, err := parseField(r, record, keyCol, o.base)
+		if err != nil {
+			return entry{}, fmt.Errorf("loader: %s: %w", path, err)
+		}
+		value, err := parseField(r, record, valueCol, o.base)
+		if err != nil {
+			return entry{}, fmt.Errorf("loader: %s: %w", path, err)
+		}
+		return entry{key, value}, nil
+	}
+	return read, release, nil
+}
+
+// parseField parses column col of the record r last read.
+func parseField(r *csv.Reader, record []string, col, base int) (uint64, error) {
+	if col >= len(record) {
+		line, _ := r.FieldPos(0)
+		return 0, fmt.Errorf("line %d: no column %d", line, col)
+	}
+	field := strings.TrimSpace(record[col])
+	if base == 16 {
+		field = strings.TrimPrefix(strings.TrimPrefix(field, "0x"), "0X")
+	}
+	n, err := strconv.ParseUint(field, base, 64)
+	if err != nil {
+		line, column := r.FieldPos(col)
+		return 0, fmt.Errorf("line %d, column %d: %w", line, column, err)
+	}
+	return n, nil
+}
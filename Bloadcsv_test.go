@@ -0,0 +1,95 @@
+package loader
+
+import (
+	"fmt"
+	"manager"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func csvFile(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCSV(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		text       string
+		key, value int
+		opts       []Option
+		want       []entry
+	}{
+		{"plain", "3,30\n1,10\n2,20\n", 0, 1, nil,
+			[]entry{{1, 10}, {2, 20}, {3, 30}}},
+		{"header and other columns", "name,value,id\nb, 20 ,2\na,10,1\n", 2, 1, []Option{WithHeader()},
+			[]entry{{1, 10}, {2, 20}}},
+		{"quoted", "\"7\",\"70\"\n\" 8 \",80\n", 0, 1, nil,
+			[]entry{{7, 70}, {8, 80}}},
+		{"tsv", "1\tx\"y\t10\n2\ty\t20\n", 0, 2, []Option{WithDelimiter('\t')},
+			[]entry{{1, 10}, {2, 20}}},
+		{"prefixed bases", "0x10,0o17\n0b11,9\n", 0, 1, nil,
+			[]entry{{3, 9}, {16, 15}}},
+		{"hexadecimal", "ff,0x10\nFF0,a\n", 0, 1, []Option{WithBase(16)},
+			[]entry{{0xff, 0x10}, {0xff0, 0xa}}},
+		{"ragged rows", "1,10,extra\n2,20\n", 0, 1, nil,
+			[]entry{{1, 10}, {2, 20}}},
+		{"duplicates", "1,10\n1,11\n", 0, 1, []Option{WithDuplicates(KeepFirst)},
+			[]entry{{1, 10}}},
+		{"empty", "", 0, 1, []Option{WithHeader()}, nil},
+	} {
+		bt, err := LoadCSV(manager.NewBufferManager(), csvFile(t, tc.text), tc.key, tc.value, tc.opts...)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		checkTree(t, bt, tc.want)
+	}
+}
+
+func TestLoadCSVSpilled(t *testing.T) {
+	entries := randomEntries(30, 5000, 2000)
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "x,%d,%d\n", e.key, e.value)
+	}
+	path := filepath.Join(t.TempDir(), "data.csv.gz")
+	if err := os.WriteFile(path, gzipped(t, []byte(b.String())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bt, err := LoadCSV(manager.NewBufferManager(), path, 1, 2,
+		WithMemoryLimit(700*entrySize), WithTempDir(t.TempDir()), WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+}
+
+func TestLoadCSVErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		text       string
+		key, value int
+		opts       []Option
+		want       string
+	}{
+		{"missing column", "1,10\n2\n", 0, 1, nil, "line 2: no column 1"},
+		{"not a number", "1,10\n2,twenty\n", 0, 1, nil, "line 2, column 3"},
+		{"negative", "-1,10\n", 0, 1, nil, "line 1, column 1"},
+		{"too large", "18446744073709551616,1\n", 0, 1, nil, "value out of range"},
+		{"hex without base", "ff,1\n", 0, 1, nil, "invalid syntax"},
+		{"bad quoting", "\"1,10\n", 0, 1, nil, "extraneous or missing"},
+		{"negative column", "1,10\n", -1, 1, nil, "negative column"},
+	} {
+		_, err := LoadCSV(manager.NewBufferManager(), csvFile(t, tc.text), tc.key, tc.value, tc.opts...)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want an error with %q", tc.name, err, tc.want)
+		}
+	}
+}
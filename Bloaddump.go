@@ -0,0 +1,67 @@
+package loader
+
+import (
+	"btree"
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// Dump writes every entry of bt to w in key order, as a data file with a
+// header that LoadReader reads, so that a tree can be saved and loaded
+// again, or rebuilt with full leaves after many inserts have left them
+// half empty. If w can seek, the header is written once the entries are;
+// otherwise, as for a pipe, the tree is read twice, first to count and
+// checksum the entries for the header.
+func Dump(bt *btree.BTree, w io.Writer) error {
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if dw, err := NewDataWriter(ws); err == nil {
+			if err := eachEntry(bt, dw.Write); err != nil {
+				return err
+			}
+			return dw.Close()
+		}
+	}
+
+	h := DataHeader{KeyWidth: keySize, ValueWidth: valueSize}
+	var buf [entrySize]byte
+	err := eachEntry(bt, func(key, value uint64) error {
+		putEntry(&buf, key, value)
+		h.Count++
+		h.Checksum = crc32.Update(h.Checksum, crc32.IEEETable, buf[:])
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(w, ioBufferSize)
+	if _, err := bw.Write(h.Bytes()); err != nil {
+		return err
+	}
+	err = eachEntry(bt, func(key, value uint64) error {
+		putEntry(&buf, key, value)
+		_, err := bw.Write(buf[:])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// eachEntry calls fn for every entry of bt in key order.
+func eachEntry(bt *btree.BTree, fn func(key, value uint64) error) error {
+	c := bt.Cursor()
+	for key, value := range c.All() {
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return c.Err()
+}
+
+func putEntry(buf *[entrySize]byte, key, value uint64) {
+	binary.BigEndian.PutUint64(buf[:keySize], key)
+	binary.BigEndian.PutUint64(buf[keySize:], value)
+}
@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"bytes"
+	"manager"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDumpAndRestore(t *testing.T) {
+	entries := sequential(30000, 7)
+	bt := bulkLoad(t, entries, WithFillFactor(0.5))
+	// Deletes leave holes that a dump and reload pack away
+	for _, e := range entries[:10000] {
+		if _, err := bt.Delete(e.key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries = entries[10000:]
+
+	path := filepath.Join(t.TempDir(), "dump")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump(bt, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Through a writer that cannot seek, the header is the same
+	var piped bytes.Buffer
+	if err := Dump(bt, &piped); err != nil {
+		t.Fatal(err)
+	}
+	seeked, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(seeked, piped.Bytes()) {
+		t.Fatalf("dumps to a file and a pipe differ: %d and %d bytes", len(seeked), piped.Len())
+	}
+	h, err := readDataHeader(bytes.NewReader(seeked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Count != uint64(len(entries)) || h.KeyWidth != 8 || h.ValueWidth != 8 || h.LittleEndian {
+		t.Errorf("dump header %+v", h)
+	}
+
+	restored, err := LoadDataFile(manager.NewBufferManager(), path, WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, restored, entries)
+	report, err := Verify(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.EmptyLeaves != 0 {
+		t.Errorf("restored tree has %d empty leaves", report.EmptyLeaves)
+	}
+}
@@ -0,0 +1,45 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDuplicateKey is returned when a load with the Error policy meets a
+// key twice.
+var ErrDuplicateKey = errors.New("loader: duplicate key")
+
+// DuplicatePolicy decides the value stored for a key that a load meets
+// more than once. It is called with the value kept so far and the next
+// one, in input order, and returns the value to keep or an error that
+// fails the load.
+type DuplicatePolicy func(key, kept, next uint64) (uint64, error)
+
+var (
+	// KeepFirst keeps the first value given for a key.
+	KeepFirst DuplicatePolicy = func(_, kept, _ uint64) (uint64, error) { return kept, nil }
+	// KeepLast keeps the last value given for a key, as inserting the
+	// entries one by one would. It is the default.
+	KeepLast DuplicatePolicy = func(_, _, next uint64) (uint64, error) { return next, nil }
+	// Error fails the load with ErrDuplicateKey.
+	Error DuplicatePolicy = func(key, _, _ uint64) (uint64, error) {
+		return 0, fmt.Errorf("%w: %d", ErrDuplicateKey, key)
+	}
+)
+
+// Merge combines the values given for a key with fn, left to right.
+func Merge(fn func(kept, next uint64) uint64) DuplicatePolicy {
+	return func(_, kept, next uint64) (uint64, error) {
+		return fn(kept, next), nil
+	}
+}
+
+// WithDuplicates sets the policy for keys that occur more than once. The
+// sort is stable, so the policy sees the values in input order.
+func WithDuplicates(p DuplicatePolicy) Option {
+	return func(o *options) {
+		if p != nil {
+			o.duplicates = p
+		}
+	}
+}
@@ -2,164 +2,310 @@ package loader
 
 import (
 	"btree"
-	"encoding/binary"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"manager"
 	"os"
-	"sort"
+	"splitordered"
+	"time"
 )
 
 const (
 	keySize   = 8
 	valueSize = 8
+	entrySize = keySize + valueSize
+
+	// DefaultMemoryLimit is how many bytes of entries are sorted in memory
+	// at a time before they are spilled to a run file.
+	DefaultMemoryLimit = 64 << 20
+
+	ioBufferSize = 256 << 10
 )
 
+var errTruncated = errors.New("loader: data file ends in a partial entry")
+
 type entry struct {
 	key   uint64
 	value uint64
 }
 
-func LoadDataFile(bm *manager.BufferManager, dataFile string) (*btree.BTree, error) {
-	// Read and sort all entries first
-	entries, err := readAndSortEntries(dataFile)
-	if err != nil {
-		return nil, err
-	}
+// Option configures LoadDataFile, LoadCSV and NewBulkLoader.
+type Option func(*options)
 
-	// Create B+Tree with bulk loading
-	return createBulkLoadedTree(bm, entries)
+type options struct {
+	memoryLimit int
+	tempDir     string
+	progress    func(Progress)
+	report      *LoadReport
+	ctx         context.Context
+	duplicates  DuplicatePolicy
+	fillFactor  float64
+	fileID      manager.FileID
+
+	checkpoint      string
+	checkpointEvery time.Duration
+	verify          bool
+	checkSource     bool
+
+	decompressors []decompressor
+	hashOptions   []splitordered.Option
+
+	// LoadCSV only
+	delimiter rune
+	header    bool
+	base      int
 }
 
-func readAndSortEntries(dataFile string) ([]entry, error) {
-	file, err := os.Open(dataFile)
-	if err != nil {
-		return nil, err
+func applyOptions(opts []Option) options {
+	o := options{memoryLimit: DefaultMemoryLimit, delimiter: ',', duplicates: KeepLast, fillFactor: 1}
+	for _, opt := range opts {
+		opt(&o)
 	}
-	defer file.Close()
-
-	var entries []entry
+	return o
+}
 
-	for {
-		var key, value uint64
-		err := binary.Read(file, binary.BigEndian, &key)
-		if err != nil {
-			break
-		}
-		err = binary.Read(file, binary.BigEndian, &value)
-		if err != nil {
-			break
+// WithMemoryLimit sets how many bytes of entries are sorted in memory at a
+// time. Inputs larger than this are sorted in runs that are spilled to
+// temporary files and merged, up to 64 at a time, in as many passes as
+// it takes; the read buffers of a merge come out of the same budget. The
+// default is DefaultMemoryLimit.
+func WithMemoryLimit(bytes int) Option {
+	return func(o *options) {
+		if bytes > 0 {
+			o.memoryLimit = bytes
 		}
+	}
+}
 
-		entries = append(entries, entry{key, value})
+// WithFillFactor sets how full loads pack leaves and internal nodes, from
+// just above 0 to 1, the default. Pages packed full split on the first
+// insert into them afterwards, so a tree that will take writes loads
+// better at 0.9 or so. Every page still holds at least one entry, or two
+// children.
+func WithFillFactor(f float64) Option {
+	return func(o *options) {
+		if f > 0 {
+			o.fillFactor = min(f, 1)
+		}
 	}
+}
 
-	// Sort entries by key
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].key < entries[j].key
-	})
+// WithTablespace makes loads allocate the tree's pages in the tablespace
+// fileID instead of the buffer manager's in-memory default.
+func WithTablespace(fileID manager.FileID) Option {
+	return func(o *options) {
+		o.fileID = fileID
+	}
+}
 
-	return entries, nil
+// WithTempDir sets the directory for spilled runs. The default is
+// os.TempDir.
+func WithTempDir(dir string) Option {
+	return func(o *options) {
+		o.tempDir = dir
+	}
 }
 
-func createBulkLoadedTree(bm *manager.BufferManager, entries []entry) (*btree.BTree, error) {
-	// Create leaf nodes
-	leaves, err := createLeafNodes(bm, entries)
+// LoadDataFile builds a B+Tree from dataFile, as LoadReader does.
+func LoadDataFile(bm *manager.BufferManager, dataFile string, opts ...Option) (*btree.BTree, error) {
+	file, err := os.Open(dataFile)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
+	return LoadReader(bm, file, opts...)
+}
 
-	// Build internal nodes from leaves
-	rootID := buildTreeFromLeaves(bm, leaves)
+// LoadReader builds a B+Tree from r, a data file of key/value pairs in any
+// order, with a header (see DataHeader) or as legacy big-endian uint64
+// pairs, possibly gzip-compressed, by sorting them and feeding them to a
+// BulkLoader. If the input does not fit the memory limit it is sorted in
+// runs that are spilled to temporary files and merged straight into the
+// leaves, so inputs far larger than memory can be loaded, from a pipe or
+// the network as well as a file.
+func LoadReader(bm *manager.BufferManager, r io.Reader, opts ...Option) (*btree.BTree, error) {
+	o := applyOptions(opts)
+	return load(bm, rewindable(r, readBinary(o)), o)
+}
 
-	return &btree.BTree{
-		bm:         bm,
-		rootPageID: rootID,
-	}, nil
+// readBinary returns the decoder of data files for rewindable.
+func readBinary(o options) func(io.Reader) (func() (entry, error), func(), error) {
+	return func(r io.Reader) (func() (entry, error), func(), error) {
+		return readData(r, o)
+	}
 }
 
-func createLeafNodes(bm *manager.BufferManager, entries []entry) ([]manager.PageID, error) {
-	var leaves []manager.PageID
-	var currentLeaf *[manager.PageSize]byte
-	var currentLeafID manager.PageID
-	entriesPerLeaf := (manager.PageSize - btree.leafHeaderSize) / (keySize + valueSize)
-
-	for i, e := range entries {
-		if i%entriesPerLeaf == 0 {
-			// Create new leaf node
-			if currentLeaf != nil {
-				// Finalize previous leaf
-				binary.BigEndian.PutUint64(currentLeaf[8:16], uint64(entriesPerLeaf))
-			}
+// source opens the input of a load from its start, as a function that
+// reads one entry at a time up to io.EOF and one that releases the input.
+type source func() (read func() (entry, error), release func(), err error)
 
-			var err error
-			currentLeafID, currentLeaf, err = bm.NewPage()
-			if err != nil {
-				return nil, err
-			}
-			leaves = append(leaves, currentLeafID)
-			btree.InitializeLeafPage(currentLeaf)
-		}
+var errNotRewindable = errors.New("loader: input cannot be read twice, it is not an io.Seeker")
 
-		// Calculate offset for this entry
-		offset := btree.leafHeaderSize + (i%entriesPerLeaf)*(keySize+valueSize)
-		binary.BigEndian.PutUint64(currentLeaf[offset:], e.key)
-		binary.BigEndian.PutUint64(currentLeaf[offset+keySize:], e.value)
+// rewindable returns the source that reads r through decode, seeking r
+// back to where it started before every open but the first.
+func rewindable(r io.Reader, decode func(io.Reader) (func() (entry, error), func(), error)) source {
+	start := int64(-1)
+	if s, ok := r.(io.Seeker); ok {
+		if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+			start = off
+		}
 	}
-
-	// Finalize last leaf
-	if currentLeaf != nil {
-		finalCount := uint64(len(entries) % entriesPerLeaf)
-		if finalCount == 0 {
-			finalCount = uint64(entriesPerLeaf)
+	opened := false
+	return func() (func() (entry, error), func(), error) {
+		if opened {
+			if start < 0 {
+				return nil, nil, errNotRewindable
+			}
+			if _, err := r.(io.Seeker).Seek(start, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
 		}
-		binary.BigEndian.PutUint64(currentLeaf[8:16], finalCount)
+		opened = true
+		return decode(r)
 	}
-
-	return leaves, nil
 }
 
-func buildTreeFromLeaves(bm *manager.BufferManager, leaves []manager.PageID) manager.PageID {
-	if len(leaves) == 1 {
-		return leaves[0]
+// load sorts the entries of open, builds a tree of them and verifies it
+// if asked to.
+func load(bm *manager.BufferManager, open source, o options) (*btree.BTree, error) {
+	t := newTracker(o)
+	defer t.fill(o.report)
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	cp, err := startCheckpoints(bm, o)
+	if err != nil {
+		return nil, err
 	}
 
-	var parents []manager.PageID
-	pointersPerNode := (manager.PageSize - btree.internalHeaderSize) / (keySize + btree.ptrSize)
-
-	for i := 0; i < len(leaves); i += pointersPerNode {
-		end := i + pointersPerNode
-		if end > len(leaves) {
-			end = len(leaves)
+	start := time.Now()
+	var src entrySource
+	if cp != nil && cp.state.phase == phaseBuild {
+		// The input is all in runs already
+		t.p.EntriesRead, t.p.RunsWritten = cp.state.entriesRead, len(cp.state.runs)
+		runs, err := cp.openRuns()
+		if err != nil {
+			return nil, err
 		}
-
-		// Create new internal node
-		pageID, data, err := bm.NewPage()
+		if err := t.spilledRuns(runs); err != nil {
+			closeRuns(runs)
+			return nil, err
+		}
+		_, bufSize := mergeShape(o.memoryLimit)
+		if src, err = newMergeSource(runs, true, bufSize); err != nil {
+			return nil, err
+		}
+	} else {
+		src, err = sortInput(open, o, t, cp)
+		t.stats.SortTime = time.Since(start)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		btree.InitializeInternalPage(data)
+	}
+	defer src.Close()
 
-		// First pointer
-		copy(data[btree.internalHeaderSize:], manager.Sizzle(leaves[i]))
+	start = time.Now()
+	bt, entries, err := buildTree(bm, src, o, t, cp)
+	t.stats.BuildTime = time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil {
+		if err := cp.finish(); err != nil {
+			return nil, err
+		}
+	}
+	if !o.verify {
+		return bt, nil
+	}
+	start = time.Now()
+	err = verifyLoad(bt, entries, open, o)
+	t.stats.VerifyTime = time.Since(start)
+	return bt, err
+}
 
-		// Add keys and subsequent pointers
-		numKeys := 0
-		for j := i + 1; j < end; j++ {
-			// Get first key from child node
-			childData, _ := bm.PinPage(leaves[j])
-			firstKey := binary.BigEndian.Uint64((*childData)[btree.leafHeaderSize:])
-			bm.UnpinPage(leaves[j], false)
+// sortInput sorts the entries of open, skipping those a checkpoint has in
+// runs already.
+func sortInput(open source, o options, t *tracker, cp *checkpointer) (entrySource, error) {
+	read, release, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-			offset := btree.internalHeaderSize + numKeys*(btree.ptrSize+keySize) + btree.ptrSize
-			binary.BigEndian.PutUint64(data[offset:], firstKey)
+	if cp != nil {
+		for t.p.EntriesRead < cp.state.entriesRead {
+			if _, err := read(); err != nil {
+				if err == io.EOF {
+					err = fmt.Errorf("loader: input ends before the %d entries of the checkpoint", cp.state.entriesRead)
+				}
+				return nil, err
+			}
+			t.p.EntriesRead++
+		}
+	}
+	counted := func() (entry, error) {
+		e, err := read()
+		if err == nil {
+			err = t.entry(true)
+		}
+		return e, err
+	}
+	return sortEntries(counted, o, t, cp)
+}
 
-			offset += keySize
-			copy(data[offset:], manager.Sizzle(leaves[j]))
-			numKeys++
+// buildTree builds a tree of the entries of src and returns it with the
+// number of entries it holds. With cp it resumes from the checkpoint's
+// build state, if any, and saves its own at leaf boundaries when due.
+func buildTree(bm *manager.BufferManager, src entrySource, o options, t *tracker, cp *checkpointer) (*btree.BTree, uint64, error) {
+	l := newBulkLoader(bm, o)
+	var consumed uint64
+	if cp != nil && cp.state.consumed > 0 {
+		for ; consumed < cp.state.consumed; consumed++ {
+			if _, err := src.next(); err != nil {
+				return nil, 0, fmt.Errorf("loader: runs end before the %d entries of the checkpoint: %w", cp.state.consumed, err)
+			}
+		}
+		var err error
+		if l, err = resumeBulkLoader(bm, o, cp.state.loader); err != nil {
+			return nil, 0, err
 		}
+	}
 
-		binary.BigEndian.PutUint64(data[8:16], uint64(numKeys))
-		parents = append(parents, pageID)
+	for {
+		e, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && cp != nil && l.atLeafEnd(e.key) && cp.due() {
+			err = cp.built(consumed, l)
+		}
+		if err == nil {
+			err = l.Add(e.key, e.value)
+			consumed++
+		}
+		if err == nil {
+			t.p.RunsMerged, t.p.PagesWritten = src.merged(), l.pages
+			err = t.entry(false)
+		}
+		if err != nil {
+			l.fail(err)
+			_, err := l.Close()
+			t.builtBy(l)
+			return nil, 0, err
+		}
 	}
 
-	return buildTreeFromLeaves(bm, parents)
+	bt, err := l.Close()
+	t.builtBy(l)
+	if err != nil {
+		return nil, 0, err
+	}
+	t.p.RunsMerged, t.p.PagesWritten, t.p.Done = src.merged(), l.pages, true
+	if t.fn != nil {
+		t.fn(t.p)
+	}
+	return bt, l.entries, nil
 }
@@ -0,0 +1,216 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A data file may start with a header describing its entries:
+//
+//	magic(8) version(2) order(1) keyWidth(1) valueWidth(1) reserved(3)
+//	count(8) checksum(4) headerChecksum(4)
+//
+// all big-endian whatever the order of the entries. checksum is the
+// CRC-32 (IEEE) of the entry bytes after the header, headerChecksum that
+// of the header bytes before it. A file that does not start with the
+// magic is read as legacy big-endian pairs of 8-byte keys and values; a
+// legacy file whose first key and value happen to start with the magic
+// bytes cannot be told apart.
+const (
+	dataHeaderSize    = 32
+	dataFormatVersion = 1
+)
+
+var dataMagic = []byte("\x89LDDATA\n")
+
+// ErrDataFile is returned for a data file whose header is malformed or
+// does not match its entries.
+var ErrDataFile = errors.New("loader: bad data file")
+
+// DataHeader describes the entries of a data file.
+type DataHeader struct {
+	LittleEndian bool
+	KeyWidth     int // bytes per key: 1, 2, 4 or 8
+	ValueWidth   int // bytes per value: 1, 2, 4 or 8
+	Count        uint64
+	Checksum     uint32 // CRC-32 (IEEE) of the entry bytes
+}
+
+// Bytes returns the header as it starts a data file, for producers
+// writing entries of other widths or byte order than DataWriter does.
+func (h DataHeader) Bytes() []byte {
+	b := append(make([]byte, 0, dataHeaderSize), dataMagic...)
+	b = binary.BigEndian.AppendUint16(b, dataFormatVersion)
+	order := byte(0)
+	if h.LittleEndian {
+		order = 1
+	}
+	b = append(b, order, byte(h.KeyWidth), byte(h.ValueWidth), 0, 0, 0)
+	b = binary.BigEndian.AppendUint64(b, h.Count)
+	b = binary.BigEndian.AppendUint32(b, h.Checksum)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+func validWidth(w int) bool {
+	return w == 1 || w == 2 || w == 4 || w == 8
+}
+
+// readDataHeader reads and checks the header r starts with.
+func readDataHeader(r io.Reader) (DataHeader, error) {
+	var b [dataHeaderSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return DataHeader{}, fmt.Errorf("%w: header cut short", ErrDataFile)
+	}
+	if binary.BigEndian.Uint32(b[28:]) != crc32.ChecksumIEEE(b[:28]) {
+		return DataHeader{}, fmt.Errorf("%w: header checksum mismatch", ErrDataFile)
+	}
+	if v := binary.BigEndian.Uint16(b[8:]); v != dataFormatVersion {
+		return DataHeader{}, fmt.Errorf("%w: version %d, only %d is known", ErrDataFile, v, dataFormatVersion)
+	}
+	h := DataHeader{
+		LittleEndian: b[10] == 1,
+		KeyWidth:     int(b[11]),
+		ValueWidth:   int(b[12]),
+		Count:        binary.BigEndian.Uint64(b[16:]),
+		Checksum:     binary.BigEndian.Uint32(b[24:]),
+	}
+	if b[10] > 1 {
+		return DataHeader{}, fmt.Errorf("%w: unknown byte order %d", ErrDataFile, b[10])
+	}
+	if !validWidth(h.KeyWidth) || !validWidth(h.ValueWidth) {
+		return DataHeader{}, fmt.Errorf("%w: key and value widths %d and %d", ErrDataFile, h.KeyWidth, h.ValueWidth)
+	}
+	return h, nil
+}
+
+// readData returns a function reading the entries of the data file r,
+// decompressed, and one releasing its decompressor. Entries are decoded
+// as the header says if there is one, and the read after the last checks
+// them against its count and checksum before returning io.EOF.
+func readData(r io.Reader, o options) (func() (entry, error), func(), error) {
+	br, release, err := decompress(r, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	if head, _ := br.Peek(len(dataMagic)); !bytes.Equal(head, dataMagic) {
+		var buf [entrySize]byte
+		return func() (entry, error) { return readEntry(br, &buf) }, release, nil
+	}
+	h, err := readDataHeader(br)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	d := &dataReader{r: br, h: h}
+	return d.read, release, nil
+}
+
+// dataReader reads the entries of a data file with a header.
+type dataReader struct {
+	r   io.Reader
+	h   DataHeader
+	n   uint64 // entries read
+	crc uint32
+	buf [entrySize]byte
+}
+
+func (d *dataReader) read() (entry, error) {
+	b := d.buf[:d.h.KeyWidth+d.h.ValueWidth]
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		switch {
+		case err == io.ErrUnexpectedEOF:
+			return entry{}, errTruncated
+		case err != io.EOF:
+			return entry{}, err
+		case d.n != d.h.Count:
+			return entry{}, fmt.Errorf("%w: header says %d entries, file holds %d", ErrDataFile, d.h.Count, d.n)
+		case d.crc != d.h.Checksum:
+			return entry{}, fmt.Errorf("%w: checksum mismatch", ErrDataFile)
+		}
+		return entry{}, io.EOF
+	}
+	if d.n++; d.n > d.h.Count {
+		return entry{}, fmt.Errorf("%w: more entries than the %d the header says", ErrDataFile, d.h.Count)
+	}
+	d.crc = crc32.Update(d.crc, crc32.IEEETable, b)
+	return entry{
+		key:   d.uint(b[:d.h.KeyWidth]),
+		value: d.uint(b[d.h.KeyWidth:]),
+	}, nil
+}
+
+// uint decodes an unsigned integer of len(b) bytes in the file's order.
+func (d *dataReader) uint(b []byte) uint64 {
+	var v uint64
+	for i := range b {
+		if d.h.LittleEndian {
+			v |= uint64(b[i]) << (8 * i)
+		} else {
+			v = v<<8 | uint64(b[i])
+		}
+	}
+	return v
+}
+
+// DataWriter writes a data file with a header, in the big-endian 8-byte
+// layout of legacy files. The count and checksum are only known at the
+// end, so Close seeks back to write the header over the blank one
+// written first. Not safe for concurrent use.
+type DataWriter struct {
+	w     io.WriteSeeker
+	bw    *bufio.Writer
+	start int64
+	h     DataHeader
+	buf   [entrySize]byte
+}
+
+// NewDataWriter starts a data file at w's current offset. It fails if w
+// cannot seek, as a pipe cannot.
+func NewDataWriter(w io.WriteSeeker) (*DataWriter, error) {
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	dw := &DataWriter{w: w, bw: bufio.NewWriterSize(w, ioBufferSize), start: start,
+		h: DataHeader{KeyWidth: keySize, ValueWidth: valueSize}}
+	if _, err := dw.bw.Write(make([]byte, dataHeaderSize)); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+// Write appends one entry.
+func (dw *DataWriter) Write(key, value uint64) error {
+	putEntry(&dw.buf, key, value)
+	if _, err := dw.bw.Write(dw.buf[:]); err != nil {
+		return err
+	}
+	dw.h.Count++
+	dw.h.Checksum = crc32.Update(dw.h.Checksum, crc32.IEEETable, dw.buf[:])
+	return nil
+}
+
+// Close flushes the entries and writes the header, leaving w at the end
+// of the file. It does not close w.
+func (dw *DataWriter) Close() error {
+	if err := dw.bw.Flush(); err != nil {
+		return err
+	}
+	end, err := dw.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := dw.w.Seek(dw.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := dw.w.Write(dw.h.Bytes()); err != nil {
+		return err
+	}
+	_, err = dw.w.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,141 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"manager"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDataWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// The file may start at any offset of f; Close leaves f at the end
+	f.WriteString("preamble")
+	dw, err := NewDataWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := randomEntries(70, 5000, 3000)
+	for _, e := range entries {
+		if err := dw.Write(e.key, e.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("trailer")
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.TrimSuffix(bytes.TrimPrefix(b, []byte("preamble")), []byte("trailer"))
+	bt, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+
+	if _, err := NewDataWriter(nopSeeker{}); err == nil {
+		t.Error("NewDataWriter on a writer that cannot seek succeeded")
+	}
+}
+
+type nopSeeker struct{}
+
+func (nopSeeker) Write(p []byte) (int, error)    { return len(p), nil }
+func (nopSeeker) Seek(int64, int) (int64, error) { return 0, errors.New("cannot seek") }
+
+// dataWithHeader returns a data file of entries in the widths and order
+// of h, its count and checksum filled in.
+func dataWithHeader(h DataHeader, entries []entry) []byte {
+	var body []byte
+	put := func(v uint64, width int) {
+		for i := range width {
+			shift := 8 * (width - 1 - i)
+			if h.LittleEndian {
+				shift = 8 * i
+			}
+			body = append(body, byte(v>>shift))
+		}
+	}
+	for _, e := range entries {
+		put(e.key, h.KeyWidth)
+		put(e.value, h.ValueWidth)
+	}
+	h.Count = uint64(len(entries))
+	h.Checksum = crc32.ChecksumIEEE(body)
+	return append(h.Bytes(), body...)
+}
+
+func TestDataHeaderWidths(t *testing.T) {
+	entries := []entry{{3, 30}, {1, 10}, {0xffff, 0xff}, {2, 20}}
+	for _, h := range []DataHeader{
+		{KeyWidth: 8, ValueWidth: 8},
+		{LittleEndian: true, KeyWidth: 8, ValueWidth: 8},
+		{KeyWidth: 4, ValueWidth: 1},
+		{LittleEndian: true, KeyWidth: 2, ValueWidth: 4},
+	} {
+		bt, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(dataWithHeader(h, entries)))
+		if err != nil {
+			t.Errorf("%+v: %v", h, err)
+			continue
+		}
+		checkTree(t, bt, resolve(entries, false))
+	}
+}
+
+func TestBadDataFiles(t *testing.T) {
+	entries := sequential(100, 1)
+	good := dataWithHeader(DataHeader{KeyWidth: 8, ValueWidth: 8}, entries)
+	// rehead rewrites header bytes and then its checksum
+	rehead := func(b []byte, f func(h []byte)) []byte {
+		f(b[:dataHeaderSize])
+		binary.BigEndian.PutUint32(b[28:], crc32.ChecksumIEEE(b[:28]))
+		return b
+	}
+	for _, tc := range []struct {
+		name   string
+		mutate func(b []byte) []byte
+		want   string
+	}{
+		{"header cut short", func(b []byte) []byte { return b[:20] }, "header cut short"},
+		{"header checksum", func(b []byte) []byte { b[20]++; return b }, "header checksum mismatch"},
+		{"version", func(b []byte) []byte {
+			return rehead(b, func(h []byte) { h[9] = 2 })
+		}, "version 2"},
+		{"byte order", func(b []byte) []byte {
+			return rehead(b, func(h []byte) { h[10] = 2 })
+		}, "unknown byte order"},
+		{"width", func(b []byte) []byte {
+			return rehead(b, func(h []byte) { h[11] = 3 })
+		}, "widths 3 and 8"},
+		{"fewer entries", func(b []byte) []byte { return b[:len(b)-entrySize] }, "header says 100 entries, file holds 99"},
+		{"more entries", func(b []byte) []byte {
+			return rehead(b, func(h []byte) { binary.BigEndian.PutUint64(h[16:], 50) })
+		}, "more entries than the 50"},
+		{"entry checksum", func(b []byte) []byte { b[len(b)-1]++; return b }, "checksum mismatch"},
+	} {
+		_, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(tc.mutate(bytes.Clone(good))))
+		if !errors.Is(err, ErrDataFile) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want ErrDataFile with %q", tc.name, err, tc.want)
+		}
+	}
+
+	// A partial entry is a truncated file, whatever the header says
+	_, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(good[:len(good)-3]))
+	if !errors.Is(err, errTruncated) {
+		t.Errorf("partial entry: %v, want errTruncated", err)
+	}
+}
@@ -0,0 +1,122 @@
+package loader
+
+import (
+	"io"
+	"manager"
+	"os"
+	"splitordered"
+)
+
+// WithHashOptions passes opts to the table LoadSplitOrderedHash builds,
+// for a load factor or hasher. The table is sized for the input whatever
+// they say.
+func WithHashOptions(opts ...splitordered.Option) Option {
+	return func(o *options) {
+		o.hashOptions = append(o.hashOptions, opts...)
+	}
+}
+
+// LoadSplitOrderedHash builds a SplitOrderedHash from dataFile, read as
+// LoadDataFile reads it. The entries go through the same sort as a tree
+// load, which counts them, so the table is created at the size they need
+// instead of doubling its way there, and which brings equal keys together
+// for the duplicate policy. Of the tree options, WithFillFactor,
+// WithTablespace, WithCheckpoint and WithVerify do not apply.
+func LoadSplitOrderedHash(dataFile string, opts ...Option) (*splitordered.SplitOrderedHash, error) {
+	o := applyOptions(opts)
+	var so *splitordered.SplitOrderedHash
+	err := loadHashFile(dataFile, o, func(n uint64) (func(key, value uint64) error, error) {
+		so = splitordered.NewSplitOrderedHash(append(o.hashOptions, splitordered.WithExpectedCount(n))...)
+		return func(key, value uint64) error {
+			so.Put(key, value)
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return so, nil
+}
+
+// LoadDiskHash builds a DiskHash in bm from dataFile as
+// LoadSplitOrderedHash builds its table, creating it with
+// NewDiskHashSized so that its buckets rarely split during the load. It
+// goes in the tablespace set by WithTablespace.
+func LoadDiskHash(bm *manager.BufferManager, dataFile string, opts ...Option) (*splitordered.DiskHash, error) {
+	o := applyOptions(opts)
+	var dh *splitordered.DiskHash
+	err := loadHashFile(dataFile, o, func(n uint64) (func(key, value uint64) error, error) {
+		var err error
+		if dh, err = splitordered.NewDiskHashSized(bm, o.fileID, n); err != nil {
+			return nil, err
+		}
+		return func(key, value uint64) error {
+			_, err := dh.Put(key, value)
+			return err
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dh, nil
+}
+
+// loadHashFile sorts the entries of dataFile, calls create with their
+// number and passes them, duplicates resolved, to the put it returns.
+func loadHashFile(dataFile string, o options, create func(n uint64) (func(key, value uint64) error, error)) error {
+	file, err := os.Open(dataFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	t := newTracker(o)
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	src, err := sortInput(rewindable(file, readBinary(o)), o, t, nil)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	put, err := create(t.p.EntriesRead)
+	if err != nil {
+		return err
+	}
+	// Equal keys are adjacent in the sorted entries, so each is held back
+	// until the next key differs
+	var pending entry
+	have := false
+	for {
+		e, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && have && e.key == pending.key {
+			pending.value, err = o.duplicates(e.key, pending.value, e.value)
+		} else if err == nil {
+			if have {
+				err = put(pending.key, pending.value)
+			}
+			pending, have = e, true
+		}
+		if err == nil {
+			t.p.RunsMerged = src.merged()
+			err = t.entry(false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if have {
+		if err := put(pending.key, pending.value); err != nil {
+			return err
+		}
+	}
+	t.p.RunsMerged, t.p.Done = src.merged(), true
+	if t.fn != nil {
+		t.fn(t.p)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package loader
+
+import (
+	"errors"
+	"manager"
+	"splitordered"
+	"testing"
+)
+
+func TestLoadSplitOrderedHash(t *testing.T) {
+	entries := randomEntries(80, 20000, 8000)
+	want := resolve(entries, true)
+	so, err := LoadSplitOrderedHash(dataFile(t, entries), WithDuplicates(KeepFirst),
+		WithMemoryLimit(3000*entrySize), WithTempDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := so.Count(); n != uint64(len(want)) {
+		t.Errorf("table holds %d keys, want %d", n, len(want))
+	}
+	for _, e := range want {
+		if v, ok := so.Get(e.key); !ok || v != e.value {
+			t.Fatalf("Get(%d) = %d, %v, want %d", e.key, v, ok, e.value)
+		}
+	}
+	// Sized up front for every entry read, so it never grew
+	if r := so.Resizes(); r != 0 {
+		t.Errorf("table resized %d times during the load", r)
+	}
+
+	so, err = LoadSplitOrderedHash(dataFile(t, entries), WithHashOptions(splitordered.WithLoadFactor(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := so.Resizes(); r != 0 || so.Stats().Buckets < uint64(len(entries)) {
+		t.Errorf("table at load factor 1 resized %d times to %+v", r, so.Stats())
+	}
+}
+
+func TestLoadDiskHash(t *testing.T) {
+	entries := randomEntries(81, 50000, 1<<40)
+	bm := manager.NewBufferManager()
+	id, err := bm.CreateTablespace(t.TempDir() + "/hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dh, err := LoadDiskHash(bm, dataFile(t, entries), WithTablespace(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := resolve(entries, false)
+	if n, err := dh.Count(); err != nil || n != uint64(len(want)) {
+		t.Errorf("Count = %d, %v, want %d", n, err, len(want))
+	}
+	for _, e := range want {
+		if v, ok, err := dh.Get(e.key); err != nil || !ok || v != e.value {
+			t.Fatalf("Get(%d) = %d, %v, %v, want %d", e.key, v, ok, err, e.value)
+		}
+	}
+	if dh.Root().FileID() != id {
+		t.Errorf("hash in tablespace %d, want %d", dh.Root().FileID(), id)
+	}
+
+	if _, err := LoadDiskHash(bm, dataFile(t, []entry{{1, 1}, {1, 2}}), WithDuplicates(Error)); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("load of duplicates with the Error policy: %v, want ErrDuplicateKey", err)
+	}
+}
@@ -0,0 +1,66 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+)
+
+// ErrZstd is returned for zstd-compressed input when no decompressor has
+// been registered for it with WithDecompressor.
+var ErrZstd = errors.New("loader: zstd input needs a decompressor, see WithDecompressor")
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressor opens a stream that starts with magic.
+type decompressor struct {
+	magic []byte
+	open  func(io.Reader) (io.Reader, error)
+}
+
+// WithDecompressor makes loads recognise input starting with magic and
+// read it through open, such as a zstd decoder's NewReader for zstd's
+// magic 28 B5 2F FD, which the standard library has no decoder for. gzip
+// is recognised without one. If open returns an io.Closer it is closed
+// when the load is done.
+func WithDecompressor(magic []byte, open func(io.Reader) (io.Reader, error)) Option {
+	return func(o *options) {
+		o.decompressors = append(o.decompressors, decompressor{bytes.Clone(magic), open})
+	}
+}
+
+// decompress returns r, buffered, decompressed if it starts with a known
+// magic number, and a function to release the decompressor.
+func decompress(r io.Reader, o options) (*bufio.Reader, func(), error) {
+	br := bufio.NewReaderSize(r, ioBufferSize)
+	// Concatenated into a new slice: loads may share o.decompressors
+	decs := slices.Concat(o.decompressors, []decompressor{{gzipMagic, func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}}})
+	for _, d := range decs {
+		head, _ := br.Peek(len(d.magic))
+		if len(d.magic) == 0 || !bytes.Equal(head, d.magic) {
+			continue
+		}
+		dr, err := d.open(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		release := func() {
+			if c, ok := dr.(io.Closer); ok {
+				c.Close()
+			}
+		}
+		return bufio.NewReaderSize(dr, ioBufferSize), release, nil
+	}
+	if head, _ := br.Peek(len(zstdMagic)); bytes.Equal(head, zstdMagic) {
+		return nil, nil, ErrZstd
+	}
+	return br, func() {}, nil
+}
@@ -0,0 +1,103 @@
+package loader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"manager"
+	"testing"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGzipInput(t *testing.T) {
+	entries := randomEntries(10, 20000, 5000)
+	bt, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(gzipped(t, dataBytes(entries))),
+		WithMemoryLimit(4000*entrySize), WithTempDir(t.TempDir()), WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+
+	// A corrupt stream fails the load
+	b := gzipped(t, dataBytes(entries))
+	b[len(b)/2] ^= 0xff
+	if _, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(b)); err == nil {
+		t.Error("load of a corrupt gzip stream succeeded")
+	}
+}
+
+// xorReader undoes a toy compression that XORs every byte after a magic.
+type xorReader struct {
+	r      io.Reader
+	closed *bool
+}
+
+func (x xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= 0x5a
+	}
+	return n, err
+}
+
+func (x xorReader) Close() error {
+	*x.closed = true
+	return nil
+}
+
+func TestDecompressor(t *testing.T) {
+	magic := []byte("XOR!")
+	entries := randomEntries(11, 1000, 1000)
+	b := dataBytes(entries)
+	for i := range b {
+		b[i] ^= 0x5a
+	}
+	b = append(magic, b...)
+
+	var closed bool
+	open := func(r io.Reader) (io.Reader, error) {
+		if _, err := io.ReadFull(r, make([]byte, len(magic))); err != nil {
+			return nil, err
+		}
+		return xorReader{r, &closed}, nil
+	}
+	bt, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(b), WithDecompressor(magic, open))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+	if !closed {
+		t.Error("the decompressor was not closed")
+	}
+
+	zstd := append([]byte{0x28, 0xb5, 0x2f, 0xfd}, make([]byte, 60)...)
+	if _, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(zstd)); !errors.Is(err, ErrZstd) {
+		t.Errorf("load of zstd input: %v, want ErrZstd", err)
+	}
+}
+
+func TestDecompressorsNotShared(t *testing.T) {
+	// Options whose decompressors have room to append into
+	o := applyOptions([]Option{WithDecompressor([]byte("A"), nil)})
+	o.decompressors = append(make([]decompressor, 0, 4), o.decompressors...)
+	spare := o.decompressors[:2]
+	if _, _, err := decompress(bytes.NewReader(dataBytes(randomEntries(12, 2, 2))), o); err != nil {
+		t.Fatal(err)
+	}
+	if spare[1].magic != nil {
+		t.Errorf("decompress wrote %x into the options' array", spare[1].magic)
+	}
+}
@@ -0,0 +1,46 @@
+package loader
+
+import (
+	"btree"
+	"bufio"
+	"io"
+	"iter"
+	"strconv"
+)
+
+// DumpJSONLines writes every entry of bt to w in key order as JSON Lines,
+// one {"key":…,"value":…} object to a line, for inspecting a tree or
+// piping it into other tools. Keys and values are written as JSON numbers
+// in full; readers that parse numbers as float64, as JavaScript does, lose
+// precision above 1<<53.
+func DumpJSONLines(bt *btree.BTree, w io.Writer) error {
+	c := bt.Cursor()
+	return writeJSONLines(c, c.All(), w)
+}
+
+// DumpJSONLinesRange writes the entries of bt with keys from lo to hi
+// inclusive as DumpJSONLines writes them all, reading only the leaves
+// that hold them.
+func DumpJSONLinesRange(bt *btree.BTree, w io.Writer, lo, hi uint64) error {
+	c := bt.Cursor()
+	return writeJSONLines(c, c.Range(lo, hi), w)
+}
+
+func writeJSONLines(c *btree.Cursor, entries iter.Seq2[uint64, uint64], w io.Writer) error {
+	bw := bufio.NewWriterSize(w, ioBufferSize)
+	var line []byte
+	for key, value := range entries {
+		line = append(line[:0], `{"key":`...)
+		line = strconv.AppendUint(line, key, 10)
+		line = append(line, `,"value":`...)
+		line = strconv.AppendUint(line, value, 10)
+		line = append(line, "}\n"...)
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,35 @@
+package loader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDumpJSONLines(t *testing.T) {
+	bt := bulkLoad(t, []entry{{1, 10}, {5, 50}, {9, 90}, {1<<64 - 1, 1<<64 - 1}})
+	var b bytes.Buffer
+	if err := DumpJSONLines(bt, &b); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"key":1,"value":10}
+{"key":5,"value":50}
+{"key":9,"value":90}
+{"key":18446744073709551615,"value":18446744073709551615}
+`
+	if b.String() != want {
+		t.Errorf("DumpJSONLines wrote\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := DumpJSONLinesRange(bt, &b, 2, 9); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"key\":5,\"value\":50}\n{\"key\":9,\"value\":90}\n"; b.String() != want {
+		t.Errorf("DumpJSONLinesRange(2, 9) wrote %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+	if err := DumpJSONLines(bulkLoad(t, nil), &b); err != nil || b.Len() != 0 {
+		t.Errorf("dump of an empty tree wrote %q, %v", b.String(), err)
+	}
+}
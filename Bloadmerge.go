@@ -0,0 +1,215 @@
+package loader
+
+import (
+	"btree"
+	"io"
+	"manager"
+	"os"
+	"time"
+)
+
+// MergeInto adds the entries of dataFile, in LoadReader's format and any
+// order, to bt in one pass over its leaves instead of one Insert
+// each. The batch is sorted as by LoadReader and merged with the leaf
+// chain: leaves no batch key falls inside are kept as they are, those
+// that gain keys are rewritten, and the upper levels are rebuilt over the
+// result. A key already in bt is resolved by the duplicate policy, with
+// bt's value first. If MergeInto fails, bt is left as it was. Rewritten
+// leaves and the old upper levels are not freed.
+func MergeInto(bt *btree.BTree, dataFile string, opts ...Option) error {
+	bm := bt.BufferManager()
+	if bm.ReadOnly(bt.RootPageID().FileID()) {
+		return manager.ErrReadOnly
+	}
+	o := applyOptions(opts)
+	t := newTracker(o)
+	defer t.fill(o.report)
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	file, err := os.Open(dataFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	next, release, err := readData(file, o)
+	if err != nil {
+		return err
+	}
+	defer release()
+	read := func() (entry, error) {
+		e, err := next()
+		if err == nil {
+			err = t.entry(true)
+		}
+		return e, err
+	}
+	start := time.Now()
+	batch, err := sortEntries(read, o, t, nil)
+	t.stats.SortTime = time.Since(start)
+	if err != nil {
+		return err
+	}
+	defer batch.Close()
+
+	start = time.Now()
+	defer func() { t.stats.BuildTime = time.Since(start) }()
+	m := &merger{l: newBulkLoader(bm, o), batch: batch, t: t}
+	if err := m.run(bt); err != nil {
+		m.l.fail(err)
+		m.l.Close()
+		t.builtBy(m.l)
+		return err
+	}
+	merged, err := m.l.Close()
+	t.builtBy(m.l)
+	if err != nil {
+		return err
+	}
+	bt.SetRootPageID(merged.RootPageID())
+
+	t.p.RunsMerged, t.p.PagesWritten, t.p.Done = batch.merged(), m.l.pages, true
+	if t.fn != nil {
+		t.fn(t.p)
+	}
+	return nil
+}
+
+// merger feeds a BulkLoader the union of a tree's leaves and a sorted
+// batch.
+type merger struct {
+	l     *BulkLoader
+	batch entrySource
+	t     *tracker
+	head  entry // next batch entry, if more
+	more  bool
+}
+
+func (m *merger) run(bt *btree.BTree) error {
+	if err := m.advance(); err != nil {
+		return err
+	}
+	pageID, err := firstLeaf(bt)
+	if err != nil {
+		return err
+	}
+	var keys, values []uint64
+	for {
+		data, err := m.l.bm.PinPage(pageID)
+		if err != nil {
+			return err
+		}
+		leaf, err := btree.AsLeafPage(data)
+		if err != nil {
+			m.l.bm.UnpinPage(pageID, false)
+			return err
+		}
+		n, next := leaf.NumKeys(), leaf.Next()
+		if n == 0 {
+			// Only an empty tree has an empty leaf
+			m.l.bm.UnpinPage(pageID, false)
+		} else {
+			first, last := leaf.Key(0), leaf.Key(n-1)
+			// Batch entries that fall between the previous leaf and this one
+			if err := m.addBatch(func(key uint64) bool { return key < first }); err != nil {
+				m.l.bm.UnpinPage(pageID, false)
+				return err
+			}
+			if !m.more || m.head.key > last {
+				if err := m.l.adoptLeaf(pageID, data); err != nil {
+					return err
+				}
+			} else {
+				keys, values = keys[:0], values[:0]
+				for i := range n {
+					keys = append(keys, leaf.Key(i))
+					values = append(values, leaf.Value(i))
+				}
+				m.l.bm.UnpinPage(pageID, false)
+				if err := m.mergeLeaf(keys, values); err != nil {
+					return err
+				}
+			}
+		}
+		if next == 0 {
+			break
+		}
+		pageID = next
+	}
+	return m.addBatch(func(uint64) bool { return true })
+}
+
+// mergeLeaf adds the entries of a leaf together with the batch entries up
+// to its last key, a leaf entry before a batch entry of equal key.
+func (m *merger) mergeLeaf(keys, values []uint64) error {
+	last := keys[len(keys)-1]
+	for i := range keys {
+		if err := m.addBatch(func(key uint64) bool { return key < keys[i] }); err != nil {
+			return err
+		}
+		if err := m.add(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return m.addBatch(func(key uint64) bool { return key <= last })
+}
+
+// addBatch adds batch entries while before holds for their key.
+func (m *merger) addBatch(before func(key uint64) bool) error {
+	for m.more && before(m.head.key) {
+		if err := m.add(m.head.key, m.head.value); err != nil {
+			return err
+		}
+		if err := m.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *merger) add(key, value uint64) error {
+	if err := m.l.Add(key, value); err != nil {
+		return err
+	}
+	m.t.p.PagesWritten = m.l.pages
+	return m.t.entry(false)
+}
+
+func (m *merger) advance() error {
+	e, err := m.batch.next()
+	switch err {
+	case nil:
+		m.head, m.more = e, true
+	case io.EOF:
+		m.more = false
+	default:
+		return err
+	}
+	m.t.p.RunsMerged = m.batch.merged()
+	return nil
+}
+
+// firstLeaf follows the leftmost children of bt down to its first leaf.
+func firstLeaf(bt *btree.BTree) (manager.PageID, error) {
+	bm := bt.BufferManager()
+	pageID := bt.RootPageID()
+	for {
+		data, err := bm.PinPage(pageID)
+		if err != nil {
+			return 0, err
+		}
+		if manager.GetPageType(data) == manager.PageTypeLeaf {
+			bm.UnpinPage(pageID, false)
+			return pageID, nil
+		}
+		node, err := btree.AsInternalPage(data)
+		if err != nil {
+			bm.UnpinPage(pageID, false)
+			return 0, err
+		}
+		childID := node.Child(0)
+		bm.UnpinPage(pageID, false)
+		pageID = childID
+	}
+}
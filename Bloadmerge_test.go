@@ -0,0 +1,87 @@
+package loader
+
+import (
+	"errors"
+	"testing"
+)
+
+// union returns the entries of base and batch in key order, batch values
+// taking the place of base values of the same key unless first.
+func union(base, batch []entry, first bool) []entry {
+	return resolve(append(append([]entry(nil), base...), batch...), first)
+}
+
+func TestMergeInto(t *testing.T) {
+	base := sequential(100000, 2) // even keys
+	for _, tc := range []struct {
+		name  string
+		batch []entry
+	}{
+		{"interleaved", randomEntries(60, 20000, 200000)},
+		{"before", []entry{{0, 7}, {0, 8}}},
+		{"consecutive", sequential(500, 1)[100:]},
+		{"beyond", []entry{{1 << 40, 1}, {1<<40 + 1, 2}}},
+		{"empty", nil},
+	} {
+		bt := bulkLoad(t, base)
+		var report LoadReport
+		if err := MergeInto(bt, dataFile(t, tc.batch), WithReport(&report), WithMemoryLimit(3000*entrySize), WithTempDir(t.TempDir())); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		checkTree(t, bt, union(base, tc.batch, false))
+		if report.EntriesRead != uint64(len(tc.batch)) {
+			t.Errorf("%s: read %d entries, want %d", tc.name, report.EntriesRead, len(tc.batch))
+		}
+	}
+}
+
+func TestMergeIntoKeepsLeaves(t *testing.T) {
+	base := sequential(100000, 2)
+	bt := bulkLoad(t, base)
+	before, err := Verify(bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A batch within a few leaves rewrites only those
+	batch := []entry{{1001, 1}, {1003, 3}, {99999, 5}}
+	var report LoadReport
+	if err := MergeInto(bt, dataFile(t, batch), WithReport(&report)); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, union(base, batch, false))
+	if len(report.PagesPerLevel) == 0 || report.PagesPerLevel[0] > 4 {
+		t.Errorf("merge of 3 keys created leaves %v of %d", report.PagesPerLevel, before.Leaves)
+	}
+	if report.Entries != uint64(len(base)+len(batch)) {
+		t.Errorf("report counts %d entries, want %d", report.Entries, len(base)+len(batch))
+	}
+}
+
+func TestMergeIntoDuplicates(t *testing.T) {
+	base := sequential(10000, 1)
+	batch := []entry{{5, 500}, {20000, 1}, {7, 700}}
+	bt := bulkLoad(t, base)
+	if err := MergeInto(bt, dataFile(t, batch), WithDuplicates(KeepFirst)); err != nil {
+		t.Fatal(err)
+	}
+	// The tree's values come first
+	checkTree(t, bt, union(base, batch, true))
+
+	// A failed merge leaves the tree as it was
+	bt = bulkLoad(t, base)
+	root := bt.RootPageID()
+	if err := MergeInto(bt, dataFile(t, batch), WithDuplicates(Error)); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("merge of a key the tree holds with the Error policy: %v", err)
+	}
+	if bt.RootPageID() != root {
+		t.Error("a failed merge moved the root")
+	}
+	checkTree(t, bt, base)
+
+	// Into an empty tree
+	bt = bulkLoad(t, nil)
+	if err := MergeInto(bt, dataFile(t, batch)); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(batch, false))
+}
@@ -0,0 +1,718 @@
+package loader
+
+import (
+	"btree"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"manager"
+	"os"
+	"slices"
+)
+
+// ErrParquet is returned for a Parquet file that is malformed or uses a
+// feature LoadParquet does not read.
+var ErrParquet = errors.New("loader: cannot read Parquet file")
+
+var parquetMagic = []byte("PAR1")
+
+// maxParquetPage bounds the decompressed size of a page, so that a
+// corrupt header cannot make LoadParquet allocate without limit.
+const maxParquetPage = 1 << 30
+
+// Parquet's enumerations, of the values LoadParquet reads
+const (
+	parquetInt32 = 1
+	parquetInt64 = 2
+
+	parquetRequired = 0
+	parquetRepeated = 2
+
+	parquetUint32 = 13 // converted type UINT_32
+
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingDeltaBinary     = 5
+	encodingRLEDictionary   = 8
+)
+
+// LoadParquet builds a B+Tree from the columns keyCol and valueCol of the
+// Parquet file at path, through the same sort as LoadDataFile. Only the
+// byte ranges of those two columns are read, one row group at a time, so
+// files of many columns load about as fast as files of two. The columns
+// must be top-level INT32 or INT64 columns, of which INT32 ones annotated
+// as unsigned are taken as unsigned; signed values are taken as the
+// uint64 of the same bits, and a null fails the load. Pages may be
+// PLAIN, dictionary or DELTA_BINARY_PACKED encoded, in version 1 or 2
+// data pages, uncompressed or compressed with Snappy or gzip, or with
+// zstd given a decompressor for zstd's magic number with
+// WithDecompressor.
+func LoadParquet(bm *manager.BufferManager, path, keyCol, valueCol string, opts ...Option) (*btree.BTree, error) {
+	o := applyOptions(opts)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return load(bm, func() (func() (entry, error), func(), error) {
+		read, err := readParquet(file, info.Size(), path, keyCol, valueCol, o)
+		return read, func() {}, err
+	}, o)
+}
+
+// readParquet returns a function reading the keyCol and valueCol entries
+// of the Parquet file f of the given size, named path in errors.
+func readParquet(f io.ReaderAt, size int64, path, keyCol, valueCol string, o options) (func() (entry, error), error) {
+	meta, err := readParquetFooter(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, err := meta.column(keyCol)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	value, err := meta.column(valueCol)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	p := &parquetReader{f: f, size: size, meta: meta, o: o}
+	var keys, values []uint64
+	group, row := 0, 0
+	return func() (entry, error) {
+		for row == len(keys) {
+			if group == len(meta.rowGroups) {
+				return entry{}, io.EOF
+			}
+			var err error
+			if keys, err = p.readColumn(group, key); err == nil {
+				values, err = p.readColumn(group, value)
+			}
+			if err == nil && len(keys) != len(values) {
+				err = fmt.Errorf("%w: row group %d has %d keys and %d values", ErrParquet, group, len(keys), len(values))
+			}
+			if err != nil {
+				return entry{}, fmt.Errorf("%s: %w", path, err)
+			}
+			group, row = group+1, 0
+		}
+		row++
+		return entry{key: keys[row-1], value: values[row-1]}, nil
+	}, nil
+}
+
+// parquetMeta is what LoadParquet uses of a file's FileMetaData.
+type parquetMeta struct {
+	schema    []schemaElement
+	rowGroups []rowGroup
+}
+
+type schemaElement struct {
+	typ         int64
+	repetition  int64
+	name        string
+	numChildren int64
+	converted   int64
+	unsigned    bool // from an INTEGER logical type
+}
+
+type rowGroup struct {
+	numRows int64
+	columns []columnMeta
+}
+
+type columnMeta struct {
+	typ             int64
+	path            []string
+	codec           int64
+	numValues       int64
+	compressedSize  int64
+	dataOffset      int64
+	dictionaryStart int64
+}
+
+// parquetColumn is a column chosen to load.
+type parquetColumn struct {
+	name     string
+	elem     schemaElement
+	index    int // of its chunk in each row group
+	optional bool
+}
+
+// readParquetFooter reads the metadata at the end of the file.
+func readParquetFooter(f io.ReaderAt, size int64) (*parquetMeta, error) {
+	var tail [8]byte
+	if size < 12 {
+		return nil, fmt.Errorf("%w: too short", ErrParquet)
+	}
+	if _, err := f.ReadAt(tail[:], size-8); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tail[4:], parquetMagic) {
+		if string(tail[4:]) == "PARE" {
+			return nil, fmt.Errorf("%w: encrypted footer", ErrParquet)
+		}
+		return nil, fmt.Errorf("%w: no PAR1 magic", ErrParquet)
+	}
+	n := int64(binary.LittleEndian.Uint32(tail[:4]))
+	if n > size-12 {
+		return nil, fmt.Errorf("%w: footer of %d bytes", ErrParquet, n)
+	}
+	b := make([]byte, n)
+	if _, err := f.ReadAt(b, size-8-n); err != nil {
+		return nil, err
+	}
+
+	r := &thriftReader{b: b}
+	meta := &parquetMeta{}
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 2 && typ == thriftList:
+			r.readList(func(byte) { meta.schema = append(meta.schema, readSchemaElement(r)) })
+		case id == 4 && typ == thriftList:
+			r.readList(func(byte) { meta.rowGroups = append(meta.rowGroups, readRowGroup(r)) })
+		default:
+			r.skip(typ)
+		}
+	})
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrParquet, r.err)
+	}
+	if len(meta.schema) == 0 {
+		return nil, fmt.Errorf("%w: no schema", ErrParquet)
+	}
+	return meta, nil
+}
+
+func readSchemaElement(r *thriftReader) schemaElement {
+	e := schemaElement{typ: -1, converted: -1}
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 1 && typ == thriftI32:
+			e.typ = r.varint()
+		case id == 3 && typ == thriftI32:
+			e.repetition = r.varint()
+		case id == 4 && typ == thriftBinary:
+			e.name = string(r.binary())
+		case id == 5 && typ == thriftI32:
+			e.numChildren = r.varint()
+		case id == 6 && typ == thriftI32:
+			e.converted = r.varint()
+		case id == 10 && typ == thriftStruct:
+			// LogicalType, a union; field 10 is INTEGER, whose field 2 is
+			// isSigned
+			r.readStruct(func(id int16, typ byte) {
+				if id != 10 || typ != thriftStruct {
+					r.skip(typ)
+					return
+				}
+				r.readStruct(func(id int16, typ byte) {
+					if id == 2 && (typ == thriftTrue || typ == thriftFalse) {
+						e.unsigned = typ == thriftFalse
+					} else {
+						r.skip(typ)
+					}
+				})
+			})
+		default:
+			r.skip(typ)
+		}
+	})
+	return e
+}
+
+func readRowGroup(r *thriftReader) rowGroup {
+	var g rowGroup
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 1 && typ == thriftList:
+			r.readList(func(byte) { g.columns = append(g.columns, readColumnChunk(r)) })
+		case id == 3 && typ == thriftI64:
+			g.numRows = r.varint()
+		default:
+			r.skip(typ)
+		}
+	})
+	return g
+}
+
+// readColumnChunk reads a ColumnChunk's ColumnMetaData, field 3.
+func readColumnChunk(r *thriftReader) columnMeta {
+	var c columnMeta
+	r.readStruct(func(id int16, typ byte) {
+		if id != 3 || typ != thriftStruct {
+			r.skip(typ)
+			return
+		}
+		r.readStruct(func(id int16, typ byte) {
+			switch {
+			case id == 1 && typ == thriftI32:
+				c.typ = r.varint()
+			case id == 3 && typ == thriftList:
+				r.readList(func(byte) { c.path = append(c.path, string(r.binary())) })
+			case id == 4 && typ == thriftI32:
+				c.codec = r.varint()
+			case id == 5 && typ == thriftI64:
+				c.numValues = r.varint()
+			case id == 7 && typ == thriftI64:
+				c.compressedSize = r.varint()
+			case id == 9 && typ == thriftI64:
+				c.dataOffset = r.varint()
+			case id == 11 && typ == thriftI64:
+				c.dictionaryStart = r.varint()
+			default:
+				r.skip(typ)
+			}
+		})
+	})
+	return c
+}
+
+// column finds the top-level column name in the schema.
+func (m *parquetMeta) column(name string) (*parquetColumn, error) {
+	// The schema is the tree flattened depth first, the root first; walk
+	// the root's children, passing over the subtree of each
+	root := m.schema[0]
+	i := 1
+	for child := int64(0); child < root.numChildren && i < len(m.schema); child++ {
+		e := m.schema[i]
+		if e.name == name {
+			return m.checkColumn(e)
+		}
+		// Skip e and its descendants
+		for pending := int64(1); pending > 0 && i < len(m.schema); pending-- {
+			pending += m.schema[i].numChildren
+			i++
+		}
+	}
+	return nil, fmt.Errorf("%w: no column %q", ErrParquet, name)
+}
+
+func (m *parquetMeta) checkColumn(e schemaElement) (*parquetColumn, error) {
+	switch {
+	case e.numChildren > 0:
+		return nil, fmt.Errorf("%w: column %q is a group", ErrParquet, e.name)
+	case e.repetition == parquetRepeated:
+		return nil, fmt.Errorf("%w: column %q is repeated", ErrParquet, e.name)
+	case e.typ != parquetInt32 && e.typ != parquetInt64:
+		return nil, fmt.Errorf("%w: column %q is of physical type %d, not INT32 or INT64", ErrParquet, e.name, e.typ)
+	}
+	c := &parquetColumn{name: e.name, elem: e, index: -1, optional: e.repetition != parquetRequired}
+	for _, g := range m.rowGroups {
+		i := slices.IndexFunc(g.columns, func(cm columnMeta) bool {
+			return len(cm.path) == 1 && cm.path[0] == e.name
+		})
+		if i < 0 || c.index >= 0 && i != c.index {
+			return nil, fmt.Errorf("%w: no chunk of column %q in a row group", ErrParquet, e.name)
+		}
+		c.index = i
+	}
+	return c, nil
+}
+
+// parquetReader reads column chunks of a file.
+type parquetReader struct {
+	f    io.ReaderAt
+	size int64
+	meta *parquetMeta
+	o    options
+}
+
+// readColumn decodes column c of row group g.
+func (p *parquetReader) readColumn(g int, c *parquetColumn) ([]uint64, error) {
+	group := p.meta.rowGroups[g]
+	cm := group.columns[c.index]
+	start := cm.dataOffset
+	if cm.dictionaryStart > 0 && cm.dictionaryStart < start {
+		start = cm.dictionaryStart
+	}
+	if start < 0 || cm.compressedSize < 0 || cm.compressedSize > p.size-start {
+		return nil, fmt.Errorf("%w: column %q chunk out of the file", ErrParquet, c.name)
+	}
+	if cm.numValues != group.numRows {
+		return nil, fmt.Errorf("%w: column %q has %d values in a row group of %d rows", ErrParquet, c.name, cm.numValues, group.numRows)
+	}
+	chunk := make([]byte, cm.compressedSize)
+	if _, err := p.f.ReadAt(chunk, start); err != nil {
+		return nil, err
+	}
+
+	var dict []uint64
+	values := make([]uint64, 0, min(cm.numValues, 1<<20))
+	for int64(len(values)) < cm.numValues {
+		r := &thriftReader{b: chunk}
+		h := readPageHeader(r)
+		if r.err != nil || h.compressedSize < 0 || h.compressedSize > len(chunk)-r.pos {
+			return nil, fmt.Errorf("%w: column %q: bad page header", ErrParquet, c.name)
+		}
+		page := chunk[r.pos : r.pos+h.compressedSize]
+		chunk = chunk[r.pos+h.compressedSize:]
+		if h.typ != pageDictionary && int64(h.numValues) > cm.numValues-int64(len(values)) {
+			return nil, fmt.Errorf("%w: column %q: more values in its pages than in its chunk", ErrParquet, c.name)
+		}
+
+		var err error
+		switch h.typ {
+		case pageDictionary:
+			// Dictionaries are plain whichever dictionary encoding the
+			// pages using them name
+			if page, err = p.decompress(cm.codec, page, h.uncompressedSize); err == nil {
+				dict, err = c.decode(encodingPlain, page, h.numValues, nil)
+			}
+		case pageData:
+			if page, err = p.decompress(cm.codec, page, h.uncompressedSize); err == nil {
+				values, err = c.readPageV1(values, h, page, dict)
+			}
+		case pageDataV2:
+			values, err = p.readPageV2(c, cm.codec, values, h, page, dict)
+		default:
+			// Index pages and the like hold no values
+		}
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", c.name, err)
+		}
+	}
+	return values, nil
+}
+
+// pageHeader is what LoadParquet uses of a PageHeader.
+type pageHeader struct {
+	typ              int64
+	uncompressedSize int
+	compressedSize   int
+	numValues        int
+	numNulls         int
+	encoding         int64
+	levelsSize       int // definition and repetition levels, version 2
+	compressed       bool
+}
+
+func readPageHeader(r *thriftReader) pageHeader {
+	h := pageHeader{compressed: true}
+	r.readStruct(func(id int16, typ byte) {
+		switch {
+		case id == 1 && typ == thriftI32:
+			h.typ = r.varint()
+		case id == 2 && typ == thriftI32:
+			h.uncompressedSize = int(r.varint())
+		case id == 3 && typ == thriftI32:
+			h.compressedSize = int(r.varint())
+		case (id == 5 || id == 7) && typ == thriftStruct:
+			// DataPageHeader and DictionaryPageHeader start alike
+			r.readStruct(func(id int16, typ byte) {
+				switch {
+				case id == 1 && typ == thriftI32:
+					h.numValues = int(r.varint())
+				case id == 2 && typ == thriftI32:
+					h.encoding = r.varint()
+				default:
+					r.skip(typ)
+				}
+			})
+		case id == 8 && typ == thriftStruct:
+			r.readStruct(func(id int16, typ byte) {
+				switch {
+				case id == 1 && typ == thriftI32:
+					h.numValues = int(r.varint())
+				case id == 2 && typ == thriftI32:
+					h.numNulls = int(r.varint())
+				case id == 4 && typ == thriftI32:
+					h.encoding = r.varint()
+				case (id == 5 || id == 6) && typ == thriftI32:
+					h.levelsSize += int(r.varint())
+				case id == 7 && (typ == thriftTrue || typ == thriftFalse):
+					h.compressed = typ == thriftTrue
+				default:
+					r.skip(typ)
+				}
+			})
+		default:
+			r.skip(typ)
+		}
+	})
+	if h.numValues < 0 || h.uncompressedSize < 0 || h.levelsSize < 0 {
+		r.fail()
+	}
+	return h
+}
+
+// readPageV1 appends the values of a version 1 data page, decompressed.
+func (c *parquetColumn) readPageV1(values []uint64, h pageHeader, page []byte, dict []uint64) ([]uint64, error) {
+	if c.optional {
+		// Definition levels, RLE with their length before them; with one
+		// level of nesting each is one bit, 0 for a null
+		if len(page) < 4 {
+			return nil, fmt.Errorf("%w: page cut short", ErrParquet)
+		}
+		n := int(binary.LittleEndian.Uint32(page))
+		if n > len(page)-4 {
+			return nil, fmt.Errorf("%w: page cut short", ErrParquet)
+		}
+		levels, err := readHybrid(page[4:4+n], 1, h.numValues)
+		if err != nil {
+			return nil, err
+		}
+		if i := slices.Index(levels, 0); i >= 0 {
+			return nil, fmt.Errorf("%w: null at row %d", ErrParquet, len(values)+i)
+		}
+		page = page[4+n:]
+	}
+	vs, err := c.decode(h.encoding, page, h.numValues, dict)
+	return append(values, vs...), err
+}
+
+// readPageV2 appends the values of a version 2 data page, whose levels
+// come before its values and are never compressed.
+func (p *parquetReader) readPageV2(c *parquetColumn, codec int64, values []uint64, h pageHeader, page []byte, dict []uint64) ([]uint64, error) {
+	if h.numNulls > 0 {
+		return nil, fmt.Errorf("%w: %d nulls in a page from row %d", ErrParquet, h.numNulls, len(values))
+	}
+	if h.levelsSize > len(page) {
+		return nil, fmt.Errorf("%w: page cut short", ErrParquet)
+	}
+	page = page[h.levelsSize:]
+	if h.compressed {
+		var err error
+		if page, err = p.decompress(codec, page, h.uncompressedSize-h.levelsSize); err != nil {
+			return nil, err
+		}
+	}
+	vs, err := c.decode(h.encoding, page, h.numValues, dict)
+	return append(values, vs...), err
+}
+
+// decompress decompresses a page of size bytes.
+func (p *parquetReader) decompress(codec int64, page []byte, size int) ([]byte, error) {
+	if size > maxParquetPage {
+		return nil, fmt.Errorf("%w: page of %d bytes", ErrParquet, size)
+	}
+	var r io.Reader
+	switch codec {
+	case codecUncompressed:
+		return page, nil
+	case codecSnappy:
+		out, err := snappyDecode(page, size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrParquet, err)
+		}
+		return out, nil
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case codecZstd:
+		i := slices.IndexFunc(p.o.decompressors, func(d decompressor) bool {
+			return bytes.Equal(d.magic, zstdMagic)
+		})
+		if i < 0 {
+			return nil, ErrZstd
+		}
+		dr, err := p.o.decompressors[i].open(bytes.NewReader(page))
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := dr.(io.Closer); ok {
+			defer c.Close()
+		}
+		r = dr
+	default:
+		return nil, fmt.Errorf("%w: compression codec %d", ErrParquet, codec)
+	}
+	out := make([]byte, size)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, fmt.Errorf("%w: page shorter than its header says: %v", ErrParquet, err)
+	}
+	return out, nil
+}
+
+// decode decodes n values of the column's type in encoding.
+func (c *parquetColumn) decode(encoding int64, b []byte, n int, dict []uint64) ([]uint64, error) {
+	width := 8
+	if c.elem.typ == parquetInt32 {
+		width = 4
+	}
+	var values []uint64
+	switch encoding {
+	case encodingPlain:
+		if len(b)/width < n {
+			return nil, fmt.Errorf("%w: page cut short", ErrParquet)
+		}
+		values = make([]uint64, n)
+		for i := range values {
+			if width == 8 {
+				values[i] = binary.LittleEndian.Uint64(b[i*8:])
+			} else {
+				values[i] = uint64(binary.LittleEndian.Uint32(b[i*4:]))
+			}
+		}
+	case encodingPlainDictionary, encodingRLEDictionary:
+		if len(b) == 0 || b[0] > 32 {
+			return nil, fmt.Errorf("%w: bad dictionary index width", ErrParquet)
+		}
+		indices, err := readHybrid(b[1:], int(b[0]), n)
+		if err != nil {
+			return nil, err
+		}
+		// Dictionary values are converted already
+		for i, x := range indices {
+			if x >= uint64(len(dict)) {
+				return nil, fmt.Errorf("%w: dictionary index %d of %d", ErrParquet, x, len(dict))
+			}
+			indices[i] = dict[x]
+		}
+		return indices, nil
+	case encodingDeltaBinary:
+		var err error
+		if values, err = readDelta(b, n); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: encoding %d", ErrParquet, encoding)
+	}
+
+	if width == 4 {
+		unsigned := c.elem.unsigned || c.elem.converted == parquetUint32
+		for i, v := range values {
+			if unsigned {
+				values[i] = uint64(uint32(v))
+			} else {
+				values[i] = uint64(int64(int32(v)))
+			}
+		}
+	}
+	return values, nil
+}
+
+// bitReader reads little-endian bit-packed values, least significant bit
+// first, as Parquet packs them.
+type bitReader struct {
+	b   []byte
+	bit int
+}
+
+func (r *bitReader) read(width int) (uint64, bool) {
+	if r.bit+width > len(r.b)*8 {
+		return 0, false
+	}
+	var v uint64
+	for i := 0; i < width; {
+		byteBit := r.bit & 7
+		take := min(8-byteBit, width-i)
+		v |= uint64(r.b[r.bit>>3]>>byteBit&(1<<take-1)) << i
+		i += take
+		r.bit += take
+	}
+	return v, true
+}
+
+// readHybrid decodes n values of width bits from the RLE/bit-packed
+// hybrid encoding, which Parquet uses for levels and dictionary indices.
+func readHybrid(b []byte, width, n int) ([]uint64, error) {
+	values := make([]uint64, 0, n)
+	byteWidth := (width + 7) / 8
+	for len(values) < n {
+		h, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, fmt.Errorf("%w: RLE run cut short", ErrParquet)
+		}
+		b = b[k:]
+		if h&1 == 0 {
+			// A run of one value, in byteWidth bytes
+			count := h >> 1
+			if len(b) < byteWidth || count > uint64(n-len(values)) {
+				return nil, fmt.Errorf("%w: bad RLE run", ErrParquet)
+			}
+			var v uint64
+			for i := byteWidth - 1; i >= 0; i-- {
+				v = v<<8 | uint64(b[i])
+			}
+			b = b[byteWidth:]
+			for range count {
+				values = append(values, v)
+			}
+			continue
+		}
+		// Groups of eight bit-packed values; the last may be padding
+		groups := h >> 1
+		size := groups * uint64(width)
+		if size > uint64(len(b)) {
+			return nil, fmt.Errorf("%w: bit-packed run cut short", ErrParquet)
+		}
+		r := &bitReader{b: b[:size]}
+		for i := uint64(0); i < groups*8 && len(values) < n; i++ {
+			v, _ := r.read(width)
+			values = append(values, v)
+		}
+		b = b[size:]
+	}
+	return values, nil
+}
+
+// readDelta decodes n values of the DELTA_BINARY_PACKED encoding: a header
+// of the block size, miniblocks per block, value count and first value,
+// then blocks of a minimum delta, the bit width of each miniblock and the
+// miniblocks, each delta stored less the minimum.
+func readDelta(b []byte, n int) ([]uint64, error) {
+	r := &thriftReader{b: b}
+	blockSize, miniblocks := r.uvarint(), r.uvarint()
+	total, first := r.uvarint(), r.varint()
+	if r.err != nil || miniblocks == 0 || blockSize > 1<<20 || blockSize%miniblocks != 0 ||
+		blockSize/miniblocks%8 != 0 || total < uint64(n) {
+		return nil, fmt.Errorf("%w: bad DELTA_BINARY_PACKED header", ErrParquet)
+	}
+	perMini := int(blockSize / miniblocks)
+
+	values := make([]uint64, 0, n)
+	if n == 0 {
+		return values, nil
+	}
+	last := uint64(first)
+	values = append(values, last)
+	for len(values) < n {
+		minDelta := uint64(r.varint())
+		if r.pos+int(miniblocks) > len(b) {
+			return nil, fmt.Errorf("%w: DELTA_BINARY_PACKED block cut short", ErrParquet)
+		}
+		widths := b[r.pos : r.pos+int(miniblocks)]
+		r.pos += int(miniblocks)
+		for _, width := range widths {
+			if len(values) == n {
+				break
+			}
+			size := perMini * int(width) / 8
+			if width > 64 || r.pos+size > len(b) {
+				return nil, fmt.Errorf("%w: DELTA_BINARY_PACKED miniblock cut short", ErrParquet)
+			}
+			br := &bitReader{b: b[r.pos : r.pos+size]}
+			for i := 0; i < perMini && len(values) < n; i++ {
+				d, _ := br.read(int(width))
+				last += minDelta + d
+				values = append(values, last)
+			}
+			r.pos += size
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("%w: DELTA_BINARY_PACKED block cut short", ErrParquet)
+		}
+	}
+	return values, nil
+}
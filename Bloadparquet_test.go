@@ -0,0 +1,223 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"manager"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The files in testdata are written by testdata/genparquet.go; these are
+// the rows it gives them.
+var parquetFixtures = []struct {
+	file           string
+	keyCol, valCol string
+	rows           int
+	key, value     func(i int) uint64
+}{
+	{"plain.parquet", "id", "val", 1000,
+		func(i int) uint64 { return uint64(i * 7919 % 1000 * 1000003) },
+		func(i int) uint64 { return uint64(i * i) }},
+	{"dict_snappy.parquet", "key", "value", 1000,
+		func(i int) uint64 { return 0xf0000000 + uint64(i*7919%1000) },
+		func(i int) uint64 { return uint64(i%10) * 1e12 }},
+	{"gzip_v2.parquet", "key", "value", 1000,
+		func(i int) uint64 { return uint64(i*5 + i%3 + i/700*1e15) },
+		func(i int) uint64 { return uint64(int64(i - 500)) }},
+}
+
+func TestLoadParquet(t *testing.T) {
+	for _, fx := range parquetFixtures {
+		t.Run(fx.file, func(t *testing.T) {
+			entries := make([]entry, fx.rows)
+			for i := range entries {
+				entries[i] = entry{fx.key(i), fx.value(i)}
+			}
+			var report LoadReport
+			bt, err := LoadParquet(manager.NewBufferManager(), filepath.Join("testdata", fx.file), fx.keyCol, fx.valCol,
+				WithReport(&report), WithVerify(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTree(t, bt, resolve(entries, false))
+			if report.EntriesRead != uint64(fx.rows) {
+				t.Errorf("read %d entries, want %d", report.EntriesRead, fx.rows)
+			}
+		})
+	}
+}
+
+func TestLoadParquetColumns(t *testing.T) {
+	bm := manager.NewBufferManager()
+	// Keys and values may be the same column, or swapped
+	bt, err := LoadParquet(bm, "testdata/plain.parquet", "val", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := bt.Get(999 * 999); err != nil || v != uint64(999*7919%1000*1000003) {
+		t.Errorf("Get(999²) = %d, %v", v, err)
+	}
+
+	for _, tc := range []struct {
+		file, key, value, want string
+	}{
+		{"plain.parquet", "id", "missing", `no column "missing"`},
+		{"plain.parquet", "name", "val", `"name" is of physical type 6`},
+		{"nulls.parquet", "key", "value", "null at row 5"},
+	} {
+		_, err := LoadParquet(bm, filepath.Join("testdata", tc.file), tc.key, tc.value)
+		if !errors.Is(err, ErrParquet) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s columns %s, %s: %v, want ErrParquet with %q", tc.file, tc.key, tc.value, err, tc.want)
+		}
+	}
+}
+
+// loadParquetBytes loads b as a Parquet file of columns key and value.
+func loadParquetBytes(t *testing.T, b []byte) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "f.parquet")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadParquet(manager.NewBufferManager(), path, "key", "value")
+	return err
+}
+
+func TestMalformedParquet(t *testing.T) {
+	good, err := os.ReadFile("testdata/dict_snappy.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(good[len(good)-8:]))
+	for _, tc := range []struct {
+		name   string
+		mutate func(b []byte) []byte
+	}{
+		{"empty", func([]byte) []byte { return nil }},
+		{"no magic", func(b []byte) []byte { return b[:len(b)-1] }},
+		{"encrypted", func(b []byte) []byte { copy(b[len(b)-4:], "PARE"); return b }},
+		{"footer longer than the file", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[len(b)-8:], uint32(len(b)))
+			return b
+		}},
+		{"footer cut short", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[len(b)-8:], uint32(footerLen/2))
+			return b
+		}},
+		{"column chunks gone", func(b []byte) []byte {
+			return append([]byte("PAR1"), b[len(b)-8-footerLen:]...)
+		}},
+		{"pages zeroed", func(b []byte) []byte {
+			clear(b[4 : len(b)-8-footerLen])
+			return b
+		}},
+	} {
+		err := loadParquetBytes(t, tc.mutate(bytes.Clone(good)))
+		if !errors.Is(err, ErrParquet) {
+			t.Errorf("%s: %v, want ErrParquet", tc.name, err)
+		}
+	}
+}
+
+func TestCorruptParquetDoesNotPanic(t *testing.T) {
+	// Damage of any byte may go unnoticed in a value, but must not crash
+	// the reader or make it allocate without bound
+	r := rand.New(rand.NewPCG(1, 2))
+	for _, fx := range parquetFixtures {
+		good, err := os.ReadFile(filepath.Join("testdata", fx.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 200 {
+			b := bytes.Clone(good)
+			for range 1 + r.IntN(3) {
+				b[4+r.IntN(len(b)-12)] ^= byte(1 + r.IntN(255))
+			}
+			path := filepath.Join(t.TempDir(), fx.file)
+			if err := os.WriteFile(path, b, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			LoadParquet(manager.NewBufferManager(), path, fx.keyCol, fx.valCol)
+		}
+	}
+}
+
+func TestSnappyDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  []byte
+		want string
+	}{
+		{"empty", []byte{0}, ""},
+		{"literal", []byte{5, 4 << 2, 'h', 'e', 'l', 'l', 'o'}, "hello"},
+		// "abcd" then a 1-byte-offset copy of 8 from 4 back, overlapping
+		{"overlapping copy", []byte{12, 3 << 2, 'a', 'b', 'c', 'd', 0x01 | 4<<2, 4}, "abcdabcdabcd"},
+		{"2-byte offset", []byte{6, 2 << 2, 'x', 'y', 'z', 0x02 | 2<<2, 3, 0}, "xyzxyz"},
+		{"4-byte offset", []byte{4, 1 << 2, 'a', 'b', 0x03 | 1<<2, 2, 0, 0, 0}, "abab"},
+		{"long literal", append([]byte{70, 60 << 2, 69}, strings.Repeat("q", 70)...), strings.Repeat("q", 70)},
+	} {
+		got, err := snappyDecode(tc.src, len(tc.want))
+		if err != nil || string(got) != tc.want {
+			t.Errorf("%s: %q, %v, want %q", tc.name, got, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		src  []byte
+		size int
+	}{
+		{"no length", nil, 0},
+		{"length mismatch", []byte{5, 4 << 2, 'h', 'e', 'l', 'l', 'o'}, 4},
+		{"literal past the end", []byte{5, 4 << 2, 'h', 'e'}, 5},
+		{"copy before the start", []byte{4, 0x01 | 0<<2, 1}, 4},
+		{"zero offset", []byte{5, 0, 'a', 0x01, 0}, 5},
+		{"copy past the length", []byte{6, 0, 'a', 0x01 | 4<<2, 1}, 6},
+		{"short", []byte{5, 0, 'a'}, 5},
+	} {
+		if got, err := snappyDecode(tc.src, tc.size); err == nil {
+			t.Errorf("%s: decoded %q", tc.name, got)
+		}
+	}
+}
+
+func TestThriftSkip(t *testing.T) {
+	// A struct of every type to skip, then field 9 = 7
+	b := []byte{
+		0x11,       // 1: true
+		0x13, 0x7f, // 2: byte
+		0x16, 0x80, 0x01, // 3: i64
+		0x17, 0, 0, 0, 0, 0, 0, 0, 0, // 4: double
+		0x18, 2, 'h', 'i', // 5: binary
+		0x19, 0x21, 1, 2, // 6: list of 2 bools, a byte each
+		0x1b, 1, 0x55, 2, 4, // 7: map of 1 i32 to i32
+		0x1c, 0x15, 2, 0, // 8: struct of an i32
+		0x15, 14, // 9: i32 7
+		0,
+	}
+	r := &thriftReader{b: b}
+	var got int64 = -1
+	r.readStruct(func(id int16, typ byte) {
+		if id == 9 {
+			got = r.varint()
+			return
+		}
+		r.skip(typ)
+	})
+	if r.err != nil || got != 7 || r.pos != len(b) {
+		t.Errorf("skipped to field 9 = %d at %d of %d, %v", got, r.pos, len(b), r.err)
+	}
+
+	// Nesting past maxThriftDepth fails rather than recursing on
+	deep := bytes.Repeat([]byte{0x1c}, maxThriftDepth+2)
+	r = &thriftReader{b: deep}
+	r.skip(thriftStruct)
+	if r.err == nil {
+		t.Error("skip of structs nested too deep succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+package loader
+
+import "context"
+
+// progressInterval is how many entries pass between progress reports and
+// cancellation checks.
+const progressInterval = 1 << 16
+
+// Progress is a snapshot of a load, passed to the WithProgress callback.
+type Progress struct {
+	EntriesRead  uint64 // entries read from the input so far
+	RunsWritten  int    // sorted runs spilled to temporary files, merge passes' among them
+	RunsMerged   int    // spilled runs merged to their end
+	PagesWritten uint64 // tree pages filled
+	Done         bool   // set on the last report, once the tree is built
+}
+
+// WithProgress makes a load call fn from the loading goroutine every so
+// many entries, after each spilled run and once at the end. fn should
+// return quickly; to watch a load from elsewhere, send the Progress on a
+// channel without blocking.
+func WithProgress(fn func(Progress)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// WithContext makes a load stop soon after ctx is done, removing its run
+// files and returning ctx.Err(). Pages already filled are not reclaimed.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// tracker counts a load's progress, reports it and checks for
+// cancellation.
+type tracker struct {
+	ctx context.Context
+	fn  func(Progress)
+	p   Progress
+	n   int // entries since the last check
+
+	stats LoadReport // for WithReport; EntriesRead and RunsSpilled are in p
+}
+
+func newTracker(o options) *tracker {
+	t := &tracker{ctx: o.ctx, fn: o.progress}
+	if t.ctx == nil {
+		t.ctx = context.Background()
+	}
+	return t
+}
+
+// entry counts one entry read or built, reporting and checking ctx every
+// progressInterval.
+func (t *tracker) entry(read bool) error {
+	if read {
+		t.p.EntriesRead++
+	}
+	if t.n++; t.n < progressInterval {
+		return nil
+	}
+	t.n = 0
+	return t.report()
+}
+
+// report calls the callback, if any, and returns ctx.Err().
+func (t *tracker) report() error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+	if t.fn != nil {
+		t.fn(t.p)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"manager"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	entries := randomEntries(40, 3*progressInterval, 1<<40)
+	var reports []Progress
+	bt, err := LoadReader(manager.NewBufferManager(), newBytesReader(entries),
+		WithMemoryLimit(progressInterval*entrySize), WithTempDir(t.TempDir()),
+		WithProgress(func(p Progress) { reports = append(reports, p) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+
+	if len(reports) < 4 {
+		t.Fatalf("%d progress reports, want one per run spilled and more", len(reports))
+	}
+	for i, p := range reports[1:] {
+		prev := reports[i]
+		if p.EntriesRead < prev.EntriesRead || p.RunsWritten < prev.RunsWritten ||
+			p.RunsMerged < prev.RunsMerged || p.PagesWritten < prev.PagesWritten || prev.Done {
+			t.Fatalf("report %d went backwards: %+v after %+v", i+1, p, prev)
+		}
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.EntriesRead != uint64(len(entries)) || last.RunsWritten != 3 || last.RunsMerged != 3 || last.PagesWritten == 0 {
+		t.Errorf("last report %+v", last)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	entries := randomEntries(41, 4*progressInterval, 1<<40)
+	for _, phase := range []string{"sort", "build"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		tmp := t.TempDir()
+		_, err := LoadReader(manager.NewBufferManager(), newBytesReader(entries),
+			WithMemoryLimit(progressInterval*entrySize), WithTempDir(tmp), WithContext(ctx),
+			WithProgress(func(p Progress) {
+				if phase == "sort" && p.RunsWritten == 2 || phase == "build" && p.PagesWritten > 0 {
+					cancel()
+				}
+			}))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("load cancelled while it %ss: %v, want context.Canceled", phase, err)
+		}
+		if names := tempFiles(t, tmp); len(names) != 0 {
+			t.Errorf("load cancelled while it %ss left run files: %v", phase, names)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	_, err := LoadReader(manager.NewBufferManager(), newBytesReader(entries), WithContext(ctx),
+		WithProgress(func(Progress) { called = true }))
+	if !errors.Is(err, context.Canceled) || called {
+		t.Errorf("load with a done context: %v, progress called %v", err, called)
+	}
+}
@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"os"
+	"slices"
+	"time"
+)
+
+// LoadReport describes a finished load, for tuning WithMemoryLimit and
+// spotting odd input: many more runs than the input size and memory limit
+// call for, or far more duplicates than expected.
+type LoadReport struct {
+	EntriesRead        uint64   // entries read from the input
+	Entries            uint64   // entries in the tree
+	DuplicatesResolved uint64   // entries folded into one before by the duplicate policy
+	RunsSpilled        int      // sorted runs spilled to temporary files, merge passes' among them
+	TempBytes          int64    // bytes written to run files
+	PagesPerLevel      []uint64 // pages created on each level, leaves first
+
+	SortTime   time.Duration // reading and sorting the input, spilling runs
+	BuildTime  time.Duration // merging the runs and filling pages
+	VerifyTime time.Duration // checking the tree, with WithVerify
+}
+
+// WithReport makes LoadDataFile, LoadReader, LoadCSV, LoadSQL,
+// LoadParquet, LoadFromChannel and MergeInto fill r in when they return, whether they
+// succeed or not, with what they did up to then. A load resumed from a
+// checkpoint counts the entries and runs the checkpoint kept, but only
+// the duplicates and pages of the tree built since; MergeInto counts the
+// tree's old entries among Entries, and its leaves kept as they were not
+// among the pages created.
+func WithReport(r *LoadReport) Option {
+	return func(o *options) {
+		o.report = r
+	}
+}
+
+// builtBy records in t's report what l did.
+func (t *tracker) builtBy(l *BulkLoader) {
+	t.stats.Entries = l.entries
+	t.stats.DuplicatesResolved = l.resolved
+	t.stats.PagesPerLevel = slices.Clone(l.levelPages)
+}
+
+// spilled records in t's report run files of n bytes.
+func (t *tracker) spilled(n int64) {
+	t.stats.TempBytes += n
+}
+
+// spilledRuns records in t's report the run files a checkpoint kept.
+func (t *tracker) spilledRuns(runs []*os.File) error {
+	for _, f := range runs {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		t.spilled(info.Size())
+	}
+	return nil
+}
+
+// fill copies t's report to r, if not nil.
+func (t *tracker) fill(r *LoadReport) {
+	if r == nil {
+		return
+	}
+	*r = t.stats
+	r.EntriesRead, r.RunsSpilled = t.p.EntriesRead, t.p.RunsWritten
+}
@@ -0,0 +1,60 @@
+package loader
+
+import (
+	"bytes"
+	"manager"
+	"testing"
+)
+
+func TestLoadReport(t *testing.T) {
+	entries := randomEntries(90, 30000, 20000)
+	want := resolve(entries, false)
+	for _, tc := range []struct {
+		name  string
+		limit int
+		runs  int
+	}{
+		{"in memory", DefaultMemoryLimit, 0},
+		{"spilled", 10000 * entrySize, 3},
+	} {
+		var report LoadReport
+		bt, err := LoadReader(manager.NewBufferManager(), newBytesReader(entries),
+			WithMemoryLimit(tc.limit), WithTempDir(t.TempDir()), WithVerify(false), WithReport(&report))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.EntriesRead != uint64(len(entries)) || report.Entries != uint64(len(want)) ||
+			report.DuplicatesResolved != uint64(len(entries)-len(want)) {
+			t.Errorf("%s: read %d entries into %d, resolving %d; want %d into %d", tc.name,
+				report.EntriesRead, report.Entries, report.DuplicatesResolved, len(entries), len(want))
+		}
+		if report.RunsSpilled != tc.runs || report.TempBytes != int64(tc.runs)*int64(len(entries))/3*entrySize {
+			t.Errorf("%s: %d runs of %d bytes, want %d", tc.name, report.RunsSpilled, report.TempBytes, tc.runs)
+		}
+		v, err := Verify(bt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var internal uint64
+		for _, n := range report.PagesPerLevel[1:] {
+			internal += n
+		}
+		if len(report.PagesPerLevel) != v.Height || report.PagesPerLevel[0] != v.Leaves || internal != v.InternalNodes {
+			t.Errorf("%s: pages per level %v, tree of height %d with %d leaves and %d internal nodes", tc.name,
+				report.PagesPerLevel, v.Height, v.Leaves, v.InternalNodes)
+		}
+		if report.SortTime <= 0 || report.BuildTime <= 0 || report.VerifyTime <= 0 {
+			t.Errorf("%s: times %v, %v, %v", tc.name, report.SortTime, report.BuildTime, report.VerifyTime)
+		}
+	}
+
+	// A failed load reports what it did before it failed
+	var report LoadReport
+	b := dataBytes(sequential(1000, 1))
+	if _, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(b[:len(b)-entrySize/2]), WithReport(&report)); err == nil {
+		t.Fatal("load of a truncated file succeeded")
+	}
+	if report.EntriesRead != 999 || report.Entries != 0 {
+		t.Errorf("failed load read %d entries into %d, want 999 into 0", report.EntriesRead, report.Entries)
+	}
+}
@@ -0,0 +1,24 @@
+package loader
+
+import (
+	"encoding/binary"
+	"errors"
+	"manager"
+)
+
+var errSnappy = errors.New("malformed Snappy block")
+
+// snappyDecode decodes a Snappy block, the raw format without stream
+// framing that Parquet compresses pages with, whose decoded length must
+// be size. The length is checked first, so a corrupt page cannot make the
+// decoder allocate more than the page header promised.
+func snappyDecode(src []byte, size int) ([]byte, error) {
+	if n, k := binary.Uvarint(src); k <= 0 || n != uint64(size) {
+		return nil, errSnappy
+	}
+	out, err := manager.SnappyCompressor{}.Decompress(make([]byte, 0, size), src)
+	if err != nil {
+		return nil, errSnappy
+	}
+	return out, nil
+}
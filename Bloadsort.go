@@ -0,0 +1,380 @@
+package loader
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"slices"
+)
+
+// entrySource yields entries in key order. next returns io.EOF after the
+// last one; merged counts the run files read to their end; Close releases
+// anything the source holds, such as run files.
+type entrySource interface {
+	next() (entry, error)
+	merged() int
+	Close() error
+}
+
+// readEntry reads one big-endian key/value pair. It returns io.EOF only at
+// a clean end of input.
+func readEntry(r io.Reader, buf *[entrySize]byte) (entry, error) {
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return entry{}, errTruncated
+		}
+		return entry{}, err
+	}
+	return entry{
+		key:   binary.BigEndian.Uint64(buf[:keySize]),
+		value: binary.BigEndian.Uint64(buf[keySize:]),
+	}, nil
+}
+
+func compareEntries(a, b entry) int {
+	return cmp.Compare(a.key, b.key)
+}
+
+// sortEntries calls read until it returns io.EOF and returns the entries
+// in key order, keeping those with equal keys in input order. Input that
+// fits in one run of o.memoryLimit bytes is sorted in memory; anything
+// larger is sorted a run at a time, each run spilled to a temporary file,
+// and the runs are merged as the returned source is read. Each spilled run
+// is reported to t. With cp, the load continues from the checkpoint's
+// runs, every run is spilled, even if there is only one, and each is
+// recorded in the checkpoint and kept if the load fails, for it to resume.
+func sortEntries(read func() (entry, error), o options, t *tracker, cp *checkpointer) (entrySource, error) {
+	runLen := max(o.memoryLimit/entrySize, 1)
+	var runs []*os.File
+	discard := removeRuns
+	if cp != nil {
+		var err error
+		if runs, err = cp.openRuns(); err != nil {
+			return nil, err
+		}
+		t.p.RunsWritten = len(runs)
+		discard = closeRuns
+		if err := t.spilledRuns(runs); err != nil {
+			discard(runs)
+			return nil, err
+		}
+	}
+	entries := make([]entry, 0, min(runLen, 1<<16))
+
+	for {
+		entries = entries[:0]
+		var err error
+		for len(entries) < runLen {
+			var e entry
+			if e, err = read(); err != nil {
+				break
+			}
+			entries = append(entries, e)
+		}
+		if err != nil && err != io.EOF {
+			discard(runs)
+			return nil, err
+		}
+		slices.SortStableFunc(entries, compareEntries)
+
+		if err == io.EOF && len(runs) == 0 && cp == nil {
+			return &sliceSource{entries: entries}, nil
+		}
+		if len(entries) > 0 {
+			run, werr := writeRun(entries, o.tempDir)
+			if werr == nil {
+				runs = append(runs, run)
+				t.p.RunsWritten++
+				t.spilled(int64(len(entries)) * entrySize)
+				if cp != nil {
+					werr = cp.sorted(t.p.EntriesRead, runs, false)
+				}
+			}
+			if werr == nil {
+				werr = t.report()
+			}
+			if werr != nil {
+				discard(runs)
+				return nil, werr
+			}
+		}
+		if err == io.EOF {
+			fanIn, bufSize := mergeShape(o.memoryLimit)
+			if runs, err = mergePasses(runs, fanIn, bufSize, o.tempDir, t, cp); err != nil {
+				return nil, err
+			}
+			if cp != nil {
+				if err := cp.sorted(t.p.EntriesRead, runs, true); err != nil {
+					discard(runs)
+					return nil, err
+				}
+			}
+			m, err := newMergeSource(runs, cp != nil, bufSize)
+			if err != nil {
+				return nil, err
+			}
+			m.prior = t.p.RunsMerged
+			return m, nil
+		}
+	}
+}
+
+const (
+	// maxMergeFanIn is the most runs merged at once, bounding the files a
+	// load holds open.
+	maxMergeFanIn = 64
+
+	// minRunBuffer is the smallest read buffer of a run being merged,
+	// whatever the memory limit.
+	minRunBuffer = 4 << 10
+)
+
+// mergeShape returns how many runs to merge at once and the read buffer
+// size of each, so that the buffers of a merge pass, with the one it
+// writes through, fit in memoryLimit where they can.
+func mergeShape(memoryLimit int) (fanIn, bufSize int) {
+	bufSize = min(max(memoryLimit/maxMergeFanIn, minRunBuffer), ioBufferSize)
+	fanIn = min(max(memoryLimit/bufSize-1, 2), maxMergeFanIn)
+	return fanIn, bufSize
+}
+
+// mergePasses merges runs fanIn at a time into longer runs until no more
+// than fanIn are left, for the final merge to read. Each pass merges
+// consecutive runs, so entries with equal keys stay in input order. The
+// merged runs are removed; with cp, only once the checkpoint lists the
+// run that replaces them. On error the runs left are discarded as
+// sortEntries does.
+func mergePasses(runs []*os.File, fanIn, bufSize int, dir string, t *tracker, cp *checkpointer) ([]*os.File, error) {
+	discard := removeRuns
+	if cp != nil {
+		discard = closeRuns
+	}
+	for len(runs) > fanIn {
+		var passed []*os.File
+		for len(runs) > 0 {
+			group := runs[:min(fanIn, len(runs))]
+			if len(group) == 1 {
+				passed = append(passed, group[0])
+				runs = runs[1:]
+				continue
+			}
+			run, n, err := mergeRun(group, dir, bufSize)
+			if err == nil && cp != nil {
+				if err = run.Sync(); err == nil {
+					err = cp.sorted(t.p.EntriesRead, slices.Concat(passed, []*os.File{run}, runs[len(group):]), false)
+				}
+			}
+			if err != nil && run != nil {
+				removeRuns([]*os.File{run})
+			}
+			if err == nil {
+				// mergeRun has closed them
+				for _, f := range group {
+					err = errors.Join(err, os.Remove(f.Name()))
+				}
+				passed = append(passed, run)
+				runs = runs[len(group):]
+				t.p.RunsWritten++
+				t.p.RunsMerged += len(group)
+				t.spilled(n)
+			}
+			if err == nil {
+				err = t.report()
+			}
+			if err != nil {
+				discard(slices.Concat(passed, runs))
+				return nil, err
+			}
+		}
+		runs = passed
+	}
+	return runs, nil
+}
+
+// mergeRun merges runs, closing them, into a new temporary file, and
+// returns it with its size.
+func mergeRun(runs []*os.File, dir string, bufSize int) (*os.File, int64, error) {
+	src, err := newMergeSource(runs, true, bufSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer src.Close()
+	f, err := os.CreateTemp(dir, "loader-run-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	w := bufio.NewWriterSize(f, bufSize)
+	var buf [entrySize]byte
+	var n int64
+	for {
+		var e entry
+		if e, err = src.next(); err != nil {
+			break
+		}
+		putEntry(&buf, e.key, e.value)
+		if _, err = w.Write(buf[:]); err != nil {
+			break
+		}
+		n += entrySize
+	}
+	if err == io.EOF {
+		err = w.Flush()
+	}
+	if err != nil {
+		removeRuns([]*os.File{f})
+		return nil, 0, err
+	}
+	return f, n, nil
+}
+
+// writeRun writes sorted entries to a new temporary file.
+func writeRun(entries []entry, dir string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, "loader-run-*")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriterSize(f, ioBufferSize)
+	var buf [entrySize]byte
+	for _, e := range entries {
+		putEntry(&buf, e.key, e.value)
+		if _, err = w.Write(buf[:]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		removeRuns([]*os.File{f})
+		return nil, err
+	}
+	return f, nil
+}
+
+func closeRuns(runs []*os.File) error {
+	var errs []error
+	for _, f := range runs {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func removeRuns(runs []*os.File) error {
+	var errs []error
+	for _, f := range runs {
+		errs = append(errs, f.Close(), os.Remove(f.Name()))
+	}
+	return errors.Join(errs...)
+}
+
+// sliceSource yields entries already sorted in memory.
+type sliceSource struct {
+	entries []entry
+	pos     int
+}
+
+func (s *sliceSource) next() (entry, error) {
+	if s.pos == len(s.entries) {
+		return entry{}, io.EOF
+	}
+	s.pos++
+	return s.entries[s.pos-1], nil
+}
+
+func (s *sliceSource) merged() int { return 0 }
+
+func (s *sliceSource) Close() error {
+	s.entries = nil
+	return nil
+}
+
+// runReader is one sorted run being merged, with its next entry.
+type runReader struct {
+	r     *bufio.Reader
+	head  entry
+	index int // position of the run in the input, to keep the merge stable
+}
+
+// runHeap orders runs by their next entry.
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].head.key != h[j].head.key {
+		return h[i].head.key < h[j].head.key
+	}
+	return h[i].index < h[j].index
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// mergeSource k-way merges sorted run files, taking the least head entry
+// from a heap of runs.
+type mergeSource struct {
+	keep  bool // close the files but leave them for a checkpoint
+	files []*os.File
+	runs  runHeap
+	done  int // runs read to their end
+	prior int // runs merged by earlier passes
+	buf   [entrySize]byte
+}
+
+// newMergeSource merges files from their start, reading each through a
+// buffer of bufSize bytes.
+func newMergeSource(files []*os.File, keep bool, bufSize int) (*mergeSource, error) {
+	m := &mergeSource{files: files, keep: keep}
+	for i, f := range files {
+		r := &runReader{r: bufio.NewReaderSize(f, bufSize), index: i}
+		_, err := f.Seek(0, io.SeekStart)
+		if err == nil {
+			r.head, err = readEntry(r.r, &m.buf)
+		}
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.runs = append(m.runs, r)
+	}
+	heap.Init(&m.runs)
+	return m, nil
+}
+
+func (m *mergeSource) next() (entry, error) {
+	if len(m.runs) == 0 {
+		return entry{}, io.EOF
+	}
+	top := m.runs[0]
+	e := top.head
+	var err error
+	switch top.head, err = readEntry(top.r, &m.buf); err {
+	case nil:
+		heap.Fix(&m.runs, 0)
+	case io.EOF:
+		heap.Pop(&m.runs)
+		m.done++
+	default:
+		return entry{}, err
+	}
+	return e, nil
+}
+
+func (m *mergeSource) merged() int { return m.prior + m.done }
+
+// Close removes the run files, or only closes them if they are kept.
+func (m *mergeSource) Close() error {
+	m.runs = nil
+	if m.keep {
+		return closeRuns(m.files)
+	}
+	return removeRuns(m.files)
+}
@@ -0,0 +1,209 @@
+package loader
+
+import (
+	"btree"
+	"bytes"
+	"errors"
+	"io"
+	"manager"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// dataFile writes entries to a headerless data file and returns its path.
+func dataFile(t *testing.T, entries []entry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, dataBytes(entries), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func dataBytes(entries []entry) []byte {
+	var b bytes.Buffer
+	var buf [entrySize]byte
+	for _, e := range entries {
+		putEntry(&buf, e.key, e.value)
+		b.Write(buf[:])
+	}
+	return b.Bytes()
+}
+
+// randomEntries returns n entries of keys below keys, so that some repeat,
+// each valued by its position.
+func randomEntries(seed uint64, n, keys int) []entry {
+	r := rand.New(rand.NewPCG(seed, seed))
+	entries := make([]entry, n)
+	for i := range entries {
+		entries[i] = entry{key: r.Uint64N(uint64(keys)), value: uint64(i)}
+	}
+	return entries
+}
+
+// resolve returns the entries a load of entries should leave with the
+// KeepFirst or KeepLast policy, in key order.
+func resolve(entries []entry, first bool) []entry {
+	want := map[uint64]uint64{}
+	for _, e := range entries {
+		if _, ok := want[e.key]; !ok || !first {
+			want[e.key] = e.value
+		}
+	}
+	out := make([]entry, 0, len(want))
+	for k, v := range want {
+		out = append(out, entry{k, v})
+	}
+	slices.SortFunc(out, compareEntries)
+	return out
+}
+
+// checkTree fails t unless bt holds exactly want, in order, and passes
+// Verify.
+func checkTree(t *testing.T, bt *btree.BTree, want []entry) {
+	t.Helper()
+	var got []entry
+	c := bt.Cursor()
+	for k, v := range c.All() {
+		got = append(got, entry{k, v})
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("tree holds %d entries, want %d; first %v, want %v", len(got), len(want), got[:min(len(got), 5)], want[:min(len(want), 5)])
+	}
+	report, err := Verify(bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("Verify: %+v", report)
+	}
+}
+
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestMergeShape(t *testing.T) {
+	for _, tc := range []struct {
+		limit, fanIn, bufSize int
+	}{
+		{DefaultMemoryLimit, maxMergeFanIn, ioBufferSize},
+		{1 << 20, 63, 16 << 10},
+		{64 << 10, 15, minRunBuffer},
+		{1600, 2, minRunBuffer},
+	} {
+		fanIn, bufSize := mergeShape(tc.limit)
+		if fanIn != tc.fanIn || bufSize != tc.bufSize {
+			t.Errorf("mergeShape(%d) = %d, %d, want %d, %d", tc.limit, fanIn, bufSize, tc.fanIn, tc.bufSize)
+		}
+		if tc.limit >= 64<<10 && (fanIn+1)*bufSize > tc.limit {
+			t.Errorf("mergeShape(%d): %d buffers of %d bytes exceed the limit", tc.limit, fanIn+1, bufSize)
+		}
+	}
+}
+
+func TestInMemorySort(t *testing.T) {
+	entries := randomEntries(1, 5000, 2000)
+	var report LoadReport
+	bt, err := LoadDataFile(manager.NewBufferManager(), dataFile(t, entries), WithReport(&report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+	if report.RunsSpilled != 0 || report.TempBytes != 0 {
+		t.Errorf("input that fits in memory spilled %d runs of %d bytes", report.RunsSpilled, report.TempBytes)
+	}
+}
+
+func TestSpilledSort(t *testing.T) {
+	entries := randomEntries(2, 10000, 3000)
+	tmp := t.TempDir()
+	var report LoadReport
+	bt, err := LoadDataFile(manager.NewBufferManager(), dataFile(t, entries),
+		WithMemoryLimit(64<<10), WithTempDir(tmp), WithReport(&report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(entries, false))
+	// Runs of 4096 entries, few enough for one merge
+	if report.RunsSpilled != 3 || report.TempBytes != 10000*entrySize {
+		t.Errorf("spilled %d runs of %d bytes, want 3 of %d", report.RunsSpilled, report.TempBytes, 10000*entrySize)
+	}
+	if names := tempFiles(t, tmp); len(names) != 0 {
+		t.Errorf("run files left behind: %v", names)
+	}
+}
+
+func TestMultiPassMerge(t *testing.T) {
+	// Runs of 100 entries are merged 2 at a time, so 30 runs take 4
+	// passes before the final merge
+	entries := randomEntries(3, 3000, 1000)
+	for _, first := range []bool{true, false} {
+		tmp := t.TempDir()
+		var report LoadReport
+		var last Progress
+		policy := KeepLast
+		if first {
+			policy = KeepFirst
+		}
+		bt, err := LoadDataFile(manager.NewBufferManager(), dataFile(t, entries),
+			WithMemoryLimit(100*entrySize), WithTempDir(tmp), WithDuplicates(policy),
+			WithReport(&report), WithProgress(func(p Progress) { last = p }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Equal keys keep input order through every pass
+		checkTree(t, bt, resolve(entries, first))
+		// Passes write 15, 7 (carrying the 15th run over), 4 and 2 runs;
+		// every run is read through, the last 2 by the final merge
+		const written = 30 + 15 + 7 + 4 + 2
+		if report.RunsSpilled != written || last.RunsMerged != written {
+			t.Errorf("spilled %d runs and merged %d, want %d", report.RunsSpilled, last.RunsMerged, written)
+		}
+		if want := int64(4*3000+2800) * entrySize; report.TempBytes != want {
+			t.Errorf("wrote %d bytes of runs, want %d", report.TempBytes, want)
+		}
+		if names := tempFiles(t, tmp); len(names) != 0 {
+			t.Errorf("run files left behind: %v", names)
+		}
+	}
+}
+
+func TestTruncatedInput(t *testing.T) {
+	b := dataBytes(randomEntries(4, 100, 100))
+	_, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(b[:len(b)-3]))
+	if !errors.Is(err, errTruncated) {
+		t.Errorf("load of a partial entry: %v, want %v", err, errTruncated)
+	}
+	tmp := t.TempDir()
+	_, err = LoadReader(manager.NewBufferManager(), bytes.NewReader(b[:len(b)-3]),
+		WithMemoryLimit(10*entrySize), WithTempDir(tmp))
+	if !errors.Is(err, errTruncated) {
+		t.Errorf("spilled load of a partial entry: %v, want %v", err, errTruncated)
+	}
+	if names := tempFiles(t, tmp); len(names) != 0 {
+		t.Errorf("failed load left run files: %v", names)
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	bt, err := LoadReader(manager.NewBufferManager(), bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, nil)
+	if _, err := LoadReader(manager.NewBufferManager(), io.LimitReader(nil, 0)); err != nil {
+		t.Errorf("load of an empty stream: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package loader
+
+import (
+	"btree"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"manager"
+	"strings"
+)
+
+// LoadSQL builds a B+Tree from the keyCol and valueCol columns of every
+// row of table in db, through the same sort as LoadDataFile, so that a
+// small dataset kept in SQLite can be moved in without a binary dump.
+// db is opened by the caller with a driver of their choice, such as
+// mattn/go-sqlite3 or modernc.org/sqlite, which this package does not
+// depend on; any database/sql driver whose SQL quotes names in double
+// quotes works. Both columns must hold integers: SQLite's are signed, so
+// a negative one is taken as the uint64 of the same bits, as Go stores a
+// uint64 above 1<<63 - 1. A NULL fails the load. With WithVerify(true) the
+// query is run a second time; a load resumed with WithCheckpoint runs it
+// again too, and skips the rows already read, so the table must not
+// change in between.
+func LoadSQL(bm *manager.BufferManager, db *sql.DB, table, keyCol, valueCol string, opts ...Option) (*btree.BTree, error) {
+	o := applyOptions(opts)
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := fmt.Sprintf("SELECT %s, %s FROM %s", quoteName(keyCol), quoteName(valueCol), quoteName(table))
+	return load(bm, func() (func() (entry, error), func(), error) {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		return readRows(rows, table), func() { rows.Close() }, nil
+	}, o)
+}
+
+// quoteName quotes an SQL identifier.
+func quoteName(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// readRows returns a function reading the key and value of each of rows,
+// from table, named in errors.
+func readRows(rows *sql.Rows, table string) func() (entry, error) {
+	var n uint64
+	return func() (entry, error) {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return entry{}, err
+			}
+			return entry{}, io.EOF
+		}
+		n++
+		var key, value sql.NullInt64
+		if err := rows.Scan(&key, &value); err != nil {
+			return entry{}, fmt.Errorf("loader: %s row %d: %w", table, n, err)
+		}
+		if !key.Valid || !value.Valid {
+			return entry{}, fmt.Errorf("loader: %s row %d: NULL key or value", table, n)
+		}
+		return entry{key: uint64(key.Int64), value: uint64(value.Int64)}, nil
+	}
+}
@@ -0,0 +1,99 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"manager"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver serving one table of two columns to
+// any query, recording the queries.
+type fakeDB struct {
+	mu      sync.Mutex
+	rows    [][2]driver.Value
+	queries []string
+}
+
+func (d *fakeDB) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	return &fakeRows{rows: c.d.rows}, nil
+}
+
+type fakeRows struct{ rows [][2]driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"k", "v"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	dest[0], dest[1] = r.rows[0][0], r.rows[0][1]
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func openFake(d *fakeDB) *sql.DB {
+	return sql.OpenDB(connector{d})
+}
+
+type connector struct{ d *fakeDB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return fakeConn{c.d}, nil }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+func TestLoadSQL(t *testing.T) {
+	d := &fakeDB{}
+	var want []entry
+	for i := range int64(5000) {
+		k := (i * 7919) % 5000
+		d.rows = append(d.rows, [2]driver.Value{k - 2500, k})
+		want = append(want, entry{uint64(k - 2500), uint64(k)})
+	}
+	db := openFake(d)
+	defer db.Close()
+	bt, err := LoadSQL(manager.NewBufferManager(), db, `my "table"`, "key", "value",
+		WithMemoryLimit(1000*entrySize), WithTempDir(t.TempDir()), WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Negative keys are the uint64 of the same bits, and sort last
+	checkTree(t, bt, resolve(want, false))
+	if v, err := bt.Get(1<<64 - 1); err != nil || v != 2499 {
+		t.Errorf("Get of key -1 = %d, %v, want 2499", v, err)
+	}
+	if len(d.queries) != 2 || d.queries[0] != `SELECT "key", "value" FROM "my ""table"""` {
+		t.Errorf("queries %q, want the quoted query twice", d.queries)
+	}
+
+	for _, tc := range []struct {
+		name string
+		row  [2]driver.Value
+		want string
+	}{
+		{"null", [2]driver.Value{int64(1), nil}, "row 2: NULL key or value"},
+		{"text", [2]driver.Value{"one", int64(1)}, "row 2: sql: Scan error"},
+	} {
+		d := &fakeDB{rows: [][2]driver.Value{{int64(0), int64(0)}, tc.row}}
+		_, err := LoadSQL(manager.NewBufferManager(), openFake(d), "t", "k", "v")
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want an error with %q", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package loader
+
+import (
+	"btree"
+	"errors"
+	"fmt"
+	"manager"
+)
+
+// ErrUnsorted is returned by BulkLoader.Add for a key below the one
+// before it.
+var ErrUnsorted = errors.New("loader: keys out of order")
+
+var errClosed = errors.New("loader: bulk loader closed")
+
+// BulkLoader builds a B+Tree from entries added in key order, in one pass
+// and without holding them: it keeps only the leaf being filled and the
+// rightmost node of each internal level pinned, adding each finished page
+// to its parent as it goes, so memory stays O(height) however many
+// entries there are. Not safe for concurrent use.
+type BulkLoader struct {
+	bm         *manager.BufferManager
+	duplicates DuplicatePolicy
+	leafCap    int // entries per leaf
+	nodeCap    int // children per internal node
+	fileID     manager.FileID
+
+	// The leaf being filled, if started
+	leaf      btree.LeafPage
+	leafID    manager.PageID
+	leafKeys  int
+	leafFirst uint64
+	started   bool
+
+	levels     []*levelNode // rightmost internal node of each level, bottom up
+	last       uint64
+	pages      uint64        // pages allocated
+	entries    uint64        // entries added, less duplicates
+	resolved   uint64        // duplicates given to the policy
+	levelPages []uint64      // pages allocated on each level, leaves first
+	adopted    []adoptedLeaf // leaves taken over from another tree
+	err        error         // sticky; set to errClosed by Close
+}
+
+// adoptedLeaf is the state of a leaf before adoptLeaf took it over, so
+// that a failed load can give it back unchanged.
+type adoptedLeaf struct {
+	id         manager.PageID
+	prev, next manager.PageID
+	keys       int
+	lastValue  uint64
+}
+
+// levelNode is the internal node being filled on one level.
+type levelNode struct {
+	node     btree.InternalPage
+	id       manager.PageID
+	firstKey uint64 // the first key under the node
+	children int
+}
+
+// NewBulkLoader returns a loader into bm. Of the options, only
+// WithDuplicates, WithFillFactor and WithTablespace apply.
+func NewBulkLoader(bm *manager.BufferManager, opts ...Option) *BulkLoader {
+	return newBulkLoader(bm, applyOptions(opts))
+}
+
+func newBulkLoader(bm *manager.BufferManager, o options) *BulkLoader {
+	return &BulkLoader{
+		bm:         bm,
+		duplicates: o.duplicates,
+		leafCap:    max(int(o.fillFactor*btree.MaxLeafEntries), 1),
+		nodeCap:    max(int(o.fillFactor*(btree.MaxInternalKeys+1)), 2),
+		fileID:     o.fileID,
+	}
+}
+
+// Add appends key and value to the tree. Keys must not decrease; a key
+// equal to the last is resolved by the duplicate policy, KeepLast unless
+// set with WithDuplicates.
+func (l *BulkLoader) Add(key, value uint64) error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.started && key < l.last {
+		return fmt.Errorf("%w: %d after %d", ErrUnsorted, key, l.last)
+	}
+	if l.started && key == l.last {
+		// The last entry is always in the current leaf
+		i := l.leafKeys - 1
+		value, err := l.duplicates(key, l.leaf.Value(i), value)
+		if err != nil {
+			return err
+		}
+		l.leaf.SetValue(i, value)
+		l.resolved++
+		return nil
+	}
+	if !l.started || l.leafKeys >= l.leafCap {
+		if err := l.startLeaf(key); err != nil {
+			return l.fail(err)
+		}
+	}
+	l.leaf.SetEntry(l.leafKeys, key, value)
+	l.leafKeys++
+	l.entries++
+	l.leaf.SetNumKeys(l.leafKeys)
+	l.last = key
+	return nil
+}
+
+// startLeaf starts a new leaf whose first key is firstKey.
+func (l *BulkLoader) startLeaf(firstKey uint64) error {
+	pageID, data, err := l.bm.NewPageIn(l.fileID)
+	if err != nil {
+		return err
+	}
+	l.allocated(0)
+	return l.pushLeaf(pageID, btree.InitializeLeafPage(data), firstKey)
+}
+
+// adoptLeaf makes the leaf pageID of another tree, pinned as data, the
+// current leaf instead of copying its entries, so that a merge can keep
+// the leaves it does not change. Its first key must be above the last
+// added. The loader takes over the pin.
+func (l *BulkLoader) adoptLeaf(pageID manager.PageID, data *[manager.PageSize]byte) error {
+	if l.err != nil {
+		l.bm.UnpinPage(pageID, false)
+		return l.err
+	}
+	leaf, err := btree.AsLeafPage(data)
+	if err == nil && leaf.NumKeys() == 0 {
+		err = errors.New("loader: cannot adopt an empty leaf")
+	}
+	if err == nil && l.started && leaf.Key(0) <= l.last {
+		err = fmt.Errorf("%w: %d after %d", ErrUnsorted, leaf.Key(0), l.last)
+	}
+	if err != nil {
+		l.bm.UnpinPage(pageID, false)
+		return err
+	}
+
+	n := leaf.NumKeys()
+	l.entries += uint64(n)
+	l.adopted = append(l.adopted, adoptedLeaf{
+		id: pageID, prev: leaf.Prev(), next: leaf.Next(),
+		keys: n, lastValue: leaf.Value(n - 1),
+	})
+	leaf.SetPrev(0)
+	leaf.SetNext(0)
+	if err := l.pushLeaf(pageID, leaf, leaf.Key(0)); err != nil {
+		return l.fail(err)
+	}
+	l.last = leaf.Key(n - 1)
+	return nil
+}
+
+// pushLeaf makes leaf, pinned, the current leaf, chaining the one before
+// it, if any, to it and adding that one to its parent.
+func (l *BulkLoader) pushLeaf(pageID manager.PageID, next btree.LeafPage, firstKey uint64) error {
+	if l.started {
+		l.leaf.SetNext(pageID)
+		next.SetPrev(l.leafID)
+		if err := l.bm.UnpinPage(l.leafID, true); err != nil {
+			l.bm.UnpinPage(pageID, true)
+			l.started = false
+			return err
+		}
+		if err := l.addChild(0, l.leafID, l.leafFirst); err != nil {
+			l.leaf, l.leafID = next, pageID
+			return err
+		}
+	}
+	l.leaf, l.leafID, l.leafKeys, l.leafFirst = next, pageID, next.NumKeys(), firstKey
+	l.started = true
+	return nil
+}
+
+// addChild appends the page childID, whose first key is firstKey, to the
+// rightmost node of internal level i, starting a new node, and passing
+// the full one up, when it has no room.
+func (l *BulkLoader) addChild(i int, childID manager.PageID, firstKey uint64) error {
+	if i < len(l.levels) && l.levels[i].children < l.nodeCap {
+		lv := l.levels[i]
+		// The new key separates the previous child from this one
+		lv.node.SetNumKeys(lv.children)
+		lv.node.SetKey(lv.children-1, firstKey)
+		lv.node.SetChild(lv.children, childID)
+		lv.children++
+		return nil
+	}
+
+	pageID, data, err := l.bm.NewPageIn(l.fileID)
+	if err != nil {
+		return err
+	}
+	l.allocated(i + 1)
+	node := btree.InitializeInternalPage(data)
+	node.SetChild(0, childID)
+	fresh := &levelNode{node: node, id: pageID, firstKey: firstKey, children: 1}
+	if i == len(l.levels) {
+		l.levels = append(l.levels, fresh)
+		return nil
+	}
+
+	full := l.levels[i]
+	l.levels[i] = fresh
+	if err := l.bm.UnpinPage(full.id, true); err != nil {
+		return err
+	}
+	return l.addChild(i+1, full.id, full.firstKey)
+}
+
+// allocated counts a page allocated on level, 0 for leaves.
+func (l *BulkLoader) allocated(level int) {
+	l.pages++
+	for len(l.levelPages) <= level {
+		l.levelPages = append(l.levelPages, 0)
+	}
+	l.levelPages[level]++
+}
+
+// Close finishes the tree and returns it. An empty loader gives an empty
+// tree. Once Add has failed to write a page, it fails every call after and
+// Close only releases the loader's pages and returns that error.
+func (l *BulkLoader) Close() (*btree.BTree, error) {
+	if l.err != nil {
+		err := l.err
+		l.release()
+		l.err = errClosed
+		return nil, err
+	}
+	l.err = errClosed
+
+	if !l.started {
+		pageID, data, err := l.bm.NewPageIn(l.fileID)
+		if err != nil {
+			return nil, err
+		}
+		l.allocated(0)
+		btree.InitializeLeafPage(data)
+		return btree.OpenBTree(l.bm, pageID), l.bm.UnpinPage(pageID, true)
+	}
+
+	// Pass the last page of each level up to its parent; the page left
+	// with no level above is the root
+	id, firstKey := l.leafID, l.leafFirst
+	if err := l.bm.UnpinPage(id, true); err != nil {
+		l.started = false
+		l.release()
+		return nil, err
+	}
+	l.started = false
+	for i := 0; i < len(l.levels); i++ {
+		if err := l.addChild(i, id, firstKey); err != nil {
+			l.release()
+			return nil, err
+		}
+		lv := l.levels[i]
+		l.levels[i] = nil
+		if err := l.bm.UnpinPage(lv.id, true); err != nil {
+			l.release()
+			return nil, err
+		}
+		id, firstKey = lv.id, lv.firstKey
+	}
+	l.levels, l.adopted = nil, nil
+	return btree.OpenBTree(l.bm, id), nil
+}
+
+// atLeafEnd reports whether adding key would start a new leaf, with the
+// last one finished: where a checkpoint can be taken.
+func (l *BulkLoader) atLeafEnd(key uint64) bool {
+	return l.started && l.leafKeys >= l.leafCap && key != l.last
+}
+
+// state returns the loader's state for a checkpoint.
+func (l *BulkLoader) state() loaderState {
+	s := loaderState{
+		started: l.started, leafID: l.leafID, leafKeys: l.leafKeys, leafFirst: l.leafFirst,
+		last: l.last, pages: l.pages, entries: l.entries,
+	}
+	for _, lv := range l.levels {
+		s.levels = append(s.levels, levelState{lv.id, lv.firstKey, lv.children})
+	}
+	return s
+}
+
+// markDirty marks the pages the loader holds pinned dirty, so that a
+// flush writes them too: pages are only marked when unpinned.
+func (l *BulkLoader) markDirty() error {
+	ids := make([]manager.PageID, 0, len(l.levels)+1)
+	if l.started {
+		ids = append(ids, l.leafID)
+	}
+	for _, lv := range l.levels {
+		ids = append(ids, lv.id)
+	}
+	for _, id := range ids {
+		if _, err := l.bm.PinPage(id); err != nil {
+			return err
+		}
+		if err := l.bm.UnpinPage(id, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeBulkLoader returns a loader in the state s, pinning its pages
+// again.
+func resumeBulkLoader(bm *manager.BufferManager, o options, s loaderState) (*BulkLoader, error) {
+	l := newBulkLoader(bm, o)
+	l.last, l.pages, l.entries = s.last, s.pages, s.entries
+	if s.started {
+		data, err := bm.PinPage(s.leafID)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := btree.AsLeafPage(data)
+		if err != nil {
+			bm.UnpinPage(s.leafID, false)
+			return nil, err
+		}
+		// Entries and a next leaf added after the checkpoint may have
+		// reached the page
+		leaf.SetNumKeys(s.leafKeys)
+		leaf.SetNext(0)
+		l.leaf, l.leafID, l.leafKeys, l.leafFirst, l.started = leaf, s.leafID, s.leafKeys, s.leafFirst, true
+	}
+	for _, lv := range s.levels {
+		data, err := bm.PinPage(lv.id)
+		if err == nil {
+			var node btree.InternalPage
+			if node, err = btree.AsInternalPage(data); err == nil {
+				node.SetNumKeys(lv.children - 1)
+				l.levels = append(l.levels, &levelNode{node, lv.id, lv.firstKey, lv.children})
+				continue
+			}
+			bm.UnpinPage(lv.id, false)
+		}
+		l.release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// fail records err so that later calls return it.
+func (l *BulkLoader) fail(err error) error {
+	l.err = err
+	return err
+}
+
+// release unpins every page the loader still holds after a failure and
+// gives adopted leaves back their old entries and links.
+func (l *BulkLoader) release() {
+	if l.started {
+		l.bm.UnpinPage(l.leafID, true)
+		l.started = false
+	}
+	for _, lv := range l.levels {
+		if lv != nil {
+			l.bm.UnpinPage(lv.id, true)
+		}
+	}
+	l.levels = nil
+
+	for _, a := range l.adopted {
+		data, err := l.bm.PinPage(a.id)
+		if err != nil {
+			continue
+		}
+		leaf, err := btree.AsLeafPage(data)
+		if err != nil {
+			l.bm.UnpinPage(a.id, false)
+			continue
+		}
+		leaf.SetNumKeys(a.keys)
+		leaf.SetValue(a.keys-1, a.lastValue)
+		leaf.SetPrev(a.prev)
+		leaf.SetNext(a.next)
+		l.bm.UnpinPage(a.id, true)
+	}
+	l.adopted = nil
+}
@@ -0,0 +1,150 @@
+package loader
+
+import (
+	"btree"
+	"bytes"
+	"errors"
+	"manager"
+	"testing"
+)
+
+// sequential returns n entries of keys 0, step, 2*step, ... valued key+1.
+func sequential(n int, step uint64) []entry {
+	entries := make([]entry, n)
+	for i := range entries {
+		k := uint64(i) * step
+		entries[i] = entry{k, k + 1}
+	}
+	return entries
+}
+
+func newBytesReader(entries []entry) *bytes.Reader {
+	return bytes.NewReader(dataBytes(entries))
+}
+
+func bulkLoad(t *testing.T, entries []entry, opts ...Option) *btree.BTree {
+	t.Helper()
+	l := NewBulkLoader(manager.NewBufferManager(), opts...)
+	for _, e := range entries {
+		if err := l.Add(e.key, e.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bt, err := l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bt
+}
+
+func TestBulkLoader(t *testing.T) {
+	for _, n := range []int{0, 1, btree.MaxLeafEntries, btree.MaxLeafEntries + 1, 100000} {
+		entries := sequential(n, 3)
+		bt := bulkLoad(t, entries)
+		checkTree(t, bt, entries)
+		report, err := Verify(bt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := max(uint64((n+btree.MaxLeafEntries-1)/btree.MaxLeafEntries), 1); report.Leaves != want {
+			t.Errorf("%d entries in %d leaves, want %d full ones", n, report.Leaves, want)
+		}
+		for _, e := range entries[:min(n, 100)] {
+			if v, err := bt.Get(e.key); err != nil || v != e.value {
+				t.Fatalf("Get(%d) = %d, %v, want %d", e.key, v, err, e.value)
+			}
+		}
+		// The tree takes inserts after the load
+		if n > 0 {
+			if err := bt.Insert(1, 42); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := bt.Get(1); err != nil || v != 42 {
+				t.Errorf("Get of an inserted key = %d, %v", v, err)
+			}
+		}
+	}
+}
+
+func TestBulkLoaderUnsorted(t *testing.T) {
+	l := NewBulkLoader(manager.NewBufferManager())
+	if err := l.Add(5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Add(3, 0); !errors.Is(err, ErrUnsorted) {
+		t.Errorf("Add of a lower key: %v, want ErrUnsorted", err)
+	}
+	// The rejected entry is dropped and the load goes on
+	if err := l.Add(7, 1); err != nil {
+		t.Fatal(err)
+	}
+	bt, err := l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, []entry{{5, 0}, {7, 1}})
+	if err := l.Add(9, 0); err == nil {
+		t.Error("Add after Close succeeded")
+	}
+}
+
+func TestFillFactor(t *testing.T) {
+	const n = 50000
+	entries := sequential(n, 1)
+	for _, f := range []float64{0.9, 0.5, 1e-9} {
+		bt := bulkLoad(t, entries, WithFillFactor(f))
+		checkTree(t, bt, entries)
+		report, err := Verify(bt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leafCap := max(int(f*btree.MaxLeafEntries), 1)
+		if want := uint64((n + leafCap - 1) / leafCap); report.Leaves != want {
+			t.Errorf("fill factor %g: %d leaves, want %d of %d entries", f, report.Leaves, want, leafCap)
+		}
+	}
+	// Internal nodes are left room likewise: at a factor that leaves one
+	// entry per leaf and two children per node, the tree is binary
+	bt := bulkLoad(t, sequential(64, 1), WithFillFactor(1e-9))
+	if h, err := bt.Height(); err != nil || h != 7 {
+		t.Errorf("height of 64 single-entry leaves in binary nodes = %d, %v, want 7", h, err)
+	}
+}
+
+func TestDuplicatePolicies(t *testing.T) {
+	entries := []entry{{1, 10}, {2, 20}, {2, 21}, {2, 22}, {3, 30}, {3, 31}}
+	for _, tc := range []struct {
+		name   string
+		policy DuplicatePolicy
+		want   []entry
+	}{
+		{"default", nil, []entry{{1, 10}, {2, 22}, {3, 31}}},
+		{"KeepFirst", KeepFirst, []entry{{1, 10}, {2, 20}, {3, 30}}},
+		{"KeepLast", KeepLast, []entry{{1, 10}, {2, 22}, {3, 31}}},
+		{"Merge", Merge(func(kept, next uint64) uint64 { return kept + next }), []entry{{1, 10}, {2, 63}, {3, 61}}},
+	} {
+		var report LoadReport
+		bt, err := LoadReader(manager.NewBufferManager(), newBytesReader(entries), WithDuplicates(tc.policy), WithReport(&report))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		checkTree(t, bt, tc.want)
+		if report.DuplicatesResolved != 3 || report.Entries != 3 {
+			t.Errorf("%s: resolved %d duplicates into %d entries, want 3 and 3", tc.name, report.DuplicatesResolved, report.Entries)
+		}
+	}
+
+	_, err := LoadReader(manager.NewBufferManager(), newBytesReader(entries), WithDuplicates(Error))
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Error policy: %v, want ErrDuplicateKey", err)
+	}
+
+	// The policy sees the values in input order across spilled runs
+	many := randomEntries(20, 5000, 50)
+	bt, err := LoadReader(manager.NewBufferManager(), newBytesReader(many),
+		WithMemoryLimit(300*entrySize), WithTempDir(t.TempDir()), WithDuplicates(KeepFirst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, bt, resolve(many, true))
+}
@@ -0,0 +1,180 @@
+package loader
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Thrift compact protocol types, as they appear in field headers
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+// maxThriftDepth bounds the nesting of structs and collections skipped,
+// so that crafted metadata cannot exhaust the stack.
+const maxThriftDepth = 32
+
+var errThrift = errors.New("malformed Thrift metadata")
+
+// thriftReader decodes Thrift's compact protocol, which Parquet writes its
+// metadata in, from b, keeping the first error; after one every read
+// returns zero.
+type thriftReader struct {
+	b     []byte
+	pos   int
+	depth int
+	err   error
+}
+
+func (r *thriftReader) fail() {
+	if r.err == nil {
+		r.err = errThrift
+	}
+	r.pos = len(r.b)
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.b) {
+		r.fail()
+		return 0
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// varint reads a zigzag-encoded integer, as i16, i32 and i64 are written.
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) binary() []byte {
+	n := r.uvarint()
+	if n > uint64(len(r.b)-r.pos) {
+		r.fail()
+		return nil
+	}
+	r.pos += int(n)
+	return r.b[r.pos-int(n) : r.pos]
+}
+
+// readStruct calls field with the id and type of each field of a struct
+// up to its end. field must read the value, or skip it with skip; a
+// boolean's value is its type, thriftTrue or thriftFalse.
+func (r *thriftReader) readStruct(field func(id int16, typ byte)) {
+	if r.depth++; r.depth > maxThriftDepth {
+		r.fail()
+	}
+	defer func() { r.depth-- }()
+	var id int16
+	for r.err == nil {
+		h := r.byte()
+		typ := h & 0x0f
+		if typ == thriftStop {
+			return
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		field(id, typ)
+	}
+}
+
+// readList calls elem with the element type once for each element of a
+// list or set.
+func (r *thriftReader) readList(elem func(typ byte)) {
+	h := r.byte()
+	n := uint64(h >> 4)
+	if n == 15 {
+		n = r.uvarint()
+	}
+	// Every element takes at least a byte
+	if n > uint64(len(r.b)-r.pos) {
+		r.fail()
+		return
+	}
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		elem(h & 0x0f)
+	}
+}
+
+// skip reads past a value of type typ.
+func (r *thriftReader) skip(typ byte) {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		// Held in the field header
+	case thriftByte:
+		r.byte()
+	case thriftI16, thriftI32, thriftI64:
+		r.uvarint()
+	case thriftDouble:
+		if r.pos+8 > len(r.b) {
+			r.fail()
+		}
+		r.pos += 8
+	case thriftBinary:
+		r.binary()
+	case thriftList, thriftSet:
+		if r.depth++; r.depth > maxThriftDepth {
+			r.fail()
+		}
+		r.readList(r.skipElem)
+		r.depth--
+	case thriftMap:
+		n := r.uvarint()
+		if n == 0 {
+			return
+		}
+		if n > uint64(len(r.b)-r.pos) {
+			r.fail()
+			return
+		}
+		if r.depth++; r.depth > maxThriftDepth {
+			r.fail()
+		}
+		kv := r.byte()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			r.skipElem(kv >> 4)
+			r.skipElem(kv & 0x0f)
+		}
+		r.depth--
+	case thriftStruct:
+		r.readStruct(func(_ int16, typ byte) { r.skip(typ) })
+	default:
+		r.fail()
+	}
+}
+
+// skipElem reads past a collection element. Booleans in collections take
+// a byte each, unlike those in fields.
+func (r *thriftReader) skipElem(typ byte) {
+	if typ == thriftTrue || typ == thriftFalse {
+		r.byte()
+		return
+	}
+	r.skip(typ)
+}
@@ -0,0 +1,257 @@
+package loader
+
+import (
+	"btree"
+	"fmt"
+	"io"
+	"manager"
+	"strings"
+)
+
+// maxProblems is how many problems a VerifyReport lists; it counts all.
+const maxProblems = 100
+
+// maxVerifyDepth bounds the walk, so that a child pointer leading back up
+// the tree is reported instead of followed for ever.
+const maxVerifyDepth = 64
+
+// VerifyReport describes a tree checked by Verify.
+type VerifyReport struct {
+	Height        int
+	InternalNodes uint64
+	Leaves        uint64
+	Entries       uint64
+	EmptyLeaves   uint64   // leaves other than the root with no entries
+	SourceKeys    uint64   // input keys looked up, with WithVerify(true)
+	Problems      []string // the first maxProblems problems found
+	ProblemCount  int
+}
+
+// OK reports whether no problems were found.
+func (r *VerifyReport) OK() bool { return r.ProblemCount == 0 }
+
+func (r *VerifyReport) problem(format string, args ...any) {
+	r.ProblemCount++
+	if len(r.Problems) < maxProblems {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	}
+}
+
+// VerifyError is returned by a load with WithVerify whose tree fails
+// verification. The tree is returned too, for inspection.
+type VerifyError struct {
+	Report *VerifyReport
+}
+
+func (e *VerifyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "loader: tree failed verification with %d problems", e.Report.ProblemCount)
+	for _, p := range e.Report.Problems[:min(len(e.Report.Problems), 3)] {
+		b.WriteString("; ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// WithVerify makes LoadDataFile, LoadReader and LoadCSV check the tree
+// they build with Verify, and that it holds as many entries as were
+// loaded, failing with a *VerifyError if not. With checkSource they also
+// read the input a second time and look every key up; that needs the
+// input to be an io.Seeker, which files are.
+func WithVerify(checkSource bool) Option {
+	return func(o *options) {
+		o.verify = true
+		o.checkSource = checkSource
+	}
+}
+
+// Verify walks bt from its root and checks that every leaf is at the same
+// depth, that no page holds more entries than fit, that the keys of each
+// page are in strictly increasing order and within the range its parent's
+// separators give it, and that the leaf chain links every leaf in key
+// order in both directions. Leaves emptied by BTree.Delete are legal, and
+// only counted. It returns an error only if a page cannot be read; what it
+// finds is in the report.
+func Verify(bt *btree.BTree) (*VerifyReport, error) {
+	v := &verifier{bm: bt.BufferManager(), r: &VerifyReport{}, root: bt.RootPageID()}
+	if err := v.walk(v.root, 1, bounds{}); err != nil {
+		return nil, err
+	}
+	if v.haveLeaf && v.prevNext != 0 {
+		v.r.problem("last leaf %d links on to page %d", v.prevLeaf, v.prevNext)
+	}
+	return v.r, nil
+}
+
+// bounds is the key range [lo, hi) a subtree may hold; hasLo and hasHi
+// are false for an open end.
+type bounds struct {
+	lo, hi       uint64
+	hasLo, hasHi bool
+}
+
+func (b bounds) contains(key uint64) bool {
+	return (!b.hasLo || key >= b.lo) && (!b.hasHi || key < b.hi)
+}
+
+type verifier struct {
+	bm   *manager.BufferManager
+	r    *VerifyReport
+	root manager.PageID
+
+	// The last leaf visited, in key order. Page 0 of the default
+	// tablespace can be a leaf, so haveLeaf says whether there is one.
+	haveLeaf bool
+	prevLeaf manager.PageID
+	prevNext manager.PageID
+	lastKey  uint64
+	haveLast bool
+}
+
+func (v *verifier) walk(pageID manager.PageID, depth int, b bounds) error {
+	if depth > maxVerifyDepth {
+		v.r.problem("page %d: deeper than %d levels, the tree may have a cycle", pageID, maxVerifyDepth)
+		return nil
+	}
+	data, err := v.bm.PinPage(pageID)
+	if err != nil {
+		return err
+	}
+	switch t := manager.GetPageType(data); t {
+	case manager.PageTypeLeaf:
+		leaf, err := btree.AsLeafPage(data)
+		if err != nil {
+			v.r.problem("leaf %d: %v", pageID, err)
+		} else {
+			v.leaf(pageID, leaf, depth, b)
+		}
+		v.bm.UnpinPage(pageID, false)
+		return nil
+	case manager.PageTypeInternal:
+		node, err := btree.AsInternalPage(data)
+		if err != nil {
+			v.bm.UnpinPage(pageID, false)
+			v.r.problem("internal node %d: %v", pageID, err)
+			return nil
+		}
+		children, ranges := v.internal(pageID, node, b)
+		v.bm.UnpinPage(pageID, false)
+		for i, child := range children {
+			if err := v.walk(child, depth+1, ranges[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		v.bm.UnpinPage(pageID, false)
+		v.r.problem("page %d: expected a tree page, got %v", pageID, t)
+		return nil
+	}
+}
+
+// internal checks an internal node and returns its children with the key
+// range of each.
+func (v *verifier) internal(pageID manager.PageID, node btree.InternalPage, b bounds) ([]manager.PageID, []bounds) {
+	v.r.InternalNodes++
+	n := node.NumKeys()
+	children := make([]manager.PageID, n+1)
+	ranges := make([]bounds, n+1)
+	lo := b
+	for i := 0; i <= n; i++ {
+		children[i] = node.Child(i)
+		r := lo
+		if i < n {
+			key := node.Key(i)
+			if !b.contains(key) {
+				v.r.problem("internal node %d: separator %d outside its range", pageID, key)
+			}
+			if i > 0 && key <= node.Key(i-1) {
+				v.r.problem("internal node %d: separators out of order at %d", pageID, i)
+			}
+			r.hi, r.hasHi = key, true
+			lo.lo, lo.hasLo = key, true
+		}
+		ranges[i] = r
+	}
+	return children, ranges
+}
+
+func (v *verifier) leaf(pageID manager.PageID, leaf btree.LeafPage, depth int, b bounds) {
+	v.r.Leaves++
+	switch {
+	case v.r.Height == 0:
+		v.r.Height = depth
+	case depth != v.r.Height:
+		v.r.problem("leaf %d: at depth %d, other leaves at %d", pageID, depth, v.r.Height)
+	}
+
+	// Chain links
+	if !v.haveLeaf {
+		if prev := leaf.Prev(); prev != 0 {
+			v.r.problem("first leaf %d links back to page %d", pageID, prev)
+		}
+	} else {
+		if v.prevNext != pageID {
+			v.r.problem("leaf %d links on to page %d, not to the next leaf %d", v.prevLeaf, v.prevNext, pageID)
+		}
+		if prev := leaf.Prev(); prev != v.prevLeaf {
+			v.r.problem("leaf %d links back to page %d, not to the leaf before it %d", pageID, prev, v.prevLeaf)
+		}
+	}
+	v.haveLeaf, v.prevLeaf, v.prevNext = true, pageID, leaf.Next()
+
+	n := leaf.NumKeys()
+	if n == 0 && pageID != v.root {
+		v.r.EmptyLeaves++
+	}
+	v.r.Entries += uint64(n)
+	for i := range n {
+		key := leaf.Key(i)
+		if v.haveLast && key <= v.lastKey {
+			v.r.problem("leaf %d: key %d at %d not above the key before it, %d", pageID, key, i, v.lastKey)
+		}
+		if !b.contains(key) {
+			v.r.problem("leaf %d: key %d outside the range of its parent's separators", pageID, key)
+		}
+		v.lastKey, v.haveLast = key, true
+	}
+}
+
+// verifyLoad verifies a tree just loaded with entries entries, from open
+// if o.checkSource.
+func verifyLoad(bt *btree.BTree, entries uint64, open source, o options) error {
+	report, err := Verify(bt)
+	if err != nil {
+		return err
+	}
+	if report.Entries != entries {
+		report.problem("tree holds %d entries, %d were loaded", report.Entries, entries)
+	}
+	if report.EmptyLeaves > 0 {
+		report.problem("%d leaves are empty", report.EmptyLeaves)
+	}
+	if o.checkSource {
+		read, release, err := open()
+		if err != nil {
+			return err
+		}
+		defer release()
+		for {
+			e, err := read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			report.SourceKeys++
+			if _, err := bt.Get(e.key); err != nil {
+				report.problem("key %d of the input not found: %v", e.key, err)
+			}
+		}
+	}
+	if !report.OK() {
+		return &VerifyError{Report: report}
+	}
+	return nil
+}
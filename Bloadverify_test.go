@@ -0,0 +1,156 @@
+package loader
+
+import (
+	"btree"
+	"errors"
+	"io"
+	"manager"
+	"strings"
+	"testing"
+)
+
+// editPage pins pageID of bt, calls edit with its data and unpins it
+// dirty.
+func editPage(t *testing.T, bt *btree.BTree, pageID manager.PageID, edit func(data *[manager.PageSize]byte)) {
+	t.Helper()
+	bm := bt.BufferManager()
+	data, err := bm.PinPage(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(data)
+	bm.UnpinPage(pageID, true)
+}
+
+// leftmost returns the pages on the path from bt's root to its first
+// leaf.
+func leftmost(t *testing.T, bt *btree.BTree) []manager.PageID {
+	t.Helper()
+	path := []manager.PageID{bt.RootPageID()}
+	for {
+		leaf := true
+		editPage(t, bt, path[len(path)-1], func(data *[manager.PageSize]byte) {
+			if node, err := btree.AsInternalPage(data); err == nil {
+				path = append(path, node.Child(0))
+				leaf = false
+			}
+		})
+		if leaf {
+			return path
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const n = 100000
+	bt := bulkLoad(t, sequential(n, 2))
+	report, err := Verify(bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := bt.Height()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaves := uint64((n + btree.MaxLeafEntries - 1) / btree.MaxLeafEntries)
+	if !report.OK() || report.Height != h || report.Entries != n || report.Leaves != leaves || report.InternalNodes == 0 {
+		t.Errorf("report of a sound tree %+v, want height %d and %d leaves", report, h, leaves)
+	}
+
+	// Emptied leaves are counted, not faulted
+	for k := range uint64(btree.MaxLeafEntries) {
+		if _, err := bt.Delete(2 * k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if report, err := Verify(bt); err != nil || !report.OK() || report.EmptyLeaves != 1 {
+		t.Errorf("report after a leaf was emptied %+v, %v", report, err)
+	}
+}
+
+func TestVerifyFindsDamage(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		damage func(t *testing.T, bt *btree.BTree, path []manager.PageID)
+		want   string
+	}{
+		{"keys out of order", func(t *testing.T, bt *btree.BTree, path []manager.PageID) {
+			editPage(t, bt, path[len(path)-1], func(data *[manager.PageSize]byte) {
+				leaf, _ := btree.AsLeafPage(data)
+				leaf.SetEntry(3, leaf.Key(1), 0)
+			})
+		}, "not above the key before it"},
+		{"key outside its range", func(t *testing.T, bt *btree.BTree, path []manager.PageID) {
+			editPage(t, bt, path[len(path)-1], func(data *[manager.PageSize]byte) {
+				leaf, _ := btree.AsLeafPage(data)
+				leaf.SetEntry(leaf.NumKeys()-1, 1<<40, 0)
+			})
+		}, "outside the range of its parent's separators"},
+		{"separators out of order", func(t *testing.T, bt *btree.BTree, path []manager.PageID) {
+			editPage(t, bt, path[len(path)-2], func(data *[manager.PageSize]byte) {
+				node, _ := btree.AsInternalPage(data)
+				node.SetKey(1, node.Key(0))
+			})
+		}, "separators out of order"},
+		{"broken chain", func(t *testing.T, bt *btree.BTree, path []manager.PageID) {
+			editPage(t, bt, path[len(path)-1], func(data *[manager.PageSize]byte) {
+				leaf, _ := btree.AsLeafPage(data)
+				leaf.SetNext(0)
+			})
+		}, "not to the next leaf"},
+		{"first leaf links back", func(t *testing.T, bt *btree.BTree, path []manager.PageID) {
+			editPage(t, bt, path[len(path)-1], func(data *[manager.PageSize]byte) {
+				leaf, _ := btree.AsLeafPage(data)
+				leaf.SetPrev(path[0])
+			})
+		}, "first leaf"},
+		{"cycle", func(t *testing.T, bt *btree.BTree, path []manager.PageID) {
+			editPage(t, bt, path[len(path)-2], func(data *[manager.PageSize]byte) {
+				node, _ := btree.AsInternalPage(data)
+				node.SetChild(0, path[0])
+			})
+		}, "may have a cycle"},
+	} {
+		// Sparse pages, for a tree a few levels deep
+		bt := bulkLoad(t, sequential(20000, 2), WithFillFactor(0.1))
+		path := leftmost(t, bt)
+		if len(path) < 3 {
+			t.Fatalf("tree of height %d, want 3 or more", len(path))
+		}
+		tc.damage(t, bt, path)
+		report, err := Verify(bt)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		found := false
+		for _, p := range report.Problems {
+			found = found || strings.Contains(p, tc.want)
+		}
+		if report.OK() || !found || len(report.Problems) > maxProblems {
+			t.Errorf("%s: problems %q, want one with %q", tc.name, report.Problems, tc.want)
+		}
+	}
+}
+
+func TestVerifyError(t *testing.T) {
+	entries := randomEntries(60, 20000, 1<<30)
+	var report LoadReport
+	_, err := LoadReader(manager.NewBufferManager(), newBytesReader(entries), WithVerify(true), WithReport(&report))
+	if err != nil || report.VerifyTime == 0 {
+		t.Fatalf("verified load: %v, verify time %v", err, report.VerifyTime)
+	}
+	// Reading the input again needs a seeker
+	_, err = LoadReader(manager.NewBufferManager(), struct{ io.Reader }{newBytesReader(entries)}, WithVerify(true))
+	if !errors.Is(err, errNotRewindable) {
+		t.Errorf("verifying against a pipe: %v, want errNotRewindable", err)
+	}
+
+	r := &VerifyReport{}
+	for i := range 5 {
+		r.problem("problem %d", i)
+	}
+	err = &VerifyError{Report: r}
+	if want := "loader: tree failed verification with 5 problems; problem 0; problem 1; problem 2"; err.Error() != want {
+		t.Errorf("VerifyError = %q, want %q", err, want)
+	}
+}
@@ -4,105 +4,260 @@ import (
 	"encoding/binary"
 	"errors"
 	"sync"
+	"sync/atomic"
 )
 
 const (
 	PageSize  = 4096 // 4KB pages
-	MaxFrames = 100  // Buffer pool size
+	MaxFrames = 100  // Default buffer pool size, see Resize
 )
 
 type PageID uint64
 
 type bufferPage struct {
-	pageID   PageID
-	data     [PageSize]byte
-	isDirty  bool
-	pinCount int
-	refbit   bool
+	pageID  PageID
+	data    *[PageSize]byte // points into a frame slab, see Bslab.go
+	isDirty bool
+	pins    atomic.Int32 // see Bpagetable.go for the locking protocol
+	refBit  atomic.Bool
+	valid   bool
+	pageLSN LSN
+	recLSN  LSN           // first logged change since written back, see Bcheckpoint.go
+	loading chan struct{} // non-nil while a Prefetch read is in flight
+	loadErr error
+	scan    bool // pinned only by sequential scans, see PinPageHint
 }
 
 type BufferManager struct {
-	disk       map[PageID]*[PageSize]byte
-	frames     map[PageID]*bufferPage
-	pageTable  map[PageID]int
-	clockHand  int
-	mu         sync.Mutex
-	nextPageID PageID
+	spaces      *spaceSet
+	frames      []*bufferPage
+	pageTable   map[PageID]int
+	fast        sync.Map // PageID -> *bufferPage, read without bm.mu
+	fastPath    atomic.Bool
+	clockHand   int
+	mu          sync.Mutex
+	wal         LogFlusher
+	holdDirty   bool // see HoldDirtyPages
+	io          *ioPool
+	scanVictims []int
+	evictHooks  []EvictionHook
+	flushHooks  []EvictionHook
+	stats       bufferCounters
+	pinTrace    map[PageID][]pinRecord // nil unless pin tracking is enabled
+	trace       *tracer
+	admission   *admission // nil unless EnableAdmission
+	pendingMu   sync.Mutex
+	pending     map[PageID]*pendingWrite
+	asyncErr    error
+	hugePages   bool
 }
 
 func NewBufferManager() *BufferManager {
+	return newBufferManager(newSpaceSet(), MaxFrames)
+}
+
+func newBufferManager(spaces *spaceSet, numFrames int) *BufferManager {
 	bm := &BufferManager{
-		disk:      make(map[PageID]*[PageSize]byte),
-		frames:    make(map[PageID]*bufferPage),
+		spaces:    spaces,
 		pageTable: make(map[PageID]int),
+		pending:   make(map[PageID]*pendingWrite),
 	}
-
-	for i := 0; i < MaxFrames; i++ {
-		bm.frames[i] = &bufferPage{}
-	}
+	bm.frames = bm.newFrames(numFrames)
+	bm.fastPath.Store(true)
 
 	return bm
 }
 
-func (bm *BufferManager) PinPage(pageID PageID) (*BufferPage, error) {
+func (bm *BufferManager) PinPage(pageID PageID) (*[PageSize]byte, error) {
+	return bm.pinPage(pageID, PinNormal)
+}
+
+func (bm *BufferManager) pinPage(pageID PageID, hint PinHint) (*[PageSize]byte, error) {
+	if data, ok := bm.tryFastPin(pageID, hint); ok {
+		return data, nil
+	}
+
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
+	bm.traceEvent(TracePin, pageID, false)
+	bm.recordAccess(pageID)
 	if idx, exists := bm.pageTable[pageID]; exists {
 		frame := bm.frames[idx]
-		frame.pinCount++
-		frame.refBit = true
-		return frame, nil
+		frame.pins.Add(1)
+		bm.stats.hits.Add(1)
+		if hint == PinNormal {
+			frame.refBit.Store(true)
+			frame.scan = false
+		}
+		if err := bm.waitLoaded(frame); err != nil {
+			return nil, err
+		}
+		bm.publish(frame)
+		bm.recordPin(pageID)
+		return frame.data, nil
 	}
 
-	data, exists := bm.disk[pageID]
+	ts, exists := bm.spaces.get(pageID.FileID())
 	if !exists {
+		return nil, errors.New("tablespace does not exist")
+	}
+	if pageID.PageNo() >= ts.pageCount() {
 		return nil, errors.New("page does not exist")
 	}
 
-	victimIdx, err := bm.findVictim()
+	victimIdx, victim, err := bm.claimFrame()
 	if err != nil {
-		return nil, errors.New("buffer full")
+		return nil, err
 	}
-	victim := bm.frames[victimIdx]
-
-	if victim.isDirty {
-		bm.disk[victim.pageID] = &victim.data
+	bm.stats.misses.Add(1)
+	if hint == PinNormal && !bm.admit(pageID) {
+		hint = PinSequential
 	}
 
-	*victim = BufferPage{
-		pageID:   pageID,
-		data:     *data,
-		pinCount: 1,
-		refBit:   true,
+	victim.reuse(pageID)
+	victim.refBit.Store(hint == PinNormal)
+	victim.scan = hint == PinSequential
+	if !bm.readPending(pageID, victim.data) {
+		if err := ts.readPage(pageID.PageNo(), victim.data); err != nil {
+			victim.pins.Store(0)
+			return nil, err
+		}
+		bm.stats.pagesRead.Add(1)
 	}
+	victim.pageLSN = GetPageLSN(victim.data)
+	victim.valid = true
+	victim.pins.Store(1)
 
-	delete(bm.pageTable, victim.pageID)
 	bm.pageTable[pageID] = victimIdx
-	return victim, nil
+	bm.publish(victim)
+	bm.recordPin(pageID)
+	return victim.data, nil
 }
 
 func (bm *BufferManager) findVictim() (int, error) {
-	for i := 0; i < 2*MaxFrames; i++ {
-		idx := (bm.clockHand + i) % MaxFrames
+	if idx, ok := bm.popScanVictim(); ok {
+		return idx, nil
+	}
+
+	numFrames := len(bm.frames)
+	for i := 0; i < 2*numFrames; i++ {
+		idx := (bm.clockHand + i) % numFrames
 		frame := bm.frames[idx]
 
-		if frame.pinCount > 0 {
+		if frame.pinned() {
+			continue
+		}
+
+		if frame.refBit.Swap(false) {
+			continue
+		}
+
+		// Log-before-data: the page's log records are not durable yet,
+		// or the page is held until its owner writes it back
+		if !bm.evictable(frame) {
 			continue
 		}
 
-		if frame.refBit {
-			frame.refBit = false
+		// Fails if a lock-free pin got in first
+		if !frame.tryLock() {
 			continue
 		}
 
-		bm.clockHand = (idx + 1) % MaxFrames
+		bm.clockHand = (idx + 1) % numFrames
+		return idx, nil
+	}
+	if idx, ok := bm.unloggedVictim(); ok {
+		return idx, nil
+	}
+	if idx, ok := bm.growForHeld(); ok {
 		return idx, nil
 	}
 	return 0, errors.New("all pages pinned")
 }
 
+// unloggedVictim returns, locked, the unpinned dirty frame with the lowest
+// pageLSN among those the sweep passed over because their log records are
+// not durable yet. Its write-back forces the log first, and the lowest
+// pageLSN forces the least of it. bm.mu must be held.
+func (bm *BufferManager) unloggedVictim() (int, bool) {
+	if bm.wal == nil || bm.holdDirty {
+		return 0, false
+	}
+	best := -1
+	for idx, frame := range bm.frames {
+		if frame.valid && frame.isDirty && !frame.pinned() &&
+			(best < 0 || frame.pageLSN < bm.frames[best].pageLSN) {
+			best = idx
+		}
+	}
+	if best < 0 || !bm.frames[best].tryLock() {
+		return 0, false
+	}
+	return best, true
+}
+
+// claimFrame picks a victim frame, writes it back if dirty and removes it
+// from the page table so the caller can reuse it. The frame is returned
+// locked; the caller unlocks it by storing its new pin count.
+func (bm *BufferManager) claimFrame() (int, *bufferPage, error) {
+	victimIdx, err := bm.findVictim()
+	if err != nil {
+		return 0, nil, errors.New("buffer full")
+	}
+	victim := bm.frames[victimIdx]
+
+	bm.noteVictim(victim)
+	if victim.valid {
+		dirty := victim.isDirty
+		if dirty {
+			writeBack := bm.writeBack
+			if bm.io != nil {
+				writeBack = bm.writeBackAsync
+			}
+			if err := writeBack(victim); err != nil {
+				victim.pins.Store(0)
+				return 0, nil, err
+			}
+		}
+		bm.unmapPage(victim.pageID)
+		victim.valid = false
+		bm.stats.evictions.Add(1)
+		bm.notifyEvict(victim.pageID, dirty)
+	}
+	return victimIdx, victim, nil
+}
+
+func (bm *BufferManager) writeBack(frame *bufferPage) error {
+	if err := bm.forceLog(frame); err != nil {
+		return err
+	}
+	ts, exists := bm.spaces.get(frame.pageID.FileID())
+	if !exists {
+		return errors.New("tablespace does not exist")
+	}
+	if bm.io != nil {
+		// Go through the pending-write queue so an older asynchronous
+		// write-back of the same page cannot land after this one
+		if err := bm.queueWrite(ts, frame)(); err != nil {
+			return err
+		}
+	} else {
+		if err := ts.writePage(frame.pageID.PageNo(), frame.data); err != nil {
+			return err
+		}
+		bm.stats.pagesWritten.Add(1)
+	}
+	frame.markClean()
+	bm.notifyFlush(frame.pageID)
+	return nil
+}
+
 func (bm *BufferManager) UnpinPage(pageID PageID, isDirty bool) error {
+	if !isDirty && bm.tryFastUnpin(pageID) {
+		return nil
+	}
+
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
@@ -111,13 +266,26 @@ func (bm *BufferManager) UnpinPage(pageID PageID, isDirty bool) error {
 		return errors.New("page not in buffer")
 	}
 
+	// A dirty unpin of a read-only page still releases the pin
+	var err error
+	if isDirty {
+		if err = bm.checkWritable(pageID.FileID()); err != nil {
+			isDirty = false
+		}
+	}
+
 	frame := bm.frames[idx]
-	frame.pinCount--
-	if frame.pinCount < 0 {
+	pins := frame.pins.Add(-1)
+	if pins < 0 {
 		panic("pin count negative")
 	}
 	frame.isDirty = frame.isDirty || isDirty
-	return nil
+	bm.releasePin(pageID)
+	bm.traceEvent(TraceUnpin, pageID, isDirty)
+	if frame.scan && pins == 0 {
+		bm.queueScanVictim(idx)
+	}
+	return err
 }
 
 func (bm *BufferManager) FlushPage(pageID PageID) error {
@@ -128,40 +296,93 @@ func (bm *BufferManager) FlushPage(pageID PageID) error {
 		frame := bm.frames[idx]
 		if frame.isDirty {
 			// Write to disk
-			bm.disk[pageID] = &frame.data
-			frame.isDirty = false
+			return bm.writeBack(frame)
 		}
 	}
 	return nil
 }
 
+// NewPage allocates a page in the default tablespace.
 func (bm *BufferManager) NewPage() (PageID, *[PageSize]byte, error) {
+	return bm.NewPageIn(DefaultFileID)
+}
+
+// NewPageIn allocates a page in the given tablespace and returns it pinned.
+func (bm *BufferManager) NewPageIn(fileID FileID) (PageID, *[PageSize]byte, error) {
+	ts, exists := bm.spaces.get(fileID)
+	if !exists {
+		return 0, nil, errors.New("tablespace does not exist")
+	}
+	if ts.readOnly {
+		return 0, nil, ErrReadOnly
+	}
+
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
-	pageID := bm.nextPageID
-	bm.nextPageID++
-
-	victimIdx, err := bm.findVictim()
+	victimIdx, victim, err := bm.claimFrame()
 	if err != nil {
-		return 0, nil, errors.New("buffer full")
+		return 0, nil, err
 	}
-	victim := bm.frames[victimIdx]
+	pageNo, err := ts.allocate()
+	if err != nil {
+		victim.pins.Store(0)
+		return 0, nil, err
+	}
+	return bm.installNewPage(victimIdx, victim, MakePageID(fileID, pageNo)), victim.data, nil
+}
+
+// installNewPage sets up a claimed frame for a freshly allocated page.
+func (bm *BufferManager) installNewPage(victimIdx int, victim *bufferPage, pageID PageID) PageID {
+	bm.stats.allocated.Add(1)
+	victim.reuse(pageID)
+	clear(victim.data[:])
+	victim.isDirty = true
+	victim.refBit.Store(true)
+	victim.valid = true
+	victim.pins.Store(1)
+
+	bm.pageTable[pageID] = victimIdx
+	bm.publish(victim)
+	bm.recordPin(pageID)
+	bm.traceEvent(TraceNew, pageID, true)
+	return pageID
+}
 
-	if victim.isDirty {
-		bm.disk[victim.pageID] = &victim.data
+// Close writes back all dirty pages and closes every tablespace file.
+func (bm *BufferManager) Close() error {
+	firstErr := bm.drainAndFlush()
+	if err := bm.spaces.closeAll(); err != nil && firstErr == nil {
+		firstErr = err
 	}
+	return firstErr
+}
 
-	*victim = BufferPage{
-		pageID:   pageID,
-		pinCount: 1,
-		isDirty:  true,
-		refBit:   true,
+// Discard closes every tablespace like Close, but drops the dirty pages
+// instead of writing them back, for an owner that holds them (see
+// HoldDirtyPages) and has to give up on them after a failure.
+func (bm *BufferManager) Discard() error {
+	bm.mu.Lock()
+	for _, frame := range bm.frames {
+		if frame.valid && frame.loading == nil {
+			frame.markClean()
+		}
 	}
+	bm.mu.Unlock()
+	return bm.Close()
+}
 
-	delete(bm.pageTable, victim.pageID)
-	bm.pageTable[pageID] = victimIdx
-	return pageID, &victim.data, nil
+// drainAndFlush stops the I/O workers and writes back every dirty page.
+func (bm *BufferManager) drainAndFlush() error {
+	firstErr := bm.StopIOWorkers()
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if err := bm.flushDirty(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
 }
 
 func Sizzle(pageID PageID) [8]byte {
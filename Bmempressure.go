@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"errors"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+)
+
+// Watermarks as fractions of the soft limit: above pressureHigh the pool
+// shrinks until the process is back at pressureTarget, below pressureLow
+// it grows back towards its configured size.
+const (
+	pressureHigh   = 0.90
+	pressureTarget = 0.80
+	pressureLow    = 0.70
+)
+
+// MemoryPressureOptions configures EnableMemoryPressure.
+type MemoryPressureOptions struct {
+	// SoftLimit is the process memory, in bytes, the pool tries to stay
+	// under. Zero uses the runtime's limit (GOMEMLIMIT).
+	SoftLimit uint64
+	Interval  time.Duration // how often memory is sampled, default 1s
+	MinFrames int           // the pool never shrinks below this, default 1
+	MaxFrames int           // the pool regrows up to this, default its current size
+}
+
+var memorySamples = []metrics.Sample{
+	{Name: "/memory/classes/total:bytes"},
+	{Name: "/memory/classes/heap/released:bytes"},
+}
+
+// memoryInUse returns the memory the runtime holds from the OS, counted
+// the way GOMEMLIMIT counts it.
+var memoryInUse = func() uint64 {
+	samples := make([]metrics.Sample, len(memorySamples))
+	copy(samples, memorySamples)
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// EnableMemoryPressure makes the pool give frames back when the process
+// approaches its memory limit and take them again once memory frees up, so
+// the buffer manager can share a process with other caches without risking
+// an OOM. The returned function stops the monitor; the pool keeps the size
+// it has when the function returns.
+func (bm *BufferManager) EnableMemoryPressure(opts MemoryPressureOptions) (stop func(), err error) {
+	if opts.SoftLimit == 0 {
+		limit := debug.SetMemoryLimit(-1)
+		if limit == math.MaxInt64 {
+			return nil, errors.New("no soft memory limit set")
+		}
+		opts.SoftLimit = uint64(limit)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.MinFrames <= 0 {
+		opts.MinFrames = 1
+	}
+	if opts.MaxFrames <= 0 {
+		opts.MaxFrames = bm.Frames()
+	}
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bm.adjustToMemory(opts, memoryInUse())
+			case <-done:
+				return
+			}
+		}
+	}()
+	// Waiting for the monitor to exit keeps a resize that was already
+	// under way from landing after stop returns
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
+
+// adjustToMemory resizes the pool for the given memory use.
+func (bm *BufferManager) adjustToMemory(opts MemoryPressureOptions, used uint64) {
+	limit := float64(opts.SoftLimit)
+	frames := bm.Frames()
+
+	switch {
+	case float64(used) > limit*pressureHigh && frames > opts.MinFrames:
+		excess := int((float64(used) - limit*pressureTarget) / PageSize)
+		newFrames := max(frames-excess, opts.MinFrames)
+		// Shrinking fails while too many pages are pinned; retry next tick
+		if bm.Resize(newFrames) == nil {
+			debug.FreeOSMemory()
+		}
+
+	case float64(used) < limit*pressureLow && frames < opts.MaxFrames:
+		// Regrow by half the headroom at a time, so a burst of other
+		// allocations does not immediately push us over again
+		headroom := int((limit*pressureTarget - float64(used)) / PageSize / 2)
+		bm.Resize(min(frames+max(headroom, 1), opts.MaxFrames))
+	}
+}
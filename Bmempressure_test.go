@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdjustToMemory(t *testing.T) {
+	const limit = 1000 * PageSize
+	opts := MemoryPressureOptions{SoftLimit: limit, MinFrames: 10, MaxFrames: 100}
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 100})
+	ids := fillPages(t, bm, DefaultFileID, 100)
+
+	for _, tc := range []struct {
+		name       string
+		used       uint64
+		frames     int
+		wantFrames int
+	}{
+		// Down to the target, 150 pages under the use
+		{"over the high watermark", 950 * PageSize, 200, 50},
+		{"not below the minimum", 950 * PageSize, 100, 10},
+		{"between the watermarks", 850 * PageSize, 50, 50},
+		{"under the high watermark", 890 * PageSize, 50, 50},
+		// Up by half the 300 pages of headroom to the target
+		{"under the low watermark", 500 * PageSize, 10, 100},
+		{"half the headroom", 650 * PageSize, 10, 85},
+		{"not above the maximum", 500 * PageSize, 100, 100},
+	} {
+		if err := bm.Resize(tc.frames); err != nil {
+			t.Fatal(err)
+		}
+		bm.adjustToMemory(opts, tc.used)
+		if got := bm.Frames(); got != tc.wantFrames {
+			t.Errorf("%s: %d frames became %d, want %d", tc.name, tc.frames, got, tc.wantFrames)
+		}
+	}
+	checkPages(t, bm, ids)
+
+	// Pins keep the pool from shrinking until they go
+	bm.Resize(40)
+	for _, pageID := range ids[:30] {
+		bm.PinPage(pageID)
+	}
+	bm.adjustToMemory(opts, 990*PageSize)
+	if got := bm.Frames(); got != 40 {
+		t.Errorf("shrink past 30 pinned pages left %d frames, want 40", got)
+	}
+	for _, pageID := range ids[:30] {
+		bm.UnpinPage(pageID, false)
+	}
+	bm.adjustToMemory(opts, 990*PageSize)
+	if got := bm.Frames(); got != 10 {
+		t.Errorf("retried shrink left %d frames, want 10", got)
+	}
+}
+
+func TestEnableMemoryPressure(t *testing.T) {
+	if used := memoryInUse(); used == 0 {
+		t.Error("memoryInUse() = 0")
+	}
+	if limit := debug.SetMemoryLimit(-1); limit == 1<<63-1 {
+		bm := NewBufferManager()
+		if _, err := bm.EnableMemoryPressure(MemoryPressureOptions{}); err == nil {
+			t.Error("EnableMemoryPressure without any limit succeeded")
+		}
+	}
+
+	var used atomic.Uint64
+	used.Store(2000 * PageSize)
+	defer func(f func() uint64) { memoryInUse = f }(memoryInUse)
+	memoryInUse = used.Load
+
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 64})
+	stop, err := bm.EnableMemoryPressure(MemoryPressureOptions{SoftLimit: 1000 * PageSize, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFrames := func(want int) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); bm.Frames() != want; {
+			if time.Now().After(deadline) {
+				t.Fatalf("pool stayed at %d frames, want %d", bm.Frames(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// Down to the default minimum of a frame, then back up to the size
+	// the pool had
+	waitFrames(1)
+	used.Store(0)
+	waitFrames(64)
+	stop()
+	used.Store(2000 * PageSize)
+	time.Sleep(20 * time.Millisecond)
+	if got := bm.Frames(); got != 64 {
+		t.Errorf("pool resized to %d frames after the monitor stopped", got)
+	}
+}
@@ -0,0 +1,197 @@
+package manager
+
+import "errors"
+
+// batchAllocator is implemented by backends that can reserve a range of
+// page numbers, and grow their storage for it, in one step.
+type batchAllocator interface {
+	AllocateN(n int) (first uint64, err error)
+}
+
+// allocateN reserves n consecutive page numbers.
+func (ts *tablespace) allocateN(n int) (uint64, error) {
+	if ba, ok := ts.backend.(batchAllocator); ok {
+		return ba.AllocateN(n)
+	}
+	first, err := ts.backend.Allocate()
+	if err != nil {
+		return 0, err
+	}
+	for i := 1; i < n; i++ {
+		pageNo, err := ts.backend.Allocate()
+		if err != nil {
+			return 0, err
+		}
+		if pageNo != first+uint64(i) {
+			return 0, errors.New("backend allocated non-consecutive pages")
+		}
+	}
+	return first, nil
+}
+
+func (mb *MemoryBackend) AllocateN(n int) (uint64, error) {
+	return mb.nextPageNo.Add(uint64(n)) - uint64(n), nil
+}
+
+// AllocateN reserves n pages and extends the file over them at once, by
+// writing zeroes to the last of them. Truncating to the new size instead
+// could shrink the file under a concurrent AllocateN or write of a page
+// further on. A compressed file only grows as pages are written to it.
+func (fb *FileBackend) AllocateN(n int) (uint64, error) {
+	first := fb.nextPageNo.Add(uint64(n)) - uint64(n)
+	if fb.extents != nil {
+		return first, nil
+	}
+	// Nobody else has the pages yet, so the write cannot clobber one.
+	// Aligned, it suits direct I/O too.
+	zero := alignedPool.Get().([]byte)
+	defer alignedPool.Put(zero)
+	clear(zero)
+	if _, err := fb.file.WriteAt(zero, int64(first+uint64(n)-1)*fb.slotSize); err != nil {
+		return 0, err
+	}
+	return first, nil
+}
+
+func (ob *ObjectBackend) AllocateN(n int) (uint64, error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	first := ob.pageCount
+	ob.pageCount += uint64(n)
+	ob.metaDirty = true
+	return first, nil
+}
+
+// NewPages allocates n consecutive pages in the default tablespace.
+func (bm *BufferManager) NewPages(n int) ([]PageID, []*[PageSize]byte, error) {
+	return bm.NewPagesIn(DefaultFileID, n)
+}
+
+// NewPagesIn allocates n consecutive pages in the given tablespace with a
+// single lock acquisition and a single storage extension, and returns them
+// all pinned. It fails without allocating anything if fewer than n frames
+// can be freed.
+func (bm *BufferManager) NewPagesIn(fileID FileID, n int) ([]PageID, []*[PageSize]byte, error) {
+	if n <= 0 {
+		return nil, nil, errors.New("page count must be positive")
+	}
+	ts, exists := bm.spaces.get(fileID)
+	if !exists {
+		return nil, nil, errors.New("tablespace does not exist")
+	}
+	if ts.readOnly {
+		return nil, nil, ErrReadOnly
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	victims, err := bm.claimFrames(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	first, err := ts.allocateN(n)
+	if err != nil {
+		bm.releaseFrames(victims)
+		return nil, nil, err
+	}
+
+	ids := make([]PageID, n)
+	pages := make([]*[PageSize]byte, n)
+	for i, victimIdx := range victims {
+		victim := bm.frames[victimIdx]
+		ids[i] = bm.installNewPage(victimIdx, victim, MakePageID(fileID, first+uint64(i)))
+		pages[i] = victim.data
+	}
+	return ids, pages, nil
+}
+
+// claimFrames claims n frames, or none.
+func (bm *BufferManager) claimFrames(n int) ([]int, error) {
+	victims := make([]int, 0, n)
+	for len(victims) < n {
+		victimIdx, _, err := bm.claimFrame()
+		if err != nil {
+			bm.releaseFrames(victims)
+			return nil, err
+		}
+		victims = append(victims, victimIdx)
+	}
+	return victims, nil
+}
+
+// releaseFrames unlocks claimed frames that end up unused.
+func (bm *BufferManager) releaseFrames(victims []int) {
+	for _, victimIdx := range victims {
+		bm.frames[victimIdx].pins.Store(0)
+	}
+}
+
+// NewPages allocates n consecutive pages in the default tablespace, see
+// BufferManager.NewPagesIn. The pages are spread over the partitions, each
+// of which is locked once.
+func (bpm *BufferPoolManager) NewPages(n int) ([]PageID, []*[PageSize]byte, error) {
+	return bpm.NewPagesIn(DefaultFileID, n)
+}
+
+// NewPagesIn allocates the page numbers first and then lets each owning
+// partition cache its share. If a partition has no free frames, the pages
+// already handed out are unpinned again and the error is returned; the
+// page numbers stay allocated but unused.
+func (bpm *BufferPoolManager) NewPagesIn(fileID FileID, n int) ([]PageID, []*[PageSize]byte, error) {
+	if n <= 0 {
+		return nil, nil, errors.New("page count must be positive")
+	}
+	ts, exists := bpm.spaces.get(fileID)
+	if !exists {
+		return nil, nil, errors.New("tablespace does not exist")
+	}
+	if ts.readOnly {
+		return nil, nil, ErrReadOnly
+	}
+	first, err := ts.allocateN(n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]PageID, n)
+	byPart := make(map[*BufferManager][]int)
+	for i := range ids {
+		ids[i] = MakePageID(fileID, first+uint64(i))
+		bm := bpm.partition(ids[i])
+		byPart[bm] = append(byPart[bm], i)
+	}
+
+	pages := make([]*[PageSize]byte, n)
+	var installed []PageID
+	for bm, idxs := range byPart {
+		err := bm.installNewPages(ids, pages, idxs)
+		if err != nil {
+			for _, pageID := range installed {
+				bpm.UnpinPage(pageID, true)
+			}
+			return nil, nil, err
+		}
+		for _, i := range idxs {
+			installed = append(installed, ids[i])
+		}
+	}
+	return ids, pages, nil
+}
+
+// installNewPages caches the already allocated pages ids[i] for i in idxs.
+func (bm *BufferManager) installNewPages(ids []PageID, pages []*[PageSize]byte, idxs []int) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	victims, err := bm.claimFrames(len(idxs))
+	if err != nil {
+		return err
+	}
+	for j, i := range idxs {
+		victim := bm.frames[victims[j]]
+		bm.installNewPage(victims[j], victim, ids[i])
+		pages[i] = victim.data
+	}
+	return nil
+}
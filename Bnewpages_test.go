@@ -0,0 +1,134 @@
+package manager
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// stamp fills a page with its own number.
+func stamp(pageNo uint64) *[PageSize]byte {
+	var page [PageSize]byte
+	for i := 0; i < PageSize; i += 8 {
+		binary.BigEndian.PutUint64(page[i:], pageNo)
+	}
+	return &page
+}
+
+func TestAllocateNConcurrent(t *testing.T) {
+	for _, name := range []string{"buffered", "direct"} {
+		var opts []TablespaceOption
+		if name == "direct" {
+			if directIOFlag == 0 {
+				continue
+			}
+			opts = append(opts, WithDirectIO())
+		}
+		path := filepath.Join(t.TempDir(), name)
+		fb, err := OpenFileBackend(path, opts...)
+		if err != nil {
+			if name == "direct" {
+				t.Logf("direct I/O: %v", err)
+				continue
+			}
+			t.Fatal(err)
+		}
+
+		// Batches and single pages are allocated and written at once; a
+		// batch that set the file's size could cut off pages written past it
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for w := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r := rand.New(rand.NewPCG(uint64(w), 1))
+				for range 200 {
+					var first uint64
+					n := 1
+					var err error
+					if w%2 == 0 {
+						n = 1 + r.IntN(8)
+						first, err = fb.AllocateN(n)
+					} else {
+						first, err = fb.Allocate()
+					}
+					for i := range uint64(n) {
+						if err == nil {
+							err = fb.WritePage(first+i, stamp(first+i))
+						}
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		count := fb.PageCount()
+		var page [PageSize]byte
+		for pageNo := range count {
+			if err := fb.ReadPage(pageNo, &page); err != nil {
+				t.Fatal(err)
+			}
+			if page != *stamp(pageNo) {
+				t.Fatalf("%s: page %d of %d lost its contents", name, pageNo, count)
+			}
+		}
+		if err := fb.Close(); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != int64(count)*PageSize {
+			t.Errorf("%s: file of %d bytes for %d pages", name, fi.Size(), count)
+		}
+	}
+}
+
+func TestAllocateNExtends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ts")
+	fb, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fb.WritePage(0, stamp(0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fb.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := fb.AllocateN(5)
+	if err != nil || first != 1 {
+		t.Fatalf("AllocateN(5) = %d, %v, want 1", first, err)
+	}
+	fb.Close()
+
+	// Reopened, the file keeps the reserved pages, zeroed
+	fb, err = OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Close()
+	if n := fb.PageCount(); n != 6 {
+		t.Errorf("reopened file holds %d pages, want 6", n)
+	}
+	var page [PageSize]byte
+	if err := fb.ReadPage(0, &page); err != nil || page != *stamp(0) {
+		t.Errorf("page 0 lost: %v", err)
+	}
+	if err := fb.ReadPage(5, &page); err != nil || page != [PageSize]byte{} {
+		t.Errorf("reserved page 5 not zero: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package manager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrObjectNotFound is returned by an ObjectStore for a missing key.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the subset of an S3-style object store ObjectBackend
+// needs. S3Client implements it for S3-compatible services.
+type ObjectStore interface {
+	GetObject(key string) ([]byte, error)
+	PutObject(key string, data []byte) error
+}
+
+// ObjectBackendOptions configures an ObjectBackend. Zero values pick the
+// defaults.
+type ObjectBackendOptions struct {
+	Prefix         string // key prefix, e.g. "indexes/orders/"
+	PagesPerObject int    // pages stored together in one object, default 16
+	CacheObjects   int    // objects kept in the local write-back cache, default 64
+}
+
+const (
+	defaultPagesPerObject = 16
+	defaultCacheObjects   = 64
+	objectMetaKey         = "meta"
+	objectMetaSize        = 12 // pageCount(8) + pagesPerObject(4)
+)
+
+type objectGroup struct {
+	data    []byte
+	dirty   bool
+	lastUse uint64
+}
+
+// ObjectBackend is a StorageBackend that stores groups of consecutive
+// pages as objects, giving cheap bottomless storage for mostly-read
+// indexes. Written pages collect in a local write-back cache and are only
+// uploaded when their object is evicted from it or on Sync.
+type ObjectBackend struct {
+	store      ObjectStore
+	prefix     string
+	groupPages int
+	maxCached  int
+
+	mu        sync.Mutex
+	cache     map[uint64]*objectGroup
+	tick      uint64
+	pageCount uint64
+	metaDirty bool
+}
+
+// OpenObjectBackend opens the page set stored under opts.Prefix, or starts
+// an empty one if nothing is stored there yet.
+func OpenObjectBackend(store ObjectStore, opts ObjectBackendOptions) (*ObjectBackend, error) {
+	ob := &ObjectBackend{
+		store:      store,
+		prefix:     opts.Prefix,
+		groupPages: opts.PagesPerObject,
+		maxCached:  opts.CacheObjects,
+		cache:      make(map[uint64]*objectGroup),
+	}
+	if ob.groupPages <= 0 {
+		ob.groupPages = defaultPagesPerObject
+	}
+	if ob.maxCached <= 0 {
+		ob.maxCached = defaultCacheObjects
+	}
+
+	meta, err := store.GetObject(ob.prefix + objectMetaKey)
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+		return ob, nil
+	case err != nil:
+		return nil, err
+	case len(meta) != objectMetaSize:
+		return nil, errors.New("corrupt object backend metadata")
+	}
+	if int(binary.BigEndian.Uint32(meta[8:])) != ob.groupPages {
+		return nil, errors.New("pages per object does not match stored pages")
+	}
+	ob.pageCount = binary.BigEndian.Uint64(meta)
+	return ob, nil
+}
+
+func (ob *ObjectBackend) objectKey(groupNo uint64) string {
+	return fmt.Sprintf("%spages/%016x", ob.prefix, groupNo)
+}
+
+// group returns the cached object holding pageNo, fetching it if needed.
+// ob.mu must be held.
+func (ob *ObjectBackend) group(pageNo uint64) (*objectGroup, int, error) {
+	groupNo := pageNo / uint64(ob.groupPages)
+	offset := int(pageNo%uint64(ob.groupPages)) * PageSize
+	ob.tick++
+
+	if g, exists := ob.cache[groupNo]; exists {
+		g.lastUse = ob.tick
+		return g, offset, nil
+	}
+	if err := ob.makeRoom(); err != nil {
+		return nil, 0, err
+	}
+
+	data, err := ob.store.GetObject(ob.objectKey(groupNo))
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+		data = make([]byte, ob.groupPages*PageSize)
+	case err != nil:
+		return nil, 0, err
+	case len(data) != ob.groupPages*PageSize:
+		return nil, 0, errors.New("corrupt page object")
+	}
+	g := &objectGroup{data: data, lastUse: ob.tick}
+	ob.cache[groupNo] = g
+	return g, offset, nil
+}
+
+// makeRoom evicts the least recently used object once the cache is full,
+// uploading it first if it holds unsynced writes.
+func (ob *ObjectBackend) makeRoom() error {
+	if len(ob.cache) < ob.maxCached {
+		return nil
+	}
+	var victimNo uint64
+	var victim *objectGroup
+	for groupNo, g := range ob.cache {
+		if victim == nil || g.lastUse < victim.lastUse {
+			victimNo, victim = groupNo, g
+		}
+	}
+	if victim.dirty {
+		if err := ob.store.PutObject(ob.objectKey(victimNo), victim.data); err != nil {
+			return err
+		}
+	}
+	delete(ob.cache, victimNo)
+	return nil
+}
+
+func (ob *ObjectBackend) ReadPage(pageNo uint64, buf *[PageSize]byte) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	g, offset, err := ob.group(pageNo)
+	if err != nil {
+		return err
+	}
+	copy(buf[:], g.data[offset:])
+	return nil
+}
+
+func (ob *ObjectBackend) WritePage(pageNo uint64, buf *[PageSize]byte) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	g, offset, err := ob.group(pageNo)
+	if err != nil {
+		return err
+	}
+	copy(g.data[offset:offset+PageSize], buf[:])
+	g.dirty = true
+	return nil
+}
+
+func (ob *ObjectBackend) Allocate() (uint64, error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.pageCount++
+	ob.metaDirty = true
+	return ob.pageCount - 1, nil
+}
+
+func (ob *ObjectBackend) PageCount() uint64 {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.pageCount
+}
+
+// Sync uploads every object with unsynced writes, then the metadata.
+func (ob *ObjectBackend) Sync() error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for groupNo, g := range ob.cache {
+		if !g.dirty {
+			continue
+		}
+		if err := ob.store.PutObject(ob.objectKey(groupNo), g.data); err != nil {
+			return err
+		}
+		g.dirty = false
+	}
+	if !ob.metaDirty {
+		return nil
+	}
+	meta := make([]byte, objectMetaSize)
+	binary.BigEndian.PutUint64(meta, ob.pageCount)
+	binary.BigEndian.PutUint32(meta[8:], uint32(ob.groupPages))
+	if err := ob.store.PutObject(ob.prefix+objectMetaKey, meta); err != nil {
+		return err
+	}
+	ob.metaDirty = false
+	return nil
+}
+
+// Close uploads pending writes. The store itself is left open.
+func (ob *ObjectBackend) Close() error {
+	return ob.Sync()
+}
@@ -0,0 +1,216 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// memStore is an in-memory ObjectStore. Like a real client it wraps
+// ErrObjectNotFound, and it fails every call with err once that is set.
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    []string
+	err     error
+}
+
+func newMemStore() *memStore {
+	return &memStore{objects: make(map[string][]byte)}
+}
+
+func (s *memStore) GetObject(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	data, exists := s.objects[key]
+	if !exists {
+		return nil, fmt.Errorf("get %s: %w", key, ErrObjectNotFound)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *memStore) PutObject(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.objects[key] = append([]byte(nil), data...)
+	s.puts = append(s.puts, key)
+	return nil
+}
+
+// takePuts returns the keys written so far, sorted, and forgets them.
+func (s *memStore) takePuts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	puts := s.puts
+	s.puts = nil
+	sort.Strings(puts)
+	return puts
+}
+
+// writeStamped allocates n pages and writes each one's stamp.
+func writeStamped(t *testing.T, ob *ObjectBackend, n int) {
+	t.Helper()
+	for range n {
+		pageNo, err := ob.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ob.WritePage(pageNo, stamp(pageNo)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readStamped(t *testing.T, ob *ObjectBackend, pageNo uint64) {
+	t.Helper()
+	var page [PageSize]byte
+	if err := ob.ReadPage(pageNo, &page); err != nil {
+		t.Fatal(err)
+	}
+	if page != *stamp(pageNo) {
+		t.Errorf("page %d does not hold its stamp", pageNo)
+	}
+}
+
+func TestObjectBackendMissing(t *testing.T) {
+	store := newMemStore()
+	ob, err := OpenObjectBackend(store, ObjectBackendOptions{Prefix: "t/"})
+	if err != nil {
+		t.Fatalf("OpenObjectBackend on an empty store: %v", err)
+	}
+	if n := ob.PageCount(); n != 0 {
+		t.Errorf("PageCount = %d, want 0", n)
+	}
+
+	// A page whose object was never uploaded reads as zeroes
+	var page [PageSize]byte
+	page[0] = 1
+	if err := ob.ReadPage(5, &page); err != nil {
+		t.Fatal(err)
+	}
+	if page != [PageSize]byte{} {
+		t.Error("missing page does not read as zeroes")
+	}
+
+	// Other store errors are passed on
+	failed := errors.New("access denied")
+	store.err = failed
+	if err := ob.ReadPage(100, &page); !errors.Is(err, failed) {
+		t.Errorf("ReadPage = %v, want the store's error", err)
+	}
+	if _, err := OpenObjectBackend(store, ObjectBackendOptions{}); !errors.Is(err, failed) {
+		t.Errorf("OpenObjectBackend = %v, want the store's error", err)
+	}
+}
+
+func TestObjectBackendEviction(t *testing.T) {
+	store := newMemStore()
+	ob, err := OpenObjectBackend(store, ObjectBackendOptions{Prefix: "t/", PagesPerObject: 2, CacheObjects: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Objects 0 and 1 fit in the cache, so nothing is uploaded yet
+	writeStamped(t, ob, 4)
+	if puts := store.takePuts(); len(puts) != 0 {
+		t.Fatalf("uploads before eviction: %v", puts)
+	}
+
+	// Touching object 0 makes object 1 the least recently used, and
+	// object 2 pushes it out
+	readStamped(t, ob, 0)
+	writeStamped(t, ob, 1)
+	want := []string{"t/pages/0000000000000001"}
+	if puts := store.takePuts(); fmt.Sprint(puts) != fmt.Sprint(want) {
+		t.Errorf("uploads = %v, want %v", puts, want)
+	}
+
+	// Reading object 1 back evicts object 0, uploading its writes
+	readStamped(t, ob, 2)
+	readStamped(t, ob, 3)
+	want = []string{"t/pages/0000000000000000"}
+	if puts := store.takePuts(); fmt.Sprint(puts) != fmt.Sprint(want) {
+		t.Errorf("uploads = %v, want %v", puts, want)
+	}
+
+	// With object 2 touched, the clean object 1 is the one to go, and
+	// it goes without an upload
+	readStamped(t, ob, 4)
+	readStamped(t, ob, 0)
+	if puts := store.takePuts(); len(puts) != 0 {
+		t.Errorf("evicting clean object 1 uploaded %v", puts)
+	}
+}
+
+func TestObjectBackendClose(t *testing.T) {
+	store := newMemStore()
+	opts := ObjectBackendOptions{Prefix: "t/", PagesPerObject: 2}
+	ob, err := OpenObjectBackend(store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeStamped(t, ob, 3)
+	if err := ob.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"t/meta", "t/pages/0000000000000000", "t/pages/0000000000000001"}
+	if puts := store.takePuts(); fmt.Sprint(puts) != fmt.Sprint(want) {
+		t.Errorf("uploads on Close = %v, want %v", puts, want)
+	}
+
+	// A second Sync has nothing left to upload
+	if err := ob.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if puts := store.takePuts(); len(puts) != 0 {
+		t.Errorf("second Sync uploaded %v", puts)
+	}
+
+	reopened, err := OpenObjectBackend(store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := reopened.PageCount(); n != 3 {
+		t.Errorf("PageCount after reopen = %d, want 3", n)
+	}
+	for pageNo := range uint64(3) {
+		readStamped(t, reopened, pageNo)
+	}
+
+	if _, err := OpenObjectBackend(store, ObjectBackendOptions{Prefix: "t/", PagesPerObject: 4}); err == nil {
+		t.Error("reopening with a different PagesPerObject succeeded")
+	}
+}
+
+func TestObjectBackendUploadError(t *testing.T) {
+	store := newMemStore()
+	ob, err := OpenObjectBackend(store, ObjectBackendOptions{PagesPerObject: 1, CacheObjects: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeStamped(t, ob, 1)
+
+	// The dirty object cannot be uploaded, so it must stay cached
+	failed := errors.New("bucket gone")
+	store.err = failed
+	var page [PageSize]byte
+	if err := ob.ReadPage(1, &page); !errors.Is(err, failed) {
+		t.Errorf("ReadPage = %v, want the upload's error", err)
+	}
+	store.err = nil
+	readStamped(t, ob, 0)
+	if err := ob.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := store.objects["pages/0000000000000000"]; !exists {
+		t.Error("page 0 was not uploaded on Close")
+	}
+}
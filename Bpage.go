@@ -0,0 +1,64 @@
+package manager
+
+import "encoding/binary"
+
+// PageType tags what a page holds. It is stored in the common page header
+// every page layout starts with.
+type PageType uint64
+
+const (
+	PageTypeLeaf PageType = iota
+	PageTypeInternal
+	PageTypeOverflow
+	PageTypeMeta
+	PageTypeFreeList
+	PageTypeHash
+	PageTypeHashDirectory
+	PageTypeHashBucket
+	PageTypeHeap
+)
+
+func (t PageType) String() string {
+	switch t {
+	case PageTypeLeaf:
+		return "leaf"
+	case PageTypeInternal:
+		return "internal"
+	case PageTypeOverflow:
+		return "overflow"
+	case PageTypeMeta:
+		return "meta"
+	case PageTypeFreeList:
+		return "free-list"
+	case PageTypeHash:
+		return "hash"
+	case PageTypeHashDirectory:
+		return "hash-directory"
+	case PageTypeHashBucket:
+		return "hash-bucket"
+	case PageTypeHeap:
+		return "heap"
+	}
+	return "unknown"
+}
+
+// PageHeaderSize is the size of the common page header:
+// pageType(8) + pageLSN(8). Page layouts place their own fields after it.
+const PageHeaderSize = 16
+
+func GetPageType(data *[PageSize]byte) PageType {
+	return PageType(binary.BigEndian.Uint64(data[0:8]))
+}
+
+func SetPageType(data *[PageSize]byte, t PageType) {
+	binary.BigEndian.PutUint64(data[0:8], uint64(t))
+}
+
+// GetPageLSN returns the LSN of the last logged update applied to the page.
+func GetPageLSN(data *[PageSize]byte) LSN {
+	return LSN(binary.BigEndian.Uint64(data[8:16]))
+}
+
+func SetPageLSN(data *[PageSize]byte, lsn LSN) {
+	binary.BigEndian.PutUint64(data[8:16], uint64(lsn))
+}
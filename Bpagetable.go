@@ -0,0 +1,147 @@
+package manager
+
+import (
+	"errors"
+	"math"
+)
+
+// frameLocked is stored in a frame's pin count while the frame is being
+// evicted, reused or dropped. A negative count sends lock-free pinners to
+// the locked slow path.
+const frameLocked = math.MinInt32 / 2
+
+// Resident, fully loaded, non-scan pages are also published in bm.fast,
+// so pinning and clean unpinning of hits never take bm.mu:
+//
+//   - a pinner looks the frame up in bm.fast, increments its pin count
+//     with a CAS unless the frame is locked, then checks that bm.fast still
+//     maps the page to the frame, undoing the pin if not;
+//   - everything that evicts or reuses a frame (all under bm.mu) first
+//     locks it by swapping its pin count from 0 to frameLocked, so a frame
+//     holding a pin can never change identity underneath its pinner.
+//
+// The fast path is off while tracing, pin tracking or admission is on, as
+// those need bm.mu for every pin.
+
+func (frame *bufferPage) tryLock() bool {
+	return frame.pins.CompareAndSwap(0, frameLocked)
+}
+
+func (frame *bufferPage) pinned() bool {
+	return frame.pins.Load() > 0
+}
+
+// reuse clears a locked frame for a new page. The pin count stays locked
+// until the caller stores the new one.
+func (frame *bufferPage) reuse(pageID PageID) {
+	frame.pageID = pageID
+	frame.isDirty = false
+	frame.refBit.Store(false)
+	frame.valid = false
+	frame.pageLSN = 0
+	frame.recLSN = 0
+	frame.loading = nil
+	frame.loadErr = nil
+	frame.scan = false
+}
+
+// publish makes a frame available to the lock-free pin path.
+func (bm *BufferManager) publish(frame *bufferPage) {
+	if frame.valid && !frame.scan && frame.loading == nil {
+		bm.fast.Store(frame.pageID, frame)
+	}
+}
+
+// unmapPage removes a page from both page tables.
+func (bm *BufferManager) unmapPage(pageID PageID) {
+	delete(bm.pageTable, pageID)
+	bm.fast.Delete(pageID)
+}
+
+// updateFastPath re-enables the lock-free path once no feature needs to
+// see every pin. bm.mu must be held.
+func (bm *BufferManager) updateFastPath() {
+	bm.fastPath.Store(bm.trace == nil && bm.pinTrace == nil && bm.admission == nil)
+}
+
+// tryFastPin pins a published page without taking bm.mu.
+func (bm *BufferManager) tryFastPin(pageID PageID, hint PinHint) (*[PageSize]byte, bool) {
+	if !bm.fastPath.Load() {
+		return nil, false
+	}
+	v, exists := bm.fast.Load(pageID)
+	if !exists {
+		return nil, false
+	}
+	frame := v.(*bufferPage)
+	for {
+		n := frame.pins.Load()
+		if n < 0 {
+			return nil, false
+		}
+		if frame.pins.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+	if v, exists := bm.fast.Load(pageID); !exists || v != frame {
+		// The frame was reused between the lookup and the pin
+		frame.pins.Add(-1)
+		return nil, false
+	}
+	if hint == PinNormal {
+		frame.refBit.Store(true)
+	}
+	bm.stats.hits.Add(1)
+	return frame.data, true
+}
+
+// tryFastUnpin releases a clean pin of a published page without taking
+// bm.mu. The caller's own pin keeps the frame from being reused meanwhile.
+func (bm *BufferManager) tryFastUnpin(pageID PageID) bool {
+	if !bm.fastPath.Load() {
+		return false
+	}
+	v, exists := bm.fast.Load(pageID)
+	if !exists {
+		return false
+	}
+	frame := v.(*bufferPage)
+	for {
+		n := frame.pins.Load()
+		if n <= 0 {
+			return false
+		}
+		if frame.pins.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// lockFrames locks every cached frame of the tablespace so it can be
+// discarded. It fails, with nothing locked, if any of them is pinned.
+func (bm *BufferManager) lockFrames(fileID FileID) error {
+	var locked []*bufferPage
+	for pageID, idx := range bm.pageTable {
+		if pageID.FileID() != fileID {
+			continue
+		}
+		frame := bm.frames[idx]
+		if !frame.tryLock() {
+			for _, f := range locked {
+				f.pins.Store(0)
+			}
+			return errors.New("tablespace has pinned pages")
+		}
+		locked = append(locked, frame)
+	}
+	return nil
+}
+
+// unlockFrames undoes lockFrames.
+func (bm *BufferManager) unlockFrames(fileID FileID) {
+	for pageID, idx := range bm.pageTable {
+		if pageID.FileID() == fileID {
+			bm.frames[idx].pins.Store(0)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package manager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestPinStress pins and unpins pages from many goroutines, mostly
+// through the lock-free path, while frames are evicted, the pool is
+// resized and compacted and tablespaces are dropped, and checks that a
+// pinned page always holds its own contents. Run it with -race.
+func TestPinStress(t *testing.T) {
+	dir := t.TempDir()
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 64})
+	defer bm.Close()
+	fileID, err := bm.CreateTablespace(filepath.Join(dir, "stable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pages = 200
+	ids := make([]PageID, pages)
+	for i := range ids {
+		pageID, data, err := bm.NewPageIn(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.BigEndian.PutUint64(data[:], uint64(pageID))
+		binary.BigEndian.PutUint64(data[PageSize-8:], uint64(pageID))
+		if err := bm.UnpinPage(pageID, true); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = pageID
+	}
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		stop.Store(true)
+	}
+
+	// Pinners; a hot set keeps pages resident for the lock-free path
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(uint64(w), 2))
+			for i := 0; i < 20000 && !stop.Load(); i++ {
+				pageID := ids[r.IntN(pages)]
+				if r.IntN(4) > 0 {
+					pageID = ids[r.IntN(8)]
+				}
+				data, err := bm.PinPage(pageID)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if got := binary.BigEndian.Uint64(data[:]); got != uint64(pageID) {
+					fail(fmt.Errorf("pinned page %v holds page %v", pageID, PageID(got)))
+				}
+				if got := binary.BigEndian.Uint64(data[PageSize-8:]); got != uint64(pageID) {
+					fail(fmt.Errorf("pinned page %v ends with page %v", pageID, PageID(got)))
+				}
+				if err := bm.UnpinPage(pageID, r.IntN(16) == 0); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+
+	// Resizes, each shrink compacting the frames
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; !stop.Load() && i < 400; i++ {
+			// Failures for want of unpinned frames are expected
+			bm.Resize(32 + i%3*32)
+		}
+	}()
+
+	// Tablespaces created, filled and dropped
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; !stop.Load() && i < 50; i++ {
+			id, err := bm.CreateTablespace(filepath.Join(dir, fmt.Sprint("drop", i)))
+			if err != nil {
+				fail(err)
+				return
+			}
+			for range 10 {
+				pageID, _, err := bm.NewPageIn(id)
+				if err == nil {
+					err = bm.UnpinPage(pageID, true)
+				}
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+			if err := bm.DropTablespace(id); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if err := bm.Resize(64); err != nil {
+		t.Fatal(err)
+	}
+	// Every pin was released, and no frame left locked
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	for i, frame := range bm.frames {
+		if n := frame.pins.Load(); n != 0 {
+			t.Errorf("frame %d of page %v left with pin count %d", i, frame.pageID, n)
+		}
+	}
+}
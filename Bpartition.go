@@ -0,0 +1,157 @@
+package manager
+
+import "errors"
+
+// BufferPoolManager spreads pages over several independent BufferManager
+// partitions, each with its own lock and clock sweep, chosen by a hash of
+// the page ID. All partitions share one set of tablespaces.
+type BufferPoolManager struct {
+	parts  []*BufferManager
+	spaces *spaceSet
+}
+
+// NewBufferPoolManager creates a pool of partitions buffer managers with
+// framesPerPartition frames each.
+func NewBufferPoolManager(partitions, framesPerPartition int) *BufferPoolManager {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	if framesPerPartition <= 0 {
+		framesPerPartition = MaxFrames
+	}
+
+	spaces := newSpaceSet()
+	bpm := &BufferPoolManager{
+		parts:  make([]*BufferManager, partitions),
+		spaces: spaces,
+	}
+	for i := range bpm.parts {
+		bpm.parts[i] = newBufferManager(spaces, framesPerPartition)
+	}
+	return bpm
+}
+
+// Partitions exposes the underlying buffer managers, e.g. to register hooks
+// or start I/O workers on each of them.
+func (bpm *BufferPoolManager) Partitions() []*BufferManager {
+	return bpm.parts
+}
+
+func (bpm *BufferPoolManager) partition(pageID PageID) *BufferManager {
+	// Fibonacci hashing spreads consecutive page numbers over partitions
+	h := uint64(pageID) * 0x9E3779B97F4A7C15
+	return bpm.parts[(h>>32)%uint64(len(bpm.parts))]
+}
+
+func (bpm *BufferPoolManager) PinPage(pageID PageID) (*[PageSize]byte, error) {
+	return bpm.partition(pageID).PinPage(pageID)
+}
+
+func (bpm *BufferPoolManager) PinPageHint(pageID PageID, hint PinHint) (*[PageSize]byte, error) {
+	return bpm.partition(pageID).PinPageHint(pageID, hint)
+}
+
+func (bpm *BufferPoolManager) UnpinPage(pageID PageID, isDirty bool) error {
+	return bpm.partition(pageID).UnpinPage(pageID, isDirty)
+}
+
+func (bpm *BufferPoolManager) FlushPage(pageID PageID) error {
+	return bpm.partition(pageID).FlushPage(pageID)
+}
+
+func (bpm *BufferPoolManager) NewPage() (PageID, *[PageSize]byte, error) {
+	return bpm.NewPageIn(DefaultFileID)
+}
+
+// NewPageIn allocates the page number first and then lets the owning
+// partition cache it. If that partition has no free frame the page number
+// stays allocated but unused.
+func (bpm *BufferPoolManager) NewPageIn(fileID FileID) (PageID, *[PageSize]byte, error) {
+	ts, exists := bpm.spaces.get(fileID)
+	if !exists {
+		return 0, nil, errors.New("tablespace does not exist")
+	}
+	if ts.readOnly {
+		return 0, nil, ErrReadOnly
+	}
+	pageNo, err := ts.allocate()
+	if err != nil {
+		return 0, nil, err
+	}
+	pageID := MakePageID(fileID, pageNo)
+
+	bm := bpm.partition(pageID)
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	victimIdx, victim, err := bm.claimFrame()
+	if err != nil {
+		return 0, nil, err
+	}
+	bm.installNewPage(victimIdx, victim, pageID)
+	return pageID, victim.data, nil
+}
+
+func (bpm *BufferPoolManager) CreateTablespace(path string, opts ...TablespaceOption) (FileID, error) {
+	return bpm.spaces.create(path, opts...)
+}
+
+func (bpm *BufferPoolManager) DropTablespace(fileID FileID) error {
+	if fileID == DefaultFileID {
+		return errors.New("cannot drop default tablespace")
+	}
+	ts, exists := bpm.spaces.get(fileID)
+	if !exists {
+		return errors.New("tablespace does not exist")
+	}
+	if ts.readOnly {
+		return ErrReadOnly
+	}
+
+	// Lock every partition so no page of the tablespace gets pinned between
+	// the check and the discard
+	for _, bm := range bpm.parts {
+		bm.mu.Lock()
+		defer bm.mu.Unlock()
+	}
+	for i, bm := range bpm.parts {
+		if err := bm.checkDiscardable(fileID); err != nil {
+			for _, locked := range bpm.parts[:i] {
+				locked.unlockFrames(fileID)
+			}
+			return err
+		}
+	}
+	for _, bm := range bpm.parts {
+		bm.discardPages(fileID)
+	}
+	return bpm.spaces.drop(fileID)
+}
+
+// InjectFaults attaches fi to a tablespace shared by all partitions.
+func (bpm *BufferPoolManager) InjectFaults(fileID FileID, fi *FaultInjector) error {
+	return bpm.parts[0].InjectFaults(fileID, fi)
+}
+
+func (bpm *BufferPoolManager) AttachTablespace(backend StorageBackend, opts ...TablespaceOption) (FileID, error) {
+	return bpm.spaces.attach(backend, opts...)
+}
+
+func (bpm *BufferPoolManager) Tablespaces() []FileID {
+	return bpm.spaces.ids()
+}
+
+// Close writes back every partition's dirty pages and closes the shared
+// tablespace files.
+func (bpm *BufferPoolManager) Close() error {
+	var firstErr error
+	for _, bm := range bpm.parts {
+		if err := bm.drainAndFlush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := bpm.spaces.closeAll(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
@@ -0,0 +1,137 @@
+package manager
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestBufferPoolManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared")
+	bpm := NewBufferPoolManager(4, 8)
+	fileID, err := bpm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []PageID
+	for range 100 {
+		pageID, data, err := bpm.NewPageIn(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*data = *stamp(uint64(pageID))
+		if err := bpm.UnpinPage(pageID, true); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, pageID)
+	}
+	// Consecutive pages spread over every partition
+	for i, bm := range bpm.Partitions() {
+		if s := bm.Stats(); s.PagesAllocated < 10 {
+			t.Errorf("partition %d got %d of 100 pages", i, s.PagesAllocated)
+		}
+	}
+	if s := bpm.Stats(); s.Frames != 32 || s.PagesAllocated != 100 || s.Resident != 32 {
+		t.Errorf("Stats: %d frames, %d allocated, %d resident", s.Frames, s.PagesAllocated, s.Resident)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(uint64(w), 3))
+			for range 2000 {
+				pageID := ids[r.IntN(len(ids))]
+				data, err := bpm.PinPage(pageID)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if *data != *stamp(uint64(pageID)) {
+					errs <- fmt.Errorf("page %d lost its contents", pageID.PageNo())
+				}
+				if err := bpm.UnpinPage(pageID, r.IntN(8) == 0); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if err := bpm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bm := NewBufferManager()
+	defer bm.Close()
+	reopened, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened != fileID {
+		t.Fatalf("reopened as tablespace %d, not %d", reopened, fileID)
+	}
+	checkPages(t, bm, ids)
+}
+
+func TestBufferPoolManagerDrop(t *testing.T) {
+	bpm := NewBufferPoolManager(4, 4)
+	defer bpm.Close()
+	fileID, err := bpm.CreateTablespace(filepath.Join(t.TempDir(), "dropped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []PageID
+	for range 12 {
+		pageID, _, err := bpm.NewPageIn(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bpm.UnpinPage(pageID, true)
+		ids = append(ids, pageID)
+	}
+
+	// A pin in the last partition to be checked fails the drop after
+	// the others have locked their frames; they must let go of them
+	last := bpm.Partitions()[3]
+	var pinned PageID
+	for _, pageID := range ids {
+		if bpm.partition(pageID) == last {
+			pinned = pageID
+		}
+	}
+	if _, err := bpm.PinPage(pinned); err != nil {
+		t.Fatal(err)
+	}
+	if err := bpm.DropTablespace(fileID); err == nil {
+		t.Fatal("DropTablespace with a page pinned succeeded")
+	}
+	for _, pageID := range ids {
+		if _, err := bpm.PinPage(pageID); err != nil {
+			t.Fatalf("PinPage after a failed drop: %v", err)
+		}
+		bpm.UnpinPage(pageID, false)
+	}
+	bpm.UnpinPage(pinned, false)
+
+	if err := bpm.DropTablespace(fileID); err != nil {
+		t.Fatal(err)
+	}
+	if s := bpm.Stats(); s.Resident != 0 {
+		t.Errorf("%d pages resident after the drop", s.Resident)
+	}
+	if _, _, err := bpm.NewPageIn(fileID); err == nil {
+		t.Error("NewPageIn a dropped tablespace succeeded")
+	}
+	if err := bpm.DropTablespace(DefaultFileID); err == nil {
+		t.Error("DropTablespace of the default tablespace succeeded")
+	}
+}
@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PinLeak describes a pin held longer than the tracking threshold.
+type PinLeak struct {
+	PageID    PageID
+	PinnedFor time.Duration
+	Stack     string // where the pin was acquired
+}
+
+func (l PinLeak) String() string {
+	return fmt.Sprintf("page %d pinned for %v at:\n%s", l.PageID, l.PinnedFor, l.Stack)
+}
+
+type pinRecord struct {
+	at  time.Time
+	pcs []uintptr
+}
+
+// EnablePinTracking turns on the pin-leak diagnostics mode: every pin
+// records its caller, and every interval report is called with the pins
+// held longer than threshold. The returned function stops the checker and
+// turns tracking off again. Tracking costs a stack walk per pin, so it is
+// meant for debugging only.
+func (bm *BufferManager) EnablePinTracking(threshold, interval time.Duration, report func([]PinLeak)) (stop func()) {
+	bm.mu.Lock()
+	bm.pinTrace = make(map[PageID][]pinRecord)
+	bm.updateFastPath()
+	bm.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if leaks := bm.PinLeaks(threshold); len(leaks) > 0 {
+					report(leaks)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		bm.mu.Lock()
+		bm.pinTrace = nil
+		bm.updateFastPath()
+		bm.mu.Unlock()
+	}
+}
+
+// PinLeaks returns the pins held longer than threshold, oldest first. It
+// returns nil unless pin tracking is enabled.
+func (bm *BufferManager) PinLeaks(threshold time.Duration) []PinLeak {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	now := time.Now()
+	var leaks []PinLeak
+	for pageID, records := range bm.pinTrace {
+		for _, rec := range records {
+			if age := now.Sub(rec.at); age >= threshold {
+				leaks = append(leaks, PinLeak{
+					PageID:    pageID,
+					PinnedFor: age,
+					Stack:     formatStack(rec.pcs),
+				})
+			}
+		}
+	}
+	sort.Slice(leaks, func(i, j int) bool {
+		return leaks[i].PinnedFor > leaks[j].PinnedFor
+	})
+	return leaks
+}
+
+// recordPin remembers the caller of a pin while tracking is enabled.
+func (bm *BufferManager) recordPin(pageID PageID) {
+	if bm.pinTrace == nil {
+		return
+	}
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	bm.pinTrace[pageID] = append(bm.pinTrace[pageID], pinRecord{at: time.Now(), pcs: pcs[:n]})
+}
+
+// releasePin forgets the most recent pin of the page. Unpins don't say
+// which pin they release, so a leaked pin is the one left behind.
+func (bm *BufferManager) releasePin(pageID PageID) {
+	records := bm.pinTrace[pageID]
+	switch len(records) {
+	case 0:
+	case 1:
+		delete(bm.pinTrace, pageID)
+	default:
+		bm.pinTrace[pageID] = records[:len(records)-1]
+	}
+}
+
+// formatStack renders a recorded stack without the buffer manager's own
+// frames.
+func formatStack(pcs []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "manager.(*BufferManager).") {
+			fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakPin pins a page and never unpins it.
+func leakPin(t *testing.T, bm *BufferManager, pageID PageID) {
+	t.Helper()
+	if _, err := bm.PinPage(pageID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinLeaks(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	ids := fillPages(t, bm, DefaultFileID, 4)
+	// Pins from before tracking are not known to it
+	leakPin(t, bm, ids[3])
+
+	reports := make(chan []PinLeak, 1)
+	stop := bm.EnablePinTracking(20*time.Millisecond, 5*time.Millisecond, func(leaks []PinLeak) {
+		select {
+		case reports <- leaks:
+		default:
+		}
+	})
+	if bm.fastPath.Load() {
+		t.Error("lock-free pins, which are not recorded, still on while tracking")
+	}
+	leakPin(t, bm, ids[0])
+	// Pins released again are forgotten, as is the later of two pins
+	checkPages(t, bm, ids[1:3])
+	leakPin(t, bm, ids[1])
+	if _, err := bm.PinPage(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	bm.UnpinPage(ids[1], false)
+
+	if leaks := bm.PinLeaks(time.Hour); len(leaks) != 0 {
+		t.Errorf("PinLeaks of an hour = %v", leaks)
+	}
+	var leaks []PinLeak
+	select {
+	case leaks = <-reports:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no leak reported")
+	}
+	if len(leaks) != 2 || leaks[0].PageID != ids[0] || leaks[1].PageID != ids[1] {
+		t.Fatalf("leaks = %v, want pages 0 and 1 oldest first", leaks)
+	}
+	for _, leak := range leaks {
+		if leak.PinnedFor < 20*time.Millisecond {
+			t.Errorf("page %d reported after %v", leak.PageID, leak.PinnedFor)
+		}
+		// The stack starts at the caller, not inside the buffer manager
+		if !strings.Contains(leak.Stack, "manager.leakPin") || strings.Contains(leak.Stack, "PinPage") {
+			t.Errorf("stack of page %d:\n%s", leak.PageID, leak.Stack)
+		}
+		if !strings.Contains(leak.String(), leak.Stack) {
+			t.Errorf("String() = %q leaves out the stack", leak.String())
+		}
+	}
+
+	stop()
+	if leaks := bm.PinLeaks(0); leaks != nil {
+		t.Errorf("PinLeaks after stop = %v", leaks)
+	}
+	if !bm.fastPath.Load() {
+		t.Error("lock-free pins still off after tracking stopped")
+	}
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// PinQuotaError is returned when a client already holds as many pins as its
+// quota allows.
+type PinQuotaError struct {
+	Client string
+	Limit  int
+}
+
+func (e *PinQuotaError) Error() string {
+	return fmt.Sprintf("client %q exceeded pin quota of %d", e.Client, e.Limit)
+}
+
+// pinSource is what a Client needs from a BufferManager or
+// BufferPoolManager.
+type pinSource interface {
+	PinPageHint(pageID PageID, hint PinHint) (*[PageSize]byte, error)
+	UnpinPage(pageID PageID, isDirty bool) error
+	NewPageIn(fileID FileID) (PageID, *[PageSize]byte, error)
+}
+
+// Client is a session's view of a buffer pool that caps how many frames
+// the session may hold pinned at once, so one runaway scan cannot pin every
+// frame and starve everyone else. A Client is safe for concurrent use.
+type Client struct {
+	src    pinSource
+	name   string
+	limit  int
+	mu     sync.Mutex
+	pinned map[PageID]int
+	total  int
+}
+
+// NewClient returns a client allowed at most maxPins simultaneous pins.
+func (bm *BufferManager) NewClient(name string, maxPins int) *Client {
+	return newClient(bm, name, maxPins)
+}
+
+func (bpm *BufferPoolManager) NewClient(name string, maxPins int) *Client {
+	return newClient(bpm, name, maxPins)
+}
+
+func newClient(src pinSource, name string, maxPins int) *Client {
+	return &Client{
+		src:    src,
+		name:   name,
+		limit:  maxPins,
+		pinned: make(map[PageID]int),
+	}
+}
+
+// reserve takes one pin from the quota before the page is pinned.
+func (c *Client) reserve() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.total >= c.limit {
+		return &PinQuotaError{Client: c.name, Limit: c.limit}
+	}
+	c.total++
+	return nil
+}
+
+// settle records the outcome of a reserved pin.
+func (c *Client) settle(pageID PageID, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.total--
+		return
+	}
+	c.pinned[pageID]++
+}
+
+func (c *Client) PinPage(pageID PageID) (*[PageSize]byte, error) {
+	return c.PinPageHint(pageID, PinNormal)
+}
+
+func (c *Client) PinPageHint(pageID PageID, hint PinHint) (*[PageSize]byte, error) {
+	if err := c.reserve(); err != nil {
+		return nil, err
+	}
+	data, err := c.src.PinPageHint(pageID, hint)
+	c.settle(pageID, err)
+	return data, err
+}
+
+func (c *Client) NewPage() (PageID, *[PageSize]byte, error) {
+	return c.NewPageIn(DefaultFileID)
+}
+
+func (c *Client) NewPageIn(fileID FileID) (PageID, *[PageSize]byte, error) {
+	if err := c.reserve(); err != nil {
+		return 0, nil, err
+	}
+	pageID, data, err := c.src.NewPageIn(fileID)
+	c.settle(pageID, err)
+	return pageID, data, err
+}
+
+// UnpinPage releases a pin taken through this client.
+func (c *Client) UnpinPage(pageID PageID, isDirty bool) error {
+	c.mu.Lock()
+	if c.pinned[pageID] == 0 {
+		c.mu.Unlock()
+		return errors.New("page not pinned by client")
+	}
+	c.pinned[pageID]--
+	if c.pinned[pageID] == 0 {
+		delete(c.pinned, pageID)
+	}
+	c.total--
+	c.mu.Unlock()
+
+	return c.src.UnpinPage(pageID, isDirty)
+}
+
+// Pinned returns the number of pins the client currently holds.
+func (c *Client) Pinned() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Release drops every pin the client still holds, e.g. when its session
+// ends or is aborted.
+func (c *Client) Release() error {
+	c.mu.Lock()
+	pinned := c.pinned
+	c.pinned = make(map[PageID]int)
+	c.total = 0
+	c.mu.Unlock()
+
+	var firstErr error
+	for pageID, n := range pinned {
+		for ; n > 0; n-- {
+			if err := c.src.UnpinPage(pageID, false); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
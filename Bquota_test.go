@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientQuota(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 6})
+	ids := fillPages(t, bm, DefaultFileID, 10)
+	c := bm.NewClient("scan", 3)
+
+	// Pins of the same page count against the quota too
+	for _, pageID := range []PageID{ids[0], ids[1], ids[1]} {
+		if _, err := c.PinPage(pageID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var quotaErr *PinQuotaError
+	if _, err := c.PinPage(ids[2]); !errors.As(err, &quotaErr) || quotaErr.Client != "scan" || quotaErr.Limit != 3 {
+		t.Errorf("PinPage past the quota: %v, want a PinQuotaError", err)
+	}
+	if _, _, err := c.NewPage(); !errors.As(err, &quotaErr) {
+		t.Errorf("NewPage past the quota: %v, want a PinQuotaError", err)
+	}
+	if c.Pinned() != 3 || bm.Stats().Pinned != 2 {
+		t.Errorf("client holds %d pins of %d pages, want 3 of 2", c.Pinned(), bm.Stats().Pinned)
+	}
+
+	// Others still find frames to pin
+	other := bm.NewClient("other", 3)
+	for _, pageID := range ids[5:8] {
+		if _, err := other.PinPage(pageID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.UnpinPage(ids[5], false); err == nil {
+		t.Error("UnpinPage of a page pinned by another client succeeded")
+	}
+	if err := c.UnpinPage(ids[1], true); err != nil {
+		t.Fatal(err)
+	}
+	// A failed pin gives its reservation back
+	if _, err := c.PinPage(MakePageID(DefaultFileID, 99)); err == nil {
+		t.Fatal("PinPage of a missing page succeeded")
+	}
+	pageID, _, err := c.NewPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Pinned() != 3 {
+		t.Errorf("client holds %d pins, want 3", c.Pinned())
+	}
+
+	if err := c.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Pinned() != 0 || bm.Stats().Pinned != 0 {
+		t.Errorf("after Release the client holds %d pins and the pool %d", c.Pinned(), bm.Stats().Pinned)
+	}
+	if err := c.UnpinPage(pageID, false); err == nil {
+		t.Error("UnpinPage after Release succeeded")
+	}
+	checkPages(t, bm, ids)
+}
+
+func TestClientQuotaConcurrent(t *testing.T) {
+	bpm := NewBufferPoolManager(2, 8)
+	var ids []PageID
+	for range 12 {
+		pageID, _, err := bpm.NewPageIn(DefaultFileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bpm.UnpinPage(pageID, true)
+		ids = append(ids, pageID)
+	}
+
+	const limit = 5
+	c := bpm.NewClient("workers", limit)
+	var held, peak atomic.Int64
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 300 {
+				pageID := ids[(w+i)%len(ids)]
+				if _, err := c.PinPage(pageID); err != nil {
+					var quotaErr *PinQuotaError
+					if !errors.As(err, &quotaErr) {
+						t.Error(err)
+						return
+					}
+					continue
+				}
+				n := held.Add(1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				held.Add(-1)
+				if err := c.UnpinPage(pageID, false); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > limit {
+		t.Errorf("client held %d pins at once, over its quota of %d", peak.Load(), limit)
+	}
+	if c.Pinned() != 0 {
+		t.Errorf("client holds %d pins after every unpin", c.Pinned())
+	}
+}
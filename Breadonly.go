@@ -0,0 +1,44 @@
+package manager
+
+import "errors"
+
+// ErrReadOnly is returned for any attempt to modify a read-only tablespace.
+var ErrReadOnly = errors.New("tablespace is read-only")
+
+// WithReadOnly opens the tablespace file O_RDONLY, e.g. to serve queries
+// from a backup copy. The file must already exist. NewPageIn and dirty
+// unpins of its pages fail with ErrReadOnly.
+func WithReadOnly() TablespaceOption {
+	return func(cfg *tablespaceConfig) {
+		cfg.readOnly = true
+	}
+}
+
+// NewReadOnlyBufferManager creates a buffer manager that opens every
+// tablespace read-only, including its default in-memory one.
+func NewReadOnlyBufferManager() *BufferManager {
+	return newBufferManager(newReadOnlySpaceSet(), MaxFrames)
+}
+
+func newReadOnlySpaceSet() *spaceSet {
+	s := newSpaceSet()
+	s.readOnly = true
+	s.spaces[DefaultFileID].readOnly = true
+	return s
+}
+
+// ReadOnly reports whether pages of the tablespace can be modified, so
+// structures built on the buffer manager can refuse updates up front
+// instead of failing halfway through one.
+func (bm *BufferManager) ReadOnly(fileID FileID) bool {
+	ts, exists := bm.spaces.get(fileID)
+	return exists && ts.readOnly
+}
+
+// checkWritable fails if pages of the tablespace must not be dirtied.
+func (bm *BufferManager) checkWritable(fileID FileID) error {
+	if bm.ReadOnly(fileID) {
+		return ErrReadOnly
+	}
+	return nil
+}
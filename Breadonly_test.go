@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnlyTablespace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ro")
+	bm := NewBufferManager()
+	fileID, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := fillPages(t, bm, fileID, 10)
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bm = NewBufferManagerWithOptions(ManagerOptions{Frames: 4})
+	if _, err := bm.CreateTablespace(filepath.Join(t.TempDir(), "missing"), WithReadOnly()); err == nil {
+		t.Error("read-only open of a missing file succeeded")
+	}
+	roID, err := bm.CreateTablespace(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bm.ReadOnly(roID) || bm.ReadOnly(DefaultFileID) || bm.ReadOnly(roID+1) {
+		t.Errorf("ReadOnly of the read-only, default and a missing tablespace = %v, %v, %v",
+			bm.ReadOnly(roID), bm.ReadOnly(DefaultFileID), bm.ReadOnly(roID+1))
+	}
+	for i := range ids {
+		ids[i] = MakePageID(roID, ids[i].PageNo())
+	}
+	for _, pageID := range ids {
+		data, err := bm.PinPage(pageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *data != *stamp(uint64(MakePageID(fileID, pageID.PageNo()))) {
+			t.Fatalf("page %d lost its contents", pageID.PageNo())
+		}
+		// The pin goes even though the change is refused
+		data[0] ^= 0xff
+		if err := bm.UnpinPage(pageID, true); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("dirty UnpinPage: %v, want ErrReadOnly", err)
+		}
+	}
+	if s := bm.Stats(); s.Pinned != 0 || s.Dirty != 0 {
+		t.Errorf("%d pages pinned and %d dirty after refused changes", s.Pinned, s.Dirty)
+	}
+	if _, _, err := bm.NewPageIn(roID); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("NewPageIn: %v, want ErrReadOnly", err)
+	}
+	if _, _, err := bm.NewPagesIn(roID, 3); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("NewPagesIn: %v, want ErrReadOnly", err)
+	}
+	if err := bm.DropTablespace(roID); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("DropTablespace: %v, want ErrReadOnly", err)
+	}
+	// Other tablespaces still take changes
+	fillPages(t, bm, DefaultFileID, 2)
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.ReadFile(path); err != nil || !bytes.Equal(after, before) {
+		t.Errorf("read-only tablespace file changed: %v", err)
+	}
+}
+
+func TestReadOnlyBufferManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ro")
+	bm := NewBufferManager()
+	fileID, _ := bm.CreateTablespace(path)
+	fillPages(t, bm, fileID, 3)
+	bm.Close()
+
+	bm = NewReadOnlyBufferManager()
+	defer bm.Close()
+	if !bm.ReadOnly(DefaultFileID) {
+		t.Error("default tablespace of a read-only manager is writable")
+	}
+	if _, _, err := bm.NewPage(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("NewPage: %v, want ErrReadOnly", err)
+	}
+	roID, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bm.ReadOnly(roID) {
+		t.Error("tablespace opened by a read-only manager is writable")
+	}
+	if n, err := bm.PageCount(roID); err != nil || n != 3 {
+		t.Errorf("PageCount = %d, %v, want 3", n, err)
+	}
+	attached, err := bm.AttachTablespace(NewMemoryBackend())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bm.NewPageIn(attached); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("NewPageIn an attached tablespace: %v, want ErrReadOnly", err)
+	}
+
+	// A writable manager may attach a read-only backend
+	bm2 := NewBufferManager()
+	attached, _ = bm2.AttachTablespace(NewMemoryBackend(), WithReadOnly())
+	if _, _, err := bm2.NewPageIn(attached); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("NewPageIn an attached read-only tablespace: %v, want ErrReadOnly", err)
+	}
+}
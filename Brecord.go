@@ -0,0 +1,384 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Type is the type of a column.
+type Type uint8
+
+const (
+	Int64 Type = iota + 1
+	Float64
+	String
+	Bytes
+	Bool
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int64:
+		return "int64"
+	case Float64:
+		return "float64"
+	case String:
+		return "string"
+	case Bytes:
+		return "bytes"
+	case Bool:
+		return "bool"
+	}
+	return fmt.Sprintf("Type(%d)", uint8(t))
+}
+
+// Column describes a column of a schema.
+type Column struct {
+	Name     string
+	Type     Type
+	Nullable bool
+}
+
+// Schema is the list of columns of a row. Rows are []any holding, per
+// column, an int64 (or int), float64, string, []byte or bool, or nil for
+// NULL in a nullable column.
+type Schema struct {
+	columns  []Column
+	nullable int // nullable columns, one bit each in the NULL bitmap
+}
+
+// Row is the values of a row, in the order of its schema's columns.
+type Row []any
+
+var errCorrupt = errors.New("record: corrupt encoding")
+
+// NewSchema returns the schema of columns, which must have distinct,
+// non-empty names and known types.
+func NewSchema(columns ...Column) (*Schema, error) {
+	s := &Schema{columns: append([]Column(nil), columns...)}
+	seen := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		if c.Name == "" || seen[c.Name] {
+			return nil, fmt.Errorf("record: column name %q empty or repeated", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Type < Int64 || c.Type > Bool {
+			return nil, fmt.Errorf("record: column %q has unknown type %v", c.Name, c.Type)
+		}
+		if c.Nullable {
+			s.nullable++
+		}
+	}
+	return s, nil
+}
+
+// Columns returns the schema's columns.
+func (s *Schema) Columns() []Column {
+	return append([]Column(nil), s.columns...)
+}
+
+// Index returns the position of the column called name, or -1.
+func (s *Schema) Index(name string) int {
+	for i, c := range s.columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// check returns row's values normalized to their column's Go type.
+func (s *Schema) check(row Row) (Row, error) {
+	if len(row) != len(s.columns) {
+		return nil, fmt.Errorf("record: row has %d values for %d columns", len(row), len(s.columns))
+	}
+	out := make(Row, len(row))
+	for i, v := range row {
+		c := s.columns[i]
+		if v == nil {
+			if !c.Nullable {
+				return nil, fmt.Errorf("record: column %q is not nullable", c.Name)
+			}
+			continue
+		}
+		ok := false
+		switch c.Type {
+		case Int64:
+			switch n := v.(type) {
+			case int64:
+				out[i], ok = n, true
+			case int:
+				out[i], ok = int64(n), true
+			}
+		case Float64:
+			out[i], ok = v.(float64)
+		case String:
+			out[i], ok = v.(string)
+		case Bytes:
+			out[i], ok = v.([]byte)
+		case Bool:
+			out[i], ok = v.(bool)
+		}
+		if !ok {
+			return nil, fmt.Errorf("record: column %q is %v, got %T", c.Name, c.Type, v)
+		}
+	}
+	return out, nil
+}
+
+// Encode appends row to dst in the compact format, for heap file records:
+// a bitmap of the nullable columns that are NULL, then each non-NULL value
+// in column order: integers as zigzag varints, floats as 8 bytes, bools as
+// one, strings and bytes as a varint length and their contents.
+func (s *Schema) Encode(dst []byte, row Row) ([]byte, error) {
+	row, err := s.check(row)
+	if err != nil {
+		return dst, err
+	}
+	bitmap := len(dst)
+	dst = append(dst, make([]byte, (s.nullable+7)/8)...)
+	bit := 0
+	for i, v := range row {
+		if s.columns[i].Nullable {
+			if v == nil {
+				dst[bitmap+bit/8] |= 1 << (bit % 8)
+				bit++
+				continue
+			}
+			bit++
+		}
+		switch v := v.(type) {
+		case int64:
+			dst = binary.AppendVarint(dst, v)
+		case float64:
+			dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+		case bool:
+			dst = append(dst, boolByte(v))
+		case string:
+			dst = binary.AppendUvarint(dst, uint64(len(v)))
+			dst = append(dst, v...)
+		case []byte:
+			dst = binary.AppendUvarint(dst, uint64(len(v)))
+			dst = append(dst, v...)
+		}
+	}
+	return dst, nil
+}
+
+// Decode reads a row written by Encode. Bytes values are copied.
+func (s *Schema) Decode(buf []byte) (Row, error) {
+	n := (s.nullable + 7) / 8
+	if len(buf) < n {
+		return nil, errCorrupt
+	}
+	bitmap, buf := buf[:n], buf[n:]
+	row := make(Row, len(s.columns))
+	bit := 0
+	for i, c := range s.columns {
+		if c.Nullable {
+			null := bitmap[bit/8]&(1<<(bit%8)) != 0
+			bit++
+			if null {
+				continue
+			}
+		}
+		switch c.Type {
+		case Int64:
+			v, k := binary.Varint(buf)
+			if k <= 0 {
+				return nil, errCorrupt
+			}
+			row[i], buf = v, buf[k:]
+		case Float64:
+			if len(buf) < 8 {
+				return nil, errCorrupt
+			}
+			row[i], buf = math.Float64frombits(binary.LittleEndian.Uint64(buf)), buf[8:]
+		case Bool:
+			if len(buf) < 1 || buf[0] > 1 {
+				return nil, errCorrupt
+			}
+			row[i], buf = buf[0] == 1, buf[1:]
+		case String, Bytes:
+			l, k := binary.Uvarint(buf)
+			if k <= 0 || uint64(len(buf)-k) < l {
+				return nil, errCorrupt
+			}
+			data := buf[k : k+int(l)]
+			if c.Type == String {
+				row[i] = string(data)
+			} else {
+				row[i] = bytes.Clone(data)
+			}
+			buf = buf[k+int(l):]
+		}
+	}
+	if len(buf) != 0 {
+		return nil, errCorrupt
+	}
+	return row, nil
+}
+
+// Key encoding: bytes.Compare of two keys orders them as their rows,
+// column by column, so variable-length index keys can be compared
+// without decoding. A nullable column starts with a marker, NULL first;
+// integers are 8 big-endian bytes with the sign bit flipped; floats their
+// bits, flipped so that negatives come first (-0 as 0, NaNs last); bools
+// one byte; strings and bytes their contents with 0x00 escaped as 0x00
+// 0xff, ended by 0x00 0x01, so a prefix sorts before what extends it.
+const (
+	keyNull    = 0x00
+	keyPresent = 0x01
+	keyEscape  = 0xff
+	keyEnd     = 0x01
+)
+
+// EncodeKey appends row to dst in the order-preserving key format.
+func (s *Schema) EncodeKey(dst []byte, row Row) ([]byte, error) {
+	row, err := s.check(row)
+	if err != nil {
+		return dst, err
+	}
+	for i, v := range row {
+		if s.columns[i].Nullable {
+			if v == nil {
+				dst = append(dst, keyNull)
+				continue
+			}
+			dst = append(dst, keyPresent)
+		}
+		switch v := v.(type) {
+		case int64:
+			dst = binary.BigEndian.AppendUint64(dst, uint64(v)^1<<63)
+		case float64:
+			dst = binary.BigEndian.AppendUint64(dst, floatKey(v))
+		case bool:
+			dst = append(dst, boolByte(v))
+		case string:
+			dst = appendKeyBytes(dst, []byte(v))
+		case []byte:
+			dst = appendKeyBytes(dst, v)
+		}
+	}
+	return dst, nil
+}
+
+// DecodeKey reads a row written by EncodeKey. A NaN comes back as the
+// canonical NaN, -0 as 0.
+func (s *Schema) DecodeKey(buf []byte) (Row, error) {
+	row := make(Row, len(s.columns))
+	for i, c := range s.columns {
+		if c.Nullable {
+			if len(buf) < 1 || buf[0] > keyPresent {
+				return nil, errCorrupt
+			}
+			null := buf[0] == keyNull
+			buf = buf[1:]
+			if null {
+				continue
+			}
+		}
+		switch c.Type {
+		case Int64:
+			if len(buf) < 8 {
+				return nil, errCorrupt
+			}
+			row[i], buf = int64(binary.BigEndian.Uint64(buf)^1<<63), buf[8:]
+		case Float64:
+			if len(buf) < 8 {
+				return nil, errCorrupt
+			}
+			row[i], buf = floatFromKey(binary.BigEndian.Uint64(buf)), buf[8:]
+		case Bool:
+			if len(buf) < 1 || buf[0] > 1 {
+				return nil, errCorrupt
+			}
+			row[i], buf = buf[0] == 1, buf[1:]
+		case String, Bytes:
+			data, rest, ok := readKeyBytes(buf)
+			if !ok {
+				return nil, errCorrupt
+			}
+			if c.Type == String {
+				row[i] = string(data)
+			} else {
+				row[i] = data
+			}
+			buf = rest
+		}
+	}
+	if len(buf) != 0 {
+		return nil, errCorrupt
+	}
+	return row, nil
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func floatKey(f float64) uint64 {
+	switch {
+	case math.IsNaN(f):
+		return math.MaxUint64
+	case f == 0:
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
+
+func floatFromKey(k uint64) float64 {
+	if k == math.MaxUint64 {
+		return math.NaN()
+	}
+	if k&(1<<63) != 0 {
+		return math.Float64frombits(k &^ (1 << 63))
+	}
+	return math.Float64frombits(^k)
+}
+
+func appendKeyBytes(dst, b []byte) []byte {
+	for _, c := range b {
+		dst = append(dst, c)
+		if c == 0 {
+			dst = append(dst, keyEscape)
+		}
+	}
+	return append(dst, 0, keyEnd)
+}
+
+func readKeyBytes(buf []byte) ([]byte, []byte, bool) {
+	var out []byte
+	for i := 0; i < len(buf); i++ {
+		if buf[i] != 0 {
+			out = append(out, buf[i])
+			continue
+		}
+		if i+1 == len(buf) {
+			return nil, nil, false
+		}
+		switch buf[i+1] {
+		case keyEscape:
+			out = append(out, 0)
+			i++
+		case keyEnd:
+			if out == nil {
+				out = []byte{}
+			}
+			return out, buf[i+2:], true
+		default:
+			return nil, nil, false
+		}
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,216 @@
+package record
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+var testSchema = mustSchema(
+	Column{Name: "id", Type: Int64},
+	Column{Name: "score", Type: Float64, Nullable: true},
+	Column{Name: "name", Type: String},
+	Column{Name: "blob", Type: Bytes, Nullable: true},
+	Column{Name: "ok", Type: Bool},
+)
+
+func mustSchema(columns ...Column) *Schema {
+	s, err := NewSchema(columns...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+var (
+	someInts    = []int64{math.MinInt64, -300, -1, 0, 1, 255, 256, math.MaxInt64}
+	someFloats  = []float64{math.Inf(-1), -1e300, -2.5, -1e-300, 0, 1e-300, 2.5, 1e300, math.Inf(1), math.NaN()}
+	someStrings = []string{"", "\x00", "\x00\x00", "\x00\x01", "a", "a\x00", "a\x00b", "a\x01", "a\xff", "ab", "b"}
+)
+
+// randomRow picks each value from the lists above, or NULL.
+func randomRow(r *rand.Rand) Row {
+	row := Row{
+		someInts[r.IntN(len(someInts))],
+		someFloats[r.IntN(len(someFloats))],
+		someStrings[r.IntN(len(someStrings))],
+		[]byte(someStrings[r.IntN(len(someStrings))]),
+		r.IntN(2) == 1,
+	}
+	if r.IntN(4) == 0 {
+		row[1] = nil
+	}
+	if r.IntN(4) == 0 {
+		row[3] = nil
+	}
+	return row
+}
+
+// compareRows orders rows as their keys should: column by column, NULL
+// first, NaN last.
+func compareRows(a, b Row) int {
+	for i := range a {
+		if a[i] == nil || b[i] == nil {
+			if c := cmp.Compare(boolByte(a[i] != nil), boolByte(b[i] != nil)); c != 0 {
+				return c
+			}
+			continue
+		}
+		var c int
+		switch x := a[i].(type) {
+		case int64:
+			c = cmp.Compare(x, b[i].(int64))
+		case float64:
+			y := b[i].(float64)
+			c = cmp.Compare(boolByte(math.IsNaN(x)), boolByte(math.IsNaN(y)))
+			if c == 0 && !math.IsNaN(x) {
+				c = cmp.Compare(x, y)
+			}
+		case string:
+			c = cmp.Compare(x, b[i].(string))
+		case []byte:
+			c = bytes.Compare(x, b[i].([]byte))
+		case bool:
+			c = cmp.Compare(boolByte(x), boolByte(b[i].(bool)))
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func sameRow(a, b Row) bool {
+	for i := range a {
+		if x, ok := a[i].(float64); ok && math.IsNaN(x) {
+			if y, ok := b[i].(float64); !ok || !math.IsNaN(y) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 500 {
+		row := randomRow(r)
+		buf, err := testSchema.Encode(nil, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := testSchema.Decode(buf)
+		if err != nil {
+			t.Fatalf("Decode(Encode(%v)): %v", row, err)
+		}
+		if !sameRow(got, row) {
+			t.Fatalf("Decode(Encode(%v)) = %v", row, got)
+		}
+		for n := range len(buf) {
+			if _, err := testSchema.Decode(buf[:n]); err == nil {
+				t.Errorf("decoded %v cut to %d of %d bytes", row, n, len(buf))
+			}
+		}
+		if _, err := testSchema.Decode(append(buf, 0)); err == nil {
+			t.Errorf("decoded %v with a trailing byte", row)
+		}
+	}
+}
+
+func TestEncodeKeyOrder(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	rows := make([]Row, 400)
+	keys := make([][]byte, len(rows))
+	for i := range rows {
+		rows[i] = randomRow(r)
+		key, err := testSchema.EncodeKey(nil, rows[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	for i := range rows {
+		for j := range rows {
+			want := compareRows(rows[i], rows[j])
+			if got := bytes.Compare(keys[i], keys[j]); got != want {
+				t.Fatalf("keys of %v and %v compare %d, want %d", rows[i], rows[j], got, want)
+			}
+		}
+	}
+
+	for i, key := range keys {
+		got, err := testSchema.DecodeKey(key)
+		if err != nil {
+			t.Fatalf("DecodeKey(EncodeKey(%v)): %v", rows[i], err)
+		}
+		if !sameRow(got, rows[i]) {
+			t.Fatalf("DecodeKey(EncodeKey(%v)) = %v", rows[i], got)
+		}
+		for n := range len(key) {
+			if _, err := testSchema.DecodeKey(key[:n]); err == nil {
+				t.Fatalf("decoded key of %v cut to %d of %d bytes", rows[i], n, len(key))
+			}
+		}
+	}
+}
+
+func TestEncodeKeyNegativeZero(t *testing.T) {
+	s := mustSchema(Column{Name: "f", Type: Float64})
+	neg, _ := s.EncodeKey(nil, Row{math.Copysign(0, -1)})
+	pos, _ := s.EncodeKey(nil, Row{0.0})
+	if !bytes.Equal(neg, pos) {
+		t.Errorf("-0 encodes as %x, 0 as %x", neg, pos)
+	}
+	// Sorting the encoded floats sorts the floats
+	var keys [][]byte
+	for _, f := range someFloats {
+		key, _ := s.EncodeKey(nil, Row{f})
+		keys = append(keys, key)
+	}
+	if !slices.IsSortedFunc(keys, bytes.Compare) {
+		t.Error("keys of ascending floats are out of order")
+	}
+}
+
+func TestSchemaChecks(t *testing.T) {
+	if _, err := NewSchema(Column{Name: "a", Type: Int64}, Column{Name: "a", Type: Bool}); err == nil {
+		t.Error("NewSchema accepted a repeated name")
+	}
+	if _, err := NewSchema(Column{Name: "a", Type: Type(9)}); err == nil {
+		t.Error("NewSchema accepted an unknown type")
+	}
+	if i := testSchema.Index("name"); i != 2 {
+		t.Errorf("Index(name) = %d, want 2", i)
+	}
+
+	for _, row := range []Row{
+		{int64(1), 1.0, "x", nil},              // too few values
+		{nil, 1.0, "x", nil, true},             // NULL in a column that is not nullable
+		{"1", 1.0, "x", nil, true},             // wrong type
+		{int64(1), float32(1), "x", nil, true}, // float32 is not float64
+	} {
+		if _, err := testSchema.Encode(nil, row); err == nil {
+			t.Errorf("Encode accepted %v", row)
+		}
+		if _, err := testSchema.EncodeKey(nil, row); err == nil {
+			t.Errorf("EncodeKey accepted %v", row)
+		}
+	}
+
+	// An int is taken for an int64
+	buf, err := testSchema.Encode(nil, Row{7, nil, "x", nil, false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row, _ := testSchema.Decode(buf); row[0] != int64(7) {
+		t.Errorf("int 7 decoded as %#v", row[0])
+	}
+}
@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReplayPolicy selects the eviction policy simulated by ReplayTrace.
+type ReplayPolicy int
+
+const (
+	ReplayClock ReplayPolicy = iota // the BufferManager's own policy
+	ReplayLRU
+	ReplayFIFO
+)
+
+func (p ReplayPolicy) String() string {
+	switch p {
+	case ReplayClock:
+		return "clock"
+	case ReplayLRU:
+		return "lru"
+	case ReplayFIFO:
+		return "fifo"
+	}
+	return fmt.Sprintf("ReplayPolicy(%d)", int(p))
+}
+
+// ParseReplayPolicy parses the names printed by ReplayPolicy.String.
+func ParseReplayPolicy(name string) (ReplayPolicy, error) {
+	for _, p := range []ReplayPolicy{ReplayClock, ReplayLRU, ReplayFIFO} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown replay policy %q", name)
+}
+
+// ReplayResult summarizes a simulated run of a trace.
+type ReplayResult struct {
+	Pins           uint64
+	Hits           uint64
+	Misses         uint64
+	NewPages       uint64
+	Evictions      uint64
+	DirtyEvictions uint64 // evictions that would have cost a write
+	Stalls         uint64 // accesses that found every frame pinned
+}
+
+func (r ReplayResult) HitRate() float64 {
+	if r.Pins == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Pins)
+}
+
+type simFrame struct {
+	pageID   PageID
+	valid    bool
+	pinCount int
+	refBit   bool
+	dirty    bool
+	lastUse  uint64
+	loadedAt uint64
+}
+
+type simPool struct {
+	policy ReplayPolicy
+	frames []simFrame
+	table  map[PageID]int
+	hand   int
+	tick   uint64
+	result ReplayResult
+}
+
+// ReplayTrace re-runs a trace recorded by StartTrace against a simulated
+// pool of the given size and policy, without touching any data.
+func ReplayTrace(r io.Reader, frames int, policy ReplayPolicy) (ReplayResult, error) {
+	if frames <= 0 {
+		return ReplayResult{}, fmt.Errorf("invalid pool size %d", frames)
+	}
+	sim := &simPool{
+		policy: policy,
+		frames: make([]simFrame, frames),
+		table:  make(map[PageID]int),
+	}
+	err := ReadTrace(r, func(ev TraceEvent) error {
+		sim.apply(ev)
+		return nil
+	})
+	return sim.result, err
+}
+
+func (s *simPool) apply(ev TraceEvent) {
+	s.tick++
+	switch ev.Op {
+	case TracePin:
+		s.result.Pins++
+		if idx, exists := s.table[ev.PageID]; exists {
+			s.result.Hits++
+			s.touch(idx)
+			return
+		}
+		s.result.Misses++
+		s.load(ev.PageID, false)
+	case TraceNew:
+		s.result.NewPages++
+		s.load(ev.PageID, true)
+	case TraceUnpin:
+		if idx, exists := s.table[ev.PageID]; exists {
+			f := &s.frames[idx]
+			if f.pinCount > 0 {
+				f.pinCount--
+			}
+			f.dirty = f.dirty || ev.Dirty
+		}
+	}
+}
+
+func (s *simPool) touch(idx int) {
+	f := &s.frames[idx]
+	f.pinCount++
+	f.refBit = true
+	f.lastUse = s.tick
+}
+
+func (s *simPool) load(pageID PageID, dirty bool) {
+	idx, ok := s.victim()
+	if !ok {
+		s.result.Stalls++
+		return
+	}
+	f := &s.frames[idx]
+	if f.valid {
+		s.result.Evictions++
+		if f.dirty {
+			s.result.DirtyEvictions++
+		}
+		delete(s.table, f.pageID)
+	}
+	*f = simFrame{pageID: pageID, valid: true, dirty: dirty, loadedAt: s.tick}
+	s.table[pageID] = idx
+	s.touch(idx)
+}
+
+func (s *simPool) victim() (int, bool) {
+	if s.policy == ReplayClock {
+		n := len(s.frames)
+		for i := 0; i < 2*n; i++ {
+			idx := (s.hand + i) % n
+			f := &s.frames[idx]
+			if f.pinCount > 0 {
+				continue
+			}
+			if f.refBit {
+				f.refBit = false
+				continue
+			}
+			s.hand = (idx + 1) % n
+			return idx, true
+		}
+		return 0, false
+	}
+
+	best := -1
+	for idx := range s.frames {
+		f := &s.frames[idx]
+		if !f.valid {
+			return idx, true
+		}
+		if f.pinCount > 0 {
+			continue
+		}
+		if best < 0 || s.age(f) < s.age(&s.frames[best]) {
+			best = idx
+		}
+	}
+	return best, best >= 0
+}
+
+// age orders frames for LRU and FIFO: the smallest value is evicted first.
+func (s *simPool) age(f *simFrame) uint64 {
+	if s.policy == ReplayFIFO {
+		return f.loadedAt
+	}
+	return f.lastUse
+}
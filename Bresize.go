@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"errors"
+	"sort"
+)
+
+// Frames returns the current number of frames in the pool.
+func (bm *BufferManager) Frames() int {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return len(bm.frames)
+}
+
+// Resize grows or shrinks the buffer pool to newFrames frames. Shrinking
+// keeps pinned and recently used pages and writes back the dirty pages it
+// evicts; it fails if more than newFrames pages are pinned, or held by
+// HoldDirtyPages.
+func (bm *BufferManager) Resize(newFrames int) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if newFrames <= 0 {
+		return errors.New("buffer pool needs at least one frame")
+	}
+
+	if newFrames >= len(bm.frames) {
+		bm.frames = append(bm.frames, bm.newFrames(newFrames-len(bm.frames))...)
+		return nil
+	}
+
+	// Order frames by how much we want to keep them
+	order := make([]*bufferPage, len(bm.frames))
+	copy(order, bm.frames)
+	// Ranks are taken once up front, lock-free pins may change them
+	rank := make(map[*bufferPage]int, len(order))
+	for _, f := range order {
+		switch {
+		case f.pinned(), f.valid && f.isDirty && bm.holdDirty:
+			rank[f] = 0
+		case f.valid && f.refBit.Load() && !f.scan:
+			rank[f] = 1
+		case f.valid && !f.scan:
+			rank[f] = 2
+		case f.valid:
+			rank[f] = 3
+		default:
+			rank[f] = 4
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rank[order[i]] < rank[order[j]]
+	})
+
+	dropped := order[newFrames:]
+	unlock := func(frames []*bufferPage) {
+		for _, frame := range frames {
+			frame.pins.Store(0)
+		}
+	}
+	for i, frame := range dropped {
+		if !frame.tryLock() {
+			unlock(dropped[:i])
+			return errors.New("too many pinned pages to shrink")
+		}
+		if frame.valid && frame.isDirty && bm.holdDirty {
+			unlock(dropped[:i+1])
+			return errors.New("too many held dirty pages to shrink")
+		}
+	}
+
+	for _, frame := range dropped {
+		if frame.valid && frame.isDirty {
+			if err := bm.writeBack(frame); err != nil {
+				unlock(dropped)
+				return err
+			}
+		}
+	}
+	for _, frame := range dropped {
+		if frame.valid {
+			bm.unmapPage(frame.pageID)
+			bm.stats.evictions.Add(1)
+			bm.notifyEvict(frame.pageID, false)
+		}
+	}
+
+	bm.frames = order[:newFrames:newFrames]
+	for idx, frame := range bm.frames {
+		if frame.valid {
+			bm.pageTable[frame.pageID] = idx
+		}
+	}
+	bm.clockHand = 0
+	bm.scanVictims = nil
+	bm.compactFrames()
+	return nil
+}
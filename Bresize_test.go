@@ -0,0 +1,78 @@
+package manager
+
+import "testing"
+
+func TestResize(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	ids := fillPages(t, bm, DefaultFileID, 8)
+
+	// Growing keeps every page and makes room for more
+	if err := bm.Resize(16); err != nil {
+		t.Fatal(err)
+	}
+	if bm.Frames() != 16 {
+		t.Errorf("Frames = %d after growing to 16", bm.Frames())
+	}
+	ids = append(ids, fillPages(t, bm, DefaultFileID, 8)...)
+	if s := bm.Stats(); s.Evictions != 0 || s.Resident != 16 {
+		t.Errorf("grown pool: %d evictions, %d resident, want 0 and 16", s.Evictions, s.Resident)
+	}
+
+	// Shrinking keeps the pinned pages and the recently used ones, and
+	// writes back the dirty pages it drops
+	pinned := ids[3]
+	if _, err := bm.PinPage(pinned); err != nil {
+		t.Fatal(err)
+	}
+	// Clear the reference bits, as a sweep of the clock would, so that
+	// only the pages used since count as recent
+	for _, frame := range bm.frames {
+		frame.refBit.Store(false)
+	}
+	recent := ids[10:12]
+	checkPages(t, bm, recent)
+	if err := bm.Resize(3); err != nil {
+		t.Fatal(err)
+	}
+	s := bm.Stats()
+	if s.Frames != 3 || s.Resident != 3 || s.Evictions != 13 {
+		t.Errorf("shrunk pool: %d frames, %d resident, %d evictions, want 3, 3 and 13", s.Frames, s.Resident, s.Evictions)
+	}
+	misses := s.Misses
+	checkPages(t, bm, append([]PageID{pinned}, recent...))
+	if bm.Stats().Misses != misses {
+		t.Error("shrinking dropped a pinned or recently used page")
+	}
+	bm.UnpinPage(pinned, false)
+	checkPages(t, bm, ids)
+}
+
+func TestResizePinned(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	ids := fillPages(t, bm, DefaultFileID, 8)
+	for _, pageID := range ids[:4] {
+		if _, err := bm.PinPage(pageID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bm.Resize(3); err == nil {
+		t.Fatal("Resize below the pinned pages succeeded")
+	}
+	// The failed shrink changed nothing
+	if s := bm.Stats(); s.Frames != 8 || s.Resident != 8 || s.Pinned != 4 {
+		t.Errorf("after a failed shrink %d frames, %d resident, %d pinned", s.Frames, s.Resident, s.Pinned)
+	}
+	for _, pageID := range ids[:4] {
+		if err := bm.UnpinPage(pageID, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkPages(t, bm, ids)
+	if err := bm.Resize(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.Resize(0); err == nil {
+		t.Error("Resize to no frames succeeded")
+	}
+	checkPages(t, bm, ids)
+}
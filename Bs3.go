@@ -0,0 +1,192 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultS3Timeout bounds each request of an S3Client without an
+// HTTPClient of its own, so that a stalled connection fails the page
+// flush or WAL archive waiting on it instead of hanging it.
+const defaultS3Timeout = time.Minute
+
+var defaultS3Client = &http.Client{Timeout: defaultS3Timeout}
+
+// S3Client is a minimal ObjectStore for S3-compatible services (AWS S3,
+// MinIO, Ceph RGW, ...) using path-style requests signed with AWS
+// Signature Version 4.
+type S3Client struct {
+	Endpoint  string // e.g. "https://s3.eu-west-1.amazonaws.com"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// SessionToken goes with temporary credentials, such as those of an
+	// assumed IAM role, and is sent as X-Amz-Security-Token.
+	SessionToken string
+	// HTTPClient defaults to a client that times requests out after a
+	// minute.
+	HTTPClient *http.Client
+}
+
+func (c *S3Client) GetObject(key string) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if err := s3Error(resp); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (c *S3Client) PutObject(key string, data []byte) error {
+	resp, err := c.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(resp)
+}
+
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3: %s: %s", resp.Status, bytes.TrimSpace(body))
+}
+
+func (c *S3Client) do(method, key string, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// Sent exactly as signed: url's own escaping leaves characters such
+	// as '+' and '=' that SigV4 encodes
+	endpoint.Path = "/" + c.Bucket + "/" + key
+	endpoint.RawPath = uriEncode(endpoint.Path, false)
+
+	req, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.sign(req, body, time.Now().UTC())
+
+	client := c.HTTPClient
+	if client == nil {
+		client = defaultS3Client
+	}
+	return client.Do(req)
+}
+
+// sign adds the AWS Signature Version 4 headers to req.
+func (c *S3Client) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	headers := []string{
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+	}
+	if c.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", c.SessionToken)
+		signedHeaders += ";x-amz-security-token"
+		headers = append(headers, "x-amz-security-token:"+c.SessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		strings.Join(headers, "\n"),
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), day)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// uriEncode percent-encodes s as SigV4 does: every byte but the
+// unreserved A-Z, a-z, 0-9, '-', '.', '_' and '~', and '/' unless
+// encodeSlash, in upper-case hex.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '.', ch == '_', ch == '~', ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[ch>>4])
+			b.WriteByte(hexDigits[ch&15])
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery returns the query parameters encoded and sorted by name,
+// then value, each with its '=' even if empty.
+func canonicalQuery(query url.Values) string {
+	var params [][2]string
+	for name, values := range query {
+		for _, v := range values {
+			params = append(params, [2]string{uriEncode(name, true), uriEncode(v, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, p := range params {
+		encoded[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,73 @@
+package manager
+
+import "unsafe"
+
+// hugePageSize is the alignment of slabs backed by transparent huge pages.
+const hugePageSize = 2 << 20
+
+// ManagerOptions configures NewBufferManagerWithOptions.
+type ManagerOptions struct {
+	Frames int // pool size, default MaxFrames
+	// HugePages aligns the frame slab to 2MB and asks the kernel to back
+	// it with transparent huge pages (Linux only, ignored elsewhere).
+	HugePages bool
+}
+
+// NewBufferManagerWithOptions creates a buffer manager from opts.
+func NewBufferManagerWithOptions(opts ManagerOptions) *BufferManager {
+	if opts.Frames <= 0 {
+		opts.Frames = MaxFrames
+	}
+	bm := newBufferManager(newSpaceSet(), 0)
+	bm.hugePages = opts.HugePages
+	bm.frames = bm.newFrames(opts.Frames)
+	return bm
+}
+
+// newFrames allocates n frames whose pages lie back to back in one
+// page-aligned slab instead of n separate allocations. That keeps the pool
+// on few TLB entries, and direct I/O can read into and write from the
+// frames without a bounce buffer.
+func (bm *BufferManager) newFrames(n int) []*bufferPage {
+	if n == 0 {
+		return nil
+	}
+	var slab []byte
+	if bm.hugePages {
+		slab = alignedBufferTo(n*PageSize, hugePageSize)
+		adviseHugePages(slab)
+	} else {
+		slab = alignedBuffer(n * PageSize)
+	}
+
+	frames := make([]bufferPage, n)
+	ptrs := make([]*bufferPage, n)
+	for i := range frames {
+		frames[i].data = (*[PageSize]byte)(slab[i*PageSize:])
+		ptrs[i] = &frames[i]
+	}
+	return ptrs
+}
+
+// compactFrames moves the pages of all unpinned frames into one new slab
+// after a shrink, so the memory of the dropped frames can be freed. Pinned
+// frames keep their memory, and with it their old slab, for now.
+func (bm *BufferManager) compactFrames() {
+	var movable []*bufferPage
+	for _, frame := range bm.frames {
+		if frame.tryLock() {
+			movable = append(movable, frame)
+		}
+	}
+	fresh := bm.newFrames(len(movable))
+	for i, frame := range movable {
+		*fresh[i].data = *frame.data
+		frame.data = fresh[i].data
+		frame.pins.Store(0)
+	}
+}
+
+// isAligned reports whether b starts on a directIOAlign boundary.
+func isAligned(b []byte) bool {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b)))&(directIOAlign-1) == 0
+}
@@ -0,0 +1,8 @@
+package manager
+
+import "syscall"
+
+func adviseHugePages(b []byte) {
+	// Best effort: without THP support the slab just uses normal pages
+	syscall.Madvise(b, syscall.MADV_HUGEPAGE)
+}
@@ -0,0 +1,5 @@
+//go:build !linux
+
+package manager
+
+func adviseHugePages(b []byte) {}
@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// contiguous reports whether the frames' pages lie back to back in memory.
+func contiguous(frames []*bufferPage) bool {
+	for i := 1; i < len(frames); i++ {
+		if uintptr(unsafe.Pointer(frames[i].data)) != uintptr(unsafe.Pointer(frames[i-1].data))+PageSize {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSlab(t *testing.T) {
+	for _, huge := range []bool{false, true} {
+		bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 16, HugePages: huge})
+		align := uintptr(directIOAlign)
+		if huge {
+			align = hugePageSize
+		}
+		if len(bm.frames) != 16 || !contiguous(bm.frames) ||
+			uintptr(unsafe.Pointer(bm.frames[0].data))%align != 0 {
+			t.Errorf("huge pages %v: %d frames, not in one slab aligned to %d", huge, len(bm.frames), align)
+		}
+	}
+}
+
+func TestCompactFrames(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 16})
+	ids := fillPages(t, bm, DefaultFileID, 16)
+	pinned, err := bm.PinPage(ids[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bm.Resize(8); err != nil {
+		t.Fatal(err)
+	}
+	// The pinned page stays where its pinner sees it, the others move to
+	// a new slab of their own
+	var moved []*bufferPage
+	for _, frame := range bm.frames {
+		if frame.pageID == ids[3] {
+			if frame.data != pinned {
+				t.Error("shrink moved a pinned page")
+			}
+			continue
+		}
+		moved = append(moved, frame)
+	}
+	if len(moved) != 7 || !contiguous(moved) || !isAligned(moved[0].data[:]) {
+		t.Errorf("%d unpinned frames not compacted into one aligned slab", len(moved))
+	}
+	if s := bm.Stats(); s.Pinned != 1 {
+		t.Errorf("%d pages pinned after the shrink, want 1", s.Pinned)
+	}
+	bm.UnpinPage(ids[3], false)
+
+	// Grown frames come in a slab of their own
+	if err := bm.Resize(12); err != nil {
+		t.Fatal(err)
+	}
+	if !contiguous(bm.frames[8:]) {
+		t.Error("frames added by a resize are not in one slab")
+	}
+	checkPages(t, bm, ids)
+}
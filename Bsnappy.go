@@ -0,0 +1,177 @@
+package manager
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errSnappy = errors.New("malformed Snappy block")
+
+// Snappy block format: the decoded length as a uvarint, then literals and
+// back-references, each introduced by a tag byte whose low two bits give
+// its kind. Offsets never reach back further than snappyBlockSize, so the
+// encoder hashes one block of input at a time.
+const (
+	snappyBlockSize   = 1 << 16
+	snappyTableBits   = 14
+	snappyMinMatch    = 4
+	snappyTagLiteral  = 0
+	snappyTagCopy1    = 1 // 11-bit offset, length 4 to 11
+	snappyTagCopy2    = 2 // 16-bit offset, length 1 to 64
+	snappyTagCopy4    = 3 // 32-bit offset, length 1 to 64
+	snappyMaxCopy1Off = 1 << 11
+)
+
+// SnappyCompressor is a Compressor writing raw Snappy blocks, the format
+// without stream framing. It compresses less than FlateCompressor but
+// several times faster, which suits pages fetched on the hot path.
+type SnappyCompressor struct{}
+
+func (SnappyCompressor) Compress(dst, src []byte) ([]byte, error) {
+	dst = binary.AppendUvarint(dst[:0], uint64(len(src)))
+	for len(src) > 0 {
+		block := src[:min(len(src), snappyBlockSize)]
+		src = src[len(block):]
+		dst = snappyEncodeBlock(dst, block)
+	}
+	return dst, nil
+}
+
+// snappyEncodeBlock appends the encoding of src, at most snappyBlockSize
+// bytes, to dst. Matches are found greedily through a table of the last
+// position each hash of four bytes was seen at.
+func snappyEncodeBlock(dst, src []byte) []byte {
+	var table [1 << snappyTableBits]uint16
+	hash := func(i int) uint32 {
+		return binary.LittleEndian.Uint32(src[i:]) * 0x1e35a7bd >> (32 - snappyTableBits)
+	}
+	lit := 0 // start of the bytes not yet emitted
+	for i := 0; i+snappyMinMatch <= len(src); {
+		h := hash(i)
+		c := int(table[h])
+		table[h] = uint16(i)
+		if c >= i || binary.LittleEndian.Uint32(src[c:]) != binary.LittleEndian.Uint32(src[i:]) {
+			i++
+			continue
+		}
+		j := i + snappyMinMatch
+		for j < len(src) && src[j] == src[j-(i-c)] {
+			j++
+		}
+		dst = snappyLiteral(dst, src[lit:i])
+		dst = snappyCopy(dst, i-c, j-i)
+		i, lit = j, j
+	}
+	return snappyLiteral(dst, src[lit:])
+}
+
+func snappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	// Lengths less one up to 59 fit in the tag, longer ones follow it in
+	// 1 to 4 bytes, flagged by tags 60 to 63
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy appends a back-reference of length bytes at offset, split
+// into copies of at most 64 bytes with none left shorter than 4.
+func snappyCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 12 || offset >= snappyMaxCopy1Off {
+		return append(dst, byte(length-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|snappyTagCopy1, byte(offset))
+}
+
+// Decompress decodes a Snappy block. It checks every literal and
+// back-reference against the length the block starts with, so a corrupt
+// block fails instead of reading or writing out of bounds.
+func (SnappyCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	size, k := binary.Uvarint(src)
+	if k <= 0 || size > 1<<32-1 {
+		return nil, errSnappy
+	}
+	src = src[k:]
+	dst = dst[:0]
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case snappyTagLiteral:
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				// The length less one follows in length-59 bytes
+				w := length - 59
+				if len(src) < w {
+					return nil, errSnappy
+				}
+				length = 0
+				for i := w - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[w:]
+			}
+			length++
+			if length > len(src) || uint64(length) > size-uint64(len(dst)) {
+				return nil, errSnappy
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case snappyTagCopy1:
+			if len(src) < 2 {
+				return nil, errSnappy
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case snappyTagCopy2:
+			if len(src) < 3 {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case snappyTagCopy4:
+			if len(src) < 5 {
+				return nil, errSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || uint64(length) > size-uint64(len(dst)) {
+			return nil, errSnappy
+		}
+		// Copies may overlap their own output, repeating it
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, errSnappy
+	}
+	return dst, nil
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestSnappyRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	// Input repeating with a period of 100KB, so matches reach back across
+	// a block boundary, which the encoder must not reference
+	long := make([]byte, 3*snappyBlockSize+7)
+	period := noisePage(9)[:]
+	for i := range long {
+		long[i] = period[i%len(period)] ^ byte(i/(100<<10))
+	}
+	var runs []byte
+	for len(runs) < 20000 {
+		b := byte(r.IntN(4))
+		runs = append(runs, bytes.Repeat([]byte{b}, 1+r.IntN(300))...)
+	}
+	for _, tc := range []struct {
+		name string
+		src  []byte
+		max  int // largest acceptable encoding, 0 for any
+	}{
+		{"empty", nil, 1},
+		{"one byte", []byte{7}, 3},
+		{"short", []byte("abcabcabc"), 0},
+		{"text", textPage(3)[:], PageSize / 8},
+		{"zeros", make([]byte, PageSize), PageSize / 16},
+		{"noise", noisePage(4)[:], PageSize + 8},
+		{"runs", runs, len(runs) / 4},
+		{"blocks", long, 0},
+	} {
+		enc, err := SnappyCompressor{}.Compress(nil, tc.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.max > 0 && len(enc) > tc.max {
+			t.Errorf("%s: %d bytes encoded in %d, want at most %d", tc.name, len(tc.src), len(enc), tc.max)
+		}
+		dec, err := SnappyCompressor{}.Decompress(nil, enc)
+		if err != nil || !bytes.Equal(dec, tc.src) {
+			t.Errorf("%s: round trip gave %d bytes, %v", tc.name, len(dec), err)
+		}
+	}
+
+	// Pages decode into the buffer given, as readCompressed relies on
+	var page [PageSize]byte
+	enc, _ := SnappyCompressor{}.Compress(make([]byte, 0, 64), textPage(8)[:])
+	out, err := SnappyCompressor{}.Decompress(page[:0], enc)
+	if err != nil || &out[0] != &page[0] || page != *textPage(8) {
+		t.Errorf("Decompress into a page: %v", err)
+	}
+	if n := testing.AllocsPerRun(100, func() { SnappyCompressor{}.Decompress(page[:0], enc) }); n != 0 {
+		t.Errorf("Decompress into a page allocates %g times", n)
+	}
+}
+
+func TestSnappyMalformed(t *testing.T) {
+	enc, _ := SnappyCompressor{}.Compress(nil, textPage(1)[:])
+	for n := range len(enc) {
+		if _, err := (SnappyCompressor{}).Decompress(nil, enc[:n]); err == nil {
+			t.Fatalf("Decompress of the first %d of %d bytes succeeded", n, len(enc))
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		src  []byte
+	}{
+		{"length past 32 bits", []byte{0x80, 0x80, 0x80, 0x80, 0x10}},
+		{"copy before the start", []byte{4, 0x01 | 0<<2, 1}},
+		{"zero offset", []byte{5, 0, 'a', 0x01, 0}},
+		{"copy past the length", []byte{6, 0, 'a', 0x01 | 4<<2, 1}},
+		{"literal past the length", []byte{1, 1 << 2, 'a', 'b'}},
+		{"4-byte offset too far", []byte{4, 0, 'a', 0x03, 2, 0, 0, 0}},
+	} {
+		if got, err := (SnappyCompressor{}).Decompress(nil, tc.src); err == nil {
+			t.Errorf("%s: decoded %q", tc.name, got)
+		}
+	}
+
+	// Damage must not crash the decoder
+	r := rand.New(rand.NewPCG(7, 8))
+	for range 2000 {
+		b := bytes.Clone(enc)
+		for range 1 + r.IntN(3) {
+			b[r.IntN(len(b))] ^= byte(1 + r.IntN(255))
+		}
+		SnappyCompressor{}.Decompress(nil, b)
+	}
+}
@@ -0,0 +1,86 @@
+package manager
+
+import "sync/atomic"
+
+type bufferCounters struct {
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+	pagesRead    atomic.Uint64
+	pagesWritten atomic.Uint64
+	evictions    atomic.Uint64
+	allocated    atomic.Uint64
+}
+
+// BufferStats is a snapshot of buffer pool activity since creation.
+type BufferStats struct {
+	Hits           uint64 // pins served from the pool
+	Misses         uint64 // pins that had to read the page
+	PagesRead      uint64
+	PagesWritten   uint64
+	Evictions      uint64
+	PagesAllocated uint64
+	Frames         int
+	Resident       int
+	Pinned         int
+	Dirty          int
+}
+
+// HitRate returns the fraction of pins served without reading the page.
+func (s BufferStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func (s BufferStats) add(o BufferStats) BufferStats {
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.PagesRead += o.PagesRead
+	s.PagesWritten += o.PagesWritten
+	s.Evictions += o.Evictions
+	s.PagesAllocated += o.PagesAllocated
+	s.Frames += o.Frames
+	s.Resident += o.Resident
+	s.Pinned += o.Pinned
+	s.Dirty += o.Dirty
+	return s
+}
+
+func (bm *BufferManager) Stats() BufferStats {
+	s := BufferStats{
+		Hits:           bm.stats.hits.Load(),
+		Misses:         bm.stats.misses.Load(),
+		PagesRead:      bm.stats.pagesRead.Load(),
+		PagesWritten:   bm.stats.pagesWritten.Load(),
+		Evictions:      bm.stats.evictions.Load(),
+		PagesAllocated: bm.stats.allocated.Load(),
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	s.Frames = len(bm.frames)
+	for _, frame := range bm.frames {
+		if !frame.valid {
+			continue
+		}
+		s.Resident++
+		if frame.pinned() {
+			s.Pinned++
+		}
+		if frame.isDirty {
+			s.Dirty++
+		}
+	}
+	return s
+}
+
+// Stats sums the statistics of all partitions.
+func (bpm *BufferPoolManager) Stats() BufferStats {
+	var s BufferStats
+	for _, bm := range bpm.parts {
+		s = s.add(bm.Stats())
+	}
+	return s
+}
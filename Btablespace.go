@@ -0,0 +1,284 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	fileIDBits = 16
+	pageNoBits = 64 - fileIDBits
+	pageNoMask = 1<<pageNoBits - 1
+)
+
+// FileID identifies a tablespace. The upper 16 bits of every PageID carry
+// the FileID, the lower 48 bits the page number inside that file.
+type FileID uint16
+
+// DefaultFileID is the in-memory tablespace every BufferManager starts with.
+const DefaultFileID FileID = 0
+
+func MakePageID(fileID FileID, pageNo uint64) PageID {
+	return PageID(uint64(fileID)<<pageNoBits | pageNo&pageNoMask)
+}
+
+func (id PageID) FileID() FileID {
+	return FileID(uint64(id) >> pageNoBits)
+}
+
+func (id PageID) PageNo() uint64 {
+	return uint64(id) & pageNoMask
+}
+
+type tablespace struct {
+	id       FileID
+	path     string // empty unless the tablespace is a file
+	backend  StorageBackend
+	readOnly bool
+	faults   atomic.Pointer[FaultInjector] // nil unless InjectFaults
+	closed   atomic.Bool
+}
+
+func (ts *tablespace) allocate() (uint64, error) {
+	return ts.backend.Allocate()
+}
+
+// pageCount returns the number of pages allocated so far.
+func (ts *tablespace) pageCount() uint64 {
+	return ts.backend.PageCount()
+}
+
+func (ts *tablespace) readPage(pageNo uint64, buf *[PageSize]byte) error {
+	if fi := ts.faults.Load(); fi != nil {
+		return ts.faultyRead(fi, pageNo, buf)
+	}
+	return ts.backend.ReadPage(pageNo, buf)
+}
+
+func (ts *tablespace) writePage(pageNo uint64, buf *[PageSize]byte) error {
+	if fi := ts.faults.Load(); fi != nil {
+		return ts.faultyWrite(fi, pageNo, buf)
+	}
+	return ts.backend.WritePage(pageNo, buf)
+}
+
+func (ts *tablespace) close() error {
+	if !ts.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return ts.backend.Close()
+}
+
+// spaceSet is the registry of open tablespaces. The partitions of a
+// BufferPoolManager share one.
+type spaceSet struct {
+	mu         sync.Mutex
+	spaces     map[FileID]*tablespace
+	nextFileID FileID
+	readOnly   bool // every tablespace is opened read-only
+}
+
+func newSpaceSet() *spaceSet {
+	s := &spaceSet{
+		spaces:     make(map[FileID]*tablespace),
+		nextFileID: DefaultFileID + 1,
+	}
+	s.spaces[DefaultFileID] = &tablespace{id: DefaultFileID, backend: NewMemoryBackend()}
+	return s
+}
+
+func (s *spaceSet) get(id FileID) (*tablespace, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts, exists := s.spaces[id]
+	return ts, exists
+}
+
+func (s *spaceSet) create(path string, opts ...TablespaceOption) (FileID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ts := range s.spaces {
+		if ts.path != "" && ts.path == path {
+			return 0, errors.New("tablespace already open")
+		}
+	}
+	if s.readOnly {
+		opts = append(opts, WithReadOnly())
+	}
+	if s.nextFileID == 0 {
+		return 0, errors.New("too many tablespaces")
+	}
+
+	fb, err := OpenFileBackend(path, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return s.add(&tablespace{path: path, backend: fb, readOnly: fb.readOnly}), nil
+}
+
+func (s *spaceSet) attach(backend StorageBackend, opts ...TablespaceOption) (FileID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nextFileID == 0 {
+		return 0, errors.New("too many tablespaces")
+	}
+	readOnly := s.readOnly || applyOptions(opts).readOnly
+	return s.add(&tablespace{backend: backend, readOnly: readOnly}), nil
+}
+
+// add registers ts under the next free FileID. s.mu must be held.
+func (s *spaceSet) add(ts *tablespace) FileID {
+	ts.id = s.nextFileID
+	s.spaces[ts.id] = ts
+	s.nextFileID++
+	return ts.id
+}
+
+// drop unregisters the tablespace, closes its file and removes it.
+func (s *spaceSet) drop(id FileID) error {
+	s.mu.Lock()
+	ts, exists := s.spaces[id]
+	delete(s.spaces, id)
+	s.mu.Unlock()
+
+	if !exists {
+		return errors.New("tablespace does not exist")
+	}
+	if err := ts.close(); err != nil {
+		return err
+	}
+	if ts.path == "" {
+		return nil
+	}
+	return os.Remove(ts.path)
+}
+
+func (s *spaceSet) ids() []FileID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]FileID, 0, len(s.spaces))
+	for id := range s.spaces {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (s *spaceSet) syncAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, ts := range s.spaces {
+		if err := ts.backend.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *spaceSet) closeAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, ts := range s.spaces {
+		if err := ts.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// CreateTablespace opens (or creates) the file at path as a new tablespace
+// and returns its FileID. Pages are allocated in it with NewPageIn. A file
+// must always be reopened with the same options it was created with.
+func (bm *BufferManager) CreateTablespace(path string, opts ...TablespaceOption) (FileID, error) {
+	return bm.spaces.create(path, opts...)
+}
+
+// AttachTablespace registers a custom storage backend as a new tablespace.
+// Of the options only WithReadOnly applies; the backend is closed by Close
+// or DropTablespace.
+func (bm *BufferManager) AttachTablespace(backend StorageBackend, opts ...TablespaceOption) (FileID, error) {
+	return bm.spaces.attach(backend, opts...)
+}
+
+// Sync writes back every dirty page and makes all tablespaces durable,
+// with the write-backs still queued to the I/O workers.
+func (bm *BufferManager) Sync() error {
+	if err := bm.FlushAll(); err != nil {
+		return err
+	}
+	if err := bm.flushPendingWrites(); err != nil {
+		return err
+	}
+	return bm.spaces.syncAll()
+}
+
+// DropTablespace discards every cached page of the tablespace, closes its
+// file and removes it from disk. It fails while any of its pages is pinned.
+func (bm *BufferManager) DropTablespace(fileID FileID) error {
+	if fileID == DefaultFileID {
+		return errors.New("cannot drop default tablespace")
+	}
+	ts, exists := bm.spaces.get(fileID)
+	if !exists {
+		return errors.New("tablespace does not exist")
+	}
+	if ts.readOnly {
+		return ErrReadOnly
+	}
+
+	bm.mu.Lock()
+	if err := bm.checkDiscardable(fileID); err != nil {
+		bm.mu.Unlock()
+		return err
+	}
+	bm.discardPages(fileID)
+	bm.mu.Unlock()
+
+	return bm.spaces.drop(fileID)
+}
+
+// checkDiscardable fails if the tablespace's pages are still in use.
+// Otherwise it leaves their frames locked for discardPages.
+func (bm *BufferManager) checkDiscardable(fileID FileID) error {
+	if bm.hasPendingWrites(fileID) {
+		return errors.New("tablespace has pending writes")
+	}
+	return bm.lockFrames(fileID)
+}
+
+// discardPages drops the tablespace's cached pages without writing them.
+func (bm *BufferManager) discardPages(fileID FileID) {
+	for pageID, idx := range bm.pageTable {
+		if pageID.FileID() == fileID {
+			frame := bm.frames[idx]
+			dirty := frame.isDirty
+			frame.reuse(0)
+			bm.unmapPage(pageID)
+			frame.pins.Store(0)
+			bm.notifyEvict(pageID, dirty)
+		}
+	}
+}
+
+// PageCount returns the number of pages allocated in a tablespace, so that
+// page numbers 0 to PageCount-1 exist.
+func (bm *BufferManager) PageCount(fileID FileID) (uint64, error) {
+	ts, exists := bm.spaces.get(fileID)
+	if !exists {
+		return 0, errors.New("tablespace does not exist")
+	}
+	return ts.pageCount(), nil
+}
+
+// Tablespaces returns the IDs of all open tablespaces.
+func (bm *BufferManager) Tablespaces() []FileID {
+	return bm.spaces.ids()
+}
@@ -0,0 +1,184 @@
+package manager
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// fillPages allocates n pages in the tablespace, each stamped with its
+// own PageID, and unpins them dirty.
+func fillPages(t *testing.T, bm *BufferManager, fileID FileID, n int) []PageID {
+	t.Helper()
+	ids := make([]PageID, n)
+	for i := range ids {
+		pageID, data, err := bm.NewPageIn(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*data = *stamp(uint64(pageID))
+		if err := bm.UnpinPage(pageID, true); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = pageID
+	}
+	return ids
+}
+
+// checkPages pins each page and checks it holds its stamp.
+func checkPages(t *testing.T, bm *BufferManager, ids []PageID) {
+	t.Helper()
+	for _, pageID := range ids {
+		data, err := bm.PinPage(pageID)
+		if err != nil {
+			t.Fatalf("PinPage(%v): %v", pageID, err)
+		}
+		got := binary.BigEndian.Uint64(data[PageSize-8:])
+		if err := bm.UnpinPage(pageID, false); err != nil {
+			t.Fatal(err)
+		}
+		if *data != *stamp(uint64(pageID)) {
+			t.Fatalf("page %v holds the stamp of %v", pageID, PageID(got))
+		}
+	}
+}
+
+func TestPageID(t *testing.T) {
+	for _, tc := range []struct {
+		fileID FileID
+		pageNo uint64
+	}{
+		{0, 0}, {1, 5}, {0xffff, pageNoMask}, {7, 1 << 40},
+	} {
+		id := MakePageID(tc.fileID, tc.pageNo)
+		if id.FileID() != tc.fileID || id.PageNo() != tc.pageNo {
+			t.Errorf("MakePageID(%d, %d) splits into %d, %d", tc.fileID, tc.pageNo, id.FileID(), id.PageNo())
+		}
+	}
+	// Page numbers past 48 bits do not spill into the FileID
+	if id := MakePageID(3, 1<<48|9); id.FileID() != 3 || id.PageNo() != 9 {
+		t.Errorf("page number of 49 bits gave %d, %d", id.FileID(), id.PageNo())
+	}
+}
+
+func TestTablespaces(t *testing.T) {
+	dir := t.TempDir()
+	// A pool smaller than the pages written, so they go to their files
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	var files []FileID
+	pages := make(map[FileID][]PageID)
+	for _, path := range paths {
+		fileID, err := bm.CreateTablespace(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fileID)
+	}
+	pages[DefaultFileID] = fillPages(t, bm, DefaultFileID, 20)
+	for _, fileID := range files {
+		pages[fileID] = fillPages(t, bm, fileID, 20)
+	}
+	for fileID, ids := range pages {
+		checkPages(t, bm, ids)
+		if n, err := bm.PageCount(fileID); err != nil || n != 20 {
+			t.Errorf("PageCount(%d) = %d, %v, want 20", fileID, n, err)
+		}
+		for i, pageID := range ids {
+			if pageID.FileID() != fileID || pageID.PageNo() != uint64(i) {
+				t.Errorf("page %d of tablespace %d is %d:%d", i, fileID, pageID.FileID(), pageID.PageNo())
+			}
+		}
+	}
+	got := bm.Tablespaces()
+	slices.Sort(got)
+	if !slices.Equal(got, []FileID{DefaultFileID, files[0], files[1]}) {
+		t.Errorf("Tablespaces = %v", got)
+	}
+
+	if _, err := bm.CreateTablespace(paths[0]); err == nil {
+		t.Error("second CreateTablespace of an open file succeeded")
+	}
+	if _, err := bm.PinPage(MakePageID(files[0], 20)); err == nil {
+		t.Error("PinPage past the end of a tablespace succeeded")
+	}
+	if _, err := bm.PinPage(MakePageID(99, 0)); err == nil {
+		t.Error("PinPage in an unknown tablespace succeeded")
+	}
+	if _, _, err := bm.NewPageIn(99); err == nil {
+		t.Error("NewPageIn an unknown tablespace succeeded")
+	}
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files keep their pages for the next manager, whatever FileIDs
+	// it hands out
+	bm = NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	defer bm.Close()
+	for i := len(paths) - 1; i >= 0; i-- {
+		fileID, err := bm.CreateTablespace(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []PageID
+		for _, pageID := range pages[files[i]] {
+			ids = append(ids, MakePageID(fileID, pageID.PageNo()))
+		}
+		for _, pageID := range ids {
+			data, err := bm.PinPage(pageID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *data != *stamp(uint64(MakePageID(files[i], pageID.PageNo()))) {
+				t.Fatalf("reopened %s: page %d lost its contents", paths[i], pageID.PageNo())
+			}
+			bm.UnpinPage(pageID, false)
+		}
+	}
+}
+
+func TestDropTablespace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dropped")
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	defer bm.Close()
+	fileID, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := fillPages(t, bm, fileID, 4)
+	kept := fillPages(t, bm, DefaultFileID, 2)
+
+	if _, err := bm.PinPage(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.DropTablespace(fileID); err == nil {
+		t.Fatal("DropTablespace with a page pinned succeeded")
+	}
+	if err := bm.UnpinPage(ids[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.DropTablespace(fileID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file of a dropped tablespace: %v", err)
+	}
+	if _, err := bm.PinPage(ids[1]); err == nil {
+		t.Error("PinPage of a dropped tablespace's page succeeded")
+	}
+	// Its frames are free again, and other tablespaces keep theirs
+	if s := bm.Stats(); s.Resident != 2 || s.Dirty != 2 {
+		t.Errorf("after the drop %d pages resident and %d dirty, want 2 and 2", s.Resident, s.Dirty)
+	}
+	checkPages(t, bm, kept)
+
+	if err := bm.DropTablespace(fileID); err == nil {
+		t.Error("second DropTablespace succeeded")
+	}
+	if err := bm.DropTablespace(DefaultFileID); err == nil {
+		t.Error("DropTablespace of the default tablespace succeeded")
+	}
+}
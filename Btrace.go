@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// TraceOp is the kind of a recorded page access.
+type TraceOp uint8
+
+const (
+	TracePin TraceOp = iota + 1
+	TraceUnpin
+	TraceNew
+)
+
+// TraceEvent is one record of a page access trace.
+type TraceEvent struct {
+	Op     TraceOp
+	PageID PageID
+	Dirty  bool // for TraceUnpin
+}
+
+// A trace is traceMagic followed by fixed-size records:
+// op(1) + dirty(1) + pageID(8), big-endian.
+const (
+	traceMagic      = 0x42545243 // "BTRC"
+	traceRecordSize = 10
+)
+
+type tracer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (t *tracer) record(op TraceOp, pageID PageID, dirty bool) {
+	if t.err != nil {
+		return
+	}
+	var rec [traceRecordSize]byte
+	rec[0] = byte(op)
+	if dirty {
+		rec[1] = 1
+	}
+	binary.BigEndian.PutUint64(rec[2:], uint64(pageID))
+	_, t.err = t.w.Write(rec[:])
+}
+
+// StartTrace records every PinPage, UnpinPage and NewPage call to w until
+// StopTrace. The trace can be replayed offline with ReplayTrace.
+func (bm *BufferManager) StartTrace(w io.Writer) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.trace != nil {
+		return errors.New("trace already running")
+	}
+	bw := bufio.NewWriter(w)
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], traceMagic)
+	if _, err := bw.Write(header[:]); err != nil {
+		return err
+	}
+	bm.trace = &tracer{w: bw}
+	bm.updateFastPath()
+	return nil
+}
+
+// StopTrace ends tracing and flushes the trace writer.
+func (bm *BufferManager) StopTrace() error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	t := bm.trace
+	if t == nil {
+		return errors.New("no trace running")
+	}
+	bm.trace = nil
+	bm.updateFastPath()
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
+
+func (bm *BufferManager) traceEvent(op TraceOp, pageID PageID, dirty bool) {
+	if bm.trace != nil {
+		bm.trace.record(op, pageID, dirty)
+	}
+}
+
+// ReadTrace calls fn for every event of a trace written by StartTrace.
+func ReadTrace(r io.Reader, fn func(TraceEvent) error) error {
+	br := bufio.NewReader(r)
+	var header [4]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(header[:]) != traceMagic {
+		return errors.New("not a page access trace")
+	}
+
+	var rec [traceRecordSize]byte
+	for {
+		if _, err := io.ReadFull(br, rec[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		ev := TraceEvent{
+			Op:     TraceOp(rec[0]),
+			Dirty:  rec[1] != 0,
+			PageID: PageID(binary.BigEndian.Uint64(rec[2:])),
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
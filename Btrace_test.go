@@ -0,0 +1,165 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"testing"
+)
+
+// writeTrace returns a trace of events.
+func writeTrace(events ...TraceEvent) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(traceMagic))
+	tr := &tracer{w: bufio.NewWriter(&buf)}
+	for _, ev := range events {
+		tr.record(ev.Op, ev.PageID, ev.Dirty)
+	}
+	tr.w.Flush()
+	return buf.Bytes()
+}
+
+func TestTrace(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	var trace bytes.Buffer
+	if err := bm.StartTrace(&trace); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.StartTrace(io.Discard); err == nil {
+		t.Error("second StartTrace succeeded")
+	}
+	if bm.fastPath.Load() {
+		t.Error("lock-free pins, which are not traced, still on while tracing")
+	}
+	ids := fillPages(t, bm, DefaultFileID, 30)
+	r := rand.New(rand.NewPCG(1, 4))
+	for range 2000 {
+		// Mostly a hot set of 6 pages, which fits the pool
+		pageID := ids[r.IntN(6)]
+		if r.IntN(4) == 0 {
+			pageID = ids[r.IntN(len(ids))]
+		}
+		if _, err := bm.PinPage(pageID); err != nil {
+			t.Fatal(err)
+		}
+		bm.UnpinPage(pageID, r.IntN(10) == 0)
+	}
+	if err := bm.StopTrace(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.StopTrace(); err == nil {
+		t.Error("second StopTrace succeeded")
+	}
+	if !bm.fastPath.Load() {
+		t.Error("lock-free pins still off after the trace")
+	}
+
+	var counts [4]int
+	err := ReadTrace(bytes.NewReader(trace.Bytes()), func(ev TraceEvent) error {
+		counts[ev.Op]++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[TraceNew] != 30 || counts[TracePin] != 2000 || counts[TraceUnpin] != 2030 {
+		t.Errorf("trace holds %d new pages, %d pins and %d unpins", counts[TraceNew], counts[TracePin], counts[TraceUnpin])
+	}
+
+	// Replayed with the manager's own policy and size, the simulation
+	// sees what the manager saw
+	res, err := ReplayTrace(bytes.NewReader(trace.Bytes()), 8, ReplayClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := bm.Stats()
+	if res.Pins != 2000 || res.Hits != s.Hits || res.Misses != s.Misses || res.Evictions != s.Evictions || res.NewPages != 30 {
+		t.Errorf("replay: %+v; the manager had %d hits, %d misses, %d evictions", res, s.Hits, s.Misses, s.Evictions)
+	}
+	if res.HitRate() != s.HitRate() {
+		t.Errorf("replay hit rate %g, the manager's %g", res.HitRate(), s.HitRate())
+	}
+	// A pool that holds every page misses nothing
+	res, _ = ReplayTrace(bytes.NewReader(trace.Bytes()), 30, ReplayLRU)
+	if res.Misses != 0 || res.Evictions != 0 {
+		t.Errorf("replay in a pool big enough: %+v", res)
+	}
+}
+
+func TestReplayPolicies(t *testing.T) {
+	a, b, c := MakePageID(1, 0), MakePageID(1, 1), MakePageID(1, 2)
+	pin := func(id PageID) []TraceEvent {
+		return []TraceEvent{{Op: TracePin, PageID: id}, {Op: TraceUnpin, PageID: id}}
+	}
+	var events []TraceEvent
+	for _, id := range []PageID{a, b, a, c, a} {
+		events = append(events, pin(id)...)
+	}
+	trace := writeTrace(events...)
+	// At 2 frames C evicts B under LRU, as A was used since, but A under
+	// FIFO, as A came first
+	for _, tc := range []struct {
+		policy ReplayPolicy
+		hits   uint64
+	}{
+		{ReplayLRU, 2},
+		{ReplayFIFO, 1},
+	} {
+		res, err := ReplayTrace(bytes.NewReader(trace), 2, tc.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Hits != tc.hits || res.Misses != 5-tc.hits || res.Pins != 5 {
+			t.Errorf("%v: %+v, want %d hits", tc.policy, res, tc.hits)
+		}
+	}
+
+	// Dirty pages cost a write to evict, and pinned ones stall loads
+	trace = writeTrace(
+		TraceEvent{Op: TraceNew, PageID: a},
+		TraceEvent{Op: TraceUnpin, PageID: a, Dirty: true},
+		TraceEvent{Op: TracePin, PageID: b},
+		TraceEvent{Op: TracePin, PageID: c},
+	)
+	for _, policy := range []ReplayPolicy{ReplayClock, ReplayLRU, ReplayFIFO} {
+		res, err := ReplayTrace(bytes.NewReader(trace), 1, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.NewPages != 1 || res.DirtyEvictions != 1 || res.Stalls != 1 {
+			t.Errorf("%v: %+v, want a dirty eviction and a stall", policy, res)
+		}
+	}
+
+	for _, p := range []ReplayPolicy{ReplayClock, ReplayLRU, ReplayFIFO} {
+		if got, err := ParseReplayPolicy(p.String()); err != nil || got != p {
+			t.Errorf("ParseReplayPolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := ParseReplayPolicy("random"); err == nil {
+		t.Error("ParseReplayPolicy of an unknown policy succeeded")
+	}
+	if _, err := ReplayTrace(bytes.NewReader(trace), 0, ReplayLRU); err == nil {
+		t.Error("ReplayTrace in no frames succeeded")
+	}
+}
+
+func TestReadTraceErrors(t *testing.T) {
+	trace := writeTrace(TraceEvent{Op: TracePin, PageID: 7}, TraceEvent{Op: TraceUnpin, PageID: 7})
+	nop := func(TraceEvent) error { return nil }
+	if err := ReadTrace(bytes.NewReader(trace[:len(trace)-3]), nop); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadTrace of a cut record = %v", err)
+	}
+	if err := ReadTrace(bytes.NewReader([]byte("BTRX")), nop); err == nil {
+		t.Error("ReadTrace of a bad magic succeeded")
+	}
+	stop := errors.New("stop")
+	n := 0
+	err := ReadTrace(bytes.NewReader(trace), func(TraceEvent) error { n++; return stop })
+	if err != stop || n != 1 {
+		t.Errorf("ReadTrace after fn failed: %v after %d events", err, n)
+	}
+}
@@ -0,0 +1,178 @@
+package btree
+
+import (
+	"iter"
+	"manager"
+	"math"
+)
+
+// Cursor walks the leaves of a tree in key order. Iterators cannot return
+// errors, so a walk stops at the first page that fails to load and Err
+// reports why.
+type Cursor struct {
+	bt  *BTree
+	err error
+}
+
+// Cursor returns a cursor over bt.
+func (bt *BTree) Cursor() *Cursor {
+	return &Cursor{bt: bt}
+}
+
+// All returns an iterator over every key and value in key order. Use a
+// Cursor to find out whether the walk ended early on an I/O error.
+func (bt *BTree) All() iter.Seq2[uint64, uint64] {
+	return bt.Cursor().All()
+}
+
+// Keys returns an iterator over every key in order.
+func (bt *BTree) Keys() iter.Seq[uint64] {
+	return bt.Cursor().Keys()
+}
+
+// Values returns an iterator over every value in key order.
+func (bt *BTree) Values() iter.Seq[uint64] {
+	return bt.Cursor().Values()
+}
+
+// Range returns an iterator over the keys from lo to hi inclusive, and
+// their values, in key order.
+func (bt *BTree) Range(lo, hi uint64) iter.Seq2[uint64, uint64] {
+	return bt.Cursor().Range(lo, hi)
+}
+
+// Err returns the error that ended the last walk, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// All returns an iterator over every key and value in key order. Each
+// leaf is copied out and unpinned before its entries are yielded, so the
+// loop body may use the buffer manager, but keys inserted meanwhile may or
+// may not be seen.
+func (c *Cursor) All() iter.Seq2[uint64, uint64] {
+	return c.walk(c.firstLeaf, 0, math.MaxUint64)
+}
+
+// Range returns an iterator over the keys from lo to hi inclusive, and
+// their values, in key order, as All does over every key. The walk starts
+// at the leaf that would hold lo, found from the root as Get finds a key,
+// and stops at the first key above hi.
+func (c *Cursor) Range(lo, hi uint64) iter.Seq2[uint64, uint64] {
+	return c.walk(func() (manager.PageID, error) { return c.leafFor(lo) }, lo, hi)
+}
+
+// walk yields the entries from lo to hi of the leaves chained from the one
+// start returns.
+func (c *Cursor) walk(start func() (manager.PageID, error), lo, hi uint64) iter.Seq2[uint64, uint64] {
+	return func(yield func(uint64, uint64) bool) {
+		c.err = nil
+		if lo > hi {
+			return
+		}
+		pageID, err := start()
+		if err != nil {
+			c.err = err
+			return
+		}
+		var keys, values []uint64
+		for {
+			data, err := c.bt.bm.PinPage(pageID)
+			if err != nil {
+				c.err = err
+				return
+			}
+			leaf, err := AsLeafPage(data)
+			if err != nil {
+				c.bt.bm.UnpinPage(pageID, false)
+				c.err = err
+				return
+			}
+			keys, values = keys[:0], values[:0]
+			for i := 0; i < leaf.NumKeys(); i++ {
+				keys = append(keys, leaf.Key(i))
+				values = append(values, leaf.Value(i))
+			}
+			next := leaf.Next()
+			c.bt.bm.UnpinPage(pageID, false)
+
+			for i, key := range keys {
+				if key > hi {
+					return
+				}
+				if key >= lo && !yield(key, values[i]) {
+					return
+				}
+			}
+			// A next of 0 ends the chain; page 0 can only be the first leaf
+			if next == 0 {
+				return
+			}
+			pageID = next
+		}
+	}
+}
+
+// Keys returns an iterator over every key in order.
+func (c *Cursor) Keys() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for key := range c.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over every value in key order.
+func (c *Cursor) Values() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for _, value := range c.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// leafFor follows the children that would hold key down to a leaf.
+func (c *Cursor) leafFor(key uint64) (manager.PageID, error) {
+	pageID := c.bt.rootPageID
+	for {
+		data, err := c.bt.bm.PinPage(pageID)
+		if err != nil {
+			return 0, err
+		}
+		if manager.GetPageType(data) == manager.PageTypeLeaf {
+			c.bt.bm.UnpinPage(pageID, false)
+			return pageID, nil
+		}
+		node, err := AsInternalPage(data)
+		if err != nil {
+			c.bt.bm.UnpinPage(pageID, false)
+			return 0, err
+		}
+		childID := node.Child(node.ChildIndex(key))
+		c.bt.bm.UnpinPage(pageID, false)
+		pageID = childID
+	}
+}
+
+// firstLeaf follows the leftmost children down to the first leaf.
+func (c *Cursor) firstLeaf() (manager.PageID, error) {
+	pageID := c.bt.rootPageID
+	for {
+		data, err := c.bt.bm.PinPage(pageID)
+		if err != nil {
+			return 0, err
+		}
+		pageType := manager.GetPageType(data)
+		childID := InternalPage{data}.Child(0)
+		c.bt.bm.UnpinPage(pageID, false)
+
+		if pageType == manager.PageTypeLeaf {
+			return pageID, nil
+		}
+		pageID = childID
+	}
+}
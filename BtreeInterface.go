@@ -1,21 +1,14 @@
 package btree
 
 import (
-	"encoding/binary"
 	"errors"
 	"manager"
 )
 
 const (
-	leafNode           = 0
-	internalNode       = 1
-	leafHeaderSize     = 32 // nodeType(8) + numKeys(8) + next(8) + prev(8)
-	internalHeaderSize = 16 // nodeType(8) + numKeys(8)
-	keySize            = 8
-	valueSize          = 8
-	ptrSize            = 8
-	maxLeafEntries     = (manager.PageSize - leafHeaderSize) / (keySize + valueSize)
-	maxInternalKeys    = (manager.PageSize - internalHeaderSize - ptrSize) / (keySize + ptrSize)
+	keySize   = 8
+	valueSize = 8
+	ptrSize   = 8
 )
 
 type BTree struct {
@@ -25,20 +18,43 @@ type BTree struct {
 
 func NewBTree(bm *manager.BufferManager) *BTree {
 	rootID, data, _ := bm.NewPage()
-	initializeLeafPage(data)
+	InitializeLeafPage(data)
+	bm.UnpinPage(rootID, true)
 	return &BTree{bm: bm, rootPageID: rootID}
 }
 
-func initializeLeafPage(data *[manager.PageSize]byte) {
-	binary.BigEndian.PutUint64(data[0:8], leafNode)
-	binary.BigEndian.PutUint64(data[8:16], 0)
-	binary.BigEndian.PutUint64(data[16:24], 0)
-	binary.BigEndian.PutUint64(data[24:32], 0)
+// NewBTreeIn creates an empty tree in the given tablespace.
+func NewBTreeIn(bm *manager.BufferManager, fileID manager.FileID) (*BTree, error) {
+	rootID, data, err := bm.NewPageIn(fileID)
+	if err != nil {
+		return nil, err
+	}
+	InitializeLeafPage(data)
+	if err := bm.UnpinPage(rootID, true); err != nil {
+		return nil, err
+	}
+	return &BTree{bm: bm, rootPageID: rootID}, nil
+}
+
+// OpenBTree opens an existing tree by its root page, e.g. a tree in a
+// read-only tablespace.
+func OpenBTree(bm *manager.BufferManager, rootPageID manager.PageID) *BTree {
+	return &BTree{bm: bm, rootPageID: rootPageID}
 }
 
-func initializeInternalPage(data *[manager.PageSize]byte) {
-	binary.BigEndian.PutUint64(data[0:8], internalNode)
-	binary.BigEndian.PutUint64(data[8:16], 0)
+func (bt *BTree) RootPageID() manager.PageID {
+	return bt.rootPageID
+}
+
+// SetRootPageID points bt at another root, such as that of a tree the
+// loader rebuilt from bt's leaves. Pages no longer reachable are not
+// freed.
+func (bt *BTree) SetRootPageID(rootPageID manager.PageID) {
+	bt.rootPageID = rootPageID
+}
+
+func (bt *BTree) BufferManager() *manager.BufferManager {
+	return bt.bm
 }
 
 func (bt *BTree) Get(key uint64) (uint64, error) {
@@ -52,62 +68,57 @@ func (bt *BTree) search(pageID manager.PageID, key uint64) (uint64, error) {
 	}
 	defer bt.bm.UnpinPage(pageID, false)
 
-	nodeType := binary.BigEndian.Uint64(data[0:8])
-	if nodeType == leafNode {
-		return bt.searchLeaf(data, key)
+	if manager.GetPageType(data) == manager.PageTypeLeaf {
+		leaf, err := AsLeafPage(data)
+		if err != nil {
+			return 0, err
+		}
+		return bt.searchLeaf(leaf, key)
 	}
-	return bt.searchInternal(data, key)
+	node, err := AsInternalPage(data)
+	if err != nil {
+		return 0, err
+	}
+	return bt.searchInternal(node, key)
 }
 
-func (bt *BTree) searchLeaf(data *[manager.PageSize]byte, key uint64) (uint64, error) {
-	numKeys := binary.BigEndian.Uint64(data[8:16])
-	low := 0
-	high := int(numKeys) - 1
-
-	for low <= high {
-		mid := (low + high) / 2
-		offset := leafHeaderSize + mid*(keySize+valueSize)
-		currentKey := binary.BigEndian.Uint64(data[offset:])
-
-		switch {
-		case key == currentKey:
-			return binary.BigEndian.Uint64(data[offset+keySize:]), nil
-		case key < currentKey:
-			high = mid - 1
-		default:
-			low = mid + 1
-		}
+func (bt *BTree) searchLeaf(leaf LeafPage, key uint64) (uint64, error) {
+	if pos, found := leaf.Search(key); found {
+		return leaf.Value(pos), nil
 	}
 	return 0, errors.New("key not found")
 }
 
-func (bt *BTree) searchInternal(data *[manager.PageSize]byte, key uint64) (uint64, error) {
-	numKeys := binary.BigEndian.Uint64(data[8:16])
-	low := 0
-	high := int(numKeys) - 1
-	childIndex := 0
-
-	for low <= high {
-		mid := (low + high) / 2
-		keyOffset := internalHeaderSize + mid*(ptrSize+keySize) + ptrSize
-		currentKey := binary.BigEndian.Uint64(data[keyOffset:])
-
-		if key < currentKey {
-			high = mid - 1
-			childIndex = mid
-		} else {
-			low = mid + 1
-			childIndex = mid + 1
+func (bt *BTree) searchInternal(node InternalPage, key uint64) (uint64, error) {
+	return bt.search(node.Child(node.ChildIndex(key)), key)
+}
+
+// Height returns the number of levels from the root down to the leaves.
+func (bt *BTree) Height() (int, error) {
+	height := 1
+	pageID := bt.rootPageID
+	for {
+		data, err := bt.bm.PinPage(pageID)
+		if err != nil {
+			return 0, err
 		}
-	}
+		pageType := manager.GetPageType(data)
+		childID := InternalPage{data}.Child(0)
+		bt.bm.UnpinPage(pageID, false)
 
-	ptrOffset := internalHeaderSize + childIndex*(ptrSize+keySize)
-	childID := manager.Unsizzle([8]byte(data[ptrOffset:]))
-	return bt.search(childID, key)
+		if pageType == manager.PageTypeLeaf {
+			return height, nil
+		}
+		pageID = childID
+		height++
+	}
 }
 
 // Updated Insert implementation with full split propagation
 func (bt *BTree) Insert(key, value uint64) error {
+	if bt.bm.ReadOnly(bt.rootPageID.FileID()) {
+		return manager.ErrReadOnly
+	}
 	splitKey, newChild, err := bt.insert(bt.rootPageID, key, value)
 	if err != nil {
 		return err
@@ -115,18 +126,7 @@ func (bt *BTree) Insert(key, value uint64) error {
 
 	// Handle root split
 	if newChild != 0 {
-		newRootID, rootData, _ := bt.bm.NewPage()
-		initializeInternalPage(rootData)
-
-		// Set first pointer to old root
-		copy(rootData[internalHeaderSize:], manager.Sizzle(bt.rootPageID))
-		// Set split key
-		binary.BigEndian.PutUint64(rootData[internalHeaderSize+ptrSize:], splitKey)
-		// Set second pointer to new child
-		copy(rootData[internalHeaderSize+ptrSize+keySize:], manager.Sizzle(newChild))
-
-		binary.BigEndian.PutUint64(rootData[8:16], 1) // numKeys = 1
-		bt.rootPageID = newRootID
+		return bt.createNewRoot(bt.rootPageID, newChild, splitKey)
 	}
 	return nil
 }
@@ -138,66 +138,66 @@ func (bt *BTree) insert(pageID manager.PageID, key, value uint64) (uint64, manag
 	}
 	defer bt.bm.UnpinPage(pageID, true)
 
-	nodeType := binary.BigEndian.Uint64(data[0:8])
-	if nodeType == leafNode {
-		return bt.insertLeaf(data, pageID, key, value)
+	if manager.GetPageType(data) == manager.PageTypeLeaf {
+		leaf, err := AsLeafPage(data)
+		if err != nil {
+			return 0, 0, err
+		}
+		return bt.insertLeaf(leaf, pageID, key, value)
+	}
+	node, err := AsInternalPage(data)
+	if err != nil {
+		return 0, 0, err
 	}
-	return bt.insertInternal(data, pageID, key, value)
+	return bt.insertInternal(node, key, value)
 }
 
-func (bt *BTree) insertLeaf(data *[manager.PageSize]byte, pageID manager.PageID, key, value uint64) (uint64, manager.PageID, error) {
-	numKeys := binary.BigEndian.Uint64(data[8:16])
-	insertPos := bt.findLeafInsertPosition(data, numKeys, key)
+func (bt *BTree) insertLeaf(leaf LeafPage, pageID manager.PageID, key, value uint64) (uint64, manager.PageID, error) {
+	insertPos, found := leaf.Search(key)
 
 	// Update existing key if found
-	if insertPos < numKeys {
-		offset := leafHeaderSize + insertPos*(keySize+valueSize)
-		currentKey := binary.BigEndian.Uint64(data[offset:])
-		if currentKey == key {
-			binary.BigEndian.PutUint64(data[offset+keySize:], value)
-			return 0, 0, nil // No split needed
-		}
+	if found {
+		leaf.SetValue(insertPos, value)
+		return 0, 0, nil // No split needed
 	}
 
-	if numKeys < maxLeafEntries {
-		bt.insertLeafEntry(data, numKeys, insertPos, key, value)
+	if leaf.NumKeys() < maxLeafEntries {
+		leaf.InsertAt(insertPos, key, value)
 		return 0, 0, nil
 	}
 
 	// Split required
-	newPageID, newData, _ := bt.bm.NewPage()
-	initializeLeafPage(newData)
-	splitPos := numKeys / 2
-	splitKey := binary.BigEndian.Uint64(data[leafHeaderSize+splitPos*(keySize+valueSize):])
+	newPageID, newData, err := bt.bm.NewPageIn(bt.rootPageID.FileID())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer bt.bm.UnpinPage(newPageID, true)
+	right := InitializeLeafPage(newData)
+	splitPos := leaf.NumKeys() / 2
 
 	// Split entries
-	bt.splitLeaf(data, newData, splitPos)
+	bt.splitLeaf(leaf, right, splitPos)
 
 	// Insert into appropriate node
-	if insertPos > splitPos {
-		bt.insertLeafEntry(newData, numKeys-splitPos, insertPos-splitPos, key, value)
+	if insertPos >= splitPos {
+		right.InsertAt(insertPos-splitPos, key, value)
 	} else {
-		bt.insertLeafEntry(data, splitPos, insertPos, key, value)
+		leaf.InsertAt(insertPos, key, value)
 	}
 
 	// Maintain linked list
-	nextPage := binary.BigEndian.Uint64(data[16:24])
-	binary.BigEndian.PutUint64(newData[16:24], nextPage)
-	binary.BigEndian.PutUint64(newData[24:32], uint64(pageID))
-	binary.BigEndian.PutUint64(data[16:24], uint64(newPageID))
+	if err := bt.linkLeaf(leaf, right, pageID, newPageID); err != nil {
+		return 0, 0, err
+	}
 
-	return splitKey, newPageID, nil
+	return right.Key(0), newPageID, nil
 }
 
-func (bt *BTree) insertInternal(data *[manager.PageSize]byte, pageID manager.PageID, key, value uint64) (uint64, manager.PageID, error) {
-	numKeys := binary.BigEndian.Uint64(data[8:16])
-	insertPos := bt.findInternalInsertPosition(data, numKeys, key)
+func (bt *BTree) insertInternal(node InternalPage, key, value uint64) (uint64, manager.PageID, error) {
+	insertPos := node.ChildIndex(key)
 
 	// Recurse to child
-	childOffset := internalHeaderSize + insertPos*(ptrSize+keySize)
-	childID := manager.Unsizzle([8]byte(data[childOffset:]))
-
-	promotedKey, newChild, err := bt.insert(childID, key, value)
+	promotedKey, newChild, err := bt.insert(node.Child(insertPos), key, value)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -207,156 +207,98 @@ func (bt *BTree) insertInternal(data *[manager.PageSize]byte, pageID manager.Pag
 	}
 
 	// Insert new key and pointer in internal node
-	if numKeys < maxInternalKeys {
-		bt.insertInternalEntry(data, numKeys, insertPos, promotedKey, newChild)
+	if node.NumKeys() < maxInternalKeys {
+		node.InsertAt(insertPos, promotedKey, newChild)
 		return 0, 0, nil
 	}
 
 	// Split internal node
-	newPageID, newData, _ := bt.bm.NewPage()
-	initializeInternalPage(newData)
-	splitPos := numKeys / 2
-	promotedSplitKey := bt.splitInternal(data, newData, splitPos)
+	newPageID, newData, err := bt.bm.NewPageIn(bt.rootPageID.FileID())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer bt.bm.UnpinPage(newPageID, true)
+	right := InitializeInternalPage(newData)
+	splitPos := node.NumKeys() / 2
+	promotedSplitKey := bt.splitInternal(node, right, splitPos)
 
 	// Determine where to insert
 	if insertPos > splitPos {
-		bt.insertInternalEntry(newData, numKeys-splitPos-1, insertPos-splitPos-1, promotedKey, newChild)
+		right.InsertAt(insertPos-splitPos-1, promotedKey, newChild)
 	} else {
-		bt.insertInternalEntry(data, splitPos, insertPos, promotedKey, newChild)
+		node.InsertAt(insertPos, promotedKey, newChild)
 	}
 
 	return promotedSplitKey, newPageID, nil
 }
 
-//
-
-func (bt *BTree) findLeafInsertPosition(data *[manager.PageSize]byte, numKeys uint64, key uint64) uint64 {
-	low := 0
-	high := int(numKeys) - 1
-	var mid int
-
-	for low <= high {
-		mid = (low + high) / 2
-		offset := leafHeaderSize + mid*(keySize+valueSize)
-		currentKey := binary.BigEndian.Uint64(data[offset:])
-
-		switch {
-		case key == currentKey:
-			return uint64(mid)
-		case key < currentKey:
-			high = mid - 1
-		default:
-			low = mid + 1
-		}
+// Delete removes key from the tree and reports whether it was there.
+// Leaves are not merged or rebalanced: a leaf may be left empty, and it
+// stays in the tree for later inserts.
+func (bt *BTree) Delete(key uint64) (bool, error) {
+	if bt.bm.ReadOnly(bt.rootPageID.FileID()) {
+		return false, manager.ErrReadOnly
 	}
-	return uint64(low)
-}
-
-func (bt *BTree) insertLeafEntry(data *[manager.PageSize]byte, numKeys, pos uint64, key, value uint64) error {
-	startOffset := leafHeaderSize + pos*(keySize+valueSize)
-	endOffset := leafHeaderSize + numKeys*(keySize+valueSize)
-	copy(data[startOffset+keySize+valueSize:], data[startOffset:endOffset])
-
-	binary.BigEndian.PutUint64(data[startOffset:], key)
-	binary.BigEndian.PutUint64(data[startOffset+keySize:], value)
-	binary.BigEndian.PutUint64(data[8:16], numKeys+1)
-	return nil
-}
-
-func (bt *BTree) splitLeaf(oldData, newData *[manager.PageSize]byte, splitPos uint64) {
-	copy(newData[leafHeaderSize:], oldData[leafHeaderSize+splitPos*(keySize+valueSize):])
-
-	oldNumKeys := binary.BigEndian.Uint64(oldData[8:16])
-	binary.BigEndian.PutUint64(oldData[8:16], splitPos)
-	binary.BigEndian.PutUint64(newData[8:16], oldNumKeys-splitPos)
-
-	// Update linked list
-	nextPage := binary.BigEndian.Uint64(oldData[16:24])
-	binary.BigEndian.PutUint64(newData[16:24], nextPage)
-	binary.BigEndian.PutUint64(newData[24:32], binary.BigEndian.Uint64(oldData[24:32]))
-	binary.BigEndian.PutUint64(oldData[16:24], binary.BigEndian.Uint64(newData[24:32]))
-}
-
-func (bt *BTree) insertInternal(data *[manager.PageSize]byte, pageID manager.PageID, key uint64, value uint64, newChildID manager.PageID) error {
-	numKeys := binary.BigEndian.Uint64(data[8:16])
-	insertPos := bt.findInternalInsertPosition(data, numKeys, key)
-
-	if numKeys < maxInternalKeys {
-		return bt.insertInternalEntry(data, numKeys, insertPos, key, newChildID)
+	pageID, err := bt.Cursor().leafFor(key)
+	if err != nil {
+		return false, err
 	}
-
-	newPageID, newData, _ := bt.bm.NewPage()
-	initializeInternalPage(newData)
-	splitPos := numKeys / 2
-	promotedKey := bt.splitInternal(data, newData, splitPos)
-
-	if insertPos > splitPos {
-		return bt.insertInternalEntry(newData, numKeys-splitPos-1, insertPos-splitPos-1, key, newChildID)
+	data, err := bt.bm.PinPage(pageID)
+	if err != nil {
+		return false, err
 	}
-	return bt.insertInternalEntry(data, splitPos, insertPos, key, newChildID)
-}
-
-func (bt *BTree) findInternalInsertPosition(data *[manager.PageSize]byte, numKeys uint64, key uint64) uint64 {
-	low := 0
-	high := int(numKeys) - 1
-	var pos int
-
-	for low <= high {
-		mid := (low + high) / 2
-		keyOffset := internalHeaderSize + mid*(ptrSize+keySize) + ptrSize
-		currentKey := binary.BigEndian.Uint64(data[keyOffset:])
-
-		switch {
-		case key < currentKey:
-			high = mid - 1
-			pos = mid
-		default:
-			low = mid + 1
-			pos = mid + 1
-		}
+	leaf, err := AsLeafPage(data)
+	if err != nil {
+		bt.bm.UnpinPage(pageID, false)
+		return false, err
+	}
+	pos, found := leaf.Search(key)
+	if found {
+		leaf.RemoveAt(pos)
 	}
-	return uint64(pos)
+	return found, bt.bm.UnpinPage(pageID, found)
 }
 
-func (bt *BTree) insertInternalEntry(data *[manager.PageSize]byte, numKeys, pos uint64, key uint64, childID manager.PageID) error {
-	startOffset := internalHeaderSize + pos*(ptrSize+keySize)
-	endOffset := internalHeaderSize + numKeys*(ptrSize+keySize)
-	copy(data[startOffset+ptrSize+keySize:], data[startOffset:endOffset])
-
-	copy(data[startOffset:], manager.Sizzle(childID))
-	binary.BigEndian.PutUint64(data[startOffset+ptrSize:], key)
-	binary.BigEndian.PutUint64(data[8:16], numKeys+1)
-	return nil
+func (bt *BTree) splitLeaf(oldLeaf, newLeaf LeafPage, splitPos int) {
+	oldLeaf.MoveTail(splitPos, newLeaf)
 }
 
-func (bt *BTree) splitInternal(oldData, newData *[manager.PageSize]byte, splitPos uint64) uint64 {
-	promotedKey := binary.BigEndian.Uint64(oldData[internalHeaderSize+splitPos*(ptrSize+keySize)+ptrSize:])
+// linkLeaf splices newLeaf into the leaf chain right after leaf.
+func (bt *BTree) linkLeaf(leaf, newLeaf LeafPage, pageID, newPageID manager.PageID) error {
+	next := leaf.Next()
+	newLeaf.SetNext(next)
+	newLeaf.SetPrev(pageID)
+	leaf.SetNext(newPageID)
 
-	// Copy right entries
-	startOffset := internalHeaderSize + (splitPos+1)*(ptrSize+keySize)
-	copy(newData[internalHeaderSize:], oldData[startOffset:])
-
-	// Update counts
-	oldNumKeys := binary.BigEndian.Uint64(oldData[8:16])
-	binary.BigEndian.PutUint64(oldData[8:16], splitPos)
-	binary.BigEndian.PutUint64(newData[8:16], oldNumKeys-splitPos-1)
+	if next == 0 {
+		return nil
+	}
+	nextData, err := bt.bm.PinPage(next)
+	if err != nil {
+		return err
+	}
+	LeafPage{nextData}.SetPrev(newPageID)
+	return bt.bm.UnpinPage(next, true)
+}
 
-	return promotedKey
+func (bt *BTree) splitInternal(oldNode, newNode InternalPage, splitPos int) uint64 {
+	return oldNode.MoveTail(splitPos, newNode)
 }
 
 func (bt *BTree) findParent(currentPageID, targetPageID manager.PageID) manager.PageID {
 	data, _ := bt.bm.PinPage(currentPageID)
 	defer bt.bm.UnpinPage(currentPageID, false)
 
-	nodeType := binary.BigEndian.Uint64(data[0:8])
-	if nodeType == leafNode {
+	if manager.GetPageType(data) == manager.PageTypeLeaf {
 		return 0
 	}
 
-	numKeys := binary.BigEndian.Uint64(data[8:16])
-	for i := uint64(0); i <= numKeys; i++ {
-		offset := internalHeaderSize + i*(ptrSize+keySize)
-		childID := manager.Unsizzle([8]byte(data[offset:]))
+	node, err := AsInternalPage(data)
+	if err != nil {
+		return 0
+	}
+	for i := 0; i <= node.NumKeys(); i++ {
+		childID := node.Child(i)
 		if childID == targetPageID {
 			return currentPageID
 		}
@@ -368,16 +310,17 @@ func (bt *BTree) findParent(currentPageID, targetPageID manager.PageID) manager.
 }
 
 func (bt *BTree) createNewRoot(leftChild, rightChild manager.PageID, key uint64) error {
-	newRootID, rootData, _ := bt.bm.NewPage()
-	initializeInternalPage(rootData)
+	newRootID, rootData, err := bt.bm.NewPageIn(bt.rootPageID.FileID())
+	if err != nil {
+		return err
+	}
+	root := InitializeInternalPage(rootData)
 
-	binary.BigEndian.PutUint64(rootData[8:16], 1)
-	copy(rootData[internalHeaderSize:], manager.Sizzle(leftChild))
-	binary.BigEndian.PutUint64(rootData[internalHeaderSize+ptrSize:], key)
-	copy(rootData[internalHeaderSize+ptrSize+keySize:], manager.Sizzle(rightChild))
+	root.SetChild(0, leftChild)
+	root.InsertAt(0, key, rightChild)
 
 	bt.rootPageID = newRootID
-	return nil
+	return bt.bm.UnpinPage(newRootID, true)
 }
 
 func Sizzle(pageID manager.PageID) [8]byte {
@@ -0,0 +1,277 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"manager"
+)
+
+const (
+	numKeysOffset      = manager.PageHeaderSize
+	leafNextOffset     = numKeysOffset + 8
+	leafPrevOffset     = leafNextOffset + 8
+	leafHeaderSize     = leafPrevOffset + 8 // header + numKeys(8) + next(8) + prev(8)
+	internalHeaderSize = numKeysOffset + 8  // header + numKeys(8)
+	leafEntrySize      = keySize + valueSize
+	internalEntrySize  = ptrSize + keySize
+	maxLeafEntries     = (manager.PageSize - leafHeaderSize) / leafEntrySize
+	maxInternalKeys    = (manager.PageSize - internalHeaderSize - ptrSize) / internalEntrySize
+)
+
+// MaxLeafEntries and MaxInternalKeys are the capacities of a leaf and of
+// an internal page, for code that fills pages directly, such as the bulk
+// loader.
+const (
+	MaxLeafEntries  = maxLeafEntries
+	MaxInternalKeys = maxInternalKeys
+)
+
+// LeafPage wraps a leaf page: the header followed by sorted key/value
+// pairs.
+type LeafPage struct {
+	data *[manager.PageSize]byte
+}
+
+// InternalPage wraps an internal page: the header followed by
+// child(0) key(0) child(1) ... key(n-1) child(n). Child i holds the keys
+// in [key(i-1), key(i)).
+type InternalPage struct {
+	data *[manager.PageSize]byte
+}
+
+// InitializeLeafPage formats data as an empty leaf.
+func InitializeLeafPage(data *[manager.PageSize]byte) LeafPage {
+	clear(data[:leafHeaderSize])
+	manager.SetPageType(data, manager.PageTypeLeaf)
+	return LeafPage{data}
+}
+
+// InitializeInternalPage formats data as an empty internal node.
+func InitializeInternalPage(data *[manager.PageSize]byte) InternalPage {
+	clear(data[:internalHeaderSize])
+	manager.SetPageType(data, manager.PageTypeInternal)
+	return InternalPage{data}
+}
+
+// AsLeafPage wraps data, checking its page type and that its key count
+// fits the page, so the accessors stay within it.
+func AsLeafPage(data *[manager.PageSize]byte) (LeafPage, error) {
+	if t := manager.GetPageType(data); t != manager.PageTypeLeaf {
+		return LeafPage{}, fmt.Errorf("expected leaf page, got %v", t)
+	}
+	if err := checkNumKeys(data, maxLeafEntries); err != nil {
+		return LeafPage{}, err
+	}
+	return LeafPage{data}, nil
+}
+
+// AsInternalPage wraps data, checking its page type and key count.
+func AsInternalPage(data *[manager.PageSize]byte) (InternalPage, error) {
+	if t := manager.GetPageType(data); t != manager.PageTypeInternal {
+		return InternalPage{}, fmt.Errorf("expected internal page, got %v", t)
+	}
+	if err := checkNumKeys(data, maxInternalKeys); err != nil {
+		return InternalPage{}, err
+	}
+	return InternalPage{data}, nil
+}
+
+var errCorruptPage = errors.New("corrupt page: key count out of range")
+
+func checkNumKeys(data *[manager.PageSize]byte, capacity uint64) error {
+	if n := binary.BigEndian.Uint64(data[numKeysOffset:]); n > capacity {
+		return fmt.Errorf("%w: %d keys, room for %d", errCorruptPage, n, capacity)
+	}
+	return nil
+}
+
+func (p LeafPage) NumKeys() int {
+	return int(binary.BigEndian.Uint64(p.data[numKeysOffset:]))
+}
+
+func (p LeafPage) SetNumKeys(n int) {
+	if n < 0 || n > maxLeafEntries {
+		panic(errCorruptPage)
+	}
+	binary.BigEndian.PutUint64(p.data[numKeysOffset:], uint64(n))
+}
+
+func (p LeafPage) Next() manager.PageID {
+	return manager.PageID(binary.BigEndian.Uint64(p.data[leafNextOffset:]))
+}
+
+func (p LeafPage) SetNext(id manager.PageID) {
+	binary.BigEndian.PutUint64(p.data[leafNextOffset:], uint64(id))
+}
+
+func (p LeafPage) Prev() manager.PageID {
+	return manager.PageID(binary.BigEndian.Uint64(p.data[leafPrevOffset:]))
+}
+
+func (p LeafPage) SetPrev(id manager.PageID) {
+	binary.BigEndian.PutUint64(p.data[leafPrevOffset:], uint64(id))
+}
+
+func (p LeafPage) entryOffset(i int) int {
+	if i < 0 || i >= maxLeafEntries {
+		panic(fmt.Sprintf("leaf entry %d out of range", i))
+	}
+	return leafHeaderSize + i*leafEntrySize
+}
+
+func (p LeafPage) Key(i int) uint64 {
+	return binary.BigEndian.Uint64(p.data[p.entryOffset(i):])
+}
+
+func (p LeafPage) Value(i int) uint64 {
+	return binary.BigEndian.Uint64(p.data[p.entryOffset(i)+keySize:])
+}
+
+func (p LeafPage) SetValue(i int, value uint64) {
+	binary.BigEndian.PutUint64(p.data[p.entryOffset(i)+keySize:], value)
+}
+
+// SetEntry overwrites slot i without touching the key count.
+func (p LeafPage) SetEntry(i int, key, value uint64) {
+	offset := p.entryOffset(i)
+	binary.BigEndian.PutUint64(p.data[offset:], key)
+	binary.BigEndian.PutUint64(p.data[offset+keySize:], value)
+}
+
+// Search returns the position of key, or where it would be inserted.
+func (p LeafPage) Search(key uint64) (int, bool) {
+	low, high := 0, p.NumKeys()-1
+	for low <= high {
+		mid := (low + high) / 2
+		currentKey := p.Key(mid)
+		switch {
+		case key == currentKey:
+			return mid, true
+		case key < currentKey:
+			high = mid - 1
+		default:
+			low = mid + 1
+		}
+	}
+	return low, false
+}
+
+// InsertAt shifts entries from pos right by one and stores key/value there.
+func (p LeafPage) InsertAt(pos int, key, value uint64) {
+	n := p.NumKeys()
+	if pos < 0 || pos > n || n >= maxLeafEntries {
+		panic(fmt.Sprintf("leaf insert at %d of %d", pos, n))
+	}
+	start := leafHeaderSize + pos*leafEntrySize
+	end := leafHeaderSize + n*leafEntrySize
+	copy(p.data[start+leafEntrySize:], p.data[start:end])
+	p.SetNumKeys(n + 1)
+	p.SetEntry(pos, key, value)
+}
+
+// RemoveAt deletes the entry at pos.
+func (p LeafPage) RemoveAt(pos int) {
+	n := p.NumKeys()
+	if pos < 0 || pos >= n {
+		panic(fmt.Sprintf("leaf remove at %d of %d", pos, n))
+	}
+	start := leafHeaderSize + pos*leafEntrySize
+	end := leafHeaderSize + n*leafEntrySize
+	copy(p.data[start:], p.data[start+leafEntrySize:end])
+	p.SetNumKeys(n - 1)
+}
+
+// MoveTail moves the entries from pos on to the empty leaf dst.
+func (p LeafPage) MoveTail(pos int, dst LeafPage) {
+	n := p.NumKeys()
+	start := leafHeaderSize + pos*leafEntrySize
+	end := leafHeaderSize + n*leafEntrySize
+	copy(dst.data[leafHeaderSize:], p.data[start:end])
+	dst.SetNumKeys(n - pos)
+	p.SetNumKeys(pos)
+}
+
+func (p InternalPage) NumKeys() int {
+	return int(binary.BigEndian.Uint64(p.data[numKeysOffset:]))
+}
+
+func (p InternalPage) SetNumKeys(n int) {
+	if n < 0 || n > maxInternalKeys {
+		panic(errCorruptPage)
+	}
+	binary.BigEndian.PutUint64(p.data[numKeysOffset:], uint64(n))
+}
+
+func (p InternalPage) childOffset(i int) int {
+	if i < 0 || i > maxInternalKeys {
+		panic(fmt.Sprintf("child %d out of range", i))
+	}
+	return internalHeaderSize + i*internalEntrySize
+}
+
+func (p InternalPage) keyOffset(i int) int {
+	if i < 0 || i >= maxInternalKeys {
+		panic(fmt.Sprintf("internal key %d out of range", i))
+	}
+	return internalHeaderSize + i*internalEntrySize + ptrSize
+}
+
+func (p InternalPage) Child(i int) manager.PageID {
+	return manager.Unsizzle([8]byte(p.data[p.childOffset(i):]))
+}
+
+func (p InternalPage) SetChild(i int, id manager.PageID) {
+	buf := manager.Sizzle(id)
+	copy(p.data[p.childOffset(i):], buf[:])
+}
+
+func (p InternalPage) Key(i int) uint64 {
+	return binary.BigEndian.Uint64(p.data[p.keyOffset(i):])
+}
+
+func (p InternalPage) SetKey(i int, key uint64) {
+	binary.BigEndian.PutUint64(p.data[p.keyOffset(i):], key)
+}
+
+// ChildIndex returns the index of the child whose range contains key.
+func (p InternalPage) ChildIndex(key uint64) int {
+	low, high := 0, p.NumKeys()-1
+	for low <= high {
+		mid := (low + high) / 2
+		if key < p.Key(mid) {
+			high = mid - 1
+		} else {
+			low = mid + 1
+		}
+	}
+	return low
+}
+
+// InsertAt stores key at pos with rightChild as its right-hand child,
+// shifting later keys and children right by one.
+func (p InternalPage) InsertAt(pos int, key uint64, rightChild manager.PageID) {
+	n := p.NumKeys()
+	if pos < 0 || pos > n || n >= maxInternalKeys {
+		panic(fmt.Sprintf("internal insert at %d of %d", pos, n))
+	}
+	start := internalHeaderSize + pos*internalEntrySize + ptrSize
+	end := internalHeaderSize + n*internalEntrySize + ptrSize
+	copy(p.data[start+internalEntrySize:], p.data[start:end])
+	p.SetNumKeys(n + 1)
+	p.SetKey(pos, key)
+	p.SetChild(pos+1, rightChild)
+}
+
+// MoveTail moves key(pos+1).. and child(pos+1).. to the empty node dst and
+// returns key(pos), which belongs to neither half.
+func (p InternalPage) MoveTail(pos int, dst InternalPage) uint64 {
+	n := p.NumKeys()
+	separator := p.Key(pos)
+	start := internalHeaderSize + (pos+1)*internalEntrySize
+	end := internalHeaderSize + n*internalEntrySize + ptrSize
+	copy(dst.data[internalHeaderSize:], p.data[start:end])
+	dst.SetNumKeys(n - pos - 1)
+	p.SetNumKeys(pos)
+	return separator
+}
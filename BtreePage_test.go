@@ -0,0 +1,246 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"manager"
+	"testing"
+)
+
+// panics reports whether f panics.
+func panics(f func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	f()
+	return false
+}
+
+// fullLeaf is a leaf holding keys 0, 2, 4, ... up to its capacity, each
+// with value key+1, inserted back to front.
+func fullLeaf() LeafPage {
+	leaf := InitializeLeafPage(new([manager.PageSize]byte))
+	for i := maxLeafEntries - 1; i >= 0; i-- {
+		key := uint64(2 * i)
+		pos, found := leaf.Search(key)
+		if found || pos != 0 {
+			panic("leaf search out of order")
+		}
+		leaf.InsertAt(pos, key, key+1)
+	}
+	return leaf
+}
+
+func TestLeafPageCapacity(t *testing.T) {
+	leaf := fullLeaf()
+	if n := leaf.NumKeys(); n != maxLeafEntries {
+		t.Fatalf("NumKeys = %d, want %d", n, maxLeafEntries)
+	}
+	for i := range maxLeafEntries {
+		if k, v := leaf.Key(i), leaf.Value(i); k != uint64(2*i) || v != k+1 {
+			t.Fatalf("entry %d = %d/%d, want %d/%d", i, k, v, 2*i, 2*i+1)
+		}
+	}
+	if pos, found := leaf.Search(5); found || pos != 3 {
+		t.Errorf("Search(5) = %d, %v, want 3, false", pos, found)
+	}
+	if pos, found := leaf.Search(uint64(2 * (maxLeafEntries - 1))); !found || pos != maxLeafEntries-1 {
+		t.Errorf("Search(last key) = %d, %v, want %d, true", pos, found, maxLeafEntries-1)
+	}
+
+	// A full leaf takes nothing more, and no accessor reaches past it
+	if !panics(func() { leaf.InsertAt(0, 1, 1) }) {
+		t.Error("InsertAt on a full leaf did not panic")
+	}
+	if !panics(func() { leaf.SetNumKeys(maxLeafEntries + 1) }) {
+		t.Error("SetNumKeys past capacity did not panic")
+	}
+	if !panics(func() { leaf.Key(maxLeafEntries) }) {
+		t.Error("Key past capacity did not panic")
+	}
+
+	// Removing the first entry makes room at either end
+	leaf.RemoveAt(0)
+	leaf.InsertAt(leaf.NumKeys(), 1<<40, 0)
+	if n, k := leaf.NumKeys(), leaf.Key(maxLeafEntries-1); n != maxLeafEntries || k != 1<<40 {
+		t.Errorf("after remove and append: NumKeys = %d, last key %d", n, k)
+	}
+}
+
+func TestLeafPageSplit(t *testing.T) {
+	leaf := fullLeaf()
+	right := InitializeLeafPage(new([manager.PageSize]byte))
+	splitPos := maxLeafEntries / 2
+	leaf.MoveTail(splitPos, right)
+
+	if n := leaf.NumKeys(); n != splitPos {
+		t.Errorf("left NumKeys = %d, want %d", n, splitPos)
+	}
+	if n := right.NumKeys(); n != maxLeafEntries-splitPos {
+		t.Errorf("right NumKeys = %d, want %d", n, maxLeafEntries-splitPos)
+	}
+	if k := leaf.Key(splitPos - 1); k != uint64(2*(splitPos-1)) {
+		t.Errorf("left last key = %d, want %d", k, 2*(splitPos-1))
+	}
+	if k, v := right.Key(0), right.Value(0); k != uint64(2*splitPos) || v != k+1 {
+		t.Errorf("right first entry = %d/%d, want %d/%d", k, v, 2*splitPos, 2*splitPos+1)
+	}
+	// Both halves have room again
+	leaf.InsertAt(splitPos, 1<<40, 0)
+	right.InsertAt(0, 1, 0)
+}
+
+// fullInternal is an internal page holding keys 10, 20, ... up to its
+// capacity, with child i = i+1.
+func fullInternal() InternalPage {
+	node := InitializeInternalPage(new([manager.PageSize]byte))
+	node.SetChild(0, 1)
+	for i := range maxInternalKeys {
+		node.InsertAt(i, uint64(10*(i+1)), manager.PageID(i+2))
+	}
+	return node
+}
+
+func TestInternalPageCapacity(t *testing.T) {
+	node := fullInternal()
+	if n := node.NumKeys(); n != maxInternalKeys {
+		t.Fatalf("NumKeys = %d, want %d", n, maxInternalKeys)
+	}
+	for i := 0; i <= maxInternalKeys; i++ {
+		if c := node.Child(i); c != manager.PageID(i+1) {
+			t.Fatalf("Child(%d) = %d, want %d", i, c, i+1)
+		}
+	}
+
+	// Child i holds the keys in [key(i-1), key(i))
+	tests := []struct {
+		key  uint64
+		want int
+	}{
+		{0, 0},
+		{9, 0},
+		{10, 1},
+		{15, 1},
+		{20, 2},
+		{uint64(10 * maxInternalKeys), maxInternalKeys},
+		{1 << 40, maxInternalKeys},
+	}
+	for _, tt := range tests {
+		if got := node.ChildIndex(tt.key); got != tt.want {
+			t.Errorf("ChildIndex(%d) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+
+	if !panics(func() { node.InsertAt(0, 5, 99) }) {
+		t.Error("InsertAt on a full node did not panic")
+	}
+	if !panics(func() { node.SetNumKeys(maxInternalKeys + 1) }) {
+		t.Error("SetNumKeys past capacity did not panic")
+	}
+	if !panics(func() { node.Child(maxInternalKeys + 1) }) {
+		t.Error("Child past capacity did not panic")
+	}
+	if !panics(func() { node.Key(maxInternalKeys) }) {
+		t.Error("Key past capacity did not panic")
+	}
+}
+
+func TestInternalPageSplit(t *testing.T) {
+	node := fullInternal()
+	right := InitializeInternalPage(new([manager.PageSize]byte))
+	splitPos := maxInternalKeys / 2
+	separator := node.MoveTail(splitPos, right)
+
+	// The separator moves up and belongs to neither half
+	if want := uint64(10 * (splitPos + 1)); separator != want {
+		t.Errorf("separator = %d, want %d", separator, want)
+	}
+	if n := node.NumKeys(); n != splitPos {
+		t.Errorf("left NumKeys = %d, want %d", n, splitPos)
+	}
+	if n := right.NumKeys(); n != maxInternalKeys-splitPos-1 {
+		t.Errorf("right NumKeys = %d, want %d", n, maxInternalKeys-splitPos-1)
+	}
+	if c := node.Child(splitPos); c != manager.PageID(splitPos+1) {
+		t.Errorf("left last child = %d, want %d", c, splitPos+1)
+	}
+	if c, k := right.Child(0), right.Key(0); c != manager.PageID(splitPos+2) || k != uint64(10*(splitPos+2)) {
+		t.Errorf("right starts with child %d, key %d, want %d, %d", c, k, splitPos+2, 10*(splitPos+2))
+	}
+	if c := right.Child(right.NumKeys()); c != manager.PageID(maxInternalKeys+1) {
+		t.Errorf("right last child = %d, want %d", c, maxInternalKeys+1)
+	}
+}
+
+func TestAsPageKeyCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		pageType manager.PageType
+		numKeys  uint64
+		ok       bool
+	}{
+		{"empty leaf", manager.PageTypeLeaf, 0, true},
+		{"full leaf", manager.PageTypeLeaf, maxLeafEntries, true},
+		{"overfull leaf", manager.PageTypeLeaf, maxLeafEntries + 1, false},
+		{"huge leaf", manager.PageTypeLeaf, 1 << 63, false},
+		{"full internal", manager.PageTypeInternal, maxInternalKeys, true},
+		{"overfull internal", manager.PageTypeInternal, maxInternalKeys + 1, false},
+	}
+	for _, tt := range tests {
+		var data [manager.PageSize]byte
+		manager.SetPageType(&data, tt.pageType)
+		binary.BigEndian.PutUint64(data[numKeysOffset:], tt.numKeys)
+
+		var err error
+		if tt.pageType == manager.PageTypeLeaf {
+			_, err = AsLeafPage(&data)
+		} else {
+			_, err = AsInternalPage(&data)
+		}
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, errCorruptPage) {
+			t.Errorf("%s: err = %v, want errCorruptPage", tt.name, err)
+		}
+	}
+
+	// Each wrapper also checks the page type
+	var data [manager.PageSize]byte
+	InitializeLeafPage(&data)
+	if _, err := AsInternalPage(&data); err == nil {
+		t.Error("AsInternalPage accepted a leaf")
+	}
+	InitializeInternalPage(&data)
+	if _, err := AsLeafPage(&data); err == nil {
+		t.Error("AsLeafPage accepted an internal page")
+	}
+}
+
+func TestBTreeSplitBoundary(t *testing.T) {
+	bm := manager.NewBufferManager()
+	defer bm.Close()
+	bt, err := NewBTreeIn(bm, manager.DefaultFileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A full root leaf is still one level; the next key splits it
+	for key := range uint64(maxLeafEntries) {
+		if err := bt.Insert(key, key+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h, err := bt.Height(); err != nil || h != 1 {
+		t.Errorf("Height of a full leaf = %d, %v, want 1", h, err)
+	}
+	if err := bt.Insert(maxLeafEntries, maxLeafEntries+1); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := bt.Height(); err != nil || h != 2 {
+		t.Errorf("Height after the split = %d, %v, want 2", h, err)
+	}
+	for key := range uint64(maxLeafEntries + 1) {
+		if v, err := bt.Get(key); err != nil || v != key+1 {
+			t.Fatalf("Get(%d) = %d, %v, want %d", key, v, err, key+1)
+		}
+	}
+}
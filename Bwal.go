@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"errors"
+	"slices"
+)
+
+// LSN is a log sequence number assigned by the write-ahead log.
+type LSN uint64
+
+// LogFlusher is the part of a write-ahead log the buffer manager needs to
+// uphold the log-before-data rule.
+type LogFlusher interface {
+	// FlushedLSN returns the highest LSN known to be durable.
+	FlushedLSN() LSN
+	// Flush makes the log durable up to and including lsn.
+	Flush(lsn LSN) error
+}
+
+// SetLogFlusher attaches a write-ahead log. From then on a dirty page is
+// never written back before the log is durable up to its pageLSN: the clock
+// sweep passes over such pages, and FlushPage/Close force the log first,
+// as does eviction when no other victim is left.
+func (bm *BufferManager) SetLogFlusher(wal LogFlusher) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.wal = wal
+}
+
+// HoldDirtyPages keeps dirty pages in the pool while hold is set:
+// eviction and Resize pass over them, so they reach disk only when
+// FlushPage, FlushAll, Sync, Checkpoint or Close writes them back. It is
+// for a log that redoes whole operations rather than page changes, which
+// needs the pages on disk to be those of one moment. Once every unpinned
+// frame holds a dirty page the pool grows instead of failing pins; the
+// caller should write them back well before, and Resize it back after.
+func (bm *BufferManager) HoldDirtyPages(hold bool) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.holdDirty = hold
+}
+
+// HeldPages returns every dirty page in the pool, logged or not, in page
+// order, for the owner of held pages to log them before writing them back.
+func (bm *BufferManager) HeldPages() []PageID {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	var ids []PageID
+	for _, frame := range bm.frames {
+		if frame.valid && frame.isDirty && frame.loading == nil {
+			ids = append(ids, frame.pageID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// evictable reports whether eviction may write back the frame if it
+// has to.
+func (bm *BufferManager) evictable(frame *bufferPage) bool {
+	return !frame.valid || !frame.isDirty || (!bm.holdDirty && bm.logDurable(frame))
+}
+
+// growForHeld adds frames to a pool that has no victim because of the
+// dirty pages it holds, and returns the first new frame, locked. bm.mu
+// must be held.
+func (bm *BufferManager) growForHeld() (int, bool) {
+	if !bm.holdDirty {
+		return 0, false
+	}
+	held := false
+	for _, frame := range bm.frames {
+		if frame.valid && frame.isDirty && !frame.pinned() {
+			held = true
+			break
+		}
+	}
+	if !held {
+		return 0, false
+	}
+	idx := len(bm.frames)
+	bm.frames = append(bm.frames, bm.newFrames(idx/8+1)...)
+	bm.frames[idx].tryLock()
+	return idx, true
+}
+
+// UnpinPageWithLSN unpins a page modified by the log record at lsn. The
+// frame is marked dirty and its pageLSN raised to lsn, in the page header
+// as well.
+func (bm *BufferManager) UnpinPageWithLSN(pageID PageID, lsn LSN) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	frame, err := bm.pinnedFrame(pageID)
+	if err != nil {
+		return err
+	}
+	// As with UnpinPage, a read-only page still gets unpinned
+	err = bm.checkWritable(pageID.FileID())
+	if err == nil {
+		frame.raiseLSN(lsn)
+		frame.isDirty = true
+	}
+	pins := frame.pins.Add(-1)
+	bm.releasePin(pageID)
+	bm.traceEvent(TraceUnpin, pageID, err == nil)
+	if frame.scan && pins == 0 {
+		bm.queueScanVictim(bm.pageTable[pageID])
+	}
+	return err
+}
+
+// GetPageLSN returns the pageLSN of a pinned page, so recovery can tell
+// whether a logged update is already reflected in it.
+func (bm *BufferManager) GetPageLSN(pageID PageID) (LSN, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	frame, err := bm.pinnedFrame(pageID)
+	if err != nil {
+		return 0, err
+	}
+	return frame.pageLSN, nil
+}
+
+// SetPageLSN records that the log record at lsn has been applied to a
+// pinned page. The LSN only ever moves forward; the page becomes dirty.
+func (bm *BufferManager) SetPageLSN(pageID PageID, lsn LSN) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	frame, err := bm.pinnedFrame(pageID)
+	if err != nil {
+		return err
+	}
+	if err := bm.checkWritable(pageID.FileID()); err != nil {
+		return err
+	}
+	frame.isDirty = true
+	frame.raiseLSN(lsn)
+	return nil
+}
+
+func (bm *BufferManager) pinnedFrame(pageID PageID) (*bufferPage, error) {
+	idx, exists := bm.pageTable[pageID]
+	if !exists {
+		return nil, errors.New("page not in buffer")
+	}
+	frame := bm.frames[idx]
+	if !frame.pinned() {
+		return nil, errors.New("page not pinned")
+	}
+	return frame, nil
+}
+
+func (frame *bufferPage) raiseLSN(lsn LSN) {
+	if frame.recLSN == 0 {
+		frame.recLSN = lsn
+	}
+	if lsn > frame.pageLSN {
+		frame.pageLSN = lsn
+		SetPageLSN(frame.data, lsn)
+	}
+}
+
+// logDurable reports whether the frame may be written back without first
+// forcing the log.
+func (bm *BufferManager) logDurable(frame *bufferPage) bool {
+	return bm.wal == nil || !frame.isDirty || frame.pageLSN <= bm.wal.FlushedLSN()
+}
+
+// forceLog flushes the log up to the frame's pageLSN if needed.
+func (bm *BufferManager) forceLog(frame *bufferPage) error {
+	if bm.logDurable(frame) {
+		return nil
+	}
+	return bm.wal.Flush(frame.pageLSN)
+}
@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// fakeLog is a LogFlusher that only remembers how far it was flushed.
+type fakeLog struct {
+	mu      sync.Mutex
+	flushed LSN
+	flushes int
+}
+
+func (l *fakeLog) FlushedLSN() LSN {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.flushed
+}
+
+func (l *fakeLog) Flush(lsn LSN) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushes++
+	if lsn > l.flushed {
+		l.flushed = lsn
+	}
+	return nil
+}
+
+// loggedBackend is a memory backend that records every page written ahead
+// of its log records.
+type loggedBackend struct {
+	*MemoryBackend
+	log *fakeLog
+	mu  sync.Mutex
+	bad []string
+}
+
+func (lb *loggedBackend) WritePage(pageNo uint64, buf *[PageSize]byte) error {
+	if lsn, flushed := GetPageLSN(buf), lb.log.FlushedLSN(); lsn > flushed {
+		lb.mu.Lock()
+		lb.bad = append(lb.bad, fmt.Sprintf("page %d at LSN %d, log flushed to %d", pageNo, lsn, flushed))
+		lb.mu.Unlock()
+	}
+	return lb.MemoryBackend.WritePage(pageNo, buf)
+}
+
+func (lb *loggedBackend) violations() []string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.bad
+}
+
+// newLoggedPages is a buffer manager of the given size over a loggedBackend,
+// with its fakeLog attached.
+func newLoggedPages(t *testing.T, frames int) (*BufferManager, *loggedBackend, FileID) {
+	t.Helper()
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: frames})
+	backend := &loggedBackend{MemoryBackend: NewMemoryBackend(), log: &fakeLog{}}
+	fileID, err := bm.AttachTablespace(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.SetLogFlusher(backend.log)
+	return bm, backend, fileID
+}
+
+// logPages creates n pages and updates page i under LSN first+i, without
+// flushing the log.
+func logPages(t *testing.T, bm *BufferManager, fileID FileID, n int, first LSN) []PageID {
+	t.Helper()
+	ids := make([]PageID, n)
+	for i := range ids {
+		pageID, data, err := bm.NewPageIn(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[PageHeaderSize] = byte(i + 1)
+		if err := bm.UnpinPageWithLSN(pageID, first+LSN(i)); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = pageID
+	}
+	return ids
+}
+
+func TestLogBeforeData(t *testing.T) {
+	bm, backend, fileID := newLoggedPages(t, 2)
+	ids := logPages(t, bm, fileID, 8, 1)
+	for i, pageID := range ids {
+		data, err := bm.PinPage(pageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[PageHeaderSize] != byte(i+1) {
+			t.Errorf("page %d holds %d, want %d", i, data[PageHeaderSize], i+1)
+		}
+		bm.UnpinPage(pageID, false)
+	}
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range backend.violations() {
+		t.Errorf("written before its log: %s", v)
+	}
+	if got := backend.log.FlushedLSN(); got != 8 {
+		t.Errorf("FlushedLSN = %d, want 8", got)
+	}
+}
+
+func TestEvictUnloggedPool(t *testing.T) {
+	bm, backend, fileID := newLoggedPages(t, 4)
+	defer bm.Close()
+
+	// Every frame holds a dirty page whose log is not durable
+	logPages(t, bm, fileID, 4, 10)
+	pageID, _, err := bm.NewPageIn(fileID)
+	if err != nil {
+		t.Fatalf("NewPageIn with a pool of un-logged pages: %v", err)
+	}
+	bm.UnpinPage(pageID, true)
+
+	// The victim is the page with the oldest LSN, so the log is forced no
+	// further than that
+	if got := backend.log.FlushedLSN(); got != 10 {
+		t.Errorf("FlushedLSN = %d, want 10", got)
+	}
+	for _, v := range backend.violations() {
+		t.Errorf("written before its log: %s", v)
+	}
+}
+
+func TestPageLSN(t *testing.T) {
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 2})
+	defer bm.Close()
+	backend := NewMemoryBackend()
+	fileID, _ := bm.AttachTablespace(backend)
+
+	pageID, data, err := bm.NewPageIn(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.SetPageLSN(pageID, 42); err != nil {
+		t.Fatal(err)
+	}
+	// An older LSN does not move it back
+	if err := bm.SetPageLSN(pageID, 7); err != nil {
+		t.Fatal(err)
+	}
+	if lsn, err := bm.GetPageLSN(pageID); err != nil || lsn != 42 {
+		t.Errorf("GetPageLSN = %d, %v, want 42", lsn, err)
+	}
+	if lsn := GetPageLSN(data); lsn != 42 {
+		t.Errorf("page header LSN = %d, want 42", lsn)
+	}
+	if err := bm.UnpinPage(pageID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Evict the page, which writes the LSN out with it, and read it back
+	fillPages(t, bm, fileID, 4)
+	var page [PageSize]byte
+	backend.ReadPage(pageID.PageNo(), &page)
+	if lsn := GetPageLSN(&page); lsn != 42 {
+		t.Errorf("written-back page header LSN = %d, want 42", lsn)
+	}
+	if _, err := bm.PinPage(pageID); err != nil {
+		t.Fatal(err)
+	}
+	if lsn, err := bm.GetPageLSN(pageID); err != nil || lsn != 42 {
+		t.Errorf("GetPageLSN after reload = %d, %v, want 42", lsn, err)
+	}
+	bm.UnpinPage(pageID, false)
+}
+
+func TestPageLSNUnpinned(t *testing.T) {
+	bm := NewBufferManager()
+	defer bm.Close()
+	fileID, _ := bm.AttachTablespace(NewMemoryBackend())
+	ids := fillPages(t, bm, fileID, 1)
+
+	if err := bm.SetPageLSN(ids[0], 1); err == nil {
+		t.Error("SetPageLSN on an unpinned page succeeded")
+	}
+	if _, err := bm.GetPageLSN(ids[0]); err == nil {
+		t.Error("GetPageLSN on an unpinned page succeeded")
+	}
+	if err := bm.SetPageLSN(MakePageID(fileID, 99), 1); err == nil {
+		t.Error("SetPageLSN on a page not in the buffer succeeded")
+	}
+}
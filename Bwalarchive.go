@@ -0,0 +1,322 @@
+package manager
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// walManifestKey names the object listing the archived segments, under
+// the archive's prefix.
+const walManifestKey = "manifest"
+
+// WALSegment is a closed segment file of a write-ahead log: one no longer
+// appended to, holding the records from FirstLSN to LastLSN.
+type WALSegment struct {
+	FirstLSN LSN
+	LastLSN  LSN
+	Path     string
+}
+
+// SegmentedLog is a write-ahead log kept in segment files, as archiving
+// needs it. WALWriter implements it.
+type SegmentedLog interface {
+	CheckpointLog
+	// Segments returns the closed segments still on disk, oldest first.
+	Segments() ([]WALSegment, error)
+}
+
+// WALArchiver copies closed WAL segments to an ObjectStore, such as an
+// S3Client or a DirStore, so that point-in-time recovery can replay them
+// onto a base backup after the log itself has been truncated. Safe for
+// concurrent use.
+type WALArchiver struct {
+	store  ObjectStore
+	prefix string
+
+	mu       sync.Mutex
+	archived []WALSegment // in LSN order, Path unset
+}
+
+// NewWALArchiver opens the archive under prefix in store, reading the
+// list of segments already archived there.
+func NewWALArchiver(store ObjectStore, prefix string) (*WALArchiver, error) {
+	archived, err := readWALManifest(store, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &WALArchiver{store: store, prefix: prefix, archived: archived}, nil
+}
+
+// segmentKey names the object of the segment starting at first. The hex
+// LSN keeps keys in log order.
+func segmentKey(prefix string, first LSN) string {
+	return fmt.Sprintf("%s%016x.wal", prefix, uint64(first))
+}
+
+// Archive uploads seg, then records it in the manifest. Archiving a
+// segment twice does nothing.
+func (a *WALArchiver) Archive(seg WALSegment) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i, found := slices.BinarySearchFunc(a.archived, seg.FirstLSN, func(s WALSegment, lsn LSN) int {
+		return cmp.Compare(s.FirstLSN, lsn)
+	})
+	if found {
+		return nil
+	}
+	data, err := os.ReadFile(seg.Path)
+	if err != nil {
+		return err
+	}
+	if err := a.store.PutObject(segmentKey(a.prefix, seg.FirstLSN), data); err != nil {
+		return err
+	}
+	archived := slices.Insert(slices.Clone(a.archived), i, WALSegment{FirstLSN: seg.FirstLSN, LastLSN: seg.LastLSN})
+	if err := a.store.PutObject(a.prefix+walManifestKey, encodeWALManifest(archived)); err != nil {
+		return err
+	}
+	a.archived = archived
+	return nil
+}
+
+// Archived returns the archived segments, oldest first.
+func (a *WALArchiver) Archived() []WALSegment {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.archived)
+}
+
+// ArchivedThrough returns the last LSN of the archive's newest segment.
+func (a *WALArchiver) ArchivedThrough() LSN {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.archived) == 0 {
+		return 0
+	}
+	return a.archived[len(a.archived)-1].LastLSN
+}
+
+// The manifest is a list of 16-byte entries: FirstLSN(8) LastLSN(8).
+func encodeWALManifest(segs []WALSegment) []byte {
+	buf := make([]byte, 0, 16*len(segs))
+	for _, s := range segs {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(s.FirstLSN))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(s.LastLSN))
+	}
+	return buf
+}
+
+func readWALManifest(store ObjectStore, prefix string) ([]WALSegment, error) {
+	buf, err := store.GetObject(prefix + walManifestKey)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(buf)%16 != 0 {
+		return nil, errors.New("corrupt WAL archive manifest")
+	}
+	segs := make([]WALSegment, len(buf)/16)
+	for i := range segs {
+		segs[i].FirstLSN = LSN(binary.LittleEndian.Uint64(buf[16*i:]))
+		segs[i].LastLSN = LSN(binary.LittleEndian.Uint64(buf[16*i+8:]))
+	}
+	return segs, nil
+}
+
+// ArchivingLog wraps a SegmentedLog so that no segment is truncated
+// before it is archived: TruncateBefore first archives every closed
+// segment it would drop. Pass it to Checkpoint or StartCheckpoints in
+// place of the log.
+type ArchivingLog struct {
+	SegmentedLog
+	Archiver *WALArchiver
+}
+
+// TruncateBefore archives the closed segments ending before lsn, then
+// truncates the log. If archiving fails, nothing is truncated.
+func (l ArchivingLog) TruncateBefore(lsn LSN) error {
+	segs, err := l.Segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		if seg.LastLSN >= lsn {
+			break
+		}
+		if err := l.Archiver.Archive(seg); err != nil {
+			return fmt.Errorf("archiving WAL segment %s: %w", seg.Path, err)
+		}
+	}
+	return l.SegmentedLog.TruncateBefore(lsn)
+}
+
+// LogRecord is a record of an archived segment, as RestoreWAL replays it.
+// Data is the record in the log's own format.
+type LogRecord struct {
+	LSN  LSN
+	Time time.Time // when it was logged; zero if the log does not say
+	Data []byte
+	// Checkpoint marks a record logged by WALWriter.AppendCheckpoint,
+	// whose Data DecodeCheckpointRecord reads.
+	Checkpoint bool
+}
+
+// RestoreTarget is where point-in-time recovery stops: after the last
+// record at or before LSN and at or before Time. A zero field sets no
+// limit.
+type RestoreTarget struct {
+	LSN  LSN
+	Time time.Time
+}
+
+func (t RestoreTarget) passed(rec LogRecord) bool {
+	return (t.LSN != 0 && rec.LSN > t.LSN) ||
+		(!t.Time.IsZero() && !rec.Time.IsZero() && rec.Time.After(t.Time))
+}
+
+// RestoreOptions configures RestoreWAL.
+type RestoreOptions struct {
+	// From is the LSN the base backup was taken at, from which its
+	// changes have to be replayed.
+	From   LSN
+	Target RestoreTarget
+	// Decode splits a segment into its records, in LSN order, handing
+	// each to yield and stopping when yield returns false.
+	Decode func(segment []byte, yield func(LogRecord) bool) error
+	// Apply redoes a record against the restored tablespaces.
+	Apply func(LogRecord) error
+}
+
+// RestoreResult describes a finished restore.
+type RestoreResult struct {
+	Segments int // read from the archive
+	Records  int // applied
+	LastLSN  LSN // of the last record applied
+	LastTime time.Time
+}
+
+// ErrArchiveGap is returned by RestoreWAL when the archive does not hold
+// the log from the base backup on.
+var ErrArchiveGap = errors.New("WAL archive does not reach back to the base backup")
+
+// RestoreWAL performs point-in-time recovery: with the tablespaces of a
+// base backup in place, it replays the archived records from opts.From up
+// to opts.Target through opts.Apply, to bring them to the state they had
+// at the target, such as just before an operator's mistake. Records of
+// segments that are not archived, still in the live log, are the
+// caller's to replay after it if the target lies beyond.
+func RestoreWAL(store ObjectStore, prefix string, opts RestoreOptions) (RestoreResult, error) {
+	var res RestoreResult
+	segs, err := readWALManifest(store, prefix)
+	if err != nil {
+		return res, err
+	}
+	i := 0
+	for i < len(segs) && segs[i].LastLSN < opts.From {
+		i++
+	}
+	if i == len(segs) || segs[i].FirstLSN > opts.From {
+		return res, ErrArchiveGap
+	}
+
+	for _, seg := range segs[i:] {
+		if opts.Target.LSN != 0 && seg.FirstLSN > opts.Target.LSN {
+			break
+		}
+		data, err := store.GetObject(segmentKey(prefix, seg.FirstLSN))
+		if err != nil {
+			return res, fmt.Errorf("reading archived WAL segment %016x: %w", uint64(seg.FirstLSN), err)
+		}
+		res.Segments++
+		done := false
+		var applyErr error
+		err = opts.Decode(data, func(rec LogRecord) bool {
+			if rec.LSN < opts.From {
+				return true
+			}
+			if opts.Target.passed(rec) {
+				done = true
+				return false
+			}
+			if applyErr = opts.Apply(rec); applyErr != nil {
+				return false
+			}
+			res.Records++
+			res.LastLSN, res.LastTime = rec.LSN, rec.Time
+			return true
+		})
+		if applyErr != nil {
+			return res, applyErr
+		}
+		if err != nil {
+			return res, err
+		}
+		if done {
+			break
+		}
+	}
+	return res, nil
+}
+
+// DirStore is an ObjectStore keeping each object as a file in a
+// directory, for archives on local or network-mounted disks. Keys may
+// contain slashes, which make subdirectories.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore opens the directory dir as an object store, creating it if
+// needed.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+func (d *DirStore) path(key string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(key))
+}
+
+func (d *DirStore) GetObject(key string) ([]byte, error) {
+	data, err := os.ReadFile(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return data, err
+}
+
+// PutObject writes the object to a temporary file, syncs it and renames
+// it into place, so a crash leaves either the old object or the new one.
+func (d *DirStore) PutObject(key string, data []byte) error {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWALSegmentRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	w, _, err := OpenWALWriterWithOptions(path, WALOptions{SegmentSize: 200}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		appendFlushed(t, w, fmt.Sprintf("record %02d", i))
+	}
+	segs, err := w.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) < 2 {
+		t.Fatalf("%d closed segments, want several", len(segs))
+	}
+	next := LSN(1)
+	for _, seg := range segs {
+		if seg.FirstLSN != next || seg.LastLSN < seg.FirstLSN || seg.Path != segmentPath(path, seg.FirstLSN) {
+			t.Errorf("segment %+v does not follow LSN %d", seg, next-1)
+		}
+		next = seg.LastLSN + 1
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening replays the closed segments, then the active one
+	w, rec, got := replayAll(t, path)
+	defer w.Close()
+	if len(got) != 20 || got[0] != "record 00" || got[19] != "record 19" || rec.LastLSN != 20 {
+		t.Errorf("replayed %d records up to LSN %d", len(got), rec.LastLSN)
+	}
+	if reopened, _ := w.Segments(); len(reopened) != len(segs) || reopened[len(segs)-1] != segs[len(segs)-1] {
+		t.Errorf("segments after reopen = %+v, want %+v", reopened, segs)
+	}
+}
+
+func TestWALArchiveAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	w, _, err := OpenWALWriterWithOptions(filepath.Join(dir, "log.wal"), WALOptions{SegmentSize: 256}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	store, err := NewDirStore(filepath.Join(dir, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiver, err := NewWALArchiver(store, "wal/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := ArchivingLog{SegmentedLog: w, Archiver: archiver}
+
+	// Half the records before the target time, half after
+	for i := range 10 {
+		appendFlushed(t, w, fmt.Sprintf("before %d", i))
+	}
+	time.Sleep(5 * time.Millisecond)
+	target := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	var last LSN
+	for i := range 10 {
+		last = appendFlushed(t, w, fmt.Sprintf("after %d", i))
+	}
+
+	// Truncating archives each segment it drops; the active one is closed
+	// and goes at the next truncation
+	if err := log.TruncateBefore(last + 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.TruncateBefore(last + 1); err != nil {
+		t.Fatal(err)
+	}
+	if segs, _ := w.Segments(); len(segs) != 0 {
+		t.Errorf("%d segments left after truncating everything", len(segs))
+	}
+	if archiver.ArchivedThrough() != last {
+		t.Fatalf("archived through %d, want %d", archiver.ArchivedThrough(), last)
+	}
+
+	restore := func(target RestoreTarget) ([]string, RestoreResult) {
+		t.Helper()
+		var applied []string
+		res, err := RestoreWAL(store, "wal/", RestoreOptions{
+			From:   1,
+			Target: target,
+			Decode: DecodeWALSegment,
+			Apply: func(rec LogRecord) error {
+				applied = append(applied, string(rec.Data))
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return applied, res
+	}
+
+	applied, res := restore(RestoreTarget{Time: target})
+	if len(applied) != 10 || applied[9] != "before 9" || res.LastLSN != 10 {
+		t.Errorf("restore to time: applied %q up to LSN %d", applied, res.LastLSN)
+	}
+	if res.LastTime.After(target) {
+		t.Errorf("restored a record from %v, past the target %v", res.LastTime, target)
+	}
+	applied, res = restore(RestoreTarget{LSN: 13})
+	if len(applied) != 13 || applied[12] != "after 2" || res.LastLSN != 13 {
+		t.Errorf("restore to LSN 13: applied %q up to LSN %d", applied, res.LastLSN)
+	}
+	applied, _ = restore(RestoreTarget{})
+	if len(applied) != 20 {
+		t.Errorf("restore of everything applied %d records, want 20", len(applied))
+	}
+
+	// The archive cannot bring a backup newer than its last record forward
+	if _, err := RestoreWAL(store, "wal/", RestoreOptions{From: 100, Decode: DecodeWALSegment}); err != ErrArchiveGap {
+		t.Errorf("restore from beyond the archive: %v, want ErrArchiveGap", err)
+	}
+}
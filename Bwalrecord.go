@@ -0,0 +1,619 @@
+package manager
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A WAL record is framed as
+//
+//	length(4) crc(4) lsn(8) time(8) data(length)
+//
+// with the CRC taken over everything after it and the length, so a record
+// cut short by a crash mid-append, or overwritten with garbage, fails the
+// check instead of being replayed. The length's top bit marks a
+// checkpoint record.
+//
+// A log file starts with a header
+//
+//	magic(4) crc(4) base(8)
+//
+// where base is the LSN its records follow: the last one assigned before
+// the file was started or reset, so numbering carries on past a Reset and
+// pageLSNs already on disk never run ahead of the log.
+const (
+	walHeaderSize = 24
+	// maxWALRecord bounds a record's data; a larger length is garbage
+	maxWALRecord = 16 << 20
+
+	walCheckpointFlag = 1 << 31
+
+	walFileHeaderSize = 16
+	walMagic          = "WAL\x01"
+)
+
+// ErrCorruptWAL is returned for a WAL record that fails its checksum where
+// a whole record is expected, as in an archived segment.
+var ErrCorruptWAL = errors.New("corrupt WAL record")
+
+// AppendWALRecord appends rec, framed with its length and checksum, to
+// dst.
+func AppendWALRecord(dst []byte, rec LogRecord) []byte {
+	start := len(dst)
+	n := uint32(len(rec.Data))
+	if rec.Checkpoint {
+		n |= walCheckpointFlag
+	}
+	dst = binary.LittleEndian.AppendUint32(dst, n)
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(rec.LSN))
+	var nanos int64
+	if !rec.Time.IsZero() {
+		nanos = rec.Time.UnixNano()
+	}
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(nanos))
+	dst = append(dst, rec.Data...)
+	binary.LittleEndian.PutUint32(dst[start+4:], walChecksum(dst[start:]))
+	return dst
+}
+
+// walChecksum covers a framed record but for its CRC field.
+func walChecksum(frame []byte) uint32 {
+	crc := crc32.ChecksumIEEE(frame[:4])
+	return crc32.Update(crc, crc32.IEEETable, frame[8:])
+}
+
+// appendWALFileHeader appends a log file header with base to dst.
+func appendWALFileHeader(dst []byte, base LSN) []byte {
+	start := len(dst)
+	dst = append(dst, walMagic...)
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(base))
+	binary.LittleEndian.PutUint32(dst[start+4:], crc32.ChecksumIEEE(dst[start+8:]))
+	return dst
+}
+
+// readWALFileHeader returns the base LSN of a log file and the length of
+// its header. A file without one, as written before headers were added
+// or cut short while being created, has its records start at offset 0
+// after LSN 0.
+func readWALFileHeader(data []byte) (LSN, int, error) {
+	if len(data) < walFileHeaderSize || string(data[:4]) != walMagic {
+		return 0, 0, nil
+	}
+	if binary.LittleEndian.Uint32(data[4:]) != crc32.ChecksumIEEE(data[8:walFileHeaderSize]) {
+		return 0, 0, fmt.Errorf("%w: bad log file header", ErrCorruptWAL)
+	}
+	return LSN(binary.LittleEndian.Uint64(data[8:])), walFileHeaderSize, nil
+}
+
+// scanWAL yields the records of data from its start until the first one
+// that is incomplete, fails its checksum, or does not follow the previous
+// LSN, starting after base, and returns the length of the valid prefix.
+// Data is not copied.
+func scanWAL(data []byte, base LSN, yield func(LogRecord) bool) int {
+	off := 0
+	last := base
+	for len(data)-off >= walHeaderSize {
+		frame := data[off:]
+		n := binary.LittleEndian.Uint32(frame)
+		checkpoint := n&walCheckpointFlag != 0
+		n &^= walCheckpointFlag
+		if n > maxWALRecord || int(n) > len(frame)-walHeaderSize {
+			break
+		}
+		frame = frame[:walHeaderSize+int(n)]
+		if binary.LittleEndian.Uint32(frame[4:]) != walChecksum(frame) {
+			break
+		}
+		rec := LogRecord{
+			LSN:        LSN(binary.LittleEndian.Uint64(frame[8:])),
+			Data:       frame[walHeaderSize:],
+			Checkpoint: checkpoint,
+		}
+		if rec.LSN <= last {
+			break
+		}
+		if nanos := int64(binary.LittleEndian.Uint64(frame[16:])); nanos != 0 {
+			rec.Time = time.Unix(0, nanos)
+		}
+		off += len(frame)
+		last = rec.LSN
+		if !yield(rec) {
+			break
+		}
+	}
+	return off
+}
+
+// DecodeWALSegment yields the records of a closed segment, as
+// RestoreOptions.Decode. A closed segment holds whole records only, so
+// any bytes past the last valid one make it fail with ErrCorruptWAL.
+func DecodeWALSegment(segment []byte, yield func(LogRecord) bool) error {
+	base, n, err := readWALFileHeader(segment)
+	if err != nil {
+		return err
+	}
+	segment = segment[n:]
+	stopped := false
+	valid := scanWAL(segment, base, func(rec LogRecord) bool {
+		if !yield(rec) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if !stopped && valid < len(segment) {
+		return fmt.Errorf("%w at offset %d", ErrCorruptWAL, valid)
+	}
+	return nil
+}
+
+// WALRecovery describes the log OpenWALWriter found.
+type WALRecovery struct {
+	Records   int   // valid records replayed
+	LastLSN   LSN   // of the last valid record, or the header's base
+	Truncated int64 // bytes of torn or corrupt tail cut off
+	// Checkpoint is the LSN of the last checkpoint record replayed, from
+	// which recovery starts; 0 if there is none.
+	Checkpoint LSN
+}
+
+// walSegment is a closed segment file of a WALWriter.
+type walSegment struct {
+	first, last LSN
+}
+
+// WALOptions configures OpenWALWriterWithOptions. The zero value is the
+// default.
+type WALOptions struct {
+	// SegmentSize closes the active segment once a flush takes it past
+	// this many bytes, so that it can be archived and, after a
+	// checkpoint, deleted. 0 leaves that to checkpoints and Rotate.
+	SegmentSize int64
+}
+
+// WALWriter appends framed records to a log file. It is a LogFlusher, so
+// it can be attached to a BufferManager with SetLogFlusher, and a
+// SegmentedLog for Checkpoint and ArchivingLog. Safe for concurrent use.
+//
+// Records are appended to the file at path, the active segment. When it
+// reaches WALOptions.SegmentSize, or a checkpoint truncates the log past
+// its first record, the active segment is closed, renamed to
+// path.<first LSN in hex>, and a new one started; closed segments are
+// deleted once no record in them is needed.
+type WALWriter struct {
+	mu      sync.Mutex
+	path    string
+	opts    WALOptions
+	f       *os.File
+	size    int64 // of the active segment
+	first   LSN   // of the active segment's first record, 0 if none
+	segs    []walSegment
+	buf     []byte // appended but not yet written
+	next    LSN
+	flushed LSN
+	err     error // a failed write leaves a torn tail, so no more follow
+}
+
+// segmentPath names the closed segment of the log at path starting at
+// first. The hex LSN keeps names in log order.
+func segmentPath(path string, first LSN) string {
+	return fmt.Sprintf("%s.%016x", path, uint64(first))
+}
+
+// listWALSegments returns the closed segments of the log at path, oldest
+// first, with only their first LSNs known.
+func listWALSegments(path string) ([]walSegment, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(path) + "."
+	var segs []walSegment
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || len(name) != 16 {
+			continue
+		}
+		first, err := strconv.ParseUint(name, 16, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, walSegment{first: LSN(first)})
+	}
+	slices.SortFunc(segs, func(a, b walSegment) int { return cmp.Compare(a.first, b.first) })
+	return segs, nil
+}
+
+// syncDir makes renames and removals in the directory of path durable.
+func syncDir(path string) error {
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// OpenWALWriter opens the log file at path, creating it if needed, and
+// recovers it: each valid record of its closed segments and then of the
+// file itself is passed to replay, which may be nil, and the file is
+// truncated after the last one, so a record torn by a crash mid-append is
+// neither replayed nor left in the way of new ones. Appends continue with
+// the LSN after the last valid record, or after the last one assigned
+// before a Reset if none is left.
+func OpenWALWriter(path string, replay func(LogRecord) error) (*WALWriter, WALRecovery, error) {
+	return OpenWALWriterWithOptions(path, WALOptions{}, replay)
+}
+
+// OpenWALWriterWithOptions is OpenWALWriter with options.
+func OpenWALWriterWithOptions(path string, opts WALOptions, replay func(LogRecord) error) (*WALWriter, WALRecovery, error) {
+	var rec WALRecovery
+	var replayErr error
+	yield := func(r LogRecord) bool {
+		if replay != nil {
+			if replayErr = replay(r); replayErr != nil {
+				return false
+			}
+		}
+		rec.Records++
+		rec.LastLSN = r.LSN
+		if r.Checkpoint {
+			rec.Checkpoint = r.LSN
+		}
+		return true
+	}
+
+	segs, err := listWALSegments(path)
+	if err != nil {
+		return nil, rec, err
+	}
+	for i := range segs {
+		seg := &segs[i]
+		segPath := segmentPath(path, seg.first)
+		data, err := os.ReadFile(segPath)
+		if err != nil {
+			return nil, rec, err
+		}
+		base, hdr, err := readWALFileHeader(data)
+		if err != nil {
+			return nil, rec, fmt.Errorf("%s: %w", segPath, err)
+		}
+		valid := hdr + scanWAL(data[hdr:], base, yield)
+		if replayErr != nil {
+			return nil, rec, replayErr
+		}
+		if valid < len(data) {
+			return nil, rec, fmt.Errorf("%s: %w at offset %d", segPath, ErrCorruptWAL, valid)
+		}
+		seg.last = rec.LastLSN
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, rec, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, rec, err
+	}
+	base, hdr, err := readWALFileHeader(data)
+	if err != nil {
+		f.Close()
+		return nil, rec, err
+	}
+	if hdr == 0 && scanWAL(data, 0, func(LogRecord) bool { return false }) == 0 {
+		// A new file, or one whose header a crash cut short, perhaps
+		// just after its predecessor became a closed segment: nothing in
+		// it can be a record
+		base = rec.LastLSN
+		if err := resetWALFile(f, base); err != nil {
+			f.Close()
+			return nil, rec, err
+		}
+		rec.Truncated = int64(max(len(data)-walFileHeaderSize, 0))
+		data = appendWALFileHeader(nil, base)
+		hdr = walFileHeaderSize
+	}
+	rec.LastLSN = max(rec.LastLSN, base)
+	var first LSN
+	valid := hdr + scanWAL(data[hdr:], base, func(r LogRecord) bool {
+		if first == 0 {
+			first = r.LSN
+		}
+		return yield(r)
+	})
+	if replayErr != nil {
+		f.Close()
+		return nil, rec, replayErr
+	}
+	if valid < len(data) {
+		rec.Truncated = int64(len(data) - valid)
+		if err := f.Truncate(int64(valid)); err != nil {
+			f.Close()
+			return nil, rec, err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return nil, rec, err
+		}
+	}
+	if _, err := f.Seek(int64(valid), io.SeekStart); err != nil {
+		f.Close()
+		return nil, rec, err
+	}
+	w := &WALWriter{
+		path:    path,
+		opts:    opts,
+		f:       f,
+		size:    int64(valid),
+		first:   first,
+		segs:    segs,
+		next:    rec.LastLSN + 1,
+		flushed: rec.LastLSN,
+	}
+	return w, rec, nil
+}
+
+// Append adds a record holding data to the log and returns its LSN. The
+// record is durable once Flush has been called with that LSN or a later
+// one.
+func (w *WALWriter) Append(data []byte) (LSN, error) {
+	return w.append(LogRecord{Data: data})
+}
+
+func (w *WALWriter) append(rec LogRecord) (LSN, error) {
+	if len(rec.Data) > maxWALRecord {
+		return 0, fmt.Errorf("WAL record of %d bytes exceeds %d", len(rec.Data), maxWALRecord)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	rec.LSN = w.next
+	rec.Time = time.Now()
+	w.next++
+	if w.first == 0 {
+		w.first = rec.LSN
+	}
+	w.buf = AppendWALRecord(w.buf, rec)
+	return rec.LSN, nil
+}
+
+// AppendCheckpoint logs rec as a checkpoint record and flushes the log.
+// Replay sees it with LogRecord.Checkpoint set, and WALRecovery reports
+// the last one.
+func (w *WALWriter) AppendCheckpoint(rec CheckpointRecord) (LSN, error) {
+	lsn, err := w.append(LogRecord{Data: encodeCheckpointRecord(rec), Checkpoint: true})
+	if err != nil {
+		return 0, err
+	}
+	return lsn, w.Flush(lsn)
+}
+
+// FlushedLSN returns the LSN of the last record known to be durable.
+func (w *WALWriter) FlushedLSN() LSN {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushed
+}
+
+// Flush writes the appended records and syncs the file, unless the log is
+// already durable up to lsn.
+func (w *WALWriter) Flush(lsn LSN) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if lsn <= w.flushed {
+		return nil
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.opts.SegmentSize > 0 && w.size >= w.opts.SegmentSize && w.first != 0 {
+		return w.rotate()
+	}
+	return nil
+}
+
+func (w *WALWriter) flush() error {
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	n, err := w.f.Write(w.buf)
+	w.size += int64(n)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.buf = w.buf[:0]
+	if err := w.f.Sync(); err != nil {
+		w.err = err
+		return err
+	}
+	w.flushed = w.next - 1
+	return nil
+}
+
+// TruncateBefore deletes the closed segments holding only records before
+// lsn. If the active segment holds such records, it is closed first, so
+// that a later call can delete it once lsn has moved past its last
+// record.
+func (w *WALWriter) TruncateBefore(lsn LSN) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	// A segment closed here is left for the next call, so a wrapper such
+	// as ArchivingLog sees it among Segments before it goes
+	closed := len(w.segs)
+	if w.first != 0 && w.first < lsn {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n := 0
+	for n < closed && w.segs[n].last < lsn {
+		if err := os.Remove(segmentPath(w.path, w.segs[n].first)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	w.segs = w.segs[n:]
+	return syncDir(w.path)
+}
+
+// Segments returns the closed segments still on disk, oldest first.
+func (w *WALWriter) Segments() ([]WALSegment, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	segs := make([]WALSegment, len(w.segs))
+	for i, seg := range w.segs {
+		segs[i] = WALSegment{FirstLSN: seg.first, LastLSN: seg.last, Path: segmentPath(w.path, seg.first)}
+	}
+	return segs, nil
+}
+
+// Rotate flushes the log and closes the active segment, if it holds any
+// records, so that an archiver can copy them without waiting for it to
+// fill.
+func (w *WALWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	if w.first == 0 {
+		return nil
+	}
+	return w.rotate()
+}
+
+// rotate closes the active segment: it is flushed and renamed to its
+// segment name, and an empty one takes its place.
+func (w *WALWriter) rotate() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	seg := walSegment{first: w.first, last: w.flushed}
+	if err := w.f.Close(); err != nil {
+		w.err = err
+		return err
+	}
+	w.f = nil
+	if err := os.Rename(w.path, segmentPath(w.path, seg.first)); err != nil {
+		w.err = err
+		return err
+	}
+	w.segs = append(w.segs, seg)
+	w.first = 0
+	// A crash before the new file's header is durable is recovered by
+	// OpenWALWriter, which continues after the closed segment
+	f, err := os.OpenFile(w.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.f = f
+	w.size = walFileHeaderSize
+	if err := resetWALFile(f, seg.last); err != nil {
+		w.err = err
+		return err
+	}
+	if err := syncDir(w.path); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Reset discards every record, appended or durable, once none is needed
+// for recovery, as after the pages they describe have been synced. LSNs
+// carry on from where they were, after a reopen too: the file's header
+// keeps the last one assigned.
+func (w *WALWriter) Reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.buf = w.buf[:0]
+	w.flushed = w.next - 1
+	for len(w.segs) > 0 {
+		if err := os.Remove(segmentPath(w.path, w.segs[0].first)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			w.err = err
+			return err
+		}
+		w.segs = w.segs[1:]
+	}
+	w.first = 0
+	w.size = walFileHeaderSize
+	if err := resetWALFile(w.f, w.flushed); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// resetWALFile empties a log file but for a header with base, and leaves
+// its offset at the end. The header is made durable before the records
+// are cut off: a crash in between leaves records at or before base, which
+// the next open drops as a torn tail, while one the other way around
+// would leave no header and restart numbering at 1.
+func resetWALFile(f *os.File, base LSN) error {
+	if _, err := f.WriteAt(appendWALFileHeader(nil, base), 0); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Truncate(walFileHeaderSize); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	_, err := f.Seek(walFileHeaderSize, io.SeekStart)
+	return err
+}
+
+// Close flushes the log and closes its file.
+func (w *WALWriter) Close() error {
+	err := w.Flush(^LSN(0))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return err
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+	return err
+}
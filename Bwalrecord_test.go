@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// appendFlushed appends one record per datum and flushes them.
+func appendFlushed(t *testing.T, w *WALWriter, data ...string) LSN {
+	t.Helper()
+	var lsn LSN
+	for _, d := range data {
+		var err error
+		if lsn, err = w.Append([]byte(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(lsn); err != nil {
+		t.Fatal(err)
+	}
+	return lsn
+}
+
+// replayAll reopens the log at path and returns the data of its records.
+func replayAll(t *testing.T, path string) (*WALWriter, WALRecovery, []string) {
+	t.Helper()
+	var got []string
+	w, rec, err := OpenWALWriter(path, func(r LogRecord) error {
+		got = append(got, string(r.Data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, rec, got
+}
+
+func TestWALTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	w, _, err := OpenWALWriter(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendFlushed(t, w, "one", "two", "three")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the last record short, as a crash mid-append would
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, fi.Size()-2); err != nil {
+		t.Fatal(err)
+	}
+	w, rec, got := replayAll(t, path)
+	if len(got) != 2 || got[0] != "one" || got[1] != "two" {
+		t.Fatalf("replayed %q, want [one two]", got)
+	}
+	if rec.LastLSN != 2 || rec.Truncated != int64(walHeaderSize+len("three")-2) {
+		t.Errorf("recovery = %+v", rec)
+	}
+
+	// New records go where the torn one was
+	if lsn := appendFlushed(t, w, "four"); lsn != 3 {
+		t.Errorf("LSN after torn tail = %d, want 3", lsn)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w, _, got = replayAll(t, path)
+	defer w.Close()
+	if len(got) != 3 || got[2] != "four" {
+		t.Errorf("replayed %q, want [one two four]", got)
+	}
+}
+
+func TestWALCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	w, _, err := OpenWALWriter(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendFlushed(t, w, "one", "two")
+	w.Close()
+
+	// Flip a byte of the second record's data
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, rec, got := replayAll(t, path)
+	defer w.Close()
+	if len(got) != 1 || got[0] != "one" || rec.LastLSN != 1 {
+		t.Errorf("replayed %q with %+v, want [one] up to LSN 1", got, rec)
+	}
+}
+
+func TestWALLSNsContinueAfterReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	w, _, err := OpenWALWriter(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendFlushed(t, w, "a", "b", "c")
+	if err := w.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if lsn := appendFlushed(t, w, "d"); lsn != 4 {
+		t.Errorf("LSN after Reset = %d, want 4", lsn)
+	}
+	if err := w.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty log still knows where numbering stopped
+	w, rec, got := replayAll(t, path)
+	if len(got) != 0 || rec.LastLSN != 4 {
+		t.Errorf("reopened reset log: replayed %q, recovery %+v", got, rec)
+	}
+	if w.FlushedLSN() != 4 {
+		t.Errorf("FlushedLSN = %d, want 4", w.FlushedLSN())
+	}
+	if lsn := appendFlushed(t, w, "e"); lsn != 5 {
+		t.Errorf("LSN after reopen = %d, want 5", lsn)
+	}
+	w.Close()
+
+	w, rec, got = replayAll(t, path)
+	defer w.Close()
+	if len(got) != 1 || got[0] != "e" || rec.LastLSN != 5 {
+		t.Errorf("replayed %q with %+v, want [e] up to LSN 5", got, rec)
+	}
+}
+
+func TestWALResetInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	w, _, err := OpenWALWriter(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendFlushed(t, w, "a", "b")
+	w.Close()
+
+	// A crash after Reset's new header but before its truncate leaves
+	// records the header has already passed
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(appendWALFileHeader(nil, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	w, rec, got := replayAll(t, path)
+	defer w.Close()
+	if len(got) != 0 || rec.LastLSN != 2 || rec.Truncated == 0 {
+		t.Errorf("replayed %q with %+v, want nothing after LSN 2", got, rec)
+	}
+}
@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// warmupMagic starts every resident page dump.
+const warmupMagic = 0x42574d50 // "BWMP"
+
+// DumpResidentPages writes the IDs of all cached pages to w, recently used
+// pages first, so WarmUp can reload them after a restart. The format is a
+// big-endian uint32 magic, a uint32 count and count uint64 page IDs.
+func (bm *BufferManager) DumpResidentPages(w io.Writer) error {
+	bm.mu.Lock()
+	var hot, cold []PageID
+	for _, frame := range bm.frames {
+		if !frame.valid {
+			continue
+		}
+		if frame.refBit.Load() || frame.pinned() {
+			hot = append(hot, frame.pageID)
+		} else {
+			cold = append(cold, frame.pageID)
+		}
+	}
+	bm.mu.Unlock()
+
+	ids := append(hot, cold...)
+	bw := bufio.NewWriter(w)
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[0:4], warmupMagic)
+	binary.BigEndian.PutUint32(header[4:8], uint32(len(ids)))
+	if _, err := bw.Write(header[:]); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		buf := Sizzle(id)
+		if _, err := bw.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WarmUp prefetches the pages listed by DumpResidentPages, stopping once the
+// pool is full. Pages that no longer exist are skipped. It returns the
+// number of pages loaded.
+func (bm *BufferManager) WarmUp(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	var header [8]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(header[0:4]) != warmupMagic {
+		return 0, errors.New("not a resident page dump")
+	}
+	count := int(binary.BigEndian.Uint32(header[4:8]))
+	if frames := bm.Frames(); count > frames {
+		count = frames
+	}
+
+	futures := make([]*IOFuture, 0, count)
+	for i := 0; i < count; i++ {
+		var buf [8]byte
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return 0, err
+		}
+		futures = append(futures, bm.Prefetch(Unsizzle(buf)))
+	}
+
+	loaded := 0
+	for _, f := range futures {
+		if f.Wait() == nil {
+			loaded++
+		}
+	}
+	return loaded, nil
+}
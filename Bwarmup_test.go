@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWarmUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warm")
+	bm := NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	fileID, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := fillPages(t, bm, fileID, 20)
+	// Pages 12 to 19 are cached; 18 and 19 were used since the clock
+	// last passed
+	for _, frame := range bm.frames {
+		frame.refBit.Store(false)
+	}
+	hot := ids[18:]
+	checkPages(t, bm, hot)
+
+	var dump bytes.Buffer
+	if err := bm.DumpResidentPages(&dump); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := dump.Bytes()
+	if n := binary.BigEndian.Uint32(b[4:]); n != 8 || len(b) != 8+8*8 {
+		t.Fatalf("dump of %d bytes lists %d pages, want 8", len(b), n)
+	}
+	var dumped []PageID
+	for i := 8; i < len(b); i += 8 {
+		dumped = append(dumped, PageID(binary.BigEndian.Uint64(b[i:])))
+	}
+	if !slices.Contains(dumped[:2], hot[0]) || !slices.Contains(dumped[:2], hot[1]) {
+		t.Errorf("dump %v does not list the recently used pages first", dumped)
+	}
+
+	// A smaller pool takes the hottest pages only
+	for _, frames := range []int{8, 2} {
+		bm = NewBufferManagerWithOptions(ManagerOptions{Frames: frames})
+		if _, err := bm.CreateTablespace(path); err != nil {
+			t.Fatal(err)
+		}
+		n, err := bm.WarmUp(bytes.NewReader(b))
+		if err != nil || n != frames {
+			t.Errorf("WarmUp into %d frames = %d, %v", frames, n, err)
+		}
+		checkPages(t, bm, dumped[:frames])
+		if s := bm.Stats(); s.Misses != 0 || s.PagesRead != uint64(frames) {
+			t.Errorf("%d frames: after warm-up %d misses, %d reads", frames, s.Misses, s.PagesRead)
+		}
+		bm.Close()
+	}
+
+	// Pages gone since the dump are skipped
+	bm = NewBufferManagerWithOptions(ManagerOptions{Frames: 8})
+	defer bm.Close()
+	if n, err := bm.WarmUp(bytes.NewReader(b)); err != nil || n != 0 {
+		t.Errorf("WarmUp without the tablespace = %d, %v", n, err)
+	}
+	if _, err := bm.WarmUp(bytes.NewReader([]byte("not a dump"))); err == nil {
+		t.Error("WarmUp of a bad dump succeeded")
+	}
+	if _, err := bm.WarmUp(bytes.NewReader(b[:20])); err == nil {
+		t.Error("WarmUp of a cut dump succeeded")
+	}
+}
@@ -0,0 +1,706 @@
+package bitmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"math/bits"
+	"slices"
+)
+
+const (
+	// An array container holds at most this many values; past it a
+	// bitmap container is smaller
+	arrayMax   = 4096
+	bitmapSize = 1 << 16 / 64 // words
+)
+
+// bitmapMagic starts every saved Bitmap.
+const bitmapMagic = 0x524F4152 // "ROAR"
+
+// Container kinds, as saved
+const (
+	kindArray byte = iota
+	kindBitmap
+	kindRun
+)
+
+// container holds the low 16 bits of the values sharing their high bits.
+// Methods that modify a container return the one to use from then on,
+// which may be of another kind.
+type container interface {
+	add(v uint16) container
+	remove(v uint16) container
+	contains(v uint16) bool
+	cardinality() int
+	// rank returns the number of values <= v
+	rank(v uint16) int
+	// selectAt returns the value of rank i+1
+	selectAt(i int) uint16
+	// toBitmap returns the values as a bitmap container, never sharing
+	// memory with the receiver
+	toBitmap() *bitmapContainer
+	all() iter.Seq[uint16]
+}
+
+type arrayContainer struct {
+	vals []uint16 // sorted
+}
+
+func (a *arrayContainer) add(v uint16) container {
+	i, ok := slices.BinarySearch(a.vals, v)
+	if ok {
+		return a
+	}
+	if len(a.vals) == arrayMax {
+		return a.toBitmap().add(v)
+	}
+	a.vals = slices.Insert(a.vals, i, v)
+	return a
+}
+
+func (a *arrayContainer) remove(v uint16) container {
+	if i, ok := slices.BinarySearch(a.vals, v); ok {
+		a.vals = slices.Delete(a.vals, i, i+1)
+	}
+	return a
+}
+
+func (a *arrayContainer) contains(v uint16) bool {
+	_, ok := slices.BinarySearch(a.vals, v)
+	return ok
+}
+
+func (a *arrayContainer) cardinality() int { return len(a.vals) }
+
+func (a *arrayContainer) rank(v uint16) int {
+	i, ok := slices.BinarySearch(a.vals, v)
+	if ok {
+		i++
+	}
+	return i
+}
+
+func (a *arrayContainer) selectAt(i int) uint16 { return a.vals[i] }
+
+func (a *arrayContainer) toBitmap() *bitmapContainer {
+	b := &bitmapContainer{}
+	for _, v := range a.vals {
+		b.words[v/64] |= 1 << (v % 64)
+	}
+	b.card = len(a.vals)
+	return b
+}
+
+func (a *arrayContainer) all() iter.Seq[uint16] { return slices.Values(a.vals) }
+
+type bitmapContainer struct {
+	words [bitmapSize]uint64
+	card  int
+}
+
+func (b *bitmapContainer) add(v uint16) container {
+	w := &b.words[v/64]
+	if *w&(1<<(v%64)) == 0 {
+		*w |= 1 << (v % 64)
+		b.card++
+	}
+	return b
+}
+
+func (b *bitmapContainer) remove(v uint16) container {
+	w := &b.words[v/64]
+	if *w&(1<<(v%64)) != 0 {
+		*w &^= 1 << (v % 64)
+		b.card--
+	}
+	return normalize(b)
+}
+
+func (b *bitmapContainer) contains(v uint16) bool {
+	return b.words[v/64]&(1<<(v%64)) != 0
+}
+
+func (b *bitmapContainer) cardinality() int { return b.card }
+
+func (b *bitmapContainer) rank(v uint16) int {
+	n := 0
+	for _, w := range b.words[:v/64] {
+		n += bits.OnesCount64(w)
+	}
+	// The bits up to and including v in its word; for the top bit the
+	// shift gives 0 and the mask all ones
+	mask := uint64(1)<<(v%64+1) - 1
+	return n + bits.OnesCount64(b.words[v/64]&mask)
+}
+
+func (b *bitmapContainer) selectAt(i int) uint16 {
+	for k, w := range b.words {
+		n := bits.OnesCount64(w)
+		if i >= n {
+			i -= n
+			continue
+		}
+		for ; i > 0; i-- {
+			w &= w - 1
+		}
+		return uint16(k*64 + bits.TrailingZeros64(w))
+	}
+	panic("bitmap: select past the end of a container")
+}
+
+func (b *bitmapContainer) toBitmap() *bitmapContainer {
+	c := *b
+	return &c
+}
+
+func (b *bitmapContainer) all() iter.Seq[uint16] {
+	return func(yield func(uint16) bool) {
+		for k, w := range b.words {
+			for ; w != 0; w &= w - 1 {
+				if !yield(uint16(k*64 + bits.TrailingZeros64(w))) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// recount sets card from the words, after they are combined wholesale.
+func (b *bitmapContainer) recount() {
+	b.card = 0
+	for _, w := range b.words {
+		b.card += bits.OnesCount64(w)
+	}
+}
+
+type run struct {
+	start, last uint16
+}
+
+// runContainer holds runs of consecutive values, for dense ranges such as
+// row IDs loaded in order. Modifying one turns it into an array or bitmap
+// container; RunOptimize turns it back.
+type runContainer struct {
+	runs []run // sorted, not touching
+}
+
+// find returns the index of the run containing v, or -1.
+func (r *runContainer) find(v uint16) int {
+	i, _ := slices.BinarySearchFunc(r.runs, v, func(x run, v uint16) int {
+		return int(x.start) - int(v)
+	})
+	// i is the first run starting after v, unless one starts at v
+	if i < len(r.runs) && r.runs[i].start == v {
+		return i
+	}
+	if i > 0 && v <= r.runs[i-1].last {
+		return i - 1
+	}
+	return -1
+}
+
+func (r *runContainer) add(v uint16) container {
+	if r.contains(v) {
+		return r
+	}
+	return normalize(r.toBitmap()).add(v)
+}
+
+func (r *runContainer) remove(v uint16) container {
+	if !r.contains(v) {
+		return r
+	}
+	return normalize(r.toBitmap()).remove(v)
+}
+
+func (r *runContainer) contains(v uint16) bool { return r.find(v) >= 0 }
+
+func (r *runContainer) cardinality() int {
+	n := 0
+	for _, x := range r.runs {
+		n += int(x.last-x.start) + 1
+	}
+	return n
+}
+
+func (r *runContainer) rank(v uint16) int {
+	n := 0
+	for _, x := range r.runs {
+		if x.start > v {
+			break
+		}
+		n += int(min(x.last, v)-x.start) + 1
+	}
+	return n
+}
+
+func (r *runContainer) selectAt(i int) uint16 {
+	for _, x := range r.runs {
+		if n := int(x.last-x.start) + 1; i >= n {
+			i -= n
+			continue
+		}
+		return x.start + uint16(i)
+	}
+	panic("bitmap: select past the end of a container")
+}
+
+func (r *runContainer) toBitmap() *bitmapContainer {
+	b := &bitmapContainer{}
+	for _, x := range r.runs {
+		for v := int(x.start); v <= int(x.last); v++ {
+			b.words[v/64] |= 1 << (v % 64)
+		}
+	}
+	b.recount()
+	return b
+}
+
+func (r *runContainer) all() iter.Seq[uint16] {
+	return func(yield func(uint16) bool) {
+		for _, x := range r.runs {
+			for v := int(x.start); v <= int(x.last); v++ {
+				if !yield(uint16(v)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// normalize returns the values of b as an array container if that is
+// smaller, or nil if there are none.
+func normalize(b *bitmapContainer) container {
+	if b.card == 0 {
+		return nil
+	}
+	if b.card > arrayMax {
+		return b
+	}
+	return &arrayContainer{vals: slices.Collect(b.all())}
+}
+
+func or(a, b container) container {
+	if x, ok := a.(*arrayContainer); ok {
+		if y, ok := b.(*arrayContainer); ok && len(x.vals)+len(y.vals) <= arrayMax {
+			vals := append(slices.Clone(x.vals), y.vals...)
+			slices.Sort(vals)
+			return &arrayContainer{vals: slices.Compact(vals)}
+		}
+	}
+	c := a.toBitmap()
+	d := b.toBitmap()
+	for i := range c.words {
+		c.words[i] |= d.words[i]
+	}
+	c.recount()
+	return normalize(c)
+}
+
+func and(a, b container) container {
+	// Probe the other with each value of an array
+	if _, ok := b.(*arrayContainer); ok {
+		a, b = b, a
+	}
+	if x, ok := a.(*arrayContainer); ok {
+		var vals []uint16
+		for _, v := range x.vals {
+			if b.contains(v) {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) == 0 {
+			return nil
+		}
+		return &arrayContainer{vals: vals}
+	}
+	c := a.toBitmap()
+	d := b.toBitmap()
+	for i := range c.words {
+		c.words[i] &= d.words[i]
+	}
+	c.recount()
+	return normalize(c)
+}
+
+func andNot(a, b container) container {
+	if x, ok := a.(*arrayContainer); ok {
+		var vals []uint16
+		for _, v := range x.vals {
+			if !b.contains(v) {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) == 0 {
+			return nil
+		}
+		return &arrayContainer{vals: vals}
+	}
+	c := a.toBitmap()
+	d := b.toBitmap()
+	for i := range c.words {
+		c.words[i] &^= d.words[i]
+	}
+	c.recount()
+	return normalize(c)
+}
+
+// Bitmap is a compressed set of uint64 values, such as row IDs for a
+// secondary index over a B+Tree, in the manner of Roaring bitmaps. Values
+// are grouped by their high 48 bits, and each group's low 16 bits are
+// kept in whichever container is smallest: a sorted array while there are
+// at most 4096 of them, a 65536-bit bitmap past that, or, after
+// RunOptimize, runs of consecutive values. Set operations work container
+// by container, with word-wide ANDs and ORs between bitmaps.
+//
+// Like a Go map, a Bitmap may be read from several goroutines at once but
+// must not be modified while anything else uses it.
+type Bitmap struct {
+	keys       []uint64 // high 48 bits, sorted
+	containers []container
+}
+
+func New() *Bitmap {
+	return &Bitmap{}
+}
+
+// Of returns a bitmap of the given values.
+func Of(values ...uint64) *Bitmap {
+	b := New()
+	for _, v := range values {
+		b.Set(v)
+	}
+	return b
+}
+
+func (b *Bitmap) index(hi uint64) (int, bool) {
+	return slices.BinarySearch(b.keys, hi)
+}
+
+// Set adds v.
+func (b *Bitmap) Set(v uint64) {
+	hi, lo := v>>16, uint16(v)
+	i, ok := b.index(hi)
+	if !ok {
+		b.keys = slices.Insert(b.keys, i, hi)
+		b.containers = slices.Insert(b.containers, i, container(&arrayContainer{}))
+	}
+	b.containers[i] = b.containers[i].add(lo)
+}
+
+// Remove deletes v.
+func (b *Bitmap) Remove(v uint64) {
+	i, ok := b.index(v >> 16)
+	if !ok {
+		return
+	}
+	if c := b.containers[i].remove(uint16(v)); c != nil && c.cardinality() > 0 {
+		b.containers[i] = c
+		return
+	}
+	b.keys = slices.Delete(b.keys, i, i+1)
+	b.containers = slices.Delete(b.containers, i, i+1)
+}
+
+func (b *Bitmap) Contains(v uint64) bool {
+	i, ok := b.index(v >> 16)
+	return ok && b.containers[i].contains(uint16(v))
+}
+
+// Cardinality returns the number of values.
+func (b *Bitmap) Cardinality() uint64 {
+	var n uint64
+	for _, c := range b.containers {
+		n += uint64(c.cardinality())
+	}
+	return n
+}
+
+// Rank returns the number of values <= v.
+func (b *Bitmap) Rank(v uint64) uint64 {
+	var n uint64
+	for i, hi := range b.keys {
+		if hi > v>>16 {
+			break
+		}
+		if hi < v>>16 {
+			n += uint64(b.containers[i].cardinality())
+		} else {
+			n += uint64(b.containers[i].rank(uint16(v)))
+		}
+	}
+	return n
+}
+
+// Select returns the value of rank i+1, the smallest being Select(0), and
+// false if there are no more than i values.
+func (b *Bitmap) Select(i uint64) (uint64, bool) {
+	for k, c := range b.containers {
+		n := uint64(c.cardinality())
+		if i >= n {
+			i -= n
+			continue
+		}
+		return b.keys[k]<<16 | uint64(c.selectAt(int(i))), true
+	}
+	return 0, false
+}
+
+// All returns an iterator over the values in increasing order. The bitmap
+// must not be modified during the loop.
+func (b *Bitmap) All() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for i, c := range b.containers {
+			for lo := range c.all() {
+				if !yield(b.keys[i]<<16 | uint64(lo)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// combine applies op to the containers of b and o with the same high bits.
+// A container of only one side is kept if keepB or keepO says so.
+func (b *Bitmap) combine(o *Bitmap, op func(a, b container) container, keepB, keepO bool) *Bitmap {
+	r := New()
+	keep := func(hi uint64, c container) {
+		if c != nil {
+			r.keys = append(r.keys, hi)
+			r.containers = append(r.containers, c)
+		}
+	}
+	i, j := 0, 0
+	for i < len(b.keys) || j < len(o.keys) {
+		switch {
+		case j == len(o.keys) || i < len(b.keys) && b.keys[i] < o.keys[j]:
+			if keepB {
+				keep(b.keys[i], clone(b.containers[i]))
+			}
+			i++
+		case i == len(b.keys) || o.keys[j] < b.keys[i]:
+			if keepO {
+				keep(o.keys[j], clone(o.containers[j]))
+			}
+			j++
+		default:
+			keep(b.keys[i], op(b.containers[i], o.containers[j]))
+			i++
+			j++
+		}
+	}
+	return r
+}
+
+func clone(c container) container {
+	switch c := c.(type) {
+	case *arrayContainer:
+		return &arrayContainer{vals: slices.Clone(c.vals)}
+	case *runContainer:
+		return &runContainer{runs: slices.Clone(c.runs)}
+	}
+	return c.toBitmap()
+}
+
+// And returns a new bitmap of the values in both b and o.
+func (b *Bitmap) And(o *Bitmap) *Bitmap { return b.combine(o, and, false, false) }
+
+// Or returns a new bitmap of the values in either b or o.
+func (b *Bitmap) Or(o *Bitmap) *Bitmap { return b.combine(o, or, true, true) }
+
+// AndNot returns a new bitmap of the values in b but not in o.
+func (b *Bitmap) AndNot(o *Bitmap) *Bitmap { return b.combine(o, andNot, true, false) }
+
+// RunOptimize turns each container into runs of consecutive values where
+// that is smaller than an array or bitmap, and back where it is not.
+func (b *Bitmap) RunOptimize() {
+	for i, c := range b.containers {
+		var runs []run
+		for v := range c.all() {
+			if n := len(runs); n > 0 && runs[n-1].last+1 == v {
+				runs[n-1].last = v
+			} else {
+				runs = append(runs, run{v, v})
+			}
+		}
+		card := c.cardinality()
+		runBytes, arrayBytes, bitmapBytes := 4*len(runs), 2*card, bitmapSize*8
+		switch {
+		case runBytes < min(arrayBytes, bitmapBytes):
+			b.containers[i] = &runContainer{runs: runs}
+		case card <= arrayMax:
+			if _, ok := c.(*arrayContainer); !ok {
+				b.containers[i] = &arrayContainer{vals: slices.Collect(c.all())}
+			}
+		default:
+			if _, ok := c.(*bitmapContainer); !ok {
+				b.containers[i] = c.toBitmap()
+			}
+		}
+	}
+}
+
+// Save writes the bitmap to w, for Load. The format, all integers
+// big-endian:
+//
+//	magic(4) containers(4)
+//	key(8) kind(1) count(4), each container, followed by
+//	  array:  count values(2)
+//	  bitmap: 1024 words(8), count being the cardinality
+//	  run:    count runs of start(2) last(2)
+//	crc(4)  CRC-32 (IEEE) of everything before it
+func (b *Bitmap) Save(w io.Writer) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	var buf [8]byte
+	put16 := func(v uint16) {
+		binary.BigEndian.PutUint16(buf[:2], v)
+		bw.Write(buf[:2])
+	}
+	put32 := func(v uint32) {
+		binary.BigEndian.PutUint32(buf[:4], v)
+		bw.Write(buf[:4])
+	}
+	put64 := func(v uint64) {
+		binary.BigEndian.PutUint64(buf[:], v)
+		bw.Write(buf[:])
+	}
+
+	put32(bitmapMagic)
+	put32(uint32(len(b.containers)))
+	for i, c := range b.containers {
+		put64(b.keys[i])
+		switch c := c.(type) {
+		case *arrayContainer:
+			bw.WriteByte(kindArray)
+			put32(uint32(len(c.vals)))
+			for _, v := range c.vals {
+				put16(v)
+			}
+		case *bitmapContainer:
+			bw.WriteByte(kindBitmap)
+			put32(uint32(c.card))
+			for _, word := range c.words {
+				put64(word)
+			}
+		case *runContainer:
+			bw.WriteByte(kindRun)
+			put32(uint32(len(c.runs)))
+			for _, x := range c.runs {
+				put16(x.start)
+				put16(x.last)
+			}
+		}
+	}
+	// bufio keeps the first write error and returns it here
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc.Sum32())
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// Load reads a bitmap written by Save. It reads r directly, no further
+// than the bitmap's end, so a bitmap can be embedded in a larger stream.
+func Load(r io.Reader) (*Bitmap, error) {
+	crc := crc32.NewIEEE()
+	tr := io.TeeReader(r, crc)
+	// A container is read whole, so this holds the largest, a bitmap
+	buf := make([]byte, bitmapSize*8)
+	read := func(n int) ([]byte, error) {
+		_, err := io.ReadFull(tr, buf[:n])
+		return buf[:n], err
+	}
+
+	hdr, err := read(8)
+	if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(hdr[:4]) != bitmapMagic {
+		return nil, errors.New("not a saved bitmap")
+	}
+	n := binary.BigEndian.Uint32(hdr[4:])
+
+	b := New()
+	for i := uint32(0); i < n; i++ {
+		h, err := read(13)
+		if err != nil {
+			return nil, err
+		}
+		key := binary.BigEndian.Uint64(h)
+		if key >= 1<<48 || len(b.keys) > 0 && key <= b.keys[len(b.keys)-1] {
+			return nil, fmt.Errorf("corrupt bitmap: container %d key %#x", i, key)
+		}
+		kind, count := h[8], binary.BigEndian.Uint32(h[9:])
+
+		var c container
+		switch kind {
+		case kindArray:
+			if count == 0 || count > arrayMax {
+				return nil, fmt.Errorf("corrupt bitmap: array of %d values", count)
+			}
+			data, err := read(2 * int(count))
+			if err != nil {
+				return nil, err
+			}
+			a := &arrayContainer{vals: make([]uint16, count)}
+			for j := range a.vals {
+				a.vals[j] = binary.BigEndian.Uint16(data[2*j:])
+				if j > 0 && a.vals[j] <= a.vals[j-1] {
+					return nil, fmt.Errorf("corrupt bitmap: array values out of order in container %d", i)
+				}
+			}
+			c = a
+		case kindBitmap:
+			data, err := read(bitmapSize * 8)
+			if err != nil {
+				return nil, err
+			}
+			bc := &bitmapContainer{}
+			for j := range bc.words {
+				bc.words[j] = binary.BigEndian.Uint64(data[8*j:])
+			}
+			bc.recount()
+			if bc.card != int(count) || count == 0 {
+				return nil, fmt.Errorf("corrupt bitmap: bitmap of %d values, header says %d", bc.card, count)
+			}
+			c = bc
+		case kindRun:
+			if count == 0 || count > 1<<15 {
+				return nil, fmt.Errorf("corrupt bitmap: %d runs", count)
+			}
+			data, err := read(4 * int(count))
+			if err != nil {
+				return nil, err
+			}
+			rc := &runContainer{runs: make([]run, count)}
+			for j := range rc.runs {
+				x := run{binary.BigEndian.Uint16(data[4*j:]), binary.BigEndian.Uint16(data[4*j+2:])}
+				if x.last < x.start || j > 0 && int(x.start) <= int(rc.runs[j-1].last)+1 {
+					return nil, fmt.Errorf("corrupt bitmap: bad run in container %d", i)
+				}
+				rc.runs[j] = x
+			}
+			c = rc
+		default:
+			return nil, fmt.Errorf("corrupt bitmap: container kind %d", kind)
+		}
+		b.keys = append(b.keys, key)
+		b.containers = append(b.containers, c)
+	}
+
+	sum := crc.Sum32()
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(buf[:4]) != sum {
+		return nil, errors.New("corrupt bitmap: checksum mismatch")
+	}
+	return b, nil
+}
@@ -0,0 +1,300 @@
+package bitmap
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// check checks that b holds exactly want, in the kind of container each
+// high 48 bits' count calls for.
+func check(t *testing.T, b *Bitmap, want map[uint64]bool) {
+	t.Helper()
+	if !slices.IsSorted(b.keys) || len(b.keys) != len(b.containers) {
+		t.Fatalf("%d keys out of order or not one per container", len(b.keys))
+	}
+	for i, c := range b.containers {
+		n := c.cardinality()
+		switch c.(type) {
+		case *arrayContainer:
+			if n == 0 || n > arrayMax {
+				t.Fatalf("container %#x: array of %d values", b.keys[i], n)
+			}
+		case *bitmapContainer:
+			if n <= arrayMax {
+				t.Fatalf("container %#x: bitmap of %d values", b.keys[i], n)
+			}
+		}
+	}
+	if b.Cardinality() != uint64(len(want)) {
+		t.Fatalf("Cardinality = %d, want %d", b.Cardinality(), len(want))
+	}
+	if got, sorted := slices.Collect(b.All()), slices.Sorted(maps.Keys(want)); !slices.Equal(got, sorted) {
+		t.Fatalf("All yields %d values, want %d in order", len(got), len(sorted))
+	}
+}
+
+// randomValues returns values clustered so that some containers are
+// sparse, some dense, and some hold long runs.
+func randomValues(r *rand.Rand, n int) []uint64 {
+	values := make([]uint64, n)
+	for i := range values {
+		switch r.IntN(3) {
+		case 0: // sparse, over many containers
+			values[i] = r.Uint64N(1 << 40)
+		case 1: // dense in container 3
+			values[i] = 3<<16 | r.Uint64N(1<<16)
+		case 2: // a run in container 7
+			values[i] = 7<<16 | 1000 + r.Uint64N(20000)
+		}
+	}
+	return values
+}
+
+func TestSetRemove(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	b := New()
+	want := make(map[uint64]bool)
+	for _, v := range randomValues(r, 60000) {
+		b.Set(v)
+		want[v] = true
+	}
+	check(t, b, want)
+	if _, ok := b.containers[slices.Index(b.keys, 3)].(*bitmapContainer); !ok {
+		t.Errorf("dense container is %T", b.containers[slices.Index(b.keys, 3)])
+	}
+	for range 1000 {
+		v := randomValues(r, 1)[0]
+		if b.Contains(v) != want[v] {
+			t.Fatalf("Contains(%#x) = %v", v, !want[v])
+		}
+	}
+
+	// Removing most values turns the bitmaps back into arrays and drops
+	// the emptied containers
+	for v := range want {
+		if r.IntN(10) > 0 {
+			b.Remove(v)
+			delete(want, v)
+		}
+	}
+	b.Remove(1 << 50)
+	check(t, b, want)
+	for v := range want {
+		b.Remove(v)
+	}
+	if len(b.keys) != 0 || b.Cardinality() != 0 {
+		t.Errorf("emptied bitmap has %d containers", len(b.keys))
+	}
+}
+
+func TestArrayToBitmap(t *testing.T) {
+	b := New()
+	for v := range uint64(arrayMax) {
+		b.Set(v * 2)
+	}
+	if _, ok := b.containers[0].(*arrayContainer); !ok {
+		t.Fatalf("%d values in a %T", arrayMax, b.containers[0])
+	}
+	b.Set(1)
+	if _, ok := b.containers[0].(*bitmapContainer); !ok {
+		t.Fatalf("%d values in a %T", arrayMax+1, b.containers[0])
+	}
+	b.Set(1)
+	b.Remove(1)
+	if _, ok := b.containers[0].(*arrayContainer); !ok {
+		t.Errorf("%d values in a %T after a remove", arrayMax, b.containers[0])
+	}
+}
+
+func TestRankSelect(t *testing.T) {
+	r := rand.New(rand.NewPCG(2, 2))
+	values := randomValues(r, 30000)
+	b := Of(values...)
+	sorted := slices.Compact(slices.Sorted(slices.Values(values)))
+	for _, optimize := range []bool{false, true} {
+		if optimize {
+			b.RunOptimize()
+		}
+		for range 2000 {
+			i := r.IntN(len(sorted))
+			if v, ok := b.Select(uint64(i)); !ok || v != sorted[i] {
+				t.Fatalf("Select(%d) = %#x, %v, want %#x", i, v, ok, sorted[i])
+			}
+			if rank := b.Rank(sorted[i]); rank != uint64(i+1) {
+				t.Fatalf("Rank(%#x) = %d, want %d", sorted[i], rank, i+1)
+			}
+			// Between values, and at the top of a container's range
+			for _, v := range []uint64{sorted[i] + 1, sorted[i] | 0xffff} {
+				want, _ := slices.BinarySearch(sorted, v+1)
+				if rank := b.Rank(v); rank != uint64(want) {
+					t.Fatalf("Rank(%#x) = %d, want %d", v, rank, want)
+				}
+			}
+		}
+		if _, ok := b.Select(uint64(len(sorted))); ok {
+			t.Error("Select past the end succeeded")
+		}
+		if b.Rank(0) != 0 && sorted[0] != 0 {
+			t.Error("Rank(0) of a bitmap without 0 is not 0")
+		}
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 3))
+	va, vb := randomValues(r, 15000), randomValues(r, 15000)
+	// Keep some containers on one side only
+	va = append(va, 1<<45, 1<<45|5)
+	vb = append(vb, 1<<46)
+	for _, optimize := range []bool{false, true} {
+		a, b := Of(va...), Of(vb...)
+		if optimize {
+			a.RunOptimize()
+		}
+		inA, inB := make(map[uint64]bool), make(map[uint64]bool)
+		for _, v := range va {
+			inA[v] = true
+		}
+		for _, v := range vb {
+			inB[v] = true
+		}
+		and, or, andNot := make(map[uint64]bool), make(map[uint64]bool), make(map[uint64]bool)
+		for v := range inA {
+			or[v] = true
+			if inB[v] {
+				and[v] = true
+			} else {
+				andNot[v] = true
+			}
+		}
+		for v := range inB {
+			or[v] = true
+		}
+		check(t, a.And(b), and)
+		check(t, b.And(a), and)
+		check(t, a.Or(b), or)
+		check(t, a.AndNot(b), andNot)
+
+		// The results share nothing with their operands
+		c := a.Or(b)
+		for v := range inA {
+			c.Remove(v)
+		}
+		check(t, a, inA)
+		check(t, b, inB)
+	}
+}
+
+func TestRunOptimize(t *testing.T) {
+	b := New()
+	for v := range uint64(50000) {
+		b.Set(v + 10) // a bitmap container of one run
+	}
+	for v := range uint64(100) {
+		b.Set(1<<16 | v*3) // an array no run shortens
+	}
+	for v := range uint64(3000) {
+		b.Set(2<<16 | v) // an array of one run
+	}
+	want := make(map[uint64]bool)
+	for v := range b.All() {
+		want[v] = true
+	}
+	b.RunOptimize()
+	kinds := []string{"*bitmap.runContainer", "*bitmap.arrayContainer", "*bitmap.runContainer"}
+	for i, c := range b.containers {
+		if got := typeName(c); got != kinds[i] {
+			t.Errorf("container %d optimized to %s, want %s", i, got, kinds[i])
+		}
+	}
+	check(t, b, want)
+
+	// Changing a run container turns it back, and optimizing again undoes
+	// runs that no longer pay
+	b.Set(5)
+	b.Remove(20)
+	want[5] = true
+	delete(want, 20)
+	if typeName(b.containers[0]) != "*bitmap.bitmapContainer" {
+		t.Errorf("modified run container became %s", typeName(b.containers[0]))
+	}
+	check(t, b, want)
+	for v := uint64(2 << 16); v < 2<<16+3000; v += 2 {
+		b.Remove(v)
+		delete(want, v)
+	}
+	b.RunOptimize()
+	if typeName(b.containers[2]) != "*bitmap.arrayContainer" {
+		t.Errorf("alternate values optimized to %s", typeName(b.containers[2]))
+	}
+	check(t, b, want)
+}
+
+func typeName(c container) string {
+	switch c.(type) {
+	case *arrayContainer:
+		return "*bitmap.arrayContainer"
+	case *bitmapContainer:
+		return "*bitmap.bitmapContainer"
+	case *runContainer:
+		return "*bitmap.runContainer"
+	}
+	return "?"
+}
+
+func TestSaveLoad(t *testing.T) {
+	r := rand.New(rand.NewPCG(4, 4))
+	b := Of(randomValues(r, 10000)...)
+	b.RunOptimize()
+	b.Set(3<<16 | 1) // keep a bitmap container too
+	want := make(map[uint64]bool)
+	for v := range b.All() {
+		want[v] = true
+	}
+	var buf bytes.Buffer
+	if err := b.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	saved := slices.Clone(buf.Bytes())
+	buf.WriteString("trailer")
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, loaded, want)
+	for i, c := range loaded.containers {
+		if typeName(c) != typeName(b.containers[i]) {
+			t.Errorf("container %d loaded as %s, saved as %s", i, typeName(c), typeName(b.containers[i]))
+		}
+	}
+	if rest, _ := io.ReadAll(&buf); string(rest) != "trailer" {
+		t.Errorf("bytes after the bitmap = %q, want %q", rest, "trailer")
+	}
+
+	empty := New()
+	buf.Reset()
+	if err := empty.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := Load(&buf); err != nil || loaded.Cardinality() != 0 {
+		t.Errorf("empty bitmap loaded as %d values, %v", loaded.Cardinality(), err)
+	}
+
+	// Any damage is caught, by the checks or by the checksum
+	for i := 0; i < len(saved); i += 1 + len(saved)/200 {
+		damaged := slices.Clone(saved)
+		damaged[i] ^= 0x10
+		if _, err := Load(bytes.NewReader(damaged)); err == nil {
+			t.Fatalf("loaded a bitmap damaged at byte %d", i)
+		}
+	}
+	for _, n := range []int{0, 7, len(saved) / 2, len(saved) - 1} {
+		if _, err := Load(bytes.NewReader(saved[:n])); err == nil {
+			t.Errorf("loaded a bitmap cut to %d of %d bytes", n, len(saved))
+		}
+	}
+}
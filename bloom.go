@@ -0,0 +1,231 @@
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// bloomMagic starts every saved Bloom filter.
+const bloomMagic = 0x424C4D31 // "BLM1"
+
+// ErrIncompatible is returned when combining filters of different sizes or
+// numbers of hash functions.
+var ErrIncompatible = errors.New("bloom filters differ in size or hash count")
+
+// Bloom is a Bloom filter: a bit array of m bits and k hash functions.
+// Add sets the k bits of a key and MayContain checks them, so MayContain
+// is never false for an added key and true for others at about the rate
+// the filter was sized for. Keys cannot be removed. The k positions come
+// from two 64-bit hashes of the key, h1 + i*h2, which is as good as k
+// independent hashes. Hashing is fixed, not seeded, so saved filters can
+// be loaded by another process. Safe for concurrent use: bits are set
+// with atomic ORs.
+type Bloom struct {
+	words []atomic.Uint64
+	m     uint64
+	k     uint32
+}
+
+// NewBloom returns a filter sized for n keys at false-positive rate
+// fpRate, with the optimal m = -n ln(p) / ln(2)^2 bits and
+// k = m/n ln(2) hash functions.
+func NewBloom(n uint64, fpRate float64) *Bloom {
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	nf := float64(max(n, 1))
+	m := uint64(math.Ceil(-nf * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Round(float64(m) / nf * math.Ln2))
+	return New(m, max(k, 1))
+}
+
+// New returns a filter of m bits and k hash functions.
+func New(m uint64, k uint32) *Bloom {
+	m = max(m, 1)
+	return &Bloom{
+		words: make([]atomic.Uint64, (m+63)/64),
+		m:     m,
+		k:     max(k, 1),
+	}
+}
+
+// M returns the number of bits.
+func (b *Bloom) M() uint64 { return b.m }
+
+// K returns the number of hash functions.
+func (b *Bloom) K() uint32 { return b.k }
+
+func hashes(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	h1 := mix64(h.Sum64())
+	// Odd, so the k positions differ whenever m is a power of two
+	h2 := mix64(h1) | 1
+	return h1, h2
+}
+
+func mix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
+func (b *Bloom) Add(key []byte) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (h1 + i*h2) % b.m
+		b.words[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// MayContain reports whether key may have been added.
+func (b *Bloom) MayContain(key []byte) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.words[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// AddUint64 adds a uint64 key, such as a B+Tree key, as its 8 big-endian
+// bytes.
+func (b *Bloom) AddUint64(key uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], key)
+	b.Add(buf[:])
+}
+
+func (b *Bloom) MayContainUint64(key uint64) bool {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], key)
+	return b.MayContain(buf[:])
+}
+
+// Union adds every key of o to b, so b then answers for the keys of both.
+// The filters must have the same m and k.
+func (b *Bloom) Union(o *Bloom) error {
+	if b.m != o.m || b.k != o.k {
+		return ErrIncompatible
+	}
+	for i := range b.words {
+		b.words[i].Or(o.words[i].Load())
+	}
+	return nil
+}
+
+// Intersection keeps in b only the bits also set in o. It answers for every
+// key added to both, with a false-positive rate no better than that of b
+// before. The filters must have the same m and k.
+func (b *Bloom) Intersection(o *Bloom) error {
+	if b.m != o.m || b.k != o.k {
+		return ErrIncompatible
+	}
+	for i := range b.words {
+		b.words[i].And(o.words[i].Load())
+	}
+	return nil
+}
+
+// Count estimates how many distinct keys have been added, from the
+// fraction of bits set.
+func (b *Bloom) Count() uint64 {
+	var set int
+	for i := range b.words {
+		set += bits.OnesCount64(b.words[i].Load())
+	}
+	if uint64(set) >= b.m {
+		return math.MaxUint64
+	}
+	m := float64(b.m)
+	return uint64(math.Round(-m / float64(b.k) * math.Log(1-float64(set)/m)))
+}
+
+// Save writes the filter to w, for Load. The format, all integers
+// big-endian:
+//
+//	magic(4) m(8) k(4) words(8) each ... crc(4)
+//
+// the CRC-32 (IEEE) covering everything before it.
+func (b *Bloom) Save(w io.Writer) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	var buf [8]byte
+	binary.BigEndian.PutUint32(buf[:4], bloomMagic)
+	bw.Write(buf[:4])
+	binary.BigEndian.PutUint64(buf[:], b.m)
+	bw.Write(buf[:])
+	binary.BigEndian.PutUint32(buf[:4], b.k)
+	bw.Write(buf[:4])
+	for i := range b.words {
+		binary.BigEndian.PutUint64(buf[:], b.words[i].Load())
+		bw.Write(buf[:])
+	}
+	// bufio keeps the first write error and returns it here
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc.Sum32())
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// Load reads a filter written by Save. It reads r directly, no further
+// than the filter's end, so a filter can be embedded in a larger stream.
+func Load(r io.Reader) (*Bloom, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(hdr[:4]) != bloomMagic {
+		return nil, errors.New("not a saved bloom filter")
+	}
+	m := binary.BigEndian.Uint64(hdr[4:])
+	k := binary.BigEndian.Uint32(hdr[12:])
+	if m == 0 || m > 1<<40 || k == 0 || k > 64 {
+		return nil, fmt.Errorf("corrupt bloom filter: m %d, k %d", m, k)
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[:])
+
+	// The bit array is read a chunk at a time and grows only as its words
+	// arrive, so a corrupt or hostile header claiming a huge m fails at
+	// the end of the input rather than with an allocation of that size
+	n := (m + 63) / 64
+	var words []uint64
+	chunk := make([]byte, 8*min(n, 8192))
+	for uint64(len(words)) < n {
+		buf := chunk[:8*min(n-uint64(len(words)), uint64(len(chunk)/8))]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		crc.Write(buf)
+		for ; len(buf) > 0; buf = buf[8:] {
+			words = append(words, binary.BigEndian.Uint64(buf))
+		}
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(sum[:]) != crc.Sum32() {
+		return nil, errors.New("corrupt bloom filter: checksum mismatch")
+	}
+
+	b := New(m, k)
+	for i, w := range words {
+		b.words[i].Store(w)
+	}
+	return b, nil
+}
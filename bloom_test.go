@@ -0,0 +1,76 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestLoadLeavesTheRestOfTheStream(t *testing.T) {
+	b := NewBloom(1000, 0.01)
+	for i := range uint64(1000) {
+		b.AddUint64(i)
+	}
+	var buf bytes.Buffer
+	if err := b.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("trailer")
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range uint64(1000) {
+		if !loaded.MayContainUint64(i) {
+			t.Fatalf("loaded filter lost key %d", i)
+		}
+	}
+	if rest, _ := io.ReadAll(&buf); string(rest) != "trailer" {
+		t.Errorf("bytes after the filter = %q, want %q", rest, "trailer")
+	}
+}
+
+func TestLoadChecksum(t *testing.T) {
+	b := New(1<<16, 3)
+	b.Add([]byte("key"))
+	var buf bytes.Buffer
+	if err := b.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	data[100] ^= 1
+	if _, err := Load(bytes.NewReader(data)); err == nil {
+		t.Error("loaded a corrupt filter")
+	}
+	if _, err := Load(bytes.NewReader(data[:50])); err == nil {
+		t.Error("loaded a truncated filter")
+	}
+}
+
+func TestLoadOversizedHeader(t *testing.T) {
+	// A header claiming the largest m allowed, with little or nothing
+	// after it, fails without allocating the bit array it claims
+	hdr := make([]byte, 16)
+	binary.BigEndian.PutUint32(hdr, bloomMagic)
+	binary.BigEndian.PutUint64(hdr[4:], 1<<40)
+	binary.BigEndian.PutUint32(hdr[12:], 7)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for _, data := range [][]byte{hdr, append(hdr, make([]byte, 1000)...)} {
+		if _, err := Load(bytes.NewReader(data)); err == nil {
+			t.Errorf("loaded a filter of 2^40 bits from %d bytes", len(data))
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("loading a 16-byte header allocated %d bytes", n)
+	}
+
+	binary.BigEndian.PutUint64(hdr[4:], 1<<40+1)
+	if _, err := Load(bytes.NewReader(hdr)); err == nil {
+		t.Error("loaded a filter of more than 2^40 bits")
+	}
+}
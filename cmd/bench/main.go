@@ -0,0 +1,247 @@
+// Command bench runs YCSB-style workloads against the B+Tree, the
+// split-ordered hash and the extensible hash from concurrent clients, and
+// reports the throughput and latency percentiles of each operation as CSV
+// or JSON.
+//
+// Each run loads -records records into a fresh structure, then -clients
+// goroutines share -ops operations drawn from the workload's mix:
+//
+//	A  read heavy: 95% reads, 5% updates
+//	B  update heavy: 50% reads, 50% updates
+//	C  read only: 100% reads
+//	E  scan heavy: 95% scans of 1 to 100 keys, 5% inserts of new keys
+//
+// Reads, updates and scan starts choose a loaded record uniformly or by a
+// zipfian distribution. The hashes have no key order, so workload E runs
+// against the tree only. The tree is not safe for concurrent writes, so
+// its writers hold a lock that its readers share; its numbers include that
+// lock, as any concurrent use of it would.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tdigest"
+)
+
+// Result is one row of the report: one operation of one run, or "all" of
+// them. Latencies are in microseconds.
+type Result struct {
+	Store        string  `json:"store"`
+	Workload     string  `json:"workload"`
+	Distribution string  `json:"distribution"`
+	Clients      int     `json:"clients"`
+	Op           string  `json:"op"`
+	Count        int     `json:"count"`
+	Throughput   float64 `json:"ops_per_sec"`
+	P50          float64 `json:"p50_us"`
+	P95          float64 `json:"p95_us"`
+	P99          float64 `json:"p99_us"`
+	P999         float64 `json:"p999_us"`
+	Max          float64 `json:"max_us"`
+}
+
+type config struct {
+	records, ops, frames int
+	dist                 string
+	seed                 uint64
+}
+
+func main() {
+	stores := flag.String("stores", strings.Join(storeNames, ","), "structures to run against")
+	wl := flag.String("workloads", "A,B,E", "workloads to run: A (read heavy), B (update heavy), C (read only) or E (scan heavy)")
+	clients := flag.String("clients", "1,4", "numbers of client goroutines to run each workload with")
+	format := flag.String("format", "csv", "output format, csv or json")
+	var cfg config
+	flag.IntVar(&cfg.records, "records", 100000, "records to load before each run")
+	flag.IntVar(&cfg.ops, "ops", 1000000, "operations per run, shared among the clients")
+	flag.IntVar(&cfg.frames, "frames", 8192, "buffer pool size of the tree")
+	flag.StringVar(&cfg.dist, "dist", "zipfian", "key distribution, zipfian or uniform")
+	flag.Uint64Var(&cfg.seed, "seed", 1, "random seed")
+	flag.Parse()
+
+	ws, err := parseWorkloads(*wl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var ns []int
+	for _, s := range strings.Split(*clients, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 {
+			log.Fatalf("bad client count %q", s)
+		}
+		ns = append(ns, n)
+	}
+	if cfg.records < 1 || cfg.ops < 1 {
+		log.Fatal("-records and -ops must be positive")
+	}
+	if *format != "csv" && *format != "json" {
+		log.Fatalf("unknown format %q, want csv or json", *format)
+	}
+	choose, err := newChooser(cfg.dist, uint64(cfg.records))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var results []Result
+	for _, name := range strings.Split(*stores, ",") {
+		for _, w := range ws {
+			for _, n := range ns {
+				rs, err := run(name, w, n, choose, cfg)
+				if err == errNoScan {
+					log.Printf("skipping workload %s on %s: %v", w.name, name, err)
+					break
+				}
+				if err != nil {
+					log.Fatalf("%s, workload %s, %d clients: %v", name, w.name, n, err)
+				}
+				results = append(results, rs...)
+			}
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	} else {
+		err = writeCSV(os.Stdout, results)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// client is what one goroutine measured.
+type client struct {
+	latency [numOps]*tdigest.TDigest
+	max     [numOps]time.Duration
+	err     error
+}
+
+func (c *client) record(o op, d time.Duration) {
+	if c.latency[o] == nil {
+		c.latency[o] = tdigest.New(tdigest.DefaultCompression)
+	}
+	c.latency[o].Add(float64(d) / float64(time.Microsecond))
+	c.max[o] = max(c.max[o], d)
+}
+
+// run loads a fresh store and runs w against it from n clients.
+func run(name string, w workload, n int, choose chooser, cfg config) ([]Result, error) {
+	s, err := newStore(name, cfg.frames)
+	if err != nil {
+		return nil, err
+	}
+	if w.mix[opScan] > 0 && name != "btree" {
+		return nil, errNoScan
+	}
+	r := rand.New(rand.NewPCG(cfg.seed, 0))
+	for i := range uint64(cfg.records) {
+		if err := s.insert(keyOf(i), r.Uint64()); err != nil {
+			return nil, fmt.Errorf("load: %w", err)
+		}
+	}
+
+	// Inserts take new records from the end on
+	next := atomic.Uint64{}
+	next.Store(uint64(cfg.records))
+	clients := make([]client, n)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range clients {
+		ops := cfg.ops / n
+		if i < cfg.ops%n {
+			ops++
+		}
+		wg.Add(1)
+		go func(c *client, r *rand.Rand) {
+			defer wg.Done()
+			for range ops {
+				o := w.pick(r)
+				t := time.Now()
+				switch o {
+				case opRead:
+					c.err = s.read(keyOf(choose.next(r)))
+				case opUpdate:
+					c.err = s.update(keyOf(choose.next(r)), r.Uint64())
+				case opInsert:
+					c.err = s.insert(keyOf(next.Add(1)-1), r.Uint64())
+				case opScan:
+					c.err = s.scan(keyOf(choose.next(r)), 1+r.IntN(maxScanLength))
+				}
+				if c.err != nil {
+					return
+				}
+				c.record(o, time.Since(t))
+			}
+		}(&clients[i], rand.New(rand.NewPCG(cfg.seed, uint64(i)+1)))
+	}
+	wg.Wait()
+	elapsed := time.Since(start).Seconds()
+
+	var results []Result
+	all := tdigest.New(tdigest.DefaultCompression)
+	var allMax time.Duration
+	row := func(o string, d *tdigest.TDigest, m time.Duration) {
+		results = append(results, Result{
+			Store:        name,
+			Workload:     w.name,
+			Distribution: cfg.dist,
+			Clients:      n,
+			Op:           o,
+			Count:        int(d.Count()),
+			Throughput:   d.Count() / elapsed,
+			P50:          d.Quantile(0.5),
+			P95:          d.Quantile(0.95),
+			P99:          d.Quantile(0.99),
+			P999:         d.Quantile(0.999),
+			Max:          float64(m) / float64(time.Microsecond),
+		})
+	}
+	for o := range numOps {
+		d := tdigest.New(tdigest.DefaultCompression)
+		var m time.Duration
+		for _, c := range clients {
+			if c.err != nil {
+				return nil, c.err
+			}
+			if c.latency[o] != nil {
+				d.Merge(c.latency[o])
+				m = max(m, c.max[o])
+			}
+		}
+		if d.Count() > 0 {
+			row(o.String(), d, m)
+			all.Merge(d)
+			allMax = max(allMax, m)
+		}
+	}
+	row("all", all, allMax)
+	return results, nil
+}
+
+func writeCSV(out io.Writer, results []Result) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"store", "workload", "distribution", "clients", "op", "count",
+		"ops_per_sec", "p50_us", "p95_us", "p99_us", "p999_us", "max_us"})
+	f := func(x float64) string { return strconv.FormatFloat(x, 'f', 2, 64) }
+	for _, r := range results {
+		w.Write([]string{r.Store, r.Workload, r.Distribution, strconv.Itoa(r.Clients), r.Op,
+			strconv.Itoa(r.Count), f(r.Throughput), f(r.P50), f(r.P95), f(r.P99), f(r.P999), f(r.Max)})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestParseWorkloads(t *testing.T) {
+	ws, err := parseWorkloads("a, B,e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, w := range ws {
+		names = append(names, w.name)
+	}
+	if got := strings.Join(names, ","); got != "A,B,E" {
+		t.Errorf("parseWorkloads = %s, want A,B,E", got)
+	}
+	for _, s := range []string{"D", "A,,B", ""} {
+		if _, err := parseWorkloads(s); err == nil {
+			t.Errorf("parseWorkloads(%q) succeeded", s)
+		}
+	}
+	for name, w := range workloads {
+		sum := 0
+		for _, pct := range w.mix {
+			sum += pct
+		}
+		if sum != 100 || w.name != name {
+			t.Errorf("workload %s: named %s, mix adds up to %d%%", name, w.name, sum)
+		}
+	}
+	// A is the read-heavy mix and B the update-heavy one
+	if a, b := workloads["A"].mix, workloads["B"].mix; a[opRead] <= 90 || b[opUpdate] < 50 {
+		t.Errorf("A reads %d%%, B updates %d%%, want A read heavy and B update heavy", a[opRead], b[opUpdate])
+	}
+}
+
+func TestPick(t *testing.T) {
+	const n = 100000
+	r := rand.New(rand.NewPCG(1, 2))
+	for _, w := range workloads {
+		var counts [numOps]int
+		for range n {
+			counts[w.pick(r)]++
+		}
+		for o, pct := range w.mix {
+			if got := float64(counts[o]) / n * 100; math.Abs(got-float64(pct)) > 0.5 {
+				t.Errorf("workload %s: %.2f%% %v, want %d%%", w.name, got, op(o), pct)
+			}
+		}
+	}
+}
+
+func TestChoosers(t *testing.T) {
+	const records, n = 1000, 200000
+	r := rand.New(rand.NewPCG(3, 4))
+	for _, dist := range []string{"uniform", "zipfian"} {
+		c, err := newChooser(dist, records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := make([]int, records)
+		for range n {
+			i := c.next(r)
+			if i >= records {
+				t.Fatalf("%s: drew %d of %d records", dist, i, records)
+			}
+			counts[i]++
+		}
+		if dist == "uniform" {
+			for i, k := range counts {
+				if k < n/records/2 || k > n/records*2 {
+					t.Errorf("uniform: record %d drawn %d times of %d", i, k, n)
+				}
+			}
+			continue
+		}
+		// Rank i is drawn in proportion to 1/(i+1)^theta
+		for _, i := range []int{1, 2, 9, 99} {
+			want := math.Pow(float64(i+1), zipfianTheta)
+			if got := float64(counts[0]) / float64(counts[i]); math.Abs(got-want) > want/5 {
+				t.Errorf("zipfian: rank 0 drawn %.2f times as often as rank %d, want %.2f", got, i, want)
+			}
+		}
+	}
+	if _, err := newChooser("normal", records); err == nil {
+		t.Error("newChooser of an unknown distribution succeeded")
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	seen := make(map[uint64]bool)
+	sorted := 0
+	for i := range uint64(100000) {
+		k := keyOf(i)
+		if seen[k] {
+			t.Fatalf("keyOf(%d) = %#x, the key of an earlier record", i, k)
+		}
+		seen[k] = true
+		if i > 0 && k > keyOf(i-1) {
+			sorted++
+		}
+	}
+	// Spread keys go up about half the time
+	if sorted < 45000 || sorted > 55000 {
+		t.Errorf("%d of 100000 keys above their predecessor's", sorted)
+	}
+}
+
+func TestStores(t *testing.T) {
+	for _, name := range storeNames {
+		s, err := newStore(name, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range uint64(1000) {
+			if err := s.insert(keyOf(k), k); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		for k := range uint64(1000) {
+			if err := s.update(keyOf(k), k+1); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if err := s.read(keyOf(k)); err != nil {
+				t.Fatalf("%s: read of a loaded key: %v", name, err)
+			}
+		}
+		if err := s.read(keyOf(1000)); err == nil {
+			t.Errorf("%s: read of a missing key succeeded", name)
+		}
+		err = s.scan(keyOf(5), 10)
+		if name == "btree" && err != nil || name != "btree" && err != errNoScan {
+			t.Errorf("%s: scan = %v", name, err)
+		}
+	}
+	if _, err := newStore("lsm", 64); err == nil {
+		t.Error("newStore of an unknown store succeeded")
+	}
+}
+
+func TestRun(t *testing.T) {
+	cfg := config{records: 2000, ops: 5000, frames: 64, dist: "zipfian", seed: 1}
+	choose, _ := newChooser(cfg.dist, uint64(cfg.records))
+	var results []Result
+	for _, name := range storeNames {
+		for _, w := range workloads {
+			rs, err := run(name, w, 3, choose, cfg)
+			if w.mix[opScan] > 0 && name != "btree" {
+				if !errors.Is(err, errNoScan) {
+					t.Errorf("%s, workload %s: %v, want errNoScan", name, w.name, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s, workload %s: %v", name, w.name, err)
+			}
+			// A row per operation in the mix, then all of them
+			want := 0
+			for _, pct := range w.mix {
+				if pct > 0 {
+					want++
+				}
+			}
+			if len(rs) != want+1 || rs[len(rs)-1].Op != "all" {
+				t.Fatalf("%s, workload %s: %d rows, want %d and all", name, w.name, len(rs), want)
+			}
+			count := 0
+			for _, r := range rs[:len(rs)-1] {
+				count += r.Count
+			}
+			all := rs[len(rs)-1]
+			if count != cfg.ops || all.Count != cfg.ops || all.Clients != 3 || all.Store != name ||
+				all.Throughput <= 0 || all.P50 > all.P99 || all.P99 > all.Max {
+				t.Errorf("%s, workload %s: %d ops in rows, all %+v", name, w.name, count, all)
+			}
+			results = append(results, rs...)
+		}
+	}
+
+	var b strings.Builder
+	if err := writeCSV(&b, results); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(results)+1 || rows[0][0] != "store" || rows[1][0] != results[0].Store || len(rows[1]) != 12 {
+		t.Errorf("CSV of %d results: %d rows, starting %q", len(results), len(rows), rows[:2])
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"btree"
+	"manager"
+	"splitordered"
+)
+
+// store is a structure under test. Implementations must be safe for
+// concurrent use. Workloads never delete, so a read, which is always of a
+// loaded key, that finds nothing is an error.
+type store interface {
+	read(key uint64) error
+	update(key, value uint64) error
+	insert(key, value uint64) error
+	// scan reads up to n keys from start on, or returns errNoScan.
+	scan(start uint64, n int) error
+}
+
+var (
+	errMissing = errors.New("loaded key not found")
+	errNoScan  = errors.New("scans not supported")
+)
+
+var storeNames = []string{"btree", "splitordered", "extensible"}
+
+func newStore(name string, frames int) (store, error) {
+	switch name {
+	case "btree":
+		bm := manager.NewBufferManager()
+		if err := bm.Resize(frames); err != nil {
+			return nil, err
+		}
+		return &treeStore{tree: btree.NewBTree(bm)}, nil
+	case "splitordered":
+		return hashStore{splitordered.NewSplitOrderedHash()}, nil
+	case "extensible":
+		return setStore{splitordered.NewExtensibleHash()}, nil
+	}
+	return nil, fmt.Errorf("unknown store %q, want one of %s", name, strings.Join(storeNames, ", "))
+}
+
+// treeStore serializes writers with a lock, as BTree is not safe for
+// concurrent writes; readers share it.
+type treeStore struct {
+	mu   sync.RWMutex
+	tree *btree.BTree
+}
+
+func (s *treeStore) read(key uint64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, err := s.tree.Get(key)
+	return err
+}
+
+func (s *treeStore) update(key, value uint64) error {
+	return s.insert(key, value)
+}
+
+func (s *treeStore) insert(key, value uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tree.Insert(key, value)
+}
+
+func (s *treeStore) scan(start uint64, n int) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cursor := s.tree.Cursor()
+	for range cursor.Range(start, math.MaxUint64) {
+		if n--; n == 0 {
+			break
+		}
+	}
+	return cursor.Err()
+}
+
+type hashStore struct {
+	h *splitordered.SplitOrderedHash
+}
+
+func (s hashStore) read(key uint64) error {
+	if _, ok := s.h.Get(key); !ok {
+		return errMissing
+	}
+	return nil
+}
+
+func (s hashStore) update(key, value uint64) error {
+	s.h.Put(key, value)
+	return nil
+}
+
+func (s hashStore) insert(key, value uint64) error {
+	s.h.Put(key, value)
+	return nil
+}
+
+func (hashStore) scan(uint64, int) error {
+	return errNoScan
+}
+
+// setStore holds keys only, so an update inserts the key again, which
+// takes the write path without changing anything.
+type setStore struct {
+	h *splitordered.ExtensibleHash
+}
+
+func (s setStore) read(key uint64) error {
+	if !s.h.Find(key) {
+		return errMissing
+	}
+	return nil
+}
+
+func (s setStore) update(key, _ uint64) error {
+	s.h.Insert(key)
+	return nil
+}
+
+func (s setStore) insert(key, _ uint64) error {
+	s.h.Insert(key)
+	return nil
+}
+
+func (setStore) scan(uint64, int) error {
+	return errNoScan
+}
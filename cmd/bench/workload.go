@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+)
+
+// op is a kind of operation a workload issues.
+type op int
+
+const (
+	opRead op = iota
+	opUpdate
+	opInsert
+	opScan
+	numOps
+)
+
+func (o op) String() string {
+	return [...]string{"read", "update", "insert", "scan"}[o]
+}
+
+// workload is a mix of operations, in percent.
+type workload struct {
+	name string
+	mix  [numOps]int
+}
+
+var workloads = map[string]workload{
+	"A": {name: "A", mix: [numOps]int{opRead: 95, opUpdate: 5}},  // read heavy
+	"B": {name: "B", mix: [numOps]int{opRead: 50, opUpdate: 50}}, // update heavy
+	"C": {name: "C", mix: [numOps]int{opRead: 100}},              // read only
+	"E": {name: "E", mix: [numOps]int{opScan: 95, opInsert: 5}},  // scan heavy
+}
+
+func parseWorkloads(s string) ([]workload, error) {
+	var ws []workload
+	for _, name := range strings.Split(s, ",") {
+		w, ok := workloads[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown workload %q, want A, B, C or E", name)
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+// pick draws an operation by the workload's mix.
+func (w workload) pick(r *rand.Rand) op {
+	n := r.IntN(100)
+	for o, pct := range w.mix {
+		if n < pct {
+			return op(o)
+		}
+		n -= pct
+	}
+	return opRead
+}
+
+// chooser draws the index of a loaded record to operate on.
+type chooser interface {
+	next(r *rand.Rand) uint64
+}
+
+type uniform struct {
+	n uint64
+}
+
+func (u uniform) next(r *rand.Rand) uint64 {
+	return r.Uint64N(u.n)
+}
+
+// zipfian draws ranks 0 to n-1, rank 0 the most often, with the
+// generator of Gray et al., "Quickly generating billion-record synthetic
+// databases", as YCSB does. Records are keyed by mixing their index, so
+// the popular ones are scattered over the key space, as YCSB's scrambled
+// zipfian scatters them.
+type zipfian struct {
+	n                       uint64
+	alpha, zetan, eta, half float64
+}
+
+// zipfianTheta is YCSB's default skew.
+const zipfianTheta = 0.99
+
+func newZipfian(n uint64, theta float64) *zipfian {
+	zeta2, zetan := zeta(2, theta), zeta(n, theta)
+	return &zipfian{
+		n:     n,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta2/zetan),
+		half:  1 + math.Pow(0.5, theta),
+	}
+}
+
+func zeta(n uint64, theta float64) float64 {
+	sum := 0.0
+	for i := uint64(1); i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), theta)
+	}
+	return sum
+}
+
+func (z *zipfian) next(r *rand.Rand) uint64 {
+	u := r.Float64()
+	uz := u * z.zetan
+	switch {
+	case uz < 1:
+		return 0
+	case uz < z.half:
+		return 1
+	}
+	return min(uint64(float64(z.n)*math.Pow(z.eta*u-z.eta+1, z.alpha)), z.n-1)
+}
+
+func newChooser(dist string, n uint64) (chooser, error) {
+	switch dist {
+	case "uniform":
+		return uniform{n}, nil
+	case "zipfian":
+		return newZipfian(n, zipfianTheta), nil
+	}
+	return nil, fmt.Errorf("unknown distribution %q, want uniform or zipfian", dist)
+}
+
+// keyOf is the key of record i: the splitmix64 finalizer, a bijection, so
+// that keys are spread and the tree is not loaded in order.
+func keyOf(i uint64) uint64 {
+	i ^= i >> 30
+	i *= 0xbf58476d1ce4e5b9
+	i ^= i >> 27
+	i *= 0x94d049bb133111eb
+	i ^= i >> 31
+	return i
+}
+
+// maxScanLength bounds the length of a scan, drawn uniformly from 1 up, as
+// YCSB's default does.
+const maxScanLength = 100
@@ -0,0 +1,340 @@
+// Command dbinspect examines a database file, such as one kept by kv.Open,
+// without changing it: it dumps the catalog, decodes pages, reports the
+// shape of each B+Tree and checks what can be checked.
+//
+// Pages carry no checksums of their own, so verify checks their layout
+// and links, and the CRCs of the records in the file's log, if any.
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"btree"
+	"catalog"
+	"heapfile"
+	"loader"
+	"manager"
+)
+
+const usage = `usage: dbinspect db-file command
+commands:
+  meta      the catalog's meta pages and entries
+  page n    decode page number n
+  stats     height, size and fill of each B+Tree, and page types
+  verify    check every tree and heap page, and the log's checksums`
+
+func main() {
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path, cmd, args := flag.Arg(0), flag.Arg(1), flag.Args()[2:]
+
+	bm := manager.NewReadOnlyBufferManager()
+	defer bm.Close()
+	fileID, err := bm.CreateTablespace(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	in := &inspector{bm: bm, fileID: fileID, path: path, out: os.Stdout}
+
+	switch {
+	case cmd == "meta" && len(args) == 0:
+		err = in.meta()
+	case cmd == "page" && len(args) == 1:
+		var n uint64
+		if n, err = strconv.ParseUint(args[0], 10, 48); err == nil {
+			err = in.page(n)
+		}
+	case cmd == "stats" && len(args) == 0:
+		err = in.stats()
+	case cmd == "verify" && len(args) == 0:
+		var problems int
+		if problems, err = in.verify(); err == nil && problems > 0 {
+			bm.Close()
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		bm.Close()
+		log.Fatal(err)
+	}
+}
+
+type inspector struct {
+	bm     *manager.BufferManager
+	fileID manager.FileID
+	path   string
+	out    io.Writer
+}
+
+// pageNo formats a page ID stored in the file as a page number, the form
+// the page command takes.
+func pageNo(id manager.PageID) string {
+	return strconv.FormatUint(id.PageNo(), 10)
+}
+
+func (in *inspector) meta() error {
+	cat, err := catalog.Open(in.bm, in.fileID)
+	if err != nil {
+		return err
+	}
+	pages := cat.Pages()
+	n, err := in.bm.PageCount(in.fileID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(in.out, "file %s: %d pages of %d bytes\n", in.path, n, manager.PageSize)
+	fmt.Fprintf(in.out, "catalog in %d meta pages:", len(pages))
+	for _, id := range pages {
+		fmt.Fprintf(in.out, " %s", pageNo(id))
+	}
+	fmt.Fprintln(in.out)
+	for _, info := range cat.Indexes() {
+		fmt.Fprintf(in.out, "index %q: %v, root %s, key %d, value %d",
+			info.Name, info.Type, pageNo(info.Root), info.Schema.Key, info.Schema.Value)
+		for _, k := range slices.Sorted(maps.Keys(info.Options)) {
+			fmt.Fprintf(in.out, ", %s=%q", k, info.Options[k])
+		}
+		fmt.Fprintln(in.out)
+	}
+	return nil
+}
+
+func (in *inspector) page(n uint64) error {
+	id := manager.MakePageID(in.fileID, n)
+	data, err := in.bm.PinPage(id)
+	if err != nil {
+		return err
+	}
+	defer in.bm.UnpinPage(id, false)
+	return safely(func() error { return decodePage(in.out, n, data) })
+}
+
+func decodePage(w io.Writer, n uint64, data *[manager.PageSize]byte) error {
+	t := manager.GetPageType(data)
+	fmt.Fprintf(w, "page %d: %v, LSN %d\n", n, t, manager.GetPageLSN(data))
+	switch t {
+	case manager.PageTypeLeaf:
+		leaf, err := btree.AsLeafPage(data)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", n, err)
+		}
+		k := leaf.NumKeys()
+		fmt.Fprintf(w, "entries %d of %d, prev %s, next %s\n", k, btree.MaxLeafEntries, pageNo(leaf.Prev()), pageNo(leaf.Next()))
+		for i := range k {
+			fmt.Fprintf(w, "  %5d  key %d  value %d\n", i, leaf.Key(i), leaf.Value(i))
+		}
+	case manager.PageTypeInternal:
+		node, err := btree.AsInternalPage(data)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", n, err)
+		}
+		k := node.NumKeys()
+		fmt.Fprintf(w, "keys %d of %d\n", k, btree.MaxInternalKeys)
+		for i := range k + 1 {
+			fmt.Fprintf(w, "  child %5d  page %s\n", i, pageNo(node.Child(i)))
+			if i < k {
+				fmt.Fprintf(w, "  key   %5d  %d\n", i, node.Key(i))
+			}
+		}
+	case manager.PageTypeHeap:
+		info, err := heapfile.InspectPage(data)
+		fmt.Fprintf(w, "next %s, slots %d, records from %d, %d bytes free\n",
+			pageNo(info.Next), len(info.Slots), info.FreeEnd, info.FreeSpace)
+		for i, s := range info.Slots {
+			switch s.Kind {
+			case "":
+				fmt.Fprintf(w, "  slot %4d  free\n", i)
+			case "record":
+				fmt.Fprintf(w, "  slot %4d  record at %d, %d bytes\n", i, s.Offset, s.Length)
+			default:
+				fmt.Fprintf(w, "  slot %4d  %s at %d, %d bytes, %v\n", i, s.Kind, s.Offset, s.Length, s.Ref)
+			}
+		}
+		return err
+	default:
+		// Trailing zeros are left out of the dump
+		end := len(data)
+		for end > 0 && data[end-1] == 0 {
+			end--
+		}
+		fmt.Fprint(w, hex.Dump(data[:end]))
+		if t == manager.PageTypeMeta && n == 0 {
+			fmt.Fprintf(w, "catalog magic %#x, length %d\n",
+				binary.BigEndian.Uint64(data[manager.PageHeaderSize:]),
+				binary.BigEndian.Uint64(data[manager.PageHeaderSize+8:]))
+		}
+	}
+	return nil
+}
+
+// safely calls fn, turning a panic from decoding a page corrupt in a way
+// the checks miss into an error.
+func safely(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("corrupt page: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// trees returns the B+Tree indexes of the catalog.
+func (in *inspector) trees() ([]catalog.IndexInfo, error) {
+	cat, err := catalog.Open(in.bm, in.fileID)
+	if err != nil {
+		return nil, err
+	}
+	var trees []catalog.IndexInfo
+	for _, info := range cat.Indexes() {
+		if info.Type == catalog.BTreeIndex {
+			trees = append(trees, info)
+		}
+	}
+	return trees, nil
+}
+
+func (in *inspector) stats() error {
+	trees, err := in.trees()
+	if err != nil {
+		return err
+	}
+	for _, info := range trees {
+		var r *loader.VerifyReport
+		err := safely(func() (err error) {
+			r, err = loader.Verify(btree.OpenBTree(in.bm, info.Root))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("index %q: %w", info.Name, err)
+		}
+		fill := 0.0
+		if r.Leaves > 0 {
+			fill = float64(r.Entries) / float64(r.Leaves*btree.MaxLeafEntries)
+		}
+		fmt.Fprintf(in.out, "index %q: height %d, %d internal, %d leaves (%d empty), %d entries, leaves %.1f%% full\n",
+			info.Name, r.Height, r.InternalNodes, r.Leaves, r.EmptyLeaves, r.Entries, 100*fill)
+	}
+
+	types := make(map[manager.PageType]int)
+	err = in.eachPage(func(n uint64, data *[manager.PageSize]byte) {
+		types[manager.GetPageType(data)]++
+	})
+	if err != nil {
+		return err
+	}
+	var parts []string
+	for _, t := range slices.Sorted(maps.Keys(types)) {
+		parts = append(parts, fmt.Sprintf("%v %d", t, types[t]))
+	}
+	fmt.Fprintf(in.out, "pages: %s\n", strings.Join(parts, ", "))
+	return nil
+}
+
+// verify prints each problem it finds and returns how many there were.
+func (in *inspector) verify() (int, error) {
+	problems := 0
+	problem := func(format string, args ...any) {
+		problems++
+		fmt.Fprintf(in.out, format+"\n", args...)
+	}
+
+	trees, err := in.trees()
+	if err != nil {
+		problem("catalog: %v", err)
+	}
+	for _, info := range trees {
+		var r *loader.VerifyReport
+		err := safely(func() (err error) {
+			r, err = loader.Verify(btree.OpenBTree(in.bm, info.Root))
+			return err
+		})
+		if err != nil {
+			problem("index %q: %v", info.Name, err)
+			continue
+		}
+		for _, p := range r.Problems {
+			problem("index %q: %s", info.Name, p)
+		}
+		if more := r.ProblemCount - len(r.Problems); more > 0 {
+			problem("index %q: %d more problems", info.Name, more)
+		}
+	}
+
+	err = in.eachPage(func(n uint64, data *[manager.PageSize]byte) {
+		var err error
+		switch t := manager.GetPageType(data); {
+		case t == manager.PageTypeHeap:
+			_, err = heapfile.InspectPage(data)
+		case t == manager.PageTypeLeaf:
+			_, err = btree.AsLeafPage(data)
+		case t == manager.PageTypeInternal:
+			_, err = btree.AsInternalPage(data)
+		case t.String() == "unknown":
+			err = fmt.Errorf("unknown page type %d", t)
+		}
+		if err != nil {
+			problem("page %d: %v", n, err)
+		}
+	})
+	if err != nil {
+		return problems, err
+	}
+
+	wal, err := os.ReadFile(in.path + ".wal")
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return problems, err
+	default:
+		records := 0
+		err := manager.DecodeWALSegment(wal, func(manager.LogRecord) bool {
+			records++
+			return true
+		})
+		fmt.Fprintf(in.out, "log: %d records with valid checksums\n", records)
+		if err != nil {
+			// A crash mid-append leaves a torn tail, which the next
+			// open cuts off; anything else is corruption
+			problem("log: %v", err)
+		}
+	}
+	if problems == 0 {
+		fmt.Fprintln(in.out, "no problems found")
+	}
+	return problems, nil
+}
+
+// eachPage calls fn with every page of the file in order.
+func (in *inspector) eachPage(fn func(n uint64, data *[manager.PageSize]byte)) error {
+	count, err := in.bm.PageCount(in.fileID)
+	if err != nil {
+		return err
+	}
+	for n := range count {
+		id := manager.MakePageID(in.fileID, n)
+		data, err := in.bm.PinPage(id)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", n, err)
+		}
+		fn(n, data)
+		in.bm.UnpinPage(id, false)
+	}
+	return nil
+}
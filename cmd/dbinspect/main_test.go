@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kv"
+	"manager"
+)
+
+// newDB creates a database of keys 0 to n-1 and a bucket of one key, and
+// closes it.
+func newDB(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range uint64(n) {
+		if err := db.Put(k, []byte(strings.Repeat("v", int(k%50)+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := db.CreateBucket("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(1, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// open returns an inspector of the file that writes into out.
+func open(t *testing.T, path string, out *strings.Builder) *inspector {
+	t.Helper()
+	bm := manager.NewReadOnlyBufferManager()
+	t.Cleanup(func() { bm.Close() })
+	fileID, err := bm.CreateTablespace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &inspector{bm: bm, fileID: fileID, path: path, out: out}
+}
+
+// checkOutput fails unless out holds each of want.
+func checkOutput(t *testing.T, what string, out string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("%s output lacks %q:\n%s", what, w, out)
+		}
+	}
+}
+
+func TestMetaAndStats(t *testing.T) {
+	path := newDB(t, 3000)
+	var out strings.Builder
+	in := open(t, path, &out)
+	if err := in.meta(); err != nil {
+		t.Fatal(err)
+	}
+	checkOutput(t, "meta", out.String(),
+		"50 pages of 4096 bytes\n",
+		"catalog in 1 meta pages: 0\n",
+		`index "kv": btree, root 5, key 0, value 0, heap=`,
+		`index "kv\x00b": btree, root 49`)
+
+	out.Reset()
+	if err := in.stats(); err != nil {
+		t.Fatal(err)
+	}
+	checkOutput(t, "stats", out.String(),
+		`index "kv": height 2, 1 internal, 23 leaves (0 empty), 3000 entries, leaves 51.6% full`+"\n",
+		`index "kv\x00b": height 1, 0 internal, 1 leaves (0 empty), 1 entries`,
+		"pages: leaf 24, internal 1, meta 1, heap 24\n")
+}
+
+func TestPage(t *testing.T) {
+	path := newDB(t, 3000)
+	var out strings.Builder
+	in := open(t, path, &out)
+
+	for _, tc := range []struct {
+		n    uint64
+		want []string
+	}{
+		{0, []string{"page 0: meta, LSN 0\n", "|CATALOG1", "catalog magic 0x434154414c4f4731, length 61\n"}},
+		{1, []string{"page 1: heap, LSN 0\n", "next 3, slots 138", "slot    0  record at 4087, 2 bytes\n"}},
+		{5, []string{"page 5: internal", "keys 22 of 254\n", "  child     0  page 2\n  key       0  126\n"}},
+		{47, []string{"page 47: leaf", "entries 228 of 253, prev 45, next 0\n", "    0  key 2772  value"}},
+	} {
+		out.Reset()
+		if err := in.page(tc.n); err != nil {
+			t.Fatalf("page %d: %v", tc.n, err)
+		}
+		checkOutput(t, "page", out.String(), tc.want...)
+	}
+	if err := in.page(50); err == nil {
+		t.Error("page past the end of the file succeeded")
+	}
+	if s := in.bm.Stats(); s.Pinned != 0 {
+		t.Errorf("%d pages left pinned", s.Pinned)
+	}
+
+	err := safely(func() error { panic("index out of range") })
+	if err == nil || !strings.Contains(err.Error(), "corrupt page: index out of range") {
+		t.Errorf("safely of a panic = %v", err)
+	}
+	want := errors.New("bad")
+	if err := safely(func() error { return want }); err != want {
+		t.Errorf("safely of an error = %v", err)
+	}
+}
+
+// corrupt overwrites the page type of page n in the file.
+func corrupt(t *testing.T, path string, n int64, pageType uint64) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], pageType)
+	if _, err := f.WriteAt(b[:], n*manager.PageSize); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := newDB(t, 3000)
+	var out strings.Builder
+	problems, err := open(t, path, &out).verify()
+	if err != nil || problems != 0 {
+		t.Fatalf("verify of a sound file: %d problems, %v", problems, err)
+	}
+	checkOutput(t, "verify", out.String(), "log: 0 records with valid checksums\n", "no problems found\n")
+
+	// A page of unknown type, the tree's root turned into a leaf, and a
+	// log whose records fail their checksums
+	corrupt(t, path, 1, 0xee)
+	corrupt(t, path, 5, uint64(manager.PageTypeLeaf))
+	if err := os.WriteFile(path+".wal", []byte(strings.Repeat("garbage!", 64)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	problems, err = open(t, path, &out).verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOutput(t, "verify", out.String(), "page 1: unknown page type 238\n", `index "kv": `, "\nlog: corrupt")
+	if problems < 3 || strings.Contains(out.String(), "no problems found") {
+		t.Errorf("verify of a damaged file found %d problems:\n%s", problems, out.String())
+	}
+}
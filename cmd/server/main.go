@@ -0,0 +1,71 @@
+// Command server serves a kv database over gRPC as the KV service of
+// kvrpc.proto, and optionally over HTTP with kvhttp, until interrupted.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"kv"
+	"kvhttp"
+	"kvrpc"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:7070", "address to listen on")
+	httpAddr := flag.String("http", "", "address to serve the HTTP API on, if any")
+	frames := flag.Int("frames", 0, "buffer pool size, 0 for the default")
+	noSync := flag.Bool("nosync", false, "do not flush the log on every write")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server [-addr host:port] [-http host:port] [-frames n] [-nosync] db-file")
+		os.Exit(2)
+	}
+
+	db, err := kv.Open(flag.Arg(0), &kv.Options{Frames: *frames, NoSync: *noSync})
+	if err != nil {
+		log.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+	srv := kvrpc.NewServer(db)
+	var web *http.Server
+	if *httpAddr != "" {
+		web = &http.Server{Addr: *httpAddr, Handler: kvhttp.NewHandler(db)}
+		go func() {
+			if err := web.ListenAndServe(); err != http.ErrServerClosed {
+				log.Print(err)
+				srv.GracefulStop()
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		srv.GracefulStop()
+	}()
+
+	log.Printf("serving %s on %s", flag.Arg(0), lis.Addr())
+	serveErr := srv.Serve(lis)
+	if web != nil {
+		web.Shutdown(context.Background())
+	}
+	if err := db.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if serveErr != nil {
+		log.Fatal(serveErr)
+	}
+}
@@ -0,0 +1,55 @@
+// Command tracereplay runs a page access trace recorded with
+// BufferManager.StartTrace against simulated pools of different sizes and
+// eviction policies.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"manager"
+)
+
+func main() {
+	frames := flag.String("frames", strconv.Itoa(manager.MaxFrames), "comma-separated pool sizes")
+	policies := flag.String("policy", "clock,lru,fifo", "comma-separated eviction policies")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: tracereplay [-frames n,...] [-policy clock,lru,fifo] trace-file")
+		os.Exit(2)
+	}
+
+	fmt.Printf("%-8s %8s %10s %10s %10s %10s %8s %8s\n",
+		"policy", "frames", "pins", "misses", "evictions", "dirty", "stalls", "hitrate")
+	for _, p := range strings.Split(*policies, ",") {
+		policy, err := manager.ParseReplayPolicy(strings.TrimSpace(p))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, f := range strings.Split(*frames, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil {
+				log.Fatalf("bad pool size %q", f)
+			}
+			res, err := replay(flag.Arg(0), n, policy)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%-8s %8d %10d %10d %10d %10d %8d %7.2f%%\n",
+				policy, n, res.Pins, res.Misses, res.Evictions, res.DirtyEvictions, res.Stalls, 100*res.HitRate())
+		}
+	}
+}
+
+func replay(path string, frames int, policy manager.ReplayPolicy) (manager.ReplayResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return manager.ReplayResult{}, err
+	}
+	defer f.Close()
+	return manager.ReplayTrace(f, frames, policy)
+}
@@ -92,34 +92,640 @@ func BenchmarkComparison(b *testing.B) {
 			}
 		})
 	})
+
+	// Benchmark Linear Hash
+	b.Run("LinearHash-100K", func(b *testing.B) {
+		lh := NewLinearHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lh = NewLinearHash()
+				for j := uint64(0); j < numItems; j++ {
+					lh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			lh = NewLinearHash()
+			for j := uint64(0); j < numItems; j++ {
+				lh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					lh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				lh = NewLinearHash()
+				for j := uint64(0); j < numItems; j++ {
+					lh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					lh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Hopscotch Hash
+	b.Run("HopscotchHash-100K", func(b *testing.B) {
+		hh := NewHopscotchHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				hh = NewHopscotchHash()
+				for j := uint64(0); j < numItems; j++ {
+					hh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			hh = NewHopscotchHash()
+			for j := uint64(0); j < numItems; j++ {
+				hh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					hh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				hh = NewHopscotchHash()
+				for j := uint64(0); j < numItems; j++ {
+					hh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					hh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Cuckoo Hash
+	b.Run("CuckooHash-100K", func(b *testing.B) {
+		ch := NewCuckooHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			ch = NewCuckooHash()
+			for j := uint64(0); j < numItems; j++ {
+				ch.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					ch.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					ch.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Robin Hood Map
+	b.Run("RobinHoodMap-100K", func(b *testing.B) {
+		rh := NewRobinHoodMap()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rh = NewRobinHoodMap()
+				for j := uint64(0); j < numItems; j++ {
+					rh.Put(j, j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			rh = NewRobinHoodMap()
+			for j := uint64(0); j < numItems; j++ {
+				rh.Put(j, j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					rh.Get(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				rh = NewRobinHoodMap()
+				for j := uint64(0); j < numItems; j++ {
+					rh.Put(j, j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					rh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Swiss Map
+	b.Run("SwissMap-100K", func(b *testing.B) {
+		sm := NewSwissMap()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sm = NewSwissMap()
+				for j := uint64(0); j < numItems; j++ {
+					sm.Put(j, j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			sm = NewSwissMap()
+			for j := uint64(0); j < numItems; j++ {
+				sm.Put(j, j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					sm.Get(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				sm = NewSwissMap()
+				for j := uint64(0); j < numItems; j++ {
+					sm.Put(j, j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					sm.Delete(j)
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkComparison1M(b *testing.B) {
+	const numItems = 1000000
+
+	// Benchmark Split-Ordered List
+	b.Run("SplitOrdered-1M", func(b *testing.B) {
+		so := NewSplitOrderedHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				so = NewSplitOrderedHash()
+				for j := uint64(0); j < numItems; j++ {
+					so.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			so = NewSplitOrderedHash()
+			for j := uint64(0); j < numItems; j++ {
+				so.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					so.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				so = NewSplitOrderedHash()
+				for j := uint64(0); j < numItems; j++ {
+					so.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					so.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Extensible Hash
+	b.Run("ExtensibleHash-1M", func(b *testing.B) {
+		eh := NewExtensibleHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				eh = NewExtensibleHash()
+				for j := uint64(0); j < numItems; j++ {
+					eh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			eh = NewExtensibleHash()
+			for j := uint64(0); j < numItems; j++ {
+				eh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					eh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				eh = NewExtensibleHash()
+				for j := uint64(0); j < numItems; j++ {
+					eh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					eh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Linear Hash
+	b.Run("LinearHash-1M", func(b *testing.B) {
+		lh := NewLinearHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lh = NewLinearHash()
+				for j := uint64(0); j < numItems; j++ {
+					lh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			lh = NewLinearHash()
+			for j := uint64(0); j < numItems; j++ {
+				lh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					lh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				lh = NewLinearHash()
+				for j := uint64(0); j < numItems; j++ {
+					lh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					lh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Hopscotch Hash
+	b.Run("HopscotchHash-1M", func(b *testing.B) {
+		hh := NewHopscotchHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				hh = NewHopscotchHash()
+				for j := uint64(0); j < numItems; j++ {
+					hh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			hh = NewHopscotchHash()
+			for j := uint64(0); j < numItems; j++ {
+				hh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					hh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				hh = NewHopscotchHash()
+				for j := uint64(0); j < numItems; j++ {
+					hh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					hh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Cuckoo Hash
+	b.Run("CuckooHash-1M", func(b *testing.B) {
+		ch := NewCuckooHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			ch = NewCuckooHash()
+			for j := uint64(0); j < numItems; j++ {
+				ch.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					ch.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					ch.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Robin Hood Map
+	b.Run("RobinHoodMap-1M", func(b *testing.B) {
+		rh := NewRobinHoodMap()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rh = NewRobinHoodMap()
+				for j := uint64(0); j < numItems; j++ {
+					rh.Put(j, j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			rh = NewRobinHoodMap()
+			for j := uint64(0); j < numItems; j++ {
+				rh.Put(j, j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					rh.Get(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				rh = NewRobinHoodMap()
+				for j := uint64(0); j < numItems; j++ {
+					rh.Put(j, j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					rh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Swiss Map
+	b.Run("SwissMap-1M", func(b *testing.B) {
+		sm := NewSwissMap()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sm = NewSwissMap()
+				for j := uint64(0); j < numItems; j++ {
+					sm.Put(j, j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			sm = NewSwissMap()
+			for j := uint64(0); j < numItems; j++ {
+				sm.Put(j, j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					sm.Get(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				sm = NewSwissMap()
+				for j := uint64(0); j < numItems; j++ {
+					sm.Put(j, j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					sm.Delete(j)
+				}
+			}
+		})
+	})
 }
 
-func BenchmarkComparison1M(b *testing.B) {
-	const numItems = 1000000
+func BenchmarkComparison1K(b *testing.B) {
+	const numItems = 1000
+
+	// Benchmark Split-Ordered List
+	b.Run("SplitOrdered-1K", func(b *testing.B) {
+		so := NewSplitOrderedHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				so = NewSplitOrderedHash()
+				for j := uint64(0); j < numItems; j++ {
+					so.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			so = NewSplitOrderedHash()
+			for j := uint64(0); j < numItems; j++ {
+				so.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					so.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				so = NewSplitOrderedHash()
+				for j := uint64(0); j < numItems; j++ {
+					so.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					so.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Extensible Hash
+	b.Run("ExtensibleHash-1K", func(b *testing.B) {
+		eh := NewExtensibleHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				eh = NewExtensibleHash()
+				for j := uint64(0); j < numItems; j++ {
+					eh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			eh = NewExtensibleHash()
+			for j := uint64(0); j < numItems; j++ {
+				eh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					eh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				eh = NewExtensibleHash()
+				for j := uint64(0); j < numItems; j++ {
+					eh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					eh.Delete(j)
+				}
+			}
+		})
+	})
 
-	// Benchmark Split-Ordered List
-	b.Run("SplitOrdered-1M", func(b *testing.B) {
-		so := NewSplitOrderedHash()
+	// Benchmark Linear Hash
+	b.Run("LinearHash-1K", func(b *testing.B) {
+		lh := NewLinearHash()
 		b.Run("Insert", func(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				so = NewSplitOrderedHash()
+				lh = NewLinearHash()
 				for j := uint64(0); j < numItems; j++ {
-					so.Insert(j)
+					lh.Insert(j)
 				}
 			}
 		})
 
 		b.Run("Find", func(b *testing.B) {
 			// Setup
-			so = NewSplitOrderedHash()
+			lh = NewLinearHash()
 			for j := uint64(0); j < numItems; j++ {
-				so.Insert(j)
+				lh.Insert(j)
 			}
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				for j := uint64(0); j < numItems; j++ {
-					so.Find(j)
+					lh.Find(j)
 				}
 			}
 		})
@@ -128,41 +734,41 @@ func BenchmarkComparison1M(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				// Setup
-				so = NewSplitOrderedHash()
+				lh = NewLinearHash()
 				for j := uint64(0); j < numItems; j++ {
-					so.Insert(j)
+					lh.Insert(j)
 				}
 				// Benchmark deletion
 				for j := uint64(0); j < numItems; j++ {
-					so.Delete(j)
+					lh.Delete(j)
 				}
 			}
 		})
 	})
 
-	// Benchmark Extensible Hash
-	b.Run("ExtensibleHash-1M", func(b *testing.B) {
-		eh := NewExtensibleHash()
+	// Benchmark Hopscotch Hash
+	b.Run("HopscotchHash-1K", func(b *testing.B) {
+		hh := NewHopscotchHash()
 		b.Run("Insert", func(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				eh = NewExtensibleHash()
+				hh = NewHopscotchHash()
 				for j := uint64(0); j < numItems; j++ {
-					eh.Insert(j)
+					hh.Insert(j)
 				}
 			}
 		})
 
 		b.Run("Find", func(b *testing.B) {
 			// Setup
-			eh = NewExtensibleHash()
+			hh = NewHopscotchHash()
 			for j := uint64(0); j < numItems; j++ {
-				eh.Insert(j)
+				hh.Insert(j)
 			}
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				for j := uint64(0); j < numItems; j++ {
-					eh.Find(j)
+					hh.Find(j)
 				}
 			}
 		})
@@ -171,45 +777,84 @@ func BenchmarkComparison1M(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				// Setup
-				eh = NewExtensibleHash()
+				hh = NewHopscotchHash()
 				for j := uint64(0); j < numItems; j++ {
-					eh.Insert(j)
+					hh.Insert(j)
 				}
 				// Benchmark deletion
 				for j := uint64(0); j < numItems; j++ {
-					eh.Delete(j)
+					hh.Delete(j)
 				}
 			}
 		})
 	})
-}
 
-func BenchmarkComparison1K(b *testing.B) {
-	const numItems = 1000
+	// Benchmark Cuckoo Hash
+	b.Run("CuckooHash-1K", func(b *testing.B) {
+		ch := NewCuckooHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+			}
+		})
 
-	// Benchmark Split-Ordered List
-	b.Run("SplitOrdered-1K", func(b *testing.B) {
-		so := NewSplitOrderedHash()
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			ch = NewCuckooHash()
+			for j := uint64(0); j < numItems; j++ {
+				ch.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					ch.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					ch.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Robin Hood Map
+	b.Run("RobinHoodMap-1K", func(b *testing.B) {
+		rh := NewRobinHoodMap()
 		b.Run("Insert", func(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				so = NewSplitOrderedHash()
+				rh = NewRobinHoodMap()
 				for j := uint64(0); j < numItems; j++ {
-					so.Insert(j)
+					rh.Put(j, j)
 				}
 			}
 		})
 
 		b.Run("Find", func(b *testing.B) {
 			// Setup
-			so = NewSplitOrderedHash()
+			rh = NewRobinHoodMap()
 			for j := uint64(0); j < numItems; j++ {
-				so.Insert(j)
+				rh.Put(j, j)
 			}
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				for j := uint64(0); j < numItems; j++ {
-					so.Find(j)
+					rh.Get(j)
 				}
 			}
 		})
@@ -218,41 +863,41 @@ func BenchmarkComparison1K(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				// Setup
-				so = NewSplitOrderedHash()
+				rh = NewRobinHoodMap()
 				for j := uint64(0); j < numItems; j++ {
-					so.Insert(j)
+					rh.Put(j, j)
 				}
 				// Benchmark deletion
 				for j := uint64(0); j < numItems; j++ {
-					so.Delete(j)
+					rh.Delete(j)
 				}
 			}
 		})
 	})
 
-	// Benchmark Extensible Hash
-	b.Run("ExtensibleHash-1K", func(b *testing.B) {
-		eh := NewExtensibleHash()
+	// Benchmark Swiss Map
+	b.Run("SwissMap-1K", func(b *testing.B) {
+		sm := NewSwissMap()
 		b.Run("Insert", func(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				eh = NewExtensibleHash()
+				sm = NewSwissMap()
 				for j := uint64(0); j < numItems; j++ {
-					eh.Insert(j)
+					sm.Put(j, j)
 				}
 			}
 		})
 
 		b.Run("Find", func(b *testing.B) {
 			// Setup
-			eh = NewExtensibleHash()
+			sm = NewSwissMap()
 			for j := uint64(0); j < numItems; j++ {
-				eh.Insert(j)
+				sm.Put(j, j)
 			}
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				for j := uint64(0); j < numItems; j++ {
-					eh.Find(j)
+					sm.Get(j)
 				}
 			}
 		})
@@ -261,13 +906,13 @@ func BenchmarkComparison1K(b *testing.B) {
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				// Setup
-				eh = NewExtensibleHash()
+				sm = NewSwissMap()
 				for j := uint64(0); j < numItems; j++ {
-					eh.Insert(j)
+					sm.Put(j, j)
 				}
 				// Benchmark deletion
 				for j := uint64(0); j < numItems; j++ {
-					eh.Delete(j)
+					sm.Delete(j)
 				}
 			}
 		})
@@ -363,4 +1008,219 @@ func BenchmarkComparison100(b *testing.B) {
 			}
 		})
 	})
+
+	// Benchmark Linear Hash
+	b.Run("LinearHash-100", func(b *testing.B) {
+		lh := NewLinearHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lh = NewLinearHash()
+				for j := uint64(0); j < numItems; j++ {
+					lh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			lh = NewLinearHash()
+			for j := uint64(0); j < numItems; j++ {
+				lh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					lh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				lh = NewLinearHash()
+				for j := uint64(0); j < numItems; j++ {
+					lh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					lh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Hopscotch Hash
+	b.Run("HopscotchHash-100", func(b *testing.B) {
+		hh := NewHopscotchHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				hh = NewHopscotchHash()
+				for j := uint64(0); j < numItems; j++ {
+					hh.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			hh = NewHopscotchHash()
+			for j := uint64(0); j < numItems; j++ {
+				hh.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					hh.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				hh = NewHopscotchHash()
+				for j := uint64(0); j < numItems; j++ {
+					hh.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					hh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Cuckoo Hash
+	b.Run("CuckooHash-100", func(b *testing.B) {
+		ch := NewCuckooHash()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			ch = NewCuckooHash()
+			for j := uint64(0); j < numItems; j++ {
+				ch.Insert(j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					ch.Find(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				ch = NewCuckooHash()
+				for j := uint64(0); j < numItems; j++ {
+					ch.Insert(j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					ch.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Robin Hood Map
+	b.Run("RobinHoodMap-100", func(b *testing.B) {
+		rh := NewRobinHoodMap()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rh = NewRobinHoodMap()
+				for j := uint64(0); j < numItems; j++ {
+					rh.Put(j, j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			rh = NewRobinHoodMap()
+			for j := uint64(0); j < numItems; j++ {
+				rh.Put(j, j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					rh.Get(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				rh = NewRobinHoodMap()
+				for j := uint64(0); j < numItems; j++ {
+					rh.Put(j, j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					rh.Delete(j)
+				}
+			}
+		})
+	})
+
+	// Benchmark Swiss Map
+	b.Run("SwissMap-100", func(b *testing.B) {
+		sm := NewSwissMap()
+		b.Run("Insert", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sm = NewSwissMap()
+				for j := uint64(0); j < numItems; j++ {
+					sm.Put(j, j)
+				}
+			}
+		})
+
+		b.Run("Find", func(b *testing.B) {
+			// Setup
+			sm = NewSwissMap()
+			for j := uint64(0); j < numItems; j++ {
+				sm.Put(j, j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := uint64(0); j < numItems; j++ {
+					sm.Get(j)
+				}
+			}
+		})
+
+		b.Run("Delete", func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Setup
+				sm = NewSwissMap()
+				for j := uint64(0); j < numItems; j++ {
+					sm.Put(j, j)
+				}
+				// Benchmark deletion
+				for j := uint64(0); j < numItems; j++ {
+					sm.Delete(j)
+				}
+			}
+		})
+	})
 }
@@ -0,0 +1,159 @@
+package consistenthash
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is the number of virtual nodes per unit of weight.
+const DefaultReplicas = 100
+
+// ErrEmpty is returned when locating a key on a ring with no members.
+var ErrEmpty = errors.New("consistent hash ring has no members")
+
+type point struct {
+	hash   uint64
+	member string
+}
+
+// Ring assigns keys to members, such as the hash tables, trees or
+// processes a data set is sharded across, so that adding or removing a
+// member moves only the keys it gains or loses: about 1/n of them. Each
+// member is hashed to weight*replicas points on a 64-bit ring and a key
+// belongs to the member of the first point at or after its own hash; the
+// many points per member even out the share each gets, in proportion to
+// its weight. Hashing is fixed, not seeded, so every process builds the
+// same ring from the same members. Safe for concurrent use.
+type Ring struct {
+	mu       sync.RWMutex
+	replicas int
+	points   []point // by hash
+	weights  map[string]int
+}
+
+// New returns an empty ring with replicas virtual nodes per unit of
+// weight, or DefaultReplicas if replicas is not positive.
+func New(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &Ring{replicas: replicas, weights: make(map[string]int)}
+}
+
+func mix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
+func hash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return mix64(h.Sum64())
+}
+
+func comparePoints(a, b point) int {
+	if c := cmp.Compare(a.hash, b.hash); c != 0 {
+		return c
+	}
+	// Break the rare tie the same way everywhere
+	return cmp.Compare(a.member, b.member)
+}
+
+// Add adds member with the given weight, or changes its weight if it is
+// already on the ring. A weight of 0 or less removes it.
+func (r *Ring) Add(member string, weight int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.remove(member)
+	if weight <= 0 {
+		return
+	}
+	r.weights[member] = weight
+	for i := 0; i < weight*r.replicas; i++ {
+		h := hash([]byte(member + "#" + strconv.Itoa(i)))
+		r.points = append(r.points, point{h, member})
+	}
+	slices.SortFunc(r.points, comparePoints)
+}
+
+// Remove takes member off the ring; its keys pass to the members after
+// its points.
+func (r *Ring) Remove(member string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remove(member)
+}
+
+func (r *Ring) remove(member string) {
+	if _, ok := r.weights[member]; !ok {
+		return
+	}
+	delete(r.weights, member)
+	r.points = slices.DeleteFunc(r.points, func(p point) bool { return p.member == member })
+}
+
+// Locate returns the member key belongs to.
+func (r *Ring) Locate(key []byte) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return "", ErrEmpty
+	}
+	return r.points[r.search(hash(key))].member, nil
+}
+
+// LocateUint64 locates a uint64 key, such as a SplitOrderedHash or B+Tree
+// key, as its 8 big-endian bytes.
+func (r *Ring) LocateUint64(key uint64) (string, error) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], key)
+	return r.Locate(buf[:])
+}
+
+// LocateN returns up to n distinct members for key, in ring order from
+// the one Locate returns, for placing replicas.
+func (r *Ring) LocateN(key []byte, n int) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return nil, ErrEmpty
+	}
+	n = max(min(n, len(r.weights)), 0)
+	members := make([]string, 0, n)
+	for i := r.search(hash(key)); len(members) < n; i = (i + 1) % len(r.points) {
+		if m := r.points[i].member; !slices.Contains(members, m) {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+// search returns the index of the first point at or after h, wrapping
+// round to the first.
+func (r *Ring) search(h uint64) int {
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	if i == len(r.points) {
+		return 0
+	}
+	return i
+}
+
+// Members returns the members and their weights.
+func (r *Ring) Members() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.weights)
+}
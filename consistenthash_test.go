@@ -0,0 +1,182 @@
+package consistenthash
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"sync"
+	"testing"
+)
+
+// shares returns how many of n keys each member of r gets.
+func shares(t *testing.T, r *Ring, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for k := range uint64(n) {
+		m, err := r.LocateUint64(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[m]++
+	}
+	return counts
+}
+
+func TestBalance(t *testing.T) {
+	r := New(0)
+	weights := map[string]int{"a": 1, "b": 1, "c": 2, "d": 4}
+	for m, w := range weights {
+		r.Add(m, w)
+	}
+	if got := r.Members(); !maps.Equal(got, weights) {
+		t.Errorf("Members = %v, want %v", got, weights)
+	}
+	const n = 80000
+	counts := shares(t, r, n)
+	// Shares in proportion to weight, within 15% at 100 points per unit
+	for m, w := range weights {
+		want := float64(n) * float64(w) / 8
+		if math.Abs(float64(counts[m])-want) > 0.15*want {
+			t.Errorf("member %s of weight %d got %d keys, want about %.0f", m, w, counts[m], want)
+		}
+	}
+}
+
+func TestMinimalMovement(t *testing.T) {
+	r := New(0)
+	for i := range 5 {
+		r.Add(fmt.Sprint("m", i), 1)
+	}
+	const n = 50000
+	before := make([]string, n)
+	for k := range before {
+		before[k], _ = r.LocateUint64(uint64(k))
+	}
+
+	// A new member takes keys only for itself, about 1/6 of them
+	r.Add("m5", 1)
+	moved := 0
+	for k := range before {
+		m, _ := r.LocateUint64(uint64(k))
+		if m != before[k] {
+			moved++
+			if m != "m5" {
+				t.Fatalf("key %d moved from %s to %s, not to the new member", k, before[k], m)
+			}
+		}
+	}
+	if moved < n/10 || moved > n/4 {
+		t.Errorf("%d of %d keys moved to a sixth member", moved, n)
+	}
+
+	// Removing it gives back exactly those keys
+	r.Remove("m5")
+	for k := range before {
+		if m, _ := r.LocateUint64(uint64(k)); m != before[k] {
+			t.Fatalf("key %d on %s after the member left, was on %s", k, m, before[k])
+		}
+	}
+
+	// Removing another moves only its own keys
+	r.Remove("m2")
+	for k := range before {
+		m, _ := r.LocateUint64(uint64(k))
+		if before[k] != "m2" && m != before[k] || m == "m2" {
+			t.Fatalf("key %d moved from %s to %s when m2 left", k, before[k], m)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	// Rings built in any order agree, as processes sharing a layout must
+	a, b := New(50), New(50)
+	for i := range 10 {
+		a.Add(fmt.Sprint("node", i), 1+i%3)
+		b.Add(fmt.Sprint("node", 9-i), 1+(9-i)%3)
+	}
+	for k := range 1000 {
+		key := []byte(fmt.Sprint("key", k))
+		ma, _ := a.Locate(key)
+		mb, _ := b.Locate(key)
+		if ma != mb {
+			t.Fatalf("key %q on %s and %s", key, ma, mb)
+		}
+	}
+}
+
+func TestWeightChanges(t *testing.T) {
+	r := New(10)
+	r.Add("a", 1)
+	r.Add("b", 1)
+	r.Add("a", 3)
+	if w := r.Members()["a"]; w != 3 || len(r.points) != 40 {
+		t.Errorf("after reweighting: weight %d, %d points", w, len(r.points))
+	}
+	r.Add("a", 0)
+	if _, ok := r.Members()["a"]; ok || len(r.points) != 10 {
+		t.Errorf("after weight 0: members %v, %d points", r.Members(), len(r.points))
+	}
+	r.Remove("missing")
+	r.Remove("b")
+	if _, err := r.Locate([]byte("k")); err != ErrEmpty {
+		t.Errorf("Locate on an empty ring: %v", err)
+	}
+	if _, err := r.LocateN([]byte("k"), 2); err != ErrEmpty {
+		t.Errorf("LocateN on an empty ring: %v", err)
+	}
+}
+
+func TestLocateN(t *testing.T) {
+	r := New(0)
+	for _, m := range []string{"a", "b", "c"} {
+		r.Add(m, 1)
+	}
+	for k := range 200 {
+		key := []byte(fmt.Sprint(k))
+		first, _ := r.Locate(key)
+		got, err := r.LocateN(key, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 3 || got[0] != first || got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+			t.Fatalf("LocateN(%q, 5) = %v, Locate %s", key, got, first)
+		}
+		// Replicas follow ring order: without the first, the second leads
+		if two, _ := r.LocateN(key, 2); len(two) != 2 || two[1] != got[1] {
+			t.Fatalf("LocateN(%q, 2) = %v, want a prefix of %v", key, two, got)
+		}
+	}
+	if got, _ := r.LocateN([]byte("k"), 0); len(got) != 0 {
+		t.Errorf("LocateN(k, 0) = %v", got)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	r := New(20)
+	r.Add("base", 1)
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				m := fmt.Sprint("w", w, "-", i%5)
+				r.Add(m, 1+i%2)
+				r.Remove(m)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for k := range 2000 {
+				if _, err := r.LocateUint64(uint64(k)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := r.Members(); len(got) != 1 || got["base"] != 1 {
+		t.Errorf("members after concurrent churn: %v", got)
+	}
+}
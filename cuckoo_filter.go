@@ -0,0 +1,189 @@
+package splitordered
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+)
+
+const (
+	cfWays     = 4
+	cfMaxKicks = 500
+	// Buckets are sized for the capacity at this load; cuckoo filters with
+	// 4-way buckets fill to about 95% before inserts start failing
+	cfTargetLoad = 0.9
+)
+
+// CuckooFilter answers approximate membership queries for uint64 keys, as
+// a cheap check in front of an index that is expensive to probe: Contains
+// is never false for a key inserted and not deleted, and true for other
+// keys at about the configured false-positive rate. It is a cuckoo hash
+// of short fingerprints rather than keys. A key's two buckets are its hash
+// and that XOR the hash of its fingerprint, so an evicted fingerprint can
+// find its other bucket without the key; that is also what makes
+// deletion possible, unlike a Bloom filter. Delete only keys that were
+// inserted, or another key's fingerprint may go.
+type CuckooFilter struct {
+	mu      sync.RWMutex
+	buckets [][cfWays]uint32 // fingerprints; 0 is an empty slot
+	bits    uint
+	// A fingerprint evicted when the filter filled up, kept so no key
+	// already inserted is lost
+	victim      uint32
+	victimIndex uint64
+	count       uint64
+	rng         uint64
+}
+
+// NewCuckooFilter returns a filter for up to capacity keys with a false
+// positive rate of about fpRate. Fingerprints take log2(8/fpRate) bits,
+// rounded up and kept to 4 to 32.
+func NewCuckooFilter(capacity uint64, fpRate float64) *CuckooFilter {
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	// A lookup compares against the 2*cfWays fingerprints of two buckets
+	fpBits := uint(math.Ceil(math.Log2(2 * cfWays / fpRate)))
+	fpBits = min(max(fpBits, 4), 32)
+
+	n := uint64(math.Ceil(float64(max(capacity, 1)) / cfWays / cfTargetLoad))
+	n = 1 << bits.Len64(n-1)
+	return &CuckooFilter{
+		buckets: make([][cfWays]uint32, n),
+		bits:    fpBits,
+		rng:     1,
+	}
+}
+
+// hash returns the first bucket and the fingerprint of key.
+func (cf *CuckooFilter) hash(key uint64) (uint64, uint32) {
+	h := mix64(key)
+	fp := uint32(h>>32) & uint32(1<<cf.bits-1)
+	if fp == 0 {
+		fp = 1
+	}
+	return h & uint64(len(cf.buckets)-1), fp
+}
+
+// alt returns the other bucket of fingerprint fp in bucket i.
+func (cf *CuckooFilter) alt(i uint64, fp uint32) uint64 {
+	return (i ^ mix64(uint64(fp))) & uint64(len(cf.buckets)-1)
+}
+
+func (cf *CuckooFilter) add(i uint64, fp uint32) bool {
+	b := &cf.buckets[i]
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *CuckooFilter) remove(i uint64, fp uint32) bool {
+	b := &cf.buckets[i]
+	for j := range b {
+		if b[j] == fp {
+			b[j] = 0
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *CuckooFilter) has(i uint64, fp uint32) bool {
+	b := &cf.buckets[i]
+	return b[0] == fp || b[1] == fp || b[2] == fp || b[3] == fp
+}
+
+// Insert adds key, and reports false if the filter is too full to.
+// Inserting a key twice adds a second fingerprint, which a Delete each
+// will remove.
+func (cf *CuckooFilter) Insert(key uint64) bool {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if cf.victim != 0 {
+		return false
+	}
+	i, fp := cf.hash(key)
+	cf.insert(i, fp)
+	cf.count++
+	return true
+}
+
+// insert stores fp in bucket i or its other bucket, evicting fingerprints
+// to their other buckets as needed. The fingerprint still homeless after
+// cfMaxKicks becomes the victim.
+func (cf *CuckooFilter) insert(i uint64, fp uint32) {
+	if cf.add(i, fp) || cf.add(cf.alt(i, fp), fp) {
+		return
+	}
+	if cf.rng&1 == 0 {
+		i = cf.alt(i, fp)
+	}
+	for kick := 0; kick < cfMaxKicks; kick++ {
+		// xorshift64
+		cf.rng ^= cf.rng << 13
+		cf.rng ^= cf.rng >> 7
+		cf.rng ^= cf.rng << 17
+		j := cf.rng % cfWays
+		fp, cf.buckets[i][j] = cf.buckets[i][j], fp
+		i = cf.alt(i, fp)
+		if cf.add(i, fp) {
+			return
+		}
+	}
+	cf.victim, cf.victimIndex = fp, i
+}
+
+// Contains reports whether key may have been inserted.
+func (cf *CuckooFilter) Contains(key uint64) bool {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+
+	i, fp := cf.hash(key)
+	i2 := cf.alt(i, fp)
+	if cf.has(i, fp) || cf.has(i2, fp) {
+		return true
+	}
+	return cf.victim == fp && (cf.victimIndex == i || cf.victimIndex == i2)
+}
+
+// Delete removes one fingerprint of key, and reports whether it found
+// one.
+func (cf *CuckooFilter) Delete(key uint64) bool {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	i, fp := cf.hash(key)
+	i2 := cf.alt(i, fp)
+	if !cf.remove(i, fp) && !cf.remove(i2, fp) {
+		if cf.victim != fp || cf.victimIndex != i && cf.victimIndex != i2 {
+			return false
+		}
+		cf.victim = 0
+	}
+	cf.count--
+	// The freed slot may make room for the victim
+	if v := cf.victim; v != 0 {
+		cf.victim = 0
+		cf.insert(cf.victimIndex, v)
+	}
+	return true
+}
+
+// Count returns the number of fingerprints held.
+func (cf *CuckooFilter) Count() uint64 {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	return cf.count
+}
+
+// LoadFactor returns the fraction of slots holding a fingerprint.
+func (cf *CuckooFilter) LoadFactor() float64 {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	return float64(cf.count) / float64(cfWays*len(cf.buckets))
+}
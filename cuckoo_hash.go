@@ -0,0 +1,265 @@
+package splitordered
+
+import (
+	"iter"
+	"sync"
+)
+
+const (
+	cuckooWays       = 4
+	cuckooMinBuckets = 4
+	cuckooMaxKicks   = 500
+	// Keys no displacement could place, kept aside until a resize
+	cuckooStashSize = 4
+	cuckooMaxLoad   = 0.9
+	cuckooMinLoad   = 0.125
+	// Seeds the second table's hash, so the two pick buckets independently
+	cuckooSeed = 0x5851F42D4C957F2D
+)
+
+type cuckooBucket struct {
+	keys [cuckooWays]uint64
+	used [cuckooWays]bool
+}
+
+// CuckooHash is a cuckoo hash table of uint64 keys: two tables of 4-way
+// buckets, each table with its own hash. A key lives in its bucket in one
+// of the two tables or in a small stash, so a lookup reads two buckets and
+// the stash and nothing else, however full the table. An insert that
+// finds both buckets full evicts a key from one, which moves to its bucket
+// in the other table, and so on; a displacement that runs too long leaves
+// its last key in the stash, and a full stash grows the tables.
+type CuckooHash struct {
+	mu      sync.RWMutex
+	tables  [2][]cuckooBucket
+	stash   []uint64
+	rng     uint64 // picks the slot to evict
+	count   uint64
+	resizes uint64
+}
+
+func NewCuckooHash() *CuckooHash {
+	ch := &CuckooHash{rng: 1}
+	ch.allocate(cuckooMinBuckets)
+	return ch
+}
+
+func (ch *CuckooHash) allocate(n int) {
+	ch.tables[0] = make([]cuckooBucket, n)
+	ch.tables[1] = make([]cuckooBucket, n)
+	ch.stash = nil
+}
+
+// bucket returns the bucket of key in table t.
+func (ch *CuckooHash) bucket(t int, key uint64) *cuckooBucket {
+	h := mix64(key)
+	if t == 1 {
+		h = mix64(key ^ cuckooSeed)
+	}
+	table := ch.tables[t]
+	return &table[h&uint64(len(table)-1)]
+}
+
+func (b *cuckooBucket) find(key uint64) int {
+	for i := range b.keys {
+		if b.used[i] && b.keys[i] == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// add stores key in a free slot of b, if it has one.
+func (b *cuckooBucket) add(key uint64) bool {
+	for i := range b.keys {
+		if !b.used[i] {
+			b.keys[i], b.used[i] = key, true
+			return true
+		}
+	}
+	return false
+}
+
+func (ch *CuckooHash) contains(key uint64) bool {
+	if ch.bucket(0, key).find(key) >= 0 || ch.bucket(1, key).find(key) >= 0 {
+		return true
+	}
+	for _, k := range ch.stash {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (ch *CuckooHash) Insert(key uint64) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.contains(key) {
+		return false
+	}
+	if float64(ch.count+1) > cuckooMaxLoad*float64(2*cuckooWays*len(ch.tables[0])) {
+		ch.resize(2 * len(ch.tables[0]))
+	}
+	for !ch.place(key) {
+		ch.resize(2 * len(ch.tables[0]))
+	}
+	ch.count++
+	return true
+}
+
+// place stores a key known to be absent, displacing others as needed, or
+// reports that the tables must grow first. On failure every key is still
+// in the tables or the stash, bar key itself.
+func (ch *CuckooHash) place(key uint64) bool {
+	if ch.bucket(0, key).add(key) || ch.bucket(1, key).add(key) {
+		return true
+	}
+	if len(ch.stash) == cuckooStashSize {
+		return false
+	}
+	t := 0
+	for kick := 0; kick < cuckooMaxKicks; kick++ {
+		b := ch.bucket(t, key)
+		// xorshift64
+		ch.rng ^= ch.rng << 13
+		ch.rng ^= ch.rng >> 7
+		ch.rng ^= ch.rng << 17
+		i := ch.rng % cuckooWays
+		key, b.keys[i] = b.keys[i], key
+		// The evicted key goes to its bucket in the other table
+		t ^= 1
+		if ch.bucket(t, key).add(key) {
+			return true
+		}
+	}
+	ch.stash = append(ch.stash, key)
+	return true
+}
+
+// resize rebuilds the tables with n buckets each, doubling again should
+// some key not fit.
+func (ch *CuckooHash) resize(n int) {
+	old, stash := ch.tables, ch.stash
+	for {
+		ch.allocate(n)
+		ok := true
+	rebuild:
+		for _, table := range old {
+			for _, b := range table {
+				for i, used := range b.used {
+					if used && !ch.place(b.keys[i]) {
+						ok = false
+						break rebuild
+					}
+				}
+			}
+		}
+		for _, key := range stash {
+			if ok && !ch.place(key) {
+				ok = false
+			}
+		}
+		if ok {
+			break
+		}
+		n *= 2
+	}
+	ch.resizes++
+}
+
+func (ch *CuckooHash) Find(key uint64) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.contains(key)
+}
+
+func (ch *CuckooHash) Delete(key uint64) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	found := false
+	for t := range ch.tables {
+		b := ch.bucket(t, key)
+		if i := b.find(key); i >= 0 {
+			b.used[i] = false
+			found = true
+			break
+		}
+	}
+	if !found {
+		for i, k := range ch.stash {
+			if k == key {
+				ch.stash = append(ch.stash[:i], ch.stash[i+1:]...)
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return false
+	}
+	ch.count--
+
+	// The freed slot may take a stashed key
+	for i := 0; i < len(ch.stash); {
+		k := ch.stash[i]
+		if ch.bucket(0, k).add(k) || ch.bucket(1, k).add(k) {
+			ch.stash = append(ch.stash[:i], ch.stash[i+1:]...)
+		} else {
+			i++
+		}
+	}
+	if n := len(ch.tables[0]); n > cuckooMinBuckets && float64(ch.count) < cuckooMinLoad*float64(2*cuckooWays*n) {
+		ch.resize(n / 2)
+	}
+	return true
+}
+
+// Stashed returns how many keys are in the stash.
+func (ch *CuckooHash) Stashed() int {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return len(ch.stash)
+}
+
+// Keys returns an iterator over the keys, first table, second table, then
+// stash. The keys are gathered before the first is yielded, so the loop
+// body may modify the table.
+func (ch *CuckooHash) Keys() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		ch.mu.RLock()
+		keys := make([]uint64, 0, ch.count)
+		for _, table := range ch.tables {
+			for _, b := range table {
+				for i, used := range b.used {
+					if used {
+						keys = append(keys, b.keys[i])
+					}
+				}
+			}
+		}
+		keys = append(keys, ch.stash...)
+		ch.mu.RUnlock()
+
+		for _, key := range keys {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (ch *CuckooHash) Count() uint64 {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.count
+}
+
+// Resizes returns how many times the tables have been rebuilt.
+func (ch *CuckooHash) Resizes() uint64 {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.resizes
+}
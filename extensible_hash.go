@@ -1,214 +1,463 @@
 package splitordered
 
 import (
-	"math/bits"
+	"iter"
+	"sync"
+	"sync/atomic"
 )
 
 const (
-	ehSegmentBits = 8
-	ehSegmentSize = 1 << ehSegmentBits
-	ehMaxSegments = 1024
 	maxBucketSize = 4 // Maximum number of items per bucket
+	// Buddy buckets merge once they hold this many items between them,
+	// well below a full bucket so a delete and an insert do not keep
+	// merging and splitting the same pair
+	mergeSize = maxBucketSize / 2
+	// Past this many hash bits a full bucket takes overflow buckets
+	// instead of doubling the directory further
+	maxGlobalDepth = 20
 )
 
-type Bucket struct {
-	items      []uint64
+// Bucket holds the keys whose hashes agree in their low localDepth bits.
+// When splitting cannot separate its keys it grows a chain of overflow
+// buckets instead.
+type Bucket[K any] struct {
+	mu         sync.RWMutex
+	items      []K
 	localDepth uint8
+	prefix     uint64 // the low localDepth bits of its keys' hashes; never changes
+	merged     bool   // folded into its buddy, which took over its slots
+	overflow   *Bucket[K]
 }
 
-type ehSegment [ehSegmentSize]*Bucket
+// ExtensibleSet is an extendible hash table of keys of any type, hashed
+// and compared by a Hasher. The directory has 2^globalDepth slots and slot
+// i points at the bucket for hashes whose low globalDepth bits are i. A
+// bucket of local depth d < globalDepth is shared by every slot agreeing
+// with i in the low d bits, so a full bucket splits by raising its local
+// depth and repointing half of its slots; only a bucket already at global
+// depth makes the directory double. Deletes undo both: nearly empty
+// buddies merge, and the directory halves once no bucket needs its last
+// bit.
+//
+// It is safe for concurrent use. Operations share the directory lock and
+// lock only the buckets they touch, so splits and merges of different
+// buckets run in parallel; only doubling and halving the directory take
+// it exclusively. A bucket found through a slot may have been split or
+// merged before it could be locked, so operations check that it still
+// covers their hash and look again if not.
+type ExtensibleSet[K any] struct {
+	hasher Hasher[K]
 
+	dirMu       sync.RWMutex
+	directory   []atomic.Pointer[Bucket[K]]
+	globalDepth uint8
+	atGlobal    atomic.Int64 // buckets whose local depth is the global depth
+
+	count   atomic.Uint64
+	resizes atomic.Uint64
+}
+
+// ExtensibleHash is an ExtensibleSet of uint64 keys that uses the keys as
+// their own hashes.
 type ExtensibleHash struct {
-	segments [ehMaxSegments]*ehSegment
-	size     uint64
-	count    uint64
+	ExtensibleSet[uint64]
 }
 
-func NewExtensibleHash() *ExtensibleHash {
-	eh := &ExtensibleHash{size: 2}
-	seg := &ehSegment{}
-	seg[0] = &Bucket{
-		items:      make([]uint64, 0, maxBucketSize),
-		localDepth: 0,
-	}
-	eh.segments[0] = seg
+// NewExtensibleSet creates an empty set hashing its keys with hasher.
+func NewExtensibleSet[K any](hasher Hasher[K]) *ExtensibleSet[K] {
+	eh := &ExtensibleSet[K]{}
+	eh.init(hasher)
 	return eh
 }
 
-func (eh *ExtensibleHash) hash(key uint64) uint64 {
-	return key
+func NewExtensibleHash() *ExtensibleHash {
+	eh := &ExtensibleHash{}
+	eh.init(IdentityHasher{})
+	return eh
 }
 
-func (eh *ExtensibleHash) getBucketIndex(key uint64) uint64 {
-	return key % eh.size
+func (eh *ExtensibleSet[K]) init(hasher Hasher[K]) {
+	eh.hasher = hasher
+	eh.directory = make([]atomic.Pointer[Bucket[K]], 1)
+	eh.directory[0].Store(newBucket[K](0, 0))
+	eh.atGlobal.Store(1)
 }
 
-func (eh *ExtensibleHash) getBucket(bucketIndex uint64) (*ehSegment, *Bucket) {
-	idx := bucketIndex / ehSegmentSize
-	seg := eh.segments[idx]
-	if seg == nil {
-		return nil, nil
+func newBucket[K any](localDepth uint8, prefix uint64) *Bucket[K] {
+	return &Bucket[K]{
+		items:      make([]K, 0, maxBucketSize),
+		localDepth: localDepth,
+		prefix:     prefix,
 	}
-	return seg, seg[bucketIndex%ehSegmentSize]
 }
 
-func (eh *ExtensibleHash) setBucket(bucketIndex uint64, bucket *Bucket) {
-	idx := bucketIndex / ehSegmentSize
-	seg := eh.segments[idx]
-	if seg == nil {
-		seg = &ehSegment{}
-		eh.segments[idx] = seg
-	}
-	seg[bucketIndex%ehSegmentSize] = bucket
+// slot returns the directory slot of hash h.
+func (eh *ExtensibleSet[K]) slot(h uint64) uint64 {
+	return h & (uint64(len(eh.directory)) - 1)
 }
 
-func (eh *ExtensibleHash) Insert(key uint64) bool {
-	bucketIndex := eh.getBucketIndex(key)
-	_, bucket := eh.getBucket(bucketIndex)
-	if bucket == nil {
-		eh.initializeBucket(bucketIndex, eh.size)
-		_, bucket = eh.getBucket(bucketIndex)
-		if bucket == nil {
-			return false
+// covers reports whether hash h belongs in the bucket.
+func (bucket *Bucket[K]) covers(h uint64) bool {
+	return !bucket.merged && h&(uint64(1)<<bucket.localDepth-1) == bucket.prefix
+}
+
+// lockBucket locks and returns the bucket of hash h. The caller holds the
+// directory lock.
+func (eh *ExtensibleSet[K]) lockBucket(h uint64, write bool) *Bucket[K] {
+	for {
+		bucket := eh.directory[eh.slot(h)].Load()
+		if write {
+			bucket.mu.Lock()
+		} else {
+			bucket.mu.RLock()
+		}
+		// A split or merge repoints the slots before unlocking, so the
+		// next look finds the right bucket
+		if bucket.covers(h) {
+			return bucket
+		}
+		if write {
+			bucket.mu.Unlock()
+		} else {
+			bucket.mu.RUnlock()
 		}
 	}
+}
+
+func (eh *ExtensibleSet[K]) Insert(key K) bool {
+	h := eh.hasher.Hash(key)
+	for {
+		eh.dirMu.RLock()
+		bucket := eh.lockBucket(h, true)
 
-	// Check if key already exists
-	for _, item := range bucket.items {
-		if item == key {
+		// Check if key already exists
+		if b, _ := bucket.find(eh.hasher, key); b != nil {
+			bucket.mu.Unlock()
+			eh.dirMu.RUnlock()
 			return false
 		}
-	}
 
-	// If bucket is full, we need to split
-	if len(bucket.items) >= maxBucketSize {
-		if bucket.localDepth == eh.globalDepth() {
-			eh.doubleSize()
+		if bucket.size() < maxBucketSize || !eh.splittable(bucket, h) {
+			bucket.add(key)
+			eh.count.Add(1)
+			bucket.mu.Unlock()
+			eh.dirMu.RUnlock()
+			return true
+		}
+
+		// Split and try again; all keys of a bucket may land on the same
+		// side, so it can take more than one
+		depth := eh.globalDepth
+		split := bucket.localDepth < depth
+		if split {
+			eh.splitBucket(bucket)
+		}
+		bucket.mu.Unlock()
+		eh.dirMu.RUnlock()
+		if !split {
+			eh.doubleDirectory(depth)
 		}
-		eh.splitBucket(bucketIndex)
-		// Recalculate bucket index as size might have changed
-		bucketIndex = eh.getBucketIndex(key)
-		_, bucket = eh.getBucket(bucketIndex)
 	}
+}
 
-	bucket.items = append(bucket.items, key)
-	eh.count++
-	return true
+func (eh *ExtensibleSet[K]) Find(key K) bool {
+	h := eh.hasher.Hash(key)
+	eh.dirMu.RLock()
+	defer eh.dirMu.RUnlock()
+	bucket := eh.lockBucket(h, false)
+	defer bucket.mu.RUnlock()
+
+	b, _ := bucket.find(eh.hasher, key)
+	return b != nil
 }
 
-func (eh *ExtensibleHash) Find(key uint64) bool {
-	bucketIndex := eh.getBucketIndex(key)
-	_, bucket := eh.getBucket(bucketIndex)
-	if bucket == nil {
+func (eh *ExtensibleSet[K]) Delete(key K) bool {
+	h := eh.hasher.Hash(key)
+	eh.dirMu.RLock()
+	bucket := eh.lockBucket(h, true)
+	b, i := bucket.find(eh.hasher, key)
+	if b == nil {
+		bucket.mu.Unlock()
+		eh.dirMu.RUnlock()
 		return false
 	}
+	bucket.remove(b, i)
+	eh.count.Add(^uint64(0))
+	merge := bucket.localDepth > 0 && bucket.size() <= mergeSize
+	bucket.mu.Unlock()
 
-	for _, item := range bucket.items {
-		if item == key {
-			return true
-		}
+	if merge {
+		eh.mergeBuckets(h)
 	}
-	return false
+	halve := eh.globalDepth > 0 && eh.atGlobal.Load() == 0
+	eh.dirMu.RUnlock()
+	if halve {
+		eh.halveDirectory()
+	}
+	return true
 }
 
-func (eh *ExtensibleHash) Delete(key uint64) bool {
-	bucketIndex := eh.getBucketIndex(key)
-	_, bucket := eh.getBucket(bucketIndex)
-	if bucket == nil {
+// splittable reports whether splitting bucket, possibly more than once,
+// can separate its keys and one with hash h: some key must differ from h
+// in a bit between the local depth and maxGlobalDepth.
+func (eh *ExtensibleSet[K]) splittable(bucket *Bucket[K], h uint64) bool {
+	if bucket.localDepth >= maxGlobalDepth {
 		return false
 	}
-
-	for i, item := range bucket.items {
-		if item == key {
-			// Remove item by swapping with last element and truncating
-			bucket.items[i] = bucket.items[len(bucket.items)-1]
-			bucket.items = bucket.items[:len(bucket.items)-1]
-			eh.count--
-			return true
+	mask := uint64(1)<<maxGlobalDepth - uint64(1)<<bucket.localDepth
+	for b := bucket; b != nil; b = b.overflow {
+		for _, item := range b.items {
+			if (eh.hasher.Hash(item)^h)&mask != 0 {
+				return true
+			}
 		}
 	}
 	return false
 }
 
-func (eh *ExtensibleHash) globalDepth() uint8 {
-	return uint8(63 - bits.LeadingZeros64(eh.size))
+// find returns the bucket of the chain holding key and its index there, or
+// nil.
+func (bucket *Bucket[K]) find(hasher Hasher[K], key K) (*Bucket[K], int) {
+	for b := bucket; b != nil; b = b.overflow {
+		for i, item := range b.items {
+			if hasher.Equal(item, key) {
+				return b, i
+			}
+		}
+	}
+	return nil, 0
 }
 
-func (eh *ExtensibleHash) doubleSize() {
-	oldSize := eh.size
-	eh.size *= 2
-	// Initialize all new buckets
-	for i := oldSize; i < eh.size; i++ {
-		eh.initializeBucket(i, eh.size)
+// size returns the number of keys in the chain.
+func (bucket *Bucket[K]) size() int {
+	n := 0
+	for b := bucket; b != nil; b = b.overflow {
+		n += len(b.items)
 	}
+	return n
 }
 
-func (eh *ExtensibleHash) initializeBucket(bucketIndex, size uint64) {
-	if bucketIndex >= size {
-		return
+// add appends key to the chain, adding an overflow bucket if it is full.
+func (bucket *Bucket[K]) add(key K) {
+	b := bucket
+	for len(b.items) >= maxBucketSize {
+		if b.overflow == nil {
+			b.overflow = newBucket[K](0, 0)
+		}
+		b = b.overflow
 	}
-	parent := ehGetParent(bucketIndex)
-	if parent >= size {
+	b.items = append(b.items, key)
+}
+
+// remove deletes item i of b, a bucket of the chain, filling the hole from
+// the end of the chain and dropping the last overflow bucket once empty.
+func (bucket *Bucket[K]) remove(b *Bucket[K], i int) {
+	var prev *Bucket[K]
+	last := bucket
+	for last.overflow != nil {
+		prev, last = last, last.overflow
+	}
+	b.items[i] = last.items[len(last.items)-1]
+	last.items = last.items[:len(last.items)-1]
+	if len(last.items) == 0 && prev != nil {
+		prev.overflow = nil
+	}
+}
+
+// doubleDirectory adds one bit of global depth, unless another operation
+// has already moved it on from depth. The upper half of the new directory
+// repeats the lower half, so every bucket keeps its slots and gains as
+// many again.
+func (eh *ExtensibleSet[K]) doubleDirectory(depth uint8) {
+	eh.dirMu.Lock()
+	defer eh.dirMu.Unlock()
+	if eh.globalDepth != depth {
 		return
 	}
+	n := len(eh.directory)
+	directory := make([]atomic.Pointer[Bucket[K]], 2*n)
+	for i := range eh.directory {
+		bucket := eh.directory[i].Load()
+		directory[i].Store(bucket)
+		directory[n+i].Store(bucket)
+	}
+	eh.directory = directory
+	eh.globalDepth++
+	eh.atGlobal.Store(0)
+	eh.resizes.Add(1)
+}
 
-	_, parentBucket := eh.getBucket(parent)
-	if parentBucket == nil {
-		eh.initializeBucket(parent, size)
-		_, parentBucket = eh.getBucket(parent)
-		if parentBucket == nil {
-			return
+// halveDirectory drops the upper half of the directory while no bucket
+// tells its slots apart by the last global depth bit.
+func (eh *ExtensibleSet[K]) halveDirectory() {
+	eh.dirMu.Lock()
+	defer eh.dirMu.Unlock()
+	for eh.globalDepth > 0 && eh.atGlobal.Load() == 0 {
+		eh.directory = eh.directory[:len(eh.directory)/2]
+		eh.globalDepth--
+		eh.resizes.Add(1)
+		// Nothing else runs, so the buckets need no locks
+		for i := range eh.directory {
+			if eh.directory[i].Load().localDepth == eh.globalDepth {
+				eh.atGlobal.Add(1)
+			}
+		}
+	}
+	// Let go of the dropped half once it is mostly unused
+	if cap(eh.directory) >= 4*len(eh.directory) {
+		directory := make([]atomic.Pointer[Bucket[K]], len(eh.directory))
+		for i := range directory {
+			directory[i].Store(eh.directory[i].Load())
+		}
+		eh.directory = directory
+	}
+}
+
+// splitBucket moves the keys of bucket whose next hash bit is set to a new
+// bucket, which takes over the slots with that bit set. The caller holds
+// the directory lock and the bucket's, and the bucket's local depth must
+// be below the global depth.
+func (eh *ExtensibleSet[K]) splitBucket(bucket *Bucket[K]) {
+	bit := uint64(1) << bucket.localDepth
+	bucket.localDepth++
+	sibling := newBucket[K](bucket.localDepth, bucket.prefix|bit)
+	if bucket.localDepth == eh.globalDepth {
+		eh.atGlobal.Add(2)
+	}
+
+	chain := bucket.chain()
+	bucket.items, bucket.overflow = make([]K, 0, maxBucketSize), nil
+	for b := chain; b != nil; b = b.overflow {
+		for _, item := range b.items {
+			if eh.hasher.Hash(item)&bit != 0 {
+				sibling.add(item)
+			} else {
+				bucket.add(item)
+			}
 		}
 	}
 
-	newBucket := &Bucket{
-		items:      make([]uint64, 0, maxBucketSize),
-		localDepth: parentBucket.localDepth,
+	// The bucket's slots are every bit-th one from its prefix; the ones
+	// with bit set go to the sibling
+	for i := sibling.prefix; i < uint64(len(eh.directory)); i += bit << 1 {
+		eh.directory[i].Store(sibling)
 	}
-	eh.setBucket(bucketIndex, newBucket)
 }
 
-func ehGetParent(bucketIndex uint64) uint64 {
-	mask := ^(uint64(1) << (63 - bits.LeadingZeros64(bucketIndex)))
-	return bucketIndex & mask
+// chain returns an unlocked copy of the bucket's items and overflow chain.
+func (bucket *Bucket[K]) chain() *Bucket[K] {
+	return &Bucket[K]{items: bucket.items, overflow: bucket.overflow}
 }
 
-func (eh *ExtensibleHash) splitBucket(bucketIndex uint64) {
-	_, bucket := eh.getBucket(bucketIndex)
-	if bucket == nil {
-		return
+// mergeBuckets folds the bucket of hash h and its buddy, the bucket it was
+// split from or split off, back into one while they hold few enough items.
+// The caller holds the directory lock. Merging is best effort: it stops
+// when concurrent operations change either bucket first.
+func (eh *ExtensibleSet[K]) mergeBuckets(h uint64) {
+	for {
+		bucket := eh.lockBucket(h, false)
+		depth, prefix := bucket.localDepth, bucket.prefix
+		bucket.mu.RUnlock()
+		if depth == 0 {
+			return
+		}
+		bit := uint64(1) << (depth - 1)
+		lower, upper := eh.directory[prefix&^bit].Load(), eh.directory[prefix|bit].Load()
+		// Buckets are always locked in prefix order
+		if lower.prefix >= upper.prefix {
+			return
+		}
+		lower.mu.Lock()
+		upper.mu.Lock()
+		// The buddy may have split further
+		ok := !lower.merged && !upper.merged && lower.localDepth == depth && upper.localDepth == depth &&
+			lower.size()+upper.size() <= mergeSize
+		if ok {
+			if depth == eh.globalDepth {
+				eh.atGlobal.Add(-2)
+			}
+			lower.items = append(lower.items, upper.items...)
+			lower.localDepth--
+			upper.merged = true
+			for i := upper.prefix; i < uint64(len(eh.directory)); i += bit << 1 {
+				eh.directory[i].Store(lower)
+			}
+		}
+		upper.mu.Unlock()
+		lower.mu.Unlock()
+		if !ok {
+			return
+		}
 	}
-	bucket.localDepth++
+}
 
-	// Create new bucket
-	newBucket := &Bucket{
-		items:      make([]uint64, 0, maxBucketSize),
-		localDepth: bucket.localDepth,
+// buckets returns the distinct buckets, each locked for reading while fn
+// runs. Slot i is the first of its bucket's slots if it is the prefix.
+// The caller holds the directory lock.
+func (eh *ExtensibleSet[K]) buckets(fn func(bucket *Bucket[K])) {
+	for i := range eh.directory {
+		bucket := eh.directory[i].Load()
+		bucket.mu.RLock()
+		if !bucket.merged && uint64(i) == bucket.prefix {
+			fn(bucket)
+		}
+		bucket.mu.RUnlock()
 	}
+}
 
-	// Redistribute items
-	var itemsToKeep []uint64
-	for _, item := range bucket.items {
-		if (eh.hash(item)>>(bucket.localDepth-1))&1 == 1 {
-			newBucket.items = append(newBucket.items, item)
-		} else {
-			itemsToKeep = append(itemsToKeep, item)
+// Stats reports the directory's depths and how the keys are spread over
+// the buckets. Directory slots sharing a bucket count as one chain, and so
+// do a bucket and its overflow buckets. Under concurrent writes the
+// figures are approximate.
+func (eh *ExtensibleSet[K]) Stats() HashStats {
+	eh.dirMu.RLock()
+	defer eh.dirMu.RUnlock()
+
+	s := HashStats{Buckets: uint64(len(eh.directory)), GlobalDepth: int(eh.globalDepth)}
+	eh.buckets(func(bucket *Bucket[K]) {
+		n := bucket.size()
+		s.LiveNodes += uint64(n)
+		s.addChain(n)
+		s.addLocalDepth(int(bucket.localDepth))
+		for b := bucket.overflow; b != nil; b = b.overflow {
+			s.OverflowBuckets++
 		}
+	})
+	s.finish()
+	if s.Chains > 0 {
+		s.Occupancy = float64(s.LiveNodes) / float64((s.Chains+s.OverflowBuckets)*maxBucketSize)
 	}
-	bucket.items = itemsToKeep
+	return s
+}
 
-	// Update directory entries
-	dirSize := eh.size
-	for i := uint64(0); i < dirSize; i++ {
-		_, currBucket := eh.getBucket(i)
-		if currBucket == bucket {
-			if (i>>(bucket.localDepth-1))&1 == 1 {
-				eh.setBucket(i, newBucket)
+// Keys returns an iterator over the keys, bucket by bucket. The table
+// holds keys only, so there is no All or Values. The keys are gathered
+// before the first is yielded, so the loop body may modify the set; keys
+// changed concurrently while they are gathered may or may not be seen.
+func (eh *ExtensibleSet[K]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		eh.dirMu.RLock()
+		keys := make([]K, 0, eh.count.Load())
+		eh.buckets(func(bucket *Bucket[K]) {
+			for b := bucket; b != nil; b = b.overflow {
+				keys = append(keys, b.items...)
+			}
+		})
+		eh.dirMu.RUnlock()
+
+		for _, key := range keys {
+			if !yield(key) {
+				return
 			}
 		}
 	}
 }
 
-func (eh *ExtensibleHash) Count() uint64 {
-	return eh.count
+func (eh *ExtensibleSet[K]) Count() uint64 {
+	return eh.count.Load()
+}
+
+// Resizes returns how many times the directory has doubled or halved.
+func (eh *ExtensibleSet[K]) Resizes() uint64 {
+	return eh.resizes.Load()
 }
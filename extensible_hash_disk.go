@@ -0,0 +1,473 @@
+package splitordered
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"manager"
+)
+
+// A DiskHash lives in three kinds of pages, all after the common header:
+//
+//	root:      globalDepth(8) count(8) dirPages(8) dirPageID(8)...
+//	directory: bucket pageID(8) per slot, dirSlotsPerPage to a page
+//	bucket:    localDepth(8) count(8) key(8) value(8)...
+//
+// Slot i of the directory is slot i%dirSlotsPerPage of directory page
+// i/dirSlotsPerPage.
+const (
+	diskDepthOffset    = manager.PageHeaderSize
+	diskCountOffset    = diskDepthOffset + 8
+	diskDirPagesOffset = diskCountOffset + 8
+	diskRootHeaderSize = diskDirPagesOffset + 8
+	maxDirPages        = (manager.PageSize - diskRootHeaderSize) / 8
+	dirSlotsPerPage    = (manager.PageSize - manager.PageHeaderSize) / 8
+
+	bucketDepthOffset  = manager.PageHeaderSize
+	bucketCountOffset  = bucketDepthOffset + 8
+	bucketHeaderSize   = bucketCountOffset + 8
+	bucketEntrySize    = 16
+	maxDiskBucketItems = (manager.PageSize - bucketHeaderSize) / bucketEntrySize
+
+	// sizedBucketItems is how many keys NewDiskHashSized plans to a
+	// bucket, leaving room for keys whose hashes bunch
+	sizedBucketItems = maxDiskBucketItems * 3 / 4
+)
+
+// ErrHashFull is returned when a bucket cannot split because the directory
+// has reached the most slots the root page can index.
+var ErrHashFull = errors.New("extendible hash directory is full")
+
+// DiskHash is an extendible hash index of uint64 keys and values kept in
+// BufferManager pages, for equality lookups in one page read after the
+// directory. Keys are mixed with splitmix64, which is fixed rather than
+// seeded so an index reads back the same in another process. Like BTree
+// it is not safe for concurrent writes.
+type DiskHash struct {
+	bm   *manager.BufferManager
+	root manager.PageID
+}
+
+// NewDiskHash creates an empty index in the tablespace of the default file.
+func NewDiskHash(bm *manager.BufferManager) (*DiskHash, error) {
+	return NewDiskHashIn(bm, manager.DefaultFileID)
+}
+
+// NewDiskHashIn creates an empty index in the given tablespace.
+func NewDiskHashIn(bm *manager.BufferManager, fileID manager.FileID) (*DiskHash, error) {
+	return NewDiskHashSized(bm, fileID, 0)
+}
+
+// NewDiskHashSized creates an empty index in the given tablespace with
+// enough buckets for n keys, three quarters filling each, so that
+// loading them splits few buckets instead of doubling the directory again
+// and again. The index grows past n as any other does.
+func NewDiskHashSized(bm *manager.BufferManager, fileID manager.FileID, n uint64) (*DiskHash, error) {
+	var depth uint64
+	for 1<<depth*sizedBucketItems < n && 2<<depth <= maxDirPages*dirSlotsPerPage {
+		depth++
+	}
+	buckets := uint64(1) << depth
+	dirPages := (buckets + dirSlotsPerPage - 1) / dirSlotsPerPage
+
+	// Each directory page follows the buckets of its slots, and the root
+	// comes last
+	dirIDs := make([]manager.PageID, dirPages)
+	bucketIDs := make([]manager.PageID, 0, min(buckets, dirSlotsPerPage))
+	for p := range dirIDs {
+		bucketIDs = bucketIDs[:0]
+		for slot := uint64(p) * dirSlotsPerPage; slot < buckets && len(bucketIDs) < dirSlotsPerPage; slot++ {
+			bucketID, bucket, err := bm.NewPageIn(fileID)
+			if err != nil {
+				return nil, err
+			}
+			initDiskPage(bucket, manager.PageTypeHashBucket, bucketHeaderSize)
+			diskBucket{bucket}.setLocalDepth(depth)
+			if err := bm.UnpinPage(bucketID, true); err != nil {
+				return nil, err
+			}
+			bucketIDs = append(bucketIDs, bucketID)
+		}
+
+		dirID, dir, err := bm.NewPageIn(fileID)
+		if err != nil {
+			return nil, err
+		}
+		initDiskPage(dir, manager.PageTypeHashDirectory, manager.PageSize)
+		for i, bucketID := range bucketIDs {
+			putPageID(dir[manager.PageHeaderSize+i*8:], bucketID)
+		}
+		if err := bm.UnpinPage(dirID, true); err != nil {
+			return nil, err
+		}
+		dirIDs[p] = dirID
+	}
+
+	rootID, root, err := bm.NewPageIn(fileID)
+	if err != nil {
+		return nil, err
+	}
+	initDiskPage(root, manager.PageTypeHashDirectory, manager.PageSize)
+	binary.BigEndian.PutUint64(root[diskDepthOffset:], depth)
+	binary.BigEndian.PutUint64(root[diskDirPagesOffset:], dirPages)
+	for p, dirID := range dirIDs {
+		putPageID(root[diskRootHeaderSize+p*8:], dirID)
+	}
+	if err := bm.UnpinPage(rootID, true); err != nil {
+		return nil, err
+	}
+	return &DiskHash{bm: bm, root: rootID}, nil
+}
+
+// OpenDiskHash opens an index created with NewDiskHash by its root page.
+func OpenDiskHash(bm *manager.BufferManager, root manager.PageID) (*DiskHash, error) {
+	data, err := bm.PinPage(root)
+	if err != nil {
+		return nil, err
+	}
+	defer bm.UnpinPage(root, false)
+	if t := manager.GetPageType(data); t != manager.PageTypeHashDirectory {
+		return nil, fmt.Errorf("expected hash directory page, got %v", t)
+	}
+	if n := binary.BigEndian.Uint64(data[diskDirPagesOffset:]); n == 0 || n > maxDirPages {
+		return nil, fmt.Errorf("corrupt hash root: %d directory pages", n)
+	}
+	return &DiskHash{bm: bm, root: root}, nil
+}
+
+// Root returns the page to pass to OpenDiskHash.
+func (dh *DiskHash) Root() manager.PageID {
+	return dh.root
+}
+
+// Count returns the number of keys.
+func (dh *DiskHash) Count() (uint64, error) {
+	data, err := dh.bm.PinPage(dh.root)
+	if err != nil {
+		return 0, err
+	}
+	defer dh.bm.UnpinPage(dh.root, false)
+	return binary.BigEndian.Uint64(data[diskCountOffset:]), nil
+}
+
+// GlobalDepth returns the number of hash bits the directory is indexed by.
+func (dh *DiskHash) GlobalDepth() (int, error) {
+	data, err := dh.bm.PinPage(dh.root)
+	if err != nil {
+		return 0, err
+	}
+	defer dh.bm.UnpinPage(dh.root, false)
+	return int(binary.BigEndian.Uint64(data[diskDepthOffset:])), nil
+}
+
+// Get returns the value stored for key.
+func (dh *DiskHash) Get(key uint64) (uint64, bool, error) {
+	bucketID, err := dh.lookup(mix64(key))
+	if err != nil {
+		return 0, false, err
+	}
+	data, err := dh.bm.PinPage(bucketID)
+	if err != nil {
+		return 0, false, err
+	}
+	defer dh.bm.UnpinPage(bucketID, false)
+	b, err := asDiskBucket(data)
+	if err != nil {
+		return 0, false, err
+	}
+	if i, found := b.find(key); found {
+		return b.value(i), true, nil
+	}
+	return 0, false, nil
+}
+
+// Put stores value for key, replacing any previous value, and reports
+// whether the key is new.
+func (dh *DiskHash) Put(key, value uint64) (bool, error) {
+	if dh.bm.ReadOnly(dh.root.FileID()) {
+		return false, manager.ErrReadOnly
+	}
+	h := mix64(key)
+	for {
+		bucketID, err := dh.lookup(h)
+		if err != nil {
+			return false, err
+		}
+		data, err := dh.bm.PinPage(bucketID)
+		if err != nil {
+			return false, err
+		}
+		b, err := asDiskBucket(data)
+		if err != nil {
+			dh.bm.UnpinPage(bucketID, false)
+			return false, err
+		}
+		if i, found := b.find(key); found {
+			b.setValue(i, value)
+			return false, dh.bm.UnpinPage(bucketID, true)
+		}
+		if n := b.count(); n < maxDiskBucketItems {
+			b.setEntry(n, key, value)
+			b.setCount(n + 1)
+			if err := dh.bm.UnpinPage(bucketID, true); err != nil {
+				return false, err
+			}
+			return true, dh.addCount(1)
+		}
+		// Full: split it and look the key up again
+		err = dh.split(h, bucketID, b)
+		if uerr := dh.bm.UnpinPage(bucketID, true); err == nil {
+			err = uerr
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// Delete removes key and reports whether it was present. Buckets are not
+// merged, so the index does not shrink.
+func (dh *DiskHash) Delete(key uint64) (bool, error) {
+	if dh.bm.ReadOnly(dh.root.FileID()) {
+		return false, manager.ErrReadOnly
+	}
+	bucketID, err := dh.lookup(mix64(key))
+	if err != nil {
+		return false, err
+	}
+	data, err := dh.bm.PinPage(bucketID)
+	if err != nil {
+		return false, err
+	}
+	b, err := asDiskBucket(data)
+	if err != nil {
+		dh.bm.UnpinPage(bucketID, false)
+		return false, err
+	}
+	i, found := b.find(key)
+	if !found {
+		return false, dh.bm.UnpinPage(bucketID, false)
+	}
+	// Move the last entry into the hole
+	n := b.count() - 1
+	b.setEntry(i, b.key(n), b.value(n))
+	b.setCount(n)
+	if err := dh.bm.UnpinPage(bucketID, true); err != nil {
+		return false, err
+	}
+	return true, dh.addCount(-1)
+}
+
+// lookup returns the bucket page of hash h.
+func (dh *DiskHash) lookup(h uint64) (manager.PageID, error) {
+	root, err := dh.bm.PinPage(dh.root)
+	if err != nil {
+		return 0, err
+	}
+	depth := binary.BigEndian.Uint64(root[diskDepthOffset:])
+	slot := h & (1<<depth - 1)
+	dirID := getPageID(root[diskRootHeaderSize+slot/dirSlotsPerPage*8:])
+	if err := dh.bm.UnpinPage(dh.root, false); err != nil {
+		return 0, err
+	}
+
+	dir, err := dh.bm.PinPage(dirID)
+	if err != nil {
+		return 0, err
+	}
+	defer dh.bm.UnpinPage(dirID, false)
+	return getPageID(dir[manager.PageHeaderSize+slot%dirSlotsPerPage*8:]), nil
+}
+
+// split moves the entries of the full bucket b, found through hash h, whose
+// next hash bit is set to a new bucket page and points half of its slots
+// at it, doubling the directory first if b is at global depth.
+func (dh *DiskHash) split(h uint64, bucketID manager.PageID, b diskBucket) error {
+	root, err := dh.bm.PinPage(dh.root)
+	if err != nil {
+		return err
+	}
+	defer dh.bm.UnpinPage(dh.root, true)
+
+	depth := binary.BigEndian.Uint64(root[diskDepthOffset:])
+	local := b.localDepth()
+	if local == depth {
+		if err := dh.double(root); err != nil {
+			return err
+		}
+		depth++
+	}
+
+	siblingID, data, err := dh.bm.NewPageIn(dh.root.FileID())
+	if err != nil {
+		return err
+	}
+	sibling := diskBucket{data}
+	initDiskPage(data, manager.PageTypeHashBucket, bucketHeaderSize)
+	bit := uint64(1) << local
+	kept, moved := 0, 0
+	for i := 0; i < b.count(); i++ {
+		key, value := b.key(i), b.value(i)
+		if mix64(key)&bit != 0 {
+			sibling.setEntry(moved, key, value)
+			moved++
+		} else {
+			b.setEntry(kept, key, value)
+			kept++
+		}
+	}
+	b.setCount(kept)
+	b.setLocalDepth(local + 1)
+	sibling.setCount(moved)
+	sibling.setLocalDepth(local + 1)
+	if err := dh.bm.UnpinPage(siblingID, true); err != nil {
+		return err
+	}
+
+	// The bucket's slots are every bit-th one from the lowest; the ones
+	// with bit set go to the sibling
+	for slot := h&(bit-1) | bit; slot < 1<<depth; slot += bit << 1 {
+		if err := dh.setSlot(root, slot, siblingID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// double copies the directory into a second half of the same size and
+// raises the global depth, adding directory pages as needed.
+func (dh *DiskHash) double(root *[manager.PageSize]byte) error {
+	depth := binary.BigEndian.Uint64(root[diskDepthOffset:])
+	size := uint64(1) << depth
+	pages := binary.BigEndian.Uint64(root[diskDirPagesOffset:])
+	need := (2*size + dirSlotsPerPage - 1) / dirSlotsPerPage
+	if need > maxDirPages {
+		return ErrHashFull
+	}
+	for ; pages < need; pages++ {
+		dirID, dir, err := dh.bm.NewPageIn(dh.root.FileID())
+		if err != nil {
+			return err
+		}
+		initDiskPage(dir, manager.PageTypeHashDirectory, manager.PageSize)
+		putPageID(root[diskRootHeaderSize+pages*8:], dirID)
+		binary.BigEndian.PutUint64(root[diskDirPagesOffset:], pages+1)
+		if err := dh.bm.UnpinPage(dirID, true); err != nil {
+			return err
+		}
+	}
+
+	for slot := uint64(0); slot < size; slot++ {
+		bucketID, err := dh.getSlot(root, slot)
+		if err != nil {
+			return err
+		}
+		if err := dh.setSlot(root, size+slot, bucketID); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint64(root[diskDepthOffset:], depth+1)
+	return nil
+}
+
+func (dh *DiskHash) getSlot(root *[manager.PageSize]byte, slot uint64) (manager.PageID, error) {
+	dirID := getPageID(root[diskRootHeaderSize+slot/dirSlotsPerPage*8:])
+	dir, err := dh.bm.PinPage(dirID)
+	if err != nil {
+		return 0, err
+	}
+	defer dh.bm.UnpinPage(dirID, false)
+	return getPageID(dir[manager.PageHeaderSize+slot%dirSlotsPerPage*8:]), nil
+}
+
+func (dh *DiskHash) setSlot(root *[manager.PageSize]byte, slot uint64, bucketID manager.PageID) error {
+	dirID := getPageID(root[diskRootHeaderSize+slot/dirSlotsPerPage*8:])
+	dir, err := dh.bm.PinPage(dirID)
+	if err != nil {
+		return err
+	}
+	putPageID(dir[manager.PageHeaderSize+slot%dirSlotsPerPage*8:], bucketID)
+	return dh.bm.UnpinPage(dirID, true)
+}
+
+func (dh *DiskHash) addCount(delta int64) error {
+	root, err := dh.bm.PinPage(dh.root)
+	if err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint64(root[diskCountOffset:])
+	binary.BigEndian.PutUint64(root[diskCountOffset:], uint64(int64(n)+delta))
+	return dh.bm.UnpinPage(dh.root, true)
+}
+
+// diskBucket wraps a bucket page.
+type diskBucket struct {
+	data *[manager.PageSize]byte
+}
+
+func asDiskBucket(data *[manager.PageSize]byte) (diskBucket, error) {
+	if t := manager.GetPageType(data); t != manager.PageTypeHashBucket {
+		return diskBucket{}, fmt.Errorf("expected hash bucket page, got %v", t)
+	}
+	b := diskBucket{data}
+	if n := b.count(); n > maxDiskBucketItems {
+		return diskBucket{}, fmt.Errorf("corrupt hash bucket: %d entries", n)
+	}
+	return b, nil
+}
+
+func (b diskBucket) localDepth() uint64 {
+	return binary.BigEndian.Uint64(b.data[bucketDepthOffset:])
+}
+
+func (b diskBucket) setLocalDepth(depth uint64) {
+	binary.BigEndian.PutUint64(b.data[bucketDepthOffset:], depth)
+}
+
+func (b diskBucket) count() int {
+	return int(binary.BigEndian.Uint64(b.data[bucketCountOffset:]))
+}
+
+func (b diskBucket) setCount(n int) {
+	binary.BigEndian.PutUint64(b.data[bucketCountOffset:], uint64(n))
+}
+
+func (b diskBucket) key(i int) uint64 {
+	return binary.BigEndian.Uint64(b.data[bucketHeaderSize+i*bucketEntrySize:])
+}
+
+func (b diskBucket) value(i int) uint64 {
+	return binary.BigEndian.Uint64(b.data[bucketHeaderSize+i*bucketEntrySize+8:])
+}
+
+func (b diskBucket) setValue(i int, value uint64) {
+	binary.BigEndian.PutUint64(b.data[bucketHeaderSize+i*bucketEntrySize+8:], value)
+}
+
+func (b diskBucket) setEntry(i int, key, value uint64) {
+	entry := b.data[bucketHeaderSize+i*bucketEntrySize:]
+	binary.BigEndian.PutUint64(entry, key)
+	binary.BigEndian.PutUint64(entry[8:], value)
+}
+
+func (b diskBucket) find(key uint64) (int, bool) {
+	for i := 0; i < b.count(); i++ {
+		if b.key(i) == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func initDiskPage(data *[manager.PageSize]byte, t manager.PageType, headerSize int) {
+	clear(data[:headerSize])
+	manager.SetPageType(data, t)
+}
+
+func getPageID(b []byte) manager.PageID {
+	return manager.PageID(binary.BigEndian.Uint64(b))
+}
+
+func putPageID(b []byte, id manager.PageID) {
+	binary.BigEndian.PutUint64(b, uint64(id))
+}
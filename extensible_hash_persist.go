@@ -0,0 +1,231 @@
+package splitordered
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+)
+
+// ehMagic starts every saved ExtensibleHash.
+const ehMagic = 0x45584831 // "EXH1"
+
+// Save writes the directory and buckets of the hash to w, as of one
+// instant, for LoadExtensibleHash. The format, all integers big-endian:
+//
+//	magic(4) globalDepth(4) buckets(4) keys(8)
+//	directory: 2^globalDepth bucket indexes(4)
+//	buckets:   localDepth(4) count(4) then count keys(8), each
+//	crc(4)     CRC-32 (IEEE) of everything before it
+//
+// Buckets are numbered in the order of their first directory slot, and
+// overflow chains are stored as one bucket.
+func (eh *ExtensibleHash) Save(w io.Writer) error {
+	// Copy it out under the exclusive lock, so no split or merge runs
+	// meanwhile, and write without holding up other operations
+	eh.dirMu.Lock()
+	slots := make([]uint32, len(eh.directory))
+	index := make(map[*Bucket[uint64]]uint32)
+	var depths []uint8
+	var keys [][]uint64
+	for i := range eh.directory {
+		bucket := eh.directory[i].Load()
+		n, ok := index[bucket]
+		if !ok {
+			n = uint32(len(keys))
+			index[bucket] = n
+			depths = append(depths, bucket.localDepth)
+			var items []uint64
+			for b := bucket; b != nil; b = b.overflow {
+				items = append(items, b.items...)
+			}
+			keys = append(keys, items)
+		}
+		slots[i] = n
+	}
+	depth := eh.globalDepth
+	count := eh.count.Load()
+	eh.dirMu.Unlock()
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	var buf [8]byte
+	put32 := func(v uint32) error {
+		binary.BigEndian.PutUint32(buf[:4], v)
+		_, err := bw.Write(buf[:4])
+		return err
+	}
+	put64 := func(v uint64) error {
+		binary.BigEndian.PutUint64(buf[:], v)
+		_, err := bw.Write(buf[:])
+		return err
+	}
+
+	if err := put32(ehMagic); err != nil {
+		return err
+	}
+	if err := put32(uint32(depth)); err != nil {
+		return err
+	}
+	if err := put32(uint32(len(keys))); err != nil {
+		return err
+	}
+	if err := put64(count); err != nil {
+		return err
+	}
+	for _, n := range slots {
+		if err := put32(n); err != nil {
+			return err
+		}
+	}
+	for i, items := range keys {
+		if err := put32(uint32(depths[i])); err != nil {
+			return err
+		}
+		if err := put32(uint32(len(items))); err != nil {
+			return err
+		}
+		for _, key := range items {
+			if err := put64(key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc.Sum32())
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// LoadExtensibleHash reads a hash written by Save. It checks the
+// checksum and that the directory and keys are consistent before
+// returning it.
+func LoadExtensibleHash(r io.Reader) (*ExtensibleHash, error) {
+	crc := crc32.NewIEEE()
+	br := io.TeeReader(bufio.NewReader(r), crc)
+	var buf [8]byte
+	get32 := func() (uint32, error) {
+		_, err := io.ReadFull(br, buf[:4])
+		return binary.BigEndian.Uint32(buf[:4]), err
+	}
+	get64 := func() (uint64, error) {
+		_, err := io.ReadFull(br, buf[:])
+		return binary.BigEndian.Uint64(buf[:]), err
+	}
+
+	magic, err := get32()
+	if err != nil {
+		return nil, err
+	}
+	if magic != ehMagic {
+		return nil, errors.New("not a saved extendible hash")
+	}
+	depth, err := get32()
+	if err != nil {
+		return nil, err
+	}
+	if depth > maxGlobalDepth {
+		return nil, fmt.Errorf("corrupt extendible hash: global depth %d", depth)
+	}
+	numBuckets, err := get32()
+	if err != nil {
+		return nil, err
+	}
+	if numBuckets == 0 || numBuckets > 1<<depth {
+		return nil, fmt.Errorf("corrupt extendible hash: %d buckets for %d slots", numBuckets, 1<<depth)
+	}
+	count, err := get64()
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]uint32, 1<<depth)
+	for i := range slots {
+		if slots[i], err = get32(); err != nil {
+			return nil, err
+		}
+		if slots[i] >= numBuckets {
+			return nil, fmt.Errorf("corrupt extendible hash: slot %d points at bucket %d of %d", i, slots[i], numBuckets)
+		}
+	}
+
+	buckets := make([]*Bucket[uint64], numBuckets)
+	var total uint64
+	for i := range buckets {
+		localDepth, err := get32()
+		if err != nil {
+			return nil, err
+		}
+		if localDepth > depth {
+			return nil, fmt.Errorf("corrupt extendible hash: bucket %d has local depth %d", i, localDepth)
+		}
+		n, err := get32()
+		if err != nil {
+			return nil, err
+		}
+		bucket := newBucket[uint64](uint8(localDepth), 0)
+		for j := uint32(0); j < n; j++ {
+			key, err := get64()
+			if err != nil {
+				return nil, err
+			}
+			bucket.add(key)
+		}
+		buckets[i] = bucket
+		total += uint64(n)
+	}
+	if total != count {
+		return nil, fmt.Errorf("corrupt extendible hash: %d keys, header says %d", total, count)
+	}
+	sum := crc.Sum32()
+	if _, err := io.ReadFull(br, buf[:4]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(buf[:4]) != sum {
+		return nil, errors.New("corrupt extendible hash: checksum mismatch")
+	}
+
+	eh := NewExtensibleHash()
+	eh.directory = make([]atomic.Pointer[Bucket[uint64]], len(slots))
+	eh.globalDepth = uint8(depth)
+	eh.atGlobal.Store(0)
+	seen := make([]int, numBuckets)
+	for i, n := range slots {
+		bucket := buckets[n]
+		step := 1 << bucket.localDepth
+		seen[n]++
+		if seen[n] == 1 {
+			// The first slot of a bucket is its prefix, and every step-th
+			// slot from there must point at it too
+			if i >= step {
+				return nil, fmt.Errorf("corrupt extendible hash: bucket %d first at slot %d", n, i)
+			}
+			bucket.prefix = uint64(i)
+			if uint32(bucket.localDepth) == depth {
+				eh.atGlobal.Add(1)
+			}
+			for b := bucket; b != nil; b = b.overflow {
+				for _, key := range b.items {
+					if eh.hasher.Hash(key)&(uint64(step)-1) != bucket.prefix {
+						return nil, fmt.Errorf("corrupt extendible hash: key %d in bucket %d", key, n)
+					}
+				}
+			}
+		} else if uint64(i)&(uint64(step)-1) != bucket.prefix {
+			return nil, fmt.Errorf("corrupt extendible hash: slot %d shares bucket %d", i, n)
+		}
+		eh.directory[i].Store(bucket)
+	}
+	for n, bucket := range buckets {
+		if want := 1 << (depth - uint32(bucket.localDepth)); seen[n] != want {
+			return nil, fmt.Errorf("corrupt extendible hash: bucket %d has %d slots, want %d", n, seen[n], want)
+		}
+	}
+	eh.count.Store(count)
+	return eh, nil
+}
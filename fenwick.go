@@ -0,0 +1,71 @@
+package rangequery
+
+// Number is the element type of a Fenwick tree and of the sum, min and max
+// segment trees.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Fenwick is a Fenwick tree, or binary indexed tree, over positions 0 to
+// n-1: point updates and prefix and range sums in O(log n), in one slice
+// of n numbers. Entry i, counting from 1, holds the sum of the i&-i
+// positions ending at i, so a prefix sum adds one entry per set bit of
+// its length and an update touches one per level. Not safe for concurrent
+// use.
+type Fenwick[T Number] struct {
+	tree []T // 1-based
+}
+
+func NewFenwick[T Number](n int) *Fenwick[T] {
+	return &Fenwick[T]{tree: make([]T, n+1)}
+}
+
+// FenwickOf returns a Fenwick tree of values, built in O(n).
+func FenwickOf[T Number](values []T) *Fenwick[T] {
+	f := NewFenwick[T](len(values))
+	copy(f.tree[1:], values)
+	for i := 1; i < len(f.tree); i++ {
+		if parent := i + i&-i; parent < len(f.tree) {
+			f.tree[parent] += f.tree[i]
+		}
+	}
+	return f
+}
+
+func (f *Fenwick[T]) Len() int { return len(f.tree) - 1 }
+
+// Add adds delta at position i.
+func (f *Fenwick[T]) Add(i int, delta T) {
+	for i++; i < len(f.tree); i += i & -i {
+		f.tree[i] += delta
+	}
+}
+
+// Set makes the value at position i v.
+func (f *Fenwick[T]) Set(i int, v T) {
+	f.Add(i, v-f.Get(i))
+}
+
+// Get returns the value at position i.
+func (f *Fenwick[T]) Get(i int) T {
+	return f.RangeSum(i, i+1)
+}
+
+// Sum returns the sum of positions 0 to n-1.
+func (f *Fenwick[T]) Sum(n int) T {
+	var s T
+	for ; n > 0; n -= n & -n {
+		s += f.tree[n]
+	}
+	return s
+}
+
+// RangeSum returns the sum of positions lo to hi-1.
+func (f *Fenwick[T]) RangeSum(lo, hi int) T {
+	if hi <= lo {
+		return 0
+	}
+	return f.Sum(hi) - f.Sum(lo)
+}
@@ -0,0 +1,72 @@
+package rangequery
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestFenwick(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	for _, n := range []int{0, 1, 2, 7, 8, 100, 1023} {
+		values := make([]int, n)
+		for i := range values {
+			values[i] = r.IntN(200) - 100
+		}
+		built := NewFenwick[int](n)
+		for i, v := range values {
+			built.Add(i, v)
+		}
+		f := FenwickOf(slices.Clone(values))
+		if !slices.Equal(f.tree, built.tree) {
+			t.Fatalf("n %d: FenwickOf differs from adding each value", n)
+		}
+		if f.Len() != n {
+			t.Errorf("Len = %d, want %d", f.Len(), n)
+		}
+
+		for step := range 500 {
+			if n > 0 {
+				i := r.IntN(n)
+				if step%2 == 0 {
+					d := r.IntN(50) - 25
+					f.Add(i, d)
+					values[i] += d
+				} else {
+					v := r.IntN(1000)
+					f.Set(i, v)
+					values[i] = v
+				}
+				if got := f.Get(i); got != values[i] {
+					t.Fatalf("n %d: Get(%d) = %d, want %d", n, i, got, values[i])
+				}
+			}
+			lo, hi := r.IntN(n+1), r.IntN(n+1)
+			want := 0
+			for _, v := range values[lo:max(lo, hi)] {
+				want += v
+			}
+			if got := f.RangeSum(lo, hi); got != want {
+				t.Fatalf("n %d: RangeSum(%d, %d) = %d, want %d", n, lo, hi, got, want)
+			}
+			if got, want := f.Sum(hi), f.RangeSum(0, hi); got != want {
+				t.Fatalf("n %d: Sum(%d) = %d, RangeSum from 0 %d", n, hi, got, want)
+			}
+		}
+	}
+}
+
+func TestFenwickUnsigned(t *testing.T) {
+	// Differences of unsigned sums wrap around and back
+	f := FenwickOf([]uint8{200, 100, 50, 255})
+	if got := f.RangeSum(1, 3); got != 150 {
+		t.Errorf("RangeSum(1, 3) = %d, want 150", got)
+	}
+	f.Set(0, 1)
+	if got := f.Get(0); got != 1 {
+		t.Errorf("Get(0) after Set = %d, want 1", got)
+	}
+	if got := f.RangeSum(2, 4); got != uint8(305%256) {
+		t.Errorf("RangeSum(2, 4) = %d, want %d", got, uint8(305%256))
+	}
+}
@@ -0,0 +1,78 @@
+package splitordered
+
+// HashStats describes how keys are spread over a hash table's buckets.
+type HashStats struct {
+	Buckets    uint64 // current table size
+	Chains     uint64 // buckets actually holding a chain
+	LiveNodes  uint64 // keys
+	DummyNodes uint64 // bucket markers in the split-ordered list
+	MinChain   int
+	MaxChain   int
+	AvgChain   float64
+	// Histogram[n] is the number of chains holding n keys
+	Histogram []uint64
+
+	// Extendible hashing only. Buckets is the directory size.
+	GlobalDepth int
+	// LocalDepths[d] is the number of buckets of local depth d; many more
+	// at the global depth than below it means keys crowd a few slots
+	LocalDepths     []uint64
+	OverflowBuckets uint64
+	// Occupancy is LiveNodes over the keys the buckets hold without
+	// overflow
+	Occupancy float64
+}
+
+func (s *HashStats) addChain(n int) {
+	if s.Chains == 0 || n < s.MinChain {
+		s.MinChain = n
+	}
+	if n > s.MaxChain {
+		s.MaxChain = n
+	}
+	for len(s.Histogram) <= n {
+		s.Histogram = append(s.Histogram, 0)
+	}
+	s.Histogram[n]++
+	s.Chains++
+}
+
+func (s *HashStats) addLocalDepth(d int) {
+	for len(s.LocalDepths) <= d {
+		s.LocalDepths = append(s.LocalDepths, 0)
+	}
+	s.LocalDepths[d]++
+}
+
+func (s *HashStats) finish() {
+	if s.Chains > 0 {
+		s.AvgChain = float64(s.LiveNodes) / float64(s.Chains)
+	}
+}
+
+// ProbeStats describes an open-addressing table: how far keys sit from
+// the slot they hash to.
+type ProbeStats struct {
+	Slots    uint64
+	Keys     uint64
+	MaxProbe int
+	AvgProbe float64
+	// Histogram[n] is the number of keys n slots past their home slot
+	Histogram []uint64
+}
+
+func (s *ProbeStats) addProbe(n int) {
+	for len(s.Histogram) <= n {
+		s.Histogram = append(s.Histogram, 0)
+	}
+	s.Histogram[n]++
+	s.MaxProbe = max(s.MaxProbe, n)
+	s.AvgProbe += float64(n)
+	s.Keys++
+}
+
+func (s *ProbeStats) finish() {
+	if s.Keys > 0 {
+		s.AvgProbe /= float64(s.Keys)
+	}
+}
@@ -0,0 +1,56 @@
+package splitordered
+
+import (
+	"bytes"
+	"hash/maphash"
+)
+
+// Hasher hashes and compares the keys of an ExtensibleSet. Keys that are
+// Equal must have the same Hash.
+type Hasher[K any] interface {
+	Hash(key K) uint64
+	Equal(a, b K) bool
+}
+
+// IdentityHasher uses uint64 keys as their own hashes. Keys that differ
+// only in their high bits, such as IDs shifted into place, all land in
+// the same bucket; Mix64Hasher spreads them.
+type IdentityHasher struct{}
+
+func (IdentityHasher) Hash(key uint64) uint64 { return key }
+func (IdentityHasher) Equal(a, b uint64) bool { return a == b }
+
+// Mix64Hasher mixes uint64 keys with splitmix64, so every key bit affects
+// the bucket.
+type Mix64Hasher struct{}
+
+func (Mix64Hasher) Hash(key uint64) uint64 { return mix64(key) }
+func (Mix64Hasher) Equal(a, b uint64) bool { return a == b }
+
+// ComparableHasher hashes any comparable key, such as strings or structs,
+// with hash/maphash and compares keys with ==.
+type ComparableHasher[K comparable] struct {
+	seed maphash.Seed
+}
+
+// NewComparableHasher returns a ComparableHasher with a random seed.
+func NewComparableHasher[K comparable]() ComparableHasher[K] {
+	return ComparableHasher[K]{seed: maphash.MakeSeed()}
+}
+
+func (h ComparableHasher[K]) Hash(key K) uint64 { return maphash.Comparable(h.seed, key) }
+func (ComparableHasher[K]) Equal(a, b K) bool   { return a == b }
+
+// BytesHasher hashes byte slice keys by content. Keys must not be modified
+// while they are in a set.
+type BytesHasher struct {
+	seed maphash.Seed
+}
+
+// NewBytesHasher returns a BytesHasher with a random seed.
+func NewBytesHasher() BytesHasher {
+	return BytesHasher{seed: maphash.MakeSeed()}
+}
+
+func (h BytesHasher) Hash(key []byte) uint64 { return maphash.Bytes(h.seed, key) }
+func (BytesHasher) Equal(a, b []byte) bool   { return bytes.Equal(a, b) }
@@ -0,0 +1,235 @@
+package heap
+
+// Item is a value in a DAry heap, returned by Push to pass to
+// DecreaseKey later.
+type Item[P, V any] struct {
+	Value    V
+	priority P
+	index    int // in h.items; -1 once popped
+	h        *DAry[P, V]
+}
+
+func (it *Item[P, V]) Priority() P { return it.priority }
+
+// DAry is a d-ary min-heap in a slice: each node has d children, so the
+// tree is log_d(n) deep and pushes and DecreaseKey, which sift up, get
+// cheaper as d grows, while pops, which compare d children per level, get
+// dearer. 4 suits most workloads, since the children share a cache line
+// or two. The order is given by less, such as cmp.Less. Not safe for
+// concurrent use.
+type DAry[P, V any] struct {
+	d     int
+	less  func(a, b P) bool
+	items []*Item[P, V]
+}
+
+// NewDAry returns an empty heap of arity d, at least 2, ordered by less.
+func NewDAry[P, V any](d int, less func(a, b P) bool) *DAry[P, V] {
+	return &DAry[P, V]{d: max(d, 2), less: less}
+}
+
+func (h *DAry[P, V]) Len() int { return len(h.items) }
+
+// Push adds value with priority p.
+func (h *DAry[P, V]) Push(value V, p P) *Item[P, V] {
+	it := &Item[P, V]{Value: value, priority: p, index: len(h.items), h: h}
+	h.items = append(h.items, it)
+	h.up(it.index)
+	return it
+}
+
+// Peek returns the item of least priority without removing it.
+func (h *DAry[P, V]) Peek() (*Item[P, V], bool) {
+	if len(h.items) == 0 {
+		return nil, false
+	}
+	return h.items[0], true
+}
+
+// Pop removes and returns the item of least priority.
+func (h *DAry[P, V]) Pop() (*Item[P, V], bool) {
+	if len(h.items) == 0 {
+		return nil, false
+	}
+	top := h.items[0]
+	last := len(h.items) - 1
+	h.swap(0, last)
+	h.items[last] = nil
+	h.items = h.items[:last]
+	if last > 0 {
+		h.down(0)
+	}
+	top.index = -1
+	return top, true
+}
+
+// DecreaseKey lowers the priority of it, still in h, to p, and reports
+// whether it did: not if p is no less than its priority.
+func (h *DAry[P, V]) DecreaseKey(it *Item[P, V], p P) bool {
+	if it.h != h || it.index < 0 || !h.less(p, it.priority) {
+		return false
+	}
+	it.priority = p
+	h.up(it.index)
+	return true
+}
+
+func (h *DAry[P, V]) swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *DAry[P, V]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / h.d
+		if !h.less(h.items[i].priority, h.items[parent].priority) {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+func (h *DAry[P, V]) down(i int) {
+	for {
+		least := i
+		first := i*h.d + 1
+		for c := first; c < first+h.d && c < len(h.items); c++ {
+			if h.less(h.items[c].priority, h.items[least].priority) {
+				least = c
+			}
+		}
+		if least == i {
+			return
+		}
+		h.swap(i, least)
+		i = least
+	}
+}
+
+// Node is a value in a Pairing heap, returned by Push to pass to
+// DecreaseKey later.
+type Node[P, V any] struct {
+	Value    V
+	priority P
+	child    *Node[P, V]
+	sibling  *Node[P, V]
+	// prev is the parent of a first child, else the previous sibling
+	prev *Node[P, V]
+	h    *Pairing[P, V] // nil once popped
+}
+
+func (n *Node[P, V]) Priority() P { return n.priority }
+
+// Pairing is a pairing heap: a tree in which every node's priority is no
+// greater than its children's, kept as child and sibling lists. Push and
+// DecreaseKey only link a node under the root or the root under it, in
+// O(1); Pop pairs the root's children up left to right and then merges the
+// pairs right to left, in amortized O(log n). That makes it the heap of
+// choice when DecreaseKey is frequent, as in Dijkstra's algorithm. The
+// order is given by less. Not safe for concurrent use.
+type Pairing[P, V any] struct {
+	less func(a, b P) bool
+	root *Node[P, V]
+	n    int
+}
+
+func NewPairing[P, V any](less func(a, b P) bool) *Pairing[P, V] {
+	return &Pairing[P, V]{less: less}
+}
+
+func (h *Pairing[P, V]) Len() int { return h.n }
+
+// meld links the roots a and b, either may be nil, and returns the root of
+// the result.
+func (h *Pairing[P, V]) meld(a, b *Node[P, V]) *Node[P, V] {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if h.less(b.priority, a.priority) {
+		a, b = b, a
+	}
+	// b becomes the first child of a
+	b.prev = a
+	b.sibling = a.child
+	if a.child != nil {
+		a.child.prev = b
+	}
+	a.child = b
+	a.sibling, a.prev = nil, nil
+	return a
+}
+
+// Push adds value with priority p.
+func (h *Pairing[P, V]) Push(value V, p P) *Node[P, V] {
+	n := &Node[P, V]{Value: value, priority: p, h: h}
+	h.root = h.meld(h.root, n)
+	h.n++
+	return n
+}
+
+// Peek returns the node of least priority without removing it.
+func (h *Pairing[P, V]) Peek() (*Node[P, V], bool) {
+	return h.root, h.root != nil
+}
+
+// Pop removes and returns the node of least priority.
+func (h *Pairing[P, V]) Pop() (*Node[P, V], bool) {
+	top := h.root
+	if top == nil {
+		return nil, false
+	}
+	h.root = h.mergePairs(top.child)
+	top.child, top.h = nil, nil
+	h.n--
+	return top, true
+}
+
+// mergePairs merges the sibling list starting at first into one tree.
+func (h *Pairing[P, V]) mergePairs(first *Node[P, V]) *Node[P, V] {
+	var pairs []*Node[P, V]
+	for a := first; a != nil; {
+		b := a.sibling
+		var next *Node[P, V]
+		if b != nil {
+			next = b.sibling
+			b.sibling, b.prev = nil, nil
+		}
+		a.sibling, a.prev = nil, nil
+		pairs = append(pairs, h.meld(a, b))
+		a = next
+	}
+	var root *Node[P, V]
+	for i := len(pairs) - 1; i >= 0; i-- {
+		root = h.meld(pairs[i], root)
+	}
+	return root
+}
+
+// DecreaseKey lowers the priority of n, still in h, to p, and reports
+// whether it did: not if p is no less than its priority.
+func (h *Pairing[P, V]) DecreaseKey(n *Node[P, V], p P) bool {
+	if n.h != h || !h.less(p, n.priority) {
+		return false
+	}
+	n.priority = p
+	if n == h.root {
+		return true
+	}
+	// Cut n and its subtree out of its sibling list and meld it back in
+	if n.prev.child == n {
+		n.prev.child = n.sibling
+	} else {
+		n.prev.sibling = n.sibling
+	}
+	if n.sibling != nil {
+		n.sibling.prev = n.prev
+	}
+	n.sibling, n.prev = nil, nil
+	h.root = h.meld(h.root, n)
+	return true
+}
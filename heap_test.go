@@ -0,0 +1,237 @@
+package heap
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"testing"
+)
+
+// minHeap is what the tests need of both heaps; handles are the items or
+// nodes Push returns.
+type minHeap struct {
+	name     string
+	push     func(v, p int) any
+	pop      func() (v, p int, ok bool)
+	peek     func() (v, p int, ok bool)
+	decrease func(handle any, p int) bool
+	len      func() int
+}
+
+func dary(d int) minHeap {
+	h := NewDAry[int, int](d, cmp.Less[int])
+	unpack := func(it *Item[int, int], ok bool) (int, int, bool) {
+		if !ok {
+			return 0, 0, false
+		}
+		return it.Value, it.Priority(), true
+	}
+	return minHeap{
+		name:     "DAry",
+		push:     func(v, p int) any { return h.Push(v, p) },
+		pop:      func() (int, int, bool) { return unpack(h.Pop()) },
+		peek:     func() (int, int, bool) { return unpack(h.Peek()) },
+		decrease: func(it any, p int) bool { return h.DecreaseKey(it.(*Item[int, int]), p) },
+		len:      h.Len,
+	}
+}
+
+func pairing() minHeap {
+	h := NewPairing[int, int](cmp.Less[int])
+	unpack := func(n *Node[int, int], ok bool) (int, int, bool) {
+		if !ok {
+			return 0, 0, false
+		}
+		return n.Value, n.Priority(), true
+	}
+	return minHeap{
+		name:     "Pairing",
+		push:     func(v, p int) any { return h.Push(v, p) },
+		pop:      func() (int, int, bool) { return unpack(h.Pop()) },
+		peek:     func() (int, int, bool) { return unpack(h.Peek()) },
+		decrease: func(n any, p int) bool { return h.DecreaseKey(n.(*Node[int, int]), p) },
+		len:      h.Len,
+	}
+}
+
+func heaps() []minHeap {
+	return []minHeap{dary(2), dary(3), dary(4), dary(8), pairing()}
+}
+
+func TestAgainstReference(t *testing.T) {
+	for _, h := range heaps() {
+		r := rand.New(rand.NewPCG(1, 1))
+		// The values in the heap, by value, with their priorities
+		live := make(map[int]int)
+		handles := make(map[int]any)
+		next := 0
+		for range 50000 {
+			switch op := r.IntN(10); {
+			case op < 5:
+				p := r.IntN(100000)
+				handles[next] = h.push(next, p)
+				live[next] = p
+				next++
+			case op < 8:
+				v, p, ok := h.pop()
+				if ok != (len(live) > 0) {
+					t.Fatalf("%s: Pop ok %v with %d values in", h.name, ok, len(live))
+				}
+				if !ok {
+					continue
+				}
+				if live[v] != p {
+					t.Fatalf("%s: Pop = %d of priority %d, pushed with %d", h.name, v, p, live[v])
+				}
+				// Draining below checks the order too, so this slow check
+				// need only be made now and then
+				if len(live)%50 == 0 {
+					for w, q := range live {
+						if q < p {
+							t.Fatalf("%s: Pop = priority %d, but %d has %d", h.name, p, w, q)
+						}
+					}
+				}
+				delete(live, v)
+				// A popped value's handle no longer decreases
+				if h.decrease(handles[v], p-1) {
+					t.Fatalf("%s: DecreaseKey of popped value %d succeeded", h.name, v)
+				}
+			default:
+				if len(live) == 0 {
+					continue
+				}
+				v := r.IntN(next)
+				p, in := live[v]
+				if !in {
+					continue
+				}
+				np := p - r.IntN(50000) + 10000
+				if got := h.decrease(handles[v], np); got != (np < p) {
+					t.Fatalf("%s: DecreaseKey(%d, %d from %d) = %v", h.name, v, np, p, got)
+				}
+				live[v] = min(p, np)
+			}
+			if h.len() != len(live) {
+				t.Fatalf("%s: Len = %d, want %d", h.name, h.len(), len(live))
+			}
+		}
+
+		// Draining gives the priorities in order
+		prev := -1 << 62
+		for h.len() > 0 {
+			_, pp, _ := h.peek()
+			_, p, _ := h.pop()
+			if p != pp || p < prev {
+				t.Fatalf("%s: Pop = %d after %d, Peek said %d", h.name, p, prev, pp)
+			}
+			prev = p
+		}
+		if _, _, ok := h.peek(); ok {
+			t.Errorf("%s: Peek of an empty heap succeeded", h.name)
+		}
+	}
+}
+
+func TestDecreaseKeyToRoot(t *testing.T) {
+	for _, h := range heaps() {
+		var handles []any
+		for i := range 100 {
+			handles = append(handles, h.push(i, 100+i))
+		}
+		// The deepest value becomes the least, and the root's own
+		// priority drops in place
+		if !h.decrease(handles[99], 0) {
+			t.Fatalf("%s: DecreaseKey failed", h.name)
+		}
+		if v, p, _ := h.peek(); v != 99 || p != 0 {
+			t.Errorf("%s: Peek = %d of %d, want 99 of 0", h.name, v, p)
+		}
+		if !h.decrease(handles[99], -1) || h.decrease(handles[99], -1) {
+			t.Errorf("%s: DecreaseKey of the root to -1 twice did not succeed once", h.name)
+		}
+		if v, _, _ := h.pop(); v != 99 {
+			t.Errorf("%s: Pop = %d, want 99", h.name, v)
+		}
+		if v, _, _ := h.pop(); v != 0 {
+			t.Errorf("%s: Pop = %d, want 0", h.name, v)
+		}
+	}
+}
+
+func TestForeignHandles(t *testing.T) {
+	a, b := NewDAry[int, string](4, cmp.Less[int]), NewDAry[int, string](4, cmp.Less[int])
+	it := a.Push("x", 5)
+	if b.DecreaseKey(it, 1) || it.Priority() != 5 {
+		t.Error("DecreaseKey through another DAry succeeded")
+	}
+	pa, pb := NewPairing[int, string](cmp.Less[int]), NewPairing[int, string](cmp.Less[int])
+	n := pa.Push("x", 5)
+	pb.Push("y", 9)
+	if pb.DecreaseKey(n, 1) || n.Priority() != 5 {
+		t.Error("DecreaseKey through another Pairing succeeded")
+	}
+	if NewDAry[int, int](0, cmp.Less[int]).d != 2 {
+		t.Error("arity below 2 not raised to 2")
+	}
+}
+
+// dijkstra returns the distances from node 0 of a graph of weighted edges,
+// with DecreaseKey as the relaxation step.
+func dijkstra(h minHeap, n int, edges [][][2]int) []int {
+	const inf = 1 << 62
+	dist := make([]int, n)
+	handles := make([]any, n)
+	for i := range dist {
+		dist[i] = inf
+		handles[i] = h.push(i, inf)
+	}
+	dist[0] = 0
+	h.decrease(handles[0], 0)
+	done := make([]bool, n)
+	for h.len() > 0 {
+		u, d, _ := h.pop()
+		done[u] = true
+		for _, e := range edges[u] {
+			if v := e[0]; !done[v] && d+e[1] < dist[v] {
+				dist[v] = d + e[1]
+				h.decrease(handles[v], dist[v])
+			}
+		}
+	}
+	return dist
+}
+
+func TestDijkstra(t *testing.T) {
+	const n = 500
+	r := rand.New(rand.NewPCG(2, 2))
+	edges := make([][][2]int, n)
+	for range 5000 {
+		u, v, w := r.IntN(n), r.IntN(n), 1+r.IntN(100)
+		edges[u] = append(edges[u], [2]int{v, w})
+	}
+	// Bellman-Ford for the answer
+	want := make([]int, n)
+	for i := range want {
+		want[i] = 1 << 62
+	}
+	want[0] = 0
+	for changed := true; changed; {
+		changed = false
+		for u := range edges {
+			for _, e := range edges[u] {
+				if want[u]+e[1] < want[e[0]] {
+					want[e[0]] = want[u] + e[1]
+					changed = true
+				}
+			}
+		}
+	}
+	for _, h := range heaps() {
+		got := dijkstra(h, n, edges)
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s: distance to %d = %d, want %d", h.name, i, got[i], want[i])
+			}
+		}
+	}
+}
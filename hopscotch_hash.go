@@ -0,0 +1,206 @@
+package splitordered
+
+import (
+	"iter"
+	"math/bits"
+	"sync"
+)
+
+const (
+	hopRange = 32 // neighborhood size: a key lives within this many slots of its home
+	// How far past home an insert looks for a free slot before growing
+	hopAddRange   = 512
+	hopMaxLoad    = 0.9
+	hopMinBuckets = 64
+)
+
+// HopscotchHash is a hopscotch hashing table of uint64 keys. Every key is
+// kept within hopRange slots of its home slot, and each home slot has a
+// bitmap of which of those slots hold its keys, so a lookup reads one
+// bitmap and at most a cache line or two of keys. An insert takes the
+// nearest free slot and, while it is too far from home, swaps it backwards
+// with keys that may move forward without leaving their own neighborhood.
+// Keys are mixed with splitmix64.
+type HopscotchHash struct {
+	mu      sync.RWMutex
+	keys    []uint64
+	used    []bool
+	hop     []uint32 // hop[i] bit d: slot i+d holds a key whose home is i
+	count   uint64
+	resizes uint64
+}
+
+func NewHopscotchHash() *HopscotchHash {
+	hh := &HopscotchHash{}
+	hh.allocate(hopMinBuckets)
+	return hh
+}
+
+func (hh *HopscotchHash) allocate(n int) {
+	hh.keys = make([]uint64, n)
+	hh.used = make([]bool, n)
+	hh.hop = make([]uint32, n)
+}
+
+func (hh *HopscotchHash) home(key uint64) int {
+	return int(mix64(key) & uint64(len(hh.keys)-1))
+}
+
+// slot returns the index of key, or -1.
+func (hh *HopscotchHash) slot(key uint64) int {
+	home := hh.home(key)
+	mask := len(hh.keys) - 1
+	for hop := hh.hop[home]; hop != 0; hop &= hop - 1 {
+		i := (home + bits.TrailingZeros32(hop)) & mask
+		if hh.keys[i] == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (hh *HopscotchHash) Insert(key uint64) bool {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if hh.slot(key) >= 0 {
+		return false
+	}
+	if float64(hh.count+1) > hopMaxLoad*float64(len(hh.keys)) {
+		hh.grow()
+	}
+	for !hh.place(key) {
+		hh.grow()
+	}
+	hh.count++
+	return true
+}
+
+// place stores key in its neighborhood, or reports that the table must
+// grow first.
+func (hh *HopscotchHash) place(key uint64) bool {
+	n := len(hh.keys)
+	mask := n - 1
+	home := hh.home(key)
+
+	// The nearest free slot, as a distance from home
+	dist := 0
+	for ; dist < hopAddRange && dist < n; dist++ {
+		if !hh.used[(home+dist)&mask] {
+			break
+		}
+	}
+	if dist == hopAddRange || dist == n {
+		return false
+	}
+
+	// Hop the free slot back towards home
+	for dist >= hopRange {
+		free := (home + dist) & mask
+		moved := false
+		// The farthest-back key that can take the free slot
+		for back := hopRange - 1; back > 0 && !moved; back-- {
+			base := (free - back) & mask
+			hop := hh.hop[base]
+			if hop == 0 {
+				continue
+			}
+			// Its first key before the free slot
+			d := bits.TrailingZeros32(hop)
+			if d >= back {
+				continue
+			}
+			from := (base + d) & mask
+			hh.keys[free], hh.used[free] = hh.keys[from], true
+			hh.used[from] = false
+			hh.hop[base] = hop&^(1<<d) | 1<<back
+			dist -= back - d
+			moved = true
+		}
+		if !moved {
+			return false
+		}
+	}
+
+	i := (home + dist) & mask
+	hh.keys[i], hh.used[i] = key, true
+	hh.hop[home] |= 1 << dist
+	return true
+}
+
+// grow doubles the table and reinserts every key.
+func (hh *HopscotchHash) grow() {
+	keys, used := hh.keys, hh.used
+	n := 2 * len(keys)
+	for {
+		hh.allocate(n)
+		ok := true
+		for i, k := range keys {
+			if used[i] && !hh.place(k) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			break
+		}
+		n *= 2
+	}
+	hh.resizes++
+}
+
+func (hh *HopscotchHash) Find(key uint64) bool {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+	return hh.slot(key) >= 0
+}
+
+func (hh *HopscotchHash) Delete(key uint64) bool {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	i := hh.slot(key)
+	if i < 0 {
+		return false
+	}
+	home := hh.home(key)
+	hh.used[i] = false
+	hh.hop[home] &^= 1 << ((i - home) & (len(hh.keys) - 1))
+	hh.count--
+	return true
+}
+
+// Keys returns an iterator over the keys in slot order. The keys are
+// gathered before the first is yielded, so the loop body may modify the
+// table.
+func (hh *HopscotchHash) Keys() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		hh.mu.RLock()
+		keys := make([]uint64, 0, hh.count)
+		for i, k := range hh.keys {
+			if hh.used[i] {
+				keys = append(keys, k)
+			}
+		}
+		hh.mu.RUnlock()
+
+		for _, key := range keys {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (hh *HopscotchHash) Count() uint64 {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+	return hh.count
+}
+
+// Resizes returns how many times the table has grown.
+func (hh *HopscotchHash) Resizes() uint64 {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+	return hh.resizes
+}
@@ -0,0 +1,181 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// relErr returns the relative error of estimate against n.
+func relErr(estimate uint64, n int) float64 {
+	return math.Abs(float64(estimate)-float64(n)) / float64(n)
+}
+
+func TestAccuracy(t *testing.T) {
+	for _, p := range []uint8{MinPrecision, 10, 14} {
+		// Four standard errors, which a fixed hash passes or fails for good
+		bound := 4 * 1.04 / math.Sqrt(float64(uint64(1)<<p))
+		for _, n := range []int{10, 1000, 100000} {
+			h, err := New(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range n {
+				h.AddUint64(uint64(i))
+				h.AddUint64(uint64(i)) // repeats count once
+			}
+			if e := relErr(h.Count(), n); e > bound {
+				t.Errorf("precision %d, %d keys: estimate %d, error %.3f above %.3f", p, n, h.Count(), e, bound)
+			}
+		}
+	}
+
+	// While sparse the estimate is close to exact
+	h, _ := New(14)
+	for i := range 1000 {
+		h.Add([]byte(strings.Repeat("k", i%7) + string(rune(i))))
+	}
+	if !h.Sparse() || h.Count() < 995 || h.Count() > 1005 {
+		t.Errorf("sparse sketch of 1000 keys: estimate %d, sparse %v", h.Count(), h.Sparse())
+	}
+}
+
+func TestSparseThreshold(t *testing.T) {
+	h, _ := New(12)
+	keys := 0
+	for h.Sparse() {
+		h.AddUint64(uint64(keys))
+		keys++
+	}
+	// The map stays smaller than the dense array it stands in for, so
+	// it turns dense on the key that takes it past 2^p/sparseEntryBytes
+	// registers; at precision 25 the first hundreds of keys rarely share one
+	if limit := 1 << 12 / sparseEntryBytes; keys != limit+1 {
+		t.Errorf("turned dense after %d keys, want %d", keys, limit+1)
+	}
+	if n := len(h.dense); n != 1<<12 {
+		t.Fatalf("dense array of %d registers", n)
+	}
+	// The switch keeps the estimate
+	if e := relErr(h.Count(), keys); e > 0.1 {
+		t.Errorf("estimate %d after the switch at %d keys", h.Count(), keys)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	// Sketches merged in each combination of forms count their union
+	for _, tc := range []struct {
+		name   string
+		na, nb int
+	}{
+		{"sparse into sparse", 100, 100},
+		{"sparse into dense", 50000, 100},
+		{"dense into sparse", 100, 50000},
+		{"dense into dense", 50000, 50000},
+		{"sparse into sparse, overflowing", 300, 300},
+	} {
+		a, _ := New(12)
+		b, _ := New(12)
+		union, _ := New(12)
+		for i := range tc.na {
+			a.AddUint64(uint64(i))
+			union.AddUint64(uint64(i))
+		}
+		// b overlaps a by half
+		for i := range tc.nb {
+			k := uint64(tc.na/2 + i)
+			b.AddUint64(k)
+			union.AddUint64(k)
+		}
+		if err := a.Merge(b); err != nil {
+			t.Fatal(err)
+		}
+		// Registers merge by maximum, so the result is the union's own
+		if a.Count() != union.Count() || a.Sparse() != union.Sparse() {
+			t.Errorf("%s: merged estimate %d, sparse %v; union's %d, %v", tc.name,
+				a.Count(), a.Sparse(), union.Count(), union.Sparse())
+		}
+		if want := max(tc.na, tc.na/2+tc.nb); relErr(a.Count(), want) > 4*1.04/64 {
+			t.Errorf("%s: merged estimate %d, want about %d", tc.name, a.Count(), want)
+		}
+	}
+
+	a, _ := New(12)
+	b, _ := New(13)
+	if err := a.Merge(b); err != ErrPrecisionMismatch {
+		t.Errorf("merge across precisions: %v", err)
+	}
+	a.AddUint64(1)
+	if err := a.Merge(a); err != nil || a.Count() != 1 {
+		t.Errorf("self-merge: %v, count %d", err, a.Count())
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	for _, n := range []int{0, 100, 100000} {
+		h, _ := New(11)
+		for i := range n {
+			h.AddUint64(uint64(i) * 3)
+		}
+		var b bytes.Buffer
+		if err := h.Save(&b); err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString("trailer")
+		got, err := Load(&b)
+		if err != nil {
+			t.Fatalf("%d keys: %v", n, err)
+		}
+		if got.Precision() != 11 || got.Sparse() != h.Sparse() || got.Count() != h.Count() {
+			t.Errorf("%d keys: loaded sketch of precision %d, sparse %v, count %d; saved %d, %v, %d",
+				n, got.Precision(), got.Sparse(), got.Count(), h.Precision(), h.Sparse(), h.Count())
+		}
+		// Load stops at the sketch's end
+		if b.String() != "trailer" {
+			t.Errorf("%d keys: Load left %q", n, b.String())
+		}
+		// The loaded sketch goes on counting
+		got.AddUint64(1)
+		h.AddUint64(1)
+		if got.Count() != h.Count() {
+			t.Errorf("%d keys: loaded sketch counts %d after an add, saved one %d", n, got.Count(), h.Count())
+		}
+	}
+
+	h, _ := New(8)
+	h.AddUint64(42)
+	var b bytes.Buffer
+	h.Save(&b)
+	good := b.Bytes()
+	for _, bad := range [][]byte{
+		nil,
+		good[:len(good)-1],
+		append([]byte("XLL1"), good[4:]...),
+		append(append([]byte(nil), good[:4]...), append([]byte{30}, good[5:]...)...),
+		append(append([]byte(nil), good[:len(good)-1]...), good[len(good)-1]^1),
+	} {
+		if _, err := Load(bytes.NewReader(bad)); err == nil {
+			t.Errorf("Load of %x succeeded", bad)
+		}
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	h, _ := New(12)
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 10000 {
+				h.AddUint64(uint64(w*10000 + i))
+			}
+		}()
+	}
+	wg.Wait()
+	if e := relErr(h.Count(), 80000); e > 4*1.04/64 {
+		t.Errorf("estimate %d of 80000", h.Count())
+	}
+}
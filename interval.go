@@ -0,0 +1,241 @@
+package interval
+
+import (
+	"cmp"
+	"iter"
+	"sync"
+)
+
+// Interval is the closed range from Lo to Hi.
+type Interval[K cmp.Ordered] struct {
+	Lo, Hi K
+}
+
+// Overlaps reports whether i and o share any point.
+func (i Interval[K]) Overlaps(o Interval[K]) bool {
+	return i.Lo <= o.Hi && o.Lo <= i.Hi
+}
+
+func (i Interval[K]) compare(o Interval[K]) int {
+	if c := cmp.Compare(i.Lo, o.Lo); c != 0 {
+		return c
+	}
+	return cmp.Compare(i.Hi, o.Hi)
+}
+
+type node[K cmp.Ordered, V comparable] struct {
+	iv          Interval[K]
+	value       V
+	left, right *node[K, V]
+	height      int
+	// max is the greatest Hi in the subtree
+	max K
+}
+
+func height[K cmp.Ordered, V comparable](n *node[K, V]) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// update recomputes the height and max of n from its children.
+func (n *node[K, V]) update() {
+	n.height = 1 + max(height(n.left), height(n.right))
+	n.max = n.iv.Hi
+	if n.left != nil {
+		n.max = max(n.max, n.left.max)
+	}
+	if n.right != nil {
+		n.max = max(n.max, n.right.max)
+	}
+}
+
+func (n *node[K, V]) rotateLeft() *node[K, V] {
+	r := n.right
+	n.right, r.left = r.left, n
+	n.update()
+	r.update()
+	return r
+}
+
+func (n *node[K, V]) rotateRight() *node[K, V] {
+	l := n.left
+	n.left, l.right = l.right, n
+	n.update()
+	l.update()
+	return l
+}
+
+// balance restores the AVL balance of n, whose children are balanced and
+// differ in height by at most two, and returns the subtree's new root.
+func (n *node[K, V]) balance() *node[K, V] {
+	n.update()
+	switch d := height(n.left) - height(n.right); {
+	case d > 1:
+		if height(n.left.left) < height(n.left.right) {
+			n.left = n.left.rotateLeft()
+		}
+		return n.rotateRight()
+	case d < -1:
+		if height(n.right.right) < height(n.right.left) {
+			n.right = n.right.rotateRight()
+		}
+		return n.rotateLeft()
+	}
+	return n
+}
+
+// Tree is an interval tree: an AVL tree of intervals ordered by their low
+// end, each node also holding the greatest high end in its subtree. A
+// query skips every subtree whose greatest high end is below the start
+// of the range, and every right subtree once the low ends pass its end,
+// so it runs in O(log n + matches). The same interval may hold several
+// values. Safe for concurrent use.
+type Tree[K cmp.Ordered, V comparable] struct {
+	mu   sync.RWMutex
+	root *node[K, V]
+	size int
+}
+
+func New[K cmp.Ordered, V comparable]() *Tree[K, V] {
+	return &Tree[K, V]{}
+}
+
+func (t *Tree[K, V]) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// Insert adds value over iv. The ends are swapped if Lo is above Hi.
+func (t *Tree[K, V]) Insert(iv Interval[K], value V) {
+	if iv.Lo > iv.Hi {
+		iv.Lo, iv.Hi = iv.Hi, iv.Lo
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.root = insert(t.root, &node[K, V]{iv: iv, value: value})
+	t.size++
+}
+
+func insert[K cmp.Ordered, V comparable](n, x *node[K, V]) *node[K, V] {
+	if n == nil {
+		x.update()
+		return x
+	}
+	// Equal intervals go right, after those already there
+	if x.iv.compare(n.iv) < 0 {
+		n.left = insert(n.left, x)
+	} else {
+		n.right = insert(n.right, x)
+	}
+	return n.balance()
+}
+
+// Delete removes one entry of value over iv, and reports whether there
+// was one.
+func (t *Tree[K, V]) Delete(iv Interval[K], value V) bool {
+	if iv.Lo > iv.Hi {
+		iv.Lo, iv.Hi = iv.Hi, iv.Lo
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ok bool
+	t.root, ok = remove(t.root, iv, value)
+	if ok {
+		t.size--
+	}
+	return ok
+}
+
+func remove[K cmp.Ordered, V comparable](n *node[K, V], iv Interval[K], value V) (*node[K, V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	var ok bool
+	switch c := iv.compare(n.iv); {
+	case c < 0:
+		n.left, ok = remove(n.left, iv, value)
+	case c > 0:
+		n.right, ok = remove(n.right, iv, value)
+	case n.value == value:
+		if n.left == nil {
+			return n.right, true
+		}
+		if n.right == nil {
+			return n.left, true
+		}
+		// Put the next node in n's place
+		var next *node[K, V]
+		n.right, next = removeMin(n.right)
+		next.left, next.right = n.left, n.right
+		return next.balance(), true
+	default:
+		// Equal intervals with other values may lie either side
+		if n.left, ok = remove(n.left, iv, value); !ok {
+			n.right, ok = remove(n.right, iv, value)
+		}
+	}
+	if !ok {
+		return n, false
+	}
+	return n.balance(), true
+}
+
+// removeMin detaches the leftmost node of n, returning the subtree left
+// and that node.
+func removeMin[K cmp.Ordered, V comparable](n *node[K, V]) (*node[K, V], *node[K, V]) {
+	if n.left == nil {
+		return n.right, n
+	}
+	var first *node[K, V]
+	n.left, first = removeMin(n.left)
+	return n.balance(), first
+}
+
+// Stab returns an iterator over the intervals containing point and their
+// values, by low end. They are gathered before the first is yielded, so
+// the loop body may modify the tree.
+func (t *Tree[K, V]) Stab(point K) iter.Seq2[Interval[K], V] {
+	return t.Overlaps(Interval[K]{point, point})
+}
+
+// Overlaps returns an iterator over the intervals sharing any point with
+// r and their values, by low end, gathered like Stab.
+func (t *Tree[K, V]) Overlaps(r Interval[K]) iter.Seq2[Interval[K], V] {
+	if r.Lo > r.Hi {
+		r.Lo, r.Hi = r.Hi, r.Lo
+	}
+	return func(yield func(Interval[K], V) bool) {
+		type entry struct {
+			iv    Interval[K]
+			value V
+		}
+		t.mu.RLock()
+		var found []entry
+		var search func(n *node[K, V])
+		search = func(n *node[K, V]) {
+			if n == nil || n.max < r.Lo {
+				return
+			}
+			search(n.left)
+			if n.iv.Lo > r.Hi {
+				return
+			}
+			if n.iv.Overlaps(r) {
+				found = append(found, entry{n.iv, n.value})
+			}
+			search(n.right)
+		}
+		search(t.root)
+		t.mu.RUnlock()
+
+		for _, e := range found {
+			if !yield(e.iv, e.value) {
+				return
+			}
+		}
+	}
+}
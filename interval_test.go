@@ -0,0 +1,218 @@
+package interval
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// check checks the AVL balance, order, heights and maxima of the tree,
+// and returns its size.
+func check[K int | float64, V comparable](t *testing.T, tr *Tree[K, V]) int {
+	t.Helper()
+	var walk func(n *node[K, V]) int
+	walk = func(n *node[K, V]) int {
+		if n == nil {
+			return 0
+		}
+		size := 1 + walk(n.left) + walk(n.right)
+		if d := height(n.left) - height(n.right); d < -1 || d > 1 {
+			t.Fatalf("node %v out of balance by %d", n.iv, d)
+		}
+		if n.height != 1+max(height(n.left), height(n.right)) {
+			t.Fatalf("node %v has height %d", n.iv, n.height)
+		}
+		want := n.iv.Hi
+		for _, c := range []*node[K, V]{n.left, n.right} {
+			if c != nil {
+				want = max(want, c.max)
+			}
+		}
+		if n.max != want {
+			t.Fatalf("node %v has max %v, want %v", n.iv, n.max, want)
+		}
+		if n.left != nil && n.left.iv.compare(n.iv) > 0 || n.right != nil && n.right.iv.compare(n.iv) < 0 {
+			t.Fatalf("node %v out of order with its children", n.iv)
+		}
+		return size
+	}
+	return walk(tr.root)
+}
+
+type ivValue struct {
+	iv    Interval[int]
+	value int
+}
+
+func randomInterval(r *rand.Rand) Interval[int] {
+	lo := r.IntN(1000)
+	return Interval[int]{lo, lo + r.IntN(50)}
+}
+
+func TestAgainstList(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	tr := New[int, int]()
+	var live []ivValue
+	for i := range 20000 {
+		if len(live) == 0 || r.IntN(3) < 2 {
+			// Reuse intervals often, so some hold several values
+			iv := randomInterval(r)
+			if len(live) > 0 && r.IntN(4) == 0 {
+				iv = live[r.IntN(len(live))].iv
+			}
+			tr.Insert(iv, i%7)
+			live = append(live, ivValue{iv, i % 7})
+		} else {
+			j := r.IntN(len(live))
+			if !tr.Delete(live[j].iv, live[j].value) {
+				t.Fatalf("Delete(%v, %d) found nothing", live[j].iv, live[j].value)
+			}
+			live[j] = live[len(live)-1]
+			live = live[:len(live)-1]
+		}
+		if i%500 == 0 {
+			if n := check(t, tr); n != len(live) {
+				t.Fatalf("tree of %d nodes, want %d", n, len(live))
+			}
+		}
+	}
+	if tr.Len() != len(live) {
+		t.Errorf("Len = %d, want %d", tr.Len(), len(live))
+	}
+	if tr.Delete(Interval[int]{5, 4000}, 0) {
+		t.Error("Delete of an interval never inserted succeeded")
+	}
+
+	for range 300 {
+		q := randomInterval(r)
+		if r.IntN(3) == 0 {
+			q.Hi = q.Lo
+		}
+		var want []ivValue
+		for _, e := range live {
+			if e.iv.Overlaps(q) {
+				want = append(want, e)
+			}
+		}
+		var got []ivValue
+		for iv, v := range tr.Overlaps(q) {
+			got = append(got, ivValue{iv, v})
+		}
+		if !slices.IsSortedFunc(got, func(a, b ivValue) int { return a.iv.compare(b.iv) }) {
+			t.Fatalf("Overlaps(%v) out of order", q)
+		}
+		sortIV := func(s []ivValue) {
+			slices.SortFunc(s, func(a, b ivValue) int {
+				if c := a.iv.compare(b.iv); c != 0 {
+					return c
+				}
+				return a.value - b.value
+			})
+		}
+		sortIV(got)
+		sortIV(want)
+		if !slices.Equal(got, want) {
+			t.Fatalf("Overlaps(%v) = %d intervals, want %d", q, len(got), len(want))
+		}
+	}
+}
+
+func TestStab(t *testing.T) {
+	tr := New[float64, string]()
+	tr.Insert(Interval[float64]{1, 5}, "a")
+	tr.Insert(Interval[float64]{5, 3}, "b") // reversed
+	tr.Insert(Interval[float64]{6, 9}, "c")
+	tr.Insert(Interval[float64]{2.5, 2.5}, "d")
+	for _, tc := range []struct {
+		point float64
+		want  []string
+	}{
+		{0, nil},
+		{1, []string{"a"}},
+		{2.5, []string{"a", "d"}},
+		{3, []string{"a", "b"}},
+		{5, []string{"a", "b"}}, // ends are closed
+		{5.5, nil},
+		{9, []string{"c"}},
+	} {
+		var got []string
+		for _, v := range tr.Stab(tc.point) {
+			got = append(got, v)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Stab(%g) = %q, want %q", tc.point, got, tc.want)
+		}
+	}
+
+	// A reversed range is swapped too, and Delete takes it either way
+	var got []string
+	for _, v := range tr.Overlaps(Interval[float64]{5.5, 2}) {
+		got = append(got, v)
+	}
+	if !slices.Equal(got, []string{"a", "d", "b"}) {
+		t.Errorf("Overlaps of a reversed range = %q", got)
+	}
+	if !tr.Delete(Interval[float64]{3, 5}, "b") || tr.Len() != 3 {
+		t.Errorf("Delete of the swapped interval failed, Len %d", tr.Len())
+	}
+
+	// The loop body may modify the tree, and breaking stops the scan
+	n := 0
+	for iv, v := range tr.Overlaps(Interval[float64]{0, 10}) {
+		tr.Delete(iv, v)
+		if n++; n == 2 {
+			break
+		}
+	}
+	if tr.Len() != 1 {
+		t.Errorf("Len after deleting 2 in a scan = %d, want 1", tr.Len())
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tr := New[int, int]()
+	iv := Interval[int]{10, 20}
+	for i := range 100 {
+		tr.Insert(iv, i%3)
+	}
+	check(t, tr)
+	// Each value comes out wherever rotations have moved its copies
+	for i := range 100 {
+		if !tr.Delete(iv, i%3) {
+			t.Fatalf("Delete %d of value %d failed", i, i%3)
+		}
+	}
+	if tr.Len() != 0 || tr.root != nil || tr.Delete(iv, 0) {
+		t.Errorf("emptied tree: Len %d", tr.Len())
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	tr := New[int, int]()
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range 2000 {
+				iv := Interval[int]{i, i + w}
+				tr.Insert(iv, w)
+				if i%2 == 1 {
+					tr.Delete(iv, w)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				for range tr.Stab(i * 10) {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := check(t, tr); n != 4000 || tr.Len() != 4000 {
+		t.Errorf("tree of %d nodes, Len %d, want 4000", n, tr.Len())
+	}
+}
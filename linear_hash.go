@@ -0,0 +1,178 @@
+package splitordered
+
+import (
+	"iter"
+	"sync"
+)
+
+const (
+	lhInitialBuckets = 2
+	// A bucket is split once the table holds more than this many keys per
+	// bucket on average, and the last one merged back below lhMergeLoad
+	lhSplitLoad = maxBucketSize * 3 / 4
+	lhMergeLoad = maxBucketSize / 4
+)
+
+// LinearHash is a linear hash table of uint64 keys, using the keys as their
+// own hashes like ExtensibleHash. Instead of a directory it grows one
+// bucket at a time: the buckets are split round-robin in address order,
+// next marking the first not yet split in the current round, whatever
+// bucket overflowed. Keys go to bucket h mod 2^level*lhInitialBuckets, or
+// to h mod twice that if that bucket has already been split this round.
+// Buckets hold more than maxBucketSize keys until their turn comes.
+type LinearHash struct {
+	mu      sync.RWMutex
+	buckets [][]uint64
+	level   uint8
+	next    uint64
+	count   uint64
+	resizes uint64
+}
+
+func NewLinearHash() *LinearHash {
+	return &LinearHash{buckets: make([][]uint64, lhInitialBuckets)}
+}
+
+// bucket returns the address of hash h.
+func (lh *LinearHash) bucket(h uint64) uint64 {
+	n := uint64(lhInitialBuckets) << lh.level
+	if b := h % n; b >= lh.next {
+		return b
+	}
+	return h % (2 * n)
+}
+
+func (lh *LinearHash) Insert(key uint64) bool {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	b := lh.bucket(key)
+	for _, item := range lh.buckets[b] {
+		if item == key {
+			return false
+		}
+	}
+	lh.buckets[b] = append(lh.buckets[b], key)
+	lh.count++
+	if lh.count > uint64(len(lh.buckets))*lhSplitLoad {
+		lh.split()
+	}
+	return true
+}
+
+func (lh *LinearHash) Find(key uint64) bool {
+	lh.mu.RLock()
+	defer lh.mu.RUnlock()
+
+	for _, item := range lh.buckets[lh.bucket(key)] {
+		if item == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (lh *LinearHash) Delete(key uint64) bool {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	b := lh.bucket(key)
+	items := lh.buckets[b]
+	for i, item := range items {
+		if item == key {
+			// Remove item by swapping with last element and truncating
+			items[i] = items[len(items)-1]
+			lh.buckets[b] = items[:len(items)-1]
+			lh.count--
+			if len(lh.buckets) > lhInitialBuckets && lh.count < uint64(len(lh.buckets))*lhMergeLoad {
+				lh.merge()
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// split splits bucket next into itself and a new last bucket, its image
+// one round size further on, then moves next on.
+func (lh *LinearHash) split() {
+	n := uint64(lhInitialBuckets) << lh.level
+	var kept, moved []uint64
+	for _, item := range lh.buckets[lh.next] {
+		if item%(2*n) == lh.next {
+			kept = append(kept, item)
+		} else {
+			moved = append(moved, item)
+		}
+	}
+	lh.buckets[lh.next] = kept
+	lh.buckets = append(lh.buckets, moved)
+	lh.resizes++
+	if lh.next++; lh.next == n {
+		lh.level++
+		lh.next = 0
+	}
+}
+
+// merge undoes the last split, folding the last bucket into the one it
+// was split from.
+func (lh *LinearHash) merge() {
+	if lh.next == 0 {
+		lh.level--
+		lh.next = uint64(lhInitialBuckets) << lh.level
+	}
+	lh.next--
+	last := len(lh.buckets) - 1
+	lh.buckets[lh.next] = append(lh.buckets[lh.next], lh.buckets[last]...)
+	lh.buckets[last] = nil
+	lh.buckets = lh.buckets[:last]
+	lh.resizes++
+}
+
+// Stats reports how the keys are spread over the buckets. Every bucket is
+// a chain.
+func (lh *LinearHash) Stats() HashStats {
+	lh.mu.RLock()
+	defer lh.mu.RUnlock()
+
+	s := HashStats{Buckets: uint64(len(lh.buckets))}
+	for _, items := range lh.buckets {
+		s.LiveNodes += uint64(len(items))
+		s.addChain(len(items))
+	}
+	s.finish()
+	return s
+}
+
+// Keys returns an iterator over the keys, bucket by bucket. The keys are
+// gathered before the first is yielded, so the loop body may modify the
+// table.
+func (lh *LinearHash) Keys() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		lh.mu.RLock()
+		keys := make([]uint64, 0, lh.count)
+		for _, items := range lh.buckets {
+			keys = append(keys, items...)
+		}
+		lh.mu.RUnlock()
+
+		for _, key := range keys {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (lh *LinearHash) Count() uint64 {
+	lh.mu.RLock()
+	defer lh.mu.RUnlock()
+	return lh.count
+}
+
+// Resizes returns how many buckets have been split or merged.
+func (lh *LinearHash) Resizes() uint64 {
+	lh.mu.RLock()
+	defer lh.mu.RUnlock()
+	return lh.resizes
+}
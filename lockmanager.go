@@ -0,0 +1,453 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"manager"
+	"slices"
+	"sync"
+)
+
+// TxnID identifies a transaction. Under WoundWait a lower ID is an older
+// transaction, so IDs should be handed out in increasing order.
+type TxnID uint64
+
+// Mode is the mode a lock is held in.
+type Mode uint8
+
+const (
+	Shared    Mode = iota + 1 // compatible with other Shared locks
+	Exclusive                 // compatible with none
+)
+
+func compatible(a, b Mode) bool { return a == Shared && b == Shared }
+
+// Kind tells the namespaces of resources apart: a key lock never
+// conflicts with a page lock, even of the same number.
+type Kind uint8
+
+const (
+	KindKey Kind = iota
+	KindPage
+)
+
+// Resource is something a transaction locks: a key of an index, a closed
+// range of its keys, or a page. Resources conflict if they are of the same
+// kind and space and their ranges overlap, so a range lock conflicts with
+// the key locks inside it.
+type Resource struct {
+	Kind   Kind
+	Space  uint64 // the index keys belong to; 0 for pages
+	Lo, Hi uint64
+}
+
+// Key returns the resource of key in the index space.
+func Key(space, key uint64) Resource {
+	return Resource{Kind: KindKey, Space: space, Lo: key, Hi: key}
+}
+
+// Range returns the resource of the keys lo through hi in space, both
+// included, for reads that must not see keys appear in between.
+func Range(space, lo, hi uint64) Resource {
+	return Resource{Kind: KindKey, Space: space, Lo: min(lo, hi), Hi: max(lo, hi)}
+}
+
+// Page returns the resource of a page.
+func Page(id manager.PageID) Resource {
+	return Resource{Kind: KindPage, Lo: uint64(id), Hi: uint64(id)}
+}
+
+func (r Resource) point() bool { return r.Lo == r.Hi }
+
+func (r Resource) overlaps(o Resource) bool { return r.Lo <= o.Hi && o.Lo <= r.Hi }
+
+// Policy is how a Manager resolves deadlocks.
+type Policy uint8
+
+const (
+	// DetectDeadlocks lets any transaction wait for any other, and fails a
+	// request with ErrDeadlock if waiting would close a cycle in the
+	// waits-for graph.
+	DetectDeadlocks Policy = iota
+	// WoundWait only lets a younger transaction wait for an older one. An
+	// older one that needs a younger one's lock wounds it: its pending and
+	// later requests fail with ErrWounded, and it must abort and release
+	// its locks, which the older one waits for. No cycle can form.
+	WoundWait
+)
+
+var (
+	// ErrDeadlock is returned by Lock when waiting would deadlock. The
+	// transaction should abort and release its locks.
+	ErrDeadlock = errors.New("lock: deadlock")
+	// ErrWounded is returned by Lock for a transaction wounded by an older
+	// one under WoundWait. The transaction must abort and release its
+	// locks.
+	ErrWounded = errors.New("lock: wounded by an older transaction")
+	// ErrShrinking is returned by Lock for a transaction that has released
+	// a lock: under two-phase locking it may not take more.
+	ErrShrinking = errors.New("lock: transaction has released a lock")
+	// ErrNotHeld is returned by Unlock for a lock the transaction does
+	// not hold.
+	ErrNotHeld = errors.New("lock: not held")
+
+	errReleased = errors.New("lock: transaction released while waiting")
+)
+
+// Stats counts a Manager's waits and deadlock resolutions.
+type Stats struct {
+	Waits     uint64 // requests that had to wait
+	Deadlocks uint64 // requests failed with ErrDeadlock
+	Wounds    uint64 // transactions wounded
+}
+
+// Manager grants shared and exclusive locks to transactions under strict
+// two-phase locking: a transaction takes locks as it goes and gives them
+// all up at once with ReleaseAll when it commits or aborts, which makes
+// concurrent transactions serializable. Waiting requests are granted in
+// the order they came, so a stream of shared locks cannot starve an
+// exclusive one, except that upgrades from Shared to Exclusive go first.
+// Conflicts among key locks are found through a map; range locks are
+// checked one by one against the other locks of their space, so they
+// suit a few wide scans better than many narrow ones. Safe for
+// concurrent use.
+type Manager struct {
+	policy Policy
+
+	mu      sync.Mutex
+	buckets map[bucketID]*bucket
+	txns    map[TxnID]*txnState
+	stats   Stats
+}
+
+// bucketID groups resources that can conflict.
+type bucketID struct {
+	kind  Kind
+	space uint64
+}
+
+// bucket holds the locks granted and waiting on the resources of a space.
+type bucket struct {
+	points  map[uint64][]*request // granted locks of single keys or pages
+	ranges  []*request            // granted range locks
+	waiting []*request            // in arrival order, upgrades first
+}
+
+// request is a lock requested, waiting or granted.
+type request struct {
+	txn     TxnID
+	res     Resource
+	mode    Mode
+	upgrade bool          // for a resource txn holds Shared
+	ready   chan struct{} // closed once granted or failed
+	err     error         // why it failed
+}
+
+// txnState is what the manager knows of a transaction.
+type txnState struct {
+	held      map[Resource]*request
+	waiting   *request
+	shrinking bool
+	wounded   bool
+}
+
+// NewManager returns a lock manager that resolves deadlocks by policy.
+func NewManager(policy Policy) *Manager {
+	return &Manager{
+		policy:  policy,
+		buckets: make(map[bucketID]*bucket),
+		txns:    make(map[TxnID]*txnState),
+	}
+}
+
+// Lock locks res in mode for txn, waiting while other transactions hold
+// conflicting locks, or until ctx is done. A lock txn already holds in the
+// same or a stronger mode is granted at once; a Shared one is upgraded to
+// Exclusive. It fails with ErrDeadlock or ErrWounded when the policy picks
+// txn to abort, and with ErrShrinking once txn has called Unlock.
+func (m *Manager) Lock(ctx context.Context, txn TxnID, res Resource, mode Mode) error {
+	m.mu.Lock()
+	t := m.txn(txn)
+	switch {
+	case t.wounded:
+		m.mu.Unlock()
+		return ErrWounded
+	case t.shrinking:
+		m.mu.Unlock()
+		return ErrShrinking
+	}
+	held := t.held[res]
+	if held != nil && held.mode >= mode {
+		m.mu.Unlock()
+		return nil
+	}
+
+	b := m.bucket(res)
+	req := &request{txn: txn, res: res, mode: mode, upgrade: held != nil, ready: make(chan struct{})}
+	blockers := m.blockers(b, req, b.waiting)
+	if len(blockers) == 0 {
+		m.grant(b, req)
+		m.mu.Unlock()
+		return nil
+	}
+	if req.upgrade {
+		// Ahead of the waiters, which might otherwise wait for txn's
+		// shared lock while txn waits for them
+		i := 0
+		for i < len(b.waiting) && b.waiting[i].upgrade {
+			i++
+		}
+		b.waiting = slices.Insert(b.waiting, i, req)
+	} else {
+		b.waiting = append(b.waiting, req)
+	}
+	t.waiting = req
+	m.stats.Waits++
+
+	switch m.policy {
+	case DetectDeadlocks:
+		if m.cycle(txn) {
+			m.dequeue(b, req)
+			m.stats.Deadlocks++
+			m.wake(b)
+			m.mu.Unlock()
+			return ErrDeadlock
+		}
+	case WoundWait:
+		for _, other := range m.blockers(b, req, b.waiting) {
+			if other > txn {
+				m.wound(other)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-req.ready:
+		return req.err
+	case <-ctx.Done():
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-req.ready:
+		// Granted or failed before the lock was retaken
+		return req.err
+	default:
+	}
+	m.dequeue(b, req)
+	m.wake(b)
+	return ctx.Err()
+}
+
+// Unlock releases txn's lock on res before the transaction ends, which
+// strict two-phase locking does not need; txn may take no more locks
+// after.
+func (m *Manager) Unlock(txn TxnID, res Resource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.txns[txn]
+	if t == nil || t.held[res] == nil {
+		return ErrNotHeld
+	}
+	t.shrinking = true
+	b := m.bucket(res)
+	m.remove(b, t.held[res])
+	delete(t.held, res)
+	m.wake(b)
+	return nil
+}
+
+// ReleaseAll releases every lock txn holds, when it commits or aborts,
+// and forgets it. A request of txn still waiting fails.
+func (m *Manager) ReleaseAll(txn TxnID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.txns[txn]
+	if t == nil {
+		return
+	}
+	delete(m.txns, txn)
+	touched := make(map[*bucket]bool)
+	if req := t.waiting; req != nil {
+		b := m.bucket(req.res)
+		m.dequeue(b, req)
+		req.err = errReleased
+		close(req.ready)
+		touched[b] = true
+	}
+	for _, req := range t.held {
+		b := m.bucket(req.res)
+		m.remove(b, req)
+		touched[b] = true
+	}
+	for b := range touched {
+		m.wake(b)
+	}
+}
+
+// Holds reports the mode txn holds res in, or 0.
+func (m *Manager) Holds(txn TxnID, res Resource) Mode {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t := m.txns[txn]; t != nil && t.held[res] != nil {
+		return t.held[res].mode
+	}
+	return 0
+}
+
+// Stats returns the manager's counters.
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+func (m *Manager) txn(id TxnID) *txnState {
+	t := m.txns[id]
+	if t == nil {
+		t = &txnState{held: make(map[Resource]*request)}
+		m.txns[id] = t
+	}
+	return t
+}
+
+func (m *Manager) bucket(res Resource) *bucket {
+	id := bucketID{res.Kind, res.Space}
+	b := m.buckets[id]
+	if b == nil {
+		b = &bucket{points: make(map[uint64][]*request)}
+		m.buckets[id] = b
+	}
+	return b
+}
+
+// blockers returns the transactions req waits for: those of other
+// transactions holding conflicting locks and, unless req is an upgrade,
+// of conflicting requests in ahead, the waiters before req.
+func (m *Manager) blockers(b *bucket, req *request, ahead []*request) []TxnID {
+	var txns []TxnID
+	conflict := func(other *request) {
+		if other.txn != req.txn && !compatible(other.mode, req.mode) && other.res.overlaps(req.res) &&
+			!slices.Contains(txns, other.txn) {
+			txns = append(txns, other.txn)
+		}
+	}
+	if req.res.point() {
+		for _, other := range b.points[req.res.Lo] {
+			conflict(other)
+		}
+	} else {
+		for _, reqs := range b.points {
+			for _, other := range reqs {
+				conflict(other)
+			}
+		}
+	}
+	for _, other := range b.ranges {
+		conflict(other)
+	}
+	if !req.upgrade {
+		for _, other := range ahead {
+			if other == req {
+				break
+			}
+			conflict(other)
+		}
+	}
+	return txns
+}
+
+// grant records req as held.
+func (m *Manager) grant(b *bucket, req *request) {
+	t := m.txn(req.txn)
+	if req.upgrade {
+		t.held[req.res].mode = req.mode
+	} else {
+		if req.res.point() {
+			b.points[req.res.Lo] = append(b.points[req.res.Lo], req)
+		} else {
+			b.ranges = append(b.ranges, req)
+		}
+		t.held[req.res] = req
+	}
+	if t.waiting == req {
+		t.waiting = nil
+	}
+}
+
+// remove drops a granted lock from b.
+func (m *Manager) remove(b *bucket, req *request) {
+	if req.res.point() {
+		reqs := slices.DeleteFunc(b.points[req.res.Lo], func(r *request) bool { return r == req })
+		if len(reqs) == 0 {
+			delete(b.points, req.res.Lo)
+		} else {
+			b.points[req.res.Lo] = reqs
+		}
+	} else {
+		b.ranges = slices.DeleteFunc(b.ranges, func(r *request) bool { return r == req })
+	}
+}
+
+// dequeue drops a waiting request from b.
+func (m *Manager) dequeue(b *bucket, req *request) {
+	b.waiting = slices.DeleteFunc(b.waiting, func(r *request) bool { return r == req })
+	if t := m.txns[req.txn]; t != nil && t.waiting == req {
+		t.waiting = nil
+	}
+}
+
+// wake grants, in order, the waiting requests of b that no longer
+// conflict.
+func (m *Manager) wake(b *bucket) {
+	for i := 0; i < len(b.waiting); {
+		req := b.waiting[i]
+		if len(m.blockers(b, req, b.waiting)) > 0 {
+			i++
+			continue
+		}
+		b.waiting = slices.Delete(b.waiting, i, i+1)
+		m.grant(b, req)
+		close(req.ready)
+	}
+}
+
+// cycle reports whether txn waits, through the waits-for graph, for
+// itself.
+func (m *Manager) cycle(txn TxnID) bool {
+	seen := make(map[TxnID]bool)
+	var reaches func(from TxnID) bool
+	reaches = func(from TxnID) bool {
+		t := m.txns[from]
+		if t == nil || t.waiting == nil || seen[from] {
+			return false
+		}
+		seen[from] = true
+		b := m.bucket(t.waiting.res)
+		for _, to := range m.blockers(b, t.waiting, b.waiting) {
+			if to == txn || reaches(to) {
+				return true
+			}
+		}
+		return false
+	}
+	return reaches(txn)
+}
+
+// wound marks txn to abort and fails its waiting request, if any.
+func (m *Manager) wound(txn TxnID) {
+	t := m.txns[txn]
+	if t == nil || t.wounded {
+		return
+	}
+	t.wounded = true
+	m.stats.Wounds++
+	if req := t.waiting; req != nil {
+		b := m.bucket(req.res)
+		m.dequeue(b, req)
+		req.err = ErrWounded
+		close(req.ready)
+		m.wake(b)
+	}
+}
@@ -0,0 +1,189 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// lockAsync requests a lock in the background; the result arrives on the
+// returned channel.
+func lockAsync(m *Manager, txn TxnID, res Resource, mode Mode) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- m.Lock(context.Background(), txn, res, mode) }()
+	return done
+}
+
+// waitForWaits blocks until n requests have had to wait.
+func waitForWaits(t *testing.T, m *Manager, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Waits < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests waiting, want %d", m.Stats().Waits, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func mustLock(t *testing.T, m *Manager, txn TxnID, res Resource, mode Mode) {
+	t.Helper()
+	if err := m.Lock(context.Background(), txn, res, mode); err != nil {
+		t.Fatalf("txn %d: %v", txn, err)
+	}
+}
+
+func expectPending(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("request finished with %v, want it to wait", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func expectDone(t *testing.T, done <-chan error, want error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if !errors.Is(err, want) {
+			t.Fatalf("request finished with %v, want %v", err, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request still waiting")
+	}
+}
+
+func TestLockUpgrade(t *testing.T) {
+	m := NewManager(DetectDeadlocks)
+	k := Key(1, 10)
+	mustLock(t, m, 1, k, Shared)
+	mustLock(t, m, 2, k, Shared)
+	mustLock(t, m, 1, k, Shared) // held already
+
+	// An exclusive request waits behind both, and the upgrade of txn 1
+	// goes ahead of it
+	excl := lockAsync(m, 3, k, Exclusive)
+	waitForWaits(t, m, 1)
+	upgrade := lockAsync(m, 1, k, Exclusive)
+	waitForWaits(t, m, 2)
+	expectPending(t, upgrade)
+
+	m.ReleaseAll(2)
+	expectDone(t, upgrade, nil)
+	if mode := m.Holds(1, k); mode != Exclusive {
+		t.Errorf("txn 1 holds %v, want Exclusive", mode)
+	}
+	expectPending(t, excl)
+
+	m.ReleaseAll(1)
+	expectDone(t, excl, nil)
+	if mode := m.Holds(3, k); mode != Exclusive {
+		t.Errorf("txn 3 holds %v, want Exclusive", mode)
+	}
+}
+
+func TestDeadlockPicksVictim(t *testing.T) {
+	m := NewManager(DetectDeadlocks)
+	a, b := Key(1, 1), Key(1, 2)
+	mustLock(t, m, 1, a, Exclusive)
+	mustLock(t, m, 2, b, Exclusive)
+
+	first := lockAsync(m, 1, b, Exclusive)
+	waitForWaits(t, m, 1)
+	// Txn 2 would close the cycle, so it is the one to abort
+	if err := m.Lock(context.Background(), 2, a, Exclusive); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("closing the cycle: %v, want ErrDeadlock", err)
+	}
+	if s := m.Stats(); s.Deadlocks != 1 {
+		t.Errorf("stats = %+v, want one deadlock", s)
+	}
+	expectPending(t, first)
+
+	m.ReleaseAll(2)
+	expectDone(t, first, nil)
+	if m.Holds(1, b) != Exclusive {
+		t.Error("txn 1 did not get the victim's lock")
+	}
+}
+
+func TestWoundWait(t *testing.T) {
+	m := NewManager(WoundWait)
+	a, b := Key(1, 1), Key(1, 2)
+	mustLock(t, m, 1, b, Exclusive)
+	mustLock(t, m, 2, a, Exclusive)
+
+	// The younger txn 2 may wait for the older txn 1
+	younger := lockAsync(m, 2, b, Shared)
+	waitForWaits(t, m, 1)
+	expectPending(t, younger)
+
+	// The older one wounds it instead of waiting behind it
+	older := lockAsync(m, 1, a, Exclusive)
+	expectDone(t, younger, ErrWounded)
+	if err := m.Lock(context.Background(), 2, Key(1, 3), Shared); !errors.Is(err, ErrWounded) {
+		t.Errorf("wounded txn took a new lock: %v", err)
+	}
+	if s := m.Stats(); s.Wounds != 1 {
+		t.Errorf("stats = %+v, want one wound", s)
+	}
+	expectPending(t, older)
+
+	m.ReleaseAll(2)
+	expectDone(t, older, nil)
+}
+
+func TestReleaseWakesWaiters(t *testing.T) {
+	m := NewManager(DetectDeadlocks)
+	k := Key(1, 5)
+	mustLock(t, m, 1, k, Exclusive)
+
+	readers := []<-chan error{lockAsync(m, 2, k, Shared), lockAsync(m, 3, k, Shared)}
+	waitForWaits(t, m, 2)
+	// A range over the key conflicts with the exclusive lock as well
+	scan := lockAsync(m, 4, Range(1, 0, 100), Shared)
+	waitForWaits(t, m, 3)
+	// A key outside the range and a page of the same number do not
+	mustLock(t, m, 5, Key(1, 200), Exclusive)
+	mustLock(t, m, 5, Page(5), Exclusive)
+
+	m.ReleaseAll(1)
+	for _, r := range readers {
+		expectDone(t, r, nil)
+	}
+	expectDone(t, scan, nil)
+	if m.Holds(2, k) != Shared || m.Holds(3, k) != Shared {
+		t.Error("readers do not hold the key")
+	}
+
+	// The range keeps writers out of every key in it
+	writer := lockAsync(m, 6, Key(1, 50), Exclusive)
+	waitForWaits(t, m, 4)
+	expectPending(t, writer)
+	m.ReleaseAll(4)
+	expectDone(t, writer, nil)
+}
+
+func TestLockContextAndShrinking(t *testing.T) {
+	m := NewManager(DetectDeadlocks)
+	k := Key(1, 1)
+	mustLock(t, m, 1, k, Exclusive)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.Lock(ctx, 2, k, Shared); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timed-out request: %v", err)
+	}
+
+	if err := m.Unlock(1, k); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Unlock(1, k); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("second Unlock: %v, want ErrNotHeld", err)
+	}
+	if err := m.Lock(context.Background(), 1, Key(1, 2), Shared); !errors.Is(err, ErrShrinking) {
+		t.Errorf("lock after Unlock: %v, want ErrShrinking", err)
+	}
+	mustLock(t, m, 2, k, Exclusive)
+}
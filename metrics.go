@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"manager"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry collects storage engine metrics and publishes them under one
+// expvar name. It also serves them in the Prometheus text format.
+type Registry struct {
+	mu        sync.Mutex
+	name      string
+	values    map[string]value
+	latencies map[string]*Latency
+}
+
+// value is a gauge or counter read on every export.
+type value struct {
+	read    func() float64
+	counter bool
+}
+
+// NewRegistry creates a registry published as the expvar variable name.
+func NewRegistry(name string) *Registry {
+	r := &Registry{
+		name:      name,
+		values:    make(map[string]value),
+		latencies: make(map[string]*Latency),
+	}
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(r.snapshot))
+	}
+	return r
+}
+
+// Gauge registers a value read on every export, one that can go up and
+// down.
+func (r *Registry) Gauge(name string, fn func() float64) {
+	r.register(name, value{read: fn})
+}
+
+// CounterFunc registers a value read on every export that only ever
+// grows, such as a count kept elsewhere. Prometheus takes it for a
+// counter, so rate() works on it; by convention its name ends in _total.
+func (r *Registry) CounterFunc(name string, fn func() float64) {
+	r.register(name, value{read: fn, counter: true})
+}
+
+func (r *Registry) register(name string, v value) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[name] = v
+}
+
+// Counter registers and returns a monotonically increasing counter.
+func (r *Registry) Counter(name string) *Counter {
+	c := &Counter{}
+	r.CounterFunc(name, func() float64 {
+		return float64(c.Value())
+	})
+	return c
+}
+
+// Latency registers and returns a latency histogram.
+func (r *Registry) Latency(name string) *Latency {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, exists := r.latencies[name]; exists {
+		return l
+	}
+	l := &Latency{}
+	r.latencies[name] = l
+	return l
+}
+
+// BufferStatsSource is implemented by BufferManager and BufferPoolManager.
+type BufferStatsSource interface {
+	Stats() manager.BufferStats
+}
+
+// TrackBufferManager exports hit rate, I/O and occupancy of a buffer pool.
+func (r *Registry) TrackBufferManager(prefix string, src BufferStatsSource) {
+	stat := func(fn func(manager.BufferStats) float64) func() float64 {
+		return func() float64 {
+			return fn(src.Stats())
+		}
+	}
+	r.Gauge(prefix+"_hit_rate", stat(func(s manager.BufferStats) float64 { return s.HitRate() }))
+	r.CounterFunc(prefix+"_hits_total", stat(func(s manager.BufferStats) float64 { return float64(s.Hits) }))
+	r.CounterFunc(prefix+"_misses_total", stat(func(s manager.BufferStats) float64 { return float64(s.Misses) }))
+	r.CounterFunc(prefix+"_pages_read_total", stat(func(s manager.BufferStats) float64 { return float64(s.PagesRead) }))
+	r.CounterFunc(prefix+"_pages_written_total", stat(func(s manager.BufferStats) float64 { return float64(s.PagesWritten) }))
+	r.CounterFunc(prefix+"_evictions_total", stat(func(s manager.BufferStats) float64 { return float64(s.Evictions) }))
+	r.Gauge(prefix+"_resident_pages", stat(func(s manager.BufferStats) float64 { return float64(s.Resident) }))
+	r.Gauge(prefix+"_dirty_pages", stat(func(s manager.BufferStats) float64 { return float64(s.Dirty) }))
+}
+
+// TrackGroupCommit exports how many commits each log flush of a group
+// committer made durable.
+func (r *Registry) TrackGroupCommit(prefix string, g interface {
+	Stats() manager.GroupCommitStats
+}) {
+	stat := func(fn func(manager.GroupCommitStats) float64) func() float64 {
+		return func() float64 {
+			return fn(g.Stats())
+		}
+	}
+	r.CounterFunc(prefix+"_commits_total", stat(func(s manager.GroupCommitStats) float64 { return float64(s.Commits) }))
+	r.CounterFunc(prefix+"_flushes_total", stat(func(s manager.GroupCommitStats) float64 { return float64(s.Flushes) }))
+	r.Gauge(prefix+"_commits_per_flush", stat(func(s manager.GroupCommitStats) float64 { return s.CommitsPerFlush() }))
+	r.Gauge(prefix+"_max_batch", stat(func(s manager.GroupCommitStats) float64 { return float64(s.MaxBatch) }))
+}
+
+// TrackTree exports the height of a B+Tree.
+func (r *Registry) TrackTree(prefix string, tree interface{ Height() (int, error) }) {
+	r.Gauge(prefix+"_height", func() float64 {
+		h, err := tree.Height()
+		if err != nil {
+			return -1
+		}
+		return float64(h)
+	})
+}
+
+// TrackHash exports how often a hash table has resized.
+func (r *Registry) TrackHash(prefix string, table interface{ Resizes() uint64 }) {
+	r.CounterFunc(prefix+"_resizes_total", func() float64 {
+		return float64(table.Resizes())
+	})
+}
+
+func (r *Registry) snapshot() any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(map[string]any, len(r.values)+len(r.latencies))
+	for name, v := range r.values {
+		out[name] = v.read()
+	}
+	for name, l := range r.latencies {
+		count, sum := l.totals()
+		out[name] = map[string]any{
+			"count":   count,
+			"sum_ns":  sum,
+			"buckets": l.bucketCounts(),
+		}
+	}
+	return out
+}
+
+// WritePrometheus writes all metrics in the Prometheus text format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sb strings.Builder
+	for _, name := range sortedKeys(r.values) {
+		v := r.values[name]
+		kind := "gauge"
+		if v.counter {
+			kind = "counter"
+		}
+		full := metricName(r.name, name)
+		fmt.Fprintf(&sb, "# TYPE %s %s\n%s %g\n", full, kind, full, v.read())
+	}
+	for _, name := range sortedKeys(r.latencies) {
+		l := r.latencies[name]
+		full := metricName(r.name, name) + "_seconds"
+		fmt.Fprintf(&sb, "# TYPE %s histogram\n", full)
+		var cumulative uint64
+		for i, n := range l.bucketCounts() {
+			cumulative += n
+			fmt.Fprintf(&sb, "%s_bucket{le=\"%g\"} %d\n", full, bucketBound(i).Seconds(), cumulative)
+		}
+		count, sum := l.totals()
+		fmt.Fprintf(&sb, "%s_bucket{le=\"+Inf\"} %d\n", full, count)
+		fmt.Fprintf(&sb, "%s_sum %g\n%s_count %d\n", full, time.Duration(sum).Seconds(), full, count)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// ServeHTTP makes the registry a Prometheus scrape endpoint.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WritePrometheus(w)
+}
+
+func metricName(prefix, name string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+			return c
+		}
+		return '_'
+	}, prefix+"_"+name)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	v atomic.Uint64
+}
+
+func (c *Counter) Inc()          { c.v.Add(1) }
+func (c *Counter) Add(n uint64)  { c.v.Add(n) }
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// latencyBuckets are powers of two from 1µs up to about 1s; slower
+// observations only show up in the +Inf bucket.
+const latencyBuckets = 21
+
+func bucketBound(i int) time.Duration {
+	return time.Microsecond << i
+}
+
+// Latency is a fixed-bucket histogram of operation durations.
+type Latency struct {
+	buckets [latencyBuckets]atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64
+}
+
+// Observe records one operation that took d.
+func (l *Latency) Observe(d time.Duration) {
+	l.count.Add(1)
+	l.sum.Add(int64(d))
+	for i := 0; i < latencyBuckets; i++ {
+		if d <= bucketBound(i) {
+			l.buckets[i].Add(1)
+			return
+		}
+	}
+}
+
+// Since records the time elapsed since start, for use as
+// defer lat.Since(time.Now()).
+func (l *Latency) Since(start time.Time) {
+	l.Observe(time.Since(start))
+}
+
+func (l *Latency) totals() (uint64, int64) {
+	return l.count.Load(), l.sum.Load()
+}
+
+func (l *Latency) bucketCounts() []uint64 {
+	counts := make([]uint64, latencyBuckets)
+	for i := range counts {
+		counts[i] = l.buckets[i].Load()
+	}
+	return counts
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"manager"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry("prom test")
+	level := 2.5
+	r.Gauge("level", func() float64 { return level })
+	c := r.Counter("ops_total")
+	c.Add(41)
+	c.Inc()
+	r.CounterFunc("bytes_total", func() float64 { return 1e9 })
+	lat := r.Latency("op")
+	lat.Observe(time.Microsecond)
+	lat.Observe(3 * time.Microsecond)
+	lat.Observe(2 * time.Second)
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"# TYPE prom_test_bytes_total counter",
+		"prom_test_bytes_total 1e+09",
+		"# TYPE prom_test_level gauge",
+		"prom_test_level 2.5",
+		"# TYPE prom_test_ops_total counter",
+		"prom_test_ops_total 42",
+		"# TYPE prom_test_op_seconds histogram",
+		`prom_test_op_seconds_bucket{le="1e-06"} 1`,
+		`prom_test_op_seconds_bucket{le="2e-06"} 1`,
+		`prom_test_op_seconds_bucket{le="4e-06"} 2`,
+	}
+	got := strings.Split(b.String(), "\n")
+	if len(got) < len(want) {
+		t.Fatalf("exposition:\n%s", b.String())
+	}
+	for i, line := range want {
+		if got[i] != line {
+			t.Errorf("line %d = %q, want %q", i+1, got[i], line)
+		}
+	}
+	for _, line := range []string{
+		`prom_test_op_seconds_bucket{le="1.048576"} 2`,
+		`prom_test_op_seconds_bucket{le="+Inf"} 3`,
+		"prom_test_op_seconds_sum 2.000004",
+		"prom_test_op_seconds_count 3",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("exposition lacks %q:\n%s", line, b.String())
+		}
+	}
+
+	// As a scrape endpoint
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") || w.Body.String() != b.String() {
+		t.Errorf("scrape served %q:\n%s", ct, w.Body.String())
+	}
+}
+
+func TestTrackedKinds(t *testing.T) {
+	r := NewRegistry("kinds_test")
+	r.TrackBufferManager("pool", manager.NewBufferManager())
+	r.TrackHash("hash", resizer(3))
+	g := manager.NewGroupCommitter(durableLog{}, manager.GroupCommitOptions{})
+	g.Commit(1)
+	r.TrackGroupCommit("commit", g)
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	// Totals are counters, the rest gauges
+	for _, line := range strings.Split(b.String(), "\n") {
+		if !strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		f := strings.Fields(line)
+		want := "gauge"
+		if strings.HasSuffix(f[2], "_total") {
+			want = "counter"
+		}
+		if f[3] != want {
+			t.Errorf("%s is a %s, want a %s", f[2], f[3], want)
+		}
+	}
+	for _, want := range []string{
+		"# TYPE kinds_test_hash_resizes_total counter\nkinds_test_hash_resizes_total 3\n",
+		"# TYPE kinds_test_commit_commits_total counter\nkinds_test_commit_commits_total 1\n",
+		"# TYPE kinds_test_commit_flushes_total counter\nkinds_test_commit_flushes_total 0\n",
+		"# TYPE kinds_test_commit_max_batch gauge\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("exposition lacks %q:\n%s", want, b.String())
+		}
+	}
+}
+
+// durableLog is a log durable up to any LSN.
+type durableLog struct{}
+
+func (durableLog) FlushedLSN() manager.LSN { return 1 << 62 }
+func (durableLog) Flush(manager.LSN) error { return nil }
+
+type resizer uint64
+
+func (r resizer) Resizes() uint64 { return uint64(r) }
+
+func TestExpvarSnapshot(t *testing.T) {
+	r := NewRegistry("expvar_test")
+	r.Counter("ops_total").Add(7)
+	r.Gauge("level", func() float64 { return 0.5 })
+	r.Latency("op").Observe(5 * time.Microsecond)
+
+	v := expvar.Get("expvar_test")
+	if v == nil {
+		t.Fatal("registry not published")
+	}
+	var snap struct {
+		Ops   float64 `json:"ops_total"`
+		Level float64 `json:"level"`
+		Op    struct {
+			Count   uint64   `json:"count"`
+			SumNs   int64    `json:"sum_ns"`
+			Buckets []uint64 `json:"buckets"`
+		} `json:"op"`
+	}
+	if err := json.Unmarshal([]byte(v.String()), &snap); err != nil {
+		t.Fatalf("%v in %s", err, v.String())
+	}
+	if snap.Ops != 7 || snap.Level != 0.5 || snap.Op.Count != 1 || snap.Op.SumNs != 5000 ||
+		len(snap.Op.Buckets) != latencyBuckets || snap.Op.Buckets[3] != 1 {
+		t.Errorf("snapshot %s", v.String())
+	}
+
+	// A second registry of the name keeps the first published
+	NewRegistry("expvar_test").Counter("ops_total").Add(100)
+	if !strings.Contains(expvar.Get("expvar_test").String(), `"ops_total":7`) {
+		t.Errorf("snapshot after a second registry: %s", expvar.Get("expvar_test"))
+	}
+}
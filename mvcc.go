@@ -0,0 +1,354 @@
+package mvcc
+
+import (
+	"errors"
+	"iter"
+	"maps"
+	"skiplist"
+	"slices"
+	"sync"
+)
+
+// Timestamp orders commits. A transaction reads the versions committed at
+// or before its snapshot's timestamp.
+type Timestamp uint64
+
+var (
+	// ErrConflict is returned when a transaction writes a key that another
+	// transaction committed after its snapshot was taken: the first
+	// committer wins, and the transaction must abort and retry.
+	ErrConflict = errors.New("mvcc: write conflict")
+	// ErrTxnDone is returned by the methods of a transaction that has
+	// committed or aborted.
+	ErrTxnDone = errors.New("mvcc: transaction already committed or aborted")
+)
+
+// version is a value a key had from a commit on, newest first in a
+// chain. A delete is a version too, so that older snapshots still see
+// the value it replaced.
+type version struct {
+	value   uint64
+	deleted bool
+	commit  Timestamp
+	older   *version
+}
+
+// chain holds the versions of a key. Its head changes under Store.mu.
+type chain struct {
+	newest *version
+}
+
+// visible returns the version of c a snapshot at ts reads, or nil.
+func (c *chain) visible(ts Timestamp) *version {
+	v := c.newest
+	for v != nil && v.commit > ts {
+		v = v.older
+	}
+	return v
+}
+
+// Stats counts a Store's commits, conflicts and vacuumed versions.
+type Stats struct {
+	Commits   uint64
+	Aborts    uint64 // including those for conflicts
+	Conflicts uint64
+	Vacuumed  uint64 // versions dropped by Vacuum
+}
+
+// Store is a multiversion map of uint64 keys to uint64 values under
+// snapshot isolation. Each transaction reads a consistent snapshot, the
+// state as of its Begin, so readers never wait for writers nor writers
+// for readers; writes are buffered in the transaction and installed as
+// new versions, all with one commit timestamp, at Commit. Two
+// transactions writing the same key conflict, and the later to commit
+// fails. Old versions are kept until no snapshot can read them and
+// Vacuum drops them. Safe for concurrent use.
+type Store struct {
+	keys *skiplist.SkipList[uint64, *chain]
+
+	mu     sync.RWMutex
+	clock  Timestamp         // last commit
+	active map[Timestamp]int // snapshots of running transactions
+	stats  Stats
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{
+		keys:   skiplist.New[uint64, *chain](),
+		active: make(map[Timestamp]int),
+	}
+}
+
+// Txn is a transaction on a Store. It is not safe for concurrent use.
+type Txn struct {
+	s        *Store
+	snapshot Timestamp
+	writes   map[uint64]write
+	done     bool
+}
+
+// write is a buffered Put or Delete.
+type write struct {
+	value   uint64
+	deleted bool
+}
+
+// Begin starts a transaction reading the snapshot of the last commit.
+func (s *Store) Begin() *Txn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[s.clock]++
+	return &Txn{s: s, snapshot: s.clock, writes: make(map[uint64]write)}
+}
+
+// Now returns the timestamp of the last commit.
+func (s *Store) Now() Timestamp {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clock
+}
+
+// Stats returns the store's counters.
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stats
+}
+
+// Snapshot returns the timestamp of the snapshot t reads.
+func (t *Txn) Snapshot() Timestamp {
+	return t.snapshot
+}
+
+// Get returns the value of key in t's snapshot, or t's own write of it.
+func (t *Txn) Get(key uint64) (uint64, bool, error) {
+	if t.done {
+		return 0, false, ErrTxnDone
+	}
+	if w, ok := t.writes[key]; ok {
+		return w.value, !w.deleted, nil
+	}
+	c, ok := t.s.keys.Get(key)
+	if !ok {
+		return 0, false, nil
+	}
+	t.s.mu.RLock()
+	defer t.s.mu.RUnlock()
+	if v := c.visible(t.snapshot); v != nil && !v.deleted {
+		return v.value, true, nil
+	}
+	return 0, false, nil
+}
+
+// Put sets key to value when t commits. It fails early with ErrConflict
+// if key was committed after t's snapshot.
+func (t *Txn) Put(key, value uint64) error {
+	return t.write(key, write{value: value})
+}
+
+// Delete removes key when t commits, failing early as Put does.
+func (t *Txn) Delete(key uint64) error {
+	return t.write(key, write{deleted: true})
+}
+
+func (t *Txn) write(key uint64, w write) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if t.s.conflicts(key, t.snapshot) {
+		t.abort(true)
+		return ErrConflict
+	}
+	t.writes[key] = w
+	return nil
+}
+
+// Range returns an iterator over the keys from lo to hi inclusive and
+// their values in t's snapshot, with t's own writes applied, in key order.
+func (t *Txn) Range(lo, hi uint64) iter.Seq2[uint64, uint64] {
+	return func(yield func(uint64, uint64) bool) {
+		if t.done {
+			return
+		}
+		var own []uint64
+		for key := range t.writes {
+			if lo <= key && key <= hi {
+				own = append(own, key)
+			}
+		}
+		slices.Sort(own)
+		// Yields the own writes before key, then key's value if it is
+		// not one of them
+		emit := func(key uint64, v *version) bool {
+			for len(own) > 0 && own[0] <= key {
+				k := own[0]
+				own = own[1:]
+				if w := t.writes[k]; !w.deleted && !yield(k, w.value) {
+					return false
+				}
+				if k == key {
+					return true
+				}
+			}
+			if v != nil && !v.deleted {
+				return yield(key, v.value)
+			}
+			return true
+		}
+		// RangeScan stops before its end, so the greatest key is
+		// looked up on its own
+		end := hi
+		if hi < ^uint64(0) {
+			end = hi + 1
+		}
+		committed := t.s.keys.RangeScan(lo, end)
+		for key, c := range committed {
+			t.s.mu.RLock()
+			v := c.visible(t.snapshot)
+			t.s.mu.RUnlock()
+			if !emit(key, v) {
+				return
+			}
+		}
+		if hi == ^uint64(0) {
+			if c, ok := t.s.keys.Get(hi); ok {
+				t.s.mu.RLock()
+				v := c.visible(t.snapshot)
+				t.s.mu.RUnlock()
+				if !emit(hi, v) {
+					return
+				}
+			}
+		}
+		for _, k := range own {
+			if w := t.writes[k]; !w.deleted && !yield(k, w.value) {
+				return
+			}
+		}
+	}
+}
+
+// Commit installs t's writes as new versions with one commit timestamp,
+// which it returns, and ends t. It fails with ErrConflict, and aborts t,
+// if another transaction committed one of the keys t wrote after t's
+// snapshot. A transaction that wrote nothing commits at its snapshot.
+func (t *Txn) Commit() (Timestamp, error) {
+	if t.done {
+		return 0, ErrTxnDone
+	}
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(t.writes) == 0 {
+		s.end(t)
+		s.stats.Commits++
+		return t.snapshot, nil
+	}
+	// Under s.mu, so that Vacuum cannot drop a chain found here
+	keys := slices.Sorted(maps.Keys(t.writes))
+	chains := make([]*chain, len(keys))
+	for i, key := range keys {
+		c, ok := s.keys.Get(key)
+		if !ok {
+			c = &chain{}
+			s.keys.Insert(key, c)
+		}
+		if c.newest != nil && c.newest.commit > t.snapshot {
+			s.end(t)
+			s.stats.Conflicts++
+			s.stats.Aborts++
+			return 0, ErrConflict
+		}
+		chains[i] = c
+	}
+	s.clock++
+	for i, c := range chains {
+		w := t.writes[keys[i]]
+		c.newest = &version{value: w.value, deleted: w.deleted, commit: s.clock, older: c.newest}
+	}
+	s.end(t)
+	s.stats.Commits++
+	return s.clock, nil
+}
+
+// Abort drops t's writes and ends t. Aborting an ended transaction does
+// nothing.
+func (t *Txn) Abort() {
+	if !t.done {
+		t.abort(false)
+	}
+}
+
+func (t *Txn) abort(conflict bool) {
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.end(t)
+	if conflict {
+		s.stats.Conflicts++
+		s.stats.Aborts++
+	} else if len(t.writes) > 0 {
+		s.stats.Aborts++
+	}
+}
+
+// end forgets t's snapshot. s.mu must be held.
+func (s *Store) end(t *Txn) {
+	t.done = true
+	if s.active[t.snapshot]--; s.active[t.snapshot] == 0 {
+		delete(s.active, t.snapshot)
+	}
+}
+
+// conflicts reports whether key has a version committed after snapshot.
+func (s *Store) conflicts(key uint64, snapshot Timestamp) bool {
+	c, ok := s.keys.Get(key)
+	if !ok {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return c.newest != nil && c.newest.commit > snapshot
+}
+
+// Vacuum drops the versions no running transaction, nor any begun later,
+// can read: for each key, those older than the one visible to the oldest
+// snapshot, and keys whose visible version there is a delete. It returns
+// how many versions it dropped.
+func (s *Store) Vacuum() int {
+	s.mu.RLock()
+	horizon := s.clock
+	for ts := range s.active {
+		horizon = min(horizon, ts)
+	}
+	s.mu.RUnlock()
+
+	dropped := 0
+	var gone []uint64
+	for key, c := range s.keys.All() {
+		s.mu.Lock()
+		if v := c.visible(horizon); v != nil {
+			for o := v.older; o != nil; o = o.older {
+				dropped++
+			}
+			v.older = nil
+			if v.deleted && c.newest == v {
+				c.newest = nil
+				dropped++
+				gone = append(gone, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range gone {
+		// Unless a commit has put a version in the chain since
+		if c, ok := s.keys.Get(key); ok && c.newest == nil {
+			s.keys.Delete(key)
+		}
+	}
+	s.stats.Vacuumed += uint64(dropped)
+	return dropped
+}
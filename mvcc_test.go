@@ -0,0 +1,162 @@
+package mvcc
+
+import (
+	"errors"
+	"testing"
+)
+
+// commit runs a transaction putting each key to its value.
+func commit(t *testing.T, s *Store, kv map[uint64]uint64) Timestamp {
+	t.Helper()
+	txn := s.Begin()
+	for k, v := range kv {
+		if err := txn.Put(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts, err := txn.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func expectGet(t *testing.T, txn *Txn, key, want uint64, wantOK bool) {
+	t.Helper()
+	v, ok, err := txn.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != wantOK || ok && v != want {
+		t.Errorf("Get(%d) = %d, %v; want %d, %v", key, v, ok, want, wantOK)
+	}
+}
+
+func TestSnapshotVisibility(t *testing.T) {
+	s := NewStore()
+	commit(t, s, map[uint64]uint64{1: 10, 2: 20})
+
+	reader := s.Begin()
+	commit(t, s, map[uint64]uint64{1: 11, 3: 30})
+	del := s.Begin()
+	if err := del.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := del.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader sees the store as of its Begin
+	expectGet(t, reader, 1, 10, true)
+	expectGet(t, reader, 2, 20, true)
+	expectGet(t, reader, 3, 0, false)
+
+	// A later one sees both commits, and its own writes over them
+	later := s.Begin()
+	expectGet(t, later, 1, 11, true)
+	expectGet(t, later, 2, 0, false)
+	expectGet(t, later, 3, 30, true)
+	later.Put(4, 40)
+	later.Delete(3)
+	expectGet(t, later, 4, 40, true)
+	var keys, values []uint64
+	for k, v := range later.Range(0, 100) {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	if len(keys) != 2 || keys[0] != 1 || values[0] != 11 || keys[1] != 4 || values[1] != 40 {
+		t.Errorf("Range = %v %v, want [1 4] [11 40]", keys, values)
+	}
+	later.Abort()
+	reader.Abort()
+
+	if _, _, err := reader.Get(1); !errors.Is(err, ErrTxnDone) {
+		t.Errorf("Get after Abort: %v, want ErrTxnDone", err)
+	}
+}
+
+func TestWriteConflict(t *testing.T) {
+	s := NewStore()
+	commit(t, s, map[uint64]uint64{1: 1})
+
+	// Both write key 1; the first to commit wins
+	a, b := s.Begin(), s.Begin()
+	if err := a.Put(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("second commit: %v, want ErrConflict", err)
+	}
+
+	// A write to a key committed after the snapshot fails at once
+	c := s.Begin()
+	commit(t, s, map[uint64]uint64{1: 4})
+	if err := c.Put(1, 5); !errors.Is(err, ErrConflict) {
+		t.Errorf("stale Put: %v, want ErrConflict", err)
+	}
+	if err := c.Put(2, 5); !errors.Is(err, ErrTxnDone) {
+		t.Errorf("Put after a conflict: %v, want ErrTxnDone", err)
+	}
+
+	// Writers of different keys do not conflict
+	d, e := s.Begin(), s.Begin()
+	d.Put(10, 1)
+	e.Put(11, 1)
+	if _, err := d.Commit(); err != nil {
+		t.Error(err)
+	}
+	if _, err := e.Commit(); err != nil {
+		t.Error(err)
+	}
+
+	if st := s.Stats(); st.Conflicts != 2 || st.Aborts != 2 {
+		t.Errorf("stats = %+v, want 2 conflicts and aborts", st)
+	}
+	check := s.Begin()
+	defer check.Abort()
+	expectGet(t, check, 1, 4, true)
+}
+
+func TestVacuumKeepsVisibleVersions(t *testing.T) {
+	s := NewStore()
+	commit(t, s, map[uint64]uint64{1: 1, 2: 1})
+	old := s.Begin()
+	commit(t, s, map[uint64]uint64{1: 2})
+	commit(t, s, map[uint64]uint64{1: 3})
+	del := s.Begin()
+	del.Delete(2)
+	if _, err := del.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old snapshot still reads the first versions, so nothing older
+	// than them can go
+	if n := s.Vacuum(); n != 0 {
+		t.Errorf("Vacuum with an old snapshot dropped %d versions, want 0", n)
+	}
+	expectGet(t, old, 1, 1, true)
+	expectGet(t, old, 2, 1, true)
+	old.Abort()
+
+	// Now only the newest versions are readable: key 1's two old ones and
+	// key 2 with its delete go
+	if n := s.Vacuum(); n != 4 {
+		t.Errorf("Vacuum dropped %d versions, want 4", n)
+	}
+	now := s.Begin()
+	defer now.Abort()
+	expectGet(t, now, 1, 3, true)
+	expectGet(t, now, 2, 0, false)
+	if _, ok := s.keys.Get(2); ok {
+		t.Error("deleted key still in the store after Vacuum")
+	}
+	if st := s.Stats(); st.Vacuumed != 4 {
+		t.Errorf("stats = %+v, want 4 vacuumed", st)
+	}
+}
@@ -0,0 +1,305 @@
+package radix
+
+import (
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type node[V any] struct {
+	// prefix is the part of the key this edge adds; children start with
+	// distinct bytes and are kept sorted by them
+	prefix   string
+	children []*node[V]
+	leaf     bool
+	value    V
+}
+
+// child returns the index of the child starting with b, or where it
+// would go.
+func (n *node[V]) child(b byte) (int, bool) {
+	return slices.BinarySearchFunc(n.children, b, func(c *node[V], b byte) int {
+		return int(c.prefix[0]) - int(b)
+	})
+}
+
+// Tree is a radix tree, a trie that stores runs of bytes no other key
+// branches off from as one edge, mapping string keys to values. It finds
+// every key with a given prefix, and the longest key that is a prefix of
+// a given string, as for routing tables and autocompletion, and matches
+// keys against ? and * wildcards. Safe for concurrent use.
+type Tree[V any] struct {
+	mu     sync.RWMutex
+	root   node[V]
+	length int
+}
+
+func New[V any]() *Tree[V] {
+	return &Tree[V]{}
+}
+
+func commonPrefix(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// Insert maps key to value, and reports whether key is new.
+func (t *Tree[V]) Insert(key string, value V) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n, s := &t.root, key
+	for s != "" {
+		i, ok := n.child(s[0])
+		if !ok {
+			leaf := &node[V]{prefix: s, leaf: true, value: value}
+			n.children = slices.Insert(n.children, i, leaf)
+			t.length++
+			return true
+		}
+		c := n.children[i]
+		l := commonPrefix(s, c.prefix)
+		if l < len(c.prefix) {
+			// Split the edge where s leaves it
+			mid := &node[V]{prefix: c.prefix[:l], children: []*node[V]{c}}
+			c.prefix = c.prefix[l:]
+			n.children[i] = mid
+			c = mid
+		}
+		n, s = c, s[l:]
+	}
+	if n.leaf {
+		n.value = value
+		return false
+	}
+	n.leaf, n.value = true, value
+	t.length++
+	return true
+}
+
+func (t *Tree[V]) Get(key string) (V, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n, s := &t.root, key
+	for s != "" {
+		i, ok := n.child(s[0])
+		if !ok || !strings.HasPrefix(s, n.children[i].prefix) {
+			var zero V
+			return zero, false
+		}
+		n, s = n.children[i], s[len(n.children[i].prefix):]
+	}
+	return n.value, n.leaf
+}
+
+// Delete removes key, returning the value it had, and merges any edge
+// left with a single child into it.
+func (t *Tree[V]) Delete(key string) (V, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var zero V
+	var parent *node[V]
+	index := 0
+	n, s := &t.root, key
+	for s != "" {
+		i, ok := n.child(s[0])
+		if !ok || !strings.HasPrefix(s, n.children[i].prefix) {
+			return zero, false
+		}
+		parent, index = n, i
+		n, s = n.children[i], s[len(n.children[i].prefix):]
+	}
+	if !n.leaf {
+		return zero, false
+	}
+	value := n.value
+	n.leaf, n.value = false, zero
+	t.length--
+
+	if parent == nil {
+		return value, true
+	}
+	switch len(n.children) {
+	case 0:
+		parent.children = slices.Delete(parent.children, index, index+1)
+		// The parent may now be a bare edge to one child
+		if parent != &t.root && !parent.leaf && len(parent.children) == 1 {
+			parent.merge()
+		}
+	case 1:
+		n.merge()
+	}
+	return value, true
+}
+
+// merge folds the only child of n into n.
+func (n *node[V]) merge() {
+	c := n.children[0]
+	n.prefix += c.prefix
+	n.children = c.children
+	n.leaf, n.value = c.leaf, c.value
+}
+
+func (t *Tree[V]) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.length
+}
+
+// LongestPrefixMatch returns the longest key that is a prefix of s, and
+// its value.
+func (t *Tree[V]) LongestPrefixMatch(s string) (string, V, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var match *node[V]
+	matched := 0
+	n, rest := &t.root, s
+	for {
+		if n.leaf {
+			match, matched = n, len(s)-len(rest)
+		}
+		if rest == "" {
+			break
+		}
+		i, ok := n.child(rest[0])
+		if !ok || !strings.HasPrefix(rest, n.children[i].prefix) {
+			break
+		}
+		n, rest = n.children[i], rest[len(n.children[i].prefix):]
+	}
+	if match == nil {
+		var zero V
+		return "", zero, false
+	}
+	return s[:matched], match.value, true
+}
+
+type entry[V any] struct {
+	key   string
+	value V
+}
+
+// collect appends the entries under n, whose key so far is key, in key
+// order.
+func (n *node[V]) collect(key string, out []entry[V]) []entry[V] {
+	if n.leaf {
+		out = append(out, entry[V]{key, n.value})
+	}
+	for _, c := range n.children {
+		out = c.collect(key+c.prefix, out)
+	}
+	return out
+}
+
+// WalkPrefix returns an iterator over the keys starting with prefix and
+// their values, in key order. The entries are gathered before the first
+// is yielded, so the loop body may modify the tree.
+func (t *Tree[V]) WalkPrefix(prefix string) iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		t.mu.RLock()
+		var entries []entry[V]
+		n, key, s := &t.root, "", prefix
+		for s != "" {
+			i, ok := n.child(s[0])
+			if !ok {
+				n = nil
+				break
+			}
+			c := n.children[i]
+			l := commonPrefix(s, c.prefix)
+			if l < len(s) && l < len(c.prefix) {
+				n = nil
+				break
+			}
+			// The prefix may end partway along the edge
+			n, key, s = c, key+c.prefix, s[l:]
+		}
+		if n != nil {
+			entries = n.collect(key, nil)
+		}
+		t.mu.RUnlock()
+
+		for _, e := range entries {
+			if !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over every key and value in key order, gathered
+// like WalkPrefix.
+func (t *Tree[V]) All() iter.Seq2[string, V] {
+	return t.WalkPrefix("")
+}
+
+// Match returns an iterator over the keys matching pattern, in key order:
+// ? matches any one byte and * any run of bytes, possibly empty. The
+// entries are gathered before the first is yielded.
+func (t *Tree[V]) Match(pattern string) iter.Seq2[string, V] {
+	// A run of stars matches what one does
+	for strings.Contains(pattern, "**") {
+		pattern = strings.ReplaceAll(pattern, "**", "*")
+	}
+	return func(yield func(string, V) bool) {
+		t.mu.RLock()
+		// A key can match a pattern with several stars more than one way
+		found := make(map[string]V)
+		t.root.match(0, nil, pattern, found)
+		t.mu.RUnlock()
+
+		keys := make([]string, 0, len(found))
+		for key := range found {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if !yield(key, found[key]) {
+				return
+			}
+		}
+	}
+}
+
+// match adds to found the keys matching pattern from the point off bytes
+// along the edge into n, key being the bytes before it.
+func (n *node[V]) match(off int, key []byte, pattern string, found map[string]V) {
+	if pattern == "" {
+		if off == len(n.prefix) && n.leaf {
+			found[string(key)] = n.value
+		}
+		return
+	}
+	if pattern[0] == '*' {
+		n.match(off, key, pattern[1:], found)
+	}
+	// Every way to take one more byte
+	step := func(b byte, next *node[V], off int) {
+		switch pattern[0] {
+		case '*':
+			next.match(off, append(key, b), pattern, found)
+		case '?':
+			next.match(off, append(key, b), pattern[1:], found)
+		default:
+			if b == pattern[0] {
+				next.match(off, append(key, b), pattern[1:], found)
+			}
+		}
+	}
+	if off < len(n.prefix) {
+		step(n.prefix[off], n, off+1)
+		return
+	}
+	for _, c := range n.children {
+		step(c.prefix[0], c, 1)
+	}
+}
@@ -0,0 +1,248 @@
+package radix
+
+import (
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// checkShape checks that edges are non-empty, children sorted by distinct
+// first bytes, and no edge but the root's is a bare link to one child.
+func checkShape[V any](t *testing.T, n *node[V], root bool) {
+	t.Helper()
+	if !root {
+		if n.prefix == "" {
+			t.Fatal("empty edge")
+		}
+		if !n.leaf && len(n.children) < 2 {
+			t.Fatalf("edge %q holds no key and %d children", n.prefix, len(n.children))
+		}
+	}
+	for i, c := range n.children {
+		if i > 0 && n.children[i-1].prefix[0] >= c.prefix[0] {
+			t.Fatalf("children %q and %q out of order", n.children[i-1].prefix, c.prefix)
+		}
+		checkShape(t, c, false)
+	}
+}
+
+// randomKey returns a short key over a small alphabet, so keys share
+// prefixes and are often prefixes of each other.
+func randomKey(r *rand.Rand) string {
+	b := make([]byte, r.IntN(7))
+	for i := range b {
+		b[i] = "abc"[r.IntN(3)]
+	}
+	return string(b)
+}
+
+func TestAgainstMap(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	tr := New[int]()
+	want := make(map[string]int)
+	for i := range 20000 {
+		k := randomKey(r)
+		if r.IntN(3) < 2 {
+			_, had := want[k]
+			if isNew := tr.Insert(k, i); isNew == had {
+				t.Fatalf("Insert(%q) reported new %v, map had it %v", k, isNew, had)
+			}
+			want[k] = i
+		} else {
+			v, ok := tr.Delete(k)
+			if wv, had := want[k]; ok != had || v != wv {
+				t.Fatalf("Delete(%q) = %d, %v, want %d, %v", k, v, ok, wv, had)
+			}
+			delete(want, k)
+		}
+		if i%1000 == 0 {
+			checkShape(t, &tr.root, true)
+		}
+	}
+	checkShape(t, &tr.root, true)
+	if tr.Len() != len(want) {
+		t.Errorf("Len = %d, want %d", tr.Len(), len(want))
+	}
+	for range 1000 {
+		k := randomKey(r)
+		v, ok := tr.Get(k)
+		if wv, had := want[k]; ok != had || v != wv {
+			t.Fatalf("Get(%q) = %d, %v, want %d, %v", k, v, ok, wv, had)
+		}
+	}
+	keys := slices.Collect(func(yield func(string) bool) {
+		for k := range tr.All() {
+			if !yield(k) {
+				return
+			}
+		}
+	})
+	if wantKeys := slices.Sorted(maps.Keys(want)); !slices.Equal(keys, wantKeys) {
+		t.Errorf("All = %q, want %q", keys, wantKeys)
+	}
+}
+
+func TestLongestPrefixMatch(t *testing.T) {
+	tr := New[int]()
+	for i, k := range []string{"10.", "10.1.", "10.1.2.", "10.2.", "192.168."} {
+		tr.Insert(k, i)
+	}
+	for _, tc := range []struct {
+		s, want string
+		ok      bool
+	}{
+		{"10.1.2.3", "10.1.2.", true},
+		{"10.1.3.4", "10.1.", true},
+		{"10.1", "10.", true},
+		{"10.3.0.1", "10.", true},
+		{"192.168.0.1", "192.168.", true},
+		{"192.167.0.1", "", false},
+		{"", "", false},
+	} {
+		got, _, ok := tr.LongestPrefixMatch(tc.s)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("LongestPrefixMatch(%q) = %q, %v, want %q, %v", tc.s, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	// The empty key is a prefix of everything
+	tr.Insert("", -1)
+	if got, v, ok := tr.LongestPrefixMatch("8.8.8.8"); got != "" || v != -1 || !ok {
+		t.Errorf("LongestPrefixMatch with an empty key = %q, %d, %v", got, v, ok)
+	}
+}
+
+func TestWalkPrefix(t *testing.T) {
+	tr := New[int]()
+	words := []string{"car", "card", "care", "cared", "cart", "cat", "do", "dog"}
+	for i, w := range words {
+		tr.Insert(w, i)
+	}
+	for _, tc := range []struct {
+		prefix string
+		want   []string
+	}{
+		{"car", []string{"car", "card", "care", "cared", "cart"}},
+		// Ending partway along an edge
+		{"ca", []string{"car", "card", "care", "cared", "cart", "cat"}},
+		{"care", []string{"care", "cared"}},
+		{"d", []string{"do", "dog"}},
+		{"cb", nil},
+		{"cartwheel", nil},
+		{"", words},
+	} {
+		var got []string
+		for k, v := range tr.WalkPrefix(tc.prefix) {
+			if words[v] != k {
+				t.Errorf("WalkPrefix(%q) yields %q = %d", tc.prefix, k, v)
+			}
+			got = append(got, k)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("WalkPrefix(%q) = %q, want %q", tc.prefix, got, tc.want)
+		}
+	}
+
+	// The loop body may delete what it is given
+	for k := range tr.WalkPrefix("car") {
+		tr.Delete(k)
+	}
+	if tr.Len() != 3 {
+		t.Errorf("Len after deleting during a walk = %d, want 3", tr.Len())
+	}
+	checkShape(t, &tr.root, true)
+}
+
+// wildcard reports whether s matches pattern, by brute force.
+func wildcard(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if wildcard(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && wildcard(pattern[1:], s[1:])
+	}
+	return s != "" && s[0] == pattern[0] && wildcard(pattern[1:], s[1:])
+}
+
+func TestMatch(t *testing.T) {
+	r := rand.New(rand.NewPCG(2, 2))
+	tr := New[int]()
+	var keys []string
+	for i := range 300 {
+		k := randomKey(r)
+		if tr.Insert(k, i) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	patterns := []string{"", "*", "**", "a*", "*a", "?", "??", "a?c", "*b*", "a**b", "*a*b*c*", "?*?", "abc", "d*"}
+	for range 200 {
+		b := make([]byte, r.IntN(6))
+		for i := range b {
+			b[i] = "abc?*"[r.IntN(5)]
+		}
+		patterns = append(patterns, string(b))
+	}
+	for _, p := range patterns {
+		var want []string
+		for _, k := range keys {
+			if wildcard(p, k) {
+				want = append(want, k)
+			}
+		}
+		var got []string
+		for k, v := range tr.Match(p) {
+			if w, _ := tr.Get(k); w != v {
+				t.Errorf("Match(%q) yields %q = %d, want %d", p, k, v, w)
+			}
+			got = append(got, k)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Match(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	tr := New[int]()
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				k := strings.Repeat("x", w) + string(rune('a'+i%26)) + string(rune('a'+i/26))
+				tr.Insert(k, i)
+				if i%2 == 1 {
+					tr.Delete(k)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				for range tr.WalkPrefix("x") {
+				}
+				tr.LongestPrefixMatch("xxxab")
+				for range tr.Match("x*a") {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if tr.Len() != 2000 {
+		t.Errorf("Len = %d, want 2000", tr.Len())
+	}
+	checkShape(t, &tr.root, true)
+}
@@ -0,0 +1,207 @@
+package splitordered
+
+import (
+	"iter"
+	"sync"
+)
+
+const (
+	rhMinSlots = 16
+	rhMaxLoad  = 0.875
+	// Shrink once deletes leave the table under this full
+	rhMinLoad = 0.25
+)
+
+// RobinHoodMap is an open-addressing map of uint64 keys to uint64 values
+// with Robin Hood linear probing. An insert that meets a key nearer its
+// home slot than the new one takes that slot and carries on inserting the
+// displaced key, so probe lengths stay short and even, and a lookup can
+// stop at the first key nearer home than it would be. Deletes shift the
+// following run back one slot instead of leaving tombstones. Keys are
+// mixed with splitmix64.
+type RobinHoodMap struct {
+	mu     sync.RWMutex
+	keys   []uint64
+	values []uint64
+	// dist[i] is how far slot i is past its key's home slot, plus one;
+	// zero marks an empty slot
+	dist    []uint32
+	count   uint64
+	resizes uint64
+}
+
+func NewRobinHoodMap() *RobinHoodMap {
+	rh := &RobinHoodMap{}
+	rh.allocate(rhMinSlots)
+	return rh
+}
+
+func (rh *RobinHoodMap) allocate(n int) {
+	rh.keys = make([]uint64, n)
+	rh.values = make([]uint64, n)
+	rh.dist = make([]uint32, n)
+}
+
+func (rh *RobinHoodMap) home(key uint64) int {
+	return int(mix64(key) & uint64(len(rh.keys)-1))
+}
+
+// slot returns the index of key, or -1.
+func (rh *RobinHoodMap) slot(key uint64) int {
+	mask := len(rh.keys) - 1
+	i := rh.home(key)
+	for d := uint32(1); ; d++ {
+		// A key nearer its home than we are to ours would have been
+		// displaced by this one
+		if rh.dist[i] < d {
+			return -1
+		}
+		if rh.keys[i] == key {
+			return i
+		}
+		i = (i + 1) & mask
+	}
+}
+
+// Put maps key to value, and reports whether key is new.
+func (rh *RobinHoodMap) Put(key, value uint64) bool {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if i := rh.slot(key); i >= 0 {
+		rh.values[i] = value
+		return false
+	}
+	if float64(rh.count+1) > rhMaxLoad*float64(len(rh.keys)) {
+		rh.resize(2 * len(rh.keys))
+	}
+	rh.place(key, value)
+	rh.count++
+	return true
+}
+
+// place stores a key known to be absent.
+func (rh *RobinHoodMap) place(key, value uint64) {
+	mask := len(rh.keys) - 1
+	i := rh.home(key)
+	for d := uint32(1); ; d++ {
+		if rh.dist[i] == 0 {
+			rh.keys[i], rh.values[i], rh.dist[i] = key, value, d
+			return
+		}
+		if rh.dist[i] < d {
+			// Take from the rich: swap and keep going with theirs
+			rh.keys[i], key = key, rh.keys[i]
+			rh.values[i], value = value, rh.values[i]
+			rh.dist[i], d = d, rh.dist[i]
+		}
+		i = (i + 1) & mask
+	}
+}
+
+func (rh *RobinHoodMap) resize(n int) {
+	keys, values, dist := rh.keys, rh.values, rh.dist
+	rh.allocate(n)
+	for i, d := range dist {
+		if d != 0 {
+			rh.place(keys[i], values[i])
+		}
+	}
+	rh.resizes++
+}
+
+func (rh *RobinHoodMap) Get(key uint64) (uint64, bool) {
+	rh.mu.RLock()
+	defer rh.mu.RUnlock()
+
+	if i := rh.slot(key); i >= 0 {
+		return rh.values[i], true
+	}
+	return 0, false
+}
+
+func (rh *RobinHoodMap) Contains(key uint64) bool {
+	_, ok := rh.Get(key)
+	return ok
+}
+
+// Delete removes key, returning the value it had.
+func (rh *RobinHoodMap) Delete(key uint64) (uint64, bool) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	i := rh.slot(key)
+	if i < 0 {
+		return 0, false
+	}
+	value := rh.values[i]
+	// Backward shift: pull each following key that is not at home one
+	// slot nearer it, up to an empty slot or a key already at home
+	mask := len(rh.keys) - 1
+	for {
+		next := (i + 1) & mask
+		if rh.dist[next] <= 1 {
+			rh.dist[i] = 0
+			break
+		}
+		rh.keys[i], rh.values[i], rh.dist[i] = rh.keys[next], rh.values[next], rh.dist[next]-1
+		i = next
+	}
+	rh.count--
+	if len(rh.keys) > rhMinSlots && float64(rh.count) < rhMinLoad*float64(len(rh.keys)) {
+		rh.resize(len(rh.keys) / 2)
+	}
+	return value, true
+}
+
+// ProbeStats reports how far keys sit from their home slots.
+func (rh *RobinHoodMap) ProbeStats() ProbeStats {
+	rh.mu.RLock()
+	defer rh.mu.RUnlock()
+
+	s := ProbeStats{Slots: uint64(len(rh.keys))}
+	for _, d := range rh.dist {
+		if d != 0 {
+			s.addProbe(int(d - 1))
+		}
+	}
+	s.finish()
+	return s
+}
+
+// All returns an iterator over the keys and values in slot order. They are
+// gathered before the first is yielded, so the loop body may modify the
+// map.
+func (rh *RobinHoodMap) All() iter.Seq2[uint64, uint64] {
+	return func(yield func(uint64, uint64) bool) {
+		rh.mu.RLock()
+		keys := make([]uint64, 0, rh.count)
+		values := make([]uint64, 0, rh.count)
+		for i, d := range rh.dist {
+			if d != 0 {
+				keys = append(keys, rh.keys[i])
+				values = append(values, rh.values[i])
+			}
+		}
+		rh.mu.RUnlock()
+
+		for i, key := range keys {
+			if !yield(key, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+func (rh *RobinHoodMap) Count() uint64 {
+	rh.mu.RLock()
+	defer rh.mu.RUnlock()
+	return rh.count
+}
+
+// Resizes returns how many times the table has grown or shrunk.
+func (rh *RobinHoodMap) Resizes() uint64 {
+	rh.mu.RLock()
+	defer rh.mu.RUnlock()
+	return rh.resizes
+}
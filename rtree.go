@@ -0,0 +1,362 @@
+package rtree
+
+import (
+	"container/heap"
+	"iter"
+	"math"
+	"sync"
+)
+
+const (
+	maxEntries = 16
+	// Nodes other than the root hold at least this many entries
+	minEntries = maxEntries * 2 / 5
+)
+
+// Point is a position in the plane.
+type Point [2]float64
+
+// Rect is an axis-aligned rectangle, from Min to Max inclusive. A point is
+// a Rect with Min == Max.
+type Rect struct {
+	Min, Max Point
+}
+
+func (r Rect) area() float64 {
+	return (r.Max[0] - r.Min[0]) * (r.Max[1] - r.Min[1])
+}
+
+func (r Rect) union(o Rect) Rect {
+	return Rect{
+		Min: Point{math.Min(r.Min[0], o.Min[0]), math.Min(r.Min[1], o.Min[1])},
+		Max: Point{math.Max(r.Max[0], o.Max[0]), math.Max(r.Max[1], o.Max[1])},
+	}
+}
+
+// Intersects reports whether r and o share any point.
+func (r Rect) Intersects(o Rect) bool {
+	return r.Min[0] <= o.Max[0] && o.Min[0] <= r.Max[0] &&
+		r.Min[1] <= o.Max[1] && o.Min[1] <= r.Max[1]
+}
+
+// Contains reports whether o lies within r.
+func (r Rect) Contains(o Rect) bool {
+	return r.Min[0] <= o.Min[0] && o.Max[0] <= r.Max[0] &&
+		r.Min[1] <= o.Min[1] && o.Max[1] <= r.Max[1]
+}
+
+// dist2 returns the squared distance from p to the nearest point of r.
+func (r Rect) dist2(p Point) float64 {
+	d := 0.0
+	for i := range p {
+		if p[i] < r.Min[i] {
+			d += (r.Min[i] - p[i]) * (r.Min[i] - p[i])
+		} else if p[i] > r.Max[i] {
+			d += (p[i] - r.Max[i]) * (p[i] - r.Max[i])
+		}
+	}
+	return d
+}
+
+type entry[V comparable] struct {
+	rect  Rect
+	child *node[V] // nil in a leaf
+	value V
+}
+
+type node[V comparable] struct {
+	entries []entry[V]
+}
+
+func (n *node[V]) bounds() Rect {
+	r := n.entries[0].rect
+	for _, e := range n.entries[1:] {
+		r = r.union(e.rect)
+	}
+	return r
+}
+
+// Tree is an R-tree, indexing values by rectangle for spatial queries:
+// which rectangles intersect a region, and which lie nearest a point. Like
+// a B+Tree it is balanced, with entries in the leaves and every internal
+// entry holding the bounding rectangle of its child, but the rectangles
+// of siblings may overlap, so a search can follow several children. An
+// insert goes down the child whose rectangle grows least, and full nodes
+// are split with Guttman's quadratic split. Safe for concurrent use.
+type Tree[V comparable] struct {
+	mu     sync.RWMutex
+	root   *node[V]
+	height int // levels; the leaves are level 0
+	size   int
+}
+
+func New[V comparable]() *Tree[V] {
+	return &Tree[V]{root: &node[V]{}, height: 1}
+}
+
+func (t *Tree[V]) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// Insert adds value with rectangle r. The same rectangle and value may be
+// inserted more than once.
+func (t *Tree[V]) Insert(r Rect, value V) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.insert(entry[V]{rect: r, value: value}, 0)
+	t.size++
+}
+
+// insert adds e to a node at level, growing a new root if the old one
+// splits.
+func (t *Tree[V]) insert(e entry[V], level int) {
+	if sibling := t.insertAt(t.root, t.height-1, e, level); sibling != nil {
+		t.root = &node[V]{entries: []entry[V]{
+			{rect: t.root.bounds(), child: t.root},
+			{rect: sibling.bounds(), child: sibling},
+		}}
+		t.height++
+	}
+}
+
+// insertAt adds e below n, which is at level depth, and returns the new
+// sibling of n if it had to split.
+func (t *Tree[V]) insertAt(n *node[V], depth int, e entry[V], level int) *node[V] {
+	if depth == level {
+		n.entries = append(n.entries, e)
+	} else {
+		i := chooseSubtree(n, e.rect)
+		child := n.entries[i].child
+		sibling := t.insertAt(child, depth-1, e, level)
+		n.entries[i].rect = child.bounds()
+		if sibling != nil {
+			n.entries = append(n.entries, entry[V]{rect: sibling.bounds(), child: sibling})
+		}
+	}
+	if len(n.entries) > maxEntries {
+		return split(n)
+	}
+	return nil
+}
+
+// chooseSubtree returns the entry of n whose rectangle grows least to
+// take r, the smallest of those on a tie.
+func chooseSubtree[V comparable](n *node[V], r Rect) int {
+	best, bestGrowth, bestArea := 0, math.Inf(1), math.Inf(1)
+	for i, e := range n.entries {
+		area := e.rect.area()
+		growth := e.rect.union(r).area() - area
+		if growth < bestGrowth || growth == bestGrowth && area < bestArea {
+			best, bestGrowth, bestArea = i, growth, area
+		}
+	}
+	return best
+}
+
+// split moves about half the entries of n to a new sibling, which it
+// returns, with Guttman's quadratic split: seed the two groups with the
+// pair that would waste most area together, then hand out the rest, the
+// entry with the strongest preference first.
+func split[V comparable](n *node[V]) *node[V] {
+	entries := n.entries
+	s1, s2, worst := 0, 1, math.Inf(-1)
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			waste := entries[i].rect.union(entries[j].rect).area() - entries[i].rect.area() - entries[j].rect.area()
+			if waste > worst {
+				s1, s2, worst = i, j, waste
+			}
+		}
+	}
+
+	g1 := []entry[V]{entries[s1]}
+	g2 := []entry[V]{entries[s2]}
+	r1, r2 := entries[s1].rect, entries[s2].rect
+	rest := make([]entry[V], 0, len(entries)-2)
+	for i, e := range entries {
+		if i != s1 && i != s2 {
+			rest = append(rest, e)
+		}
+	}
+	for len(rest) > 0 {
+		// A group that needs every remaining entry to reach the minimum
+		// gets them
+		if len(g1)+len(rest) == minEntries {
+			g1 = append(g1, rest...)
+			break
+		}
+		if len(g2)+len(rest) == minEntries {
+			g2 = append(g2, rest...)
+			break
+		}
+		pick, diff := 0, math.Inf(-1)
+		for i, e := range rest {
+			d1 := r1.union(e.rect).area() - r1.area()
+			d2 := r2.union(e.rect).area() - r2.area()
+			if d := math.Abs(d1 - d2); d > diff {
+				pick, diff = i, d
+			}
+		}
+		e := rest[pick]
+		rest[pick] = rest[len(rest)-1]
+		rest = rest[:len(rest)-1]
+
+		d1 := r1.union(e.rect).area() - r1.area()
+		d2 := r2.union(e.rect).area() - r2.area()
+		toFirst := d1 < d2 ||
+			d1 == d2 && (r1.area() < r2.area() || r1.area() == r2.area() && len(g1) <= len(g2))
+		if toFirst {
+			g1, r1 = append(g1, e), r1.union(e.rect)
+		} else {
+			g2, r2 = append(g2, e), r2.union(e.rect)
+		}
+	}
+	n.entries = g1
+	return &node[V]{entries: g2}
+}
+
+// orphan is an entry of a node removed for underflow, to be inserted
+// again at its level.
+type orphan[V comparable] struct {
+	e     entry[V]
+	level int
+}
+
+// Delete removes one entry of value with rectangle r, and reports whether
+// there was one. Nodes left with too few entries are dissolved and their
+// entries inserted again.
+func (t *Tree[V]) Delete(r Rect, value V) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var orphans []orphan[V]
+	if !t.remove(t.root, t.height-1, r, value, &orphans) {
+		return false
+	}
+	t.size--
+	for len(t.root.entries) == 1 && t.height > 1 {
+		t.root = t.root.entries[0].child
+		t.height--
+	}
+	for _, o := range orphans {
+		t.insert(o.e, o.level)
+	}
+	return true
+}
+
+func (t *Tree[V]) remove(n *node[V], depth int, r Rect, value V, orphans *[]orphan[V]) bool {
+	for i, e := range n.entries {
+		if depth == 0 {
+			if e.rect == r && e.value == value {
+				n.entries = append(n.entries[:i], n.entries[i+1:]...)
+				return true
+			}
+			continue
+		}
+		if !e.rect.Contains(r) || !t.remove(e.child, depth-1, r, value, orphans) {
+			continue
+		}
+		if len(e.child.entries) < minEntries {
+			for _, ce := range e.child.entries {
+				*orphans = append(*orphans, orphan[V]{ce, depth - 1})
+			}
+			n.entries = append(n.entries[:i], n.entries[i+1:]...)
+		} else {
+			n.entries[i].rect = e.child.bounds()
+		}
+		return true
+	}
+	return false
+}
+
+type item[V comparable] struct {
+	rect  Rect
+	value V
+}
+
+// SearchIntersect returns an iterator over the rectangles intersecting r
+// and their values. They are gathered before the first is yielded, so
+// the loop body may modify the tree.
+func (t *Tree[V]) SearchIntersect(r Rect) iter.Seq2[Rect, V] {
+	return func(yield func(Rect, V) bool) {
+		t.mu.RLock()
+		var found []item[V]
+		var search func(n *node[V], depth int)
+		search = func(n *node[V], depth int) {
+			for _, e := range n.entries {
+				if !e.rect.Intersects(r) {
+					continue
+				}
+				if depth == 0 {
+					found = append(found, item[V]{e.rect, e.value})
+				} else {
+					search(e.child, depth-1)
+				}
+			}
+		}
+		search(t.root, t.height-1)
+		t.mu.RUnlock()
+
+		for _, it := range found {
+			if !yield(it.rect, it.value) {
+				return
+			}
+		}
+	}
+}
+
+// candidate is a node or leaf entry waiting in the nearest-neighbour
+// search, by its distance from the query point.
+type candidate[V comparable] struct {
+	dist float64
+	e    entry[V]
+}
+
+type candidates[V comparable] []candidate[V]
+
+func (c candidates[V]) Len() int           { return len(c) }
+func (c candidates[V]) Less(i, j int) bool { return c[i].dist < c[j].dist }
+func (c candidates[V]) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c *candidates[V]) Push(x any)        { *c = append(*c, x.(candidate[V])) }
+func (c *candidates[V]) Pop() any {
+	old := *c
+	x := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return x
+}
+
+// Nearest returns an iterator over the k rectangles nearest p and their
+// values, nearest first, distance being from p to the nearest point of
+// the rectangle. It searches best first: nodes and entries are taken from
+// a queue by distance, and a node is never nearer than what it holds, so
+// entries come off the queue in order. The results are gathered before
+// the first is yielded.
+func (t *Tree[V]) Nearest(p Point, k int) iter.Seq2[Rect, V] {
+	return func(yield func(Rect, V) bool) {
+		t.mu.RLock()
+		var found []item[V]
+		queue := &candidates[V]{}
+		for _, e := range t.root.entries {
+			heap.Push(queue, candidate[V]{e.rect.dist2(p), e})
+		}
+		for queue.Len() > 0 && len(found) < k {
+			c := heap.Pop(queue).(candidate[V])
+			if c.e.child == nil {
+				found = append(found, item[V]{c.e.rect, c.e.value})
+				continue
+			}
+			for _, e := range c.e.child.entries {
+				heap.Push(queue, candidate[V]{e.rect.dist2(p), e})
+			}
+		}
+		t.mu.RUnlock()
+
+		for _, it := range found {
+			if !yield(it.rect, it.value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package rtree
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// check checks that the leaves are all at level 0, that nodes other than
+// the root hold between minEntries and maxEntries entries, and that every
+// internal entry has the bounds of its child; it returns the leaf entries.
+func check[V comparable](t *testing.T, tr *Tree[V]) int {
+	t.Helper()
+	var walk func(n *node[V], depth int, root bool) int
+	walk = func(n *node[V], depth int, root bool) int {
+		if !root && (len(n.entries) < minEntries || len(n.entries) > maxEntries) {
+			t.Fatalf("node at level %d holds %d entries", depth, len(n.entries))
+		}
+		count := 0
+		for _, e := range n.entries {
+			if (e.child == nil) != (depth == 0) {
+				t.Fatalf("entry at level %d has child %v", depth, e.child != nil)
+			}
+			if depth == 0 {
+				count++
+				continue
+			}
+			if e.rect != e.child.bounds() {
+				t.Fatalf("entry at level %d has %v, child bounds %v", depth, e.rect, e.child.bounds())
+			}
+			count += walk(e.child, depth-1, false)
+		}
+		return count
+	}
+	if tr.height > 1 && len(tr.root.entries) < 2 {
+		t.Fatalf("root of a tree %d high holds %d entries", tr.height, len(tr.root.entries))
+	}
+	return walk(tr.root, tr.height-1, true)
+}
+
+func randomRect(r *rand.Rand) Rect {
+	x, y := r.Float64()*1000, r.Float64()*1000
+	if r.IntN(4) == 0 {
+		return Rect{Point{x, y}, Point{x, y}}
+	}
+	return Rect{Point{x, y}, Point{x + r.Float64()*20, y + r.Float64()*20}}
+}
+
+type rectValue struct {
+	rect  Rect
+	value int
+}
+
+func TestInsertDelete(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	tr := New[int]()
+	var live []rectValue
+	for i := range 5000 {
+		rv := rectValue{randomRect(r), i}
+		tr.Insert(rv.rect, rv.value)
+		live = append(live, rv)
+	}
+	if n := check(t, tr); n != 5000 || tr.Len() != 5000 {
+		t.Fatalf("%d leaf entries, Len %d, want 5000", n, tr.Len())
+	}
+	if tr.height < 3 {
+		t.Errorf("5000 entries in a tree %d high", tr.height)
+	}
+
+	// Delete in random order, with a miss between deletes
+	r.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+	for i, rv := range live {
+		if tr.Delete(rv.rect, rv.value+1e6) {
+			t.Fatalf("Delete of a value never inserted succeeded")
+		}
+		if !tr.Delete(rv.rect, rv.value) {
+			t.Fatalf("Delete(%v, %d) found nothing", rv.rect, rv.value)
+		}
+		if i%250 == 0 {
+			if n := check(t, tr); n != len(live)-i-1 {
+				t.Fatalf("%d leaf entries after %d deletes, want %d", n, i+1, len(live)-i-1)
+			}
+		}
+	}
+	if tr.Len() != 0 || tr.height != 1 || len(tr.root.entries) != 0 {
+		t.Errorf("emptied tree: Len %d, height %d, %d root entries", tr.Len(), tr.height, len(tr.root.entries))
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tr := New[string]()
+	r := Rect{Point{1, 1}, Point{2, 2}}
+	for range 40 {
+		tr.Insert(r, "a")
+	}
+	tr.Insert(r, "b")
+	check(t, tr)
+	n := 0
+	for range 40 {
+		if tr.Delete(r, "a") {
+			n++
+		}
+	}
+	if n != 40 || tr.Delete(r, "a") || tr.Len() != 1 {
+		t.Errorf("deleted %d of 40 copies, Len %d", n, tr.Len())
+	}
+}
+
+func TestSearchIntersect(t *testing.T) {
+	r := rand.New(rand.NewPCG(2, 2))
+	tr := New[int]()
+	var all []rectValue
+	for i := range 3000 {
+		rv := rectValue{randomRect(r), i}
+		tr.Insert(rv.rect, rv.value)
+		all = append(all, rv)
+	}
+	queries := []Rect{
+		{Point{0, 0}, Point{1000, 1000}},
+		{Point{-10, -10}, Point{-1, -1}},
+		{Point{500, 500}, Point{500, 500}},
+	}
+	for range 100 {
+		q := randomRect(r)
+		q.Max[0] += r.Float64() * 100
+		q.Max[1] += r.Float64() * 100
+		queries = append(queries, q)
+	}
+	for _, q := range queries {
+		var want, got []int
+		for _, rv := range all {
+			if rv.rect.Intersects(q) {
+				want = append(want, rv.value)
+			}
+		}
+		for rect, v := range tr.SearchIntersect(q) {
+			if rect != all[v].rect {
+				t.Fatalf("SearchIntersect yields %d with %v, inserted with %v", v, rect, all[v].rect)
+			}
+			got = append(got, v)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("SearchIntersect(%v) found %d, want %d", q, len(got), len(want))
+		}
+	}
+
+	// The loop body may delete what it is given
+	for rect, v := range tr.SearchIntersect(Rect{Point{0, 0}, Point{500, 1000}}) {
+		if !tr.Delete(rect, v) {
+			t.Fatalf("Delete of a yielded entry failed")
+		}
+	}
+	for rect := range tr.SearchIntersect(Rect{Point{0, 0}, Point{500, 1000}}) {
+		t.Fatalf("%v left after deleting the region", rect)
+	}
+	check(t, tr)
+}
+
+func TestNearest(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 3))
+	tr := New[int]()
+	var all []rectValue
+	for i := range 3000 {
+		rv := rectValue{randomRect(r), i}
+		tr.Insert(rv.rect, rv.value)
+		all = append(all, rv)
+	}
+	for range 50 {
+		p := Point{r.Float64()*1200 - 100, r.Float64()*1200 - 100}
+		dists := make([]float64, len(all))
+		for i, rv := range all {
+			dists[i] = rv.rect.dist2(p)
+		}
+		slices.Sort(dists)
+
+		const k = 20
+		var got []float64
+		for rect, v := range tr.Nearest(p, k) {
+			if rect != all[v].rect {
+				t.Fatalf("Nearest yields %d with %v, inserted with %v", v, rect, all[v].rect)
+			}
+			got = append(got, rect.dist2(p))
+		}
+		// Ties may be broken either way, so compare distances
+		if !slices.Equal(got, dists[:k]) {
+			t.Errorf("Nearest(%v) distances %v, want %v", p, got, dists[:k])
+		}
+	}
+
+	n := 0
+	for range tr.Nearest(Point{}, len(all)+10) {
+		n++
+	}
+	if n != len(all) {
+		t.Errorf("Nearest of more than Len yields %d, want %d", n, len(all))
+	}
+	for range New[int]().Nearest(Point{}, 5) {
+		t.Error("Nearest in an empty tree yields an entry")
+	}
+}
+
+func TestRect(t *testing.T) {
+	a := Rect{Point{0, 0}, Point{2, 2}}
+	for _, tc := range []struct {
+		o                    Rect
+		intersects, contains bool
+	}{
+		{Rect{Point{1, 1}, Point{1, 1}}, true, true},
+		{Rect{Point{2, 2}, Point{3, 3}}, true, false}, // touching corners
+		{Rect{Point{-1, -1}, Point{3, 3}}, true, false},
+		{Rect{Point{0, 0}, Point{2, 2}}, true, true},
+		{Rect{Point{2.5, 0}, Point{3, 2}}, false, false},
+	} {
+		if got := a.Intersects(tc.o); got != tc.intersects {
+			t.Errorf("Intersects(%v) = %v, want %v", tc.o, got, tc.intersects)
+		}
+		if got := a.Contains(tc.o); got != tc.contains {
+			t.Errorf("Contains(%v) = %v, want %v", tc.o, got, tc.contains)
+		}
+	}
+	if d := a.dist2(Point{5, 6}); d != 9+16 {
+		t.Errorf("dist2 = %g, want 25", d)
+	}
+	if d := a.dist2(Point{1, 1}); d != 0 || math.Signbit(d) {
+		t.Errorf("dist2 of a point inside = %g, want 0", d)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	tr := New[int]()
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(uint64(w), 9))
+			for i := range 1000 {
+				rect := randomRect(r)
+				tr.Insert(rect, w*1000+i)
+				if i%2 == 1 {
+					tr.Delete(rect, w*1000+i)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				for range tr.SearchIntersect(Rect{Point{0, 0}, Point{100, 100}}) {
+				}
+				for range tr.Nearest(Point{500, 500}, 5) {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := check(t, tr); n != 2000 || tr.Len() != 2000 {
+		t.Errorf("%d leaf entries, Len %d, want 2000", n, tr.Len())
+	}
+}
@@ -0,0 +1,89 @@
+package rangequery
+
+// SegmentTree answers range queries for any associative operation, such
+// as sum, min, max or gcd, with point updates, both in O(log n). It is a
+// complete binary tree in a slice of 2n elements: leaves n to 2n-1 hold
+// the values and node i combines nodes 2i and 2i+1. A query climbs from
+// both ends of the range at once, combining the nodes that fall wholly
+// inside it, left ones on the left and right ones on the right, so the
+// operation need not be commutative. Not safe for concurrent use.
+type SegmentTree[T any] struct {
+	n       int
+	nodes   []T
+	combine func(a, b T) T
+}
+
+// NewSegmentTree returns a tree of values combined by combine, which must
+// be associative.
+func NewSegmentTree[T any](values []T, combine func(a, b T) T) *SegmentTree[T] {
+	n := len(values)
+	s := &SegmentTree[T]{n: n, nodes: make([]T, 2*n), combine: combine}
+	copy(s.nodes[n:], values)
+	for i := n - 1; i > 0; i-- {
+		s.nodes[i] = combine(s.nodes[2*i], s.nodes[2*i+1])
+	}
+	return s
+}
+
+// NewSumTree returns a segment tree of range sums.
+func NewSumTree[T Number](values []T) *SegmentTree[T] {
+	return NewSegmentTree(values, func(a, b T) T { return a + b })
+}
+
+// NewMinTree returns a segment tree of range minimums.
+func NewMinTree[T Number](values []T) *SegmentTree[T] {
+	return NewSegmentTree(values, func(a, b T) T { return min(a, b) })
+}
+
+// NewMaxTree returns a segment tree of range maximums.
+func NewMaxTree[T Number](values []T) *SegmentTree[T] {
+	return NewSegmentTree(values, func(a, b T) T { return max(a, b) })
+}
+
+func (s *SegmentTree[T]) Len() int { return s.n }
+
+// Get returns the value at position i.
+func (s *SegmentTree[T]) Get(i int) T {
+	return s.nodes[s.n+i]
+}
+
+// Set makes the value at position i v.
+func (s *SegmentTree[T]) Set(i int, v T) {
+	i += s.n
+	s.nodes[i] = v
+	for i /= 2; i > 0; i /= 2 {
+		s.nodes[i] = s.combine(s.nodes[2*i], s.nodes[2*i+1])
+	}
+}
+
+// Query returns positions lo to hi-1 combined in order, and false if the
+// range is empty.
+func (s *SegmentTree[T]) Query(lo, hi int) (T, bool) {
+	var left, right T
+	haveLeft, haveRight := false, false
+	for lo, hi = lo+s.n, hi+s.n; lo < hi; lo, hi = lo/2, hi/2 {
+		if lo&1 == 1 {
+			if haveLeft {
+				left = s.combine(left, s.nodes[lo])
+			} else {
+				left, haveLeft = s.nodes[lo], true
+			}
+			lo++
+		}
+		if hi&1 == 1 {
+			hi--
+			if haveRight {
+				right = s.combine(s.nodes[hi], right)
+			} else {
+				right, haveRight = s.nodes[hi], true
+			}
+		}
+	}
+	switch {
+	case haveLeft && haveRight:
+		return s.combine(left, right), true
+	case haveLeft:
+		return left, true
+	}
+	return right, haveRight
+}
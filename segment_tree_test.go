@@ -0,0 +1,83 @@
+package rangequery
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSegmentTree(t *testing.T) {
+	r := rand.New(rand.NewPCG(2, 2))
+	for _, n := range []int{0, 1, 2, 3, 5, 8, 13, 100, 1000} {
+		values := make([]int, n)
+		for i := range values {
+			values[i] = r.IntN(2000) - 1000
+		}
+		sums := NewSumTree(slices.Clone(values))
+		mins := NewMinTree(slices.Clone(values))
+		maxes := NewMaxTree(slices.Clone(values))
+		if sums.Len() != n {
+			t.Errorf("Len = %d, want %d", sums.Len(), n)
+		}
+		for range 500 {
+			if n > 0 {
+				i, v := r.IntN(n), r.IntN(2000)-1000
+				values[i] = v
+				for _, s := range []*SegmentTree[int]{sums, mins, maxes} {
+					s.Set(i, v)
+					if s.Get(i) != v {
+						t.Fatalf("n %d: Get(%d) = %d after Set to %d", n, i, s.Get(i), v)
+					}
+				}
+			}
+			lo, hi := r.IntN(n+1), r.IntN(n+1)
+			if lo >= hi {
+				for _, s := range []*SegmentTree[int]{sums, mins, maxes} {
+					if v, ok := s.Query(lo, hi); ok {
+						t.Fatalf("n %d: Query(%d, %d) of an empty range = %d", n, lo, hi, v)
+					}
+				}
+				continue
+			}
+			span := values[lo:hi]
+			want := 0
+			for _, v := range span {
+				want += v
+			}
+			if got, _ := sums.Query(lo, hi); got != want {
+				t.Fatalf("n %d: sum of %d to %d = %d, want %d", n, lo, hi, got, want)
+			}
+			if got, _ := mins.Query(lo, hi); got != slices.Min(span) {
+				t.Fatalf("n %d: min of %d to %d = %d, want %d", n, lo, hi, got, slices.Min(span))
+			}
+			if got, _ := maxes.Query(lo, hi); got != slices.Max(span) {
+				t.Fatalf("n %d: max of %d to %d = %d, want %d", n, lo, hi, got, slices.Max(span))
+			}
+		}
+	}
+}
+
+func TestSegmentTreeOrder(t *testing.T) {
+	// Concatenation is associative but not commutative, so any range
+	// combined out of order shows
+	for _, n := range []int{1, 2, 3, 6, 7, 11, 26} {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = string(rune('a' + i))
+		}
+		s := NewSegmentTree(values, func(a, b string) string { return a + b })
+		for lo := 0; lo < n; lo++ {
+			for hi := lo + 1; hi <= n; hi++ {
+				want := strings.Join(values[lo:hi], "")
+				if got, ok := s.Query(lo, hi); !ok || got != want {
+					t.Fatalf("n %d: Query(%d, %d) = %q, %v, want %q", n, lo, hi, got, ok, want)
+				}
+			}
+		}
+		s.Set(n-1, "Z")
+		if got, _ := s.Query(0, n); !strings.HasSuffix(got, "Z") || len(got) != n {
+			t.Errorf("n %d: Query after Set = %q", n, got)
+		}
+	}
+}
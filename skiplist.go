@@ -0,0 +1,198 @@
+package skiplist
+
+import (
+	"cmp"
+	"iter"
+	"sync"
+)
+
+const (
+	maxLevel = 32
+	// Entries a scan copies out per visit under the lock
+	scanBatch = 64
+)
+
+type node[K cmp.Ordered, V any] struct {
+	key   K
+	value V
+	// next[i] is the following node at level i
+	next []*node[K, V]
+}
+
+// SkipList is an ordered map: a sorted linked list with express lanes.
+// Every node is on level 0, and each is also on the next level up with
+// probability 1/4, so a search skips along the top levels and drops down,
+// in O(log n) expected steps, with no rebalancing on insert or delete.
+// It complements the on-disk B+Tree as an in-memory ordered structure,
+// such as the memtable of an LSM tree. Safe for concurrent use.
+type SkipList[K cmp.Ordered, V any] struct {
+	mu     sync.RWMutex
+	head   node[K, V]
+	level  int // levels in use
+	length int
+	rng    uint64
+}
+
+func New[K cmp.Ordered, V any]() *SkipList[K, V] {
+	return &SkipList[K, V]{
+		head:  node[K, V]{next: make([]*node[K, V], maxLevel)},
+		level: 1,
+		rng:   1,
+	}
+}
+
+// randomLevel returns the level of a new node: 1, then one more with
+// probability 1/4 at a time.
+func (s *SkipList[K, V]) randomLevel() int {
+	// xorshift64
+	s.rng ^= s.rng << 13
+	s.rng ^= s.rng >> 7
+	s.rng ^= s.rng << 17
+	level := 1
+	for r := s.rng; level < maxLevel && r&3 == 0; r >>= 2 {
+		level++
+	}
+	return level
+}
+
+// seek returns, for every level, the last node before key.
+func (s *SkipList[K, V]) seek(key K, update *[maxLevel]*node[K, V]) {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+}
+
+// first returns the first node at or after key.
+func (s *SkipList[K, V]) first(key K) *node[K, V] {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+	}
+	return x.next[0]
+}
+
+// Insert maps key to value, and reports whether key is new.
+func (s *SkipList[K, V]) Insert(key K, value V) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var update [maxLevel]*node[K, V]
+	s.seek(key, &update)
+	if x := update[0].next[0]; x != nil && x.key == key {
+		x.value = value
+		return false
+	}
+
+	level := s.randomLevel()
+	for ; s.level < level; s.level++ {
+		update[s.level] = &s.head
+	}
+	x := &node[K, V]{key: key, value: value, next: make([]*node[K, V], level)}
+	for i := 0; i < level; i++ {
+		x.next[i] = update[i].next[i]
+		update[i].next[i] = x
+	}
+	s.length++
+	return true
+}
+
+func (s *SkipList[K, V]) Get(key K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if x := s.first(key); x != nil && x.key == key {
+		return x.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Delete removes key, returning the value it had.
+func (s *SkipList[K, V]) Delete(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var update [maxLevel]*node[K, V]
+	s.seek(key, &update)
+	x := update[0].next[0]
+	if x == nil || x.key != key {
+		var zero V
+		return zero, false
+	}
+	for i := range x.next {
+		update[i].next[i] = x.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+	return x.value, true
+}
+
+func (s *SkipList[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.length
+}
+
+// RangeScan returns an iterator over the entries with from <= key < to,
+// in key order. It copies entries out a batch at a time and finds its
+// place again by key for the next, so the loop body may modify the list;
+// it sees changes beyond the current batch.
+func (s *SkipList[K, V]) RangeScan(from, to K) iter.Seq2[K, V] {
+	return s.scan(from, &to)
+}
+
+// All returns an iterator over every entry in key order, batched like
+// RangeScan.
+func (s *SkipList[K, V]) All() iter.Seq2[K, V] {
+	return s.scan(*new(K), nil)
+}
+
+// scan iterates from the first key at or after from, or the first key of
+// all when to is nil, up to to.
+func (s *SkipList[K, V]) scan(from K, to *K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		type entry struct {
+			key   K
+			value V
+		}
+		batch := make([]entry, 0, scanBatch)
+		start, after := from, false
+		for {
+			s.mu.RLock()
+			x := s.head.next[0]
+			if to != nil || after {
+				x = s.first(start)
+			}
+			// After the first batch, start is the last key yielded
+			if after && x != nil && x.key == start {
+				x = x.next[0]
+			}
+			batch = batch[:0]
+			for ; x != nil && len(batch) < scanBatch; x = x.next[0] {
+				if to != nil && x.key >= *to {
+					break
+				}
+				batch = append(batch, entry{x.key, x.value})
+			}
+			s.mu.RUnlock()
+
+			for _, e := range batch {
+				if !yield(e.key, e.value) {
+					return
+				}
+			}
+			if len(batch) < scanBatch {
+				return
+			}
+			start, after = batch[len(batch)-1].key, true
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package skiplist
+
+import (
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// checkLevels checks that every level is sorted and holds only nodes of
+// the level below.
+func checkLevels[K int | string, V any](t *testing.T, s *SkipList[K, V]) {
+	t.Helper()
+	var below map[*node[K, V]]bool
+	for i := 0; i < maxLevel; i++ {
+		on := make(map[*node[K, V]]bool)
+		for x := s.head.next[i]; x != nil; x = x.next[i] {
+			if x.next[i] != nil && x.next[i].key <= x.key {
+				t.Fatalf("level %d out of order at %v", i, x.key)
+			}
+			if below != nil && !below[x] {
+				t.Fatalf("node %v on level %d but not %d", x.key, i, i-1)
+			}
+			on[x] = true
+		}
+		if i >= s.level && len(on) > 0 {
+			t.Fatalf("level %d in use, above the %d counted", i, s.level)
+		}
+		below = on
+	}
+}
+
+func TestAgainstMap(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	s := New[int, int]()
+	want := make(map[int]int)
+	for i := range 20000 {
+		k := r.IntN(2000)
+		switch r.IntN(3) {
+		case 0, 1:
+			_, had := want[k]
+			if isNew := s.Insert(k, i); isNew == had {
+				t.Fatalf("Insert(%d) reported new %v, map had it %v", k, isNew, had)
+			}
+			want[k] = i
+		case 2:
+			v, ok := s.Delete(k)
+			if wv, had := want[k]; ok != had || v != wv {
+				t.Fatalf("Delete(%d) = %d, %v, want %d, %v", k, v, ok, wv, had)
+			}
+			delete(want, k)
+		}
+	}
+	if s.Len() != len(want) {
+		t.Errorf("Len = %d, want %d", s.Len(), len(want))
+	}
+	for k := range 2000 {
+		v, ok := s.Get(k)
+		if wv, had := want[k]; ok != had || v != wv {
+			t.Fatalf("Get(%d) = %d, %v, want %d, %v", k, v, ok, wv, had)
+		}
+	}
+	checkLevels(t, s)
+
+	var keys []int
+	for k, v := range s.All() {
+		if v != want[k] {
+			t.Fatalf("All yields %d = %d, want %d", k, v, want[k])
+		}
+		keys = append(keys, k)
+	}
+	if wantKeys := slices.Sorted(maps.Keys(want)); !slices.Equal(keys, wantKeys) {
+		t.Errorf("All yields %d keys, want %d in order", len(keys), len(wantKeys))
+	}
+
+	// Deleting everything lowers the levels back to one
+	for k := range want {
+		s.Delete(k)
+	}
+	if s.Len() != 0 || s.level != 1 {
+		t.Errorf("emptied list: length %d, %d levels", s.Len(), s.level)
+	}
+}
+
+func TestRangeScan(t *testing.T) {
+	s := New[int, string]()
+	for k := 0; k < 1000; k += 2 {
+		s.Insert(k, "v")
+	}
+	for _, tc := range []struct {
+		from, to int
+		first, n int
+	}{
+		{0, 1000, 0, 500},
+		{1, 9, 2, 4},   // 2, 4, 6, 8
+		{10, 10, 0, 0}, // empty
+		{10, 11, 10, 1},
+		{998, 2000, 998, 1},
+		{-5, 1, 0, 1},
+		{5, 3, 0, 0},
+		// Across batch boundaries
+		{100, 400, 100, 150},
+	} {
+		var got []int
+		for k := range s.RangeScan(tc.from, tc.to) {
+			got = append(got, k)
+		}
+		if len(got) != tc.n || tc.n > 0 && (got[0] != tc.first || !slices.IsSorted(got)) {
+			t.Errorf("RangeScan(%d, %d) = %v, want %d keys from %d", tc.from, tc.to, got, tc.n, tc.first)
+		}
+	}
+
+	// Stopping early
+	n := 0
+	for range s.All() {
+		n++
+		if n == scanBatch+3 {
+			break
+		}
+	}
+	if n != scanBatch+3 {
+		t.Errorf("All stopped after %d", n)
+	}
+}
+
+func TestModifyDuringScan(t *testing.T) {
+	s := New[string, int]()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		for i := range 100 {
+			s.Insert(k+string(rune('a'+i%26))+string(rune('a'+i/26)), i)
+		}
+	}
+	// The loop body deletes each key it sees and inserts one beyond the
+	// current batch, which the scan goes on to yield
+	seen := 0
+	sawInserted := false
+	for k := range s.All() {
+		if _, ok := s.Delete(k); !ok && k != "zz" {
+			t.Fatalf("key %q yielded but already gone", k)
+		}
+		if k == "zz" {
+			sawInserted = true
+		}
+		if seen == 0 {
+			s.Insert("zz", 1)
+		}
+		seen++
+	}
+	if seen != 401 || !sawInserted || s.Len() != 0 {
+		t.Errorf("scan yielded %d keys, the inserted one %v, left %d", seen, sawInserted, s.Len())
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	s := New[int, int]()
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range 2000 {
+				k := w*2000 + i
+				s.Insert(k, k)
+				if i%2 == 1 {
+					s.Delete(k)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				prev := -1
+				for k, v := range s.RangeScan(0, 8000) {
+					if k <= prev || v != k {
+						t.Errorf("scan yields %d = %d after %d", k, v, prev)
+						return
+					}
+					prev = k
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s.Len() != 4000 {
+		t.Errorf("Len = %d, want 4000", s.Len())
+	}
+	checkLevels(t, s)
+}
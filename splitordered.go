@@ -1,79 +1,477 @@
 package splitordered
 
 import (
+	"hash/maphash"
+	"iter"
 	"math/bits"
+	"sync"
+	"sync/atomic"
 )
 
 const (
-	segmentBits   = 8
-	segmentSize   = 1 << segmentBits
-	maxSegments   = 1024
-	maxLoadFactor = 4
+	segmentBits = 8
+	segmentSize = 1 << segmentBits
+	// Dummy keys need the top bit clear, which caps the bucket count
+	maxBuckets        = 1 << 63
+	defaultLoadFactor = 4
+	// The table halves once its load falls below loadFactor/shrinkDivisor
+	shrinkDivisor = 8
 )
 
-type node struct {
-	key  uint64
-	next *node
+// node is an element of the split-ordered list: a regular key or the dummy
+// node starting a bucket. soKey is the bit-reversed hash the list is sorted
+// by; keys whose hashes collide share a run of equal soKeys.
+type node[K comparable, V any] struct {
+	soKey uint64
+	key   K
+	next  atomic.Pointer[link[K, V]]
+
+	// See splitordered_arena.go
+	unlinkedAt uint64
+	nextFree   *node[K, V]
 }
 
-type segment [segmentSize]*node
+// link is an immutable successor reference that also carries the value of
+// the node owning it. A node is logically deleted once its own link is
+// marked; mark, value and successor change together with a single CAS on
+// the pointer to a fresh link. ver is the epoch of the write that made it;
+// while snapshots are open, older keeps the link it replaced.
+type link[K comparable, V any] struct {
+	node   *node[K, V]
+	value  V
+	marked bool
+	ver    uint64
+	older  *link[K, V]
+}
 
-type SplitOrderedHash struct {
-	segments [maxSegments]*segment
-	size     uint64
-	count    uint64
+// newLink makes the link replacing old on behalf of w.
+func newLink[K comparable, V any](w guard, old *link[K, V], next *node[K, V], value V, marked bool) *link[K, V] {
+	l := &link[K, V]{node: next, value: value, marked: marked, ver: w.ver}
+	if w.keep {
+		l.older = old
+	}
+	return l
 }
 
-// NewSplitOrderedHash creates an empty hash with initial size 2.
-func NewSplitOrderedHash() *SplitOrderedHash {
-	so := &SplitOrderedHash{size: 2}
-	seg := &segment{}
-	seg[0] = &node{key: so_dummykey(0)}
-	so.segments[0] = seg
-	return so
+type segment[K comparable, V any] [segmentSize]atomic.Pointer[node[K, V]]
+
+// directory maps segment numbers to segments. Level 0 holds segment 0 and
+// level l > 0 holds segments [1<<(l-1), 1<<l), each level allocated the
+// first time the table reaches it. The table can thus keep doubling
+// without ever copying the directory.
+type directory[K comparable, V any] [64]atomic.Pointer[[]atomic.Pointer[segment[K, V]]]
+
+// slot returns the pointer to segment idx, or nil if its level does not
+// exist and create is false.
+func (d *directory[K, V]) slot(idx uint64, create bool) *atomic.Pointer[segment[K, V]] {
+	level := bits.Len64(idx)
+	first := uint64(0)
+	if level > 0 {
+		first = 1 << (level - 1)
+	}
+	slots := d[level].Load()
+	if slots == nil {
+		if !create {
+			return nil
+		}
+		fresh := make([]atomic.Pointer[segment[K, V]], max(first, 1))
+		d[level].CompareAndSwap(nil, &fresh)
+		slots = d[level].Load()
+	}
+	return &(*slots)[idx-first]
 }
 
-// Insert adds key if absent, returns true on success.
-func (so *SplitOrderedHash) Insert(key uint64) bool {
-	soKey := so_regularkey(key)
-	newNode := &node{key: soKey}
+// SplitOrderedMap is the lock-free hash map of Shalev and Shavit: all keys
+// live in one lock-free linked list (Harris/Michael style, with logical
+// deletion) sorted by bit-reversed hash, and buckets are shortcuts into it
+// that are created lazily as the table doubles. It is safe for concurrent
+// use by any number of goroutines.
+type SplitOrderedMap[K comparable, V any] struct {
+	segments directory[K, V]
+	hash     func(K) uint64
+	size     atomic.Uint64
+	count    counter
+	resizes  atomic.Uint64
+
+	loadFactor float64
+	growth     uint64
+	minSize    uint64
+
+	// See splitordered_snapshot.go
+	epoch     atomic.Uint64
+	inflight  [2]counter
+	snapshots atomic.Int64
+	snapMu    sync.Mutex
+	nodes     nodeArena[K, V]
+}
+
+// NewSplitOrderedMap creates an empty map, by default with initial size 2.
+// A nil hash uses maphash with a random seed; WithHasher does not apply.
+func NewSplitOrderedMap[K comparable, V any](hash func(K) uint64, opts ...Option) *SplitOrderedMap[K, V] {
+	m := &SplitOrderedMap[K, V]{}
+	m.init(hash, applyOptions(opts))
+	return m
+}
+
+func (m *SplitOrderedMap[K, V]) init(hash func(K) uint64, o options) {
+	if hash == nil {
+		seed := maphash.MakeSeed()
+		hash = func(key K) uint64 {
+			return maphash.Comparable(seed, key)
+		}
+	}
+	m.hash = hash
+	m.loadFactor = o.loadFactor
+	m.growth = o.growth
+	m.minSize = o.initialSize
+	m.size.Store(o.initialSize)
+	head := &node[K, V]{soKey: so_dummykey(0)}
+	head.next.Store(&link[K, V]{})
+	seg := &segment[K, V]{}
+	seg[0].Store(head)
+	m.segments.slot(0, true).Store(seg)
+}
+
+// Put sets the value of key, adding the key if absent. It returns true if
+// the key was added.
+func (m *SplitOrderedMap[K, V]) Put(key K, value V) bool {
+	return m.put(key, value, true)
+}
+
+// PutIfAbsent adds key with value unless it is already present, returns
+// true on success.
+func (m *SplitOrderedMap[K, V]) PutIfAbsent(key K, value V) bool {
+	return m.put(key, value, false)
+}
+
+func (m *SplitOrderedMap[K, V]) put(key K, value V, replace bool) bool {
+	h := m.hash(key)
+	w := m.enter(h)
+	defer m.exit(w)
+
+	var sz uint64
+	for {
+		sz = m.size.Load()
+		inserted, retired := m.listPut(w, m.bucketHead(h%sz), so_regularkey(h), key, value, replace)
+		if retired {
+			continue
+		}
+		if !inserted {
+			return false
+		}
+		break
+	}
+
+	// Sum the shards only once this key's shard suggests the table is full
+	limit := m.loadFactor * float64(sz)
+	if estimate(m.count.add(h, 1)) > limit && float64(m.count.load()) > limit && sz < maxBuckets {
+		grown := uint64(maxBuckets)
+		if sz <= maxBuckets/m.growth {
+			grown = sz * m.growth
+		}
+		// Losing the race means another insert already grew it
+		if m.size.CompareAndSwap(sz, grown) {
+			m.resizes.Add(1)
+		}
+	}
+	return true
+}
+
+// Get returns the value stored for key. It never changes the list, so
+// lookups do not contend with each other.
+func (m *SplitOrderedMap[K, V]) Get(key K) (V, bool) {
+	h := m.hash(key)
+	w := m.enter(h)
+	defer m.exit(w)
+
+	soKey := so_regularkey(h)
+	curr := m.bucketHead(h % m.size.Load())
+	for curr != nil && (curr.soKey < soKey || curr.soKey == soKey && curr.key != key) {
+		curr = curr.next.Load().node
+	}
+	if curr == nil || curr.soKey != soKey {
+		var zero V
+		return zero, false
+	}
+	l := curr.next.Load()
+	return l.value, !l.marked
+}
+
+// Contains returns true if key exists.
+func (m *SplitOrderedMap[K, V]) Contains(key K) bool {
+	_, ok := m.Get(key)
+	return ok
+}
+
+// Delete removes key if present and returns the value it had.
+func (m *SplitOrderedMap[K, V]) Delete(key K) (V, bool) {
+	h := m.hash(key)
+	w := m.enter(h)
+	defer m.exit(w)
 
 	for {
-		sz := so.size
-		bucket := key % sz
-		_, dummy := so.getBucket(bucket)
+		sz := m.size.Load()
+		value, deleted, retired := m.listDelete(w, m.bucketHead(h%sz), so_regularkey(h), key)
+		if retired {
+			continue
+		}
+		if deleted {
+			m.shrink(w, sz, m.count.add(h, -1))
+		}
+		return value, deleted
+	}
+}
+
+// shrink halves the table once count keys leave it mostly empty, but not
+// below its initial size, then retires the dummy nodes of the upper half
+// of the buckets so lookups no longer step over them.
+func (m *SplitOrderedMap[K, V]) shrink(w guard, sz uint64, shard int64) {
+	if sz <= m.minSize {
+		return
+	}
+	limit := m.loadFactor * float64(sz) / shrinkDivisor
+	if estimate(shard) >= limit || float64(m.count.load()) >= limit {
+		return
+	}
+	// Losing the race means another operation already resized it
+	half := sz / 2
+	if !m.size.CompareAndSwap(sz, half) {
+		return
+	}
+	m.resizes.Add(1)
+
+	var zeroKey K
+	for bucket := sz - 1; bucket >= half; bucket-- {
+		dummy := m.getBucket(bucket)
 		if dummy == nil {
-			so.initializeBucket(bucket, sz)
 			continue
 		}
+		// The bucket's ancestor below half precedes it in the list. An
+		// operation still holding the dummy sees it marked and retries.
+		m.listDelete(w, m.bucketHead(bucket%half), so_dummykey(bucket), zeroKey)
+		m.clearBucket(bucket, dummy)
+	}
+	// Drop the segments that only held retired buckets
+	for seg := (half + segmentSize - 1) / segmentSize; seg < (sz+segmentSize-1)/segmentSize; seg++ {
+		if slot := m.segments.slot(seg, false); slot != nil {
+			slot.Store(nil)
+		}
+	}
+}
 
-		if listInsert(&dummy.next, newNode) {
-			so.count++
-			maxSize := segmentSize * maxSegments
-			if so.count/sz > maxLoadFactor && sz < uint64(maxSize) {
-				so.size = sz * 2
+// Range calls fn for every live key and its value, in split order, until
+// fn returns false. Keys added or removed during the walk may or may not
+// be seen.
+func (m *SplitOrderedMap[K, V]) Range(fn func(key K, value V) bool) {
+	w := m.enter(0)
+	defer m.exit(w)
+
+	for curr := m.getBucket(0).next.Load().node; curr != nil; {
+		l := curr.next.Load()
+		// Dummy nodes have the lowest soKey bit clear
+		if curr.soKey&1 == 1 && !l.marked && !fn(curr.key, l.value) {
+			return
+		}
+		curr = l.node
+	}
+}
+
+// All returns an iterator over the live keys and their values, with the
+// same guarantees as Range.
+func (m *SplitOrderedMap[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys returns an iterator over the live keys.
+func (m *SplitOrderedMap[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.Range(func(key K, _ V) bool { return yield(key) })
+	}
+}
+
+// Values returns an iterator over the values of the live keys.
+func (m *SplitOrderedMap[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.Range(func(_ K, value V) bool { return yield(value) })
+	}
+}
+
+// Stats walks the list and reports how its keys are spread. A chain is the
+// run of keys behind one dummy node, which is what a lookup in that bucket
+// or its uninitialized children steps over. Under concurrent writes the
+// figures are approximate.
+func (m *SplitOrderedMap[K, V]) Stats() HashStats {
+	w := m.enter(0)
+	defer m.exit(w)
+
+	s := HashStats{Buckets: m.size.Load()}
+	chain := 0
+	for curr := m.getBucket(0); curr != nil; {
+		l := curr.next.Load()
+		if !l.marked {
+			if curr.soKey&1 == 0 {
+				if s.DummyNodes > 0 {
+					s.addChain(chain)
+				}
+				s.DummyNodes++
+				chain = 0
+			} else {
+				s.LiveNodes++
+				chain++
 			}
-			return true
 		}
-		return false
+		curr = l.node
+	}
+	s.addChain(chain)
+	s.finish()
+	return s
+}
+
+// Count returns the number of keys in the map.
+func (m *SplitOrderedMap[K, V]) Count() uint64 {
+	return m.count.load()
+}
+
+// Resizes returns how many times the table has doubled or halved.
+func (m *SplitOrderedMap[K, V]) Resizes() uint64 {
+	return m.resizes.Load()
+}
+
+// NewStringMap creates an empty map keyed by strings, hashed with maphash
+// under a random seed. Keys whose hashes collide are told apart by
+// comparing the stored strings.
+func NewStringMap[V any](opts ...Option) *SplitOrderedMap[string, V] {
+	seed := maphash.MakeSeed()
+	return NewSplitOrderedMap[string, V](func(key string) uint64 {
+		return maphash.String(seed, key)
+	}, opts...)
+}
+
+// SplitOrderedHash is a SplitOrderedMap keyed by uint64 keys.
+type SplitOrderedHash struct {
+	SplitOrderedMap[uint64, uint64]
+}
+
+// Option configures a SplitOrderedHash or SplitOrderedMap.
+type Option func(*options)
+
+type options struct {
+	hash        func(uint64) uint64
+	loadFactor  float64
+	growth      uint64
+	initialSize uint64
+	expected    uint64
+}
+
+func applyOptions(opts []Option) options {
+	o := options{hash: mix64, loadFactor: defaultLoadFactor, growth: 2, initialSize: 2}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// Sized here, after the load factor is known whatever the option order
+	if buckets := float64(o.expected) / o.loadFactor; buckets > float64(o.initialSize) {
+		o.initialSize = ceilPow2(uint64(min(buckets, maxBuckets)))
+	}
+	return o
+}
+
+// WithLoadFactor sets the average number of keys per bucket above which
+// the table grows; the sharded key count makes the point approximate.
+// Lower values trade memory for shorter chains. The default is 4.
+func WithLoadFactor(f float64) Option {
+	return func(o *options) {
+		if f > 0 {
+			o.loadFactor = f
+		}
 	}
 }
 
-// Delete removes key if present, returns true on success.
-func (so *SplitOrderedHash) Delete(key uint64) bool {
-	soKey := so_regularkey(key)
-	sz := so.size
-	bucket := key % sz
-	_, dummy := so.getBucket(bucket)
-	if dummy == nil {
-		return false
+// WithGrowthFactor sets by how much the bucket count is multiplied when
+// the table grows, rounded up to a power of two as split ordering needs.
+// The default is 2.
+func WithGrowthFactor(n int) Option {
+	return func(o *options) {
+		if n > 2 {
+			o.growth = ceilPow2(uint64(n))
+		}
 	}
+}
 
-	if listDelete(&dummy.next, soKey) {
-		so.count--
-		return true
+// WithInitialSize sets the starting bucket count, rounded up to a power of
+// two. The table never shrinks below it. The default is 2.
+func WithInitialSize(n uint64) Option {
+	return func(o *options) {
+		if n > 2 {
+			o.initialSize = ceilPow2(n)
+		}
 	}
-	return false
+}
+
+// WithExpectedCount sizes the table for n keys at the load factor, so that
+// filling it does not grow it step by step. Like WithInitialSize, it also
+// sets the size the table never shrinks below.
+func WithExpectedCount(n uint64) Option {
+	return func(o *options) {
+		o.expected = n
+	}
+}
+
+func ceilPow2(x uint64) uint64 {
+	if x > maxBuckets {
+		return maxBuckets
+	}
+	return 1 << bits.Len64(x-1)
+}
+
+// options returns the growth settings the map was created with.
+func (m *SplitOrderedMap[K, V]) options() options {
+	return options{loadFactor: m.loadFactor, growth: m.growth, initialSize: m.minSize}
+}
+
+// WithHasher replaces the default mixing of keys into hashes. Keys the
+// hasher maps to the same value still work, but share a chain.
+func WithHasher(hash func(uint64) uint64) Option {
+	return func(o *options) {
+		o.hash = hash
+	}
+}
+
+// NewSplitOrderedHash creates an empty hash, by default with initial size 2.
+func NewSplitOrderedHash(opts ...Option) *SplitOrderedHash {
+	o := applyOptions(opts)
+	so := &SplitOrderedHash{}
+	so.init(o.hash, o)
+	return so
+}
+
+// mix64 is the splitmix64 finalizer. Buckets are taken from the low bits
+// of the hash, so structured keys such as multiples of 1024 would pile
+// into a few buckets if used as is; mixing spreads every input bit over
+// the whole word. It is a bijection, so distinct keys never collide.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Insert adds key, with value 0, if absent, returns true on success.
+func (so *SplitOrderedHash) Insert(key uint64) bool {
+	return so.PutIfAbsent(key, 0)
+}
+
+// Find checks if a key exists in the hash table
+func (so *SplitOrderedHash) Find(key uint64) bool {
+	return so.Contains(key)
+}
+
+// Range calls fn for every key in the table until fn returns false.
+func (so *SplitOrderedHash) Range(fn func(key uint64) bool) {
+	so.SplitOrderedMap.Range(func(key, _ uint64) bool {
+		return fn(key)
+	})
 }
 
 func so_regularkey(key uint64) uint64 {
@@ -88,45 +486,47 @@ func reverseBits(x uint64) uint64 {
 	return bits.Reverse64(x)
 }
 
-func (so *SplitOrderedHash) getBucket(bucket uint64) (*segment, *node) {
-	idx := bucket / segmentSize
-	seg := so.segments[idx]
+func (m *SplitOrderedMap[K, V]) getBucket(bucket uint64) *node[K, V] {
+	slot := m.segments.slot(bucket/segmentSize, false)
+	if slot == nil {
+		return nil
+	}
+	seg := slot.Load()
 	if seg == nil {
-		return nil, nil
+		return nil
 	}
-	nodePtr := seg[bucket%segmentSize]
-	return seg, nodePtr
+	return seg[bucket%segmentSize].Load()
 }
 
-func (so *SplitOrderedHash) initializeBucket(bucket, size uint64) {
-	maxSize := segmentSize * maxSegments
-	if bucket >= uint64(maxSize) {
-		return
-	}
-	parent := getParent(bucket)
-	if parent >= size {
-		return
-	}
-
-	_, pd := so.getBucket(parent)
-	if pd == nil {
-		so.initializeBucket(parent, size)
-		_, pd = so.getBucket(parent)
-		if pd == nil {
-			return
+// bucketHead returns the bucket's dummy node, creating it first if needed.
+// A dummy retired by a shrink is replaced.
+func (m *SplitOrderedMap[K, V]) bucketHead(bucket uint64) *node[K, V] {
+	if dummy := m.getBucket(bucket); dummy != nil {
+		if !dummy.next.Load().marked {
+			return dummy
 		}
+		m.clearBucket(bucket, dummy)
 	}
-	dummyKey := so_dummykey(bucket)
-	newDummy := &node{key: dummyKey}
-	if listInsert(&pd.next, newDummy) {
-		so.setBucket(bucket, newDummy)
-	} else {
-		curr := pd.next
-		for curr != nil && curr.key < dummyKey {
-			curr = curr.next
-		}
-		if curr != nil && curr.key == dummyKey {
-			so.setBucket(bucket, curr)
+	return m.initializeBucket(bucket)
+}
+
+// initializeBucket links the bucket's dummy node into the list behind its
+// parent's, which is initialized first if necessary. Concurrent callers
+// agree on one dummy node because the list rejects duplicates.
+func (m *SplitOrderedMap[K, V]) initializeBucket(bucket uint64) *node[K, V] {
+	w := m.enter(bucket)
+	defer m.exit(w)
+
+	var zeroKey K
+	var zeroValue V
+	soKey := so_dummykey(bucket)
+	for {
+		// Retry if a shrink retires the parent or the new dummy meanwhile
+		parent := m.bucketHead(getParent(bucket))
+		m.listPut(w, parent, soKey, zeroKey, zeroValue, false)
+		if _, _, dummy, found := m.listFind(w, parent, soKey, zeroKey); found {
+			m.setBucket(bucket, dummy)
+			return dummy
 		}
 	}
 }
@@ -136,75 +536,124 @@ func getParent(bucket uint64) uint64 {
 	return bucket & mask
 }
 
-func (so *SplitOrderedHash) setBucket(bucket uint64, n *node) {
-	idx := bucket / segmentSize
-	seg := so.segments[idx]
+func (m *SplitOrderedMap[K, V]) setBucket(bucket uint64, n *node[K, V]) {
+	slot := m.segments.slot(bucket/segmentSize, true)
+	seg := slot.Load()
 	if seg == nil {
-		seg = &segment{}
-		so.segments[idx] = seg
+		slot.CompareAndSwap(nil, &segment[K, V]{})
+		seg = slot.Load()
 	}
-	seg[bucket%segmentSize] = n
+	seg[bucket%segmentSize].CompareAndSwap(nil, n)
 }
 
-// List operations (single-threaded)
-func listInsert(head **node, newNode *node) bool {
-	prev := head
-	curr := *prev
-	for curr != nil {
-		if curr.key < newNode.key {
-			prev = &curr.next
-			curr = curr.next
-		} else {
-			break
-		}
+func (m *SplitOrderedMap[K, V]) clearBucket(bucket uint64, n *node[K, V]) {
+	slot := m.segments.slot(bucket/segmentSize, false)
+	if slot == nil {
+		return
 	}
-	if curr != nil && curr.key == newNode.key {
-		return false
+	if seg := slot.Load(); seg != nil {
+		seg[bucket%segmentSize].CompareAndSwap(n, nil)
 	}
-	newNode.next = curr
-	*prev = newNode
-	return true
 }
 
-func listDelete(head **node, key uint64) bool {
-	prev := head
-	curr := *prev
-	for curr != nil && curr.key < key {
-		prev = &curr.next
-		curr = curr.next
+// listFind returns the node holding key, or else the first node sorting
+// after it, with its unmarked predecessor and the link of that predecessor
+// pointing at it. Dummy nodes have the zero key and a soKey of their own.
+// Marked nodes met on the way are unlinked. prev is nil if head itself has
+// been retired by a shrink.
+func (m *SplitOrderedMap[K, V]) listFind(w guard, head *node[K, V], soKey uint64, key K) (prev *node[K, V], prevLink *link[K, V], curr *node[K, V], found bool) {
+retry:
+	prev = head
+	prevLink = prev.next.Load()
+	if prevLink.marked {
+		return nil, nil, nil, false
 	}
-	if curr == nil || curr.key != key {
-		return false
+	curr = prevLink.node
+	for curr != nil {
+		currLink := curr.next.Load()
+		if currLink.marked {
+			// Help finish the deletion; if prev changed meanwhile, start over
+			unlinked := newLink(w, prevLink, currLink.node, prevLink.value, false)
+			if !prev.next.CompareAndSwap(prevLink, unlinked) {
+				goto retry
+			}
+			m.nodes.retire(m, curr)
+			prevLink = unlinked
+			curr = currLink.node
+			continue
+		}
+		if curr.soKey > soKey {
+			return prev, prevLink, curr, false
+		}
+		if curr.soKey == soKey && curr.key == key {
+			return prev, prevLink, curr, true
+		}
+		prev, prevLink, curr = curr, currLink, currLink.node
 	}
-	*prev = curr.next
-	return true
+	return prev, prevLink, nil, false
 }
 
-// Contains returns true if key exists.
-func (so *SplitOrderedHash) Contains(key uint64) bool {
-	soKey := so_regularkey(key)
-	_, dummy := so.getBucket(key % so.size)
-	if dummy == nil {
-		return false
-	}
-	curr := dummy.next
-	for curr != nil && curr.key < soKey {
-		curr = curr.next
+// listPut inserts key with value, or when replace is set updates the value
+// of an existing node. inserted reports whether a node was added; retired
+// that head was retired and the caller must look up its bucket again.
+func (m *SplitOrderedMap[K, V]) listPut(w guard, head *node[K, V], soKey uint64, key K, value V, replace bool) (inserted, retired bool) {
+	newNode := m.nodes.alloc()
+	newNode.soKey, newNode.key = soKey, key
+	// Unless it gets linked, nobody else has seen it
+	defer func() {
+		if !inserted {
+			m.nodes.release(newNode)
+		}
+	}()
+	for {
+		prev, prevLink, curr, found := m.listFind(w, head, soKey, key)
+		if prev == nil {
+			return false, true
+		}
+		if !found {
+			newNode.next.Store(&link[K, V]{node: curr, value: value, ver: w.ver})
+			if prev.next.CompareAndSwap(prevLink, newLink(w, prevLink, newNode, prevLink.value, false)) {
+				return true, false
+			}
+			continue
+		}
+		if !replace {
+			return false, false
+		}
+		currLink := curr.next.Load()
+		if currLink.marked {
+			continue
+		}
+		if curr.next.CompareAndSwap(currLink, newLink(w, currLink, currLink.node, value, false)) {
+			return false, false
+		}
 	}
-	return curr != nil && curr.key == soKey
 }
 
-// Find checks if a key exists in the hash table
-func (so *SplitOrderedHash) Find(key uint64) bool {
-	soKey := so_regularkey(key)
-	bucket := key % so.size
-	_, dummy := so.getBucket(bucket)
-	if dummy == nil {
-		return false
-	}
-	curr := dummy.next
-	for curr != nil && curr.key < soKey {
-		curr = curr.next
+// listDelete marks and unlinks the node holding key. retired is as for
+// listPut.
+func (m *SplitOrderedMap[K, V]) listDelete(w guard, head *node[K, V], soKey uint64, key K) (value V, deleted, retired bool) {
+	for {
+		prev, prevLink, curr, found := m.listFind(w, head, soKey, key)
+		if prev == nil {
+			return value, false, true
+		}
+		if !found {
+			return value, false, false
+		}
+		currLink := curr.next.Load()
+		if currLink.marked {
+			continue
+		}
+		// The mark is the linearization point of the delete
+		marked := newLink(w, currLink, currLink.node, currLink.value, true)
+		if !curr.next.CompareAndSwap(currLink, marked) {
+			continue
+		}
+		// Unlink it now if nobody got in between, else a later find will
+		if prev.next.CompareAndSwap(prevLink, newLink(w, prevLink, currLink.node, prevLink.value, false)) {
+			m.nodes.retire(m, curr)
+		}
+		return currLink.value, true, false
 	}
-	return curr != nil && curr.key == soKey
 }
@@ -0,0 +1,127 @@
+package splitordered
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Nodes are carved out of blocks instead of allocated one by one, and the
+// nodes of deleted keys are reused once no operation can still hold them.
+// Every operation registers in the epoch it starts in (see enter), and a
+// node unlinked in epoch e is only handed out again from epoch e+2 on:
+// the epoch moves past e+1 only after the operations of e have exited, and
+// an operation that starts later can no longer reach the node. Snapshots
+// read old links without registering, so nothing is reused while one is
+// open. Dummy nodes are never reused, since stale directory slots may
+// still point at them.
+
+const (
+	nodeBlockSize = 128
+	// Unlinked nodes are sorted into reusable and waiting every this many
+	reclaimBatch = 1024
+)
+
+type nodeBlock[K comparable, V any] struct {
+	nodes [nodeBlockSize]node[K, V]
+	used  int
+}
+
+// nodeArena hands out list nodes. Blocks and free nodes are kept in
+// sync.Pools, so each P mostly allocates from its own and the collector
+// may still drop them when idle. A block stays alive as long as any of its
+// nodes does.
+type nodeArena[K comparable, V any] struct {
+	blocks sync.Pool // *nodeBlock with unused nodes
+	free   sync.Pool // *node past its grace period
+
+	// Unlinked nodes waiting out their grace period, linked by nextFree
+	unlinked atomic.Pointer[node[K, V]]
+	pending  atomic.Int64
+	reused   atomic.Uint64
+}
+
+// alloc returns a node with an empty next link. Its soKey and key are for
+// the caller to set.
+func (a *nodeArena[K, V]) alloc() *node[K, V] {
+	if n, _ := a.free.Get().(*node[K, V]); n != nil {
+		a.reused.Add(1)
+		var zeroKey K
+		n.key, n.nextFree = zeroKey, nil
+		n.next.Store(nil)
+		return n
+	}
+	b, _ := a.blocks.Get().(*nodeBlock[K, V])
+	if b == nil {
+		b = &nodeBlock[K, V]{}
+	}
+	n := &b.nodes[b.used]
+	if b.used++; b.used < nodeBlockSize {
+		a.blocks.Put(b)
+	}
+	return n
+}
+
+// release takes back a node that was never linked into the list.
+func (a *nodeArena[K, V]) release(n *node[K, V]) {
+	a.free.Put(n)
+}
+
+// retire queues n, just removed from the list, for reuse. Only the
+// operation whose CAS unlinked it may call this.
+func (a *nodeArena[K, V]) retire(m *SplitOrderedMap[K, V], n *node[K, V]) {
+	if n.soKey&1 == 0 {
+		return
+	}
+	n.unlinkedAt = m.epoch.Load()
+	a.push(n)
+	if a.pending.Add(1)%reclaimBatch == 0 {
+		a.reclaim(m)
+	}
+}
+
+func (a *nodeArena[K, V]) push(n *node[K, V]) {
+	for {
+		head := a.unlinked.Load()
+		n.nextFree = head
+		if a.unlinked.CompareAndSwap(head, n) {
+			return
+		}
+	}
+}
+
+// reclaim moves the unlinked nodes whose grace period is over to the free
+// pool, first advancing the epoch if the operations of the previous one
+// are all gone. It gives up rather than wait for a snapshot.
+func (a *nodeArena[K, V]) reclaim(m *SplitOrderedMap[K, V]) {
+	if !m.snapMu.TryLock() {
+		return
+	}
+	defer m.snapMu.Unlock()
+	if m.snapshots.Load() > 0 {
+		return
+	}
+	e := m.epoch.Load()
+	if m.inflight[(e+1)&1].load() == 0 {
+		e++
+		m.epoch.Store(e)
+	}
+
+	var freed int64
+	for n := a.unlinked.Swap(nil); n != nil; {
+		next := n.nextFree
+		if n.unlinkedAt+2 <= e {
+			a.free.Put(n)
+			freed++
+		} else {
+			a.push(n)
+		}
+		n = next
+	}
+	a.pending.Add(-freed)
+}
+
+// ReusedNodes returns how many nodes of deleted keys were handed out again
+// instead of being allocated.
+func (m *SplitOrderedMap[K, V]) ReusedNodes() uint64 {
+	return m.nodes.reused.Load()
+}
@@ -0,0 +1,37 @@
+package splitordered
+
+import "sync/atomic"
+
+const counterShards = 32
+
+// counter is a key count spread over cache-line sized shards, so inserts
+// and deletes of different keys do not all hit one atomic. A key always
+// counts against the same shard, chosen from its hash.
+type counter struct {
+	shards [counterShards]struct {
+		n atomic.Int64
+		_ [56]byte
+	}
+}
+
+// add adjusts the shard of hash h by delta and returns the shard's new
+// value.
+func (c *counter) add(h uint64, delta int64) int64 {
+	// Fibonacci hashing: the top bits of the product depend on all of h
+	return c.shards[(h*0x9e3779b97f4a7c15)>>(64-5)].n.Add(delta)
+}
+
+// load sums the shards. An insert and a delete of the same key may be
+// counted out of order, so a shard can briefly go negative.
+func (c *counter) load() uint64 {
+	var sum int64
+	for i := range c.shards {
+		sum += c.shards[i].n.Load()
+	}
+	return uint64(max(sum, 0))
+}
+
+// estimate extrapolates the total from one shard's value.
+func estimate(shard int64) float64 {
+	return float64(shard) * counterShards
+}
@@ -0,0 +1,111 @@
+package splitordered
+
+import (
+	"encoding/binary"
+	"fmt"
+	"manager"
+)
+
+// A saved hash is a chain of hash pages starting at the root page: the
+// common header, then next page(8), entry count(8) and table size(8), then
+// key/value pairs. Only the root's table size is used.
+const (
+	hashNextOffset   = manager.PageHeaderSize
+	hashCountOffset  = hashNextOffset + 8
+	hashSizeOffset   = hashCountOffset + 8
+	hashHeaderSize   = hashSizeOffset + 8
+	hashEntrySize    = 16
+	maxHashPageItems = (manager.PageSize - hashHeaderSize) / hashEntrySize
+)
+
+// Save writes the contents of the hash, as of one instant, to new pages of
+// bm and returns the root page to pass to Load.
+func (so *SplitOrderedHash) Save(bm *manager.BufferManager) (manager.PageID, error) {
+	snap := so.Snapshot()
+	defer snap.Close()
+
+	root, data, err := bm.NewPage()
+	if err != nil {
+		return 0, err
+	}
+	initHashPage(data)
+	binary.BigEndian.PutUint64(data[hashSizeOffset:], so.size.Load())
+
+	pageID, n := root, 0
+	snap.Range(func(key, value uint64) bool {
+		if n == maxHashPageItems {
+			var nextID manager.PageID
+			var next *[manager.PageSize]byte
+			nextID, next, err = bm.NewPage()
+			if err != nil {
+				return false
+			}
+			initHashPage(next)
+			binary.BigEndian.PutUint64(data[hashNextOffset:], uint64(nextID))
+			binary.BigEndian.PutUint64(data[hashCountOffset:], uint64(n))
+			err = bm.UnpinPage(pageID, true)
+			pageID, data, n = nextID, next, 0
+			if err != nil {
+				return false
+			}
+		}
+		entry := data[hashHeaderSize+n*hashEntrySize:]
+		binary.BigEndian.PutUint64(entry, key)
+		binary.BigEndian.PutUint64(entry[8:], value)
+		n++
+		return true
+	})
+	if err != nil {
+		bm.UnpinPage(pageID, true)
+		return 0, err
+	}
+	binary.BigEndian.PutUint64(data[hashCountOffset:], uint64(n))
+	if err := bm.UnpinPage(pageID, true); err != nil {
+		return 0, err
+	}
+	return root, nil
+}
+
+// Load rebuilds a hash saved with Save from its root page. The options
+// must match those the saved hash was created with.
+func Load(bm *manager.BufferManager, root manager.PageID, opts ...Option) (*SplitOrderedHash, error) {
+	so := NewSplitOrderedHash(opts...)
+	for pageID := root; ; {
+		data, err := bm.PinPage(pageID)
+		if err != nil {
+			return nil, err
+		}
+		if t := manager.GetPageType(data); t != manager.PageTypeHash {
+			bm.UnpinPage(pageID, false)
+			return nil, fmt.Errorf("expected hash page, got %v", t)
+		}
+		n := binary.BigEndian.Uint64(data[hashCountOffset:])
+		if n > maxHashPageItems {
+			bm.UnpinPage(pageID, false)
+			return nil, fmt.Errorf("corrupt hash page: %d entries", n)
+		}
+		if pageID == root {
+			// Restore the table size up front instead of regrowing to it
+			if sz := binary.BigEndian.Uint64(data[hashSizeOffset:]); sz > so.size.Load() {
+				so.size.Store(sz)
+			}
+		}
+		for i := uint64(0); i < n; i++ {
+			entry := data[hashHeaderSize+i*hashEntrySize:]
+			so.Put(binary.BigEndian.Uint64(entry), binary.BigEndian.Uint64(entry[8:]))
+		}
+		next := manager.PageID(binary.BigEndian.Uint64(data[hashNextOffset:]))
+		if err := bm.UnpinPage(pageID, false); err != nil {
+			return nil, err
+		}
+		if next == 0 {
+			return so, nil
+		}
+		pageID = next
+	}
+}
+
+func initHashPage(data *[manager.PageSize]byte) {
+	clear(data[:hashHeaderSize])
+	manager.SetPageType(data, manager.PageTypeHash)
+}
@@ -0,0 +1,150 @@
+package splitordered
+
+import (
+	"iter"
+	"runtime"
+)
+
+// Snapshots are multi-version reads of the list. Every operation runs in an
+// epoch and writes stamp the links they make with it; taking a snapshot
+// closes the current epoch and waits for the writes still running in it,
+// so the snapshot sees exactly the links stamped with a closed epoch. While any
+// snapshot is open a new link keeps the one it replaced, and a snapshot
+// reading a link from a later epoch follows older until it finds its own.
+// Writers never wait for snapshots; a node changed while snapshots are open
+// holds on to its old links until it is written again.
+
+// guard is the epoch an operation runs in. h picks the shard of the
+// in-flight counter it is counted in.
+type guard struct {
+	ver  uint64
+	keep bool // snapshots are open, keep replaced links reachable
+	h    uint64
+}
+
+func (m *SplitOrderedMap[K, V]) enter(h uint64) guard {
+	for {
+		e := m.epoch.Load()
+		m.inflight[e&1].add(h, 1)
+		// A snapshot closing e meanwhile may already be past its wait
+		if m.epoch.Load() == e {
+			return guard{ver: e, keep: m.snapshots.Load() > 0, h: h}
+		}
+		m.inflight[e&1].add(h, -1)
+	}
+}
+
+func (m *SplitOrderedMap[K, V]) exit(w guard) {
+	m.inflight[w.ver&1].add(w.h, -1)
+}
+
+// Snapshot is a stable, read-only view of a SplitOrderedMap as of the call
+// to Snapshot. Writers carry on while it is open; Close it when done so
+// they stop keeping old versions.
+type Snapshot[K comparable, V any] struct {
+	m   *SplitOrderedMap[K, V]
+	ver uint64
+}
+
+// Snapshot opens a view of the map's current contents. It waits for the
+// writes already in progress, but reading it costs no more than Range.
+func (m *SplitOrderedMap[K, V]) Snapshot() *Snapshot[K, V] {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+
+	// Counted first, so every write of the next epoch keeps old links
+	m.snapshots.Add(1)
+	e := m.epoch.Load()
+	// Node reuse counts on epoch e+1 only starting once the operations of
+	// e-1, which share its counter, are gone
+	for m.inflight[(e+1)&1].load() != 0 {
+		runtime.Gosched()
+	}
+	m.epoch.Store(e + 1)
+	for m.inflight[e&1].load() != 0 {
+		runtime.Gosched()
+	}
+	return &Snapshot[K, V]{m: m, ver: e}
+}
+
+// visible returns the version of the link the snapshot sees.
+func (s *Snapshot[K, V]) visible(l *link[K, V]) *link[K, V] {
+	for l != nil && l.ver > s.ver {
+		l = l.older
+	}
+	return l
+}
+
+// Range calls fn for every key and value in the snapshot, in split order,
+// until fn returns false.
+func (s *Snapshot[K, V]) Range(fn func(key K, value V) bool) {
+	l := s.visible(s.m.getBucket(0).next.Load())
+	for l != nil && l.node != nil {
+		curr := l.node
+		l = s.visible(curr.next.Load())
+		if l == nil {
+			// Only nodes added after the snapshot lack a visible link,
+			// and those cannot be reached from it
+			panic("splitordered: snapshot reached a newer node")
+		}
+		if curr.soKey&1 == 1 && !l.marked && !fn(curr.key, l.value) {
+			return
+		}
+	}
+}
+
+// All returns an iterator over the keys and values in the snapshot.
+func (s *Snapshot[K, V]) All() iter.Seq2[K, V] {
+	return s.Range
+}
+
+// Keys returns an iterator over the keys in the snapshot.
+func (s *Snapshot[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		s.Range(func(key K, _ V) bool { return yield(key) })
+	}
+}
+
+// Values returns an iterator over the values in the snapshot.
+func (s *Snapshot[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		s.Range(func(_ K, value V) bool { return yield(value) })
+	}
+}
+
+// Close releases the snapshot. It must not be used afterwards.
+func (s *Snapshot[K, V]) Close() {
+	if s.m != nil {
+		s.m.snapshots.Add(-1)
+		s.m = nil
+	}
+}
+
+// Clone returns an independent copy of the map as of one instant, using
+// the same hash function.
+func (m *SplitOrderedMap[K, V]) Clone() *SplitOrderedMap[K, V] {
+	c := &SplitOrderedMap[K, V]{}
+	c.init(m.hash, m.options())
+	m.copyInto(c)
+	return c
+}
+
+// Clone returns an independent copy of the hash.
+func (so *SplitOrderedHash) Clone() *SplitOrderedHash {
+	c := &SplitOrderedHash{}
+	c.init(so.hash, so.options())
+	so.copyInto(&c.SplitOrderedMap)
+	return c
+}
+
+func (m *SplitOrderedMap[K, V]) copyInto(c *SplitOrderedMap[K, V]) {
+	s := m.Snapshot()
+	defer s.Close()
+
+	// Start at the current size so the copy does not regrow step by step
+	c.size.Store(m.size.Load())
+	s.Range(func(key K, value V) bool {
+		c.Put(key, value)
+		return true
+	})
+}
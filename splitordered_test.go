@@ -1,6 +1,13 @@
 package splitordered
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"manager"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -20,7 +27,7 @@ func TestInsertAndContains(t *testing.T) {
 func TestDelete(t *testing.T) {
 	so := NewSplitOrderedHash()
 	so.Insert(42)
-	if !so.Delete(42) {
+	if _, ok := so.Delete(42); !ok {
 		t.Error("Delete failed")
 	}
 	if so.Contains(42) {
@@ -28,17 +35,1019 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestPutGet(t *testing.T) {
+	so := NewSplitOrderedHash()
+	if !so.Put(1, 100) {
+		t.Error("Put of a new key should insert")
+	}
+	if so.Put(1, 200) {
+		t.Error("Put of an existing key should update")
+	}
+	if v, ok := so.Get(1); !ok || v != 200 {
+		t.Errorf("Get(1) = %d, %v", v, ok)
+	}
+	if _, ok := so.Get(2); ok {
+		t.Error("Got non-existent key")
+	}
+	if v, ok := so.Delete(1); !ok || v != 200 {
+		t.Errorf("Delete(1) = %d, %v", v, ok)
+	}
+	if _, ok := so.Get(1); ok {
+		t.Error("Got deleted key")
+	}
+
+	for i := uint64(0); i < 10000; i++ {
+		so.Put(i, i*3)
+	}
+	for i := uint64(0); i < 10000; i++ {
+		if v, ok := so.Get(i); !ok || v != i*3 {
+			t.Fatalf("Get(%d) = %d, %v", i, v, ok)
+		}
+	}
+}
+
+func TestGenericMap(t *testing.T) {
+	m := NewSplitOrderedMap[string, []int](nil)
+	m.Put("a", []int{1})
+	m.Put("b", []int{2, 3})
+	if v, ok := m.Get("b"); !ok || len(v) != 2 {
+		t.Errorf("Get(b) = %v, %v", v, ok)
+	}
+	if m.PutIfAbsent("a", nil) {
+		t.Error("PutIfAbsent replaced an existing key")
+	}
+	if _, ok := m.Delete("a"); !ok || m.Contains("a") {
+		t.Error("Failed to delete a")
+	}
+
+	// Every key hashes alike, so they all share one run of the list
+	c := NewSplitOrderedMap[int, int](func(int) uint64 { return 7 })
+	for i := 0; i < 100; i++ {
+		c.Put(i, -i)
+	}
+	for i := 0; i < 100; i += 2 {
+		c.Delete(i)
+	}
+	for i := 0; i < 100; i++ {
+		v, ok := c.Get(i)
+		if ok != (i%2 == 1) || ok && v != -i {
+			t.Fatalf("Get(%d) = %d, %v", i, v, ok)
+		}
+	}
+}
+
+func TestStringMap(t *testing.T) {
+	m := NewStringMap[int]()
+	for i := 0; i < 1000; i++ {
+		m.Put(fmt.Sprintf("user-%d", i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(fmt.Sprintf("user-%d", i)); !ok || v != i {
+			t.Fatalf("Get(user-%d) = %d, %v", i, v, ok)
+		}
+	}
+	if m.Contains("user-1000") {
+		t.Error("Found a key never added")
+	}
+
+	// Strings with equal hashes are still kept apart
+	c := NewSplitOrderedMap[string, int](func(key string) uint64 { return uint64(len(key)) })
+	c.Put("ab", 1)
+	c.Put("cd", 2)
+	c.Delete("ab")
+	if v, ok := c.Get("cd"); !ok || v != 2 || c.Contains("ab") {
+		t.Errorf("Colliding strings mixed up: cd = %d, %v", v, ok)
+	}
+}
+
+func TestRange(t *testing.T) {
+	so := NewSplitOrderedHash()
+	for i := uint64(0); i < 1000; i++ {
+		so.Insert(i)
+	}
+	for i := uint64(0); i < 1000; i += 3 {
+		so.Delete(i)
+	}
+
+	seen := make(map[uint64]bool)
+	so.Range(func(key uint64) bool {
+		if seen[key] {
+			t.Errorf("Key %d seen twice", key)
+		}
+		seen[key] = true
+		return true
+	})
+	for i := uint64(0); i < 1000; i++ {
+		if seen[i] != (i%3 != 0) {
+			t.Fatalf("Key %d: seen %v", i, seen[i])
+		}
+	}
+	if keys := slices.Collect(so.Keys()); len(keys) != len(seen) {
+		t.Errorf("Keys returned %d keys, want %d", len(keys), len(seen))
+	}
+
+	n := 0
+	so.Range(func(uint64) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Errorf("Range did not stop early, called %d times", n)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	m := NewStringMap[int]()
+	for i := 0; i < 100; i++ {
+		m.Put(fmt.Sprint(i), i)
+	}
+	sum := 0
+	for key, value := range m.All() {
+		if key != fmt.Sprint(value) {
+			t.Fatalf("Key %q has value %d", key, value)
+		}
+		sum += value
+	}
+	if sum != 4950 {
+		t.Errorf("Values add up to %d, want 4950", sum)
+	}
+	if n := len(slices.Collect(m.Keys())); n != 100 {
+		t.Errorf("Keys yielded %d keys, want 100", n)
+	}
+	values := slices.Sorted(m.Values())
+	if values[0] != 0 || values[99] != 99 {
+		t.Errorf("Values yielded %d..%d", values[0], values[99])
+	}
+	n := 0
+	for range m.Keys() {
+		if n++; n == 10 {
+			break
+		}
+	}
+
+	eh := NewExtensibleHash()
+	for i := uint64(0); i < 10; i++ {
+		eh.Insert(i)
+	}
+	if keys := slices.Sorted(eh.Keys()); len(keys) != 10 || keys[9] != 9 {
+		t.Errorf("ExtensibleHash keys: %v", keys)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	so := NewSplitOrderedHash()
+	for i := uint64(0); i < 10000; i++ {
+		so.Put(i, i)
+	}
+	snap := so.Snapshot()
+	defer snap.Close()
+
+	var wg sync.WaitGroup
+	for g := uint64(0); g < 4; g++ {
+		wg.Add(1)
+		go func(g uint64) {
+			defer wg.Done()
+			for i := g; i < 10000; i += 4 {
+				if i%2 == 0 {
+					so.Delete(i)
+				} else {
+					so.Put(i, i+1)
+				}
+				so.Insert(10000 + i)
+			}
+		}(g)
+	}
+
+	check := func() {
+		seen := make(map[uint64]bool)
+		snap.Range(func(key, value uint64) bool {
+			if key != value || key >= 10000 || seen[key] {
+				t.Errorf("Snapshot saw key %d value %d", key, value)
+			}
+			seen[key] = true
+			return true
+		})
+		if len(seen) != 10000 {
+			t.Errorf("Snapshot saw %d keys, want 10000", len(seen))
+		}
+	}
+	check()
+	wg.Wait()
+	check()
+
+	if so.Contains(0) || !so.Contains(19999) {
+		t.Error("Writers did not go through while the snapshot was open")
+	}
+}
+
+func TestClone(t *testing.T) {
+	so := NewSplitOrderedHash()
+	for i := uint64(0); i < 1000; i++ {
+		so.Put(i, i*2)
+	}
+	c := so.Clone()
+	so.Delete(1)
+	c.Put(2, 0)
+	if v, ok := c.Get(1); !ok || v != 2 {
+		t.Errorf("Clone lost key 1: %d, %v", v, ok)
+	}
+	if v, _ := so.Get(2); v != 4 {
+		t.Errorf("Write to the clone reached the original: %d", v)
+	}
+	if len(slices.Collect(c.Keys())) != 1000 {
+		t.Errorf("Clone has %d keys, want 1000", len(slices.Collect(c.Keys())))
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	// A pool smaller than the saved chain, so Load reads evicted pages back
+	bm := manager.NewBufferManagerWithOptions(manager.ManagerOptions{Frames: 3})
+	so := NewSplitOrderedHash()
+	for i := uint64(0); i < 2000; i++ {
+		so.Put(i, i*7)
+	}
+
+	root, err := so.Save(bm)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := Load(bm, root)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if n := len(slices.Collect(loaded.Keys())); n != 2000 {
+		t.Errorf("Loaded %d keys, want 2000", n)
+	}
+	for i := uint64(0); i < 2000; i++ {
+		if v, ok := loaded.Get(i); !ok || v != i*7 {
+			t.Fatalf("Get(%d) = %d, %v after Load", i, v, ok)
+		}
+	}
+	if loaded.size.Load() != so.size.Load() {
+		t.Errorf("Loaded size %d, want %d", loaded.size.Load(), so.size.Load())
+	}
+
+	empty, err := NewSplitOrderedHash().Save(bm)
+	if err != nil {
+		t.Fatalf("Save of an empty hash: %v", err)
+	}
+	if loaded, err := Load(bm, empty); err != nil || len(slices.Collect(loaded.Keys())) != 0 {
+		t.Errorf("Load of an empty hash: %v", err)
+	}
+
+	leaf, data, err := bm.NewPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetPageType(data, manager.PageTypeLeaf)
+	bm.UnpinPage(leaf, true)
+	if _, err := Load(bm, leaf); err == nil {
+		t.Error("Loaded a hash from a leaf page")
+	}
+}
+
+func TestDiskHash(t *testing.T) {
+	// Far fewer frames than pages, so buckets and directory pages are
+	// evicted and read back
+	bm := manager.NewBufferManagerWithOptions(manager.ManagerOptions{Frames: 8})
+	dh, err := NewDiskHash(bm)
+	if err != nil {
+		t.Fatalf("NewDiskHash: %v", err)
+	}
+	const n = 100000
+	for i := uint64(0); i < n; i++ {
+		if added, err := dh.Put(i, i*3); err != nil || !added {
+			t.Fatalf("Put(%d) = %v, %v", i, added, err)
+		}
+	}
+	if added, err := dh.Put(7, 1); err != nil || added {
+		t.Fatalf("Put of an existing key = %v, %v", added, err)
+	}
+	for i := uint64(0); i < n; i += 2 {
+		if deleted, err := dh.Delete(i); err != nil || !deleted {
+			t.Fatalf("Delete(%d) = %v, %v", i, deleted, err)
+		}
+	}
+
+	reopened, err := OpenDiskHash(bm, dh.Root())
+	if err != nil {
+		t.Fatalf("OpenDiskHash: %v", err)
+	}
+	for i := uint64(0); i < n; i++ {
+		want := i * 3
+		if i == 7 {
+			want = 1
+		}
+		v, ok, err := reopened.Get(i)
+		if err != nil || ok != (i%2 == 1) || ok && v != want {
+			t.Fatalf("Get(%d) = %d, %v, %v", i, v, ok, err)
+		}
+	}
+	if count, err := reopened.Count(); err != nil || count != n/2 {
+		t.Errorf("Count = %d, %v, want %d", count, err, n/2)
+	}
+	// 254 entries to a bucket: at least 2^9 slots for 100000 keys
+	if depth, err := reopened.GlobalDepth(); err != nil || depth < 9 {
+		t.Errorf("Global depth %d, %v", depth, err)
+	}
+	if _, err := OpenDiskHash(bm, dh.Root()+1); err == nil {
+		t.Error("Opened a non-root page")
+	}
+}
+
+func TestDiskHashSized(t *testing.T) {
+	bm := manager.NewBufferManagerWithOptions(manager.ManagerOptions{Frames: 64})
+	const n = 200000
+	dh, err := NewDiskHashSized(bm, manager.DefaultFileID, n)
+	if err != nil {
+		t.Fatalf("NewDiskHashSized: %v", err)
+	}
+	// 190 planned to a bucket: 2^11 buckets, over four directory pages
+	sized, err := dh.GlobalDepth()
+	if err != nil || sized != 11 {
+		t.Fatalf("Global depth %d, %v, want 11", sized, err)
+	}
+	for i := uint64(0); i < n; i++ {
+		if added, err := dh.Put(i, i+1); err != nil || !added {
+			t.Fatalf("Put(%d) = %v, %v", i, added, err)
+		}
+	}
+	if depth, err := dh.GlobalDepth(); err != nil || depth > sized+1 {
+		t.Errorf("Global depth %d, %v after filling, sized at %d", depth, err, sized)
+	}
+	reopened, err := OpenDiskHash(bm, dh.Root())
+	if err != nil {
+		t.Fatalf("OpenDiskHash: %v", err)
+	}
+	for i := uint64(0); i < n; i++ {
+		if v, ok, err := reopened.Get(i); err != nil || !ok || v != i+1 {
+			t.Fatalf("Get(%d) = %d, %v, %v", i, v, ok, err)
+		}
+	}
+	if count, err := reopened.Count(); err != nil || count != n {
+		t.Errorf("Count = %d, %v, want %d", count, err, n)
+	}
+}
+
 func TestResize(t *testing.T) {
 	so := NewSplitOrderedHash()
-	initialSize := so.size
+	initialSize := so.size.Load()
 	for i := 0; i < 10; i++ {
 		so.Insert(uint64(i))
 	}
-	if so.size <= initialSize {
+	if so.size.Load() <= initialSize {
 		t.Error("Table did not resize")
 	}
 }
 
+func TestShrink(t *testing.T) {
+	so := NewSplitOrderedHash()
+	for i := uint64(0); i < 100000; i++ {
+		so.Insert(i)
+	}
+	grown := so.size.Load()
+	for i := uint64(0); i < 100000; i++ {
+		if i%1000 != 0 {
+			so.Delete(i)
+		}
+	}
+	if so.size.Load() >= grown/64 {
+		t.Errorf("Table did not shrink: size %d, was %d", so.size.Load(), grown)
+	}
+	for i := uint64(0); i < 100000; i++ {
+		if so.Contains(i) != (i%1000 == 0) {
+			t.Fatalf("Contains(%d) wrong after shrink", i)
+		}
+	}
+	if got := len(slices.Collect(so.Keys())); got != 100 {
+		t.Errorf("Keys returned %d keys, want 100", got)
+	}
+
+	// The retired buckets must come back when it grows again
+	for i := uint64(0); i < 100000; i++ {
+		so.Insert(i)
+	}
+	if so.size.Load() < grown {
+		t.Errorf("Table did not regrow: size %d", so.size.Load())
+	}
+	for i := uint64(0); i < 100000; i++ {
+		if !so.Contains(i) {
+			t.Fatalf("Key %d missing after regrow", i)
+		}
+	}
+}
+
+func TestConcurrentShrink(t *testing.T) {
+	so := NewSplitOrderedHash()
+	const goroutines = 8
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			base := uint64(g) << 32
+			for round := 0; round < 5; round++ {
+				for i := uint64(0); i < 5000; i++ {
+					so.Insert(base + i)
+				}
+				for i := uint64(0); i < 5000; i++ {
+					if _, ok := so.Delete(base + i); !ok {
+						t.Errorf("Failed to delete %d", base+i)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := len(slices.Collect(so.Keys())); n != 0 || so.Count() != 0 {
+		t.Errorf("%d keys left, count %d", n, so.Count())
+	}
+}
+
+func TestNodeReuse(t *testing.T) {
+	so := NewSplitOrderedHash()
+	const goroutines = 8
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			base := uint64(g) << 32
+			for round := uint64(0); round < 20; round++ {
+				for i := uint64(0); i < 1000; i++ {
+					so.Put(base+i, base+i+round)
+				}
+				for i := uint64(0); i < 1000; i++ {
+					// A node reused too early would show another key's value
+					other := uint64((g+1)%goroutines)<<32 + i
+					if v, ok := so.Get(other); ok && v-other >= 20 {
+						t.Errorf("Key %d has value %d", other, v)
+						return
+					}
+					if v, ok := so.Delete(base + i); !ok || v != base+i+round {
+						t.Errorf("Delete(%d) = %d, %v", base+i, v, ok)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if so.ReusedNodes() == 0 {
+		t.Error("No deleted node was reused")
+	}
+	if n := len(slices.Collect(so.Keys())); n != 0 {
+		t.Errorf("%d keys left", n)
+	}
+}
+
+func TestHashMixing(t *testing.T) {
+	so := NewSplitOrderedHash()
+	for i := uint64(0); i < 10000; i++ {
+		so.Insert(i * 1024)
+	}
+	sz := so.size.Load()
+	perBucket := make(map[uint64]int)
+	for i := uint64(0); i < 10000; i++ {
+		perBucket[so.hash(i*1024)%sz]++
+	}
+	for bucket, n := range perBucket {
+		if n > 4*defaultLoadFactor {
+			t.Fatalf("Bucket %d holds %d of the multiples of 1024", bucket, n)
+		}
+	}
+
+	identity := NewSplitOrderedHash(WithHasher(func(key uint64) uint64 { return key }))
+	for i := uint64(0); i < 1000; i++ {
+		identity.Insert(i * 1024)
+	}
+	for i := uint64(0); i < 1000; i++ {
+		if !identity.Contains(i * 1024) {
+			t.Fatalf("Key %d missing with a custom hasher", i*1024)
+		}
+	}
+}
+
+func TestLargeDirectory(t *testing.T) {
+	// Far beyond the 262K buckets a fixed directory used to allow
+	so := NewSplitOrderedHash()
+	so.size.Store(1 << 28)
+	for i := uint64(0); i < 10000; i++ {
+		so.Insert(i)
+	}
+	for i := uint64(0); i < 10000; i++ {
+		if !so.Contains(i) {
+			t.Fatalf("Key %d missing", i)
+		}
+	}
+
+	var d directory[uint64, uint64]
+	seen := make(map[*atomic.Pointer[segment[uint64, uint64]]]bool)
+	for idx := uint64(0); idx < 5000; idx++ {
+		slot := d.slot(idx, true)
+		if seen[slot] {
+			t.Fatalf("Segment %d shares a directory slot", idx)
+		}
+		seen[slot] = true
+	}
+}
+
+func TestGrowthOptions(t *testing.T) {
+	so := NewSplitOrderedHash(WithInitialSize(1000), WithLoadFactor(1), WithGrowthFactor(4))
+	if sz := so.size.Load(); sz != 1024 {
+		t.Fatalf("Initial size %d, want 1024", sz)
+	}
+	// The count is only summed once the inserting key's shard suggests the
+	// table is full, so growth may set in a little past the load factor
+	for i := uint64(0); i < 1536; i++ {
+		so.Insert(i)
+	}
+	if sz := so.size.Load(); sz != 4096 {
+		t.Errorf("Size %d after passing load factor 1, want 4096", sz)
+	}
+	for i := uint64(0); i < 1536; i++ {
+		so.Delete(i)
+	}
+	if sz := so.size.Load(); sz != 1024 {
+		t.Errorf("Shrank to %d, below the initial size", sz)
+	}
+
+	// Sized for the expected count whichever option comes first
+	for _, opts := range [][]Option{
+		{WithExpectedCount(10000), WithLoadFactor(2)},
+		{WithLoadFactor(2), WithExpectedCount(10000)},
+	} {
+		if sz := NewSplitOrderedHash(opts...).size.Load(); sz != 8192 {
+			t.Errorf("Size %d for 10000 keys at load factor 2, want 8192", sz)
+		}
+	}
+	if sz := NewSplitOrderedHash(WithInitialSize(1<<16), WithExpectedCount(100)).size.Load(); sz != 1<<16 {
+		t.Errorf("Expected count shrank the initial size to %d", sz)
+	}
+
+	// Load factor 4 and doubling by default
+	def := NewSplitOrderedHash()
+	for i := uint64(0); i < 9; i++ {
+		def.Insert(i)
+	}
+	if sz := def.size.Load(); sz != 4 {
+		t.Errorf("Default size %d after 9 keys, want 4", sz)
+	}
+}
+
+func TestStats(t *testing.T) {
+	so := NewSplitOrderedHash()
+	eh := NewExtensibleHash()
+	for i := uint64(0); i < 1000; i++ {
+		so.Insert(i)
+		eh.Insert(i)
+	}
+
+	if n := so.Stats().LiveNodes; n != 1000 {
+		t.Errorf("%d live nodes, want 1000", n)
+	}
+	for name, s := range map[string]HashStats{"split-ordered": so.Stats(), "extensible": eh.Stats()} {
+		var chains, keys uint64
+		for n, c := range s.Histogram {
+			chains += c
+			keys += uint64(n) * c
+		}
+		if chains != s.Chains || keys != s.LiveNodes {
+			t.Errorf("%s: histogram holds %d chains and %d keys, want %d and %d", name, chains, keys, s.Chains, s.LiveNodes)
+		}
+		if s.MinChain > s.MaxChain || s.AvgChain < float64(s.MinChain) || s.AvgChain > float64(s.MaxChain) {
+			t.Errorf("%s: inconsistent chain lengths %+v", name, s)
+		}
+	}
+
+	s := so.Stats()
+	if s.DummyNodes != s.Chains || s.DummyNodes > s.Buckets {
+		t.Errorf("%d dummy nodes for %d chains and %d buckets", s.DummyNodes, s.Chains, s.Buckets)
+	}
+	if s.MaxChain > 4*defaultLoadFactor {
+		t.Errorf("Longest chain %d keys with mixed sequential keys", s.MaxChain)
+	}
+}
+
+func TestExtensibleHashStats(t *testing.T) {
+	eh := NewExtensibleHash()
+	for i := uint64(0); i < 1024; i++ {
+		eh.Insert(i)
+	}
+	eh.Insert(1 << 40)
+	s := eh.Stats()
+	if s.Buckets != 1<<s.GlobalDepth {
+		t.Errorf("%d slots at global depth %d", s.Buckets, s.GlobalDepth)
+	}
+	var buckets, slots uint64
+	for d, n := range s.LocalDepths {
+		buckets += n
+		slots += n << (s.GlobalDepth - d)
+	}
+	if buckets != s.Chains || slots != s.Buckets {
+		t.Errorf("Local depths cover %d buckets and %d slots, want %d and %d", buckets, slots, s.Chains, s.Buckets)
+	}
+	if s.LiveNodes != 1025 || s.Occupancy <= 0 || s.Occupancy > 1 {
+		t.Errorf("%d keys, occupancy %v", s.LiveNodes, s.Occupancy)
+	}
+
+	for i := uint64(1); i < 10; i++ {
+		eh.Insert(i << 40)
+	}
+	if s := eh.Stats(); s.OverflowBuckets == 0 {
+		t.Error("Keys sharing their low bits did not overflow")
+	}
+}
+
+func TestLinearHash(t *testing.T) {
+	lh := NewLinearHash()
+	for i := uint64(0); i < 10000; i++ {
+		if !lh.Insert(i * 7) {
+			t.Fatalf("Failed to insert %d", i*7)
+		}
+	}
+	if lh.Insert(70) {
+		t.Error("Inserted a duplicate")
+	}
+	if lh.Count() != 10000 || lh.Resizes() == 0 {
+		t.Errorf("Count %d after %d splits", lh.Count(), lh.Resizes())
+	}
+	// Splits keep the number of buckets in step with the keys
+	s := lh.Stats()
+	if s.Buckets < 10000/lhSplitLoad || s.Buckets > 10000/lhSplitLoad+1 {
+		t.Errorf("%d buckets for 10000 keys", s.Buckets)
+	}
+	for i := uint64(0); i < 10000; i++ {
+		if !lh.Find(i * 7) {
+			t.Fatalf("Key %d lost", i*7)
+		}
+		if lh.Find(i*7 + 1) {
+			t.Fatalf("Found absent key %d", i*7+1)
+		}
+	}
+
+	for i := uint64(0); i < 10000; i++ {
+		if i%100 != 0 && !lh.Delete(i*7) {
+			t.Fatalf("Failed to delete %d", i*7)
+		}
+	}
+	if s := lh.Stats(); s.Buckets > 100 {
+		t.Errorf("%d buckets left for 100 keys", s.Buckets)
+	}
+	keys := slices.Collect(lh.Keys())
+	if len(keys) != 100 {
+		t.Errorf("Keys yielded %d keys, want 100", len(keys))
+	}
+	for _, key := range keys {
+		if key%700 != 0 || !lh.Find(key) {
+			t.Errorf("Unexpected key %d", key)
+		}
+	}
+}
+
+func TestExtensibleHashSaveLoad(t *testing.T) {
+	eh := NewExtensibleHash()
+	for i := uint64(0); i < 3000; i++ {
+		eh.Insert(i * 3)
+	}
+	// Overflow chains too
+	for i := uint64(1); i < 10; i++ {
+		eh.Insert(i << 40)
+	}
+	var buf bytes.Buffer
+	if err := eh.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved := slices.Clone(buf.Bytes())
+
+	loaded, err := LoadExtensibleHash(&buf)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	checkDirectory(t, &loaded.ExtensibleSet)
+	if loaded.Count() != eh.Count() || loaded.globalDepth != eh.globalDepth {
+		t.Errorf("Loaded %d keys at depth %d, want %d at %d", loaded.Count(), loaded.globalDepth, eh.Count(), eh.globalDepth)
+	}
+	for key := range eh.Keys() {
+		if !loaded.Find(key) {
+			t.Fatalf("Key %d lost", key)
+		}
+	}
+	loaded.Insert(1)
+	loaded.Delete(3)
+
+	corrupt := slices.Clone(saved)
+	corrupt[len(corrupt)/2] ^= 1
+	if _, err := LoadExtensibleHash(bytes.NewReader(corrupt)); err == nil {
+		t.Error("Loaded a corrupted hash")
+	}
+	if _, err := LoadExtensibleHash(bytes.NewReader(saved[:len(saved)-1])); err == nil {
+		t.Error("Loaded a truncated hash")
+	}
+}
+
+func TestResizeCount(t *testing.T) {
+	so := NewSplitOrderedHash()
+	eh := NewExtensibleHash()
+	for i := uint64(0); i < 1000; i++ {
+		so.Insert(i)
+		eh.Insert(i)
+	}
+	if so.Resizes() == 0 {
+		t.Error("SplitOrderedHash resizes not counted")
+	}
+	if eh.Resizes() == 0 {
+		t.Error("ExtensibleHash resizes not counted")
+	}
+}
+
+func TestExtensibleHashDirectory(t *testing.T) {
+	eh := NewExtensibleHash()
+	keys := make(map[uint64]bool)
+	for i := uint64(0); i < 5000; i++ {
+		key := i * 0x9e3779b97f4a7c15 >> 7
+		keys[key] = eh.Insert(key)
+	}
+	for key := range keys {
+		if !eh.Find(key) {
+			t.Fatalf("Key %d lost", key)
+		}
+	}
+	if eh.Count() != uint64(len(keys)) {
+		t.Errorf("Count %d, want %d", eh.Count(), len(keys))
+	}
+
+	checkDirectory(t, &eh.ExtensibleSet)
+	if n := len(slices.Collect(eh.Keys())); n != len(keys) {
+		t.Errorf("Keys yielded %d keys, want %d", n, len(keys))
+	}
+}
+
+func TestExtensibleHashShrink(t *testing.T) {
+	eh := NewExtensibleHash()
+	for i := uint64(0); i < 5000; i++ {
+		eh.Insert(i)
+	}
+	depth := eh.globalDepth
+	for i := uint64(0); i < 5000; i++ {
+		if i%100 != 0 && !eh.Delete(i) {
+			t.Fatalf("Failed to delete %d", i)
+		}
+	}
+	checkDirectory(t, &eh.ExtensibleSet)
+	if eh.globalDepth >= depth {
+		t.Errorf("Global depth %d after deleting 99%% of the keys, was %d", eh.globalDepth, depth)
+	}
+	for i := uint64(0); i < 5000; i += 100 {
+		if !eh.Find(i) {
+			t.Fatalf("Key %d lost by merging", i)
+		}
+	}
+	for i := uint64(0); i < 5000; i += 100 {
+		eh.Delete(i)
+	}
+	if len(eh.directory) != 1 || eh.directory[0].Load().localDepth != 0 {
+		t.Errorf("Empty table kept %d slots", len(eh.directory))
+	}
+	checkDirectory(t, &eh.ExtensibleSet)
+}
+
+func TestExtensibleHashOverflow(t *testing.T) {
+	eh := NewExtensibleHash()
+	// No split can tell these apart below maxGlobalDepth bits
+	for i := uint64(0); i < 1000; i++ {
+		if !eh.Insert(i << 32) {
+			t.Fatalf("Failed to insert %d", i<<32)
+		}
+	}
+	eh.Insert(1)
+	checkDirectory(t, &eh.ExtensibleSet)
+	if eh.globalDepth > 1 {
+		t.Errorf("Directory doubled to global depth %d for inseparable keys", eh.globalDepth)
+	}
+	if s := eh.Stats(); s.MaxChain != 1000 || s.LiveNodes != 1001 {
+		t.Errorf("Longest chain %d, %d keys", s.MaxChain, s.LiveNodes)
+	}
+	for i := uint64(0); i < 1000; i++ {
+		if !eh.Find(i << 32) {
+			t.Fatalf("Key %d lost", i<<32)
+		}
+	}
+
+	// Keys agreeing in their low maxGlobalDepth bits stop the directory there
+	for i := uint64(1); i < 100; i++ {
+		eh.Insert(i<<maxGlobalDepth | 5)
+	}
+	checkDirectory(t, &eh.ExtensibleSet)
+	if eh.globalDepth > maxGlobalDepth {
+		t.Errorf("Global depth %d", eh.globalDepth)
+	}
+
+	for i := uint64(0); i < 1000; i++ {
+		if !eh.Delete(i << 32) {
+			t.Fatalf("Failed to delete %d", i<<32)
+		}
+	}
+	checkDirectory(t, &eh.ExtensibleSet)
+	if eh.Count() != 100 || len(slices.Collect(eh.Keys())) != 100 {
+		t.Errorf("Count %d after deleting the overflowing keys", eh.Count())
+	}
+}
+
+func TestExtensibleSet(t *testing.T) {
+	names := NewExtensibleSet[string](NewComparableHasher[string]())
+	for i := 0; i < 1000; i++ {
+		names.Insert(fmt.Sprint("user-", i))
+	}
+	if names.Insert("user-7") || !names.Find("user-999") || names.Find("user-1000") {
+		t.Error("String set lookups")
+	}
+	checkDirectory(t, names)
+
+	blobs := NewExtensibleSet[[]byte](NewBytesHasher())
+	for i := 0; i < 1000; i++ {
+		blobs.Insert([]byte(fmt.Sprint(i)))
+	}
+	if !blobs.Find([]byte("42")) || !blobs.Delete([]byte("42")) || blobs.Find([]byte("42")) {
+		t.Error("Byte slice keys compare by content")
+	}
+	checkDirectory(t, blobs)
+
+	type point struct{ X, Y int32 }
+	points := NewExtensibleSet[point](NewComparableHasher[point]())
+	for x := int32(0); x < 30; x++ {
+		for y := int32(0); y < 30; y++ {
+			points.Insert(point{x, y})
+		}
+	}
+	if points.Count() != 900 || !points.Find(point{29, 29}) {
+		t.Errorf("Struct set holds %d points", points.Count())
+	}
+
+	// Mixing spreads keys the identity hash would pile into one bucket
+	ids := NewExtensibleSet[uint64](Mix64Hasher{})
+	for i := uint64(0); i < 1000; i++ {
+		ids.Insert(i << 32)
+	}
+	if s := ids.Stats(); s.MaxChain > maxBucketSize {
+		t.Errorf("Longest chain %d keys with mixed shifted keys", s.MaxChain)
+	}
+	checkDirectory(t, ids)
+}
+
+func TestExtensibleHashConcurrent(t *testing.T) {
+	eh := NewExtensibleSet[uint64](Mix64Hasher{})
+	const goroutines = 8
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			base := uint64(g) << 32
+			for round := 0; round < 5; round++ {
+				for i := uint64(0); i < 2000; i++ {
+					if !eh.Insert(base + i) {
+						t.Errorf("Failed to insert %d", base+i)
+						return
+					}
+				}
+				for i := uint64(0); i < 2000; i++ {
+					if !eh.Find(base + i) {
+						t.Errorf("Key %d lost", base+i)
+						return
+					}
+				}
+				// Leave every tenth key, so merges and splits interleave
+				for i := uint64(0); i < 2000; i++ {
+					if i%10 != 0 || round < 4 {
+						if !eh.Delete(base + i) {
+							t.Errorf("Failed to delete %d", base+i)
+							return
+						}
+					}
+				}
+				eh.Stats()
+			}
+		}(g)
+	}
+	wg.Wait()
+	checkDirectory(t, eh)
+	if n := eh.Count(); n != goroutines*200 {
+		t.Errorf("Count %d, want %d", n, goroutines*200)
+	}
+}
+
+// checkDirectory verifies the extendible hashing invariants.
+func checkDirectory[K any](t *testing.T, eh *ExtensibleSet[K]) {
+	t.Helper()
+	if len(eh.directory) != 1<<eh.globalDepth {
+		t.Fatalf("%d slots at global depth %d", len(eh.directory), eh.globalDepth)
+	}
+	atGlobal := 0
+	for i := range eh.directory {
+		bucket := eh.directory[i].Load()
+		if bucket.localDepth == eh.globalDepth {
+			atGlobal++
+		}
+		step := 1 << bucket.localDepth
+		if bucket.merged || bucket.prefix != uint64(i%step) {
+			t.Fatalf("Slot %d: bucket with prefix %d, merged %v", i, bucket.prefix, bucket.merged)
+		}
+		if bucket.localDepth > eh.globalDepth {
+			t.Fatalf("Slot %d: local depth %d above global %d", i, bucket.localDepth, eh.globalDepth)
+		}
+		// Slots agreeing in the low localDepth bits share the bucket
+		for j := i % step; j < len(eh.directory); j += step {
+			if eh.directory[j].Load() != bucket {
+				t.Fatalf("Slots %d and %d differ at local depth %d", i, j, bucket.localDepth)
+			}
+		}
+		// and its buddy at the last local depth bit does not
+		if step > 1 && eh.directory[i^step>>1].Load() == bucket {
+			t.Fatalf("Slots %d and %d share a bucket of local depth %d", i, i^step>>1, bucket.localDepth)
+		}
+		for b := bucket; b != nil; b = b.overflow {
+			for _, key := range b.items {
+				if int(eh.hasher.Hash(key)%uint64(step)) != i%step {
+					t.Fatalf("Key %v in the bucket of slot %d", key, i)
+				}
+			}
+			if b.overflow != nil && len(b.items) != maxBucketSize {
+				t.Fatalf("Slot %d: %d keys in a bucket with overflow", i, len(b.items))
+			}
+		}
+	}
+	if atGlobal != int(eh.atGlobal.Load()) {
+		t.Fatalf("%d buckets at global depth, counted %d", atGlobal, eh.atGlobal.Load())
+	}
+}
+
+func TestConcurrentInsertDelete(t *testing.T) {
+	so := NewSplitOrderedHash()
+	const goroutines = 8
+	const perGoroutine = 20000
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			base := uint64(g * perGoroutine)
+			for i := uint64(0); i < perGoroutine; i++ {
+				if !so.Insert(base + i) {
+					t.Errorf("Insert failed for %d", base+i)
+				}
+			}
+			// Delete the odd keys again while other goroutines still insert
+			for i := uint64(1); i < perGoroutine; i += 2 {
+				if _, ok := so.Delete(base + i); !ok {
+					t.Errorf("Delete failed for %d", base+i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if got := so.Count(); got != goroutines*perGoroutine/2 {
+		t.Errorf("Expected count %d, got %d", goroutines*perGoroutine/2, got)
+	}
+	for k := uint64(0); k < goroutines*perGoroutine; k++ {
+		if so.Contains(k) != (k%2 == 0) {
+			t.Fatalf("Contains(%d) = %v", k, so.Contains(k))
+		}
+	}
+}
+
+func TestConcurrentSameKey(t *testing.T) {
+	so := NewSplitOrderedHash()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted, deleted := 0, 0
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				ins := so.Insert(7)
+				_, del := so.Delete(7)
+				mu.Lock()
+				if ins {
+					inserted++
+				}
+				if del {
+					deleted++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if inserted != deleted || so.Contains(7) {
+		t.Errorf("inserted %d, deleted %d, contains %v", inserted, deleted, so.Contains(7))
+	}
+}
+
 func TestManyItems(t *testing.T) {
 	so := NewSplitOrderedHash()
 	n := 10000
@@ -73,8 +1082,8 @@ func TestLargeScale(t *testing.T) {
 				t.Errorf("Failed to insert %d", i)
 			}
 		}
-		if so.count != numItems {
-			t.Errorf("Expected count %d, got %d", numItems, so.count)
+		if so.Count() != numItems {
+			t.Errorf("Expected count %d, got %d", numItems, so.Count())
 		}
 	})
 
@@ -90,12 +1099,12 @@ func TestLargeScale(t *testing.T) {
 	// Delete all items
 	t.Run("Delete 100K items", func(t *testing.T) {
 		for i := uint64(0); i < numItems; i++ {
-			if !so.Delete(i) {
+			if _, ok := so.Delete(i); !ok {
 				t.Errorf("Failed to delete %d", i)
 			}
 		}
-		if so.count != 0 {
-			t.Errorf("Expected count 0, got %d", so.count)
+		if so.Count() != 0 {
+			t.Errorf("Expected count 0, got %d", so.Count())
 		}
 	})
 }
@@ -111,8 +1120,8 @@ func TestMillionItems(t *testing.T) {
 				t.Errorf("Failed to insert %d", i)
 			}
 		}
-		if so.count != numItems {
-			t.Errorf("Expected count %d, got %d", numItems, so.count)
+		if so.Count() != numItems {
+			t.Errorf("Expected count %d, got %d", numItems, so.Count())
 		}
 	})
 
@@ -128,12 +1137,12 @@ func TestMillionItems(t *testing.T) {
 	// Delete all items
 	t.Run("Delete 1M items", func(t *testing.T) {
 		for i := uint64(0); i < numItems; i++ {
-			if !so.Delete(i) {
+			if _, ok := so.Delete(i); !ok {
 				t.Errorf("Failed to delete %d", i)
 			}
 		}
-		if so.count != 0 {
-			t.Errorf("Expected count 0, got %d", so.count)
+		if so.Count() != 0 {
+			t.Errorf("Expected count 0, got %d", so.Count())
 		}
 	})
 }
@@ -237,3 +1246,365 @@ func BenchmarkMillionItems(b *testing.B) {
 		}
 	})
 }
+
+func TestHopscotchHash(t *testing.T) {
+	hh := NewHopscotchHash()
+	for i := uint64(0); i < 20000; i++ {
+		if !hh.Insert(i * 5) {
+			t.Fatalf("Failed to insert %d", i*5)
+		}
+	}
+	if hh.Insert(50) {
+		t.Error("Inserted a duplicate")
+	}
+	if hh.Count() != 20000 || hh.Resizes() == 0 {
+		t.Errorf("Count %d after %d resizes", hh.Count(), hh.Resizes())
+	}
+	checkNeighborhoods(t, hh)
+	for i := uint64(0); i < 20000; i++ {
+		if !hh.Find(i * 5) {
+			t.Fatalf("Key %d lost", i*5)
+		}
+		if hh.Find(i*5 + 1) {
+			t.Fatalf("Found absent key %d", i*5+1)
+		}
+	}
+
+	for i := uint64(0); i < 20000; i++ {
+		if i%100 != 0 && !hh.Delete(i*5) {
+			t.Fatalf("Failed to delete %d", i*5)
+		}
+	}
+	if hh.Delete(1) {
+		t.Error("Deleted an absent key")
+	}
+	checkNeighborhoods(t, hh)
+	keys := slices.Collect(hh.Keys())
+	if len(keys) != 200 {
+		t.Errorf("Keys yielded %d keys, want 200", len(keys))
+	}
+	for _, key := range keys {
+		if key%500 != 0 || !hh.Find(key) {
+			t.Errorf("Unexpected key %d", key)
+		}
+	}
+}
+
+// checkNeighborhoods checks that every key is within hopRange of its home
+// and that the bitmaps mark exactly the slots holding keys.
+func checkNeighborhoods(t *testing.T, hh *HopscotchHash) {
+	t.Helper()
+	mask := len(hh.keys) - 1
+	marked := make([]bool, len(hh.keys))
+	for home, hop := range hh.hop {
+		for d := 0; d < hopRange; d++ {
+			if hop&(1<<d) == 0 {
+				continue
+			}
+			i := (home + d) & mask
+			if !hh.used[i] || hh.home(hh.keys[i]) != home {
+				t.Fatalf("Slot %d marked for home %d", i, home)
+			}
+			marked[i] = true
+		}
+	}
+	for i, used := range hh.used {
+		if used != marked[i] {
+			t.Fatalf("Slot %d used %v, marked %v", i, used, marked[i])
+		}
+	}
+}
+
+func TestRobinHoodMap(t *testing.T) {
+	rh := NewRobinHoodMap()
+	for i := uint64(0); i < 20000; i++ {
+		if !rh.Put(i*3, i) {
+			t.Fatalf("Put(%d) did not insert", i*3)
+		}
+	}
+	if rh.Put(30, 0) {
+		t.Error("Put of an existing key inserted")
+	}
+	if v, ok := rh.Get(30); !ok || v != 0 {
+		t.Errorf("Get(30) = %d, %v after update", v, ok)
+	}
+	rh.Put(30, 10)
+	checkRobinHood(t, rh)
+	for i := uint64(0); i < 20000; i++ {
+		if v, ok := rh.Get(i * 3); !ok || v != i {
+			t.Fatalf("Get(%d) = %d, %v", i*3, v, ok)
+		}
+		if rh.Contains(i*3 + 1) {
+			t.Fatalf("Found absent key %d", i*3+1)
+		}
+	}
+	s := rh.ProbeStats()
+	if s.Keys != 20000 || s.MaxProbe == 0 || s.AvgProbe > 4 {
+		t.Errorf("Probe stats: %d keys, max %d, avg %.2f", s.Keys, s.MaxProbe, s.AvgProbe)
+	}
+
+	for i := uint64(0); i < 20000; i++ {
+		if i%100 != 0 {
+			if v, ok := rh.Delete(i * 3); !ok || v != i {
+				t.Fatalf("Delete(%d) = %d, %v", i*3, v, ok)
+			}
+		}
+	}
+	if _, ok := rh.Delete(1); ok {
+		t.Error("Deleted an absent key")
+	}
+	// Deletes shift keys back rather than leave gaps, and shrink the table
+	checkRobinHood(t, rh)
+	if s := rh.ProbeStats(); s.Slots > 1024 {
+		t.Errorf("%d slots left for %d keys", s.Slots, s.Keys)
+	}
+	n := 0
+	for key, value := range rh.All() {
+		if key != value*3 || key%300 != 0 {
+			t.Errorf("Unexpected key %d value %d", key, value)
+		}
+		n++
+	}
+	if n != 200 || rh.Count() != 200 {
+		t.Errorf("All yielded %d keys, Count %d, want 200", n, rh.Count())
+	}
+}
+
+// checkRobinHood checks each slot's recorded distance from its key's home,
+// and that no key follows one nearer home by more than one slot.
+func checkRobinHood(t *testing.T, rh *RobinHoodMap) {
+	t.Helper()
+	mask := len(rh.keys) - 1
+	for i, d := range rh.dist {
+		if d == 0 {
+			continue
+		}
+		if (i-rh.home(rh.keys[i]))&mask != int(d-1) {
+			t.Fatalf("Slot %d holds key %d at distance %d", i, rh.keys[i], d-1)
+		}
+		if prev := rh.dist[(i-1)&mask]; d > prev+1 {
+			t.Fatalf("Slot %d at distance %d follows one at %d", i, d-1, int(prev)-1)
+		}
+	}
+}
+
+func TestSwissMap(t *testing.T) {
+	sm := NewSwissMap()
+	for i := uint64(0); i < 20000; i++ {
+		if !sm.Put(i*3, i) {
+			t.Fatalf("Put(%d) did not insert", i*3)
+		}
+	}
+	if sm.Put(30, 10) {
+		t.Error("Put of an existing key inserted")
+	}
+	for i := uint64(0); i < 20000; i++ {
+		if v, ok := sm.Get(i * 3); !ok || v != i {
+			t.Fatalf("Get(%d) = %d, %v", i*3, v, ok)
+		}
+		if sm.Contains(i*3 + 1) {
+			t.Fatalf("Found absent key %d", i*3+1)
+		}
+	}
+	if s := sm.ProbeStats(); s.Keys != 20000 || s.AvgProbe > 1 {
+		t.Errorf("Probe stats: %d keys, max %d, avg %.2f", s.Keys, s.MaxProbe, s.AvgProbe)
+	}
+
+	// Churn leaves tombstones behind; deleted keys must stay gone and the
+	// rest reachable past them
+	for round := uint64(0); round < 5; round++ {
+		for i := uint64(0); i < 20000; i += 2 {
+			sm.Delete(i * 3)
+		}
+		for i := uint64(0); i < 20000; i += 2 {
+			sm.Put(i*3, i)
+		}
+	}
+	for i := uint64(0); i < 20000; i++ {
+		if i%100 != 0 {
+			if v, ok := sm.Delete(i * 3); !ok || v != i {
+				t.Fatalf("Delete(%d) = %d, %v", i*3, v, ok)
+			}
+		}
+	}
+	if _, ok := sm.Delete(3); ok {
+		t.Error("Deleted a key twice")
+	}
+	if s := sm.ProbeStats(); s.Slots > 2048 {
+		t.Errorf("%d slots left for %d keys", s.Slots, s.Keys)
+	}
+	n := 0
+	for key, value := range sm.All() {
+		if key != value*3 || key%300 != 0 || !sm.Contains(key) {
+			t.Errorf("Unexpected key %d value %d", key, value)
+		}
+		n++
+	}
+	if n != 200 || sm.Count() != 200 {
+		t.Errorf("All yielded %d keys, Count %d, want 200", n, sm.Count())
+	}
+
+	var word [8]byte
+	copy(word[:], []byte{5, swissEmpty, 0x7F, swissDeleted, 5, 6, swissEmpty, 0})
+	w := binary.LittleEndian.Uint64(word[:])
+	if m := swissMatch(w, 5); m&(0x80|0x80<<32) != 0x80|0x80<<32 {
+		t.Errorf("swissMatch(5) = %#x", m)
+	}
+	if m := swissMatchEmpty(w); m != 0x80<<8|0x80<<48 {
+		t.Errorf("swissMatchEmpty = %#x", m)
+	}
+}
+
+func TestCuckooHash(t *testing.T) {
+	ch := NewCuckooHash()
+	for i := uint64(0); i < 20000; i++ {
+		if !ch.Insert(i * 5) {
+			t.Fatalf("Failed to insert %d", i*5)
+		}
+	}
+	if ch.Insert(50) {
+		t.Error("Inserted a duplicate")
+	}
+	if ch.Count() != 20000 || ch.Resizes() == 0 {
+		t.Errorf("Count %d after %d resizes", ch.Count(), ch.Resizes())
+	}
+	checkCuckoo(t, ch)
+	for i := uint64(0); i < 20000; i++ {
+		if !ch.Find(i * 5) {
+			t.Fatalf("Key %d lost", i*5)
+		}
+		if ch.Find(i*5 + 1) {
+			t.Fatalf("Found absent key %d", i*5+1)
+		}
+	}
+
+	for i := uint64(0); i < 20000; i++ {
+		if i%100 != 0 && !ch.Delete(i*5) {
+			t.Fatalf("Failed to delete %d", i*5)
+		}
+	}
+	if ch.Delete(1) {
+		t.Error("Deleted an absent key")
+	}
+	checkCuckoo(t, ch)
+	keys := slices.Collect(ch.Keys())
+	if len(keys) != 200 {
+		t.Errorf("Keys yielded %d keys, want 200", len(keys))
+	}
+	for _, key := range keys {
+		if key%500 != 0 || !ch.Find(key) {
+			t.Errorf("Unexpected key %d", key)
+		}
+	}
+
+	// Keys that pick the same buckets in both tables overflow into the
+	// stash before the tables grow
+	ch = NewCuckooHash()
+	b0, b1 := ch.bucket(0, 0), ch.bucket(1, 0)
+	var same []uint64
+	for k := uint64(0); len(same) < 2*cuckooWays+2; k++ {
+		if ch.bucket(0, k) == b0 && ch.bucket(1, k) == b1 {
+			same = append(same, k)
+		}
+	}
+	for _, k := range same {
+		ch.Insert(k)
+	}
+	if ch.Stashed() != 2 || ch.Resizes() != 0 {
+		t.Errorf("%d keys stashed after %d resizes, want 2 and 0", ch.Stashed(), ch.Resizes())
+	}
+	ch.Delete(same[0])
+	if ch.Stashed() != 1 {
+		t.Errorf("Delete left %d keys stashed, want 1", ch.Stashed())
+	}
+	for _, k := range same[1:] {
+		if !ch.Find(k) {
+			t.Errorf("Key %d lost", k)
+		}
+	}
+}
+
+// checkCuckoo checks that every key is in one of its two buckets or the
+// stash, and only once.
+func checkCuckoo(t *testing.T, ch *CuckooHash) {
+	t.Helper()
+	seen := make(map[uint64]bool)
+	for n, table := range ch.tables {
+		for i := range table {
+			b := &table[i]
+			for j, used := range b.used {
+				if !used {
+					continue
+				}
+				key := b.keys[j]
+				if ch.bucket(n, key) != b || seen[key] {
+					t.Fatalf("Key %d misplaced in table %d", key, n)
+				}
+				seen[key] = true
+			}
+		}
+	}
+	for _, key := range ch.stash {
+		if seen[key] {
+			t.Fatalf("Stashed key %d also in the tables", key)
+		}
+		seen[key] = true
+	}
+	if uint64(len(seen)) != ch.count {
+		t.Fatalf("%d keys stored, count %d", len(seen), ch.count)
+	}
+}
+
+func TestCuckooFilter(t *testing.T) {
+	cf := NewCuckooFilter(10000, 0.01)
+	for i := uint64(0); i < 10000; i++ {
+		if !cf.Insert(i * 3) {
+			t.Fatalf("Filter full after %d keys", i)
+		}
+	}
+	for i := uint64(0); i < 10000; i++ {
+		if !cf.Contains(i * 3) {
+			t.Fatalf("Key %d missing", i*3)
+		}
+	}
+	fp := 0
+	for i := uint64(0); i < 100000; i++ {
+		if cf.Contains(1<<40 + i) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 100000; rate > 0.02 {
+		t.Errorf("False positive rate %.4f, want about 0.01", rate)
+	}
+
+	for i := uint64(0); i < 10000; i += 2 {
+		if !cf.Delete(i * 3) {
+			t.Fatalf("Failed to delete %d", i*3)
+		}
+	}
+	if cf.Count() != 5000 {
+		t.Errorf("Count %d after deletes, want 5000", cf.Count())
+	}
+	for i := uint64(1); i < 10000; i += 2 {
+		if !cf.Contains(i * 3) {
+			t.Fatalf("Key %d lost to a delete", i*3)
+		}
+	}
+
+	// Filling it past capacity fails inserts but never loses a key
+	n := uint64(0)
+	for ; cf.Insert(1<<50 + n); n++ {
+	}
+	if cf.LoadFactor() < 0.9 {
+		t.Errorf("Filter full at load %.2f", cf.LoadFactor())
+	}
+	for i := uint64(0); i < n; i++ {
+		if !cf.Contains(1<<50 + i) {
+			t.Fatalf("Key %d lost when the filter filled", 1<<50+i)
+		}
+	}
+	cf.Delete(3)
+	if !cf.Insert(3) {
+		t.Error("No room after a delete")
+	}
+}
@@ -0,0 +1,412 @@
+package sstable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"iter"
+	"sort"
+
+	"bloom"
+)
+
+const (
+	// DefaultBlockSize is the size a data block is cut at when Options
+	// sets none; blocks end at the first entry to reach it.
+	DefaultBlockSize = 4096
+	// DefaultFPRate is the Bloom filter's false-positive rate when Options
+	// sets none.
+	DefaultFPRate = 0.01
+
+	tableMagic = 0x5353544231000000 // "SSTB1"
+	footerSize = 6 * 8
+
+	kindPut       = 1
+	kindTombstone = 2
+)
+
+var (
+	// ErrOrder is returned by a Writer given a key not above the last.
+	ErrOrder = errors.New("sstable: keys out of order")
+	// ErrClosed is returned by a Writer used after Close.
+	ErrClosed = errors.New("sstable: writer closed")
+	// ErrCorrupt is returned when a table fails its checks.
+	ErrCorrupt = errors.New("sstable: corrupt table")
+)
+
+// Entry is a key and its value, or a tombstone recording that the key was
+// deleted, which an LSM tree keeps so that older tables' values for the
+// key stay hidden.
+type Entry struct {
+	Key       []byte
+	Value     []byte
+	Tombstone bool
+}
+
+// Options configures a Writer.
+type Options struct {
+	BlockSize int
+	FPRate    float64
+}
+
+// Writer writes an immutable sorted table: entries added in strictly
+// increasing key order, compared bytewise, cut into data blocks, then a
+// Bloom filter of the keys, an index of the blocks and a footer. The
+// format, integers big-endian and lengths uvarints:
+//
+//	block    entry ... crc(4)
+//	entry    kind(1) keyLen valueLen key value
+//	filter   a bloom.Bloom as Save writes it
+//	index    (lastKeyLen lastKey offset length) ... crc(4)
+//	footer   filterOffset(8) filterLen(8) indexOffset(8) indexLen(8) count(8) magic(8)
+//
+// Each CRC-32 (IEEE) covers what comes before it in its block or index.
+// The filter holds a 64-bit FNV-1a hash of each key rather than the key,
+// so the keys need not be kept until Close, which sizes it.
+type Writer struct {
+	w       *bufio.Writer
+	off     uint64
+	opts    Options
+	block   []byte
+	lastKey []byte
+	hashes  []uint64
+	index   []byte
+	closed  bool
+}
+
+// NewWriter returns a Writer to w. opts may be nil for the defaults.
+func NewWriter(w io.Writer, opts *Options) *Writer {
+	o := Options{BlockSize: DefaultBlockSize, FPRate: DefaultFPRate}
+	if opts != nil {
+		if opts.BlockSize > 0 {
+			o.BlockSize = opts.BlockSize
+		}
+		if opts.FPRate > 0 && opts.FPRate < 1 {
+			o.FPRate = opts.FPRate
+		}
+	}
+	return &Writer{w: bufio.NewWriter(w), opts: o}
+}
+
+// Add writes key with value.
+func (w *Writer) Add(key, value []byte) error {
+	return w.add(kindPut, key, value)
+}
+
+// AddTombstone writes a tombstone for key.
+func (w *Writer) AddTombstone(key []byte) error {
+	return w.add(kindTombstone, key, nil)
+}
+
+func (w *Writer) add(kind byte, key, value []byte) error {
+	switch {
+	case w.closed:
+		return ErrClosed
+	case w.hashes != nil && bytes.Compare(key, w.lastKey) <= 0:
+		return ErrOrder
+	}
+	w.block = append(w.block, kind)
+	w.block = binary.AppendUvarint(w.block, uint64(len(key)))
+	w.block = binary.AppendUvarint(w.block, uint64(len(value)))
+	w.block = append(w.block, key...)
+	w.block = append(w.block, value...)
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.hashes = append(w.hashes, keyHash(key))
+	if len(w.block) >= w.opts.BlockSize {
+		w.flushBlock()
+	}
+	return nil
+}
+
+// flushBlock writes the pending block and indexes it by its last key.
+func (w *Writer) flushBlock() {
+	if len(w.block) == 0 {
+		return
+	}
+	w.block = binary.BigEndian.AppendUint32(w.block, crc32.ChecksumIEEE(w.block))
+	w.index = binary.AppendUvarint(w.index, uint64(len(w.lastKey)))
+	w.index = append(w.index, w.lastKey...)
+	w.index = binary.AppendUvarint(w.index, w.off)
+	w.index = binary.AppendUvarint(w.index, uint64(len(w.block)))
+	w.write(w.block)
+	w.block = w.block[:0]
+}
+
+func (w *Writer) write(p []byte) {
+	// bufio keeps the first write error and returns it from Flush
+	w.w.Write(p)
+	w.off += uint64(len(p))
+}
+
+// Close writes the last block, the filter, the index and the footer, and
+// flushes. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	w.flushBlock()
+
+	filter := bloom.NewBloom(uint64(len(w.hashes)), w.opts.FPRate)
+	for _, h := range w.hashes {
+		filter.AddUint64(h)
+	}
+	filterOff := w.off
+	var buf bytes.Buffer
+	if err := filter.Save(&buf); err != nil {
+		return err
+	}
+	w.write(buf.Bytes())
+
+	indexOff := w.off
+	w.index = binary.BigEndian.AppendUint32(w.index, crc32.ChecksumIEEE(w.index))
+	w.write(w.index)
+
+	footer := make([]byte, 0, footerSize)
+	for _, v := range []uint64{filterOff, indexOff - filterOff, indexOff, uint64(len(w.index)), uint64(len(w.hashes)), tableMagic} {
+		footer = binary.BigEndian.AppendUint64(footer, v)
+	}
+	w.write(footer)
+	return w.w.Flush()
+}
+
+func keyHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// blockHandle locates a data block; lastKey is the last key in it.
+type blockHandle struct {
+	lastKey []byte
+	off     uint64
+	length  uint64
+}
+
+// Reader reads a table written by a Writer. It keeps the index and the
+// filter in memory and reads data blocks as they are needed. Safe for
+// concurrent use if the underlying ReaderAt is, as files are.
+type Reader struct {
+	r      io.ReaderAt
+	blocks []blockHandle
+	filter *bloom.Bloom
+	count  uint64
+}
+
+// Open reads the footer, index and filter of the table of size bytes in r.
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < footerSize {
+		return nil, fmt.Errorf("%w: %d bytes is too short", ErrCorrupt, size)
+	}
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-footerSize); err != nil {
+		return nil, err
+	}
+	var f [6]uint64
+	for i := range f {
+		f[i] = binary.BigEndian.Uint64(footer[8*i:])
+	}
+	filterOff, filterLen, indexOff, indexLen, count, magic := f[0], f[1], f[2], f[3], f[4], f[5]
+	body := uint64(size - footerSize)
+	if magic != tableMagic {
+		return nil, fmt.Errorf("%w: bad magic %#x", ErrCorrupt, magic)
+	}
+	if filterOff+filterLen != indexOff || indexOff+indexLen != body || indexLen < 4 {
+		return nil, fmt.Errorf("%w: bad footer", ErrCorrupt)
+	}
+
+	filter, err := bloom.Load(io.NewSectionReader(r, int64(filterOff), int64(filterLen)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: filter: %v", ErrCorrupt, err)
+	}
+	index, err := readChecked(r, indexOff, indexLen)
+	if err != nil {
+		return nil, err
+	}
+	t := &Reader{r: r, filter: filter, count: count}
+	for len(index) > 0 {
+		var h blockHandle
+		n, ok := uvarint(&index)
+		if !ok || n > uint64(len(index)) {
+			return nil, fmt.Errorf("%w: bad index", ErrCorrupt)
+		}
+		h.lastKey, index = index[:n], index[n:]
+		h.off, ok = uvarint(&index)
+		if ok {
+			h.length, ok = uvarint(&index)
+		}
+		if !ok || h.off+h.length > filterOff || h.length < 4 {
+			return nil, fmt.Errorf("%w: bad index", ErrCorrupt)
+		}
+		t.blocks = append(t.blocks, h)
+	}
+	return t, nil
+}
+
+// readChecked reads length bytes at off and checks and strips the CRC
+// that ends them.
+func readChecked(r io.ReaderAt, off, length uint64) ([]byte, error) {
+	buf := make([]byte, length)
+	if _, err := r.ReadAt(buf, int64(off)); err != nil {
+		return nil, err
+	}
+	data := buf[:length-4]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(buf[length-4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorrupt, off)
+	}
+	return data, nil
+}
+
+func uvarint(b *[]byte) (uint64, bool) {
+	v, n := binary.Uvarint(*b)
+	if n <= 0 {
+		return 0, false
+	}
+	*b = (*b)[n:]
+	return v, true
+}
+
+// Len returns the number of entries, tombstones included.
+func (t *Reader) Len() int {
+	return int(t.count)
+}
+
+// Find returns the entry for key, which may be a tombstone. The filter
+// answers most lookups of absent keys without reading a block.
+func (t *Reader) Find(key []byte) (Entry, bool, error) {
+	if !t.filter.MayContainUint64(keyHash(key)) {
+		return Entry{}, false, nil
+	}
+	i := t.blockFor(key)
+	if i == len(t.blocks) {
+		return Entry{}, false, nil
+	}
+	block, err := t.readBlock(i)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	for len(block) > 0 {
+		e, err := nextEntry(&block)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		switch c := bytes.Compare(e.Key, key); {
+		case c == 0:
+			return e, true, nil
+		case c > 0:
+			return Entry{}, false, nil
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// Get returns the value of key; a tombstone is not found.
+func (t *Reader) Get(key []byte) ([]byte, bool, error) {
+	e, ok, err := t.Find(key)
+	if !ok || e.Tombstone {
+		return nil, false, err
+	}
+	return e.Value, true, nil
+}
+
+// blockFor returns the first block that may hold key, the first whose
+// last key is not below it, or len(t.blocks) if there is none.
+func (t *Reader) blockFor(key []byte) int {
+	return sort.Search(len(t.blocks), func(i int) bool {
+		return bytes.Compare(t.blocks[i].lastKey, key) >= 0
+	})
+}
+
+func (t *Reader) readBlock(i int) ([]byte, error) {
+	h := t.blocks[i]
+	return readChecked(t.r, h.off, h.length)
+}
+
+func nextEntry(block *[]byte) (Entry, error) {
+	b := *block
+	if len(b) == 0 || (b[0] != kindPut && b[0] != kindTombstone) {
+		return Entry{}, fmt.Errorf("%w: bad entry", ErrCorrupt)
+	}
+	e := Entry{Tombstone: b[0] == kindTombstone}
+	b = b[1:]
+	kl, ok := uvarint(&b)
+	vl, ok2 := uvarint(&b)
+	if !ok || !ok2 || kl+vl > uint64(len(b)) {
+		return Entry{}, fmt.Errorf("%w: bad entry", ErrCorrupt)
+	}
+	e.Key, e.Value = b[:kl:kl], b[kl:kl+vl:kl+vl]
+	*block = b[kl+vl:]
+	return e, nil
+}
+
+// Cursor walks a table in key order and keeps the error that ended the
+// last walk, as the B+Tree's cursor does.
+type Cursor struct {
+	t   *Reader
+	err error
+}
+
+// Cursor returns a cursor over t.
+func (t *Reader) Cursor() *Cursor {
+	return &Cursor{t: t}
+}
+
+// Err returns the error that ended the last walk, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Entries returns an iterator over the entries with keys from lo up to
+// but not including hi, tombstones included, as an LSM merge needs them.
+// A nil lo starts at the first key and a nil hi runs to the last. Each
+// block is read afresh, so yielded slices may be kept.
+func (c *Cursor) Entries(lo, hi []byte) iter.Seq[Entry] {
+	return func(yield func(Entry) bool) {
+		c.err = nil
+		for i := c.t.blockFor(lo); i < len(c.t.blocks); i++ {
+			block, err := c.t.readBlock(i)
+			if err != nil {
+				c.err = err
+				return
+			}
+			for len(block) > 0 {
+				e, err := nextEntry(&block)
+				if err != nil {
+					c.err = err
+					return
+				}
+				if bytes.Compare(e.Key, lo) < 0 {
+					continue
+				}
+				if hi != nil && bytes.Compare(e.Key, hi) >= 0 {
+					return
+				}
+				if !yield(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Range returns an iterator over the keys from lo up to but not including
+// hi and their values, as Entries bounds them, leaving out tombstones.
+func (c *Cursor) Range(lo, hi []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		for e := range c.Entries(lo, hi) {
+			if !e.Tombstone && !yield(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over every key and value in key order.
+func (c *Cursor) All() iter.Seq2[[]byte, []byte] {
+	return c.Range(nil, nil)
+}
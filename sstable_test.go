@@ -0,0 +1,214 @@
+package sstable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func key(i int) []byte {
+	return fmt.Appendf(nil, "key%05d", i)
+}
+
+func value(i int) []byte {
+	return bytes.Repeat(fmt.Appendf(nil, "v%d", i), i%7+1)
+}
+
+// build writes a table of n keys, every tenth a tombstone, in small blocks.
+func build(t *testing.T, n int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, &Options{BlockSize: 128})
+	for i := range n {
+		var err error
+		if i%10 == 0 {
+			err = w.AddTombstone(key(i))
+		} else {
+			err = w.Add(key(i), value(i))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func open(t *testing.T, table []byte) *Reader {
+	t.Helper()
+	r, err := Open(bytes.NewReader(table), int64(len(table)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	const n = 1000
+	r := open(t, build(t, n))
+	if r.Len() != n {
+		t.Errorf("Len = %d, want %d", r.Len(), n)
+	}
+	if len(r.blocks) < 10 {
+		t.Fatalf("%d blocks, want many", len(r.blocks))
+	}
+	for i := range n {
+		v, ok, err := r.Get(key(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%10 == 0 {
+			if ok {
+				t.Errorf("Get of deleted %s found %q", key(i), v)
+			}
+			if e, ok, _ := r.Find(key(i)); !ok || !e.Tombstone {
+				t.Errorf("Find(%s) = %+v, %v; want a tombstone", key(i), e, ok)
+			}
+			continue
+		}
+		if !ok || !bytes.Equal(v, value(i)) {
+			t.Errorf("Get(%s) = %q, %v; want %q", key(i), v, ok, value(i))
+		}
+	}
+	for _, k := range []string{"", "key", "key00000x", "key99999", "zzz"} {
+		if _, ok, err := r.Find([]byte(k)); ok || err != nil {
+			t.Errorf("Find(%q) = %v, %v", k, ok, err)
+		}
+	}
+}
+
+func TestRangeAcrossBlocks(t *testing.T) {
+	r := open(t, build(t, 1000))
+	check := func(lo, hi []byte, from, to int) {
+		t.Helper()
+		var want []int
+		for i := from; i < to; i++ {
+			if i%10 != 0 {
+				want = append(want, i)
+			}
+		}
+		c := r.Cursor()
+		n := 0
+		for k, v := range c.Range(lo, hi) {
+			if n >= len(want) || !bytes.Equal(k, key(want[n])) || !bytes.Equal(v, value(want[n])) {
+				t.Fatalf("Range(%q, %q) yielded %s as entry %d", lo, hi, k, n)
+			}
+			n++
+		}
+		if err := c.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n != len(want) {
+			t.Errorf("Range(%q, %q) yielded %d entries, want %d", lo, hi, n, len(want))
+		}
+	}
+	check(nil, nil, 0, 1000)
+	check(key(123), key(877), 123, 877)
+	check([]byte("key00123x"), key(124), 124, 124)
+	check(key(995), nil, 995, 1000)
+	check(nil, key(5), 0, 5)
+	check([]byte("zzz"), nil, 0, 0)
+
+	// Entries keeps the tombstones, which an LSM merge needs
+	tombstones := 0
+	for e := range r.Cursor().Entries(key(100), key(200)) {
+		if e.Tombstone {
+			tombstones++
+		}
+	}
+	if tombstones != 10 {
+		t.Errorf("Entries yielded %d tombstones, want 10", tombstones)
+	}
+
+	// Stopping early is fine
+	for k := range r.Cursor().All() {
+		if !bytes.Equal(k, key(1)) {
+			t.Errorf("first key %s, want %s", k, key(1))
+		}
+		break
+	}
+}
+
+func TestWriterOrder(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	if err := w.Add([]byte("b"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"b", "a", ""} {
+		if err := w.Add([]byte(k), nil); !errors.Is(err, ErrOrder) {
+			t.Errorf("Add(%q) after b: %v, want ErrOrder", k, err)
+		}
+	}
+	if err := w.AddTombstone([]byte("a")); !errors.Is(err, ErrOrder) {
+		t.Errorf("AddTombstone(a) after b: %v, want ErrOrder", err)
+	}
+	if err := w.Add([]byte("c"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add([]byte("d"), nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Add after Close: %v, want ErrClosed", err)
+	}
+	r := open(t, buf.Bytes())
+	if v, ok, _ := r.Get([]byte("c")); !ok || string(v) != "3" || r.Len() != 2 {
+		t.Errorf("Get(c) = %q, %v in a table of %d", v, ok, r.Len())
+	}
+
+	// An empty table is valid
+	buf.Reset()
+	if err := NewWriter(&buf, nil).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r := open(t, buf.Bytes()); r.Len() != 0 {
+		t.Errorf("empty table has %d entries", r.Len())
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	table := build(t, 1000)
+	r := open(t, table)
+	first := r.blocks[0]
+
+	// A flipped byte in a data block fails its CRC when it is read
+	bad := bytes.Clone(table)
+	bad[first.off+first.length/2] ^= 0x40
+	r = open(t, bad)
+	if _, _, err := r.Get(key(1)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Get from a corrupt block: %v, want ErrCorrupt", err)
+	}
+	c := r.Cursor()
+	for range c.All() {
+	}
+	if !errors.Is(c.Err(), ErrCorrupt) {
+		t.Errorf("scan over a corrupt block: %v, want ErrCorrupt", c.Err())
+	}
+	if v, ok, err := r.Get(key(999)); err != nil || !ok || !bytes.Equal(v, value(999)) {
+		t.Errorf("Get from an intact block = %q, %v, %v", v, ok, err)
+	}
+
+	// The index, footer and size are checked on Open
+	footer := len(table) - footerSize
+	for name, table := range map[string][]byte{
+		"index":     flip(table, footer-2),
+		"magic":     flip(table, len(table)-1),
+		"footer":    flip(table, footer+7),
+		"truncated": table[:len(table)-1],
+		"short":     table[:footerSize-1],
+	} {
+		if _, err := Open(bytes.NewReader(table), int64(len(table))); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Open with a bad %s: %v, want ErrCorrupt", name, err)
+		}
+	}
+}
+
+func flip(table []byte, i int) []byte {
+	bad := bytes.Clone(table)
+	bad[i] ^= 0x01
+	return bad
+}
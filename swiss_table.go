@@ -0,0 +1,267 @@
+package splitordered
+
+import (
+	"encoding/binary"
+	"iter"
+	"math/bits"
+	"sync"
+)
+
+const (
+	swissGroupSize = 16
+	// Control bytes: a full slot holds the low 7 bits of its key's hash
+	swissEmpty   = 0x80
+	swissDeleted = 0xFE
+
+	swissLSB = 0x0101010101010101
+	swissMSB = 0x8080808080808080
+)
+
+// SwissMap is an open-addressing map of uint64 keys to uint64 values laid
+// out like a Swiss table. Slots come in groups of 16 with one control byte
+// each, holding 7 bits of the key's hash or marking the slot empty or
+// deleted. The rest of the hash picks the first group to probe; a probe
+// compares all 16 control bytes at once, eight per 64-bit word, and reads
+// keys only where a byte matches, so it touches the keys in one cache line
+// or two per group. Groups are probed quadratically. Keys are mixed with
+// splitmix64.
+type SwissMap struct {
+	mu     sync.RWMutex
+	ctrl   []byte
+	keys   []uint64
+	values []uint64
+	// groups - 1, groups being a power of two
+	mask      uint64
+	count     uint64
+	tombstone uint64
+	resizes   uint64
+}
+
+func NewSwissMap() *SwissMap {
+	sm := &SwissMap{}
+	sm.allocate(1)
+	return sm
+}
+
+func (sm *SwissMap) allocate(groups int) {
+	n := groups * swissGroupSize
+	sm.ctrl = make([]byte, n)
+	for i := range sm.ctrl {
+		sm.ctrl[i] = swissEmpty
+	}
+	sm.keys = make([]uint64, n)
+	sm.values = make([]uint64, n)
+	sm.mask = uint64(groups - 1)
+	sm.tombstone = 0
+}
+
+// swissMatch returns the high bit of every byte of word equal to b. It
+// may also flag a byte just above a true match; callers compare keys
+// anyway.
+func swissMatch(word uint64, b byte) uint64 {
+	x := word ^ (swissLSB * uint64(b))
+	return (x - swissLSB) &^ x & swissMSB
+}
+
+// swissMatchEmpty returns the high bit of every empty byte of word: those
+// with the high bit set and bit 1 clear, as deleted has it set.
+func swissMatchEmpty(word uint64) uint64 {
+	return word &^ (word << 6) & swissMSB
+}
+
+// group returns the two control words of group g.
+func (sm *SwissMap) group(g uint64) (uint64, uint64) {
+	base := g * swissGroupSize
+	return binary.LittleEndian.Uint64(sm.ctrl[base:]), binary.LittleEndian.Uint64(sm.ctrl[base+8:])
+}
+
+// slot returns the index of key, or -1.
+func (sm *SwissMap) slot(key uint64) int {
+	h := mix64(key)
+	h2 := byte(h & 0x7F)
+	g := (h >> 7) & sm.mask
+	for step := uint64(1); ; step++ {
+		lo, hi := sm.group(g)
+		base := int(g * swissGroupSize)
+		for m := swissMatch(lo, h2); m != 0; m &= m - 1 {
+			if i := base + bits.TrailingZeros64(m)/8; sm.keys[i] == key {
+				return i
+			}
+		}
+		for m := swissMatch(hi, h2); m != 0; m &= m - 1 {
+			if i := base + 8 + bits.TrailingZeros64(m)/8; sm.keys[i] == key {
+				return i
+			}
+		}
+		// An insert would have used an empty slot here rather than go on
+		if swissMatchEmpty(lo)|swissMatchEmpty(hi) != 0 {
+			return -1
+		}
+		g = (g + step) & sm.mask
+	}
+}
+
+// Put maps key to value, and reports whether key is new.
+func (sm *SwissMap) Put(key, value uint64) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if i := sm.slot(key); i >= 0 {
+		sm.values[i] = value
+		return false
+	}
+	// Keep at least one slot in eight empty, so probes end quickly
+	capacity := uint64(len(sm.ctrl))
+	if (sm.count+sm.tombstone+1)*8 > capacity*7 {
+		groups := len(sm.ctrl) / swissGroupSize
+		if sm.count*2 >= capacity*7/8 {
+			groups *= 2
+		}
+		// Otherwise mostly tombstones: rehash at the same size
+		sm.resize(groups)
+	}
+	sm.place(key, value)
+	sm.count++
+	return true
+}
+
+// place stores a key known to be absent in the first empty or deleted
+// slot along its probe sequence.
+func (sm *SwissMap) place(key, value uint64) {
+	h := mix64(key)
+	g := (h >> 7) & sm.mask
+	for step := uint64(1); ; step++ {
+		lo, hi := sm.group(g)
+		base := int(g * swissGroupSize)
+		// Empty and deleted both have the high bit set
+		i := -1
+		if m := lo & swissMSB; m != 0 {
+			i = base + bits.TrailingZeros64(m)/8
+		} else if m := hi & swissMSB; m != 0 {
+			i = base + 8 + bits.TrailingZeros64(m)/8
+		}
+		if i >= 0 {
+			if sm.ctrl[i] == swissDeleted {
+				sm.tombstone--
+			}
+			sm.ctrl[i] = byte(h & 0x7F)
+			sm.keys[i], sm.values[i] = key, value
+			return
+		}
+		g = (g + step) & sm.mask
+	}
+}
+
+func (sm *SwissMap) resize(groups int) {
+	ctrl, keys, values := sm.ctrl, sm.keys, sm.values
+	sm.allocate(groups)
+	for i, c := range ctrl {
+		if c&0x80 == 0 {
+			sm.place(keys[i], values[i])
+		}
+	}
+	sm.resizes++
+}
+
+func (sm *SwissMap) Get(key uint64) (uint64, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if i := sm.slot(key); i >= 0 {
+		return sm.values[i], true
+	}
+	return 0, false
+}
+
+func (sm *SwissMap) Contains(key uint64) bool {
+	_, ok := sm.Get(key)
+	return ok
+}
+
+// Delete removes key, returning the value it had.
+func (sm *SwissMap) Delete(key uint64) (uint64, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	i := sm.slot(key)
+	if i < 0 {
+		return 0, false
+	}
+	value := sm.values[i]
+	// A group that still has an empty slot has never been full, so no
+	// probe has gone past it and the slot can be emptied; otherwise it
+	// must stay a tombstone to keep later keys reachable
+	lo, hi := sm.group(uint64(i / swissGroupSize))
+	if swissMatchEmpty(lo)|swissMatchEmpty(hi) != 0 {
+		sm.ctrl[i] = swissEmpty
+	} else {
+		sm.ctrl[i] = swissDeleted
+		sm.tombstone++
+	}
+	sm.count--
+	if groups := len(sm.ctrl) / swissGroupSize; groups > 1 && sm.count*8 < uint64(len(sm.ctrl)) {
+		sm.resize(groups / 2)
+	}
+	return value, true
+}
+
+// ProbeStats reports how many groups past its first each key sits.
+func (sm *SwissMap) ProbeStats() ProbeStats {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	s := ProbeStats{Slots: uint64(len(sm.ctrl))}
+	for i, c := range sm.ctrl {
+		if c&0x80 != 0 {
+			continue
+		}
+		want := uint64(i / swissGroupSize)
+		g := (mix64(sm.keys[i]) >> 7) & sm.mask
+		n := 0
+		for step := uint64(1); g != want; step++ {
+			g = (g + step) & sm.mask
+			n++
+		}
+		s.addProbe(n)
+	}
+	s.finish()
+	return s
+}
+
+// All returns an iterator over the keys and values in slot order. They are
+// gathered before the first is yielded, so the loop body may modify the
+// map.
+func (sm *SwissMap) All() iter.Seq2[uint64, uint64] {
+	return func(yield func(uint64, uint64) bool) {
+		sm.mu.RLock()
+		keys := make([]uint64, 0, sm.count)
+		values := make([]uint64, 0, sm.count)
+		for i, c := range sm.ctrl {
+			if c&0x80 == 0 {
+				keys = append(keys, sm.keys[i])
+				values = append(values, sm.values[i])
+			}
+		}
+		sm.mu.RUnlock()
+
+		for i, key := range keys {
+			if !yield(key, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+func (sm *SwissMap) Count() uint64 {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.count
+}
+
+// Resizes returns how many times the table has been rebuilt, to grow,
+// shrink or clear tombstones.
+func (sm *SwissMap) Resizes() uint64 {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.resizes
+}
@@ -0,0 +1,298 @@
+package tdigest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"sync"
+)
+
+// DefaultCompression keeps a digest to a few hundred centroids, with
+// quantile errors well under 1% and far smaller near the tails.
+const DefaultCompression = 100
+
+// tdMagic starts every saved digest.
+const tdMagic = 0x54444731 // "TDG1"
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest estimates quantiles of a stream of values in bounded memory, for
+// latency histograms and key distributions. It keeps the values as
+// centroids, each a mean and a count, ordered by mean. Centroids may hold
+// many values in the middle of the distribution but only a few near either
+// end, where the scale function k(q) = compression/(2π) asin(2q-1) grows
+// steeply and no centroid may span more than one unit of k; that keeps the
+// extreme quantiles accurate. Values are buffered and merged into the
+// centroids in batches.
+type TDigest struct {
+	mu          sync.Mutex
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	total       float64 // weight of centroids and buffer
+	min, max    float64
+}
+
+// New returns an empty digest. Higher compression keeps more centroids
+// and is more accurate; DefaultCompression suits most uses.
+func New(compression float64) *TDigest {
+	if compression < 20 {
+		compression = 20
+	}
+	return &TDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (t *TDigest) Add(x float64) {
+	t.AddWeighted(x, 1)
+}
+
+// AddWeighted adds x as if it had been added weight times. NaN values and
+// weights that are not positive are ignored.
+func (t *TDigest) AddWeighted(x, weight float64) {
+	if math.IsNaN(x) || !(weight > 0) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(centroid{x, weight})
+	t.min = math.Min(t.min, x)
+	t.max = math.Max(t.max, x)
+}
+
+func (t *TDigest) add(c centroid) {
+	t.buffer = append(t.buffer, c)
+	t.total += c.weight
+	if len(t.buffer) >= int(5*t.compression) {
+		t.compress()
+	}
+}
+
+// k is the scale function, mapping a quantile to the units in which
+// centroid sizes are bounded.
+func (t *TDigest) k(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// compress merges the buffer into the centroids in one pass over both in
+// mean order, joining neighbours while the result spans at most one unit
+// of k.
+func (t *TDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buffer...)
+	slices.SortFunc(all, func(a, b centroid) int {
+		switch {
+		case a.mean < b.mean:
+			return -1
+		case a.mean > b.mean:
+			return 1
+		}
+		return 0
+	})
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	// Weight of the centroids before cur
+	before := 0.0
+	kLeft := t.k(0)
+	for _, c := range all[1:] {
+		q := (before + cur.weight + c.weight) / t.total
+		if t.k(q)-kLeft <= 1 {
+			// Weighted mean, in the form that stays between the two
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		merged = append(merged, cur)
+		before += cur.weight
+		kLeft = t.k(before / t.total)
+		cur = c
+	}
+	t.centroids = append(merged, cur)
+	t.buffer = t.buffer[:0]
+}
+
+// Quantile returns the estimated value below which a fraction q of the
+// values fall, or NaN for an empty digest. It interpolates between
+// centroid means, and between the extreme centroids and the smallest and
+// largest values added.
+func (t *TDigest) Quantile(q float64) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.compress()
+
+	if len(t.centroids) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return t.min
+	}
+	if q >= 1 {
+		return t.max
+	}
+
+	index := q * t.total
+	first := t.centroids[0]
+	if index < first.weight/2 {
+		return t.min + (first.mean-t.min)*index/(first.weight/2)
+	}
+	// Centroid i is taken as centred at cum + weight/2
+	cum := 0.0
+	for i := 0; i < len(t.centroids)-1; i++ {
+		a, b := t.centroids[i], t.centroids[i+1]
+		left := cum + a.weight/2
+		right := cum + a.weight + b.weight/2
+		if index < right {
+			return a.mean + (b.mean-a.mean)*(index-left)/(right-left)
+		}
+		cum += a.weight
+	}
+	last := t.centroids[len(t.centroids)-1]
+	left := t.total - last.weight/2
+	return last.mean + (t.max-last.mean)*(index-left)/(last.weight/2)
+}
+
+// Count returns the total weight added.
+func (t *TDigest) Count() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// Merge adds the values summarized by o to t.
+func (t *TDigest) Merge(o *TDigest) {
+	if t == o {
+		return
+	}
+	// Copy o out first, so two merges in opposite directions cannot
+	// deadlock
+	o.mu.Lock()
+	cs := append(slices.Clone(o.centroids), o.buffer...)
+	lo, hi := o.min, o.max
+	o.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range cs {
+		t.add(c)
+	}
+	t.min = math.Min(t.min, lo)
+	t.max = math.Max(t.max, hi)
+}
+
+// Save writes the digest to w, for Load. The format, all integers and
+// floats big-endian:
+//
+//	magic(4) compression(8) min(8) max(8) centroids(4)
+//	mean(8) weight(8), each centroid
+//	crc(4)  CRC-32 (IEEE) of everything before it
+func (t *TDigest) Save(w io.Writer) error {
+	t.mu.Lock()
+	t.compress()
+	cs := slices.Clone(t.centroids)
+	compression, lo, hi := t.compression, t.min, t.max
+	t.mu.Unlock()
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	var buf [8]byte
+	putFloat := func(f float64) {
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(f))
+		bw.Write(buf[:])
+	}
+	binary.BigEndian.PutUint32(buf[:4], tdMagic)
+	bw.Write(buf[:4])
+	putFloat(compression)
+	putFloat(lo)
+	putFloat(hi)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(cs)))
+	bw.Write(buf[:4])
+	for _, c := range cs {
+		putFloat(c.mean)
+		putFloat(c.weight)
+	}
+	// bufio keeps the first write error and returns it here
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc.Sum32())
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// Load reads a digest written by Save. It reads r directly, no further
+// than the digest's end, so a digest can be embedded in a larger stream.
+func Load(r io.Reader) (*TDigest, error) {
+	crc := crc32.NewIEEE()
+	br := io.TeeReader(r, crc)
+	var buf [8]byte
+	getFloat := func() (float64, error) {
+		_, err := io.ReadFull(br, buf[:])
+		return math.Float64frombits(binary.BigEndian.Uint64(buf[:])), err
+	}
+
+	if _, err := io.ReadFull(br, buf[:4]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(buf[:4]) != tdMagic {
+		return nil, errors.New("not a saved t-digest")
+	}
+	compression, err := getFloat()
+	if err != nil {
+		return nil, err
+	}
+	lo, err := getFloat()
+	if err != nil {
+		return nil, err
+	}
+	hi, err := getFloat()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(br, buf[:4]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(buf[:4])
+	// A digest never holds more than a few times compression centroids
+	if !(compression >= 20 && compression <= 1e6) || float64(n) > 10*compression {
+		return nil, fmt.Errorf("corrupt t-digest: compression %g, %d centroids", compression, n)
+	}
+
+	t := New(compression)
+	t.min, t.max = lo, hi
+	t.centroids = make([]centroid, n)
+	for i := range t.centroids {
+		c := &t.centroids[i]
+		if c.mean, err = getFloat(); err != nil {
+			return nil, err
+		}
+		if c.weight, err = getFloat(); err != nil {
+			return nil, err
+		}
+		if !(c.weight > 0) || c.mean < lo || c.mean > hi || i > 0 && c.mean < t.centroids[i-1].mean {
+			return nil, fmt.Errorf("corrupt t-digest: centroid %d", i)
+		}
+		t.total += c.weight
+	}
+	sum := crc.Sum32()
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(buf[:4]) != sum {
+		return nil, errors.New("corrupt t-digest: checksum mismatch")
+	}
+	return t, nil
+}
@@ -0,0 +1,176 @@
+package tdigest
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// checkQuantiles compares t's quantiles to those of sorted, which holds
+// the values added to it, allowing an error in rank of half a percent
+// plus a twentieth of the rank's distance from the nearer tail.
+func checkQuantiles(t *testing.T, name string, td *TDigest, sorted []float64) {
+	t.Helper()
+	n := float64(len(sorted))
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999} {
+		got := td.Quantile(q)
+		// The rank of the estimate among the values
+		rank, _ := slices.BinarySearch(sorted, got)
+		tail := math.Min(q, 1-q)
+		if err := math.Abs(float64(rank)/n - q); err > 0.005+0.05*tail {
+			t.Errorf("%s: Quantile(%g) = %g, of rank %.4f", name, q, got, float64(rank)/n)
+		}
+	}
+}
+
+func TestQuantiles(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	for _, tc := range []struct {
+		name string
+		gen  func(i int) float64
+	}{
+		{"uniform", func(int) float64 { return r.Float64() * 1000 }},
+		{"normal", func(int) float64 { return r.NormFloat64()*10 + 50 }},
+		{"exponential", func(int) float64 { return r.ExpFloat64() }},
+		{"ascending", func(i int) float64 { return float64(i) }},
+		{"descending", func(i int) float64 { return float64(-i) }},
+	} {
+		td := New(DefaultCompression)
+		values := make([]float64, 100000)
+		for i := range values {
+			values[i] = tc.gen(i)
+			td.Add(values[i])
+		}
+		slices.Sort(values)
+		checkQuantiles(t, tc.name, td, values)
+		if td.Quantile(0) != values[0] || td.Quantile(1) != values[len(values)-1] {
+			t.Errorf("%s: extremes %g and %g, want %g and %g", tc.name, td.Quantile(0), td.Quantile(1), values[0], values[len(values)-1])
+		}
+		if n := len(td.centroids); n > 2*DefaultCompression {
+			t.Errorf("%s: %d centroids", tc.name, n)
+		}
+	}
+}
+
+func TestEdgeCases(t *testing.T) {
+	td := New(DefaultCompression)
+	if q := td.Quantile(0.5); !math.IsNaN(q) {
+		t.Errorf("quantile of an empty digest = %g", q)
+	}
+	td.Add(math.NaN())
+	td.AddWeighted(1, 0)
+	td.AddWeighted(1, -1)
+	if td.Count() != 0 {
+		t.Errorf("count after ignored adds = %g", td.Count())
+	}
+	td.Add(7)
+	for _, q := range []float64{0, 0.3, 1} {
+		if got := td.Quantile(q); got != 7 {
+			t.Errorf("Quantile(%g) of one value = %g", q, got)
+		}
+	}
+	if !math.IsNaN(td.Quantile(math.NaN())) {
+		t.Error("Quantile(NaN) is not NaN")
+	}
+
+	// A weighted add counts as that many adds
+	a, b := New(DefaultCompression), New(DefaultCompression)
+	for i := range 100 {
+		a.AddWeighted(float64(i), 10)
+		for range 10 {
+			b.Add(float64(i))
+		}
+	}
+	if a.Count() != 1000 || math.Abs(a.Quantile(0.5)-b.Quantile(0.5)) > 1 {
+		t.Errorf("weighted digest: count %g, median %g, unweighted median %g", a.Count(), a.Quantile(0.5), b.Quantile(0.5))
+	}
+}
+
+func TestMerge(t *testing.T) {
+	r := rand.New(rand.NewPCG(2, 2))
+	parts := make([]*TDigest, 8)
+	var values []float64
+	for i := range parts {
+		parts[i] = New(DefaultCompression)
+		// Each part covers its own range, as shards of a key space would
+		for range 10000 {
+			v := float64(i)*100 + r.Float64()*150
+			parts[i].Add(v)
+			values = append(values, v)
+		}
+	}
+	merged := New(DefaultCompression)
+	for _, p := range parts {
+		merged.Merge(p)
+	}
+	merged.Merge(merged)
+	slices.Sort(values)
+	if merged.Count() != float64(len(values)) {
+		t.Errorf("merged count %g, want %d", merged.Count(), len(values))
+	}
+	checkQuantiles(t, "merged", merged, values)
+}
+
+func TestSaveLoad(t *testing.T) {
+	td := New(200)
+	for i := range 50000 {
+		td.Add(float64(i % 977))
+	}
+	var b bytes.Buffer
+	if err := td.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	saved := bytes.Clone(b.Bytes())
+	b.WriteString("trailer")
+	got, err := Load(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(&b); string(rest) != "trailer" {
+		t.Errorf("bytes after the digest = %q, want %q", rest, "trailer")
+	}
+	if got.Count() != td.Count() {
+		t.Errorf("loaded count %g, want %g", got.Count(), td.Count())
+	}
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if got.Quantile(q) != td.Quantile(q) {
+			t.Errorf("loaded Quantile(%g) = %g, want %g", q, got.Quantile(q), td.Quantile(q))
+		}
+	}
+
+	for i, bad := range [][]byte{
+		nil,
+		saved[:len(saved)-1],
+		append([]byte("XXXX"), saved[4:]...),
+		func() []byte { b := bytes.Clone(saved); b[30]++; return b }(),
+		func() []byte { b := bytes.Clone(saved); b[len(b)-1]++; return b }(),
+	} {
+		if _, err := Load(bytes.NewReader(bad)); err == nil {
+			t.Errorf("Load of damaged digest %d succeeded", i)
+		}
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	td := New(DefaultCompression)
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 10000 {
+				td.Add(float64(w*10000 + i))
+			}
+		}()
+	}
+	wg.Wait()
+	// How the runs interleave varies from one run to the next, and runs
+	// of ascending values are hard on a digest, so allow 2% in rank
+	if td.Count() != 80000 || math.Abs(td.Quantile(0.5)-40000) > 1600 {
+		t.Errorf("count %g, median %g", td.Count(), td.Quantile(0.5))
+	}
+}
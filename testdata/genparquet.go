@@ -0,0 +1,527 @@
+//go:build ignore
+
+// genparquet writes the Parquet files the loader tests read, straight
+// from the format's specification rather than through the loader's own
+// reader: the Thrift compact protocol, pages and encodings are written by
+// hand here, and Snappy pages by github.com/golang/snappy. Run it from
+// this directory with that package available:
+//
+//	go run genparquet.go
+//
+// The rows of each file are given by the functions below; the tests
+// compute the same values.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"log"
+	"os"
+
+	"github.com/golang/snappy"
+)
+
+// Parquet's enumerations
+const (
+	typeInt32     = 1
+	typeInt64     = 2
+	typeByteArray = 6
+
+	required = 0
+	optional = 1
+
+	uncompressed = 0
+	codecSnappy  = 1
+	codecGzip    = 2
+
+	dataPage       = 0
+	dictionaryPage = 2
+	dataPageV2     = 3
+
+	plain           = 0
+	rle             = 3
+	deltaBinary     = 5
+	rleDictionary   = 8
+	convertedUint32 = 13
+)
+
+// Thrift compact protocol types
+const (
+	tTrue   = 1
+	tFalse  = 2
+	tByte   = 3
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+// thrift writes the compact protocol. Structs are written by fields in
+// increasing id order.
+type thrift struct {
+	b    bytes.Buffer
+	last []int16
+}
+
+func (t *thrift) uvarint(v uint64) { t.b.Write(binary.AppendUvarint(nil, v)) }
+func (t *thrift) zigzag(v int64)   { t.uvarint(uint64(v<<1) ^ uint64(v>>63)) }
+
+func (t *thrift) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		t.b.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.b.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (t *thrift) begin()                { t.last = append(t.last, 0) }
+func (t *thrift) end()                  { t.b.WriteByte(0); t.last = t.last[:len(t.last)-1] }
+func (t *thrift) i32(id int16, v int64) { t.field(id, tI32); t.zigzag(v) }
+func (t *thrift) i64(id int16, v int64) { t.field(id, tI64); t.zigzag(v) }
+func (t *thrift) str(id int16, s string) {
+	t.field(id, tBinary)
+	t.uvarint(uint64(len(s)))
+	t.b.WriteString(s)
+}
+func (t *thrift) boolean(id int16, v bool) {
+	if v {
+		t.field(id, tTrue)
+	} else {
+		t.field(id, tFalse)
+	}
+}
+func (t *thrift) list(id int16, typ byte, n int) {
+	t.field(id, tList)
+	if n < 15 {
+		t.b.WriteByte(byte(n)<<4 | typ)
+	} else {
+		t.b.WriteByte(0xf0 | typ)
+		t.uvarint(uint64(n))
+	}
+}
+func (t *thrift) structField(id int16) { t.field(id, tStruct); t.begin() }
+
+// column describes a column and how to write it.
+type column struct {
+	name       string
+	typ        int64
+	repetition int64
+	converted  int64 // -1 for none
+	unsigned   bool  // INTEGER logical type, not signed
+	codec      int64
+	encoding   int64 // plain, deltaBinary or rleDictionary
+	v2         bool  // version 2 data pages
+	pageRows   int   // rows per data page
+}
+
+// value is a cell: an integer, a string for BYTE_ARRAY, or null.
+type value struct {
+	n    int64
+	s    string
+	null bool
+}
+
+type chunkMeta struct {
+	col                    *column
+	numValues              int
+	dictOffset, dataOffset int64
+	size, rawSize          int64
+}
+
+type file struct {
+	out    bytes.Buffer
+	cols   []*column
+	groups [][]chunkMeta
+	rows   []int
+}
+
+func (c *column) compress(b []byte) []byte {
+	switch c.codec {
+	case codecSnappy:
+		return snappy.Encode(nil, b)
+	case codecGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	return b
+}
+
+func (c *column) plainValues(vs []value) []byte {
+	var b []byte
+	for _, v := range vs {
+		switch c.typ {
+		case typeInt32:
+			b = binary.LittleEndian.AppendUint32(b, uint32(v.n))
+		case typeInt64:
+			b = binary.LittleEndian.AppendUint64(b, uint64(v.n))
+		case typeByteArray:
+			b = binary.LittleEndian.AppendUint32(b, uint32(len(v.s)))
+			b = append(b, v.s...)
+		}
+	}
+	return b
+}
+
+// bitPack packs values of width bits, least significant bit first, in
+// groups of eight, padding the last group with zeros.
+func bitPack(vs []uint64, width int) []byte {
+	for len(vs)%8 != 0 {
+		vs = append(vs, 0)
+	}
+	b := make([]byte, len(vs)*width/8)
+	bit := 0
+	for _, v := range vs {
+		for i := 0; i < width; i++ {
+			if v>>i&1 == 1 {
+				b[bit>>3] |= 1 << (bit & 7)
+			}
+			bit++
+		}
+	}
+	return b
+}
+
+// hybrid encodes values in the RLE/bit-packed hybrid encoding: runs of 8
+// or more equal values as RLE runs, the rest bit-packed.
+func hybrid(vs []uint64, width int) []byte {
+	var b []byte
+	for len(vs) > 0 {
+		run := 1
+		for run < len(vs) && vs[run] == vs[0] {
+			run++
+		}
+		if run >= 8 {
+			b = binary.AppendUvarint(b, uint64(run)<<1)
+			for i := 0; i < (width+7)/8; i++ {
+				b = append(b, byte(vs[0]>>(8*i)))
+			}
+			vs = vs[run:]
+			continue
+		}
+		n := min(len(vs), 64)
+		b = binary.AppendUvarint(b, uint64((n+7)/8)<<1|1)
+		b = append(b, bitPack(vs[:n], width)...)
+		vs = vs[n:]
+	}
+	return b
+}
+
+// delta encodes values in DELTA_BINARY_PACKED, blocks of 128 in four
+// miniblocks.
+func delta(vs []int64) []byte {
+	const block, minis = 128, 4
+	b := binary.AppendUvarint(nil, block)
+	b = binary.AppendUvarint(b, minis)
+	b = binary.AppendUvarint(b, uint64(len(vs)))
+	b = binary.AppendVarint(b, vs[0])
+	for rest := vs; len(rest) > 1; {
+		n := min(len(rest)-1, block)
+		deltas := make([]int64, n)
+		minDelta := int64(1<<63 - 1)
+		for i := range deltas {
+			deltas[i] = rest[i+1] - rest[i]
+			minDelta = min(minDelta, deltas[i])
+		}
+		b = binary.AppendVarint(b, minDelta)
+		var widths [minis]byte
+		var bodies [][]byte
+		for m := 0; m*block/minis < n; m++ {
+			mini := deltas[m*block/minis : min((m+1)*block/minis, n)]
+			us := make([]uint64, block/minis)
+			width := 0
+			for i, d := range mini {
+				us[i] = uint64(d - minDelta)
+				for us[i]>>width != 0 {
+					width++
+				}
+			}
+			widths[m] = byte(width)
+			bodies = append(bodies, bitPack(us, width))
+		}
+		b = append(b, widths[:]...)
+		for _, body := range bodies {
+			b = append(b, body...)
+		}
+		rest = rest[n:]
+	}
+	return b
+}
+
+func pageHeader(typ int64, raw, compressed int, body func(t *thrift)) []byte {
+	t := &thrift{}
+	t.begin()
+	t.i32(1, typ)
+	t.i32(2, int64(raw))
+	t.i32(3, int64(compressed))
+	body(t)
+	t.end()
+	return t.b.Bytes()
+}
+
+// writeChunk writes the pages of one column chunk.
+func (f *file) writeChunk(c *column, vs []value) chunkMeta {
+	m := chunkMeta{col: c, numValues: len(vs), dictOffset: -1}
+	start := int64(f.out.Len())
+
+	var dict []value
+	index := map[int64]uint64{}
+	if c.encoding == rleDictionary {
+		for _, v := range vs {
+			if _, ok := index[v.n]; !ok && !v.null {
+				index[v.n] = uint64(len(dict))
+				dict = append(dict, v)
+			}
+		}
+		raw := c.plainValues(dict)
+		page := c.compress(raw)
+		m.dictOffset = start
+		f.out.Write(pageHeader(dictionaryPage, len(raw), len(page), func(t *thrift) {
+			t.structField(7)
+			t.i32(1, int64(len(dict)))
+			t.i32(2, plain)
+			t.end()
+		}))
+		f.out.Write(page)
+		m.rawSize += int64(len(raw))
+	}
+
+	m.dataOffset = int64(f.out.Len())
+	for len(vs) > 0 {
+		page := vs[:min(c.pageRows, len(vs))]
+		vs = vs[len(page):]
+
+		var levels []byte
+		var present []value
+		nulls := 0
+		if c.repetition == optional {
+			var defs []uint64
+			for _, v := range page {
+				if v.null {
+					defs = append(defs, 0)
+					nulls++
+				} else {
+					defs = append(defs, 1)
+					present = append(present, v)
+				}
+			}
+			levels = hybrid(defs, 1)
+		} else {
+			present = page
+		}
+
+		var values []byte
+		switch c.encoding {
+		case plain:
+			values = c.plainValues(present)
+		case deltaBinary:
+			ns := make([]int64, len(present))
+			for i, v := range present {
+				ns[i] = v.n
+			}
+			values = delta(ns)
+		case rleDictionary:
+			width := 0
+			for uint64(len(dict)-1)>>width != 0 {
+				width++
+			}
+			idx := make([]uint64, len(present))
+			for i, v := range present {
+				idx[i] = index[v.n]
+			}
+			values = append([]byte{byte(width)}, hybrid(idx, width)...)
+		}
+
+		if c.v2 {
+			body := c.compress(values)
+			f.out.Write(pageHeader(dataPageV2, len(levels)+len(values), len(levels)+len(body), func(t *thrift) {
+				t.structField(8)
+				t.i32(1, int64(len(page)))
+				t.i32(2, int64(nulls))
+				t.i32(3, int64(len(page)))
+				t.i32(4, c.encoding)
+				t.i32(5, int64(len(levels)))
+				t.i32(6, 0)
+				t.boolean(7, c.codec != uncompressed)
+				t.end()
+			}))
+			f.out.Write(levels)
+			f.out.Write(body)
+			m.rawSize += int64(len(levels) + len(values))
+			continue
+		}
+		var raw []byte
+		if levels != nil {
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(len(levels)))
+			raw = append(raw, levels...)
+		}
+		raw = append(raw, values...)
+		body := c.compress(raw)
+		f.out.Write(pageHeader(dataPage, len(raw), len(body), func(t *thrift) {
+			t.structField(5)
+			t.i32(1, int64(len(page)))
+			t.i32(2, c.encoding)
+			t.i32(3, rle)
+			t.i32(4, rle)
+			t.end()
+		}))
+		f.out.Write(body)
+		m.rawSize += int64(len(raw))
+	}
+	m.size = int64(f.out.Len()) - start
+	return m
+}
+
+// writeGroup writes a row group of rows, cells[i][j] for column j.
+func (f *file) writeGroup(cells [][]value) {
+	var group []chunkMeta
+	for j, c := range f.cols {
+		vs := make([]value, len(cells))
+		for i := range cells {
+			vs[i] = cells[i][j]
+		}
+		group = append(group, f.writeChunk(c, vs))
+	}
+	f.groups = append(f.groups, group)
+	f.rows = append(f.rows, len(cells))
+}
+
+func (f *file) footer() []byte {
+	t := &thrift{}
+	t.begin()
+	t.i32(1, 1)
+	t.list(2, tStruct, len(f.cols)+1)
+	t.begin()
+	t.str(4, "schema")
+	t.i32(5, int64(len(f.cols)))
+	t.end()
+	for _, c := range f.cols {
+		t.begin()
+		t.i32(1, c.typ)
+		t.i32(3, c.repetition)
+		t.str(4, c.name)
+		if c.converted >= 0 {
+			t.i32(6, c.converted)
+		}
+		if c.unsigned {
+			t.structField(10) // LogicalType
+			t.structField(10) // INTEGER
+			t.field(1, tByte)
+			t.b.WriteByte(32)
+			t.boolean(2, false)
+			t.end()
+			t.end()
+		}
+		t.end()
+	}
+	total := 0
+	for _, n := range f.rows {
+		total += n
+	}
+	t.i64(3, int64(total))
+	t.list(4, tStruct, len(f.groups))
+	for g, group := range f.groups {
+		t.begin()
+		t.list(1, tStruct, len(group))
+		var size int64
+		for _, m := range group {
+			size += m.rawSize
+			t.begin()
+			t.i64(2, m.dataOffset)
+			t.structField(3)
+			t.i32(1, m.col.typ)
+			t.list(2, tI32, 1)
+			t.zigzag(m.col.encoding)
+			t.list(3, tBinary, 1)
+			t.uvarint(uint64(len(m.col.name)))
+			t.b.WriteString(m.col.name)
+			t.i32(4, m.col.codec)
+			t.i64(5, int64(m.numValues))
+			t.i64(6, m.rawSize)
+			t.i64(7, m.size)
+			t.i64(9, m.dataOffset)
+			if m.dictOffset >= 0 {
+				t.i64(11, m.dictOffset)
+			}
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, int64(f.rows[g]))
+		t.end()
+	}
+	t.str(6, "genparquet")
+	t.end()
+	return t.b.Bytes()
+}
+
+func write(name string, cols []*column, groups ...[][]value) {
+	f := &file{cols: cols}
+	f.out.WriteString("PAR1")
+	for _, g := range groups {
+		f.writeGroup(g)
+	}
+	footer := f.footer()
+	f.out.Write(footer)
+	f.out.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	f.out.WriteString("PAR1")
+	if err := os.WriteFile(name, f.out.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func rows(from, to int, row func(i int) []value) [][]value {
+	var cells [][]value
+	for i := from; i < to; i++ {
+		cells = append(cells, row(i))
+	}
+	return cells
+}
+
+func main() {
+	// plain.parquet: INT64 id and val around a BYTE_ARRAY name, PLAIN and
+	// uncompressed, in two row groups of several pages
+	plainRow := func(i int) []value {
+		return []value{{n: int64(i * 7919 % 1000 * 1000003)}, {s: "row"}, {n: int64(i * i)}}
+	}
+	write("plain.parquet", []*column{
+		{name: "id", typ: typeInt64, converted: -1, encoding: plain, pageRows: 300},
+		{name: "name", typ: typeByteArray, converted: -1, encoding: plain, pageRows: 300},
+		{name: "val", typ: typeInt64, converted: -1, encoding: plain, pageRows: 300},
+	}, rows(0, 600, plainRow), rows(600, 1000, plainRow))
+
+	// dict_snappy.parquet: an unsigned INT32 key above 1<<31, PLAIN, and
+	// an optional INT64 value of ten distinct values, dictionary encoded,
+	// both Snappy compressed
+	write("dict_snappy.parquet", []*column{
+		{name: "key", typ: typeInt32, converted: -1, unsigned: true, codec: codecSnappy, encoding: plain, pageRows: 256},
+		{name: "value", typ: typeInt64, repetition: optional, converted: -1, codec: codecSnappy, encoding: rleDictionary, pageRows: 256},
+	}, rows(0, 1000, func(i int) []value {
+		return []value{{n: int64(int32(0xf0000000 + uint32(i*7919%1000)))}, {n: int64(i%10) * 1e12}}
+	}))
+
+	// gzip_v2.parquet: version 2 pages, gzip compressed, of a
+	// DELTA_BINARY_PACKED INT64 key and a signed INT32 value
+	v2Row := func(i int) []value {
+		return []value{{n: int64(i*5 + i%3 + i/700*1e15)}, {n: int64(i - 500)}}
+	}
+	write("gzip_v2.parquet", []*column{
+		{name: "key", typ: typeInt64, converted: -1, codec: codecGzip, encoding: deltaBinary, v2: true, pageRows: 400},
+		{name: "value", typ: typeInt32, converted: -1, codec: codecGzip, encoding: plain, v2: true, pageRows: 400},
+	}, rows(0, 700, v2Row), rows(700, 1000, v2Row))
+
+	// nulls.parquet: an optional UINT_32 value with a null in row 5
+	write("nulls.parquet", []*column{
+		{name: "key", typ: typeInt64, converted: -1, encoding: plain, pageRows: 100},
+		{name: "value", typ: typeInt32, repetition: optional, converted: convertedUint32, encoding: plain, pageRows: 100},
+	}, rows(0, 10, func(i int) []value {
+		return []value{{n: int64(i)}, {n: int64(i), null: i == 5}}
+	}))
+}